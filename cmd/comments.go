@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+var (
+	commentsSiteKey   string
+	commentsIDs       []string
+	commentsOlderThan time.Duration
+	commentsAll       bool
+	commentsDryRun    bool
+	commentsJSON      bool
+)
+
+// init configures package-level command and flag wiring.
+func init() {
+	rootCmd.AddCommand(commentsCmd)
+	commentsCmd.AddCommand(commentsPurgeCmd)
+
+	commentsPurgeCmd.Flags().StringVar(&commentsSiteKey, "site-key", "", "Site Key from config.comment_sites (default: all sites)")
+	commentsPurgeCmd.Flags().StringSliceVar(&commentsIDs, "id", nil, "Only purge these comments (requires --site-key)")
+	commentsPurgeCmd.Flags().DurationVar(&commentsOlderThan, "older-than", 0, "Purge comments deleted before this age, e.g. 720h (default: apply trash.purge_after_days)")
+	commentsPurgeCmd.Flags().BoolVar(&commentsAll, "all", false, "Purge all deleted comments regardless of their age")
+	commentsPurgeCmd.Flags().BoolVar(&commentsDryRun, "dry-run", false, "Only count the comments that would be purged")
+	commentsPurgeCmd.Flags().BoolVar(&commentsJSON, "json", false, "Print JSON instead of text")
+}
+
+var commentsCmd = &cobra.Command{
+	Use:   "comments",
+	Short: "Manage stored comments",
+}
+
+var commentsPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Permanently remove deleted comments",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if commentsOlderThan < 0 {
+			return fmt.Errorf("older-than must not be negative")
+		}
+		if commentsAll && commentsOlderThan > 0 {
+			return fmt.Errorf("--all and --older-than cannot be combined")
+		}
+		if len(commentsIDs) > 0 && strings.TrimSpace(commentsSiteKey) == "" {
+			return fmt.Errorf("--id requires --site-key")
+		}
+
+		database, cleanup, err := openDatabase()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		sites, err := commentsSites(ctx, database)
+		if err != nil {
+			return err
+		}
+
+		var n int64
+		now := time.Now()
+		for siteKey, siteID := range sites {
+			f := db.PurgeFilter{SiteID: siteID, IDs: commentsIDs}
+			switch {
+			case commentsAll || len(commentsIDs) > 0:
+			case commentsOlderThan > 0:
+				f.DeletedBefore = now.Add(-commentsOlderThan).Unix()
+			default:
+				days := config.Cfg.CommentSites[siteKey].Trash.PurgeAfterDays
+				if days <= 0 {
+					continue
+				}
+				f.DeletedBefore = now.AddDate(0, 0, -days).Unix()
+			}
+
+			if commentsDryRun {
+				count, err := database.CountPurgeableComments(ctx, f)
+				if err != nil {
+					return err
+				}
+				n += count
+				continue
+			}
+			ids, err := database.PurgeComments(ctx, f)
+			if err != nil {
+				return err
+			}
+			n += int64(len(ids))
+		}
+
+		if commentsJSON {
+			return printJSON(map[string]any{"purged": n, "dry_run": commentsDryRun})
+		}
+		if commentsDryRun {
+			fmt.Printf("Would purge %d comments\n", n)
+		} else {
+			fmt.Printf("Purged %d comments\n", n)
+		}
+		return nil
+	},
+}
+
+// commentsSites returns the site IDs of the --site-key flag by site key, or all sites.
+func commentsSites(ctx context.Context, database *db.DB) (map[string]int64, error) {
+	if key := strings.TrimSpace(commentsSiteKey); key != "" {
+		siteID, found, err := database.GetSiteIDByKey(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown site key %q", key)
+		}
+		return map[string]int64{key: siteID}, nil
+	}
+
+	sites, err := database.ListSites(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]int64, len(sites))
+	for _, s := range sites {
+		out[s.SiteKey] = s.ID
+	}
+	return out, nil
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/geschke/fyndmark/pkg/git"
+	"github.com/spf13/cobra"
+)
+
+// init configures package-level command and flag wiring.
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configCheckCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validate the configuration including the workspace audit",
+	Long: `Loads and validates the configuration like "fyndmark serve" does at startup,
+including the audit of repo_url, clone_dir and theme target_path settings.
+Nothing is cloned and no server is started.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// The other checks already ran when the configuration was loaded.
+		if err := git.AuditConfig(); err != nil {
+			return fmt.Errorf("workspace audit failed: %w", err)
+		}
+		fmt.Println("Configuration OK.")
+		return nil
+	},
+}
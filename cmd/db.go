@@ -3,18 +3,118 @@
 import (
 	"context"
 	"fmt"
+	"log"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/geschke/fyndmark/config"
 	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/spf13/cobra"
 )
 
+var (
+	dbCheckFix  bool
+	dbBackupOut string
+)
+
+// init configures package-level command and flag wiring.
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbCheckCmd)
+	dbCmd.AddCommand(dbBackupCmd)
+
+	dbCheckCmd.Flags().BoolVar(&dbCheckFix, "fix", false, "Repair fixable issues (missing timestamps, orphaned replies, dangling run rows)")
+	dbBackupCmd.Flags().StringVar(&dbBackupOut, "out", "", "Backup file to write (required, must not exist)")
+
+	_ = dbBackupCmd.MarkFlagRequired("out")
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Database maintenance commands",
+}
+
+var dbCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the database file, its foreign keys and the consistency of comments and pipeline runs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, cleanup, err := openDatabase()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		report, err := database.Check(ctx, dbCheckFix)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("integrity_check: %s\n", strings.Join(report.Integrity, "; "))
+		if len(report.Integrity) != 1 || report.Integrity[0] != "ok" {
+			fmt.Println("  The database file is damaged: stop the server and restore a backup, or rescue the data with sqlite3 .recover")
+		}
+		if len(report.Issues) == 0 {
+			fmt.Println("No consistency issues found")
+		}
+		for _, is := range report.Issues {
+			switch {
+			case dbCheckFix && is.Fixable:
+				fmt.Printf("  %s: %d (fixed %d)\n", is.Check, is.Count, is.Fixed)
+			case is.Fixable:
+				fmt.Printf("  %s: %d (fixable with --fix)\n", is.Check, is.Count)
+			case is.Hint != "":
+				fmt.Printf("  %s: %d (manual repair needed: %s)\n", is.Check, is.Count, is.Hint)
+			default:
+				fmt.Printf("  %s: %d (manual repair needed)\n", is.Check, is.Count)
+			}
+		}
+
+		if !report.OK() {
+			return fmt.Errorf("database check found problems")
+		}
+		return nil
+	},
+}
+
+var dbBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Write a consistent copy of the SQLite database, also while the server runs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := strings.TrimSpace(dbBackupOut)
+		if path == "" {
+			return fmt.Errorf("--out is required")
+		}
+
+		// The database is copied as it is, without migrating it first.
+		database, err := openConfiguredDatabase()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = database.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer cancel()
+
+		if err := database.Backup(ctx, path); err != nil {
+			return err
+		}
+		if err := os.Chmod(path, 0o600); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		fmt.Printf("Backup written to %s\n", path)
+		return nil
+	},
+}
+
 // openDatabase performs its package-specific operation.
 func openDatabase() (*db.DB, func(), error) {
-	database, err := db.Open(config.Cfg.SQLite.Path)
+	database, err := openConfiguredDatabase()
 	if err != nil {
-		return nil, nil, fmt.Errorf("db open failed (sqlite.path=%q): %w", config.Cfg.SQLite.Path, err)
+		return nil, nil, err
 	}
 
 	if err := database.Migrate(); err != nil {
@@ -30,15 +130,52 @@ func openDatabase() (*db.DB, func(), error) {
 		return nil, nil, fmt.Errorf("collect configured site keys failed: %w", err)
 	}
 
-	if err := database.SyncSites(ctx, configuredSites); err != nil {
+	summary, err := database.SyncSites(ctx, configuredSites, db.SyncOptions{KeepMissing: config.Cfg.SiteSync.KeepMissing})
+	if err != nil {
 		_ = database.Close()
 		return nil, nil, fmt.Errorf("sync sites from config failed: %w", err)
 	}
+	logSyncSummary(summary)
 
 	cleanup := func() { _ = database.Close() }
 	return database, cleanup, nil
 }
 
+// openConfiguredDatabase opens the database selected by database.driver.
+func openConfiguredDatabase() (*db.DB, error) {
+	switch config.Cfg.Database.Driver {
+	case db.DriverPostgres:
+		database, err := db.OpenPostgres(config.Cfg.Database.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("db open failed (database.driver=postgres): %w", err)
+		}
+		return database, nil
+	case db.DriverMySQL:
+		database, err := db.OpenMySQL(config.Cfg.Database.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("db open failed (database.driver=mysql): %w", err)
+		}
+		return database, nil
+	}
+
+	database, err := db.Open(config.Cfg.SQLite.Path)
+	if err != nil {
+		return nil, fmt.Errorf("db open failed (sqlite.path=%q): %w", config.Cfg.SQLite.Path, err)
+	}
+	return database, nil
+}
+
+// logSyncSummary logs the changes of a site sync, with a warning for kept or disabled sites.
+func logSyncSummary(s db.SyncSummary) {
+	log.Printf("Sites synced from config: %s", s)
+	for _, key := range s.Missing {
+		log.Printf("WARN: site %q is missing from comment_sites but kept active (site_sync.keep_missing)", key)
+	}
+	for _, key := range s.Disabled {
+		log.Printf("WARN: site %q was disabled because it is missing from comment_sites", key)
+	}
+}
+
 // collectConfiguredSites performs its package-specific operation.
 func collectConfiguredSites(cfg map[string]config.CommentsSiteConfig) (map[string]string, error) {
 	out := make(map[string]string, len(cfg))
@@ -3,6 +3,7 @@
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/geschke/fyndmark/pkg/generator"
@@ -10,12 +11,16 @@ import (
 )
 
 var (
-	siteKey string
+	siteKey    string
+	tarOutPath string
+	strictGen  bool
 )
 
 // init configures package-level command and flag wiring.
 func init() {
 	generateCommentsCmd.Flags().StringVar(&siteKey, "site-key", "", "Site Key from config.comment_sites (required)")
+	generateCommentsCmd.Flags().StringVar(&tarOutPath, "tar", "", "Write the comment files as .tar.gz to this path instead of the git workdir")
+	generateCommentsCmd.Flags().BoolVar(&strictGen, "strict", false, "Fail if approved comments belong to a post_path without page bundle")
 	rootCmd.AddCommand(generateCommentsCmd)
 }
 
@@ -39,8 +44,39 @@ var generateCommentsCmd = &cobra.Command{
 		g := generator.Generator{
 			DB:      database,
 			SiteKey: siteKey,
+			Strict:  strictGen,
 		}
+		defer printOrphans(&g)
 
-		return g.Generate(context.Background())
+		if tarOutPath == "" {
+			return g.Generate(context.Background())
+		}
+
+		f, err := os.Create(tarOutPath)
+		if err != nil {
+			return fmt.Errorf("create %s: %w", tarOutPath, err)
+		}
+		defer f.Close()
+
+		tarOut := generator.NewTarOutput(f)
+		g.Output = tarOut
+		if err := g.Generate(context.Background()); err != nil {
+			return err
+		}
+		if err := tarOut.Close(); err != nil {
+			return err
+		}
+		return f.Close()
 	},
 }
+
+// printOrphans lists the post paths whose comments were not written.
+func printOrphans(g *generator.Generator) {
+	if len(g.Orphans) == 0 {
+		return
+	}
+	fmt.Printf("%d post_paths without page bundle:\n", len(g.Orphans))
+	for _, o := range g.Orphans {
+		fmt.Printf("  %s (%s, %d comments)\n", o.PostPath, o.Reason, o.Comments)
+	}
+}
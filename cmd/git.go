@@ -22,7 +22,7 @@ func init() {
 	gitCommitCmd.Flags().StringVar(&gitSiteID, "site-id", "", "Site ID from config.comment_sites (required)")
 	gitPushCmd.Flags().StringVar(&gitSiteID, "site-id", "", "Site ID from config.comment_sites (required)")
 
-	gitCommitCmd.Flags().StringVar(&gitCommitMsg, "message", "Update generated content", "Commit message")
+	gitCommitCmd.Flags().StringVar(&gitCommitMsg, "message", "", "Commit message (default: git.commit_message of the site)")
 
 	rootCmd.AddCommand(gitCheckoutCmd)
 	rootCmd.AddCommand(gitCommitCmd)
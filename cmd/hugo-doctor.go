@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/hugo"
+	"github.com/spf13/cobra"
+)
+
+// init configures package-level command and flag wiring.
+func init() {
+	hugoDoctorCmd.Flags().StringVar(&hugoDoctorSiteId, "site-id", "", "Site ID from config.comment_sites (default: all sites)")
+	rootCmd.AddCommand(hugoDoctorCmd)
+}
+
+var hugoDoctorSiteId string
+
+var hugoDoctorCmd = &cobra.Command{
+	Use:   "hugo-doctor",
+	Short: "Check the Hugo binary and version of comment sites",
+	Long: `Runs "hugo version" with the binary and environment configured for each site
+and checks it against hugo.min_version, hugo.version and hugo.extended.
+Sites with hugo.disabled are skipped.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		siteIDs := []string{strings.TrimSpace(hugoDoctorSiteId)}
+		if siteIDs[0] == "" {
+			siteIDs = siteIDs[:0]
+			for siteID := range config.Cfg.CommentSites {
+				siteIDs = append(siteIDs, siteID)
+			}
+			sort.Strings(siteIDs)
+		}
+
+		failed := 0
+		for _, siteID := range siteIDs {
+			siteCfg, ok := config.Cfg.CommentSites[siteID]
+			if !ok {
+				return fmt.Errorf("unknown site_id %q (not found in comment_sites)", siteID)
+			}
+			if siteCfg.Hugo.Disabled {
+				fmt.Printf("%s: skipped (hugo.disabled)\n", siteID)
+				continue
+			}
+			v, err := hugo.Preflight(context.Background(), siteID)
+			if err != nil {
+				failed++
+				fmt.Printf("%s: FAILED: %v\n", siteID, err)
+				continue
+			}
+			fmt.Printf("%s: OK, %s (%s)\n", siteID, v, hugo.Bin(siteCfg.Hugo))
+		}
+		if failed > 0 {
+			return fmt.Errorf("hugo check failed for %d site(s)", failed)
+		}
+		return nil
+	},
+}
@@ -4,18 +4,22 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/geschke/fyndmark/pkg/db"
 	"github.com/geschke/fyndmark/pkg/pipeline"
 	"github.com/spf13/cobra"
 )
 
 var (
 	runSiteKey string
+	runDryRun  bool
 )
 
 // init configures package-level command and flag wiring.
 func init() {
 	pipelineRunCmd.Flags().StringVar(&runSiteKey, "site-key", "", "Site Key from config.comment_sites (required)")
+	pipelineRunCmd.Flags().BoolVar(&runDryRun, "dry-run", false, "Run checkout, generate and Hugo, skip commit and push and print the planned file changes")
 	rootCmd.AddCommand(pipelineRunCmd)
 }
 
@@ -39,6 +43,7 @@ var pipelineRunCmd = &cobra.Command{
 		r := pipeline.Runner{
 			DB:      database,
 			SiteKey: siteKey,
+			DryRun:  runDryRun,
 		}
 
 		runID, err := r.Run(context.Background(), "")
@@ -46,7 +51,36 @@ var pipelineRunCmd = &cobra.Command{
 			return err
 		}
 
+		if runDryRun {
+			if err := printPlannedFiles(database, runID); err != nil {
+				return err
+			}
+		}
 		fmt.Printf("Pipeline finished (run_id=%d)\n", runID)
 		return nil
 	},
 }
+
+// printPlannedFiles prints the comment files a dry run would have committed.
+func printPlannedFiles(database *db.DB, runID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	run, found, err := database.GetRun(ctx, runID)
+	if err != nil || !found {
+		return err
+	}
+	files, _, err := database.ListRunFiles(ctx, run.SiteID, runID)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Println("Dry run: no file changes")
+		return nil
+	}
+	fmt.Printf("Dry run: %d file changes not committed:\n", len(files))
+	for _, f := range files {
+		fmt.Printf("  %-8s %s\n", f.Action, f.Path)
+	}
+	return nil
+}
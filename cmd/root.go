@@ -6,6 +6,14 @@ import (
 	"os"
 
 	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/commentid"
+	"github.com/geschke/fyndmark/pkg/generator"
+	"github.com/geschke/fyndmark/pkg/gitcli"
+	"github.com/geschke/fyndmark/pkg/hugo"
+	"github.com/geschke/fyndmark/pkg/pipeline"
+	"github.com/geschke/fyndmark/pkg/sandbox"
+	"github.com/geschke/fyndmark/pkg/secrets"
+	"github.com/geschke/fyndmark/pkg/webhooks"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -41,6 +49,30 @@ fyndmark focuses on simplicity and full control — just files, Git, and Hugo.`,
 			if err != nil {
 				return fmt.Errorf("failed to init configuration: %w", err)
 			}
+			if err := secrets.ValidateConfig(); err != nil {
+				return fmt.Errorf("failed to init configuration: %w", err)
+			}
+			if err := webhooks.ValidateConfig(); err != nil {
+				return fmt.Errorf("failed to init configuration: %w", err)
+			}
+			if err := gitcli.ValidateConfig(); err != nil {
+				return fmt.Errorf("failed to init configuration: %w", err)
+			}
+			if err := sandbox.ValidateConfig(); err != nil {
+				return fmt.Errorf("failed to init configuration: %w", err)
+			}
+			if err := commentid.ValidateConfig(); err != nil {
+				return fmt.Errorf("failed to init configuration: %w", err)
+			}
+			if err := generator.ValidateConfig(); err != nil {
+				return fmt.Errorf("failed to init configuration: %w", err)
+			}
+			if err := pipeline.ValidateConfig(); err != nil {
+				return fmt.Errorf("failed to init configuration: %w", err)
+			}
+			if err := hugo.ValidateConfig(); err != nil {
+				return fmt.Errorf("failed to init configuration: %w", err)
+			}
 			return nil
 		},
 	}
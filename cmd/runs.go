@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/pipeline"
+	"github.com/spf13/cobra"
+)
+
+var (
+	runsSiteKey   string
+	runsState     string
+	runsSince     string
+	runsLimit     int
+	runsJSON      bool
+	runsLogs      bool
+	runsOlderThan time.Duration
+	runsDryRun    bool
+)
+
+// init configures package-level command and flag wiring.
+func init() {
+	rootCmd.AddCommand(runsCmd)
+	runsCmd.AddCommand(runsListCmd)
+	runsCmd.AddCommand(runsShowCmd)
+	runsCmd.AddCommand(runsRetryCmd)
+	runsCmd.AddCommand(runsPruneCmd)
+
+	runsCmd.PersistentFlags().BoolVar(&runsJSON, "json", false, "Print JSON instead of text")
+
+	for _, c := range []*cobra.Command{runsListCmd, runsPruneCmd} {
+		c.Flags().StringVar(&runsSiteKey, "site-key", "", "Site Key from config.comment_sites (default: all sites)")
+		c.Flags().StringVar(&runsState, "state", "", "Only runs in this state ("+strings.Join(db.RunStates, ", ")+")")
+	}
+	runsListCmd.Flags().StringVar(&runsSince, "since", "", "Only runs created since then: duration (24h), date (2006-01-02) or RFC 3339 time")
+	runsListCmd.Flags().IntVar(&runsLimit, "limit", 50, "Maximum number of runs (0 = all)")
+	runsShowCmd.Flags().BoolVar(&runsLogs, "logs", false, "Include the captured git and Hugo output")
+	runsPruneCmd.Flags().DurationVar(&runsOlderThan, "older-than", 0, "Delete finished runs created before this age, e.g. 720h (default: apply pipeline.retention)")
+	runsPruneCmd.Flags().BoolVar(&runsDryRun, "dry-run", false, "Only count the runs that would be deleted")
+}
+
+var runsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "Inspect and manage pipeline runs",
+}
+
+var runsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pipeline runs, newest first",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, cleanup, err := openDatabase()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		filter, err := runsFilter(ctx, database)
+		if err != nil {
+			return err
+		}
+		if filter.Since, err = parseSince(runsSince); err != nil {
+			return err
+		}
+		if runsLimit < 0 {
+			return fmt.Errorf("limit must be >= 0")
+		}
+		filter.Limit = runsLimit
+
+		runs, err := database.ListRuns(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if runsJSON {
+			return printJSON(runs)
+		}
+
+		if len(runs) == 0 {
+			fmt.Println("(no runs)")
+			return nil
+		}
+		for _, r := range runs {
+			fmt.Printf("id=%d site_key=%s state=%s attempts=%d created_at=%s", r.ID, r.SiteKey, r.State, r.Attempts, formatUnix(r.CreatedAt))
+			if r.Step != "" {
+				fmt.Printf(" step=%s", r.Step)
+			}
+			if r.ErrorMessage != "" {
+				fmt.Printf(" error=%q", r.ErrorMessage)
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+var runsShowCmd = &cobra.Command{
+	Use:   "show <run-id>",
+	Short: "Show a pipeline run and the files it changed",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runID, err := parseRunID(args[0])
+		if err != nil {
+			return err
+		}
+
+		database, cleanup, err := openDatabase()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		run, found, err := database.GetRun(ctx, runID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("run %d not found", runID)
+		}
+		files, _, err := database.ListRunFiles(ctx, run.SiteID, runID)
+		if err != nil {
+			return err
+		}
+		var logs []db.RunLogChunk
+		if runsLogs {
+			if logs, err = database.ListRunLogs(ctx, runID); err != nil {
+				return err
+			}
+		}
+
+		if runsJSON {
+			out := map[string]any{"run": run, "files": files}
+			if runsLogs {
+				out["logs"] = logs
+			}
+			return printJSON(out)
+		}
+
+		fmt.Printf("id:            %d\n", run.ID)
+		fmt.Printf("site_key:      %s\n", run.SiteKey)
+		fmt.Printf("state:         %s\n", run.State)
+		fmt.Printf("trigger:       %s\n", run.TriggerCommentID)
+		fmt.Printf("attempts:      %d\n", run.Attempts)
+		fmt.Printf("created_at:    %s\n", formatUnix(run.CreatedAt))
+		fmt.Printf("started_at:    %s\n", formatUnix(run.StartedAt))
+		fmt.Printf("finished_at:   %s\n", formatUnix(run.FinishedAt))
+		if run.NextRetryAt > 0 {
+			fmt.Printf("next_retry_at: %s\n", formatUnix(run.NextRetryAt))
+		}
+		if run.CoalescedInto > 0 {
+			fmt.Printf("coalesced_into: %d\n", run.CoalescedInto)
+		}
+		if run.Step != "" {
+			fmt.Printf("step:          %s\n", run.Step)
+		}
+		if run.ErrorMessage != "" {
+			fmt.Printf("error:         %s\n", run.ErrorMessage)
+		}
+		if len(files) > 0 {
+			fmt.Println("files:")
+			for _, f := range files {
+				fmt.Printf("  %-8s %s\n", f.Action, f.Path)
+			}
+		}
+		current := ""
+		for _, chunk := range logs {
+			if chunk.Step != current {
+				current = chunk.Step
+				fmt.Printf("==> %s\n", current)
+			}
+			fmt.Print(chunk.Content)
+			if !strings.HasSuffix(chunk.Content, "\n") {
+				fmt.Println()
+			}
+		}
+		return nil
+	},
+}
+
+var runsRetryCmd = &cobra.Command{
+	Use:   "retry <run-id>",
+	Short: "Run a failed, retrying or cancelled pipeline run again in the foreground",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runID, err := parseRunID(args[0])
+		if err != nil {
+			return err
+		}
+
+		database, cleanup, err := openDatabase()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		run, found, err := database.GetRun(ctx, runID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("run %d not found", runID)
+		}
+		changed, err := database.RequeueRun(ctx, runID)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return fmt.Errorf("run %d is %s; only failed, retrying or cancelled runs can be retried", runID, run.State)
+		}
+
+		r := pipeline.Runner{
+			DB:      database,
+			SiteKey: run.SiteKey,
+		}
+		if err := r.RunExisting(context.Background(), runID); err != nil {
+			_ = database.MarkRunFailed(runID, "pipeline", fmt.Sprintf("run failed: %v", err))
+			return err
+		}
+
+		fmt.Printf("Pipeline finished (run_id=%d)\n", runID)
+		return nil
+	},
+}
+
+var runsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete finished pipeline runs with their logs and file lists",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if runsOlderThan < 0 {
+			return fmt.Errorf("older-than must not be negative")
+		}
+		if runsOlderThan == 0 && strings.TrimSpace(runsState) != "" {
+			return fmt.Errorf("--state requires --older-than")
+		}
+
+		database, cleanup, err := openDatabase()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		filter, err := runsFilter(ctx, database)
+		if err != nil {
+			return err
+		}
+
+		var n int64
+		if runsOlderThan > 0 {
+			filter.Until = time.Now().Add(-runsOlderThan).Unix()
+			if runsDryRun {
+				n, err = database.CountPrunableRuns(ctx, filter)
+			} else {
+				n, err = database.PruneRuns(ctx, filter)
+			}
+		} else {
+			n, err = pruneByRetention(ctx, database, filter.SiteIDs)
+		}
+		if err != nil {
+			return err
+		}
+
+		if runsJSON {
+			return printJSON(map[string]any{"deleted": n, "dry_run": runsDryRun})
+		}
+		if runsDryRun {
+			fmt.Printf("Would delete %d runs\n", n)
+		} else {
+			fmt.Printf("Deleted %d runs\n", n)
+		}
+		return nil
+	},
+}
+
+// pruneByRetention applies the pipeline.retention settings of the given sites.
+// Sites without retention settings are skipped.
+func pruneByRetention(ctx context.Context, database *db.DB, siteIDs []int64) (int64, error) {
+	var total int64
+	now := time.Now()
+	for _, siteID := range siteIDs {
+		site, found, err := database.GetSiteByID(ctx, siteID)
+		if err != nil {
+			return total, err
+		}
+		siteCfg, ok := config.Cfg.CommentSites[site.SiteKey]
+		if !found || !ok {
+			continue
+		}
+		r := pipeline.Retention(siteCfg.Pipeline, now)
+		var n int64
+		if runsDryRun {
+			n, err = database.CountRunsByRetention(ctx, siteID, r)
+		} else {
+			n, err = database.PruneRunsByRetention(ctx, siteID, r)
+		}
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// runsFilter returns the run filter of the --site-key and --state flags.
+func runsFilter(ctx context.Context, database *db.DB) (db.RunListFilter, error) {
+	var f db.RunListFilter
+
+	f.State = strings.TrimSpace(runsState)
+	if f.State != "" && !slices.Contains(db.RunStates, f.State) {
+		return f, fmt.Errorf("unknown state %q (use one of %s)", f.State, strings.Join(db.RunStates, ", "))
+	}
+
+	if key := strings.TrimSpace(runsSiteKey); key != "" {
+		siteID, found, err := database.GetSiteIDByKey(ctx, key)
+		if err != nil {
+			return f, err
+		}
+		if !found {
+			return f, fmt.Errorf("unknown site key %q", key)
+		}
+		f.SiteIDs = []int64{siteID}
+		return f, nil
+	}
+
+	sites, err := database.ListSites(ctx)
+	if err != nil {
+		return f, err
+	}
+	for _, s := range sites {
+		f.SiteIDs = append(f.SiteIDs, s.ID)
+	}
+	return f, nil
+}
+
+// parseSince parses the --since flag: a duration before now, a date or an RFC 3339 time.
+func parseSince(v string) (int64, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return time.Now().Add(-d).Unix(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Unix(), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t.Unix(), nil
+	}
+	return 0, fmt.Errorf("invalid since %q (use e.g. 24h, 2006-01-02 or an RFC 3339 time)", v)
+}
+
+// parseRunID parses a run ID argument.
+func parseRunID(v string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid run id %q", v)
+	}
+	return id, nil
+}
+
+// formatUnix formats a unix timestamp for output, "-" for unset.
+func formatUnix(ts int64) string {
+	if ts <= 0 {
+		return "-"
+	}
+	return time.Unix(ts, 0).Format(time.RFC3339)
+}
+
+// printJSON writes v as indented JSON to stdout.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
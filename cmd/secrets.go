@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/geschke/fyndmark/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+// init configures package-level command and flag wiring.
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsGenerateKeyCmd)
+	secretsCmd.AddCommand(secretsEncryptCmd)
+}
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage encrypted settings (e.g. git access tokens)",
+}
+
+var secretsGenerateKeyCmd = &cobra.Command{
+	Use:   "generate-key",
+	Short: "Print a new random secrets key (for " + secrets.KeyEnv + " or secrets.key_file)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := secrets.GenerateKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	},
+}
+
+var secretsEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Read a plaintext value from stdin and print it encrypted (enc:v1:...)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("read value from stdin: %w", err)
+		}
+		plain := strings.TrimSpace(string(b))
+		if plain == "" {
+			return errors.New("value is empty")
+		}
+
+		enc, err := secrets.Encrypt(plain)
+		if err != nil {
+			return err
+		}
+		fmt.Println(enc)
+		return nil
+	},
+}
@@ -4,6 +4,9 @@ Copyright © 2025 Ralf Geschke <ralf@kuerbis.org>
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/geschke/fyndmark/pkg/git"
 	"github.com/geschke/fyndmark/pkg/server"
 	"github.com/spf13/cobra"
 )
@@ -27,6 +30,11 @@ and can generate markdown files inside each page bundle under
 content/.../comments/ for a Git-based workflow.`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// The workspace audit only guards the server; other commands work with a
+		// broken clone_dir, and checkout audits again before removing anything.
+		if err := git.AuditConfig(); err != nil {
+			return fmt.Errorf("failed to init configuration: %w", err)
+		}
 		database, cleanup, err := openDatabase()
 		if err != nil {
 			return err
@@ -3,15 +3,28 @@
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/embed"
+	"github.com/geschke/fyndmark/pkg/secrets"
 	"github.com/spf13/cobra"
 )
 
+var (
+	embedTokenSiteKey string
+	embedTokenTTL     time.Duration
+)
+
 // init configures package-level command and flag wiring.
 func init() {
 	rootCmd.AddCommand(sitesCmd)
 	sitesCmd.AddCommand(sitesListCmd)
+	sitesCmd.AddCommand(sitesEmbedTokenCmd)
+
+	sitesEmbedTokenCmd.Flags().StringVar(&embedTokenSiteKey, "site-key", "", "Site Key from config.comment_sites (required)")
+	sitesEmbedTokenCmd.Flags().DurationVar(&embedTokenTTL, "ttl", 0, "Token lifetime, e.g. 720h (0 = no expiry)")
 }
 
 var sitesCmd = &cobra.Command{
@@ -57,3 +70,36 @@ var sitesListCmd = &cobra.Command{
 		return nil
 	},
 }
+
+var sitesEmbedTokenCmd = &cobra.Command{
+	Use:   "embed-token",
+	Short: "Issue a signed embed token for the public read API (comment_sites.<site>.embed)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := strings.TrimSpace(embedTokenSiteKey)
+		if key == "" {
+			return fmt.Errorf("site-key is required (use --site-key)")
+		}
+		siteCfg, ok := config.Cfg.CommentSites[key]
+		if !ok {
+			return fmt.Errorf("unknown site key %q (not found in comment_sites)", key)
+		}
+		if strings.TrimSpace(siteCfg.Embed.Secret) == "" {
+			return fmt.Errorf("comment_sites.%s.embed.secret is not set", key)
+		}
+		if embedTokenTTL < 0 {
+			return fmt.Errorf("ttl must be >= 0")
+		}
+
+		secret, err := secrets.Decrypt(siteCfg.Embed.Secret)
+		if err != nil {
+			return fmt.Errorf("comment_sites.%s.embed.secret: %w", key, err)
+		}
+
+		var expires time.Time
+		if embedTokenTTL > 0 {
+			expires = time.Now().Add(embedTokenTTL)
+		}
+		fmt.Println(embed.Issue(secret, key, expires))
+		return nil
+	},
+}
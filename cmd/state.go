@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/state"
+	"github.com/spf13/cobra"
+)
+
+var (
+	stateExportOutput  string
+	stateImportInput   string
+	stateImportReplace bool
+)
+
+// init configures package-level command and flag wiring.
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateExportCmd)
+	stateCmd.AddCommand(stateImportCmd)
+
+	stateExportCmd.Flags().StringVar(&stateExportOutput, "output", "", "Archive file to write (required, e.g. fyndmark-state.tar.gz)")
+	stateImportCmd.Flags().StringVar(&stateImportInput, "input", "", "Archive file to read (required)")
+	stateImportCmd.Flags().BoolVar(&stateImportReplace, "replace", false, "Replace existing users, comments and runs")
+
+	_ = stateExportCmd.MarkFlagRequired("output")
+	_ = stateImportCmd.MarkFlagRequired("input")
+}
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Export or import the full server state",
+}
+
+var stateExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export sites, users, comments and pipeline runs into a portable archive",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, cleanup, err := openDatabase()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		path := strings.TrimSpace(stateExportOutput)
+		if path == "" {
+			return fmt.Errorf("--output is required")
+		}
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return fmt.Errorf("create archive: %w", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		manifest, err := state.Export(ctx, database, f)
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(path)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("close archive: %w", err)
+		}
+
+		fmt.Printf("State exported (file=%s schema_version=%d)\n", path, manifest.SchemaVersion)
+		for _, table := range sortedTableNames(manifest.Tables) {
+			fmt.Printf("  %s: %d\n", table, manifest.Tables[table])
+		}
+		return nil
+	},
+}
+
+var stateImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import a state archive created by 'state export'",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, cleanup, err := openDatabase()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		path := strings.TrimSpace(stateImportInput)
+		if path == "" {
+			return fmt.Errorf("--input is required")
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open archive: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		manifest, err := state.Import(ctx, database, f, stateImportReplace)
+		if err != nil {
+			return err
+		}
+
+		// Re-apply the configured sites, the archive may come from a host with a different config.
+		configuredSites, err := collectConfiguredSites(config.Cfg.CommentSites)
+		if err != nil {
+			return err
+		}
+		summary, err := database.SyncSites(ctx, configuredSites, db.SyncOptions{KeepMissing: config.Cfg.SiteSync.KeepMissing})
+		if err != nil {
+			return fmt.Errorf("sync sites from config failed: %w", err)
+		}
+		logSyncSummary(summary)
+
+		fmt.Printf("State imported (file=%s schema_version=%d exported_at=%d)\n", path, manifest.SchemaVersion, manifest.ExportedAt)
+		for _, table := range sortedTableNames(manifest.Tables) {
+			fmt.Printf("  %s: %d\n", table, manifest.Tables[table])
+		}
+		return nil
+	},
+}
+
+// sortedTableNames returns the manifest tables in export order.
+func sortedTableNames(tables map[string]int64) []string {
+	out := make([]string, 0, len(tables))
+	for _, t := range db.StateTables {
+		if _, ok := tables[t]; ok {
+			out = append(out, t)
+		}
+	}
+	return out
+}
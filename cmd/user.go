@@ -9,7 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/geschke/fyndmark/config"
 	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/sessionstore"
 	"github.com/geschke/fyndmark/pkg/users"
 	"github.com/spf13/cobra"
 )
@@ -126,6 +128,7 @@ var userDeleteCmd = &cobra.Command{
 			if !deleted {
 				return fmt.Errorf("user not found (id=%d)", userDeleteID)
 			}
+			revokeSessions(ctx, database, userDeleteID)
 			fmt.Printf("User deleted (id=%d)\n", userDeleteID)
 			return nil
 		}
@@ -135,6 +138,10 @@ var userDeleteCmd = &cobra.Command{
 			return fmt.Errorf("provide either --id or --email")
 		}
 
+		u, _, err := database.GetUserByEmail(ctx, strings.ToLower(email))
+		if err != nil {
+			return err
+		}
 		deleted, err := users.DeleteByEmail(ctx, database, email)
 		if err != nil {
 			return err
@@ -142,6 +149,7 @@ var userDeleteCmd = &cobra.Command{
 		if !deleted {
 			return fmt.Errorf("user not found (email=%s)", strings.ToLower(email))
 		}
+		revokeSessions(ctx, database, u.ID)
 		fmt.Printf("User deleted (email=%s)\n", strings.ToLower(email))
 		return nil
 	},
@@ -171,13 +179,14 @@ var userListCmd = &cobra.Command{
 		}
 
 		for _, u := range list {
-			fmt.Printf("id=%d email=%s name=%s %s created_at=%d updated_at=%d\n",
+			fmt.Printf("id=%d email=%s name=%s %s created_at=%d updated_at=%d last_login_at=%d\n",
 				u.ID,
 				u.Email,
 				u.FirstName,
 				u.LastName,
 				u.CreatedAt,
 				u.UpdatedAt,
+				u.LastLoginAt,
 			)
 		}
 		return nil
@@ -306,6 +315,24 @@ var userSitesCmd = &cobra.Command{
 	},
 }
 
+// revokeSessions ends the sessions of a deleted user in a Redis session store. SQLite
+// sessions are deleted together with the user.
+func revokeSessions(ctx context.Context, database *db.DB, userID int64) {
+	if !config.Cfg.WebAdmin.Enabled || !strings.EqualFold(strings.TrimSpace(config.Cfg.WebAdmin.SessionStore), sessionstore.TypeRedis) {
+		return
+	}
+	store, err := sessionstore.New(config.Cfg.WebAdmin, database)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARN: revoke sessions: %v\n", err)
+		return
+	}
+	if s, ok := store.(*sessionstore.Store); ok {
+		if _, err := s.RevokeUser(ctx, userID, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "WARN: revoke sessions: %v\n", err)
+		}
+	}
+}
+
 // readPassword performs its package-specific operation.
 func readPassword(cmd *cobra.Command, flagValue string, fromStdin bool) (string, error) {
 	if strings.TrimSpace(flagValue) != "" {
@@ -10,8 +10,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	//	"github.com/geschke/fyndmark/pkg/dbconn"
 	//	logging "github.com/geschke/goar/pkg/logging"
@@ -25,6 +29,63 @@ type ServerConfig struct {
 
 	// TrustedProxies defines reverse proxies (IP or CIDR) whose forwarding headers are trusted.
 	TrustedProxies []string `mapstructure:"trusted_proxies"`
+
+	// BasePath mounts all routes below a prefix, e.g. "/fyndmark". It is normalized
+	// to a leading and no trailing slash; "" mounts them at the root.
+	BasePath string `mapstructure:"base_path"`
+
+	// Timeouts of the HTTP server; 0 selects the default.
+	ReadHeaderTimeoutSeconds int `mapstructure:"read_header_timeout_seconds"`
+	ReadTimeoutSeconds       int `mapstructure:"read_timeout_seconds"`
+	WriteTimeoutSeconds      int `mapstructure:"write_timeout_seconds"`
+	IdleTimeoutSeconds       int `mapstructure:"idle_timeout_seconds"`
+
+	// DrainTimeoutSeconds is how long shutdown waits for a running pipeline run
+	// (0 = 2 minutes). Runs still running afterwards are cancelled and queued again.
+	DrainTimeoutSeconds int `mapstructure:"drain_timeout_seconds"`
+
+	// MaxHeaderBytes limits the size of request headers (0 = 1 MiB).
+	MaxHeaderBytes int `mapstructure:"max_header_bytes"`
+
+	// MaxBodyBytes limits request bodies per route group.
+	MaxBodyBytes ServerBodyLimitsConfig `mapstructure:"max_body_bytes"`
+
+	// MaxStreams limits the concurrent comment event streams.
+	MaxStreams ServerStreamLimitsConfig `mapstructure:"max_streams"`
+
+	// Readiness selects optional checks of GET /readyz.
+	Readiness ReadinessConfig `mapstructure:"readiness"`
+
+	// Pprof exposes the net/http/pprof handlers.
+	Pprof PprofConfig `mapstructure:"pprof"`
+}
+
+// PprofConfig enables the profiling endpoints.
+type PprofConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Listen serves the endpoints on a separate loopback address, e.g. "127.0.0.1:6060".
+	// If empty, they are part of the admin API and require a login.
+	Listen string `mapstructure:"listen"`
+}
+
+// ReadinessConfig holds the optional readiness checks.
+type ReadinessConfig struct {
+	// SMTP checks that the SMTP server accepts a connection and the login.
+	SMTP bool `mapstructure:"smtp"`
+}
+
+// ServerBodyLimitsConfig holds the request body limits in bytes; 0 selects the default.
+type ServerBodyLimitsConfig struct {
+	Comments int64 `mapstructure:"comments"`
+	Forms    int64 `mapstructure:"forms"`
+	Admin    int64 `mapstructure:"admin"`
+}
+
+// ServerStreamLimitsConfig limits the comment event streams per site and per client
+// IP (0 selects the default).
+type ServerStreamLimitsConfig struct {
+	PerSite int `mapstructure:"per_site"`
+	PerIP   int `mapstructure:"per_ip"`
 }
 
 type WebAdminConfig struct {
@@ -42,6 +103,63 @@ type WebAdminConfig struct {
 	CookieSameSite     string   `mapstructure:"cookie_samesite"` // lax|strict|none
 	CookieMaxAgeDays   int      `mapstructure:"cookie_max_age_days"`
 	CORSAllowedOrigins []string `mapstructure:"cors_allowed_origins"`
+
+	// SessionStore is "cookie" (default, sessions live in the signed cookie), "sqlite"
+	// or "redis". Server-side sessions can be revoked.
+	SessionStore string      `mapstructure:"session_store"`
+	SessionRedis RedisConfig `mapstructure:"session_redis"`
+
+	// DisableCSRF turns off the CSRF token check of state-changing admin requests,
+	// e.g. for an old admin frontend that does not send X-CSRF-Token.
+	DisableCSRF bool `mapstructure:"disable_csrf"`
+
+	// MaxPasswordAgeDays forces users to change passwords older than this; 0 = never.
+	// It applies to sessions only, API tokens keep working.
+	MaxPasswordAgeDays int `mapstructure:"max_password_age_days"`
+
+	// OIDC enables single sign-on with an OpenID Connect provider.
+	OIDC OIDCConfig `mapstructure:"oidc"`
+}
+
+// OIDCConfig configures the OpenID Connect login of the admin (authorization code
+// flow with PKCE).
+type OIDCConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Issuer is the issuer URL; its discovery document is read from
+	// <issuer>/.well-known/openid-configuration.
+	Issuer   string `mapstructure:"issuer"`
+	ClientID string `mapstructure:"client_id"`
+	// ClientSecret may be encrypted (see package secrets); empty for public clients.
+	ClientSecret string `mapstructure:"client_secret"`
+	// RedirectURL is the callback URL registered at the provider,
+	// e.g. "https://comments.example.com/api/auth/oidc/callback".
+	RedirectURL string `mapstructure:"redirect_url"`
+	// SuccessURL is where the browser is sent after the login, usually the admin frontend.
+	SuccessURL string   `mapstructure:"success_url"`
+	Scopes     []string `mapstructure:"scopes"` // default: openid email profile
+
+	// AutoProvision creates a local user on the first login of a verified email
+	// address from AllowedDomains.
+	AutoProvision  bool     `mapstructure:"auto_provision"`
+	AllowedDomains []string `mapstructure:"allowed_domains"`
+
+	// DisablePasswordLogin rejects logins with local passwords.
+	DisablePasswordLogin bool `mapstructure:"disable_password_login"`
+}
+
+// SecretsConfig holds settings for encrypted values (e.g. git access tokens).
+type SecretsConfig struct {
+	// KeyFile points to a file containing the secrets key.
+	// The FYNDMARK_SECRETS_KEY environment variable takes precedence.
+	KeyFile string `mapstructure:"key_file"`
+}
+
+// DatabaseConfig selects the database backend.
+type DatabaseConfig struct {
+	// Driver is "sqlite" (default, the file in sqlite.path), "postgres" or "mysql".
+	Driver string `mapstructure:"driver"`
+	// DSN is the connection string of a PostgreSQL or MySQL database.
+	DSN string `mapstructure:"dsn"`
 }
 
 // SQLiteConfig holds settings for the SQLite database file.
@@ -49,10 +167,76 @@ type SQLiteConfig struct {
 	Path string `mapstructure:"path"`
 }
 
+// BackupConfig controls scheduled backups of the SQLite database, made by the server.
+type BackupConfig struct {
+	// IntervalHours is the time between two backups (0 = no scheduled backups).
+	IntervalHours int `mapstructure:"interval_hours"`
+
+	// Keep is the number of newest backups kept in Dir and in the bucket (0 = all).
+	Keep int `mapstructure:"keep"`
+
+	// Dir is the directory the backups are written to.
+	Dir string `mapstructure:"dir"`
+
+	// S3 uploads the backups to a bucket; Prefix is prepended to the file names.
+	S3 PublishS3Config `mapstructure:"s3"`
+}
+
 // HugoConfig controls whether Hugo should be executed by fyndmark (optional).
 type HugoConfig struct {
 	// Disables controls whether the backend should run Hugo after generating markdown files, default false, so Hugo will run. Set to true if this step should be skipped.
 	Disabled bool `mapstructure:"disabled"`
+
+	// Bin is the Hugo binary name or path (default: "hugo").
+	Bin string `mapstructure:"bin"`
+
+	// Args are passed to Hugo, e.g. ["--minify", "--environment", "production"].
+	Args []string `mapstructure:"args"`
+
+	// Env holds additional environment variables, e.g. HUGO_ENV.
+	Env map[string]string `mapstructure:"env"`
+
+	// TimeoutSeconds limits the Hugo build (0 = 5 minutes).
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
+
+	// MinVersion is the oldest Hugo version the site builds with, e.g. "0.120.0".
+	MinVersion string `mapstructure:"min_version"`
+
+	// Version pins the exact Hugo version, e.g. "0.128.0".
+	Version string `mapstructure:"version"`
+
+	// Extended requires the extended edition of Hugo (Sass/SCSS, WebP).
+	Extended bool `mapstructure:"extended"`
+}
+
+// GeneratorConfig controls the comment files written into the site repository.
+type GeneratorConfig struct {
+	// Template is a Go text/template for one comment file (front matter and body).
+	// Empty = built-in format.
+	Template string `mapstructure:"template"`
+
+	// TemplateFile is read instead of Template. Relative paths are resolved in the
+	// site's repository, so the template can be versioned with the theme.
+	TemplateFile string `mapstructure:"template_file"`
+
+	// Filename is a Go text/template for the names of comment files.
+	// Empty = "YYYY-MM-DD-NNN.md" with a counter per day.
+	Filename string `mapstructure:"filename"`
+
+	// Output selects where comments are written: "bundle" (default, one markdown file
+	// per comment in the page bundle) or "data" (one Hugo data file per post).
+	Output string `mapstructure:"output"`
+
+	// DataFormat is the format of data files: "json" (default) or "yaml".
+	DataFormat string `mapstructure:"data_format"`
+
+	// Strict fails the generator (and the pipeline run) if approved comments belong to
+	// a post_path without page bundle, instead of skipping them.
+	Strict bool `mapstructure:"strict"`
+
+	// FullRebuild rewrites every bundle on each pipeline run. By default only bundles
+	// whose comment files changed since the last successful run are rewritten.
+	FullRebuild bool `mapstructure:"full_rebuild"`
 }
 
 // CommentsSiteConfig describes one logical site/blog for comments.
@@ -61,11 +245,372 @@ type CommentsSiteConfig struct {
 	CORSAllowedOrigins []string       `mapstructure:"cors_allowed_origins"`
 	Captcha            *CaptchaConfig `mapstructure:"captcha"`
 
-	AdminRecipients []string   `mapstructure:"admin_recipients"`
-	TokenSecret     string     `mapstructure:"token_secret"`
-	Git             GitConfig  `mapstructure:"git"`
-	Hugo            HugoConfig `mapstructure:"hugo"`
-	Timezone        string     `mapstructure:"timezone"`
+	AdminRecipients []string              `mapstructure:"admin_recipients"`
+	TokenSecret     string                `mapstructure:"token_secret"`
+	Git             GitConfig             `mapstructure:"git"`
+	Hugo            HugoConfig            `mapstructure:"hugo"`
+	Generator       GeneratorConfig       `mapstructure:"generator"`
+	Pipeline        PipelineConfig        `mapstructure:"pipeline"`
+	Webhooks        []WebhookConfig       `mapstructure:"webhooks"`
+	Antispam        AntispamConfig        `mapstructure:"antispam"`
+	Blocklist       BlocklistConfig       `mapstructure:"blocklist"`
+	RateLimit       RateLimitConfig       `mapstructure:"rate_limit"`
+	Embed           EmbedConfig           `mapstructure:"embed"`
+	DoubleOptIn     DoubleOptInConfig     `mapstructure:"double_opt_in"`
+	SelfService     SelfServiceConfig     `mapstructure:"self_service"`
+	ViewToken       ViewTokenConfig       `mapstructure:"view_token"`
+	Sanitize        SanitizeConfig        `mapstructure:"sanitize"`
+	WordFilter      WordFilterConfig      `mapstructure:"word_filter"`
+	Summary         SummaryConfig         `mapstructure:"summary"`
+	Trash           TrashConfig           `mapstructure:"trash"`
+	AdminReply      AdminReplyConfig      `mapstructure:"admin_reply"`
+	DisposableEmail DisposableEmailConfig `mapstructure:"disposable_email"`
+	EmailMX         EmailMXConfig         `mapstructure:"email_mx"`
+	Timezone        string                `mapstructure:"timezone"`
+}
+
+// AntispamConfig configures automatic spam classification of new comments.
+type AntispamConfig struct {
+	Heuristics *HeuristicsConfig `mapstructure:"heuristics"`
+	Akismet    *AkismetConfig    `mapstructure:"akismet"`
+}
+
+// HeuristicsConfig configures the built-in rule-based spam scoring.
+type HeuristicsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Threshold is the score from which a comment is classified as spam (default 10).
+	Threshold int `mapstructure:"threshold"`
+
+	// Phrases are additional spam phrases (case-insensitive), added to the built-in list.
+	Phrases []string `mapstructure:"phrases"`
+}
+
+type AkismetConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// APIKey may be encrypted (enc:v1:...).
+	APIKey string `mapstructure:"api_key"`
+
+	// BlogURL is the front page of the site as registered with Akismet.
+	BlogURL string `mapstructure:"blog_url"`
+
+	// APIURL replaces the Akismet endpoint, e.g. for a compatible service (optional).
+	APIURL string `mapstructure:"api_url"`
+}
+
+// BlocklistConfig defines how submissions matching the site's blocklist are handled.
+type BlocklistConfig struct {
+	// Action is "drop" (default: answer as if accepted, store nothing) or "reject" (403).
+	Action string `mapstructure:"action"`
+}
+
+// DoubleOptInConfig makes commenters confirm their email address before a comment
+// enters the moderation queue.
+type DoubleOptInConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// TTLHours is the validity of the confirmation link; unconfirmed comments are
+	// deleted afterwards. 0 = 48.
+	TTLHours int `mapstructure:"ttl_hours"`
+}
+
+// DisposableEmailConfig handles commenter addresses at throwaway mail services.
+type DisposableEmailConfig struct {
+	// Action is "reject" (400), "flag" (note in the moderation mail) or empty (no check).
+	Action string `mapstructure:"action"`
+
+	// File is a list of additional domains, one per line, checked besides the built-in list.
+	File string `mapstructure:"file"`
+}
+
+// EmailMXConfig rejects commenter addresses whose domain cannot receive mail.
+type EmailMXConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// TimeoutMS limits the DNS lookup (default 2000). Lookups that time out or fail
+	// temporarily never reject a comment.
+	TimeoutMS int `mapstructure:"timeout_ms"`
+}
+
+// SummaryConfig sends a weekly activity summary of the site to admin_recipients.
+type SummaryConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Weekday is the day the summary is sent (monday..sunday, default monday).
+	Weekday string `mapstructure:"weekday"`
+
+	// Hour is the hour of the day (0-23, site timezone) from which the summary is sent.
+	Hour int `mapstructure:"hour"`
+}
+
+// TrashConfig controls how long comments deleted by moderators are kept.
+type TrashConfig struct {
+	// PurgeAfterDays purges deleted comments after this many days; 0 = keep them until
+	// they are purged manually.
+	PurgeAfterDays int `mapstructure:"purge_after_days"`
+}
+
+// AdminReplyConfig configures replies posted by moderators from the admin UI.
+type AdminReplyConfig struct {
+	// Author is the display name of the replies (default "Admin").
+	Author string `mapstructure:"author"`
+	// AuthorURL is linked from the display name (optional).
+	AuthorURL string `mapstructure:"author_url"`
+}
+
+// SanitizeConfig selects the Markdown formatting kept in comment bodies.
+// By default bold, italic, inline code and blockquotes are kept.
+type SanitizeConfig struct {
+	// Allow enables additional elements: heading, code_block, strikethrough, link
+	// (or re-enables bold, italic, code, blockquote).
+	Allow []string `mapstructure:"allow"`
+
+	// Deny removes elements; it takes precedence over Allow.
+	Deny []string `mapstructure:"deny"`
+
+	// MaxBodyLength limits the comment body in bytes (0 = server limit of 20000).
+	MaxBodyLength int `mapstructure:"max_body_length"`
+
+	AuthorURL AuthorURLConfig `mapstructure:"author_url"`
+}
+
+// AuthorURLConfig restricts the domains commenters may link to as their homepage.
+// Domain entries also match subdomains.
+type AuthorURLConfig struct {
+	// AllowedDomains, if set, is the only domains accepted.
+	AllowedDomains []string `mapstructure:"allowed_domains"`
+
+	// BlockedDomains are rejected; they take precedence over AllowedDomains.
+	BlockedDomains []string `mapstructure:"blocked_domains"`
+
+	// BlockedTLDs rejects all hosts under these top-level domains, e.g. ["zip", "xyz"].
+	BlockedTLDs []string `mapstructure:"blocked_tlds"`
+}
+
+// WordFilterConfig checks comment bodies and author names against a wordlist.
+type WordFilterConfig struct {
+	// Action is "hold" (default: moderate as usual, list the matches in the mail),
+	// "reject" (400) or "mask" (replace matched terms with asterisks).
+	Action string `mapstructure:"action"`
+
+	// Words are terms (case-insensitive, whole words) checked in addition to File.
+	Words []string `mapstructure:"words"`
+
+	// File is a wordlist with one term per line; empty lines and lines starting with # are ignored.
+	File string `mapstructure:"file"`
+}
+
+// SanitizeElements are the element names accepted in sanitize.allow and sanitize.deny.
+var SanitizeElements = []string{"bold", "italic", "code", "blockquote", "heading", "code_block", "strikethrough", "link"}
+
+// SelfServiceConfig lets commenters edit or withdraw their comment for a short time
+// while it has not been moderated yet.
+type SelfServiceConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// WindowMinutes is the validity of the edit token returned on submission. 0 = 15.
+	WindowMinutes int `mapstructure:"window_minutes"`
+}
+
+// ViewTokenConfig adds a signed link to the double opt-in mail that lets commenters
+// see their own pending comments on the post before they are approved.
+type ViewTokenConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// BaseURL is the public URL of the site; the link points to BaseURL + post_path
+	// with the token in the fyndmark_view query parameter.
+	BaseURL string `mapstructure:"base_url"`
+
+	// TTLDays is the validity of the link. 0 = 30.
+	TTLDays int `mapstructure:"ttl_days"`
+}
+
+// EmbedConfig restricts the public read API (counts, stream, config) to clients
+// presenting a signed site token, e.g. for staging or members-only sites.
+type EmbedConfig struct {
+	RequireToken bool `mapstructure:"require_token"`
+
+	// Secret signs the embed tokens (may be encrypted, see "secrets encrypt").
+	// Changing it invalidates all issued tokens.
+	Secret string `mapstructure:"secret"`
+}
+
+// RateLimitConfig limits comment submissions per client IP and per email address.
+// Each limit is a token bucket holding up to the limit, refilled over the window.
+type RateLimitConfig struct {
+	// WindowSeconds is the refill period of the buckets (default 3600).
+	WindowSeconds int `mapstructure:"window_seconds"`
+
+	// PerIP is the number of submissions per client IP and window (0 = unlimited).
+	PerIP int `mapstructure:"per_ip"`
+
+	// PerEmail is the number of submissions per email address and window (0 = unlimited).
+	PerEmail int `mapstructure:"per_email"`
+}
+
+// WebhookConfig is an outbound webhook receiving signed comment and pipeline events.
+type WebhookConfig struct {
+	URL string `mapstructure:"url"`
+
+	// Secret is used to sign the request body (HMAC-SHA256). May be encrypted (enc:v1:...).
+	Secret string `mapstructure:"secret"`
+
+	// Events limits the delivered event types (empty = all events).
+	Events []string `mapstructure:"events"`
+}
+
+// PipelineConfig limits how often the pipeline may run for a site.
+// Runs beyond the limits are coalesced into the next allowed slot.
+type PipelineConfig struct {
+	// CooldownSeconds is the minimum interval between two pipeline runs (0 = no cooldown).
+	CooldownSeconds int `mapstructure:"cooldown_seconds"`
+
+	// DailyBudget is the maximum number of pipeline runs within 24 hours (0 = unlimited).
+	DailyBudget int `mapstructure:"daily_budget"`
+
+	// MaxAttempts is how often a failed run is started in total (0 or 1 = no retry).
+	MaxAttempts int `mapstructure:"max_attempts"`
+
+	// RetryBackoffSeconds is the delay before the first retry; it doubles with every
+	// further attempt, up to one hour (default: 60).
+	RetryBackoffSeconds int `mapstructure:"retry_backoff_seconds"`
+
+	// Timeouts limit the runtime of the pipeline steps.
+	Timeouts PipelineTimeoutsConfig `mapstructure:"timeouts"`
+
+	// DebounceSeconds delays a run until no further run was queued for the site within
+	// this window; the queued runs are coalesced into one (0 = start immediately).
+	DebounceSeconds int `mapstructure:"debounce_seconds"`
+
+	// MinFreeMB is the free disk space required before checkout and Hugo (0 = no check).
+	MinFreeMB int `mapstructure:"min_free_mb"`
+
+	// MaxWorkdirMB limits the size of the site's workdir (0 = unlimited).
+	MaxWorkdirMB int `mapstructure:"max_workdir_mb"`
+
+	// Commands are additional steps run before or after the Hugo build or after the push.
+	Commands []PipelineCommandConfig `mapstructure:"commands"`
+
+	// Push set to false makes every run skip commit, push and the later steps, e.g. to
+	// test templates against production data (default: true).
+	Push *bool `mapstructure:"push"`
+
+	// Retention limits how many finished runs are kept.
+	Retention PipelineRetentionConfig `mapstructure:"retention"`
+
+	// DeployHook is called after a successful push, for sites built by an external service.
+	DeployHook DeployHookConfig `mapstructure:"deploy_hook"`
+
+	// Publish uploads the Hugo output after a successful push, for sites built by Fyndmark.
+	Publish PublishConfig `mapstructure:"publish"`
+}
+
+// PipelineRetentionConfig controls the periodic deletion of finished pipeline runs.
+// A run is kept if either limit keeps it; with both 0 runs are kept forever.
+type PipelineRetentionConfig struct {
+	// KeepRuns is the number of newest runs kept per site (0 = no count limit).
+	KeepRuns int `mapstructure:"keep_runs"`
+
+	// KeepDays is the number of days runs are kept (0 = no age limit).
+	KeepDays int `mapstructure:"keep_days"`
+}
+
+// DeployHookConfig is a build hook URL (Netlify, Cloudflare Pages, Vercel, ...) called
+// by the deploy step of the pipeline.
+type DeployHookConfig struct {
+	// URL of the build hook (empty = no deploy step). May be encrypted (enc:v1:...).
+	URL string `mapstructure:"url"`
+
+	// Method is the HTTP method (default: POST).
+	Method string `mapstructure:"method"`
+}
+
+// PublishConfig uploads the Hugo output directory to a web server or bucket.
+type PublishConfig struct {
+	// Type is "rsync" or "s3" (empty = no publish step).
+	Type string `mapstructure:"type"`
+
+	// Dir is the output directory relative to the site's workdir (default: "public").
+	Dir string `mapstructure:"dir"`
+
+	// Delete removes files at the target that no longer exist in Dir.
+	Delete bool `mapstructure:"delete"`
+
+	Rsync PublishRsyncConfig `mapstructure:"rsync"`
+	S3    PublishS3Config    `mapstructure:"s3"`
+}
+
+// PublishRsyncConfig is an rsync destination, local or via SSH.
+type PublishRsyncConfig struct {
+	// Target is the rsync destination, e.g. "deploy@example.org:/var/www/blog/".
+	Target string `mapstructure:"target"`
+
+	// SSHKey is the private key file for SSH targets (default: the keys of ssh).
+	SSHKey string `mapstructure:"ssh_key"`
+
+	// KnownHosts is a known_hosts file. Without it, unknown host keys are accepted
+	// on first use.
+	KnownHosts string `mapstructure:"known_hosts"`
+
+	// Args are additional rsync arguments, e.g. ["--chmod=D755,F644"].
+	Args []string `mapstructure:"args"`
+}
+
+// PublishS3Config is an S3 compatible bucket (AWS S3, Cloudflare R2, MinIO, ...).
+type PublishS3Config struct {
+	Bucket string `mapstructure:"bucket"`
+
+	// Prefix is prepended to all object keys, e.g. "blog/".
+	Prefix string `mapstructure:"prefix"`
+
+	// Region of the bucket (default: "us-east-1"; "auto" for R2).
+	Region string `mapstructure:"region"`
+
+	// Endpoint is the URL of S3 compatible services, e.g.
+	// "https://<account>.r2.cloudflarestorage.com" (default: AWS).
+	Endpoint string `mapstructure:"endpoint"`
+
+	AccessKeyID string `mapstructure:"access_key_id"`
+
+	// SecretAccessKey may be encrypted (enc:v1:...).
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+}
+
+// PipelineCommandConfig is a custom command run as a pipeline step.
+type PipelineCommandConfig struct {
+	// Name is the step name recorded in pipeline_runs and the run log.
+	Name string `mapstructure:"name"`
+
+	// Stage is when the command runs: pre_build, post_build or post_push.
+	Stage string `mapstructure:"stage"`
+
+	// Command is the program and its arguments; it is not run through a shell.
+	Command []string `mapstructure:"command"`
+
+	// Dir is the working directory relative to the site's workdir (default: workdir).
+	Dir string `mapstructure:"dir"`
+
+	// Env holds additional environment variables.
+	Env map[string]string `mapstructure:"env"`
+
+	// TimeoutSeconds limits the runtime (0 = 5 minutes).
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
+
+	// AllowFailure logs a failing command and continues the run.
+	AllowFailure bool `mapstructure:"allow_failure"`
+}
+
+// PipelineTimeoutsConfig limits the runtime of each pipeline step, in seconds
+// (0 = built-in default).
+type PipelineTimeoutsConfig struct {
+	CheckoutSeconds int `mapstructure:"checkout_seconds"`
+	GenerateSeconds int `mapstructure:"generate_seconds"`
+	HugoSeconds     int `mapstructure:"hugo_seconds"`
+	CommitSeconds   int `mapstructure:"commit_seconds"`
+	PushSeconds     int `mapstructure:"push_seconds"`
+	DeploySeconds   int `mapstructure:"deploy_seconds"`
+	PublishSeconds  int `mapstructure:"publish_seconds"`
 }
 
 type GitConfig struct {
@@ -75,13 +620,76 @@ type GitConfig struct {
 	CloneDir    string `mapstructure:"clone_dir"`
 	Depth       int    `mapstructure:"depth"`
 
+	// Optional: user name sent with the access token, e.g. "oauth2" for GitLab or the
+	// account name for Gitea. Defaults to "oauth2" for GitLab and "x-access-token" otherwise.
+	TokenUsername string `mapstructure:"token_username"`
+
 	// Optional: initialize/update submodules during clone
 	RecurseSubmodules bool `mapstructure:"recurse_submodules"`
 
+	// Optional: tag or commit the checked out branch must contain. This is a floor,
+	// not a pin: the branch is not moved, because generated content is committed and
+	// pushed on top of it, so later upstream commits are built as well.
+	MinRevision string `mapstructure:"min_revision"`
+
+	// Revision is rejected for site repositories, which cannot be pinned; only
+	// themes support it. Kept so that old configs fail instead of being ignored.
+	Revision string `mapstructure:"revision"`
+
+	// Optional: "clone" (default) removes and re-clones the working copy on every run,
+	// "fetch" reuses it with fetch and hard reset to the remote branch.
+	CheckoutMode string `mapstructure:"checkout_mode"`
+
+	// Optional: author of pipeline commits. Unset fields fall back to the git config.
+	AuthorName  string `mapstructure:"author_name"`
+	AuthorEmail string `mapstructure:"author_email"`
+
+	// Optional: text/template for commit messages, see git.CommitMessageData.
+	CommitMessage string `mapstructure:"commit_message"`
+
+	// Optional: how often a push rejected because the remote branch advanced is
+	// retried after rebasing onto it (nil = default, 0 = fail right away).
+	PushRetries *int `mapstructure:"push_retries"`
+
+	// Optional: push every run to its own branch and open a pull request.
+	PullRequest GitPullRequestConfig `mapstructure:"pull_request"`
+
+	// Optional: sign pipeline commits.
+	Signing GitSigningConfig `mapstructure:"signing"`
+
 	// Optional: additional themes/components to ensure exist under the cloned repo
 	Themes []GitThemeConfig `mapstructure:"themes"`
 }
 
+// GitPullRequestConfig enables the branch-per-run mode: runs push to a new branch and
+// open a pull request (GitHub) or merge request (GitLab) against the site branch,
+// using the access token of the site.
+type GitPullRequestConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Optional: "github" or "gitlab"; detected from repo_url for github.com and gitlab.com.
+	Provider string `mapstructure:"provider"`
+
+	// Optional: API base URL, e.g. for GitHub Enterprise or self-hosted GitLab.
+	APIURL string `mapstructure:"api_url"`
+
+	// Optional: prefix of the run branches, followed by the run ID (default "fyndmark/run-").
+	BranchPrefix string `mapstructure:"branch_prefix"`
+}
+
+// GitSigningConfig configures commit signing. An empty format disables signing.
+type GitSigningConfig struct {
+	// "ssh" or "gpg".
+	Format string `mapstructure:"format"`
+
+	// ssh: path to the private key file. gpg: key ID in the keyring of the Fyndmark
+	// user (exec backend) or path to an armored private key file (go-git backend).
+	Key string `mapstructure:"key"`
+
+	// Optional passphrase of the key file (go-git backend only), may be encrypted.
+	Passphrase string `mapstructure:"passphrase"`
+}
+
 // GitThemeConfig describes an additional theme/component repository that should be
 // cloned into the website working copy (typically under themes/).
 type GitThemeConfig struct {
@@ -100,8 +708,97 @@ type GitThemeConfig struct {
 	// Optional token for private theme repos (leave empty for public repos)
 	AccessToken string `mapstructure:"access_token"`
 
+	// Optional user name sent with the token, see GitConfig.TokenUsername.
+	TokenUsername string `mapstructure:"token_username"`
+
 	// Optional shallow clone depth for this theme repo (0 = full clone)
 	Depth int `mapstructure:"depth"`
+
+	// Optional: initialize/update submodules of the theme repo
+	RecurseSubmodules bool `mapstructure:"recurse_submodules"`
+
+	// Optional tag or commit to check out (detached) instead of the branch head.
+	Revision string `mapstructure:"revision"`
+}
+
+// WorkspaceConfig restricts where repositories may come from and where they are checked out.
+type WorkspaceConfig struct {
+	// AllowedHosts lists the git hosts repo_url may point to (empty = any host).
+	AllowedHosts []string `mapstructure:"allowed_hosts"`
+
+	// BaseDir is the directory all clone dirs must be located in (empty = no restriction).
+	BaseDir string `mapstructure:"base_dir"`
+
+	// GitBackend selects the git implementation: "exec" runs the git binary (default),
+	// "go-git" uses the built-in go-git library and needs no git binary.
+	GitBackend string `mapstructure:"git_backend"`
+}
+
+// SandboxConfig restricts the git and hugo subprocesses started by the pipeline.
+type SandboxConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Commands lists the programs to sandbox ("git", "hugo"). Empty = both.
+	Commands []string `mapstructure:"commands"`
+
+	// UID/GID to run the subprocesses as (0 = unchanged; requires privileges, Unix only).
+	UID int `mapstructure:"uid"`
+	GID int `mapstructure:"gid"`
+
+	// Home is the HOME of subprocesses running as UID, so they do not read the
+	// git config and caches of the Fyndmark user. Empty = a directory in the
+	// system temp dir, created for the UID.
+	Home string `mapstructure:"home"`
+
+	// Wrapper is prepended to the command line, e.g. ["bwrap", "--ro-bind", "/", "/", ..., "--"].
+	// The placeholder {dir} is replaced with the working directory of the subprocess.
+	Wrapper []string `mapstructure:"wrapper"`
+}
+
+// SubprocessConfig controls the environment of git and hugo subprocesses.
+type SubprocessConfig struct {
+	// EnvPassthrough lists additional environment variables passed to subprocesses.
+	// By default only a minimal environment (PATH, HOME, locale, proxy and TLS settings) is passed.
+	EnvPassthrough []string `mapstructure:"env_passthrough"`
+}
+
+// SiteSyncConfig controls how sites are reconciled with the database on startup.
+type SiteSyncConfig struct {
+	// KeepMissing keeps sites active that were removed from comment_sites and only
+	// logs a warning, instead of disabling them.
+	KeepMissing bool `mapstructure:"keep_missing"`
+}
+
+// CommentIDsConfig selects how IDs of new comments are generated.
+type CommentIDsConfig struct {
+	// Strategy is "ulid" (default), "uuidv7" or "snowflake".
+	Strategy string `mapstructure:"strategy"`
+
+	// NodeID distinguishes instances generating snowflake IDs (0-1023).
+	NodeID int64 `mapstructure:"node_id"`
+}
+
+// CacheConfig controls the response cache of the public read endpoints.
+type CacheConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+
+	// Backend is "memory" (default) or "redis". Use redis when several instances serve the same sites.
+	Backend string `mapstructure:"backend"`
+
+	// TTLSeconds bounds how long an entry is served. Moderation invalidates earlier; 0 = 300.
+	TTLSeconds int `mapstructure:"ttl_seconds"`
+
+	// MaxEntries limits the memory backend; 0 = 10000.
+	MaxEntries int `mapstructure:"max_entries"`
+
+	Redis RedisConfig `mapstructure:"redis"`
+}
+
+// RedisConfig holds the connection settings of a Redis server (cache, sessions).
+type RedisConfig struct {
+	Addr     string `mapstructure:"addr"` // host:port
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
 }
 
 // SMTPConfig holds settings related to the sending mail server
@@ -132,6 +829,20 @@ type CaptchaConfig struct {
 	Enabled   bool   `mapstructure:"enabled"`
 	Provider  string `mapstructure:"provider"`
 	SecretKey string `mapstructure:"secret_key"`
+
+	// SiteKey is the public widget key, published to frontends via the site config endpoint.
+	SiteKey string `mapstructure:"site_key"`
+
+	// Mode selects the challenge type of the builtin provider: "math" (default) or "image".
+	Mode string `mapstructure:"mode"`
+
+	// TTLSeconds is the lifetime of builtin challenges (default 600).
+	TTLSeconds int `mapstructure:"ttl_seconds"`
+
+	// Fallbacks are further providers tried in order if this one fails or rejects
+	// the token (e.g. builtin during an outage of the primary service).
+	// Their enabled flag and own fallbacks are ignored.
+	Fallbacks []CaptchaConfig `mapstructure:"fallbacks"`
 }
 
 // FormConfig describes one logical form (e.g. feedback form for a specific site).
@@ -152,7 +863,16 @@ type AppConfig struct {
 	//CORS   CORSConfig            `mapstructure:"cors"` // maybe later
 	Forms map[string]FormConfig `mapstructure:"forms"`
 
+	Database     DatabaseConfig                `mapstructure:"database"`
 	SQLite       SQLiteConfig                  `mapstructure:"sqlite"`
+	Backup       BackupConfig                  `mapstructure:"backup"`
+	Secrets      SecretsConfig                 `mapstructure:"secrets"`
+	Workspace    WorkspaceConfig               `mapstructure:"workspace"`
+	Sandbox      SandboxConfig                 `mapstructure:"sandbox"`
+	Subprocess   SubprocessConfig              `mapstructure:"subprocess"`
+	Cache        CacheConfig                   `mapstructure:"cache"`
+	SiteSync     SiteSyncConfig                `mapstructure:"site_sync"`
+	CommentIDs   CommentIDsConfig              `mapstructure:"comment_ids"`
 	CommentSites map[string]CommentsSiteConfig `mapstructure:"comment_sites"`
 
 	// Logging config kept for future extensions, currently unused.
@@ -260,10 +980,46 @@ func readAndSetConfig() error {
 
 	log.Println("server.listen:", Cfg.Server.Listen)
 
-	if Cfg.SQLite.Path == "" {
-		return exitOnErr(errors.New("sqlite.path must be set in config or environment"))
+	basePath, err := normalizeBasePath(Cfg.Server.BasePath)
+	if err != nil {
+		return exitOnErr(err)
+	}
+	Cfg.Server.BasePath = basePath
+
+	if s := Cfg.Server; s.ReadHeaderTimeoutSeconds < 0 || s.ReadTimeoutSeconds < 0 || s.WriteTimeoutSeconds < 0 || s.IdleTimeoutSeconds < 0 || s.DrainTimeoutSeconds < 0 {
+		return exitOnErr(errors.New("server timeouts must be >= 0"))
+	}
+	if s := Cfg.Server; s.MaxHeaderBytes < 0 || s.MaxBodyBytes.Comments < 0 || s.MaxBodyBytes.Forms < 0 || s.MaxBodyBytes.Admin < 0 {
+		return exitOnErr(errors.New("server.max_header_bytes and server.max_body_bytes must be >= 0"))
+	}
+	if s := Cfg.Server.MaxStreams; s.PerSite < 0 || s.PerIP < 0 {
+		return exitOnErr(errors.New("server.max_streams must be >= 0"))
+	}
+	if p := Cfg.Server.Pprof; p.Enabled {
+		if err := validatePprof(p); err != nil {
+			return exitOnErr(err)
+		}
+	}
+
+	Cfg.Database.Driver = strings.ToLower(strings.TrimSpace(Cfg.Database.Driver))
+	switch Cfg.Database.Driver {
+	case "", "sqlite":
+		Cfg.Database.Driver = "sqlite"
+		if Cfg.SQLite.Path == "" {
+			return exitOnErr(errors.New("sqlite.path must be set in config or environment"))
+		}
+		log.Println("sqlite.path:", Cfg.SQLite.Path)
+	case "postgres", "mysql":
+		if strings.TrimSpace(Cfg.Database.DSN) == "" {
+			return exitOnErr(fmt.Errorf("database.dsn must be set for database.driver %s", Cfg.Database.Driver))
+		}
+		log.Println("database.driver:", Cfg.Database.Driver)
+	default:
+		return exitOnErr(fmt.Errorf("database.driver must be sqlite, postgres or mysql, got %q", Cfg.Database.Driver))
+	}
+	if err := validateBackup(Cfg.Backup); err != nil {
+		return exitOnErr(err)
 	}
-	log.Println("sqlite.path:", Cfg.SQLite.Path)
 
 	for siteID, siteCfg := range Cfg.CommentSites {
 		if len(siteCfg.AdminRecipients) == 0 {
@@ -273,11 +1029,122 @@ func readAndSetConfig() error {
 			return exitOnErr(fmt.Errorf("comment_sites.%s.token_secret must be set", siteID))
 		}
 		if siteCfg.Captcha != nil {
-			if strings.TrimSpace(siteCfg.Captcha.Provider) == "" {
-				return exitOnErr(fmt.Errorf("comment_sites.%s.captcha.provider must be set", siteID))
+			if err := validateCaptcha("comment_sites."+siteID+".captcha", siteCfg.Captcha, true); err != nil {
+				return exitOnErr(err)
+			}
+		}
+		if siteCfg.Pipeline.CooldownSeconds < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.pipeline.cooldown_seconds must be >= 0", siteID))
+		}
+		if siteCfg.Pipeline.DailyBudget < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.pipeline.daily_budget must be >= 0", siteID))
+		}
+		if siteCfg.Pipeline.MaxAttempts < 0 || siteCfg.Pipeline.RetryBackoffSeconds < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.pipeline.max_attempts and retry_backoff_seconds must be >= 0", siteID))
+		}
+		if t := siteCfg.Pipeline.Timeouts; t.CheckoutSeconds < 0 || t.GenerateSeconds < 0 || t.HugoSeconds < 0 || t.CommitSeconds < 0 || t.PushSeconds < 0 || t.DeploySeconds < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.pipeline.timeouts values must be >= 0", siteID))
+		}
+		if siteCfg.Pipeline.DebounceSeconds < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.pipeline.debounce_seconds must be >= 0", siteID))
+		}
+		if r := siteCfg.Pipeline.Retention; r.KeepRuns < 0 || r.KeepDays < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.pipeline.retention values must be >= 0", siteID))
+		}
+		if siteCfg.Pipeline.MinFreeMB < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.pipeline.min_free_mb must be >= 0", siteID))
+		}
+		if siteCfg.Pipeline.MaxWorkdirMB < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.pipeline.max_workdir_mb must be >= 0", siteID))
+		}
+		if siteCfg.Trash.PurgeAfterDays < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.trash.purge_after_days must be >= 0", siteID))
+		}
+		if siteCfg.RateLimit.WindowSeconds < 0 || siteCfg.RateLimit.PerIP < 0 || siteCfg.RateLimit.PerEmail < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.rate_limit values must be >= 0", siteID))
+		}
+		if siteCfg.SelfService.WindowMinutes < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.self_service.window_minutes must be >= 0", siteID))
+		}
+		if err := validateSanitize("comment_sites."+siteID+".sanitize", siteCfg.Sanitize); err != nil {
+			return exitOnErr(err)
+		}
+		switch strings.ToLower(strings.TrimSpace(siteCfg.WordFilter.Action)) {
+		case "", "hold", "reject", "mask":
+		default:
+			return exitOnErr(fmt.Errorf("comment_sites.%s.word_filter.action must be hold, reject or mask", siteID))
+		}
+		if f := strings.TrimSpace(siteCfg.WordFilter.File); f != "" {
+			if _, err := os.Stat(f); err != nil {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.word_filter.file: %w", siteID, err))
+			}
+		}
+		if vt := siteCfg.ViewToken; vt.Enabled {
+			if !siteCfg.DoubleOptIn.Enabled {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.view_token requires double_opt_in (the link is sent in the confirmation mail)", siteID))
+			}
+			if u, err := url.Parse(strings.TrimSpace(vt.BaseURL)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.view_token.base_url must be an http(s) URL", siteID))
+			}
+			if vt.TTLDays < 0 {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.view_token.ttl_days must be >= 0", siteID))
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(siteCfg.DisposableEmail.Action)) {
+		case "", "flag", "reject":
+		default:
+			return exitOnErr(fmt.Errorf("comment_sites.%s.disposable_email.action must be flag or reject", siteID))
+		}
+		if f := strings.TrimSpace(siteCfg.DisposableEmail.File); f != "" {
+			if _, err := os.Stat(f); err != nil {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.disposable_email.file: %w", siteID, err))
+			}
+		}
+		if siteCfg.EmailMX.TimeoutMS < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.email_mx.timeout_ms must be >= 0", siteID))
+		}
+		if sc := siteCfg.Summary; sc.Enabled {
+			if _, ok := ParseWeekday(sc.Weekday); !ok {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.summary.weekday must be a day name like monday", siteID))
 			}
-			if strings.TrimSpace(siteCfg.Captcha.SecretKey) == "" {
-				return exitOnErr(fmt.Errorf("comment_sites.%s.captcha.secret_key must be set", siteID))
+			if sc.Hour < 0 || sc.Hour > 23 {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.summary.hour must be between 0 and 23", siteID))
+			}
+		}
+		if siteCfg.DoubleOptIn.TTLHours < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.double_opt_in.ttl_hours must be >= 0", siteID))
+		}
+		if siteCfg.Embed.RequireToken && strings.TrimSpace(siteCfg.Embed.Secret) == "" {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.embed.secret must be set when require_token is enabled", siteID))
+		}
+		switch strings.ToLower(strings.TrimSpace(siteCfg.Blocklist.Action)) {
+		case "", "drop", "reject":
+		default:
+			return exitOnErr(fmt.Errorf("comment_sites.%s.blocklist.action must be drop or reject", siteID))
+		}
+		if h := siteCfg.Antispam.Heuristics; h != nil && h.Threshold < 0 {
+			return exitOnErr(fmt.Errorf("comment_sites.%s.antispam.heuristics.threshold must be >= 0", siteID))
+		}
+		if ak := siteCfg.Antispam.Akismet; ak != nil && ak.Enabled {
+			if strings.TrimSpace(ak.APIKey) == "" {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.antispam.akismet.api_key must be set", siteID))
+			}
+			if strings.TrimSpace(ak.BlogURL) == "" {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.antispam.akismet.blog_url must be set", siteID))
+			}
+			if raw := strings.TrimSpace(ak.APIURL); raw != "" {
+				if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return exitOnErr(fmt.Errorf("comment_sites.%s.antispam.akismet.api_url must be an http(s) URL", siteID))
+				}
+			}
+		}
+		for i, hook := range siteCfg.Webhooks {
+			u, err := url.Parse(strings.TrimSpace(hook.URL))
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.webhooks[%d].url must be an http(s) URL", siteID, i))
+			}
+			if strings.TrimSpace(hook.Secret) == "" {
+				return exitOnErr(fmt.Errorf("comment_sites.%s.webhooks[%d].secret must be set", siteID, i))
 			}
 		}
 	}
@@ -287,12 +1154,24 @@ func readAndSetConfig() error {
 			return exitOnErr(fmt.Errorf("forms.%s.recipients must be set", formID))
 		}
 		if formCfg.Captcha != nil {
-			if strings.TrimSpace(formCfg.Captcha.Provider) == "" {
-				return exitOnErr(fmt.Errorf("forms.%s.captcha.provider must be set", formID))
+			if err := validateCaptcha("forms."+formID+".captcha", formCfg.Captcha, false); err != nil {
+				return exitOnErr(err)
 			}
-			if strings.TrimSpace(formCfg.Captcha.SecretKey) == "" {
-				return exitOnErr(fmt.Errorf("forms.%s.captcha.secret_key must be set", formID))
+		}
+	}
+
+	if Cfg.Cache.Enabled {
+		switch strings.ToLower(strings.TrimSpace(Cfg.Cache.Backend)) {
+		case "", "memory":
+		case "redis":
+			if strings.TrimSpace(Cfg.Cache.Redis.Addr) == "" {
+				return exitOnErr(errors.New("cache.redis.addr must be set when cache.backend=redis"))
 			}
+		default:
+			return exitOnErr(errors.New("cache.backend must be memory or redis"))
+		}
+		if Cfg.Cache.TTLSeconds < 0 || Cfg.Cache.MaxEntries < 0 {
+			return exitOnErr(errors.New("cache.ttl_seconds and cache.max_entries must be >= 0"))
 		}
 	}
 
@@ -310,6 +1189,23 @@ func readAndSetConfig() error {
 		if strings.TrimSpace(Cfg.WebAdmin.CookieSameSite) == "" {
 			Cfg.WebAdmin.CookieSameSite = "lax"
 		}
+		switch strings.ToLower(strings.TrimSpace(Cfg.WebAdmin.SessionStore)) {
+		case "", "cookie", "sqlite":
+		case "redis":
+			if strings.TrimSpace(Cfg.WebAdmin.SessionRedis.Addr) == "" {
+				return exitOnErr(errors.New("web_admin.session_redis.addr must be set for session_store redis"))
+			}
+		default:
+			return exitOnErr(fmt.Errorf("web_admin.session_store must be cookie, sqlite or redis, got %q", Cfg.WebAdmin.SessionStore))
+		}
+		if Cfg.WebAdmin.MaxPasswordAgeDays < 0 {
+			return exitOnErr(errors.New("web_admin.max_password_age_days must not be negative"))
+		}
+	}
+	if Cfg.WebAdmin.OIDC.Enabled {
+		if err := validateOIDC(Cfg.WebAdmin.OIDC); err != nil {
+			return exitOnErr(err)
+		}
 	}
 
 	// maybe later enable logging config
@@ -317,6 +1213,77 @@ func readAndSetConfig() error {
 	return nil
 }
 
+// normalizeBasePath returns p with a leading and without a trailing slash, "" for
+// the root.
+func normalizeBasePath(p string) (string, error) {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(p, "?#:*\\ ") || strings.Contains(p, "//") || slices.Contains(strings.Split(p, "/"), "..") {
+		return "", fmt.Errorf("server.base_path %q is not a valid path prefix", p)
+	}
+	return "/" + p, nil
+}
+
+// validateOIDC checks the OpenID Connect settings of the admin.
+func validateOIDC(o OIDCConfig) error {
+	if !Cfg.WebAdmin.Enabled {
+		return errors.New("web_admin.oidc requires web_admin.enabled=true")
+	}
+	urls := []struct{ name, value string }{{"issuer", o.Issuer}, {"redirect_url", o.RedirectURL}, {"success_url", o.SuccessURL}}
+	for _, v := range urls {
+		u, err := url.Parse(strings.TrimSpace(v.value))
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("web_admin.oidc.%s must be an http(s) URL", v.name)
+		}
+	}
+	if strings.TrimSpace(o.ClientID) == "" {
+		return errors.New("web_admin.oidc.client_id must be set")
+	}
+	if o.AutoProvision && len(o.AllowedDomains) == 0 {
+		return errors.New("web_admin.oidc.auto_provision requires web_admin.oidc.allowed_domains")
+	}
+	return nil
+}
+
+// validatePprof checks the pprof settings: a separate listener must be bound to a
+// loopback address, otherwise the admin API must be enabled.
+func validatePprof(p PprofConfig) error {
+	listen := strings.TrimSpace(p.Listen)
+	if listen == "" {
+		if !Cfg.WebAdmin.Enabled {
+			return errors.New("server.pprof requires web_admin.enabled=true or server.pprof.listen")
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("server.pprof.listen: %w", err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("server.pprof.listen must be a loopback address, got %q", listen)
+	}
+	return nil
+}
+
+// validateBackup checks the scheduled backups; they need SQLite and a target.
+func validateBackup(b BackupConfig) error {
+	if b.IntervalHours < 0 || b.Keep < 0 {
+		return errors.New("backup.interval_hours and backup.keep must be >= 0")
+	}
+	if b.IntervalHours == 0 {
+		return nil
+	}
+	if Cfg.Database.Driver != "sqlite" {
+		return fmt.Errorf("backup needs database.driver sqlite, got %q", Cfg.Database.Driver)
+	}
+	if strings.TrimSpace(b.Dir) == "" && strings.TrimSpace(b.S3.Bucket) == "" {
+		return errors.New("backup.dir or backup.s3.bucket must be set")
+	}
+	return nil
+}
+
 // exitOnErr prints an error to stderr and exits the process.
 // It also returns the same error for completeness, even though it's never reached.
 func exitOnErr(err error) error {
@@ -324,3 +1291,89 @@ func exitOnErr(err error) error {
 	os.Exit(1)
 	return err
 }
+
+// validateSanitize checks the element names and limits of a sanitize section.
+func validateSanitize(prefix string, sc SanitizeConfig) error {
+	if sc.MaxBodyLength < 0 {
+		return fmt.Errorf("%s.max_body_length must be >= 0", prefix)
+	}
+	for _, list := range []struct {
+		name  string
+		items []string
+	}{{"allowed_domains", sc.AuthorURL.AllowedDomains}, {"blocked_domains", sc.AuthorURL.BlockedDomains}, {"blocked_tlds", sc.AuthorURL.BlockedTLDs}} {
+		for _, item := range list.items {
+			if v := strings.Trim(strings.TrimSpace(item), ".*"); v == "" || strings.ContainsAny(v, "/@: ") {
+				return fmt.Errorf("%s.author_url.%s: invalid domain %q", prefix, list.name, item)
+			}
+		}
+	}
+	for _, list := range []struct {
+		name  string
+		items []string
+	}{{"allow", sc.Allow}, {"deny", sc.Deny}} {
+		for _, item := range list.items {
+			if !slices.Contains(SanitizeElements, strings.ToLower(strings.TrimSpace(item))) {
+				return fmt.Errorf("%s.%s: unknown element %q (known: %s)", prefix, list.name, item, strings.Join(SanitizeElements, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// ParseWeekday parses an English day name (case-insensitive); empty means Monday.
+func ParseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return time.Monday, true
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.ToLower(d.String()) == s {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// validateCaptcha checks a captcha section and its fallbacks.
+func validateCaptcha(prefix string, cc *CaptchaConfig, allowBuiltin bool) error {
+	if err := validateCaptchaProvider(prefix, *cc, allowBuiltin); err != nil {
+		return err
+	}
+	for i, fb := range cc.Fallbacks {
+		p := fmt.Sprintf("%s.fallbacks[%d]", prefix, i)
+		if len(fb.Fallbacks) > 0 {
+			return fmt.Errorf("%s: nested fallbacks are not supported", p)
+		}
+		if err := validateCaptchaProvider(p, fb, allowBuiltin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCaptchaProvider performs its package-specific operation.
+func validateCaptchaProvider(prefix string, cc CaptchaConfig, allowBuiltin bool) error {
+	provider := strings.ToLower(strings.TrimSpace(cc.Provider))
+	if provider == "" {
+		return fmt.Errorf("%s.provider must be set", prefix)
+	}
+	if provider != "builtin" {
+		if strings.TrimSpace(cc.SecretKey) == "" {
+			return fmt.Errorf("%s.secret_key must be set", prefix)
+		}
+		return nil
+	}
+
+	if !allowBuiltin {
+		return fmt.Errorf("%s: the builtin provider is only available for comment_sites", prefix)
+	}
+	switch strings.ToLower(strings.TrimSpace(cc.Mode)) {
+	case "", "math", "image":
+	default:
+		return fmt.Errorf("%s.mode must be math or image", prefix)
+	}
+	if cc.TTLSeconds < 0 {
+		return fmt.Errorf("%s.ttl_seconds must be >= 0", prefix)
+	}
+	return nil
+}
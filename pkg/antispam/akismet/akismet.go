@@ -0,0 +1,134 @@
+package akismet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Provider struct {
+	APIKey  string
+	BlogURL string
+	// APIURL replaces the Akismet endpoint https://<api key>.rest.akismet.com/1.1,
+	// e.g. for a compatible service. The key is then sent as the api_key field.
+	APIURL string
+}
+
+type Comment struct {
+	UserIP      string
+	UserAgent   string
+	Referrer    string
+	Permalink   string
+	Author      string
+	AuthorEmail string
+	AuthorURL   string
+	Content     string
+}
+
+// New constructs and returns a new instance.
+func New(apiKey, blogURL string) (*Provider, error) {
+	if strings.TrimSpace(apiKey) == "" {
+		return nil, fmt.Errorf("akismet api key is not configured")
+	}
+	if strings.TrimSpace(blogURL) == "" {
+		return nil, fmt.Errorf("akismet blog url is not configured")
+	}
+	return &Provider{APIKey: apiKey, BlogURL: blogURL}, nil
+}
+
+// Check asks Akismet's comment-check API whether a comment is spam.
+func (p *Provider) Check(ctx context.Context, c Comment) (bool, error) {
+	resp, body, err := p.post(ctx, "comment-check", c)
+	if err != nil {
+		return false, err
+	}
+
+	switch body {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected Akismet response: %s", debugHelp(resp, body))
+	}
+}
+
+// SubmitSpam reports a comment Akismet missed as spam.
+func (p *Provider) SubmitSpam(ctx context.Context, c Comment) error {
+	return p.submit(ctx, "submit-spam", c)
+}
+
+// SubmitHam reports a comment Akismet wrongly classified as spam.
+func (p *Provider) SubmitHam(ctx context.Context, c Comment) error {
+	return p.submit(ctx, "submit-ham", c)
+}
+
+func (p *Provider) submit(ctx context.Context, method string, c Comment) error {
+	resp, body, err := p.post(ctx, method, c)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("akismet %s failed: %s", method, debugHelp(resp, body))
+	}
+	return nil
+}
+
+// post sends a comment to one of Akismet's comment methods and returns the trimmed response body.
+func (p *Provider) post(ctx context.Context, method string, c Comment) (*http.Response, string, error) {
+	data := url.Values{}
+	data.Set("blog", p.BlogURL)
+	data.Set("user_ip", c.UserIP)
+	data.Set("user_agent", c.UserAgent)
+	data.Set("referrer", c.Referrer)
+	data.Set("permalink", c.Permalink)
+	data.Set("comment_type", "comment")
+	data.Set("comment_author", c.Author)
+	data.Set("comment_author_email", c.AuthorEmail)
+	data.Set("comment_author_url", c.AuthorURL)
+	data.Set("comment_content", c.Content)
+
+	endpoint := "https://" + url.PathEscape(p.APIKey) + ".rest.akismet.com/1.1/" + method
+	if apiURL := strings.TrimRight(strings.TrimSpace(p.APIURL), "/"); apiURL != "" {
+		endpoint = apiURL + "/" + method
+		data.Set("api_key", p.APIKey)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		endpoint,
+		bytes.NewBufferString(data.Encode()),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create Akismet request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "fyndmark | akismet-go/1.0")
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("akismet request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read Akismet response: %w", err)
+	}
+	return resp, strings.TrimSpace(string(b)), nil
+}
+
+func debugHelp(resp *http.Response, body string) string {
+	if msg := resp.Header.Get("X-akismet-debug-help"); msg != "" {
+		return msg
+	}
+	return body
+}
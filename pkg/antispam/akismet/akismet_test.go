@@ -0,0 +1,107 @@
+package akismet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeAkismet answers every request with status and body and records the forms.
+func fakeAkismet(t *testing.T, status int, body string, header http.Header) (*Provider, *[]url.Values) {
+	t.Helper()
+	var forms []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		r.PostForm.Set("method", strings.TrimPrefix(r.URL.Path, "/1.1/"))
+		forms = append(forms, r.PostForm)
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	p, err := New("k3y", "https://blog.example.org/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.APIURL = srv.URL + "/1.1/"
+	return p, &forms
+}
+
+var comment = Comment{UserIP: "192.0.2.1", UserAgent: "Mozilla/5.0", Permalink: "https://blog.example.org/p/", Author: "Bob", AuthorEmail: "bob@example.org", Content: "Buy now"}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		header   http.Header
+		wantSpam bool
+		wantErr  string
+	}{
+		{"spam", http.StatusOK, "true", nil, true, ""},
+		{"ham", http.StatusOK, "false\n", nil, false, ""},
+		{"invalid key", http.StatusOK, "invalid", http.Header{"X-Akismet-Debug-Help": {"Your API key is invalid."}}, false, "Your API key is invalid."},
+		{"server error", http.StatusInternalServerError, "oops", nil, false, "unexpected Akismet response: oops"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, forms := fakeAkismet(t, tt.status, tt.body, tt.header)
+			spam, err := p.Check(context.Background(), comment)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spam != tt.wantSpam {
+				t.Fatalf("spam = %t, want %t", spam, tt.wantSpam)
+			}
+			f := (*forms)[0]
+			for k, want := range map[string]string{
+				"method": "comment-check", "api_key": "k3y", "blog": "https://blog.example.org/", "user_ip": "192.0.2.1",
+				"comment_type": "comment", "comment_author_email": "bob@example.org", "comment_content": "Buy now",
+			} {
+				if got := f.Get(k); got != want {
+					t.Errorf("%s = %q, want %q", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckUnreachable(t *testing.T) {
+	p, _ := fakeAkismet(t, http.StatusOK, "true", nil)
+	p.APIURL = "http://127.0.0.1:1"
+	if _, err := p.Check(context.Background(), comment); err == nil || !strings.Contains(err.Error(), "akismet request failed") {
+		t.Fatalf("err = %v, want request error", err)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	p, forms := fakeAkismet(t, http.StatusOK, "Thanks for making the web a better place.", nil)
+	if err := p.SubmitSpam(context.Background(), comment); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SubmitHam(context.Background(), comment); err != nil {
+		t.Fatal(err)
+	}
+	if len(*forms) != 2 || (*forms)[0].Get("method") != "submit-spam" || (*forms)[1].Get("method") != "submit-ham" {
+		t.Fatalf("requests = %v", *forms)
+	}
+
+	p, _ = fakeAkismet(t, http.StatusForbidden, "forbidden", nil)
+	if err := p.SubmitSpam(context.Background(), comment); err == nil || !strings.Contains(err.Error(), "akismet submit-spam failed: forbidden") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+// Package antispam classifies new comments as spam before they enter moderation.
+package antispam
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/antispam/akismet"
+	"github.com/geschke/fyndmark/pkg/secrets"
+)
+
+// Comment holds the data available to spam checks.
+type Comment struct {
+	UserIP      string
+	UserAgent   string
+	Referrer    string
+	Permalink   string
+	Author      string
+	AuthorEmail string
+	AuthorURL   string
+	Body        string
+
+	// Recent submissions of the site, used by the heuristics (see Score).
+	RecentSameIP   int64
+	RecentSameBody int64
+
+	// RuleFeedback holds the moderator decisions per heuristic rule of the site (see Score).
+	RuleFeedback map[string]RuleFeedback
+}
+
+// RuleFeedback counts how often moderators confirmed (Spam) or rescued (Ham)
+// comments a heuristic rule matched.
+type RuleFeedback struct {
+	Spam int64
+	Ham  int64
+}
+
+type Result struct {
+	Spam bool
+	// Reason names the check that classified the comment as spam.
+	Reason string
+	// Score is the heuristic spam score (0 if heuristics are disabled).
+	Score int
+	// Rules lists the heuristic rules that contributed to the score.
+	Rules []string
+}
+
+// HeuristicsEnabled reports whether the site uses the built-in spam scoring.
+func HeuristicsEnabled(cfg config.AntispamConfig) bool {
+	return cfg.Heuristics != nil && cfg.Heuristics.Enabled
+}
+
+// Check runs the spam checks configured for a site.
+// An error means a check could not be performed; callers should fall back to
+// normal moderation instead of rejecting the comment.
+func Check(ctx context.Context, cfg config.AntispamConfig, c Comment) (Result, error) {
+	var res Result
+
+	// Heuristics run first; a comment above the threshold is not sent to external services.
+	if HeuristicsEnabled(cfg) {
+		res.Score, res.Rules = Score(cfg.Heuristics, c)
+		if res.Score >= threshold(cfg.Heuristics) {
+			res.Spam = true
+			res.Reason = "heuristics"
+			return res, nil
+		}
+	}
+
+	if ak := cfg.Akismet; ak != nil && ak.Enabled {
+		provider, err := newAkismet(ak)
+		if err != nil {
+			return res, err
+		}
+		spam, err := provider.Check(ctx, akismetComment(c))
+		if err != nil {
+			return res, err
+		}
+		if spam {
+			res.Spam = true
+			res.Reason = "akismet"
+		}
+	}
+
+	return res, nil
+}
+
+// Report feeds a moderator decision back to the external spam providers of a site:
+// spam marks a comment as spam, otherwise it was rescued from spam.
+// Heuristic rule feedback is stored by the caller and passed in via Comment.RuleFeedback.
+func Report(ctx context.Context, cfg config.AntispamConfig, c Comment, spam bool) error {
+	ak := cfg.Akismet
+	if ak == nil || !ak.Enabled {
+		return nil
+	}
+
+	provider, err := newAkismet(ak)
+	if err != nil {
+		return err
+	}
+	if spam {
+		return provider.SubmitSpam(ctx, akismetComment(c))
+	}
+	return provider.SubmitHam(ctx, akismetComment(c))
+}
+
+// newAkismet returns the Akismet client of a site.
+func newAkismet(ak *config.AkismetConfig) (*akismet.Provider, error) {
+	apiKey, err := secrets.Decrypt(ak.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("akismet api key: %w", err)
+	}
+	provider, err := akismet.New(apiKey, ak.BlogURL)
+	if err != nil {
+		return nil, err
+	}
+	provider.APIURL = ak.APIURL
+	return provider, nil
+}
+
+func akismetComment(c Comment) akismet.Comment {
+	return akismet.Comment{
+		UserIP:      c.UserIP,
+		UserAgent:   c.UserAgent,
+		Referrer:    c.Referrer,
+		Permalink:   c.Permalink,
+		Author:      c.Author,
+		AuthorEmail: c.AuthorEmail,
+		AuthorURL:   c.AuthorURL,
+		Content:     c.Body,
+	}
+}
@@ -0,0 +1,179 @@
+package antispam
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// DefaultThreshold is used when heuristics.threshold is not set.
+const DefaultThreshold = 10
+
+// defaultPhrases are typical phrases of comment spam (matched case-insensitively).
+var defaultPhrases = []string{
+	"viagra",
+	"cialis",
+	"casino",
+	"online poker",
+	"payday loan",
+	"crypto investment",
+	"bitcoin investment",
+	"forex signals",
+	"seo services",
+	"backlinks",
+	"buy followers",
+	"work from home",
+	"make money online",
+	"click here",
+	"escort",
+}
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)[^\s<>"]+`)
+
+// Score returns the heuristic spam score of a comment and the names of the rules that matched.
+//
+// Rules:
+//   - links: 2 points per link from the second link on, plus 3 if the author name contains a link
+//   - url_only: 6 points if the body consists of links only
+//   - duplicate: 6 points if the same body was submitted recently
+//   - flood: 2 points per recent submission from the same IP beyond the second
+//   - phrase: 3 points per known spam phrase
+//   - entropy: 3 points for a long, highly repetitive body; 2 for a random-looking author name
+//
+// The points of a rule are weighted with the moderator feedback in c.RuleFeedback (see ruleWeight).
+func Score(cfg *config.HeuristicsConfig, c Comment) (int, []string) {
+	score := 0
+	var rules []string
+	add := func(points int, rule string) {
+		if points <= 0 {
+			return
+		}
+		score += int(math.Round(float64(points) * ruleWeight(c.RuleFeedback[rule])))
+		rules = append(rules, rule)
+	}
+
+	body := strings.TrimSpace(c.Body)
+	lowerBody := strings.ToLower(body)
+
+	links := linkPattern.FindAllString(body, -1)
+	if len(links) > 1 {
+		add(2*(len(links)-1), "links")
+	}
+	if linkPattern.MatchString(c.Author) {
+		add(3, "links")
+	}
+
+	if len(links) > 0 && strings.TrimSpace(linkPattern.ReplaceAllString(body, "")) == "" {
+		add(6, "url_only")
+	}
+
+	if c.RecentSameBody > 0 {
+		add(6, "duplicate")
+	}
+	if c.RecentSameIP > 2 {
+		add(2*int(c.RecentSameIP-2), "flood")
+	}
+
+	phrases := defaultPhrases
+	if cfg != nil {
+		phrases = append(append([]string{}, defaultPhrases...), cfg.Phrases...)
+	}
+	for _, p := range phrases {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p != "" && strings.Contains(lowerBody, p) {
+			add(3, "phrase")
+		}
+	}
+
+	if utf8.RuneCountInString(body) >= 40 && entropy(body) < 2.5 {
+		add(3, "entropy")
+	}
+	if looksRandom(c.Author) {
+		add(2, "entropy")
+	}
+
+	return score, uniqueRules(rules)
+}
+
+// ruleWeight scales a rule by how often moderators agreed with it: (spam+1)/(ham+1),
+// limited to 0.5–2 so a few decisions cannot disable or dominate a rule.
+func ruleWeight(f RuleFeedback) float64 {
+	w := float64(f.Spam+1) / float64(f.Ham+1)
+	return math.Min(2, math.Max(0.5, w))
+}
+
+// threshold returns the configured threshold or the default.
+func threshold(cfg *config.HeuristicsConfig) int {
+	if cfg == nil || cfg.Threshold <= 0 {
+		return DefaultThreshold
+	}
+	return cfg.Threshold
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range strings.ToLower(s) {
+		counts[r]++
+		total++
+	}
+	if total == 0 {
+		return 0
+	}
+
+	var h float64
+	for _, n := range counts {
+		p := float64(n) / float64(total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// looksRandom reports whether an author name looks like generated gibberish:
+// a single long token with high character entropy, mixed letters and digits or no vowels.
+func looksRandom(author string) bool {
+	author = strings.TrimSpace(author)
+	if utf8.RuneCountInString(author) < 10 || strings.ContainsAny(author, " -'.") {
+		return false
+	}
+
+	letters, digits, vowels, upper := 0, 0, 0, 0
+	for _, r := range author {
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+			if strings.ContainsRune("aeiouyäöüàáâèéêìíîòóôùúû", unicode.ToLower(r)) {
+				vowels++
+			}
+		case unicode.IsDigit(r):
+			digits++
+		}
+	}
+
+	if entropy(author) < 3.0 {
+		return false
+	}
+	return (letters > 0 && digits > 0) || vowels == 0 || upper > 3
+}
+
+// uniqueRules performs its package-specific operation.
+func uniqueRules(rules []string) []string {
+	seen := make(map[string]struct{}, len(rules))
+	out := make([]string, 0, len(rules))
+	for _, r := range rules {
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+package antispam
+
+import (
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestScoreRegularComment(t *testing.T) {
+	score, rules := Score(&config.HeuristicsConfig{Enabled: true}, Comment{
+		Author: "Jane Doe",
+		Body:   "Thanks for the write-up, the part about shallow clones saved me some time. See also https://example.org/notes",
+	})
+	if score >= DefaultThreshold {
+		t.Fatalf("regular comment scored %d (rules %v)", score, rules)
+	}
+}
+
+func TestScoreSpamComment(t *testing.T) {
+	score, rules := Score(&config.HeuristicsConfig{Enabled: true}, Comment{
+		Author:         "xK9qZr7vWp2L",
+		Body:           "https://spam.example/a https://spam.example/b https://spam.example/c",
+		RecentSameBody: 1,
+	})
+	if score < DefaultThreshold {
+		t.Fatalf("spam comment scored only %d (rules %v)", score, rules)
+	}
+}
+
+func TestScoreCustomPhrases(t *testing.T) {
+	cfg := &config.HeuristicsConfig{Enabled: true, Phrases: []string{"Cheap Watches"}}
+	score, _ := Score(cfg, Comment{Author: "Bob", Body: "cheap watches here"})
+	if score != 3 {
+		t.Fatalf("expected phrase score 3, got %d", score)
+	}
+}
+
+func TestScoreRuleFeedback(t *testing.T) {
+	cfg := &config.HeuristicsConfig{Enabled: true}
+	c := Comment{Author: "Bob", Body: "cheap casino bonus"}
+
+	c.RuleFeedback = map[string]RuleFeedback{"phrase": {Ham: 9}}
+	if score, _ := Score(cfg, c); score != 2 {
+		t.Fatalf("expected down-weighted score 2, got %d", score)
+	}
+
+	c.RuleFeedback = map[string]RuleFeedback{"phrase": {Spam: 20}}
+	if score, _ := Score(cfg, c); score != 6 {
+		t.Fatalf("expected up-weighted score 6, got %d", score)
+	}
+}
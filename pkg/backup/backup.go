@@ -0,0 +1,162 @@
+// Package backup makes backups of the SQLite database for the schedule in the backup
+// config section and removes old ones, in a directory and/or an S3 bucket.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/publish"
+)
+
+const (
+	namePrefix = "fyndmark-"
+	nameSuffix = ".sqlite"
+)
+
+// FileName returns the file name of a backup made at t. Names sort by time.
+func FileName(t time.Time) string {
+	return namePrefix + t.UTC().Format("20060102T150405Z") + nameSuffix
+}
+
+// isBackup reports whether name was made by FileName.
+func isBackup(name string) bool {
+	return strings.HasPrefix(name, namePrefix) && strings.HasSuffix(name, nameSuffix)
+}
+
+// Validate checks the targets of cfg.
+func Validate(cfg config.BackupConfig) error {
+	if strings.TrimSpace(cfg.Dir) == "" && strings.TrimSpace(cfg.S3.Bucket) == "" {
+		return fmt.Errorf("backup.dir or backup.s3.bucket must be set")
+	}
+	if strings.TrimSpace(cfg.S3.Bucket) != "" {
+		if err := publish.Validate(config.PublishConfig{Type: publish.TypeS3, S3: cfg.S3}); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	}
+	return nil
+}
+
+// Run makes a backup into the targets of cfg and then removes the backups beyond
+// cfg.Keep. It returns the locations of the new backup.
+func Run(ctx context.Context, database *db.DB, cfg config.BackupConfig) ([]string, error) {
+	return run(ctx, database, cfg, time.Now())
+}
+
+func run(ctx context.Context, database *db.DB, cfg config.BackupConfig, now time.Time) ([]string, error) {
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	name := FileName(now)
+	dir := strings.TrimSpace(cfg.Dir)
+
+	// Without a directory, the file only lives until it is uploaded.
+	target := dir
+	if target == "" {
+		tmp, err := os.MkdirTemp("", "fyndmark-backup-")
+		if err != nil {
+			return nil, fmt.Errorf("backup: %w", err)
+		}
+		defer func() { _ = os.RemoveAll(tmp) }()
+		target = tmp
+	} else if err := os.MkdirAll(target, 0o700); err != nil {
+		return nil, fmt.Errorf("backup dir: %w", err)
+	}
+
+	path := filepath.Join(target, name)
+	if err := database.Backup(ctx, path); err != nil {
+		return nil, err
+	}
+	// The copy holds password hashes and the e-mail addresses of commenters.
+	if err := os.Chmod(path, 0o600); err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+
+	var out []string
+	if dir != "" {
+		out = append(out, path)
+		if err := pruneDir(dir, cfg.Keep); err != nil {
+			return out, err
+		}
+	}
+	if strings.TrimSpace(cfg.S3.Bucket) != "" {
+		location, err := upload(ctx, path, name, cfg)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, location)
+	}
+	return out, nil
+}
+
+// pruneDir removes the oldest backups in dir beyond keep (0 = keep all).
+func pruneDir(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("list backups: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && isBackup(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return fmt.Errorf("remove old backup: %w", err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// upload stores the backup at path in the bucket of cfg and removes the oldest backups
+// there beyond cfg.Keep. It returns the s3:// URL of the object.
+func upload(ctx context.Context, path, name string, cfg config.BackupConfig) (string, error) {
+	bucket, err := publish.NewS3Bucket(cfg.S3)
+	if err != nil {
+		return "", err
+	}
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read backup: %w", err)
+	}
+
+	prefix := strings.TrimSpace(cfg.S3.Prefix)
+	if err := bucket.Put(ctx, prefix+name, body, "application/vnd.sqlite3"); err != nil {
+		return "", err
+	}
+	location := "s3://" + strings.TrimSpace(cfg.S3.Bucket) + "/" + prefix + name
+
+	if cfg.Keep <= 0 {
+		return location, nil
+	}
+	keys, err := bucket.Keys(ctx, prefix+namePrefix)
+	if err != nil {
+		return location, err
+	}
+	var backups []string
+	for _, key := range keys {
+		if isBackup(strings.TrimPrefix(key, prefix)) {
+			backups = append(backups, key)
+		}
+	}
+	for len(backups) > cfg.Keep {
+		if err := bucket.Delete(ctx, backups[0]); err != nil {
+			return location, err
+		}
+		backups = backups[1:]
+	}
+	return location, nil
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// fakeS3 is an in-memory bucket for path-style requests.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch r.Method {
+	case http.MethodPut:
+		b, _ := io.ReadAll(r.Body)
+		f.objects[key] = b
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct{ Key string }
+		}
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				result.Contents = append(result.Contents, struct{ Key string }{k})
+			}
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+	}
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for k := range f.objects {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestRun(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "live.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeS3{objects: map[string][]byte{
+		"db/" + FileName(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)): []byte("old"),
+		"db/notes.txt": []byte("keep"),
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{FileName(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)), FileName(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)), "notes.txt"} {
+		_ = os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600)
+	}
+
+	cfg := config.BackupConfig{
+		Keep: 2,
+		Dir:  dir,
+		S3: config.PublishS3Config{
+			Bucket:          "bucket",
+			Prefix:          "db/",
+			Endpoint:        srv.URL,
+			AccessKeyID:     "key",
+			SecretAccessKey: "secret",
+		},
+	}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	locations, err := run(context.Background(), database, cfg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := FileName(now)
+	if len(locations) != 2 || locations[0] != filepath.Join(dir, name) || locations[1] != "s3://bucket/db/"+name {
+		t.Fatalf("locations = %v", locations)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{FileName(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)), name, "notes.txt"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("dir = %v, want %v", names, want)
+	}
+	if info, err := os.Stat(locations[0]); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("backup file: %v, %v", info, err)
+	}
+
+	// The bucket has one older backup, so both are kept.
+	if got := strings.Join(fake.keys(), " "); got != "db/"+FileName(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))+" db/"+name+" db/notes.txt" {
+		t.Errorf("bucket = %s", got)
+	}
+	cfg.Keep = 1
+	cfg.Dir = ""
+	if _, err := run(context.Background(), database, cfg, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fake.keys(), " "); got != "db/"+FileName(now.Add(time.Hour))+" db/notes.txt" {
+		t.Errorf("bucket after keep=1 = %s", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(config.BackupConfig{}); err == nil {
+		t.Error("no target accepted")
+	}
+	if err := Validate(config.BackupConfig{S3: config.PublishS3Config{Bucket: "b"}}); err == nil {
+		t.Error("bucket without keys accepted")
+	}
+	if err := Validate(config.BackupConfig{Dir: "/var/backups"}); err != nil {
+		t.Error(err)
+	}
+}
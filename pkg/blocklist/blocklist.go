@@ -0,0 +1,111 @@
+// Package blocklist normalizes blocklist values and matches comment submissions against them.
+package blocklist
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// Submission holds the values of a new comment that are checked against the blocklist.
+type Submission struct {
+	Email     string
+	IP        string
+	AuthorURL string
+}
+
+// Normalize validates a value for the given kind and returns its canonical form.
+func Normalize(kind, value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "", fmt.Errorf("value is empty")
+	}
+
+	switch kind {
+	case db.BlockEmail:
+		if !strings.Contains(value, "@") {
+			return "", fmt.Errorf("invalid email address")
+		}
+		return value, nil
+	case db.BlockEmailDomain, db.BlockURLDomain:
+		value = strings.TrimPrefix(value, "@")
+		value = strings.TrimPrefix(value, "*.")
+		value = strings.TrimSuffix(value, ".")
+		if value == "" || strings.ContainsAny(value, "/@: ") || !strings.Contains(value, ".") {
+			return "", fmt.Errorf("invalid domain")
+		}
+		return value, nil
+	case db.BlockIP:
+		if _, ipNet, err := net.ParseCIDR(value); err == nil {
+			return ipNet.String(), nil
+		}
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return "", fmt.Errorf("invalid IP address or CIDR")
+		}
+		return ip.String(), nil
+	default:
+		return "", fmt.Errorf("invalid kind %q", kind)
+	}
+}
+
+// Match returns the first entry matching the submission.
+// Domain entries also match subdomains.
+func Match(entries []db.BlocklistEntry, s Submission) (db.BlocklistEntry, bool) {
+	email := strings.ToLower(strings.TrimSpace(s.Email))
+	emailDomain := ""
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		emailDomain = email[at+1:]
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(s.IP))
+
+	urlHost := ""
+	if s.AuthorURL != "" {
+		if u, err := url.Parse(strings.TrimSpace(s.AuthorURL)); err == nil {
+			urlHost = strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+		}
+	}
+
+	for _, e := range entries {
+		switch e.Kind {
+		case db.BlockEmail:
+			if email != "" && email == e.Value {
+				return e, true
+			}
+		case db.BlockEmailDomain:
+			if matchDomain(emailDomain, e.Value) {
+				return e, true
+			}
+		case db.BlockURLDomain:
+			if matchDomain(urlHost, e.Value) {
+				return e, true
+			}
+		case db.BlockIP:
+			if ip == nil {
+				continue
+			}
+			if _, ipNet, err := net.ParseCIDR(e.Value); err == nil {
+				if ipNet.Contains(ip) {
+					return e, true
+				}
+				continue
+			}
+			if blocked := net.ParseIP(e.Value); blocked != nil && blocked.Equal(ip) {
+				return e, true
+			}
+		}
+	}
+	return db.BlocklistEntry{}, false
+}
+
+// matchDomain reports whether host equals domain or is a subdomain of it.
+func matchDomain(host, domain string) bool {
+	if host == "" || domain == "" {
+		return false
+	}
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
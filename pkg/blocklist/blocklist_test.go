@@ -0,0 +1,119 @@
+package blocklist
+
+import (
+	"testing"
+
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		kind    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{db.BlockEmail, "  Spammer@Example.ORG ", "spammer@example.org", false},
+		{db.BlockEmail, "spammer.example.org", "", true},
+		{db.BlockEmail, "   ", "", true},
+		{db.BlockEmail, "", "", true},
+
+		{db.BlockEmailDomain, " Example.ORG ", "example.org", false},
+		{db.BlockEmailDomain, "@example.org", "example.org", false},
+		{db.BlockEmailDomain, "*.example.org", "example.org", false},
+		{db.BlockEmailDomain, "example.org.", "example.org", false},
+		{db.BlockEmailDomain, "localhost", "", true},
+		{db.BlockEmailDomain, "user@example.org", "", true},
+		{db.BlockEmailDomain, "@", "", true},
+		{db.BlockEmailDomain, "", "", true},
+
+		{db.BlockURLDomain, "SPAM.example", "spam.example", false},
+		{db.BlockURLDomain, "https://spam.example/", "", true},
+		{db.BlockURLDomain, "spam .example", "", true},
+		{db.BlockURLDomain, " ", "", true},
+
+		{db.BlockIP, " 192.0.2.1 ", "192.0.2.1", false},
+		{db.BlockIP, "192.0.2.77/24", "192.0.2.0/24", false},
+		{db.BlockIP, "2001:DB8::1", "2001:db8::1", false},
+		{db.BlockIP, "2001:db8::1/32", "2001:db8::/32", false},
+		{db.BlockIP, "192.0.2.300", "", true},
+		{db.BlockIP, "", "", true},
+
+		{"phone", "123", "", true},
+	}
+	for _, tc := range cases {
+		got, err := Normalize(tc.kind, tc.value)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("Normalize(%q, %q) = %q, %v; want %q, error %t", tc.kind, tc.value, got, err, tc.want, tc.wantErr)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	entry := func(id int64, kind, value string) db.BlocklistEntry {
+		return db.BlocklistEntry{ID: id, Kind: kind, Value: value}
+	}
+	entries := []db.BlocklistEntry{
+		entry(1, db.BlockEmail, "spammer@example.org"),
+		entry(2, db.BlockEmailDomain, "spam.example"),
+		entry(3, db.BlockURLDomain, "casino.example"),
+		entry(4, db.BlockIP, "192.0.2.1"),
+		entry(5, db.BlockIP, "198.51.100.0/24"),
+		entry(6, db.BlockIP, "2001:db8::/32"),
+	}
+	cases := []struct {
+		name string
+		s    Submission
+		want int64 // 0 = no match
+	}{
+		{"exact email", Submission{Email: "spammer@example.org"}, 1},
+		{"email case and whitespace", Submission{Email: "  SPAMMER@Example.Org "}, 1},
+		{"other email on domain", Submission{Email: "friend@example.org"}, 0},
+		{"email prefix", Submission{Email: "spammer@example.org.evil"}, 0},
+
+		{"email domain", Submission{Email: "a@spam.example"}, 2},
+		{"email subdomain", Submission{Email: "a@mail.Spam.Example"}, 2},
+		{"email domain suffix without dot", Submission{Email: "a@nospam.example"}, 0},
+
+		{"url domain", Submission{AuthorURL: "https://casino.example/win"}, 3},
+		{"url subdomain, case and port", Submission{AuthorURL: " https://WWW.Casino.Example:8443/ "}, 3},
+		{"url trailing dot", Submission{AuthorURL: "https://casino.example./"}, 3},
+		{"url domain suffix without dot", Submission{AuthorURL: "https://mycasino.example/"}, 0},
+		{"url domain only in path", Submission{AuthorURL: "https://blog.example/casino.example"}, 0},
+
+		{"exact ip", Submission{IP: " 192.0.2.1 "}, 4},
+		{"other ip", Submission{IP: "192.0.2.2"}, 0},
+		{"ip in cidr", Submission{IP: "198.51.100.200"}, 5},
+		{"ipv6 in cidr", Submission{IP: "2001:DB8::42"}, 6},
+		{"ipv4-mapped ipv6", Submission{IP: "::ffff:192.0.2.1"}, 4},
+		{"invalid ip", Submission{IP: "not-an-ip"}, 0},
+
+		{"empty submission", Submission{}, 0},
+		{"first match wins", Submission{Email: "spammer@example.org", IP: "192.0.2.1"}, 1},
+	}
+	for _, tc := range cases {
+		got, ok := Match(entries, tc.s)
+		if tc.want == 0 && ok {
+			t.Errorf("%s: matched entry %d, want no match", tc.name, got.ID)
+		}
+		if tc.want != 0 && (!ok || got.ID != tc.want) {
+			t.Errorf("%s: got entry %d (matched %t), want %d", tc.name, got.ID, ok, tc.want)
+		}
+	}
+
+	// Empty entries never match, not even empty submission values.
+	empty := []db.BlocklistEntry{
+		entry(7, db.BlockEmail, ""),
+		entry(8, db.BlockEmailDomain, ""),
+		entry(9, db.BlockURLDomain, ""),
+		entry(10, db.BlockIP, ""),
+	}
+	for _, s := range []Submission{{}, {Email: "a@example.org", IP: "192.0.2.1", AuthorURL: "https://example.org/"}, {Email: "no-at-sign"}} {
+		if got, ok := Match(empty, s); ok {
+			t.Errorf("empty entry %d matched %+v", got.ID, s)
+		}
+	}
+	if _, ok := Match(nil, Submission{Email: "spammer@example.org"}); ok {
+		t.Error("nil entries matched")
+	}
+}
@@ -0,0 +1,150 @@
+// Package builtin implements a self-hosted captcha: the server generates an arithmetic
+// challenge (as text or as a distorted image), stores the expected answer with a TTL
+// and checks the answer submitted with the comment. No external service is involved.
+package builtin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	ModeMath  = "math"
+	ModeImage = "image"
+
+	// DefaultTTL is the lifetime of a challenge if captcha.ttl_seconds is not set.
+	DefaultTTL = 10 * time.Minute
+)
+
+// Store persists challenges. Take must remove the challenge, so every challenge
+// can be answered only once.
+type Store interface {
+	CreateCaptchaChallenge(ctx context.Context, id, answer string, expiresAt int64) error
+	TakeCaptchaChallenge(ctx context.Context, id string, now int64) (answer string, found bool, err error)
+}
+
+// Challenge is sent to the client. The client submits "<ID>:<answer>" as captcha token.
+type Challenge struct {
+	ID        string `json:"challenge_id"`
+	Question  string `json:"question,omitempty"`
+	Image     string `json:"image,omitempty"` // data:image/png;base64,...
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type Provider struct {
+	Store Store
+}
+
+// New constructs and returns a new instance.
+func New(store Store) (*Provider, error) {
+	if store == nil {
+		return nil, fmt.Errorf("builtin captcha store is not configured")
+	}
+	return &Provider{Store: store}, nil
+}
+
+// NewChallenge creates and stores a challenge.
+func NewChallenge(ctx context.Context, store Store, mode string, ttl time.Duration) (Challenge, error) {
+	if store == nil {
+		return Challenge{}, fmt.Errorf("builtin captcha store is not configured")
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+
+	question, answer, err := arithmetic()
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return Challenge{}, fmt.Errorf("generate challenge id: %w", err)
+	}
+
+	ch := Challenge{
+		ID:        hex.EncodeToString(idBytes),
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+	}
+	if mode == ModeImage {
+		img, err := renderPNG(question + " = ?")
+		if err != nil {
+			return Challenge{}, err
+		}
+		ch.Image = img
+	} else {
+		ch.Question = question + " = ?"
+	}
+
+	if err := store.CreateCaptchaChallenge(ctx, ch.ID, answer, ch.ExpiresAt); err != nil {
+		return Challenge{}, err
+	}
+	return ch, nil
+}
+
+// Validate checks a token of the form "<challenge_id>:<answer>". The challenge is
+// consumed even if the answer is wrong.
+func (p *Provider) Validate(token, remoteIP string) (bool, []string, error) {
+	id, given, ok := strings.Cut(strings.TrimSpace(token), ":")
+	if !ok || id == "" {
+		return false, []string{"invalid-input-response"}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	answer, found, err := p.Store.TakeCaptchaChallenge(ctx, id, time.Now().Unix())
+	if err != nil {
+		return false, nil, err
+	}
+	if !found {
+		return false, []string{"timeout-or-duplicate"}, nil
+	}
+	if strings.TrimSpace(given) != answer {
+		return false, []string{"wrong-answer"}, nil
+	}
+	return true, nil, nil
+}
+
+// arithmetic returns a question like "7 + 12" and its answer.
+func arithmetic() (string, string, error) {
+	a, err := randInt(1, 20)
+	if err != nil {
+		return "", "", err
+	}
+	b, err := randInt(1, 20)
+	if err != nil {
+		return "", "", err
+	}
+	op, err := randInt(0, 2)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch op {
+	case 0:
+		return fmt.Sprintf("%d + %d", a, b), fmt.Sprint(a + b), nil
+	case 1:
+		if a < b {
+			a, b = b, a
+		}
+		return fmt.Sprintf("%d - %d", a, b), fmt.Sprint(a - b), nil
+	default:
+		a, b = a%10+1, b%10+1
+		return fmt.Sprintf("%d x %d", a, b), fmt.Sprint(a * b), nil
+	}
+}
+
+// randInt returns a random number in [lo, hi].
+func randInt(lo, hi int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(hi-lo+1)))
+	if err != nil {
+		return 0, fmt.Errorf("random number: %w", err)
+	}
+	return lo + int(n.Int64()), nil
+}
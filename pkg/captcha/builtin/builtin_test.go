@@ -0,0 +1,63 @@
+package builtin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memStore map[string]string
+
+func (m memStore) CreateCaptchaChallenge(ctx context.Context, id, answer string, expiresAt int64) error {
+	m[id] = answer
+	return nil
+}
+
+func (m memStore) TakeCaptchaChallenge(ctx context.Context, id string, now int64) (string, bool, error) {
+	a, ok := m[id]
+	delete(m, id)
+	return a, ok, nil
+}
+
+func TestChallengeIsSingleUse(t *testing.T) {
+	store := memStore{}
+	p, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := NewChallenge(context.Background(), store, ModeMath, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(ch.Question, " = ?") || ch.Image != "" {
+		t.Fatalf("unexpected math challenge: %+v", ch)
+	}
+	answer := store[ch.ID]
+
+	if ok, _, _ := p.Validate(ch.ID+":"+answer, ""); !ok {
+		t.Fatal("correct answer rejected")
+	}
+	if ok, codes, _ := p.Validate(ch.ID+":"+answer, ""); ok || codes[0] != "timeout-or-duplicate" {
+		t.Fatalf("reused challenge accepted (codes=%v)", codes)
+	}
+
+	ch, _ = NewChallenge(context.Background(), store, ModeMath, time.Minute)
+	if ok, codes, _ := p.Validate(ch.ID+":-1", ""); ok || codes[0] != "wrong-answer" {
+		t.Fatalf("wrong answer accepted (codes=%v)", codes)
+	}
+	if _, exists := store[ch.ID]; exists {
+		t.Fatal("challenge not consumed after wrong answer")
+	}
+}
+
+func TestImageChallenge(t *testing.T) {
+	ch, err := NewChallenge(context.Background(), memStore{}, ModeImage, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Question != "" || !strings.HasPrefix(ch.Image, "data:image/png;base64,") {
+		t.Fatalf("unexpected image challenge: question=%q image prefix=%q", ch.Question, ch.Image[:20])
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/captcha/builtin"
 	"github.com/geschke/fyndmark/pkg/captcha/hcaptcha"
 	"github.com/geschke/fyndmark/pkg/captcha/turnstile"
 )
@@ -13,18 +14,77 @@ type Provider interface {
 	Validate(token, remoteIP string) (bool, []string, error)
 }
 
-// ResolveProvider performs its package-specific operation.
+// challengeStore holds the challenges of the built-in provider (set by the server at startup).
+var challengeStore builtin.Store
+
+// SetChallengeStore configures the store used by the built-in provider.
+func SetChallengeStore(s builtin.Store) {
+	challengeStore = s
+}
+
+// ChallengeStore returns the store used by the built-in provider.
+func ChallengeStore() builtin.Store {
+	return challengeStore
+}
+
+// ResolveProvider returns the validator for a captcha config. With fallbacks it
+// returns a Chain trying the primary provider first.
 func ResolveProvider(cfg *config.CaptchaConfig) (Provider, error) {
 	if cfg == nil || !cfg.Enabled {
 		return nil, nil
 	}
 
+	primary, err := newProvider(*cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Fallbacks) == 0 {
+		return primary, nil
+	}
+
+	chain := Chain{primary}
+	for _, fb := range cfg.Fallbacks {
+		p, err := newProvider(fb)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+// Builtin returns the config of the builtin provider if it is the primary provider
+// or one of the fallbacks.
+func Builtin(cfg *config.CaptchaConfig) (*config.CaptchaConfig, bool) {
+	if cfg == nil || !cfg.Enabled {
+		return nil, false
+	}
+	if isBuiltin(*cfg) {
+		return cfg, true
+	}
+	for i := range cfg.Fallbacks {
+		if isBuiltin(cfg.Fallbacks[i]) {
+			return &cfg.Fallbacks[i], true
+		}
+	}
+	return nil, false
+}
+
+// isBuiltin performs its package-specific operation.
+func isBuiltin(cfg config.CaptchaConfig) bool {
+	return strings.EqualFold(strings.TrimSpace(cfg.Provider), "builtin")
+}
+
+// newProvider performs its package-specific operation.
+func newProvider(cfg config.CaptchaConfig) (Provider, error) {
 	name := strings.TrimSpace(strings.ToLower(cfg.Provider))
 	switch name {
 	case "turnstile":
 		return turnstile.New(cfg.SecretKey)
 	case "hcaptcha":
 		return hcaptcha.New(cfg.SecretKey)
+	case "builtin":
+		return builtin.New(challengeStore)
 	default:
 		return nil, fmt.Errorf("unknown captcha provider %q", cfg.Provider)
 	}
@@ -0,0 +1,37 @@
+package captcha
+
+import "log"
+
+// Chain tries providers in order. The token is accepted by the first provider that
+// validates it; a provider that fails (e.g. the service is unreachable) or rejects
+// the token hands over to the next one. The frontend decides which provider's token
+// it sends, typically the fallback's when the primary widget cannot be loaded.
+type Chain []Provider
+
+// Validate implements Provider.
+func (c Chain) Validate(token, remoteIP string) (bool, []string, error) {
+	var (
+		codes   []string
+		lastErr error
+		decided bool
+	)
+	for i, p := range c {
+		ok, errCodes, err := p.Validate(token, remoteIP)
+		if err != nil {
+			log.Printf("captcha provider %d of %d failed: %v", i+1, len(c), err)
+			lastErr = err
+			continue
+		}
+		if ok {
+			return true, nil, nil
+		}
+		decided = true
+		codes = append(codes, errCodes...)
+	}
+
+	// Only report an error if no provider could check the token at all.
+	if !decided && lastErr != nil {
+		return false, nil, lastErr
+	}
+	return false, codes, nil
+}
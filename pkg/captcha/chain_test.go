@@ -0,0 +1,46 @@
+package captcha
+
+import (
+	"errors"
+	"testing"
+)
+
+type stubProvider struct {
+	ok    bool
+	codes []string
+	err   error
+	calls int
+}
+
+func (s *stubProvider) Validate(token, remoteIP string) (bool, []string, error) {
+	s.calls++
+	return s.ok, s.codes, s.err
+}
+
+func TestChainFallsBack(t *testing.T) {
+	down := &stubProvider{err: errors.New("unreachable")}
+	fallback := &stubProvider{ok: true}
+	if ok, _, err := (Chain{down, fallback}).Validate("t", ""); !ok || err != nil {
+		t.Fatalf("fallback not used: ok=%t err=%v", ok, err)
+	}
+
+	primary := &stubProvider{ok: true}
+	unused := &stubProvider{ok: true}
+	if ok, _, _ := (Chain{primary, unused}).Validate("t", ""); !ok || unused.calls != 0 {
+		t.Fatalf("fallback called although primary accepted (calls=%d)", unused.calls)
+	}
+}
+
+func TestChainRejects(t *testing.T) {
+	rejecting := &stubProvider{codes: []string{"invalid-input-response"}}
+	down := &stubProvider{err: errors.New("unreachable")}
+
+	ok, codes, err := (Chain{rejecting, down}).Validate("t", "")
+	if ok || err != nil || len(codes) != 1 {
+		t.Fatalf("got ok=%t codes=%v err=%v, want rejection without error", ok, codes, err)
+	}
+
+	if _, _, err := (Chain{down, down}).Validate("t", ""); err == nil {
+		t.Fatal("expected error when no provider could check the token")
+	}
+}
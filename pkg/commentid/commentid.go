@@ -0,0 +1,108 @@
+// Package commentid generates the IDs of new comments. The strategy is selected with
+// comment_ids.strategy; further strategies can be added with Register.
+package commentid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// DefaultStrategy is used if comment_ids.strategy is empty.
+const DefaultStrategy = "ulid"
+
+// Generator creates comment IDs. IDs must be unique, at most 64 characters and should
+// sort roughly by creation time.
+type Generator interface {
+	New(t time.Time) (string, error)
+	// Valid reports whether id has the format of this generator.
+	Valid(id string) bool
+}
+
+// Factory creates a generator from the comment_ids config.
+type Factory func(cfg config.CommentIDsConfig) (Generator, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{}
+	formats   = map[string]Generator{}
+	current   Generator
+)
+
+// Register makes a strategy available under name. It is meant to be called from init
+// functions and panics on duplicate names.
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("commentid: strategy registered twice: " + name)
+	}
+	factories[name] = f
+	if g, err := f(config.CommentIDsConfig{}); err == nil {
+		formats[name] = g
+	}
+}
+
+// Strategies returns the names of the registered strategies.
+func Strategies() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]string, 0, len(factories))
+	for name := range factories {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ValidateConfig checks comment_ids and selects the generator used by New.
+func ValidateConfig() error {
+	cfg := config.Cfg.CommentIDs
+	name := strings.ToLower(strings.TrimSpace(cfg.Strategy))
+	if name == "" {
+		name = DefaultStrategy
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	f, ok := factories[name]
+	if !ok {
+		return fmt.Errorf("comment_ids.strategy: unknown strategy %q", cfg.Strategy)
+	}
+	g, err := f(cfg)
+	if err != nil {
+		return fmt.Errorf("comment_ids: %w", err)
+	}
+	current = g
+	return nil
+}
+
+// New returns a new comment ID of the configured strategy.
+func New() (string, error) {
+	mu.RLock()
+	g := current
+	mu.RUnlock()
+	if g == nil {
+		mu.RLock()
+		g = formats[DefaultStrategy]
+		mu.RUnlock()
+	}
+	return g.New(time.Now())
+}
+
+// Valid reports whether id has the format of any registered strategy, so comments
+// imported with another strategy stay addressable.
+func Valid(id string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, g := range formats {
+		if g.Valid(id) {
+			return true
+		}
+	}
+	return false
+}
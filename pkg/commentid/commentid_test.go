@@ -0,0 +1,75 @@
+package commentid
+
+import (
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestStrategies(t *testing.T) {
+	defer func() { config.Cfg.CommentIDs = config.CommentIDsConfig{}; current = nil }()
+
+	for _, tc := range []struct {
+		strategy string
+		length   int
+	}{
+		{"", 26},
+		{"uuidv7", 36},
+		{"snowflake", 0},
+	} {
+		config.Cfg.CommentIDs = config.CommentIDsConfig{Strategy: tc.strategy, NodeID: 3}
+		if err := ValidateConfig(); err != nil {
+			t.Fatalf("%q: %v", tc.strategy, err)
+		}
+
+		prev := ""
+		for i := 0; i < 100; i++ {
+			id, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.length > 0 && len(id) != tc.length {
+				t.Fatalf("%q: unexpected id %q", tc.strategy, id)
+			}
+			if !Valid(id) {
+				t.Fatalf("%q: generated id %q is not valid", tc.strategy, id)
+			}
+			if id == prev {
+				t.Fatalf("%q: duplicate id %q", tc.strategy, id)
+			}
+			prev = id
+		}
+	}
+
+	config.Cfg.CommentIDs = config.CommentIDsConfig{Strategy: "serial"}
+	if err := ValidateConfig(); err == nil {
+		t.Fatal("expected an error for an unknown strategy")
+	}
+	config.Cfg.CommentIDs = config.CommentIDsConfig{Strategy: "snowflake", NodeID: 1024}
+	if err := ValidateConfig(); err == nil {
+		t.Fatal("expected an error for an out-of-range node id")
+	}
+
+	for _, bad := range []string{"", "abc", "0123", "01ARZ3NDEKTSV4RRFFQ69G5FA"} {
+		if Valid(bad) {
+			t.Fatalf("expected %q to be invalid", bad)
+		}
+	}
+}
+
+func TestSnowflakeSequence(t *testing.T) {
+	g, err := newSnowflake(config.CommentIDsConfig{NodeID: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	seen := map[string]bool{}
+	for i := 0; i < 5000; i++ { // more than one millisecond's sequence space
+		id, _ := g.New(now)
+		if seen[id] {
+			t.Fatalf("duplicate id %s after %d ids", id, i)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,72 @@
+package commentid
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// Snowflake layout: 41 bits milliseconds since snowflakeEpoch, 10 bits node ID,
+// 12 bits sequence. IDs are written as decimal numbers.
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+)
+
+// snowflakeEpoch is 2020-01-01T00:00:00Z in milliseconds.
+const snowflakeEpoch = 1577836800000
+
+type snowflakeGenerator struct {
+	node int64
+
+	mu     sync.Mutex
+	lastMS int64
+	seq    int64
+}
+
+// newSnowflake creates a snowflake generator for the configured node.
+func newSnowflake(cfg config.CommentIDsConfig) (Generator, error) {
+	if cfg.NodeID < 0 || cfg.NodeID > snowflakeMaxNode {
+		return nil, fmt.Errorf("node_id must be between 0 and %d", snowflakeMaxNode)
+	}
+	return &snowflakeGenerator{node: cfg.NodeID}, nil
+}
+
+// New returns the next snowflake ID for t.
+func (g *snowflakeGenerator) New(t time.Time) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := t.UnixMilli() - snowflakeEpoch
+	if ms < g.lastMS {
+		// Clock went backwards: continue on the last timestamp.
+		ms = g.lastMS
+	}
+	if ms == g.lastMS {
+		g.seq = (g.seq + 1) & snowflakeMaxSeq
+		if g.seq == 0 {
+			// Sequence exhausted within this millisecond, borrow the next one.
+			ms++
+		}
+	} else {
+		g.seq = 0
+	}
+	g.lastMS = ms
+
+	id := ms<<(snowflakeNodeBits+snowflakeSeqBits) | g.node<<snowflakeSeqBits | g.seq
+	return strconv.FormatInt(id, 10), nil
+}
+
+// Valid reports whether id is a positive decimal snowflake ID.
+func (g *snowflakeGenerator) Valid(id string) bool {
+	if id == "" || id[0] == '0' || len(id) > 19 {
+		return false
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	return err == nil && n>>(snowflakeNodeBits+snowflakeSeqBits) > 0
+}
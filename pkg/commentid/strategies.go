@@ -0,0 +1,61 @@
+package commentid
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
+)
+
+func init() {
+	Register("ulid", func(config.CommentIDsConfig) (Generator, error) { return &ulidGenerator{}, nil })
+	Register("uuidv7", func(config.CommentIDsConfig) (Generator, error) { return uuidV7Generator{}, nil })
+	Register("snowflake", newSnowflake)
+}
+
+// ulidGenerator creates 26-character ULIDs, monotonic within the same millisecond.
+type ulidGenerator struct {
+	mu      sync.Mutex
+	entropy *ulid.MonotonicEntropy
+}
+
+// New returns a ULID for t.
+func (g *ulidGenerator) New(t time.Time) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.entropy == nil {
+		g.entropy = ulid.Monotonic(rand.Reader, 0)
+	}
+	id, err := ulid.New(ulid.Timestamp(t), g.entropy)
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// Valid reports whether id is a ULID in canonical form.
+func (g *ulidGenerator) Valid(id string) bool {
+	_, err := ulid.ParseStrict(id)
+	return err == nil
+}
+
+// uuidV7Generator creates time-ordered UUIDs (RFC 9562) in the canonical lowercase form.
+type uuidV7Generator struct{}
+
+// New returns a UUIDv7; its timestamp is taken from the clock.
+func (uuidV7Generator) New(time.Time) (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// Valid reports whether id is a canonical UUIDv7.
+func (uuidV7Generator) Valid(id string) bool {
+	u, err := uuid.Parse(id)
+	return err == nil && len(id) == 36 && u.Version() == 7
+}
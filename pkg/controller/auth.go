@@ -3,14 +3,15 @@
 import (
 	"context"
 	"crypto/subtle"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/geschke/fyndmark/config"
-	"github.com/geschke/fyndmark/pkg/cors"
 	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/sessionstore"
 	"github.com/geschke/fyndmark/pkg/users"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
@@ -37,35 +38,8 @@ type loginRequest struct {
 	ReturnSecureToken bool   `json:"returnSecureToken"`
 }
 
-// OptionsLogin handles the CORS preflight request.
-func (ct AuthController) OptionsLogin(c *gin.Context) {
-	// Allow preflight for browser-based clients.
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-}
-
-// OptionsLogout handles the CORS preflight request.
-func (ct AuthController) OptionsLogout(c *gin.Context) {
-	// Allow preflight for browser-based clients.
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-}
-
-// OptionsMe handles the CORS preflight request.
-func (ct AuthController) OptionsMe(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-}
-
 // PostLogin performs its package-specific operation.
 func (ct AuthController) PostLogin(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-
 	if ct.DB == nil || ct.DB.SQL == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_NOT_INITIALIZED"})
 		return
@@ -74,6 +48,10 @@ func (ct AuthController) PostLogin(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "AUTH_NOT_CONFIGURED"})
 		return
 	}
+	if oc := config.Cfg.WebAdmin.OIDC; oc.Enabled && oc.DisablePasswordLogin {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "PASSWORD_LOGIN_DISABLED"})
+		return
+	}
 
 	var req loginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -106,56 +84,36 @@ func (ct AuthController) PostLogin(c *gin.Context) {
 	}
 
 	ok, err := users.VerifyPassword(password, u.Password)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "INVALID_CREDENTIALS"})
-		return
-	}
-	if !ok {
+	if err != nil || !ok {
+		recordLogin(ctx, c, ct.DB, u.ID, db.LoginMethodPassword, false)
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "INVALID_CREDENTIALS"})
 		return
 	}
 
-	sess, _ := ct.Store.Get(c.Request, ct.SessionName)
-	sess.Values["id"] = u.ID
-	sess.Values["email"] = u.Email
-	sess.Values["firstname"] = u.FirstName
-	sess.Values["lastname"] = u.LastName
-
-	maxAgeDays := config.Cfg.WebAdmin.CookieMaxAgeDays
-	if maxAgeDays <= 0 {
-		maxAgeDays = 30
-	}
-	maxAge := maxAgeDays * 24 * 60 * 60
-
-	sess.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   maxAge,
-		HttpOnly: true,
-		Secure:   config.Cfg.WebAdmin.CookieSecure,
-		SameSite: parseSameSite(config.Cfg.WebAdmin.CookieSameSite),
-	}
-
-	if err := sess.Save(c.Request, c.Writer); err != nil {
+	csrfToken, err := startSession(c, ct.Store, ct.SessionName, u, db.LoginMethodPassword)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "SESSION_SAVE_FAILED"})
 		return
 	}
+	recordLogin(ctx, c, ct.DB, u.ID, db.LoginMethodPassword, true)
 
+	reason := passwordChangeReason(u)
 	c.JSON(http.StatusOK, gin.H{
-		"success":   true,
-		"id":        strconv.FormatInt(u.ID, 10),
-		"email":     u.Email,
-		"firstname": u.FirstName,
-		"lastname":  u.LastName,
-		"session":   "cookie",
+		"success":                  true,
+		"id":                       strconv.FormatInt(u.ID, 10),
+		"email":                    u.Email,
+		"firstname":                u.FirstName,
+		"lastname":                 u.LastName,
+		"session":                  "cookie",
+		"csrf_token":               csrfToken,
+		"password_change_required": reason != "",
+		"password_change_reason":   reason,
 	})
 }
 
-// PostLogout performs its package-specific operation.
+// PostLogout clears the session. A session with a CSRF token must send it, like the
+// state-changing requests behind RequireAuth.
 func (ct AuthController) PostLogout(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-
 	if ct.Store == nil || strings.TrimSpace(ct.SessionName) == "" {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "AUTH_NOT_CONFIGURED"})
 		return
@@ -166,13 +124,18 @@ func (ct AuthController) PostLogout(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": true, "message": "LOGGED_OUT"})
 		return
 	}
+	// Logout is outside RequireAuth, so another site must not end a session either.
+	if token, _ := sess.Values[csrfSessionKey].(string); token != "" && !checkCSRF(c, sess) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "CSRF_TOKEN_INVALID"})
+		return
+	}
 
 	for k := range sess.Values {
 		delete(sess.Values, k)
 	}
 
 	sess.Options = &sessions.Options{
-		Path:     "/",
+		Path:     cookiePath(),
 		MaxAge:   -1,
 		HttpOnly: true,
 		Secure:   config.Cfg.WebAdmin.CookieSecure,
@@ -189,10 +152,6 @@ func (ct AuthController) PostLogout(c *gin.Context) {
 
 // GetMe returns the current authenticated user for a valid session.
 func (ct AuthController) GetMe(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-
 	if ct.DB == nil || ct.DB.SQL == nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_NOT_INITIALIZED"})
 		return
@@ -233,7 +192,7 @@ func (ct AuthController) GetMe(c *gin.Context) {
 			delete(sess.Values, k)
 		}
 		sess.Options = &sessions.Options{
-			Path:     "/",
+			Path:     cookiePath(),
 			MaxAge:   -1,
 			HttpOnly: true,
 			Secure:   config.Cfg.WebAdmin.CookieSecure,
@@ -244,8 +203,124 @@ func (ct AuthController) GetMe(c *gin.Context) {
 		return
 	}
 
+	csrfToken, err := ensureCSRFToken(c, sess)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "SESSION_SAVE_FAILED"})
+		return
+	}
+
+	reason := sessionPasswordChangeReason(sess, u)
 	u.Password = ""
-	c.JSON(http.StatusOK, gin.H{"success": true, "item": u})
+	c.JSON(http.StatusOK, gin.H{
+		"success":                  true,
+		"item":                     u,
+		"csrf_token":               csrfToken,
+		"password_change_required": reason != "",
+		"password_change_reason":   reason,
+	})
+}
+
+// GET /api/auth/providers
+// Tells the login page which login methods are available.
+func (ct AuthController) GetProviders(c *gin.Context) {
+	oc := config.Cfg.WebAdmin.OIDC
+	resp := gin.H{
+		"success":  true,
+		"password": !(oc.Enabled && oc.DisablePasswordLogin),
+		"oidc":     oc.Enabled,
+	}
+	if oc.Enabled {
+		resp["oidc_login_url"] = config.Cfg.Server.BasePath + "/api/auth/oidc/login"
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// sessionRegenerator is implemented by server-side session stores.
+type sessionRegenerator interface {
+	Regenerate(r *http.Request, session *sessions.Session) error
+}
+
+// startSession stores the login of u with the given method (db.LoginMethod*) in the
+// session cookie and returns the new CSRF token of the session.
+func startSession(c *gin.Context, store sessions.Store, sessionName string, u db.User, method string) (string, error) {
+	csrfToken, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+	c.Request = sessionstore.WithClientIP(c.Request, resolveClientIP(c, config.Cfg.Server.TrustedProxies))
+	sess, _ := store.Get(c.Request, sessionName)
+	// Every login gets a new session ID and starts without the values of the
+	// previous session, so an ID planted before the login is never authenticated.
+	if rg, ok := store.(sessionRegenerator); ok {
+		if err := rg.Regenerate(c.Request, sess); err != nil {
+			return "", err
+		}
+	}
+	for k := range sess.Values {
+		delete(sess.Values, k)
+	}
+	sess.Values[csrfSessionKey] = csrfToken
+	sess.Values[loginMethodKey] = method
+	sess.Values["id"] = u.ID
+	sess.Values["email"] = u.Email
+	sess.Values["firstname"] = u.FirstName
+	sess.Values["lastname"] = u.LastName
+
+	maxAgeDays := config.Cfg.WebAdmin.CookieMaxAgeDays
+	if maxAgeDays <= 0 {
+		maxAgeDays = 30
+	}
+	maxAge := maxAgeDays * 24 * 60 * 60
+
+	sess.Options = &sessions.Options{
+		Path:     cookiePath(),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   config.Cfg.WebAdmin.CookieSecure,
+		SameSite: parseSameSite(config.Cfg.WebAdmin.CookieSameSite),
+	}
+	return csrfToken, sess.Save(c.Request, c.Writer)
+}
+
+// recordLogin adds a login of userID to the login history.
+func recordLogin(ctx context.Context, c *gin.Context, database *db.DB, userID int64, method string, success bool) {
+	err := database.RecordLogin(ctx, db.LoginEvent{
+		UserID:    userID,
+		Success:   success,
+		Method:    method,
+		IP:        resolveClientIP(c, config.Cfg.Server.TrustedProxies),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		log.Printf("Record login of user %d failed: %v", userID, err)
+	}
+}
+
+// userSessionRevoker is implemented by server-side session stores.
+type userSessionRevoker interface {
+	RevokeUser(ctx context.Context, userID int64, keepID string) (int64, error)
+}
+
+// revokeUserSessions ends all sessions of a user except keepID. Sessions of the cookie
+// store cannot be revoked; they stay valid until the cookie expires.
+func revokeUserSessions(ctx context.Context, store sessions.Store, userID int64, keepID string) {
+	rv, ok := store.(userSessionRevoker)
+	if !ok {
+		return
+	}
+	if n, err := rv.RevokeUser(ctx, userID, keepID); err != nil {
+		log.Printf("Revoke sessions of user %d failed: %v", userID, err)
+	} else if n > 0 {
+		log.Printf("Revoked %d sessions of user %d", n, userID)
+	}
+}
+
+// cookiePath scopes the session cookie to the base path of the API.
+func cookiePath() string {
+	if p := config.Cfg.Server.BasePath; p != "" {
+		return p
+	}
+	return "/"
 }
 
 // parseSameSite performs its package-specific operation.
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/blocklist"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+type BlocklistController struct {
+	DB          *db.DB
+	Store       sessions.Store
+	SessionName string
+}
+
+type blocklistAddRequest struct {
+	SiteID int64  `json:"SiteID"`
+	Kind   string `json:"Kind"`
+	Value  string `json:"Value"`
+	Note   string `json:"Note"`
+}
+
+// NewBlocklistController constructs and returns a new instance.
+func NewBlocklistController(database *db.DB, store sessions.Store, sessionName string) *BlocklistController {
+	return &BlocklistController{
+		DB:          database,
+		Store:       store,
+		SessionName: sessionName,
+	}
+}
+
+// currentSessionUserID returns the authenticated user, see currentUserID.
+func (ct BlocklistController) currentSessionUserID(c *gin.Context) (int64, bool) {
+	return currentUserID(c, ct.Store, ct.SessionName)
+}
+
+// GET /api/blocklist/list?site_id=<id>
+func (ct BlocklistController) GetList(c *gin.Context) {
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	siteIDs, err := ct.DB.ListAllowedSiteIDsByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	if v := strings.TrimSpace(c.Query("site_id")); v != "" {
+		siteID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || siteID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+			return
+		}
+		if !containsID(siteIDs, siteID) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+			return
+		}
+		siteIDs = []int64{siteID}
+	}
+
+	items, err := ct.DB.ListBlocklist(ctx, siteIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"items":   items,
+	})
+}
+
+// POST /api/blocklist/add
+func (ct BlocklistController) PostAdd(c *gin.Context) {
+	var req blocklistAddRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+	if req.SiteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+		return
+	}
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	if !db.IsValidBlockKind(kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_KIND"})
+		return
+	}
+	value, err := blocklist.Normalize(kind, req.Value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_VALUE"})
+		return
+	}
+
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, req.SiteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+
+	id, created, err := ct.DB.AddBlocklistEntry(ctx, db.BlocklistEntry{
+		SiteID:    req.SiteID,
+		Kind:      kind,
+		Value:     value,
+		Note:      req.Note,
+		CreatedBy: userID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !created {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "ALREADY_EXISTS"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"id":      id,
+		"value":   value,
+	})
+}
+
+// POST /api/blocklist/delete/:id
+func (ct BlocklistController) PostDelete(c *gin.Context) {
+	id, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_ID"})
+		return
+	}
+
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	entry, found, err := ct.DB.GetBlocklistEntry(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, entry.SiteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+
+	if _, err := ct.DB.DeleteBlocklistEntry(ctx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// containsID performs its package-specific operation.
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
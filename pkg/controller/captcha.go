@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/captcha"
+	"github.com/geschke/fyndmark/pkg/captcha/builtin"
+	"github.com/geschke/fyndmark/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// Challenges per client IP and minute; limits the rows a single client can create.
+const captchaChallengesPerMinute = 20
+
+type CaptchaController struct {
+	Limiter *ratelimit.Limiter
+}
+
+// NewCaptchaController constructs and returns a new instance.
+func NewCaptchaController() *CaptchaController {
+	return &CaptchaController{Limiter: ratelimit.New()}
+}
+
+// GET /api/captcha/:sitekey/new
+func (ct CaptchaController) GetNew(c *gin.Context) {
+	siteKey := c.Param("sitekey")
+
+	siteCfg, ok := config.Cfg.CommentSites[siteKey]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return
+	}
+
+	cc, ok := captcha.Builtin(siteCfg.Captcha)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "captcha_not_builtin"})
+		return
+	}
+
+	if ok, wait := ct.Limiter.Allow(siteKey+"|"+resolveClientIP(c, config.Cfg.Server.TrustedProxies), captchaChallengesPerMinute, time.Minute); !ok {
+		retryAfter := int64((wait + time.Second - 1) / time.Second)
+		c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+		c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "error": "rate_limited", "retry_after": retryAfter})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mode := builtin.ModeMath
+	if strings.EqualFold(strings.TrimSpace(cc.Mode), builtin.ModeImage) {
+		mode = builtin.ModeImage
+	}
+	ch, err := builtin.NewChallenge(ctx, captcha.ChallengeStore(), mode, time.Duration(cc.TTLSeconds)*time.Second)
+	if err != nil {
+		log.Printf("Create captcha challenge failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "captcha_unavailable"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"challenge_id": ch.ID,
+		"question":     ch.Question,
+		"image":        ch.Image,
+		"expires_at":   ch.ExpiresAt,
+	})
+}
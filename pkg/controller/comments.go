@@ -3,10 +3,10 @@
 import (
 	"context"
 	"crypto/hmac"
-	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -17,19 +17,37 @@ import (
 	"unicode/utf8"
 
 	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/antispam"
+	"github.com/geschke/fyndmark/pkg/blocklist"
 	"github.com/geschke/fyndmark/pkg/captcha"
-	"github.com/geschke/fyndmark/pkg/cors"
+	"github.com/geschke/fyndmark/pkg/commentid"
 	"github.com/geschke/fyndmark/pkg/db"
-	"github.com/geschke/fyndmark/pkg/generator"
-	"github.com/geschke/fyndmark/pkg/mailer"
+	"github.com/geschke/fyndmark/pkg/events"
+	"github.com/geschke/fyndmark/pkg/ratelimit"
+	"github.com/geschke/fyndmark/pkg/respcache"
 	"github.com/geschke/fyndmark/pkg/sanitize"
+	"github.com/geschke/fyndmark/pkg/webhooks"
+	"github.com/geschke/fyndmark/pkg/wordfilter"
 	"github.com/gin-gonic/gin"
-	"github.com/oklog/ulid/v2"
+)
+
+// Field limits of comment submissions (basic DoS protection), also published via GetConfig.
+const (
+	maxAuthorRunes  = 80
+	maxAuthorURLLen = 2048
+	maxEmailLen     = 254
+	maxPostPathLen  = 512
+	maxEntryIDLen   = 128
+	maxBodyLen      = 20000
 )
 
 type CommentsController struct {
 	DB       *db.DB
 	Enqueuer PipelineEnqueuer
+	Events   *events.Broker
+	Webhooks *webhooks.Dispatcher
+	Limiter  *ratelimit.Limiter
+	Cache    *respcache.Cache
 }
 
 type PipelineEnqueuer interface {
@@ -49,8 +67,8 @@ type CreateCommentRequest struct {
 }
 
 // NewCommentsController constructs and returns a new instance.
-func NewCommentsController(database *db.DB, enqueuer PipelineEnqueuer) *CommentsController {
-	return &CommentsController{DB: database, Enqueuer: enqueuer}
+func NewCommentsController(database *db.DB, enqueuer PipelineEnqueuer, broker *events.Broker, hooks *webhooks.Dispatcher, cache *respcache.Cache) *CommentsController {
+	return &CommentsController{DB: database, Enqueuer: enqueuer, Events: broker, Webhooks: hooks, Limiter: ratelimit.New(), Cache: cache}
 }
 
 // POST /api/comments/:sitekey/
@@ -68,14 +86,13 @@ func (ct CommentsController) PostComment(c *gin.Context) {
 		return
 	}
 
-	// Apply CORS based on the site's allowed origins.
-	// If this returns false, the response is already handled (403 or 204).
-	if !cors.ApplyCORS(c, siteCfg.CORSAllowedOrigins) {
-		return
-	}
-
 	var req CreateCommentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "body_too_large"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   "invalid_json",
@@ -83,6 +100,11 @@ func (ct CommentsController) PostComment(c *gin.Context) {
 		return
 	}
 
+	// Rate limiting runs before the captcha check, so limited clients cause no captcha API calls.
+	if !ct.allowSubmission(c, siteKey, siteCfg.RateLimit, req.Email) {
+		return
+	}
+
 	// Captcha verification (per site config)
 	captchaToken := strings.TrimSpace(req.CaptchaToken)
 	if captchaToken == "" {
@@ -135,18 +157,31 @@ func (ct CommentsController) PostComment(c *gin.Context) {
 	}
 	if authorReport.Changed {
 		log.Printf(
-			"author sanitized (site=%s): removed_ctrl=%d removed_bad=%d",
+			"author sanitized (site=%s): removed_ctrl=%d removed_bad=%d removed_invisible=%d nfc=%t",
 			siteKey,
 			authorReport.RemovedControlChars,
 			authorReport.RemovedDisallowedChars,
+			authorReport.RemovedInvisibleChars,
+			authorReport.NormalizedNFC,
 		)
 	}
+	if len(authorReport.MixedScriptWords) > 0 {
+		log.Printf("author uses mixed scripts (site=%s): words=%q scripts=%v", siteKey, authorReport.MixedScriptWords, authorReport.Scripts)
+	}
 
 	req.AuthorUrl = strings.TrimSpace(req.AuthorUrl)
 
 	var urlReport sanitize.AuthorURLReport
-	req.AuthorUrl, urlReport, err = sanitize.SanitizeAuthorURL(req.AuthorUrl, 2048)
+	req.AuthorUrl, urlReport, err = sanitize.SanitizeAuthorURLWithPolicy(req.AuthorUrl, maxAuthorURLLen, sanitize.URLPolicyFromConfig(siteCfg.Sanitize.AuthorURL))
 	if err != nil {
+		if urlReport.RejectedBlockedDomain || urlReport.RejectedBlockedTLD || urlReport.RejectedNotAllowed {
+			log.Printf("author_url rejected by site policy (site=%s): %v", siteKey, err)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "author_url_not_allowed",
+			})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"error":   "invalid_author_url",
@@ -155,13 +190,36 @@ func (ct CommentsController) PostComment(c *gin.Context) {
 	}
 
 	if urlReport.Changed {
-		log.Printf("author_url sanitized (site=%s): trimmed=%t", siteKey, urlReport.Trimmed)
+		log.Printf("author_url sanitized (site=%s): trimmed=%t nfc=%t", siteKey, urlReport.Trimmed, urlReport.NormalizedNFC)
+	}
+	if urlReport.MixedScriptHost {
+		log.Printf("author_url host mixes scripts (site=%s): punycode=%t scripts=%v", siteKey, urlReport.PunycodeHost, urlReport.HostScripts)
 	}
 
 	// Validate email strictly (plain addr-spec only)
 	var emailReport sanitize.EmailReport
-	req.Email, emailReport, err = sanitize.SanitizeEmail(req.Email, 254)
+	req.Email, emailReport, err = sanitize.SanitizeEmailWithOptions(req.Email, maxEmailLen, siteEmailOptions(siteCfg))
+	if emailReport.DisposableListError != nil {
+		log.Printf("Disposable domain list not readable (site=%s): %v", siteKey, emailReport.DisposableListError)
+	}
+	if emailReport.MXLookupError != nil {
+		log.Printf("MX lookup failed, accepting email (site=%s): %v", siteKey, emailReport.MXLookupError)
+	}
 	if err != nil {
+		if emailReport.RejectedDisposable {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "disposable_email",
+			})
+			return
+		}
+		if emailReport.RejectedNoMX {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "email_domain_undeliverable",
+			})
+			return
+		}
 		if emailReport.RejectedEmpty {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"success": false,
@@ -179,6 +237,9 @@ func (ct CommentsController) PostComment(c *gin.Context) {
 	if emailReport.Changed {
 		log.Printf("email normalized (site=%s): trimmed=%t lower=%t", siteKey, emailReport.Trimmed, emailReport.Lowercased)
 	}
+	if emailReport.Disposable {
+		log.Printf("email uses a disposable domain (site=%s)", siteKey)
+	}
 
 	req.Body = strings.TrimSpace(req.Body)
 
@@ -197,26 +258,43 @@ func (ct CommentsController) PostComment(c *gin.Context) {
 	}
 
 	// Size limits (basic DoS protection)
-	if utf8.RuneCountInString(req.Author) > 80 {
+	if utf8.RuneCountInString(req.Author) > maxAuthorRunes {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "author_too_long"})
 		return
 	}
-	if len(req.PostPath) > 512 {
+	if len(req.PostPath) > maxPostPathLen {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "post_path_too_long"})
 		return
 	}
-	if len(req.EntryID) > 128 {
+	if len(req.EntryID) > maxEntryIDLen {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "entry_id_too_long"})
 		return
 	}
-	if len(req.Body) > 20000 {
+	if len(req.Body) > siteMaxBodyLen(siteCfg) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "body_too_long"})
 		return
 	}
 
-	// Generate comment ID (ULID)
-	entropy := ulid.Monotonic(rand.Reader, 0)
-	commentID := ulid.MustNew(ulid.Timestamp(time.Now()), entropy).String()
+	// Wordlist filter (optional): reject, or mask/hold and list the matches in the moderation mail.
+	wordAction, wordMatches := applyWordFilter(siteKey, siteCfg, &req.Author, &req.Body)
+	if wordAction != "" {
+		log.Printf("Word filter matched (site=%s action=%s): %v", siteKey, wordAction, wordMatches)
+	}
+	if wordAction == wordfilter.ActionReject {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "word_filter"})
+		return
+	}
+
+	// Generate comment ID (strategy from comment_ids, ULID by default)
+	commentID, err := commentid.New()
+	if err != nil {
+		log.Printf("Generate comment ID failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "id_generation_failed",
+		})
+		return
+	}
 
 	// Build nullable fields for DB
 	entryID := sql.NullString{Valid: false}
@@ -263,88 +341,163 @@ func (ct CommentsController) PostComment(c *gin.Context) {
 		}
 	}
 
-	err = ct.DB.InsertComment(context.Background(), db.Comment{
-		ID:        commentID,
-		SiteID:    siteID,
-		EntryID:   entryID,
-		PostPath:  req.PostPath,
-		ParentID:  parentID,
-		Status:    "pending",
-		Author:    req.Author,
+	// Blocklist (emails, domains, IPs). Matching submissions are dropped or rejected.
+	blockCtx, blockCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	blockEntries, err := ct.DB.ListBlocklist(blockCtx, []int64{siteID})
+	blockCancel()
+	if err != nil {
+		log.Printf("Load blocklist failed (site=%s): %v", siteKey, err)
+	} else if entry, blocked := blocklist.Match(blockEntries, blocklist.Submission{
 		Email:     req.Email,
-		AuthorUrl: authorUrl,
-		Body:      req.Body,
 		IP:        clientIP,
-		CreatedAt: time.Now().Unix(),
-	})
+		AuthorURL: req.AuthorUrl,
+	}); blocked {
+		log.Printf("Comment blocked (site=%s kind=%s entry_id=%d)", siteKey, entry.Kind, entry.ID)
+		if strings.EqualFold(strings.TrimSpace(siteCfg.Blocklist.Action), "reject") {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "blocked"})
+			return
+		}
+		// Drop silently: answer like an accepted comment, store nothing.
+		c.JSON(http.StatusCreated, decoyResponse(siteKey, siteID, siteCfg, commentID, time.Now(), true))
+		return
+	}
+
+	// Automatic spam classification (optional). Failures fall back to normal moderation.
+	status := "pending"
+	decidedVia := ""
+	spamCtx, spamCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	spamInput := antispam.Comment{
+		UserIP:      clientIP,
+		UserAgent:   c.GetHeader("User-Agent"),
+		Referrer:    c.GetHeader("Referer"),
+		Permalink:   c.GetHeader("Referer"),
+		Author:      req.Author,
+		AuthorEmail: req.Email,
+		AuthorURL:   req.AuthorUrl,
+		Body:        req.Body,
+	}
+	if antispam.HeuristicsEnabled(siteCfg.Antispam) {
+		since := time.Now().Add(-24 * time.Hour).Unix()
+		spamInput.RecentSameIP, spamInput.RecentSameBody, err = ct.DB.CountRecentSubmissions(spamCtx, siteID, since, clientIP, req.Body)
+		if err != nil {
+			log.Printf("Count recent submissions failed (site=%s): %v", siteKey, err)
+		}
+		spamInput.RuleFeedback = ct.ruleFeedback(spamCtx, siteKey, siteID)
+	}
+	spamResult, err := antispam.Check(spamCtx, siteCfg.Antispam, spamInput)
+	spamCancel()
+	if err != nil {
+		log.Printf("Spam check failed for site %s (continuing with moderation): %v", siteKey, err)
+	} else if spamResult.Spam {
+		status = "spam"
+		decidedVia = spamResult.Reason
+		log.Printf("Comment %s classified as spam (site=%s reason=%s score=%d rules=%v)", commentID, siteKey, spamResult.Reason, spamResult.Score, spamResult.Rules)
+	}
+	if status == "pending" && siteCfg.DoubleOptIn.Enabled {
+		status = db.CommentStatusUnconfirmed
+	}
+
+	createdAt := time.Now().Unix()
+	cm := db.Comment{
+		ID:          commentID,
+		SiteID:      siteID,
+		EntryID:     entryID,
+		PostPath:    req.PostPath,
+		ParentID:    parentID,
+		Status:      status,
+		SpamScore:   spamResult.Score,
+		SpamRules:   strings.Join(spamResult.Rules, ","),
+		WordMatches: strings.Join(wordMatches, ","),
+		DecidedVia:  decidedVia,
+		Author:      req.Author,
+		Email:       req.Email,
+		AuthorUrl:   authorUrl,
+		Body:        req.Body,
+		IP:          clientIP,
+		CreatedAt:   createdAt,
+	}
+	// The notification mail is queued together with the comment, so it is sent
+	// eventually even if the process stops right after the insert.
+	var mail db.OutboxMail
+	switch status {
+	case "spam":
+		err = ct.DB.InsertComment(context.Background(), cm)
+	case db.CommentStatusUnconfirmed:
+		mail, err = ct.DB.InsertCommentWithMail(context.Background(), cm, db.MailConfirmation, baseURLFromRequest(c))
+	default:
+		mail, err = ct.DB.InsertCommentWithMail(context.Background(), cm, db.MailModeration, baseURLFromRequest(c))
+	}
 	if err != nil {
 		log.Printf("DB insert failed for comment %s: %v", commentID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_insert_failed"})
 		return
 	}
 
-	// Build signed approve/reject tokens (HMAC) with expiry
-	exp := time.Now().Add(72 * time.Hour).Unix()
-	base := baseURLFromRequest(c)
-
-	approvePayload := fmt.Sprintf("%s|%s|approve|%d", siteKey, commentID, exp)
-	rejectPayload := fmt.Sprintf("%s|%s|reject|%d", siteKey, commentID, exp)
+	created := events.Comment{
+		ID:        commentID,
+		EntryID:   req.EntryID,
+		PostPath:  req.PostPath,
+		ParentID:  req.ParentID,
+		Author:    req.Author,
+		AuthorURL: req.AuthorUrl,
+		Body:      req.Body,
+		CreatedAt: createdAt,
+	}
 
-	approveToken := signToken(approvePayload, siteCfg.TokenSecret)
-	rejectToken := signToken(rejectPayload, siteCfg.TokenSecret)
+	if status == "spam" {
+		// No moderation mail for spam. The response does not reveal the classification.
+		ct.Webhooks.Fire(c.Request.Context(), siteKey, webhooks.EventCommentSpam, created)
+		c.JSON(http.StatusCreated, decoyResponse(siteKey, siteID, siteCfg, commentID, time.Unix(createdAt, 0), false))
+		return
+	}
 
-	approveLink := fmt.Sprintf("%s/api/comments/%s/decision?token=%s", base, siteKey, approveToken)
-	rejectLink := fmt.Sprintf("%s/api/comments/%s/decision?token=%s", base, siteKey, rejectToken)
+	if status == db.CommentStatusUnconfirmed {
+		// Double opt-in: moderation mail and webhook follow after the confirmation.
+		sent := deliverOutboxMail(c.Request.Context(), ct.DB, mail)
+		c.JSON(http.StatusCreated, addEditToken(gin.H{
+			"success":           true,
+			"site_id":           siteID,
+			"site_key":          siteKey,
+			"id":                commentID,
+			"status":            db.CommentStatusUnconfirmed,
+			"confirmation_sent": sent,
+		}, siteKey, siteCfg, commentID, time.Unix(createdAt, 0)))
+		return
+	}
 
-	// Send admin email (do not fail the request if mail fails)
-	subject, body, _ := generator.BuildModerationMail(generator.ModerationMailInput{
-		SiteID:     siteKey,
-		PostPath:   req.PostPath,
-		EntryID:    req.EntryID,
-		ParentID:   req.ParentID,
-		CommentID:  commentID,
-		Author:     req.Author,
-		Email:      req.Email,
-		AuthorUrl:  req.AuthorUrl,
-		ClientIP:   clientIP,
-		Body:       req.Body,
-		CreatedAt:  time.Now(),
-		ApproveURL: approveLink,
-		RejectURL:  rejectLink,
-	})
+	ct.Webhooks.Fire(c.Request.Context(), siteKey, webhooks.EventCommentCreated, created)
 
-	mailSent := true
-	if err := mailer.SendTextMail(siteCfg.AdminRecipients, subject, body); err != nil {
-		mailSent = false
-		log.Printf("Failed to send admin mail for comment %s: %v", commentID, err)
-	}
+	mailSent := deliverOutboxMail(c.Request.Context(), ct.DB, mail)
 
-	c.JSON(http.StatusCreated, gin.H{
+	c.JSON(http.StatusCreated, addEditToken(gin.H{
 		"success":   true,
 		"site_id":   siteID,
 		"site_key":  siteKey,
 		"id":        commentID,
 		"status":    "pending",
 		"mail_sent": mailSent,
-	})
+	}, siteKey, siteCfg, commentID, time.Unix(createdAt, 0)))
 }
 
-// OPTIONS /api/comments/:sitekey/
-func (ct CommentsController) OptionsComment(c *gin.Context) {
-	siteKey := c.Param("sitekey")
-
-	siteCfg, ok := config.Cfg.CommentSites[siteKey]
-	if !ok {
-		c.Status(http.StatusNotFound)
-		return
-	}
-
-	// Apply CORS for this site and finish preflight
-	if !cors.ApplyCORS(c, siteCfg.CORSAllowedOrigins) {
-		return
-	}
-
-	c.Status(http.StatusNoContent)
+// decoyResponse answers a submission that was classified as spam or dropped by the
+// blocklist like an accepted one, so the response does not reveal the classification.
+// With double opt-in, accepted comments wait for their confirmation, so the decoy
+// claims a confirmation mail was sent; otherwise mailSent is reported.
+func decoyResponse(siteKey string, siteID int64, siteCfg config.CommentsSiteConfig, commentID string, createdAt time.Time, mailSent bool) gin.H {
+	resp := gin.H{
+		"success":  true,
+		"site_id":  siteID,
+		"site_key": siteKey,
+		"id":       commentID,
+	}
+	if siteCfg.DoubleOptIn.Enabled {
+		resp["status"] = db.CommentStatusUnconfirmed
+		resp["confirmation_sent"] = true
+	} else {
+		resp["status"] = "pending"
+		resp["mail_sent"] = mailSent
+	}
+	return addEditToken(resp, siteKey, siteCfg, commentID, createdAt)
 }
 
 // signToken performs its package-specific operation.
@@ -358,7 +511,43 @@ func signToken(payload, secret string) string {
 	return p + "." + s
 }
 
-// baseURLFromRequest performs its package-specific operation.
+// verifyToken checks a token created by signToken and returns the payload fields
+// (site_key|comment_id|action|exp_unix). On failure it returns the HTTP status and
+// message for the response.
+func verifyToken(token, secret string) ([]string, int, string) {
+	// token format: base64url(payload) + "." + base64url(signature)
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, http.StatusBadRequest, "invalid token format"
+	}
+
+	payloadB, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, http.StatusBadRequest, "invalid token payload encoding"
+	}
+	sigB, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, http.StatusBadRequest, "invalid token signature encoding"
+	}
+
+	payload := string(payloadB)
+
+	// Verify signature (constant-time)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	expectedSig := mac.Sum(nil)
+	if !hmac.Equal(sigB, expectedSig) {
+		return nil, http.StatusForbidden, "invalid token signature"
+	}
+
+	fields := strings.Split(payload, "|")
+	if len(fields) != 4 {
+		return nil, http.StatusBadRequest, "invalid token payload"
+	}
+	return fields, http.StatusOK, ""
+}
+
+// baseURLFromRequest returns the external URL of the API, including the base path.
 func baseURLFromRequest(c *gin.Context) string {
 	// Prefer reverse proxy headers if present.
 	proto := c.GetHeader("X-Forwarded-Proto")
@@ -366,7 +555,7 @@ func baseURLFromRequest(c *gin.Context) string {
 		proto = "http"
 	}
 	host := c.Request.Host
-	return proto + "://" + host
+	return proto + "://" + host + config.Cfg.Server.BasePath
 }
 
 // resolveClientIP performs its package-specific operation.
@@ -470,39 +659,9 @@ func (ct CommentsController) GetDecision(c *gin.Context) {
 		return
 	}
 
-	// token format: base64url(payload) + "." + base64url(signature)
-	parts := strings.Split(token, ".")
-	if len(parts) != 2 {
-		c.String(http.StatusBadRequest, "invalid token format")
-		return
-	}
-
-	payloadB, err := base64.RawURLEncoding.DecodeString(parts[0])
-	if err != nil {
-		c.String(http.StatusBadRequest, "invalid token payload encoding")
-		return
-	}
-	sigB, err := base64.RawURLEncoding.DecodeString(parts[1])
-	if err != nil {
-		c.String(http.StatusBadRequest, "invalid token signature encoding")
-		return
-	}
-
-	payload := string(payloadB)
-
-	// Verify signature (constant-time)
-	mac := hmac.New(sha256.New, []byte(siteCfg.TokenSecret))
-	mac.Write([]byte(payload))
-	expectedSig := mac.Sum(nil)
-	if !hmac.Equal(sigB, expectedSig) {
-		c.String(http.StatusForbidden, "invalid token signature")
-		return
-	}
-
-	// payload format: site_key|comment_id|action|exp_unix
-	fields := strings.Split(payload, "|")
-	if len(fields) != 4 {
-		c.String(http.StatusBadRequest, "invalid token payload")
+	fields, status, msg := verifyToken(token, siteCfg.TokenSecret)
+	if status != http.StatusOK {
+		c.String(status, msg)
 		return
 	}
 
@@ -541,9 +700,10 @@ func (ct CommentsController) GetDecision(c *gin.Context) {
 		return
 	}
 
+	linkDecision := db.Decision{By: db.DecidedByEmailToken, Via: db.DecidedViaDecisionLink}
 	switch action {
 	case "approve":
-		changed, err := ct.DB.ApproveComment(ctx, siteID, commentID)
+		changed, err := ct.DB.ApproveComment(ctx, siteID, commentID, linkDecision)
 		if err != nil {
 			log.Printf("approve failed (site=%s id=%s): %v", siteKey, commentID, err)
 			c.String(http.StatusInternalServerError, "db update failed")
@@ -554,6 +714,9 @@ func (ct CommentsController) GetDecision(c *gin.Context) {
 			return
 		}
 
+		invalidateCache(ctx, ct.Cache, siteID)
+		notifyModeration(ctx, ct.DB, ct.Events, ct.Webhooks, siteKey, siteID, commentID, "approved")
+
 		if ct.Enqueuer == nil {
 			c.String(http.StatusOK, "approved (pipeline not configured)")
 			return
@@ -577,7 +740,7 @@ func (ct CommentsController) GetDecision(c *gin.Context) {
 		return
 
 	case "reject":
-		changed, err := ct.DB.RejectComment(ctx, siteID, commentID)
+		changed, err := ct.DB.RejectComment(ctx, siteID, commentID, linkDecision)
 		if err != nil {
 			log.Printf("reject failed (site=%s id=%s): %v", siteKey, commentID, err)
 			c.String(http.StatusInternalServerError, "db update failed")
@@ -587,6 +750,8 @@ func (ct CommentsController) GetDecision(c *gin.Context) {
 			c.String(http.StatusOK, "nothing to reject (already decided or not found)")
 			return
 		}
+		invalidateCache(ctx, ct.Cache, siteID)
+		notifyModeration(ctx, ct.DB, ct.Events, ct.Webhooks, siteKey, siteID, commentID, "rejected")
 		c.String(http.StatusOK, "rejected")
 		return
 
@@ -596,3 +761,32 @@ func (ct CommentsController) GetDecision(c *gin.Context) {
 	}
 
 }
+
+// allowSubmission applies the site's rate limits per client IP and per email address.
+// It writes a 429 response with Retry-After and returns false if a limit is exceeded.
+func (ct CommentsController) allowSubmission(c *gin.Context, siteKey string, cfg config.RateLimitConfig, email string) bool {
+	window := time.Duration(cfg.WindowSeconds) * time.Second
+	if window <= 0 {
+		window = time.Hour
+	}
+
+	// Forwarding headers only count from trusted proxies, so clients cannot pick a fresh bucket.
+	clientIP := resolveClientIP(c, config.Cfg.Server.TrustedProxies)
+	ok, wait := ct.Limiter.Allow(siteKey+"|ip|"+clientIP, cfg.PerIP, window)
+	if email = strings.ToLower(strings.TrimSpace(email)); ok && email != "" {
+		ok, wait = ct.Limiter.Allow(siteKey+"|email|"+email, cfg.PerEmail, window)
+	}
+	if ok {
+		return true
+	}
+
+	retryAfter := int64((wait + time.Second - 1) / time.Second)
+	log.Printf("Rate limit exceeded (site=%s ip=%s): retry after %ds", siteKey, clientIP, retryAfter)
+	c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"success":     false,
+		"error":       "rate_limited",
+		"retry_after": retryAfter,
+	})
+	return false
+}
@@ -9,8 +9,10 @@ import (
 	"time"
 
 	"github.com/geschke/fyndmark/config"
-	"github.com/geschke/fyndmark/pkg/cors"
 	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/events"
+	"github.com/geschke/fyndmark/pkg/respcache"
+	"github.com/geschke/fyndmark/pkg/webhooks"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
 )
@@ -20,6 +22,9 @@ type CommentsAdminController struct {
 	Store       sessions.Store
 	SessionName string
 	Enqueuer    PipelineEnqueuer
+	Events      *events.Broker
+	Webhooks    *webhooks.Dispatcher
+	Cache       *respcache.Cache
 }
 
 type commentModerationItem struct {
@@ -40,105 +45,30 @@ type commentModerationResult struct {
 }
 
 // NewCommentsAdminController constructs and returns a new instance.
-func NewCommentsAdminController(database *db.DB, store sessions.Store, sessionName string, enqueuer PipelineEnqueuer) *CommentsAdminController {
+func NewCommentsAdminController(database *db.DB, store sessions.Store, sessionName string, enqueuer PipelineEnqueuer, broker *events.Broker, hooks *webhooks.Dispatcher, cache *respcache.Cache) *CommentsAdminController {
 	return &CommentsAdminController{
 		DB:          database,
 		Store:       store,
 		SessionName: sessionName,
 		Enqueuer:    enqueuer,
+		Events:      broker,
+		Webhooks:    hooks,
+		Cache:       cache,
 	}
 }
 
-// Options handles the CORS preflight request.
-func (ct CommentsAdminController) Options(c *gin.Context) {
-	_ = cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins)
-}
-
-// ensureAuthorized performs its package-specific operation.
-func (ct CommentsAdminController) ensureAuthorized(c *gin.Context) bool {
-	if ct.DB == nil || ct.DB.SQL == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_NOT_INITIALIZED"})
-		return false
-	}
-	if ct.Store == nil || strings.TrimSpace(ct.SessionName) == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "AUTH_NOT_CONFIGURED"})
-		return false
-	}
-	sess, _ := ct.Store.Get(c.Request, ct.SessionName)
-	if sess == nil || sess.IsNew {
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
-		return false
-	}
-	if _, ok := sess.Values["id"]; !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
-		return false
-	}
-	return true
-}
-
-// currentSessionUserID performs its package-specific operation.
+// currentSessionUserID returns the authenticated user, see currentUserID.
 func (ct CommentsAdminController) currentSessionUserID(c *gin.Context) (int64, bool) {
-	sess, _ := ct.Store.Get(c.Request, ct.SessionName)
-	if sess == nil {
-		return 0, false
-	}
-	raw, ok := sess.Values["id"]
-	if !ok {
-		return 0, false
-	}
-	id, ok := raw.(int64)
-	if !ok {
-		return 0, false
-	}
-	return id, true
+	return currentUserID(c, ct.Store, ct.SessionName)
 }
 
-// GET /api/comments/list?site_id=<id>&status=pending|approved|rejected|spam|deleted|all&q=<text>&limit=..&offset=..
+// GET /api/comments/list?site_id=<id>&status=pending|approved|rejected|spam|deleted|all&q=<text>&since=..&until=..&limit=..&offset=..
 func (ct CommentsAdminController) GetList(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-	if !ct.ensureAuthorized(c) {
-		return
-	}
-
-	siteID := int64(0)
-	if v := strings.TrimSpace(c.Query("site_id")); v != "" {
-		n, err := strconv.ParseInt(v, 10, 64)
-		if err != nil || n <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
-			return
-		}
-		siteID = n
-	}
-	status := strings.ToLower(strings.TrimSpace(c.DefaultQuery("status", "pending")))
-	switch status {
-	case "pending", "approved", "rejected", "spam", "deleted", "all":
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_STATUS"})
+	filter, ok := parseCommentListFilter(c, 10, 100)
+	if !ok {
 		return
 	}
-
-	limit := 10
-	if v := strings.TrimSpace(c.Query("limit")); v != "" {
-		n, err := strconv.Atoi(v)
-		if err != nil || n < 0 || n > 100 {
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_LIMIT"})
-			return
-		}
-		limit = n
-	}
-
-	offset := 0
-	if v := strings.TrimSpace(c.Query("offset")); v != "" {
-		n, err := strconv.Atoi(v)
-		if err != nil || n < 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_OFFSET"})
-			return
-		}
-		offset = n
-	}
-	searchQuery := strings.TrimSpace(c.Query("q"))
+	siteID := filter.SiteID
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -173,14 +103,7 @@ func (ct CommentsAdminController) GetList(c *gin.Context) {
 		}
 	}
 
-	filter := db.CommentListFilter{
-		SiteID:         siteID,
-		AllowedSiteIDs: allowedSiteIDs,
-		Status:         status,
-		Query:          searchQuery,
-		Limit:          limit,
-		Offset:         offset,
-	}
+	filter.AllowedSiteIDs = allowedSiteIDs
 
 	total, err := ct.DB.CountComments(ctx, filter)
 	if err != nil {
@@ -225,12 +148,6 @@ func (ct CommentsAdminController) PostDelete(c *gin.Context) {
 
 // postModerateBatch performs its package-specific operation.
 func (ct CommentsAdminController) postModerateBatch(c *gin.Context, action string) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-	if !ct.ensureAuthorized(c) {
-		return
-	}
 	switch action {
 	case "approve", "reject", "spam", "delete":
 	default:
@@ -292,8 +209,10 @@ func (ct CommentsAdminController) postModerateBatch(c *gin.Context, action strin
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
+	by := db.AdminDecision(userID)
 	results := make([]commentModerationResult, 0, len(items))
 	approvedChangedSites := make(map[int64]struct{})
+	var spamDecisions []spamDecision
 	for _, item := range items {
 		res := commentModerationResult{
 			SiteID:    item.SiteID,
@@ -307,9 +226,18 @@ func (ct CommentsAdminController) postModerateBatch(c *gin.Context, action strin
 			continue
 		}
 
+		// The previous status decides whether the action is spam feedback.
+		var decision spamDecision
+		hasDecision := false
+		if action == "approve" || action == "spam" {
+			if prev, found, err := ct.DB.GetComment(ctx, item.SiteID, item.CommentID); err == nil && found {
+				decision, hasDecision = spamDecisionFor(action, prev)
+			}
+		}
+
 		switch action {
 		case "approve":
-			changed, err := ct.DB.ApproveComment(ctx, item.SiteID, item.CommentID)
+			changed, err := ct.DB.ApproveComment(ctx, item.SiteID, item.CommentID, by)
 			if err != nil {
 				res.Status = "error"
 				res.Error = "DB_ERROR"
@@ -320,10 +248,13 @@ func (ct CommentsAdminController) postModerateBatch(c *gin.Context, action strin
 			res.Status = "approved"
 			if changed {
 				approvedChangedSites[item.SiteID] = struct{}{}
+				if hasDecision {
+					spamDecisions = append(spamDecisions, decision)
+				}
 			}
 			results = append(results, res)
 		case "reject":
-			changed, err := ct.DB.RejectComment(ctx, item.SiteID, item.CommentID)
+			changed, err := ct.DB.RejectComment(ctx, item.SiteID, item.CommentID, by)
 			if err != nil {
 				res.Status = "error"
 				res.Error = "DB_ERROR"
@@ -334,7 +265,7 @@ func (ct CommentsAdminController) postModerateBatch(c *gin.Context, action strin
 			res.Status = "rejected"
 			results = append(results, res)
 		case "spam":
-			changed, err := ct.DB.SpamComment(ctx, item.SiteID, item.CommentID)
+			changed, err := ct.DB.SpamComment(ctx, item.SiteID, item.CommentID, by)
 			if err != nil {
 				res.Status = "error"
 				res.Error = "DB_ERROR"
@@ -343,9 +274,12 @@ func (ct CommentsAdminController) postModerateBatch(c *gin.Context, action strin
 			}
 			res.Changed = changed
 			res.Status = "spam"
+			if changed && hasDecision {
+				spamDecisions = append(spamDecisions, decision)
+			}
 			results = append(results, res)
 		case "delete":
-			changed, err := ct.DB.DeleteComment(ctx, item.SiteID, item.CommentID)
+			changed, err := ct.DB.DeleteComment(ctx, item.SiteID, item.CommentID, by)
 			if err != nil {
 				res.Status = "error"
 				res.Error = "DB_ERROR"
@@ -358,28 +292,38 @@ func (ct CommentsAdminController) postModerateBatch(c *gin.Context, action strin
 		}
 	}
 
+	// Drop cached public responses and notify stream subscribers and webhooks about changed comments.
+	invalidated := make(map[int64]bool)
+	siteKeys := make(map[int64]string)
+	for _, res := range results {
+		if res.Changed && !invalidated[res.SiteID] {
+			invalidateCache(ctx, ct.Cache, res.SiteID)
+			invalidated[res.SiteID] = true
+		}
+		if !res.Changed || res.Status == "deleted" {
+			continue
+		}
+		siteKey, known := siteKeys[res.SiteID]
+		if !known {
+			site, found, err := ct.DB.GetSiteByID(ctx, res.SiteID)
+			if err == nil && found {
+				siteKey = site.SiteKey
+			}
+			siteKeys[res.SiteID] = siteKey
+		}
+		notifyModeration(ctx, ct.DB, ct.Events, ct.Webhooks, siteKey, res.SiteID, res.CommentID, res.Status)
+	}
+	for _, d := range spamDecisions {
+		reportSpamDecision(ct.DB, siteKeys[d.Comment.SiteID], d)
+	}
+
 	batchRunIDs := map[string]int64{}
 	warnings := map[string]string{}
 	if action == "approve" && ct.Enqueuer != nil {
 		for siteID := range approvedChangedSites {
 			key := strconv.FormatInt(siteID, 10)
-			site, found, err := ct.DB.GetSiteByID(ctx, siteID)
-			if err != nil || !found {
-				warnings[key] = "pipeline_enqueue_failed"
-				continue
-			}
-			if _, ok := config.Cfg.CommentSites[site.SiteKey]; !ok {
-				warnings[key] = "pipeline_enqueue_failed"
-				continue
-			}
-
-			runID, err := ct.DB.CreateRun(siteID, "")
-			if err != nil {
-				warnings[key] = "pipeline_enqueue_failed"
-				continue
-			}
-			if err := ct.Enqueuer.EnqueueRun(runID, site.SiteKey, ""); err != nil {
-				_ = ct.DB.MarkRunFailed(runID, "enqueue", err.Error())
+			runID, ok := ct.enqueueSiteRun(ctx, siteID)
+			if !ok {
 				warnings[key] = "pipeline_enqueue_failed"
 				continue
 			}
@@ -395,3 +339,117 @@ func (ct CommentsAdminController) postModerateBatch(c *gin.Context, action strin
 		"warnings":      warnings,
 	})
 }
+
+// enqueueSiteRun creates and enqueues a pipeline run regenerating a site's content.
+func (ct CommentsAdminController) enqueueSiteRun(ctx context.Context, siteID int64) (int64, bool) {
+	if ct.Enqueuer == nil {
+		return 0, false
+	}
+	site, found, err := ct.DB.GetSiteByID(ctx, siteID)
+	if err != nil || !found {
+		return 0, false
+	}
+	if _, ok := config.Cfg.CommentSites[site.SiteKey]; !ok {
+		return 0, false
+	}
+
+	runID, err := ct.DB.CreateRun(siteID, "")
+	if err != nil {
+		return 0, false
+	}
+	if err := ct.Enqueuer.EnqueueRun(runID, site.SiteKey, ""); err != nil {
+		_ = ct.DB.MarkRunFailed(runID, "enqueue", err.Error())
+		return 0, false
+	}
+	return runID, true
+}
+
+// parseCommentListFilter reads the filter query parameters shared by the comment list
+// and export endpoints (site_id, status, q, since, until, limit, offset). It writes the
+// error response itself and returns false on invalid input. A maxLimit of 0 means no cap.
+func parseCommentListFilter(c *gin.Context, defaultLimit, maxLimit int) (db.CommentListFilter, bool) {
+	siteID := int64(0)
+	if v := strings.TrimSpace(c.Query("site_id")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+			return db.CommentListFilter{}, false
+		}
+		siteID = n
+	}
+	status := strings.ToLower(strings.TrimSpace(c.DefaultQuery("status", "pending")))
+	switch status {
+	case "pending", "approved", "rejected", "spam", "deleted", "unconfirmed", "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_STATUS"})
+		return db.CommentListFilter{}, false
+	}
+
+	limit := defaultLimit
+	if v := strings.TrimSpace(c.Query("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || (maxLimit > 0 && n > maxLimit) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_LIMIT"})
+			return db.CommentListFilter{}, false
+		}
+		limit = n
+	}
+
+	offset := 0
+	if v := strings.TrimSpace(c.Query("offset")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_OFFSET"})
+			return db.CommentListFilter{}, false
+		}
+		offset = n
+	}
+	searchQuery := strings.TrimSpace(c.Query("q"))
+
+	since, ok := parseTimeParam(c.Query("since"), false)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SINCE"})
+		return db.CommentListFilter{}, false
+	}
+	until, ok := parseTimeParam(c.Query("until"), true)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_UNTIL"})
+		return db.CommentListFilter{}, false
+	}
+	if since > 0 && until > 0 && since > until {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_RANGE"})
+		return db.CommentListFilter{}, false
+	}
+
+	return db.CommentListFilter{
+		SiteID: siteID,
+		Status: status,
+		Query:  searchQuery,
+		Since:  since,
+		Until:  until,
+		Limit:  limit,
+		Offset: offset,
+	}, true
+}
+
+// parseTimeParam parses unix seconds, RFC 3339 or a date (YYYY-MM-DD, UTC).
+// For endOfDay, a date means the end of that day. Empty values return 0.
+func parseTimeParam(v string, endOfDay bool) (int64, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, true
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n, n >= 0
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Unix(), true
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		if endOfDay {
+			return t.Add(24*time.Hour - time.Second).Unix(), true
+		}
+		return t.Unix(), true
+	}
+	return 0, false
+}
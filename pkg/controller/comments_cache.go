@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/geschke/fyndmark/pkg/respcache"
+)
+
+// loadCached decodes a cached value into v. Cache errors are logged and treated as a miss.
+func loadCached(ctx context.Context, cache *respcache.Cache, key string, v any) bool {
+	if cache == nil || key == "" {
+		return false
+	}
+	raw, ok, err := cache.Get(ctx, key)
+	if err != nil {
+		log.Printf("Response cache read failed: %v", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(raw, v) == nil
+}
+
+// storeCached stores v under key. Errors are logged only.
+func storeCached(ctx context.Context, cache *respcache.Cache, key string, v any) {
+	if cache == nil || key == "" {
+		return
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if err := cache.Set(ctx, key, raw); err != nil {
+		log.Printf("Response cache write failed: %v", err)
+	}
+}
+
+// cacheKey returns the cache key of a public read request, or "" if caching is
+// disabled or the generation could not be read.
+func cacheKey(ctx context.Context, cache *respcache.Cache, siteID int64, parts ...string) string {
+	if cache == nil {
+		return ""
+	}
+	key, err := cache.Key(ctx, siteID, parts...)
+	if err != nil {
+		log.Printf("Response cache read failed (site_id=%d): %v", siteID, err)
+		return ""
+	}
+	return key
+}
+
+// invalidateCache drops the cached public responses of a site after a moderation change.
+func invalidateCache(ctx context.Context, cache *respcache.Cache, siteID int64) {
+	if err := cache.Invalidate(ctx, siteID); err != nil {
+		log.Printf("Response cache invalidation failed (site_id=%d): %v", siteID, err)
+	}
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/gin-gonic/gin"
+)
+
+// siteConfigMaxAge is the client cache lifetime of the site config (in seconds).
+const siteConfigMaxAge = 300
+
+// GET /api/comments/:sitekey/config
+//
+// Returns the non-secret settings a frontend needs to render the comment form.
+func (ct CommentsController) GetConfig(c *gin.Context) {
+	siteKey := c.Param("sitekey")
+
+	siteCfg, ok := config.Cfg.CommentSites[siteKey]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return
+	}
+
+	if !checkEmbedToken(c, siteKey, siteCfg) {
+		return
+	}
+
+	if ct.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_not_initialized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, found, err := ct.DB.GetSiteIDByKey(ctx, siteKey)
+	if err != nil {
+		log.Printf("Resolve site key failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return
+	}
+
+	captchaInfo := gin.H{"enabled": false}
+	if cc := siteCfg.Captcha; cc != nil && cc.Enabled {
+		captchaInfo = publicCaptchaInfo(siteKey, *cc)
+		captchaInfo["enabled"] = true
+
+		fallbacks := make([]gin.H, 0, len(cc.Fallbacks))
+		for _, fb := range cc.Fallbacks {
+			fallbacks = append(fallbacks, publicCaptchaInfo(siteKey, fb))
+		}
+		captchaInfo["fallbacks"] = fallbacks
+	}
+
+	rl := siteCfg.RateLimit
+	window := rl.WindowSeconds
+	if window <= 0 {
+		window = 3600
+	}
+
+	body, err := json.Marshal(gin.H{
+		"success":  true,
+		"site_key": siteKey,
+		"title":    siteCfg.Title,
+		// Replies must reference an approved comment of the same post; nesting is not limited.
+		"replies": gin.H{
+			"allowed":   true,
+			"max_depth": 0,
+		},
+		"fields": gin.H{
+			"author":     "required",
+			"email":      "required",
+			"author_url": "optional",
+		},
+		"limits": gin.H{
+			"author_max_chars":      maxAuthorRunes,
+			"email_max_length":      maxEmailLen,
+			"author_url_max_length": maxAuthorURLLen,
+			"body_max_length":       maxBodyLen,
+		},
+		"captcha": captchaInfo,
+		"rate_limit": gin.H{
+			"per_ip":         rl.PerIP,
+			"per_email":      rl.PerEmail,
+			"window_seconds": window,
+		},
+		"moderation": true,
+		"double_opt_in": gin.H{
+			"enabled":   siteCfg.DoubleOptIn.Enabled,
+			"ttl_hours": int(doubleOptInTTL(siteCfg.DoubleOptIn) / time.Hour),
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "internal_error"})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	cacheScope := "public"
+	if siteCfg.Embed.RequireToken {
+		cacheScope = "private"
+	}
+	c.Header("Cache-Control", cacheScope+", max-age="+strconv.Itoa(siteConfigMaxAge))
+	c.Header("ETag", etag)
+	if match := c.GetHeader("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// publicCaptchaInfo returns the non-secret settings of one captcha provider.
+func publicCaptchaInfo(siteKey string, cc config.CaptchaConfig) gin.H {
+	info := gin.H{
+		"provider": strings.ToLower(strings.TrimSpace(cc.Provider)),
+		"site_key": strings.TrimSpace(cc.SiteKey),
+	}
+	if strings.EqualFold(strings.TrimSpace(cc.Provider), "builtin") {
+		info["challenge_url"] = config.Cfg.Server.BasePath + "/api/captcha/" + siteKey + "/new"
+	}
+	return info
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/generator"
+	"github.com/geschke/fyndmark/pkg/mailer"
+	"github.com/geschke/fyndmark/pkg/sanitize"
+	"github.com/geschke/fyndmark/pkg/webhooks"
+	"github.com/geschke/fyndmark/pkg/wordfilter"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultDoubleOptInTTL is used when double_opt_in.ttl_hours is not set.
+const defaultDoubleOptInTTL = 48 * time.Hour
+
+// doubleOptInTTL returns how long a comment can be confirmed.
+func doubleOptInTTL(cfg config.DoubleOptInConfig) time.Duration {
+	if cfg.TTLHours > 0 {
+		return time.Duration(cfg.TTLHours) * time.Hour
+	}
+	return defaultDoubleOptInTTL
+}
+
+// GET /api/comments/:sitekey/confirm?token=...
+func (ct CommentsController) GetConfirm(c *gin.Context) {
+	siteKey := c.Param("sitekey")
+
+	siteCfg, ok := config.Cfg.CommentSites[siteKey]
+	if !ok {
+		c.String(http.StatusNotFound, "unknown site")
+		return
+	}
+
+	token := strings.TrimSpace(c.Query("token"))
+	if token == "" {
+		c.String(http.StatusBadRequest, "missing token")
+		return
+	}
+
+	if ct.DB == nil || ct.DB.SQL == nil {
+		c.String(http.StatusInternalServerError, "db not initialized")
+		return
+	}
+
+	fields, status, msg := verifyToken(token, siteCfg.TokenSecret)
+	if status != http.StatusOK {
+		c.String(status, msg)
+		return
+	}
+	if fields[0] != siteKey {
+		c.String(http.StatusForbidden, "site mismatch")
+		return
+	}
+	if fields[2] != "confirm" {
+		c.String(http.StatusBadRequest, "invalid action")
+		return
+	}
+	commentID := fields[1]
+
+	exp, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid token expiry")
+		return
+	}
+	now := time.Now()
+	if now.Unix() > exp {
+		c.String(http.StatusForbidden, "token expired")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	siteID, found, err := ct.DB.GetSiteIDByKey(ctx, siteKey)
+	if err != nil {
+		log.Printf("resolve site key failed (site=%s): %v", siteKey, err)
+		c.String(http.StatusInternalServerError, "db query failed")
+		return
+	}
+	if !found {
+		c.String(http.StatusNotFound, "unknown site")
+		return
+	}
+
+	notBefore := now.Add(-doubleOptInTTL(siteCfg.DoubleOptIn)).Unix()
+	mail, changed, err := ct.DB.ConfirmCommentWithMail(ctx, siteID, commentID, notBefore, baseURLFromRequest(c))
+	if err != nil {
+		log.Printf("confirm failed (site=%s id=%s): %v", siteKey, commentID, err)
+		c.String(http.StatusInternalServerError, "db update failed")
+		return
+	}
+	if !changed {
+		c.String(http.StatusOK, "nothing to confirm (already confirmed or expired)")
+		return
+	}
+
+	cm, found, err := ct.DB.GetComment(ctx, siteID, commentID)
+	if err != nil || !found {
+		log.Printf("load confirmed comment failed (site=%s id=%s): %v", siteKey, commentID, err)
+		c.String(http.StatusOK, "confirmed")
+		return
+	}
+
+	ct.Webhooks.Fire(ctx, siteKey, webhooks.EventCommentCreated, publicComment(cm))
+	deliverOutboxMail(ctx, ct.DB, mail)
+
+	c.String(http.StatusOK, "confirmed, your comment is now awaiting moderation")
+}
+
+// sendConfirmationMail sends the double opt-in link to the commenter.
+func sendConfirmationMail(base, siteKey string, siteCfg config.CommentsSiteConfig, cm db.Comment) error {
+	exp := time.Unix(cm.CreatedAt, 0).Add(doubleOptInTTL(siteCfg.DoubleOptIn))
+	payload := fmt.Sprintf("%s|%s|confirm|%d", siteKey, cm.ID, exp.Unix())
+	link := fmt.Sprintf("%s/api/comments/%s/confirm?token=%s", base, siteKey, signToken(payload, siteCfg.TokenSecret))
+
+	title := siteCfg.Title
+	if strings.TrimSpace(title) == "" {
+		title = siteKey
+	}
+	subject, body := generator.BuildConfirmationMail(generator.ConfirmationMailInput{
+		SiteTitle:  title,
+		PostPath:   cm.PostPath,
+		Author:     cm.Author,
+		Body:       cm.Body,
+		ConfirmURL: link,
+		ExpiresAt:  exp,
+		ViewURL:    viewURL(siteKey, siteCfg, cm),
+		Policy:     sitePolicy(siteCfg),
+	})
+
+	return mailer.SendTextMail([]string{cm.Email}, subject, body)
+}
+
+// sendModerationMail sends the approve/reject links of a pending comment to the site admins.
+func sendModerationMail(base, siteKey string, siteCfg config.CommentsSiteConfig, cm db.Comment) error {
+	// Build signed approve/reject tokens (HMAC) with expiry
+	exp := time.Now().Add(72 * time.Hour).Unix()
+
+	approvePayload := fmt.Sprintf("%s|%s|approve|%d", siteKey, cm.ID, exp)
+	rejectPayload := fmt.Sprintf("%s|%s|reject|%d", siteKey, cm.ID, exp)
+
+	approveToken := signToken(approvePayload, siteCfg.TokenSecret)
+	rejectToken := signToken(rejectPayload, siteCfg.TokenSecret)
+
+	approveLink := fmt.Sprintf("%s/api/comments/%s/decision?token=%s", base, siteKey, approveToken)
+	rejectLink := fmt.Sprintf("%s/api/comments/%s/decision?token=%s", base, siteKey, rejectToken)
+
+	var wordMatches []string
+	if cm.WordMatches != "" {
+		wordMatches = strings.Split(cm.WordMatches, ",")
+	}
+	disposable := false
+	if siteEmailOptions(siteCfg).Disposable == sanitize.DisposableFlag {
+		disposable, _ = sanitize.IsDisposableEmail(cm.Email, siteCfg.DisposableEmail.File)
+	}
+
+	subject, body, _ := generator.BuildModerationMail(generator.ModerationMailInput{
+		SiteID:     siteKey,
+		PostPath:   cm.PostPath,
+		EntryID:    cm.EntryID.String,
+		ParentID:   cm.ParentID.String,
+		CommentID:  cm.ID,
+		Author:     cm.Author,
+		Email:      cm.Email,
+		AuthorUrl:  cm.AuthorURLString(),
+		ClientIP:   cm.IP,
+		Body:       cm.Body,
+		CreatedAt:  time.Unix(cm.CreatedAt, 0),
+		ApproveURL: approveLink,
+		RejectURL:  rejectLink,
+		Policy:     sitePolicy(siteCfg),
+
+		WordAction:  wordfilter.Action(siteCfg.WordFilter),
+		WordMatches: wordMatches,
+
+		DisposableEmail: disposable,
+	})
+
+	return mailer.SendTextMail(siteCfg.AdminRecipients, subject, body)
+}
+
+// CleanupUnconfirmed deletes unconfirmed comments whose confirmation link has expired.
+func CleanupUnconfirmed(ctx context.Context, database *db.DB) {
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		if !siteCfg.DoubleOptIn.Enabled {
+			continue
+		}
+		siteID, found, err := database.GetSiteIDByKey(ctx, siteKey)
+		if err != nil || !found {
+			continue
+		}
+		before := time.Now().Add(-doubleOptInTTL(siteCfg.DoubleOptIn)).Unix()
+		n, err := database.DeleteExpiredUnconfirmed(ctx, siteID, before)
+		if err != nil {
+			log.Printf("Cleanup of unconfirmed comments failed (site=%s): %v", siteKey, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Deleted %d unconfirmed comments (site=%s)", n, siteKey)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/gin-gonic/gin"
+)
+
+// maxCountPostPaths limits the batch variant of the count endpoint.
+const maxCountPostPaths = 100
+
+// GET /api/comments/:sitekey/count?post_path=...&since=<unix|comment id>
+func (ct CommentsController) GetCount(c *gin.Context) {
+	siteKey := c.Param("sitekey")
+
+	postPath := strings.TrimSpace(c.Query("post_path"))
+	if postPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "missing_post_path"})
+		return
+	}
+
+	counts, ok := ct.countApproved(c, siteKey, []string{postPath})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"site_key":  siteKey,
+		"post_path": postPath,
+		"count":     counts[postPath],
+	})
+}
+
+// GET /api/comments/:sitekey/counts?post_path=...&post_path=...&since=<unix|comment id>
+func (ct CommentsController) GetCounts(c *gin.Context) {
+	siteKey := c.Param("sitekey")
+
+	postPaths := make([]string, 0)
+	for _, p := range c.QueryArray("post_path") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			postPaths = append(postPaths, p)
+		}
+	}
+	if len(postPaths) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "missing_post_path"})
+		return
+	}
+	if len(postPaths) > maxCountPostPaths {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "too_many_post_paths"})
+		return
+	}
+
+	counts, ok := ct.countApproved(c, siteKey, postPaths)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"site_key": siteKey,
+		"counts":   counts,
+	})
+}
+
+// countApproved resolves the site, applies CORS and queries the counts.
+// It writes the error response itself and returns false on failure.
+func (ct CommentsController) countApproved(c *gin.Context, siteKey string, postPaths []string) (map[string]int64, bool) {
+	siteCfg, ok := config.Cfg.CommentSites[siteKey]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return nil, false
+	}
+
+	if !checkEmbedToken(c, siteKey, siteCfg) {
+		return nil, false
+	}
+
+	if ct.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_not_initialized"})
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	siteID, found, err := ct.DB.GetSiteIDByKey(ctx, siteKey)
+	if err != nil {
+		log.Printf("Resolve site key failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return nil, false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return nil, false
+	}
+
+	sinceRaw := strings.TrimSpace(c.Query("since"))
+	key := cacheKey(ctx, ct.Cache, siteID, append([]string{"counts", sinceRaw}, postPaths...)...)
+	var counts map[string]int64
+	if loadCached(ctx, ct.Cache, key, &counts) {
+		return counts, true
+	}
+
+	since, ok := ct.resolveSince(ctx, c, siteKey, siteID)
+	if !ok {
+		return nil, false
+	}
+
+	counts, err = ct.DB.CountApprovedByPostPathSince(ctx, siteID, postPaths, since)
+	if err != nil {
+		log.Printf("Count approved comments failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return nil, false
+	}
+	storeCached(ctx, ct.Cache, key, counts)
+	return counts, true
+}
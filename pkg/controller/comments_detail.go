@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/comments/detail?site_id=<id>&id=<comment id>
+//
+// Returns one comment with its revision history, oldest change first.
+func (ct CommentsAdminController) GetDetail(c *gin.Context) {
+	siteID, err := strconv.ParseInt(strings.TrimSpace(c.Query("site_id")), 10, 64)
+	if err != nil || siteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+		return
+	}
+	commentID := strings.TrimSpace(c.Query("id"))
+	if commentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_ID"})
+		return
+	}
+
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, siteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+
+	comment, found, err := ct.DB.GetComment(ctx, siteID, commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+	revisions, err := ct.DB.ListCommentRevisions(ctx, siteID, commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if revisions == nil {
+		revisions = []db.CommentRevision{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"comment":      comment,
+		"spam_rules":   comment.SpamRules,
+		"word_matches": comment.WordMatches,
+		"revisions":    revisions,
+	})
+}
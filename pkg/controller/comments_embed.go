@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/embed"
+	"github.com/geschke/fyndmark/pkg/secrets"
+	"github.com/gin-gonic/gin"
+)
+
+// embedTokenHeader carries the signed site token; the embed_token query parameter is
+// accepted as well because EventSource cannot set request headers.
+const embedTokenHeader = "X-Fyndmark-Embed-Token"
+
+// checkEmbedToken enforces embed.require_token for the public read endpoints.
+// It writes the error response itself and returns false if access is denied.
+func checkEmbedToken(c *gin.Context, siteKey string, siteCfg config.CommentsSiteConfig) bool {
+	if !siteCfg.Embed.RequireToken {
+		return true
+	}
+
+	secret, err := secrets.Decrypt(siteCfg.Embed.Secret)
+	if err != nil {
+		log.Printf("Embed secret not usable (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "embed_not_configured"})
+		return false
+	}
+
+	token := c.GetHeader(embedTokenHeader)
+	if token == "" {
+		token = c.Query("embed_token")
+	}
+
+	switch err := embed.Verify(secret, siteKey, token, time.Now()); {
+	case err == nil:
+		return true
+	case errors.Is(err, embed.ErrMissing):
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "embed_token_required"})
+	case errors.Is(err, embed.ErrExpired):
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "error": "embed_token_expired"})
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "embed_token_invalid"})
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// exportTimeout bounds a single export; exports stream rows and may take longer than list requests.
+const exportTimeout = 5 * time.Minute
+
+var exportCSVHeader = []string{
+	"id", "site_id", "entry_id", "post_path", "parent_id", "status", "author", "email",
+	"author_url", "body", "ip", "created_at", "approved_at", "rejected_at", "spam_score",
+	"updated_at", "decided_by", "decided_via",
+}
+
+// GET /api/comments/export?format=csv|ndjson&site_id=<id>&status=..&q=..&since=..&until=..
+//
+// Accepts the same filters as /api/comments/list; without limit all matching comments are exported.
+func (ct CommentsAdminController) GetExport(c *gin.Context) {
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "csv")))
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_FORMAT"})
+		return
+	}
+
+	filter, ok := parseCommentListFilter(c, 0, 0)
+	if !ok {
+		return
+	}
+
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), exportTimeout)
+	defer cancel()
+
+	allowedSiteIDs, err := ct.DB.ListAllowedSiteIDsByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if filter.SiteID > 0 && !containsID(allowedSiteIDs, filter.SiteID) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+	filter.AllowedSiteIDs = allowedSiteIDs
+
+	filename := fmt.Sprintf("comments-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	c.Status(http.StatusOK)
+
+	if len(allowedSiteIDs) == 0 {
+		if format == "csv" {
+			w := csv.NewWriter(c.Writer)
+			_ = w.Write(exportCSVHeader)
+			w.Flush()
+		}
+		return
+	}
+
+	// Headers are sent with the first write; errors after that can only abort the stream.
+	buf := bufio.NewWriterSize(c.Writer, 32*1024)
+	var writeRow func(db.Comment) error
+	var flush func() error
+
+	if format == "csv" {
+		w := csv.NewWriter(buf)
+		if err := w.Write(exportCSVHeader); err != nil {
+			return
+		}
+		writeRow = func(cm db.Comment) error {
+			return w.Write([]string{
+				cm.ID,
+				strconv.FormatInt(cm.SiteID, 10),
+				nullableString(cm.EntryID),
+				cm.PostPath,
+				nullableString(cm.ParentID),
+				cm.Status,
+				csvSafe(cm.Author),
+				csvSafe(cm.Email),
+				csvSafe(cm.AuthorURLString()),
+				csvSafe(cm.Body),
+				cm.IP,
+				strconv.FormatInt(cm.CreatedAt, 10),
+				strconv.FormatInt(cm.ApprovedAt, 10),
+				strconv.FormatInt(cm.RejectedAt, 10),
+				strconv.Itoa(cm.SpamScore),
+				strconv.FormatInt(cm.UpdatedAt, 10),
+				cm.DecidedBy,
+				cm.DecidedVia,
+			})
+		}
+		flush = func() error {
+			w.Flush()
+			if err := w.Error(); err != nil {
+				return err
+			}
+			return buf.Flush()
+		}
+	} else {
+		enc := json.NewEncoder(buf)
+		writeRow = func(cm db.Comment) error {
+			return enc.Encode(cm)
+		}
+		flush = buf.Flush
+	}
+
+	count := 0
+	err = ct.DB.EachComment(ctx, filter, func(cm db.Comment) error {
+		count++
+		return writeRow(cm)
+	})
+	if err != nil {
+		log.Printf("comment export aborted after %d rows (user_id=%d): %v", count, userID, err)
+	}
+	if err := flush(); err != nil {
+		log.Printf("comment export flush failed (user_id=%d): %v", userID, err)
+	}
+}
+
+// nullableString performs its package-specific operation.
+func nullableString(ns sql.NullString) string {
+	if ns.Valid {
+		return ns.String
+	}
+	return ""
+}
+
+// csvSafe prefixes values that spreadsheet applications would evaluate as formulas.
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/commentid"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/events"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	publicListDefaultLimit = 100
+	publicListMaxLimit     = 500
+)
+
+// GET /api/comments/:sitekey/list?post_path=...&since=<unix|comment id>&order=created|approved&limit=..
+//
+// Lists approved comments of one post. Without since, comments are sorted in thread
+// order (created_at, id). With since, only comments approved after the marker are
+// returned, sorted by (approved_at, id); next_since can be passed as since in the
+// next poll.
+func (ct CommentsController) GetPublicList(c *gin.Context) {
+	siteKey := c.Param("sitekey")
+
+	siteCfg, ok := config.Cfg.CommentSites[siteKey]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return
+	}
+
+	if !checkEmbedToken(c, siteKey, siteCfg) {
+		return
+	}
+
+	postPath := strings.TrimSpace(c.Query("post_path"))
+	if postPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "missing_post_path"})
+		return
+	}
+
+	limit := publicListDefaultLimit
+	if v := strings.TrimSpace(c.Query("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > publicListMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "invalid_limit"})
+			return
+		}
+		limit = n
+	}
+
+	order := strings.ToLower(strings.TrimSpace(c.Query("order")))
+	switch order {
+	case "", db.OrderCreated, db.OrderApproved:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "invalid_order"})
+		return
+	}
+
+	if ct.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_not_initialized"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	siteID, found, err := ct.DB.GetSiteIDByKey(ctx, siteKey)
+	if err != nil {
+		log.Printf("Resolve site key failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return
+	}
+
+	// The commenter's own comments are never cached; they are added to the response.
+	own, ok := ct.ownComments(ctx, c, siteKey, siteCfg, siteID, postPath)
+	if !ok {
+		return
+	}
+
+	sinceRaw := strings.TrimSpace(c.Query("since"))
+	key := cacheKey(ctx, ct.Cache, siteID, "list", postPath, sinceRaw, order, strconv.Itoa(limit))
+	var cached publicListPage
+	if loadCached(ctx, ct.Cache, key, &cached) {
+		c.JSON(http.StatusOK, withOwn(c, cached.response(siteKey, postPath), own))
+		return
+	}
+
+	since, ok := ct.resolveSince(ctx, c, siteKey, siteID)
+	if !ok {
+		return
+	}
+	if !since.IsZero() {
+		// Markers refer to the approval order.
+		order = db.OrderApproved
+	}
+	if order == "" {
+		order = db.OrderCreated
+	}
+
+	list, err := ct.DB.ListPublicComments(ctx, db.PublicCommentFilter{
+		SiteID:   siteID,
+		PostPath: postPath,
+		Since:    since,
+		Order:    order,
+		Limit:    limit,
+	})
+	if err != nil {
+		log.Printf("List public comments failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return
+	}
+
+	page := publicListPage{Order: order, Items: make([]events.Comment, 0, len(list))}
+	for _, cm := range list {
+		page.Items = append(page.Items, publicComment(cm))
+	}
+	if order == db.OrderApproved && len(list) > 0 {
+		page.NextSince = list[len(list)-1].ID
+	}
+	storeCached(ctx, ct.Cache, key, page)
+
+	c.JSON(http.StatusOK, withOwn(c, page.response(siteKey, postPath), own))
+}
+
+// withOwn adds the commenter's own comments to a list response and marks it private.
+func withOwn(c *gin.Context, resp gin.H, own []ownComment) gin.H {
+	if own == nil {
+		return resp
+	}
+	c.Header("Cache-Control", "private, no-store")
+	resp["own_items"] = own
+	return resp
+}
+
+// publicListPage is the cacheable part of a list response.
+type publicListPage struct {
+	Order     string           `json:"order"`
+	Items     []events.Comment `json:"items"`
+	NextSince string           `json:"next_since,omitempty"`
+}
+
+func (p publicListPage) response(siteKey, postPath string) gin.H {
+	resp := gin.H{
+		"success":   true,
+		"site_key":  siteKey,
+		"post_path": postPath,
+		"order":     p.Order,
+		"items":     p.Items,
+	}
+	if p.NextSince != "" {
+		resp["next_since"] = p.NextSince
+	}
+	return resp
+}
+
+// maxSinceSeconds is the largest since value read as unix seconds (year 5138).
+const maxSinceSeconds = 1e11
+
+// resolveSince parses the since query parameter: unix seconds or the ID of an
+// approved comment of the site. It writes the error response itself and returns
+// false on invalid input.
+func (ct CommentsController) resolveSince(ctx context.Context, c *gin.Context, siteKey string, siteID int64) (db.ApprovedMarker, bool) {
+	raw := strings.TrimSpace(c.Query("since"))
+	if raw == "" {
+		return db.ApprovedMarker{}, true
+	}
+
+	// Numbers up to maxSinceSeconds are unix seconds; larger ones are snowflake comment IDs.
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil && n <= maxSinceSeconds {
+		if n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "invalid_since"})
+			return db.ApprovedMarker{}, false
+		}
+		return db.ApprovedMarker{ApprovedAt: n}, true
+	}
+
+	if !commentid.Valid(raw) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "invalid_since"})
+		return db.ApprovedMarker{}, false
+	}
+
+	cm, found, err := ct.DB.GetComment(ctx, siteID, raw)
+	if err != nil {
+		log.Printf("Resolve since marker failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return db.ApprovedMarker{}, false
+	}
+	if !found || cm.Status != db.CommentStatusApproved {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "invalid_since"})
+		return db.ApprovedMarker{}, false
+	}
+	return db.ApprovedMarker{ApprovedAt: cm.ApprovedAt, ID: cm.ID}, true
+}
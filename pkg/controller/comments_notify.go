@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"log"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/events"
+	"github.com/geschke/fyndmark/pkg/webhooks"
+)
+
+// notifyModeration informs live stream subscribers and webhooks about a moderation decision.
+// status is the new comment status (approved|rejected|spam).
+func notifyModeration(ctx context.Context, database *db.DB, broker *events.Broker, hooks *webhooks.Dispatcher, siteKey string, siteID int64, commentID, status string) {
+	if database == nil || (broker == nil && hooks == nil) {
+		return
+	}
+
+	cm, found, err := database.GetComment(ctx, siteID, commentID)
+	if err != nil {
+		log.Printf("Load comment for notification failed (site_id=%d id=%s): %v", siteID, commentID, err)
+		return
+	}
+	if !found || cm.Status != status {
+		return
+	}
+
+	pc := publicComment(cm)
+	switch status {
+	case "approved":
+		broker.Publish(siteID, pc)
+		hooks.Fire(ctx, siteKey, webhooks.EventCommentApproved, pc)
+	case "rejected":
+		hooks.Fire(ctx, siteKey, webhooks.EventCommentRejected, pc)
+	case "spam":
+		hooks.Fire(ctx, siteKey, webhooks.EventCommentSpam, pc)
+	}
+}
+
+// publicComment returns the comment without private fields (email, IP).
+func publicComment(cm db.Comment) events.Comment {
+	return events.Comment{
+		ID:          cm.ID,
+		EntryID:     cm.EntryID.String,
+		PostPath:    cm.PostPath,
+		ParentID:    cm.ParentID.String,
+		Author:      cm.Author,
+		AuthorURL:   cm.AuthorURLString(),
+		EmailMD5:    cm.EmailMD5,
+		EmailSHA256: cm.EmailSHA256,
+		Body:        cm.Body,
+		CreatedAt:   cm.CreatedAt,
+		ApprovedAt:  cm.ApprovedAt,
+	}
+}
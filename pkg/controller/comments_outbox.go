@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// Retry schedule of outbox mails: 1, 2, 4, ... minutes, at most maxMailRetryDelay apart.
+const (
+	maxMailAttempts   = 10
+	mailRetryDelay    = time.Minute
+	maxMailRetryDelay = 6 * time.Hour
+
+	// outboxRetention is how long sent, skipped and failed mails are kept.
+	outboxRetention = 30 * 24 * time.Hour
+)
+
+// deliverOutboxMail sends a queued notification mail and records the result.
+// Errors are logged; the result reports whether the mail was sent.
+func deliverOutboxMail(ctx context.Context, database *db.DB, m db.OutboxMail) bool {
+	// Mail delivery must not be cut short by a request that ends meanwhile.
+	ctx = context.WithoutCancel(ctx)
+
+	skip, err := sendOutboxMail(ctx, database, m)
+	attempts := m.Attempts + 1
+	status, errMsg, next := db.OutboxSent, "", time.Now()
+	switch {
+	case skip != "":
+		status, errMsg = db.OutboxSkipped, skip
+	case err != nil:
+		log.Printf("Failed to send %s mail for comment %s (attempt %d): %v", m.Kind, m.CommentID, attempts, err)
+		status, errMsg = db.OutboxPending, err.Error()
+		next = next.Add(mailRetryBackoff(attempts))
+		if attempts >= maxMailAttempts {
+			status = db.OutboxFailed
+		}
+	}
+
+	if err := database.RecordMailAttempt(ctx, m.ID, status, attempts, errMsg, next.Unix()); err != nil {
+		log.Printf("Record mail attempt failed (id=%d): %v", m.ID, err)
+	}
+	return status == db.OutboxSent
+}
+
+// sendOutboxMail builds and sends the mail from the current state of the comment.
+// skip is set if the mail became obsolete.
+func sendOutboxMail(ctx context.Context, database *db.DB, m db.OutboxMail) (skip string, err error) {
+	site, found, err := database.GetSiteByID(ctx, m.SiteID)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "site not found", nil
+	}
+	siteCfg, ok := config.Cfg.CommentSites[site.SiteKey]
+	if !ok {
+		return "site not configured", nil
+	}
+
+	cm, found, err := database.GetComment(ctx, m.SiteID, m.CommentID)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "comment not found", nil
+	}
+
+	switch m.Kind {
+	case db.MailModeration:
+		if cm.Status != db.CommentStatusPending {
+			return "comment is " + cm.Status, nil
+		}
+		return "", sendModerationMail(m.BaseURL, site.SiteKey, siteCfg, cm)
+	case db.MailConfirmation:
+		if cm.Status != db.CommentStatusUnconfirmed {
+			return "comment is " + cm.Status, nil
+		}
+		return "", sendConfirmationMail(m.BaseURL, site.SiteKey, siteCfg, cm)
+	default:
+		return fmt.Sprintf("unknown mail kind %q", m.Kind), nil
+	}
+}
+
+// mailRetryBackoff returns the delay after the given number of failed attempts.
+func mailRetryBackoff(attempts int) time.Duration {
+	d := mailRetryDelay
+	for i := 1; i < attempts && d < maxMailRetryDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxMailRetryDelay)
+}
+
+// ProcessMailOutbox sends queued notification mails that were not sent when their
+// comment was stored (SMTP failure, restart) and removes old outbox entries.
+func ProcessMailOutbox(ctx context.Context, database *db.DB) {
+	due, err := database.ListDueMails(ctx, time.Now().Unix(), 100)
+	if err != nil {
+		log.Printf("List due outbox mails failed: %v", err)
+		return
+	}
+	for _, m := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		deliverOutboxMail(ctx, database, m)
+	}
+
+	if n, err := database.DeleteOldOutboxMails(ctx, time.Now().Add(-outboxRetention).Unix()); err != nil {
+		log.Printf("Delete old outbox mails failed: %v", err)
+	} else if n > 0 {
+		log.Printf("Deleted %d old outbox mails", n)
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/sanitize"
+	"github.com/geschke/fyndmark/pkg/wordfilter"
+)
+
+// sitePolicy returns the sanitize policy configured for a site.
+func sitePolicy(siteCfg config.CommentsSiteConfig) *sanitize.Policy {
+	p := sanitize.PolicyFromConfig(siteCfg.Sanitize)
+	return &p
+}
+
+// siteMaxBodyLen returns the body limit of a site, capped at the server limit.
+func siteMaxBodyLen(siteCfg config.CommentsSiteConfig) int {
+	if n := siteCfg.Sanitize.MaxBodyLength; n > 0 && n < maxBodyLen {
+		return n
+	}
+	return maxBodyLen
+}
+
+// siteEmailOptions returns the email checks configured for a site.
+func siteEmailOptions(siteCfg config.CommentsSiteConfig) sanitize.EmailOptions {
+	return sanitize.EmailOptions{
+		Disposable:     strings.ToLower(strings.TrimSpace(siteCfg.DisposableEmail.Action)),
+		DisposableFile: siteCfg.DisposableEmail.File,
+		CheckMX:        siteCfg.EmailMX.Enabled,
+		MXTimeout:      time.Duration(siteCfg.EmailMX.TimeoutMS) * time.Millisecond,
+	}
+}
+
+// applyWordFilter checks author and body against the site's wordlist. With action
+// mask, matched terms are replaced in place. It returns the action and the matches
+// ("field:term"); an empty action means no filter is configured or nothing matched.
+func applyWordFilter(siteKey string, siteCfg config.CommentsSiteConfig, author, body *string) (string, []string) {
+	f, err := wordfilter.Load(siteCfg.WordFilter)
+	if err != nil {
+		log.Printf("Load word filter failed (site=%s): %v", siteKey, err)
+		return "", nil
+	}
+	if f == nil {
+		return "", nil
+	}
+
+	var matches []string
+	for _, m := range f.Find("author", *author) {
+		matches = append(matches, m.String())
+	}
+	for _, m := range f.Find("body", *body) {
+		matches = append(matches, m.String())
+	}
+	if len(matches) == 0 {
+		return "", nil
+	}
+
+	if f.Action == wordfilter.ActionMask {
+		*author = f.Mask(*author)
+		*body = f.Mask(*body)
+	}
+	return f.Action, matches
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/sanitize"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPseudonym replaces the author name if no new name is given.
+const defaultPseudonym = "Anonymous"
+
+type commentPseudonymizeRequest struct {
+	SiteID  int64  `json:"SiteID"`
+	Email   string `json:"Email"`
+	Author  string `json:"Author"`
+	NewName string `json:"NewName"`
+	Reason  string `json:"Reason"`
+}
+
+// POST /api/comments/pseudonymize
+//
+// Replaces the display name and clears the personal data of all comments of one
+// author (matched by email and/or current name) on a site and regenerates the site if
+// published comments changed.
+func (ct CommentsAdminController) PostPseudonymize(c *gin.Context) {
+	var req commentPseudonymizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+	if req.SiteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	req.Author = strings.TrimSpace(req.Author)
+	if req.Email == "" && req.Author == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_AUTHOR"})
+		return
+	}
+
+	newName := defaultPseudonym
+	if strings.TrimSpace(req.NewName) != "" {
+		newName, _ = sanitize.SanitizeAuthorName(req.NewName, 0)
+		if newName == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_NEW_NAME"})
+			return
+		}
+	}
+
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, req.SiteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+
+	res, err := ct.DB.PseudonymizeAuthor(ctx, db.PseudonymizeRequest{
+		SiteID:  req.SiteID,
+		Email:   req.Email,
+		Author:  req.Author,
+		NewName: newName,
+		Reason:  strings.TrimSpace(req.Reason),
+		UserID:  userID,
+	})
+	if err != nil {
+		log.Printf("pseudonymize failed (site_id=%d): %v", req.SiteID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	if res.ApprovedChanged {
+		invalidateCache(ctx, ct.Cache, req.SiteID)
+	}
+
+	resp := gin.H{
+		"success":    true,
+		"changed":    res.Changed,
+		"new_name":   newName,
+		"post_paths": res.PostPaths,
+	}
+	if res.ApprovedChanged {
+		if runID, ok := ct.enqueueSiteRun(ctx, req.SiteID); ok {
+			resp["run_id"] = runID
+		} else {
+			resp["warning"] = "pipeline_enqueue_failed"
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
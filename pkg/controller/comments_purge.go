@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+type commentPurgeRequest struct {
+	// SiteID purges all deleted comments of a site if Items is empty.
+	SiteID int64                   `json:"SiteID"`
+	Items  []commentModerationItem `json:"Items"`
+}
+
+// POST /api/comments/purge
+//
+// Permanently removes deleted comments: the given Items, or all deleted comments of
+// SiteID. Comments in another status are skipped.
+func (ct CommentsAdminController) PostPurge(c *gin.Context) {
+	var req commentPurgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+
+	// Comment IDs per site; a site without IDs purges all its deleted comments.
+	bySite := make(map[int64][]string)
+	var siteIDs []int64
+	for _, item := range req.Items {
+		item.CommentID = strings.TrimSpace(item.CommentID)
+		if item.SiteID <= 0 || item.CommentID == "" {
+			continue
+		}
+		if _, ok := bySite[item.SiteID]; !ok {
+			siteIDs = append(siteIDs, item.SiteID)
+		}
+		bySite[item.SiteID] = append(bySite[item.SiteID], item.CommentID)
+	}
+	if len(req.Items) > 0 && len(siteIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_ITEMS"})
+		return
+	}
+	if len(req.Items) == 0 {
+		if req.SiteID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+			return
+		}
+		siteIDs = []int64{req.SiteID}
+	}
+
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Nothing is purged unless the user may access every site of the request.
+	for _, siteID := range siteIDs {
+		hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, siteID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+			return
+		}
+		if !hasAccess {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+			return
+		}
+	}
+
+	purged := make([]commentModerationItem, 0)
+	for _, siteID := range siteIDs {
+		ids, err := ct.DB.PurgeComments(ctx, db.PurgeFilter{SiteID: siteID, IDs: bySite[siteID], UserID: userID})
+		if err != nil {
+			log.Printf("purge comments failed (site_id=%d): %v", siteID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+			return
+		}
+		if len(ids) > 0 {
+			// Replies of purged comments became top-level comments.
+			invalidateCache(ctx, ct.Cache, siteID)
+		}
+		for _, id := range ids {
+			purged = append(purged, commentModerationItem{SiteID: siteID, CommentID: id})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"purged":  purged,
+		"count":   len(purged),
+	})
+}
+
+// PurgeTrash permanently removes the comments deleted longer ago than the
+// trash.purge_after_days setting of their site.
+func PurgeTrash(ctx context.Context, database *db.DB) {
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		if siteCfg.Trash.PurgeAfterDays <= 0 {
+			continue
+		}
+		siteID, found, err := database.GetSiteIDByKey(ctx, siteKey)
+		if err != nil || !found {
+			continue
+		}
+		before := time.Now().AddDate(0, 0, -siteCfg.Trash.PurgeAfterDays).Unix()
+		ids, err := database.PurgeComments(ctx, db.PurgeFilter{SiteID: siteID, DeletedBefore: before})
+		if err != nil {
+			log.Printf("Purging deleted comments failed (site=%s): %v", siteKey, err)
+			continue
+		}
+		if len(ids) > 0 {
+			log.Printf("Purged %d deleted comments (site=%s)", len(ids), siteKey)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/commentid"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/sanitize"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAdminReplyAuthor is used when admin_reply.author is not set.
+const defaultAdminReplyAuthor = "Admin"
+
+type commentReplyRequest struct {
+	SiteID   int64  `json:"SiteID"`
+	ParentID string `json:"ParentID"`
+	Body     string `json:"Body"`
+}
+
+// adminReplyAuthor returns the display name and URL of admin replies on a site.
+func adminReplyAuthor(siteCfg config.CommentsSiteConfig) (string, string) {
+	author, _ := sanitize.SanitizeAuthorName(siteCfg.AdminReply.Author, 0)
+	if author == "" {
+		author = defaultAdminReplyAuthor
+	}
+	return author, strings.TrimSpace(siteCfg.AdminReply.AuthorURL)
+}
+
+// POST /api/comments/reply
+//
+// Publishes a moderator's reply to an approved comment. The reply skips moderation,
+// is attributed to the admin_reply author of the site and regenerates the site.
+func (ct CommentsAdminController) PostReply(c *gin.Context) {
+	var req commentReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+	if req.SiteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+		return
+	}
+	req.ParentID = strings.TrimSpace(req.ParentID)
+	if req.ParentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_PARENT_ID"})
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_BODY"})
+		return
+	}
+
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, req.SiteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+
+	site, found, err := ct.DB.GetSiteByID(ctx, req.SiteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	siteCfg, configured := config.Cfg.CommentSites[site.SiteKey]
+	if !found || !configured {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "UNKNOWN_SITE"})
+		return
+	}
+	if len(req.Body) > siteMaxBodyLen(siteCfg) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "BODY_TOO_LONG"})
+		return
+	}
+
+	parent, found, err := ct.DB.GetComment(ctx, req.SiteID, req.ParentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+	// Like replies of visitors, admin replies need a published parent.
+	if parent.Status != db.CommentStatusApproved {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "PARENT_NOT_APPROVED"})
+		return
+	}
+
+	// The account email only feeds the avatar hashes; it is not published.
+	user, _, err := ct.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	commentID, err := commentid.New()
+	if err != nil {
+		log.Printf("Generate comment ID failed (site=%s): %v", site.SiteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "ID_GENERATION_FAILED"})
+		return
+	}
+
+	author, authorURL := adminReplyAuthor(siteCfg)
+	by := db.AdminDecision(userID)
+	if err := ct.DB.InsertComment(ctx, db.Comment{
+		ID:         commentID,
+		SiteID:     req.SiteID,
+		EntryID:    parent.EntryID,
+		PostPath:   parent.PostPath,
+		ParentID:   sql.NullString{String: parent.ID, Valid: true},
+		Status:     db.CommentStatusApproved,
+		Author:     author,
+		Email:      user.Email,
+		AuthorUrl:  sql.NullString{String: authorURL, Valid: authorURL != ""},
+		Body:       req.Body,
+		DecidedBy:  by.By,
+		DecidedVia: by.Via,
+	}); err != nil {
+		log.Printf("Insert admin reply failed (site=%s parent=%s): %v", site.SiteKey, parent.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	invalidateCache(ctx, ct.Cache, req.SiteID)
+	notifyModeration(ctx, ct.DB, ct.Events, ct.Webhooks, site.SiteKey, req.SiteID, commentID, db.CommentStatusApproved)
+
+	comment, _, err := ct.DB.GetComment(ctx, req.SiteID, commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	resp := gin.H{
+		"success": true,
+		"comment": comment,
+	}
+	if runID, ok := ct.enqueueSiteRun(ctx, req.SiteID); ok {
+		resp["run_id"] = runID
+	} else {
+		resp["warning"] = "pipeline_enqueue_failed"
+	}
+	c.JSON(http.StatusCreated, resp)
+}
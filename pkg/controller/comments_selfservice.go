@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/wordfilter"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultSelfServiceWindow is used when self_service.window_minutes is not set.
+const defaultSelfServiceWindow = 15 * time.Minute
+
+type selfServiceRequest struct {
+	EditToken string `json:"edit_token"`
+	Body      string `json:"body"`
+}
+
+// selfServiceWindow returns how long a commenter may edit or withdraw a comment.
+func selfServiceWindow(cfg config.SelfServiceConfig) time.Duration {
+	if cfg.WindowMinutes > 0 {
+		return time.Duration(cfg.WindowMinutes) * time.Minute
+	}
+	return defaultSelfServiceWindow
+}
+
+// addEditToken adds a signed edit token to a submission response if self-service is enabled.
+func addEditToken(resp gin.H, siteKey string, siteCfg config.CommentsSiteConfig, commentID string, createdAt time.Time) gin.H {
+	if !siteCfg.SelfService.Enabled {
+		return resp
+	}
+	exp := createdAt.Add(selfServiceWindow(siteCfg.SelfService)).Unix()
+	payload := fmt.Sprintf("%s|%s|edit|%d", siteKey, commentID, exp)
+	resp["edit_token"] = signToken(payload, siteCfg.TokenSecret)
+	resp["edit_expires_at"] = exp
+	return resp
+}
+
+// POST /api/comments/:sitekey/edit
+func (ct CommentsController) PostEdit(c *gin.Context) {
+	siteKey, siteID, commentID, req, ok := ct.verifySelfService(c)
+	if !ok {
+		return
+	}
+
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "missing_body"})
+		return
+	}
+	siteCfg := config.Cfg.CommentSites[siteKey]
+	if len(req.Body) > siteMaxBodyLen(siteCfg) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "body_too_long"})
+		return
+	}
+
+	// Edits must pass the word filter like new submissions; the author name is unchanged.
+	author := ""
+	if action, matches := applyWordFilter(siteKey, siteCfg, &author, &req.Body); action == wordfilter.ActionReject {
+		log.Printf("Word filter rejected edit (site=%s id=%s): %v", siteKey, commentID, matches)
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "word_filter"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	changed, err := ct.DB.UpdateCommentBody(ctx, siteID, commentID, req.Body)
+	if err != nil {
+		log.Printf("Update comment body failed (site=%s id=%s): %v", siteKey, commentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_update_failed"})
+		return
+	}
+	if !changed {
+		cm, found, err := ct.DB.GetComment(ctx, siteID, commentID)
+		if err != nil || !found || cm.Body != req.Body {
+			c.JSON(http.StatusConflict, gin.H{"success": false, "error": "not_editable"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"id":      commentID,
+		"changed": changed,
+	})
+}
+
+// POST /api/comments/:sitekey/withdraw
+func (ct CommentsController) PostWithdraw(c *gin.Context) {
+	siteKey, siteID, commentID, _, ok := ct.verifySelfService(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	deleted, err := ct.DB.DeleteOwnComment(ctx, siteID, commentID)
+	if err != nil {
+		log.Printf("Withdraw comment failed (site=%s id=%s): %v", siteKey, commentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_update_failed"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "error": "not_editable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"id":      commentID,
+	})
+}
+
+// verifySelfService applies CORS, parses the request and checks the edit token.
+// It writes the error response itself and returns false on failure.
+func (ct CommentsController) verifySelfService(c *gin.Context) (string, int64, string, selfServiceRequest, bool) {
+	var req selfServiceRequest
+	siteKey := c.Param("sitekey")
+
+	siteCfg, ok := config.Cfg.CommentSites[siteKey]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return "", 0, "", req, false
+	}
+	if !siteCfg.SelfService.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "self_service_disabled"})
+		return "", 0, "", req, false
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "invalid_json"})
+		return "", 0, "", req, false
+	}
+	token := strings.TrimSpace(req.EditToken)
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "missing_edit_token"})
+		return "", 0, "", req, false
+	}
+
+	fields, status, _ := verifyToken(token, siteCfg.TokenSecret)
+	if status != http.StatusOK || fields[0] != siteKey || fields[2] != "edit" {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "invalid_edit_token"})
+		return "", 0, "", req, false
+	}
+	exp, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "invalid_edit_token"})
+		return "", 0, "", req, false
+	}
+	if time.Now().Unix() > exp {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "edit_window_expired"})
+		return "", 0, "", req, false
+	}
+
+	if ct.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_not_initialized"})
+		return "", 0, "", req, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	siteID, found, err := ct.DB.GetSiteIDByKey(ctx, siteKey)
+	if err != nil {
+		log.Printf("Resolve site key failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return "", 0, "", req, false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return "", 0, "", req, false
+	}
+
+	return siteKey, siteID, fields[1], req, true
+}
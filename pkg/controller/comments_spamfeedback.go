@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/antispam"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// spamDecision is a moderator decision that contradicts or confirms the spam classification of a comment.
+type spamDecision struct {
+	Comment db.Comment
+	Spam    bool
+}
+
+// ruleFeedback loads the moderator feedback of a site's heuristic rules.
+// Errors are logged and yield unweighted scoring.
+func (ct CommentsController) ruleFeedback(ctx context.Context, siteKey string, siteID int64) map[string]antispam.RuleFeedback {
+	stats, err := ct.DB.ListSpamRuleStats(ctx, siteID)
+	if err != nil {
+		log.Printf("List spam rule stats failed (site=%s): %v", siteKey, err)
+		return nil
+	}
+	out := make(map[string]antispam.RuleFeedback, len(stats))
+	for rule, s := range stats {
+		out[rule] = antispam.RuleFeedback{Spam: s.Spam, Ham: s.Ham}
+	}
+	return out
+}
+
+// spamDecisionFor returns the feedback a moderation action gives on a comment's previous status:
+// marking a comment as spam confirms spam, approving a spam comment rescues it (ham).
+func spamDecisionFor(action string, prev db.Comment) (spamDecision, bool) {
+	switch {
+	case action == "spam" && prev.Status != "spam":
+		return spamDecision{Comment: prev, Spam: true}, true
+	case action == "approve" && prev.Status == "spam":
+		return spamDecision{Comment: prev, Spam: false}, true
+	}
+	return spamDecision{}, false
+}
+
+// reportSpamDecision records the decision for the heuristic rules that matched the comment
+// and submits it to the site's spam providers in the background.
+func reportSpamDecision(database *db.DB, siteKey string, d spamDecision) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+
+		cm := d.Comment
+		if cm.SpamRules != "" {
+			if err := database.RecordSpamFeedback(ctx, cm.SiteID, strings.Split(cm.SpamRules, ","), d.Spam); err != nil {
+				log.Printf("Record spam feedback failed (site=%s comment=%s): %v", siteKey, cm.ID, err)
+			}
+		}
+
+		siteCfg, ok := config.Cfg.CommentSites[siteKey]
+		if !ok {
+			return
+		}
+		err := antispam.Report(ctx, siteCfg.Antispam, antispam.Comment{
+			UserIP:      cm.IP,
+			Author:      cm.Author,
+			AuthorEmail: cm.Email,
+			AuthorURL:   cm.AuthorUrl.String,
+			Body:        cm.Body,
+		}, d.Spam)
+		if err != nil {
+			log.Printf("Spam feedback submission failed (site=%s comment=%s spam=%t): %v", siteKey, cm.ID, d.Spam, err)
+		}
+	}()
+}
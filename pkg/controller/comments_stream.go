@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/events"
+	"github.com/gin-gonic/gin"
+)
+
+// streamHeartbeatInterval keeps idle connections open through proxies.
+const streamHeartbeatInterval = 25 * time.Second
+
+// GET /api/comments/:sitekey/stream?post_path=...
+func (ct CommentsController) GetStream(c *gin.Context) {
+	siteKey := c.Param("sitekey")
+
+	siteCfg, ok := config.Cfg.CommentSites[siteKey]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return
+	}
+
+	if !checkEmbedToken(c, siteKey, siteCfg) {
+		return
+	}
+
+	if ct.DB == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_not_initialized"})
+		return
+	}
+	if ct.Events == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": "stream_not_available"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	siteID, found, err := ct.DB.GetSiteIDByKey(ctx, siteKey)
+	cancel()
+	if err != nil {
+		log.Printf("Resolve site key failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "unknown_site"})
+		return
+	}
+
+	postPath := strings.TrimSpace(c.Query("post_path"))
+
+	sub, unsubscribe, err := ct.Events.Subscribe(siteID, resolveClientIP(c, config.Cfg.Server.TrustedProxies))
+	if errors.Is(err, events.ErrTooManySubscribers) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"success": false, "error": "too_many_streams"})
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Disable response buffering in nginx.
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	fmt.Fprint(c.Writer, "retry: 5000\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		case ev, open := <-sub:
+			if !open {
+				return
+			}
+			if postPath != "" && ev.PostPath != postPath {
+				continue
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("Encode stream event failed (site=%s id=%s): %v", siteKey, ev.ID, err)
+				continue
+			}
+			fmt.Fprintf(c.Writer, "id: %s\nevent: comment\ndata: %s\n\n", ev.ID, data)
+			c.Writer.Flush()
+		}
+	}
+}
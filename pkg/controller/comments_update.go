@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/sanitize"
+	"github.com/gin-gonic/gin"
+)
+
+type commentUpdateRequest struct {
+	SiteID    int64  `json:"SiteID"`
+	CommentID string `json:"CommentID"`
+	// Omitted fields are kept; an empty AuthorUrl removes the URL.
+	Author    *string `json:"Author"`
+	AuthorUrl *string `json:"AuthorUrl"`
+	Body      *string `json:"Body"`
+}
+
+// POST /api/comments/update
+//
+// Edits the author name, author URL or body of a pending comment before it is
+// moderated. The values pass the same sanitization as new submissions and each
+// change is stored as revision.
+func (ct CommentsAdminController) PostUpdate(c *gin.Context) {
+	var req commentUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+	if req.SiteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+		return
+	}
+	req.CommentID = strings.TrimSpace(req.CommentID)
+	if req.CommentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_ID"})
+		return
+	}
+	if req.Author == nil && req.AuthorUrl == nil && req.Body == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_FIELDS"})
+		return
+	}
+
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, req.SiteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+
+	site, found, err := ct.DB.GetSiteByID(ctx, req.SiteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+	siteCfg := config.Cfg.CommentSites[site.SiteKey]
+
+	edit := db.CommentEdit{SiteID: req.SiteID, CommentID: req.CommentID, UserID: userID}
+	if req.Author != nil {
+		author, _ := sanitize.SanitizeAuthorName(*req.Author, 0)
+		if author == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_AUTHOR"})
+			return
+		}
+		if utf8.RuneCountInString(author) > maxAuthorRunes {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "AUTHOR_TOO_LONG"})
+			return
+		}
+		edit.Author = &author
+	}
+	if req.AuthorUrl != nil {
+		authorURL, urlReport, err := sanitize.SanitizeAuthorURLWithPolicy(strings.TrimSpace(*req.AuthorUrl), maxAuthorURLLen, sanitize.URLPolicyFromConfig(siteCfg.Sanitize.AuthorURL))
+		if err != nil {
+			if urlReport.RejectedBlockedDomain || urlReport.RejectedBlockedTLD || urlReport.RejectedNotAllowed {
+				c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "AUTHOR_URL_NOT_ALLOWED"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_AUTHOR_URL"})
+			return
+		}
+		edit.AuthorURL = &authorURL
+	}
+	if req.Body != nil {
+		body := strings.TrimSpace(*req.Body)
+		if body == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_BODY"})
+			return
+		}
+		if len(body) > siteMaxBodyLen(siteCfg) {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "BODY_TOO_LONG"})
+			return
+		}
+		edit.Body = &body
+	}
+
+	fields, ok, err := ct.DB.EditPendingComment(ctx, edit)
+	if err != nil {
+		log.Printf("edit comment failed (site_id=%d id=%s): %v", req.SiteID, req.CommentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	comment, found, err := ct.DB.GetComment(ctx, req.SiteID, req.CommentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "NOT_PENDING"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"changed": fields,
+		"comment": comment,
+	})
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/events"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultViewTokenTTL is used when view_token.ttl_days is not set.
+const defaultViewTokenTTL = 30 * 24 * time.Hour
+
+// viewQueryParam is the query parameter carrying the view token on the site's pages.
+const viewQueryParam = "fyndmark_view"
+
+// ownComment is a comment shown to its author through a view token.
+type ownComment struct {
+	events.Comment
+	Own     bool `json:"own"`
+	Pending bool `json:"pending"`
+}
+
+// viewTokenTTL returns the validity of view links.
+func viewTokenTTL(cfg config.ViewTokenConfig) time.Duration {
+	if cfg.TTLDays > 0 {
+		return time.Duration(cfg.TTLDays) * 24 * time.Hour
+	}
+	return defaultViewTokenTTL
+}
+
+// viewURL returns the link to the post page with a signed view token for the
+// commenter of cm, or "" if view tokens are disabled.
+func viewURL(siteKey string, siteCfg config.CommentsSiteConfig, cm db.Comment) string {
+	if !siteCfg.ViewToken.Enabled || strings.TrimSpace(siteCfg.ViewToken.BaseURL) == "" {
+		return ""
+	}
+	exp := time.Unix(cm.CreatedAt, 0).Add(viewTokenTTL(siteCfg.ViewToken)).Unix()
+	payload := fmt.Sprintf("%s|%s|view|%d", siteKey, cm.ID, exp)
+
+	base := strings.TrimRight(strings.TrimSpace(siteCfg.ViewToken.BaseURL), "/")
+	path := "/" + strings.TrimLeft(cm.PostPath, "/")
+	return base + path + "?" + viewQueryParam + "=" + url.QueryEscape(signToken(payload, siteCfg.TokenSecret))
+}
+
+// ownComments resolves the view_token query parameter and returns the commenter's
+// pending and approved comments on the post. The token names one comment; all
+// comments with the same email address on that post are returned. It writes the
+// error response itself and returns false on failure.
+func (ct CommentsController) ownComments(ctx context.Context, c *gin.Context, siteKey string, siteCfg config.CommentsSiteConfig, siteID int64, postPath string) ([]ownComment, bool) {
+	token := strings.TrimSpace(c.Query("view_token"))
+	if token == "" {
+		return nil, true
+	}
+	if !siteCfg.ViewToken.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "view_token_disabled"})
+		return nil, false
+	}
+
+	fields, status, _ := verifyToken(token, siteCfg.TokenSecret)
+	if status != http.StatusOK || fields[0] != siteKey || fields[2] != "view" {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "invalid_view_token"})
+		return nil, false
+	}
+	exp, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "view_token_expired"})
+		return nil, false
+	}
+
+	cm, found, err := ct.DB.GetComment(ctx, siteID, fields[1])
+	if err != nil {
+		log.Printf("Load view token comment failed (site=%s id=%s): %v", siteKey, fields[1], err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return nil, false
+	}
+	if !found || cm.PostPath != postPath {
+		// The comment was withdrawn or deleted, or the token belongs to another post.
+		return []ownComment{}, true
+	}
+
+	list, err := ct.DB.ListOwnComments(ctx, siteID, postPath, cm.Email)
+	if err != nil {
+		log.Printf("List own comments failed (site=%s): %v", siteKey, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "db_query_failed"})
+		return nil, false
+	}
+
+	out := make([]ownComment, 0, len(list))
+	for _, own := range list {
+		out = append(out, ownComment{
+			Comment: publicComment(own),
+			Own:     true,
+			Pending: own.Status != db.CommentStatusApproved,
+		})
+	}
+	return out, true
+}
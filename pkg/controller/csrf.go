@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// CSRFHeader carries the CSRF token of the session on state-changing admin requests.
+const CSRFHeader = "X-CSRF-Token"
+
+// csrfSessionKey is the session value holding the CSRF token.
+const csrfSessionKey = "csrf"
+
+// newCSRFToken returns a random CSRF token.
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ensureCSRFToken returns the CSRF token of the session. Sessions created before CSRF
+// protection get one, which is saved with the session.
+func ensureCSRFToken(c *gin.Context, sess *sessions.Session) (string, error) {
+	if token, _ := sess.Values[csrfSessionKey].(string); token != "" {
+		return token, nil
+	}
+	token, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+	sess.Values[csrfSessionKey] = token
+	if err := sess.Save(c.Request, c.Writer); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// checkCSRF reports whether a request authenticated by sess may proceed: safe methods
+// always may, others must send the CSRF token of the session in CSRFHeader.
+func checkCSRF(c *gin.Context, sess *sessions.Session) bool {
+	if config.Cfg.WebAdmin.DisableCSRF {
+		return true
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	want, _ := sess.Values[csrfSessionKey].(string)
+	got := strings.TrimSpace(c.GetHeader(CSRFHeader))
+	return want != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
@@ -8,7 +8,6 @@ import (
 
 	"github.com/geschke/fyndmark/config"
 	"github.com/geschke/fyndmark/pkg/captcha"
-	"github.com/geschke/fyndmark/pkg/cors"
 	"github.com/geschke/fyndmark/pkg/mailer"
 	"github.com/gin-gonic/gin"
 )
@@ -39,12 +38,6 @@ func (ct FeedbackController) PostMail(c *gin.Context) {
 		return
 	}
 
-	// Apply CORS based on the form's allowed origins.
-	// If this returns false, the response is already handled (403 or 204).
-	if !cors.ApplyCORS(c, formCfg.CORSAllowedOrigins) {
-		return
-	}
-
 	// Captcha verification (per form config)
 	token := strings.TrimSpace(c.PostForm("cf-turnstile-response"))
 	provider, err := captcha.ResolveProvider(formCfg.Captcha)
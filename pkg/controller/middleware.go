@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/sessionstore"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// userIDKey is the gin context key of the user authenticated by RequireAuth.
+const userIDKey = "fyndmark.user_id"
+
+// RequireAuth is the middleware of the admin API. It accepts the session of a
+// logged-in user or, if scope is set, an API token with that scope in the
+// Authorization: Bearer header. An empty scope allows sessions only. Sessions must
+// send their CSRF token on state-changing requests. Sessions are rejected while the
+// password change of their user is due, whether forced or after
+// web_admin.max_password_age_days. Tokens are only rejected while a change is forced
+// (MustChangePassword): an expired password does not break automation, and tokens
+// are revoked anyway when the password is reset.
+func RequireAuth(database *db.DB, store sessions.Store, sessionName, scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if database == nil || database.SQL == nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_NOT_INITIALIZED"})
+			return
+		}
+
+		if token, ok := bearerToken(c); ok {
+			if scope == "" {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "message": "SESSION_REQUIRED"})
+				return
+			}
+			userID, status, msg := authenticateToken(c.Request.Context(), database, token, scope)
+			if status != http.StatusOK {
+				c.AbortWithStatusJSON(status, gin.H{"success": false, "message": msg})
+				return
+			}
+			c.Set(userIDKey, userID)
+			c.Next()
+			return
+		}
+
+		if store == nil || strings.TrimSpace(sessionName) == "" {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "message": "AUTH_NOT_CONFIGURED"})
+			return
+		}
+		c.Request = sessionstore.WithClientIP(c.Request, resolveClientIP(c, config.Cfg.Server.TrustedProxies))
+		sess, _ := store.Get(c.Request, sessionName)
+		if sess == nil || sess.IsNew {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+			return
+		}
+		userID, ok := sess.Values["id"].(int64)
+		if !ok || userID <= 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+			return
+		}
+		if !checkCSRF(c, sess) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "message": "CSRF_TOKEN_INVALID"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+		u, found, err := database.GetUserByID(ctx, userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+			return
+		}
+		if !found {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+			return
+		}
+		if reason := sessionPasswordChangeReason(sess, u); reason != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "message": reason})
+			return
+		}
+		c.Next()
+	}
+}
+
+// bearerToken returns the token of an Authorization: Bearer header.
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(c.GetHeader("Authorization")), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// authenticateToken resolves an API token to its user. On failure it returns the
+// HTTP status and message of the response. Tokens are rejected while their user is
+// forced to change the password; password expiry does not apply to them.
+func authenticateToken(ctx context.Context, database *db.DB, token, scope string) (int64, int, string) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	t, found, err := database.GetAPITokenByHash(ctx, hashAPIToken(token))
+	if err != nil {
+		return 0, http.StatusInternalServerError, "DB_ERROR"
+	}
+	if !found || !t.Active(time.Now().Unix()) {
+		return 0, http.StatusUnauthorized, "INVALID_TOKEN"
+	}
+	if !t.HasScope(scope) {
+		return 0, http.StatusForbidden, "INSUFFICIENT_SCOPE"
+	}
+	u, found, err := database.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		return 0, http.StatusInternalServerError, "DB_ERROR"
+	}
+	if !found {
+		return 0, http.StatusUnauthorized, "INVALID_TOKEN"
+	}
+	if u.MustChangePassword {
+		return 0, http.StatusForbidden, "PASSWORD_CHANGE_REQUIRED"
+	}
+	if err := database.TouchAPIToken(ctx, t.ID); err != nil {
+		log.Printf("Touch API token failed (id=%d): %v", t.ID, err)
+	}
+	return t.UserID, http.StatusOK, ""
+}
+
+// hashAPIToken returns the stored form of an API token.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// currentUserID returns the user authenticated by RequireAuth: the owner of the API
+// token or the user of the session.
+func currentUserID(c *gin.Context, store sessions.Store, sessionName string) (int64, bool) {
+	if v, ok := c.Get(userIDKey); ok {
+		id, ok := v.(int64)
+		return id, ok
+	}
+	if store == nil {
+		return 0, false
+	}
+	sess, _ := store.Get(c.Request, sessionName)
+	if sess == nil {
+		return 0, false
+	}
+	raw, ok := sess.Values["id"]
+	if !ok {
+		return 0, false
+	}
+	id, ok := raw.(int64)
+	if !ok {
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/oidc"
+	"github.com/geschke/fyndmark/pkg/secrets"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// oidcFlowMaxAge is how long a started OIDC login may take.
+const oidcFlowMaxAge = 10 * 60
+
+type OIDCController struct {
+	DB          *db.DB
+	Store       sessions.Store
+	SessionName string
+	// Provider is nil if OIDC login is disabled.
+	Provider *oidc.Provider
+}
+
+// NewOIDCController returns the controller of the OIDC login configured in
+// web_admin.oidc.
+func NewOIDCController(database *db.DB, store sessions.Store, sessionName string) *OIDCController {
+	ct := &OIDCController{
+		DB:          database,
+		Store:       store,
+		SessionName: sessionName,
+	}
+	oc := config.Cfg.WebAdmin.OIDC
+	if !oc.Enabled {
+		return ct
+	}
+	secret, err := secrets.Decrypt(strings.TrimSpace(oc.ClientSecret))
+	if err != nil {
+		log.Printf("WARN: OIDC login disabled, client secret: %v", err)
+		return ct
+	}
+	ct.Provider = oidc.New(oc.Issuer, oc.ClientID, secret, oc.RedirectURL, oc.Scopes)
+	return ct
+}
+
+// flowSession returns the short-lived session holding state, nonce and PKCE verifier
+// of a login in progress. It is sent on the redirect back from the provider, so it
+// always uses SameSite=Lax.
+func (ct OIDCController) flowSession(c *gin.Context, maxAge int) *sessions.Session {
+	sess, _ := ct.Store.Get(c.Request, ct.SessionName+"_oidc")
+	sess.Options = &sessions.Options{
+		Path:     cookiePath(),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   config.Cfg.WebAdmin.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	return sess
+}
+
+// GET /api/auth/oidc/login
+// Redirects to the login page of the provider.
+func (ct OIDCController) GetLogin(c *gin.Context) {
+	if ct.Provider == nil || ct.Store == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "OIDC_NOT_ENABLED"})
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "TOKEN_GENERATION_FAILED"})
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	authURL, err := ct.Provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "message": "OIDC_PROVIDER_ERROR"})
+		return
+	}
+
+	sess := ct.flowSession(c, oidcFlowMaxAge)
+	sess.Values["state"] = state
+	sess.Values["nonce"] = nonce
+	sess.Values["verifier"] = verifier
+	if err := sess.Save(c.Request, c.Writer); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "SESSION_SAVE_FAILED"})
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// GET /api/auth/oidc/callback?code=...&state=...
+// Completes the login and redirects to web_admin.oidc.success_url. Failures add
+// oidc_error to that URL.
+func (ct OIDCController) GetCallback(c *gin.Context) {
+	if ct.Provider == nil || ct.Store == nil || ct.DB == nil || ct.DB.SQL == nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "OIDC_NOT_ENABLED"})
+		return
+	}
+
+	// The flow session is used once.
+	flow := ct.flowSession(c, -1)
+	state, _ := flow.Values["state"].(string)
+	nonce, _ := flow.Values["nonce"].(string)
+	verifier, _ := flow.Values["verifier"].(string)
+	_ = flow.Save(c.Request, c.Writer)
+
+	if state == "" || c.Query("state") != state {
+		ct.redirectError(c, "invalid_state")
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		log.Printf("OIDC login failed at the provider: %s %s", e, c.Query("error_description"))
+		ct.redirectError(c, "provider_error")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	claims, err := ct.Provider.Exchange(ctx, c.Query("code"), verifier, nonce)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		ct.redirectError(c, "login_failed")
+		return
+	}
+
+	u, errCode := ct.resolveUser(ctx, claims)
+	if errCode != "" {
+		ct.redirectError(c, errCode)
+		return
+	}
+	if _, err := startSession(c, ct.Store, ct.SessionName, u, db.LoginMethodOIDC); err != nil {
+		ct.redirectError(c, "session_save_failed")
+		return
+	}
+	recordLogin(ctx, c, ct.DB, u.ID, db.LoginMethodOIDC, true)
+	c.Redirect(http.StatusFound, config.Cfg.WebAdmin.OIDC.SuccessURL)
+}
+
+// resolveUser returns the local user of an OIDC login: the user linked to the subject,
+// the user with the verified email address, or a new user if auto-provisioning
+// allows it. On failure it returns the error code for the redirect.
+func (ct OIDCController) resolveUser(ctx context.Context, claims oidc.Claims) (db.User, string) {
+	oc := config.Cfg.WebAdmin.OIDC
+	issuer := ct.Provider.Issuer
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	verified := bool(claims.EmailVerified) && email != ""
+
+	userID, found, err := ct.DB.GetUserIDByIdentity(ctx, issuer, claims.Subject)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		return db.User{}, "db_error"
+	}
+	if !found && verified {
+		u, ok, err := ct.DB.GetUserByEmail(ctx, email)
+		if err != nil {
+			log.Printf("OIDC login failed: %v", err)
+			return db.User{}, "db_error"
+		}
+		userID, found = u.ID, ok
+	}
+	if !found && verified && oc.AutoProvision && emailDomainAllowed(email, oc.AllowedDomains) {
+		if userID, err = ct.provisionUser(ctx, claims, email); err != nil {
+			log.Printf("OIDC login failed, provisioning %s: %v", email, err)
+			return db.User{}, "db_error"
+		}
+		found = true
+	}
+	if !found {
+		log.Printf("OIDC login rejected: no user for subject %q (email %q, verified %t)", claims.Subject, email, verified)
+		return db.User{}, "no_account"
+	}
+
+	u, found, err := ct.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		return db.User{}, "db_error"
+	}
+	if !found {
+		return db.User{}, "no_account"
+	}
+	if err := ct.DB.RecordUserIdentity(ctx, u.ID, issuer, claims.Subject, email); err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		return db.User{}, "db_error"
+	}
+	return u, ""
+}
+
+// provisionUser creates the local user of a first OIDC login. The user gets a random
+// password, so it can only log in through the provider until one is set.
+func (ct OIDCController) provisionUser(ctx context.Context, claims oidc.Claims, email string) (int64, error) {
+	password, err := oidc.RandomString()
+	if err != nil {
+		return 0, err
+	}
+	id, err := users.Create(ctx, ct.DB, users.CreateParams{
+		Email:     email,
+		Password:  password,
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+	})
+	if err != nil {
+		return 0, err
+	}
+	details := map[string]any{"user_id": id, "email": email, "issuer": ct.Provider.Issuer}
+	if err := ct.DB.InsertAuditLog(ctx, db.AuditEntry{Action: db.AuditUserProvision, Details: details}); err != nil {
+		log.Printf("Audit log failed (action=%s): %v", db.AuditUserProvision, err)
+	}
+	log.Printf("OIDC login created user %s", email)
+	return id, nil
+}
+
+// emailDomainAllowed reports whether the domain of email is in domains.
+func emailDomainAllowed(email string, domains []string) bool {
+	_, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return false
+	}
+	return slices.ContainsFunc(domains, func(d string) bool {
+		return strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(d), "@"), domain)
+	})
+}
+
+// redirectError sends the browser back to the success URL with oidc_error set.
+func (ct OIDCController) redirectError(c *gin.Context, code string) {
+	u, err := url.Parse(config.Cfg.WebAdmin.OIDC.SuccessURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": strings.ToUpper(code)})
+		return
+	}
+	q := u.Query()
+	q.Set("oidc_error", code)
+	u.RawQuery = q.Encode()
+	c.Redirect(http.StatusFound, u.String())
+}
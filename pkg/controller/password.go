@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// loginMethodKey is the session value holding how the user logged in.
+const loginMethodKey = "login_method"
+
+type changePasswordRequest struct {
+	CurrentPassword   string `json:"CurrentPassword"`
+	Password          string `json:"Password"`
+	PasswordDuplicate string `json:"PasswordDuplicate"`
+}
+
+// passwordChangeReason returns why u must change the password before using the admin
+// API: PASSWORD_CHANGE_REQUIRED, PASSWORD_EXPIRED, or "" if the password is fine.
+func passwordChangeReason(u db.User) string {
+	if u.MustChangePassword {
+		return "PASSWORD_CHANGE_REQUIRED"
+	}
+	maxAge := config.Cfg.WebAdmin.MaxPasswordAgeDays
+	if maxAge <= 0 {
+		return ""
+	}
+	changedAt := u.PasswordChangedAt
+	if changedAt == 0 {
+		changedAt = u.CreatedAt
+	}
+	if time.Since(time.Unix(changedAt, 0)) > time.Duration(maxAge)*24*time.Hour {
+		return "PASSWORD_EXPIRED"
+	}
+	return ""
+}
+
+// sessionPasswordChangeReason is passwordChangeReason for the user of a session.
+// Sessions of an OpenID Connect login do not depend on the local password.
+func sessionPasswordChangeReason(sess *sessions.Session, u db.User) string {
+	if method, _ := sess.Values[loginMethodKey].(string); method == db.LoginMethodOIDC {
+		return ""
+	}
+	return passwordChangeReason(u)
+}
+
+// invalidPasswordMessage returns the response message of a password rejected by
+// users.ValidatePassword.
+func invalidPasswordMessage(err error) string {
+	switch {
+	case errors.Is(err, users.ErrPasswordRequired):
+		return "MISSING_PASSWORD"
+	case errors.Is(err, users.ErrPasswordTooShort):
+		return "PASSWORD_TOO_SHORT"
+	default:
+		return "INVALID_PASSWORD"
+	}
+}
+
+// newPasswordMessage checks a new password of u and returns the response message if it
+// is rejected, or "".
+func newPasswordMessage(u db.User, password, duplicate string) string {
+	password = strings.TrimSpace(password)
+	if password != strings.TrimSpace(duplicate) {
+		return "PASSWORD_MISMATCH"
+	}
+	if err := users.ValidatePassword(password); err != nil {
+		return invalidPasswordMessage(err)
+	}
+	if same, _ := users.VerifyPassword(password, u.Password); same {
+		return "PASSWORD_UNCHANGED"
+	}
+	return ""
+}
+
+// currentPasswordValid reports whether password is the password of u.
+func currentPasswordValid(u db.User, password string) bool {
+	ok, err := users.VerifyPassword(password, u.Password)
+	return err == nil && ok
+}
+
+// POST /api/auth/change-password
+// Changes the password of the logged-in user. This is the only admin endpoint open to
+// sessions that must change their password.
+func (ct AuthController) PostChangePassword(c *gin.Context) {
+	if ct.DB == nil || ct.DB.SQL == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_NOT_INITIALIZED"})
+		return
+	}
+	if ct.Store == nil || strings.TrimSpace(ct.SessionName) == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "AUTH_NOT_CONFIGURED"})
+		return
+	}
+
+	sess, _ := ct.Store.Get(c.Request, ct.SessionName)
+	if sess == nil || sess.IsNew {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+	userID, ok := sess.Values["id"].(int64)
+	if !ok || userID <= 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+	if !checkCSRF(c, sess) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "CSRF_TOKEN_INVALID"})
+		return
+	}
+
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	u, found, err := ct.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+	if !currentPasswordValid(u, req.CurrentPassword) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "INVALID_CURRENT_PASSWORD"})
+		return
+	}
+	if msg := newPasswordMessage(u, req.Password, req.PasswordDuplicate); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": msg})
+		return
+	}
+
+	hash, err := users.HashPassword(strings.TrimSpace(req.Password), users.DefaultArgon2idParams)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "PASSWORD_HASH_FAILED"})
+		return
+	}
+	if _, err := ct.DB.UpdateUser(ctx, db.User{ID: userID, Password: hash, FirstName: u.FirstName, LastName: u.LastName}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if _, err := ct.DB.SetMustChangePassword(ctx, userID, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	revokeUserSessions(ctx, ct.Store, userID, sess.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "PASSWORD_UPDATED",
+	})
+}
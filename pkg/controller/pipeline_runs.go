@@ -0,0 +1,236 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/pipeline/runs?site_id=<id>&state=<state>&since=..&until=..&limit=..&offset=..
+//
+// Lists the pipeline runs of the sites the user can access, newest first.
+func (ct SitesController) GetRuns(c *gin.Context) {
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	var siteID int64
+	if v := strings.TrimSpace(c.Query("site_id")); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+			return
+		}
+		siteID = id
+	}
+
+	filter := db.RunListFilter{State: strings.TrimSpace(c.Query("state"))}
+	if filter.State != "" && !slices.Contains(db.RunStates, filter.State) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_STATE"})
+		return
+	}
+
+	var valid bool
+	if filter.Since, valid = parseTimeParam(c.Query("since"), false); !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SINCE"})
+		return
+	}
+	if filter.Until, valid = parseTimeParam(c.Query("until"), true); !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_UNTIL"})
+		return
+	}
+	if filter.Since > 0 && filter.Until > 0 && filter.Since > filter.Until {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_RANGE"})
+		return
+	}
+
+	filter.Limit = 20
+	if v := strings.TrimSpace(c.Query("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_LIMIT"})
+			return
+		}
+		filter.Limit = n
+	}
+	if v := strings.TrimSpace(c.Query("offset")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_OFFSET"})
+			return
+		}
+		filter.Offset = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	allowedSiteIDs, err := ct.DB.ListAllowedSiteIDsByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if siteID > 0 {
+		if !slices.Contains(allowedSiteIDs, siteID) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+			return
+		}
+		filter.SiteIDs = []int64{siteID}
+	} else {
+		filter.SiteIDs = allowedSiteIDs
+	}
+
+	count, err := ct.DB.CountRuns(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	runs, err := ct.DB.ListRuns(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"items":   runs,
+		"count":   count,
+		"limit":   filter.Limit,
+		"offset":  filter.Offset,
+	})
+}
+
+// GET /api/pipeline/runs/:id
+//
+// Returns a pipeline run.
+func (ct SitesController) GetRun(c *gin.Context) {
+	run, _, ok := ct.loadRun(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "run": run})
+}
+
+// POST /api/pipeline/runs/:id/retry
+//
+// Starts a failed, retrying or cancelled run again right away.
+func (ct SitesController) PostRunRetry(c *gin.Context) {
+	run, userID, ok := ct.loadRun(c)
+	if !ok {
+		return
+	}
+	if ct.Enqueuer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "message": "PIPELINE_NOT_CONFIGURED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	changed, err := ct.DB.RequeueRun(ctx, run.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !changed {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "RUN_NOT_RETRYABLE"})
+		return
+	}
+
+	if err := ct.DB.InsertAuditLog(ctx, db.AuditEntry{UserID: userID, SiteID: run.SiteID, Action: db.AuditRunRetry, Details: map[string]any{"run_id": run.ID}}); err != nil {
+		log.Printf("Audit log failed (site=%s action=%s): %v", run.SiteKey, db.AuditRunRetry, err)
+	}
+
+	if err := ct.Enqueuer.EnqueueRun(run.ID, run.SiteKey, run.TriggerCommentID); err != nil {
+		log.Printf("Enqueue retried run failed (site=%s run_id=%d): %v", run.SiteKey, run.ID, err)
+		_ = ct.DB.MarkRunFailed(run.ID, "enqueue", err.Error())
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "message": "PIPELINE_ENQUEUE_FAILED"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "run_id": run.ID, "state": db.RunQueued})
+}
+
+// POST /api/pipeline/runs/:id/cancel
+//
+// Cancels a run that has not started yet (queued, paused or retrying) and no other
+// run was coalesced into.
+func (ct SitesController) PostRunCancel(c *gin.Context) {
+	run, userID, ok := ct.loadRun(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	changed, err := ct.DB.CancelRun(ctx, run.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !changed {
+		// Cancelling a run that covers coalesced runs would drop their changes.
+		if n, err := ct.DB.CountCoalescedRuns(ctx, run.ID); err == nil && n > 0 {
+			c.JSON(http.StatusConflict, gin.H{"success": false, "message": "RUN_HAS_COALESCED_RUNS"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "RUN_NOT_CANCELLABLE"})
+		return
+	}
+
+	if err := ct.DB.InsertAuditLog(ctx, db.AuditEntry{UserID: userID, SiteID: run.SiteID, Action: db.AuditRunCancel, Details: map[string]any{"run_id": run.ID}}); err != nil {
+		log.Printf("Audit log failed (site=%s action=%s): %v", run.SiteKey, db.AuditRunCancel, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "run_id": run.ID, "state": db.RunCancelled})
+}
+
+// loadRun loads the run of the :id parameter. Runs of sites the user cannot access
+// are reported as not found. On failure the response is written and ok is false.
+func (ct SitesController) loadRun(c *gin.Context) (run db.Run, userID int64, ok bool) {
+	userID, ok = ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return run, 0, false
+	}
+
+	runID, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || runID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_RUN_ID"})
+		return run, 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	run, found, err := ct.DB.GetRun(ctx, runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return run, 0, false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return run, 0, false
+	}
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, run.SiteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return run, 0, false
+	}
+	if !hasAccess {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return run, 0, false
+	}
+	return run, userID, true
+}
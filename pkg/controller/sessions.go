@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// sessionManager is implemented by server-side session stores.
+type sessionManager interface {
+	userSessionRevoker
+	ListUser(ctx context.Context, userID int64) ([]db.Session, error)
+	Revoke(ctx context.Context, userID int64, id string) (bool, error)
+}
+
+// sessionItem is a session in API responses. Session IDs are credentials, so sessions
+// are identified by a hash of the ID.
+type sessionItem struct {
+	ID         string `json:"ID"`
+	IP         string `json:"IP"`
+	UserAgent  string `json:"UserAgent"`
+	CreatedAt  int64  `json:"CreatedAt"`
+	LastSeenAt int64  `json:"LastSeenAt"`
+	ExpiresAt  int64  `json:"ExpiresAt"`
+	Current    bool   `json:"Current"`
+}
+
+type sessionRevokeRequest struct {
+	UserID int64  `json:"UserID"` // 0 = current user
+	ID     string `json:"ID"`
+	All    bool   `json:"All"` // all sessions except the current one
+}
+
+// sessionHandle returns the identifier of a session in API responses.
+func sessionHandle(id string) string {
+	return hashAPIToken(id)[:32]
+}
+
+// sessionTarget returns the session manager, the current session ID and the user whose
+// sessions are requested: the current user or, if given, userID.
+func (ct AuthController) sessionTarget(ctx context.Context, c *gin.Context, userID int64) (sessionManager, string, int64, bool) {
+	mgr, ok := ct.Store.(sessionManager)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"success": false, "message": "SESSION_STORE_REQUIRED"})
+		return nil, "", 0, false
+	}
+	currentID := ""
+	if sess, _ := ct.Store.Get(c.Request, ct.SessionName); sess != nil {
+		currentID = sess.ID
+	}
+	if userID == 0 {
+		id, ok := currentUserID(c, ct.Store, ct.SessionName)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+			return nil, "", 0, false
+		}
+		return mgr, currentID, id, true
+	}
+	_, found, err := ct.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return nil, "", 0, false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "USER_NOT_FOUND"})
+		return nil, "", 0, false
+	}
+	return mgr, currentID, userID, true
+}
+
+// GET /api/auth/sessions?user_id=...
+// Lists the active sessions of the current user, or of user_id.
+func (ct AuthController) GetSessions(c *gin.Context) {
+	var userID int64
+	if raw := strings.TrimSpace(c.Query("user_id")); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_USER_ID"})
+			return
+		}
+		userID = id
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mgr, currentID, userID, ok := ct.sessionTarget(ctx, c, userID)
+	if !ok {
+		return
+	}
+	list, err := mgr.ListUser(ctx, userID)
+	if err != nil {
+		log.Printf("List sessions of user %d failed: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "SESSION_STORE_ERROR"})
+		return
+	}
+
+	items := make([]sessionItem, 0, len(list))
+	for _, s := range list {
+		items = append(items, sessionItem{
+			ID:         sessionHandle(s.ID),
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"user_id": userID,
+		"items":   items,
+	})
+}
+
+// POST /api/auth/sessions/revoke
+// Ends the session ID of the current user (or UserID), or with All every session but
+// the current one.
+func (ct AuthController) PostRevokeSessions(c *gin.Context) {
+	var req sessionRevokeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+	handle := strings.TrimSpace(req.ID)
+	if req.UserID < 0 || (handle == "") == !req.All {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_REQUEST"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mgr, currentID, userID, ok := ct.sessionTarget(ctx, c, req.UserID)
+	if !ok {
+		return
+	}
+
+	var revoked int64
+	if req.All {
+		n, err := mgr.RevokeUser(ctx, userID, currentID)
+		if err != nil {
+			log.Printf("Revoke sessions of user %d failed: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "SESSION_STORE_ERROR"})
+			return
+		}
+		revoked = n
+	} else {
+		list, err := mgr.ListUser(ctx, userID)
+		if err != nil {
+			log.Printf("List sessions of user %d failed: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "SESSION_STORE_ERROR"})
+			return
+		}
+		for _, s := range list {
+			if sessionHandle(s.ID) != handle {
+				continue
+			}
+			ok, err := mgr.Revoke(ctx, userID, s.ID)
+			if err != nil {
+				log.Printf("Revoke session of user %d failed: %v", userID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "SESSION_STORE_ERROR"})
+				return
+			}
+			if ok {
+				revoked = 1
+			}
+			break
+		}
+		if revoked == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "SESSION_NOT_FOUND"})
+			return
+		}
+	}
+
+	actorID, _ := currentUserID(c, ct.Store, ct.SessionName)
+	details := map[string]any{"user_id": userID, "count": revoked}
+	if err := ct.DB.InsertAuditLog(ctx, db.AuditEntry{UserID: actorID, Action: db.AuditSessionRevoke, Details: details}); err != nil {
+		log.Printf("Audit log failed (action=%s): %v", db.AuditSessionRevoke, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "SESSIONS_REVOKED",
+		"revoked": revoked,
+	})
+}
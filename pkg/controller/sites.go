@@ -3,11 +3,8 @@
 import (
 	"context"
 	"net/http"
-	"strings"
 	"time"
 
-	"github.com/geschke/fyndmark/config"
-	"github.com/geschke/fyndmark/pkg/cors"
 	"github.com/geschke/fyndmark/pkg/db"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
@@ -17,70 +14,26 @@ type SitesController struct {
 	DB          *db.DB
 	Store       sessions.Store
 	SessionName string
+	Enqueuer    PipelineEnqueuer
 }
 
 // NewSitesController constructs and returns a new instance.
-func NewSitesController(database *db.DB, store sessions.Store, sessionName string) *SitesController {
+func NewSitesController(database *db.DB, store sessions.Store, sessionName string, enqueuer PipelineEnqueuer) *SitesController {
 	return &SitesController{
 		DB:          database,
 		Store:       store,
 		SessionName: sessionName,
+		Enqueuer:    enqueuer,
 	}
 }
 
-// Options handles the CORS preflight request.
-func (ct SitesController) Options(c *gin.Context) {
-	_ = cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins)
-}
-
-// ensureAuthorized performs its package-specific operation.
-func (ct SitesController) ensureAuthorized(c *gin.Context) bool {
-	if ct.DB == nil || ct.DB.SQL == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_NOT_INITIALIZED"})
-		return false
-	}
-	if ct.Store == nil || strings.TrimSpace(ct.SessionName) == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "AUTH_NOT_CONFIGURED"})
-		return false
-	}
-	sess, _ := ct.Store.Get(c.Request, ct.SessionName)
-	if sess == nil || sess.IsNew {
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
-		return false
-	}
-	if _, ok := sess.Values["id"]; !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
-		return false
-	}
-	return true
-}
-
-// currentSessionUserID performs its package-specific operation.
+// currentSessionUserID returns the authenticated user, see currentUserID.
 func (ct SitesController) currentSessionUserID(c *gin.Context) (int64, bool) {
-	sess, _ := ct.Store.Get(c.Request, ct.SessionName)
-	if sess == nil {
-		return 0, false
-	}
-	raw, ok := sess.Values["id"]
-	if !ok {
-		return 0, false
-	}
-	id, ok := raw.(int64)
-	if !ok {
-		return 0, false
-	}
-	return id, true
+	return currentUserID(c, ct.Store, ct.SessionName)
 }
 
 // GET /api/sites
 func (ct SitesController) GetList(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-	if !ct.ensureAuthorized(c) {
-		return
-	}
-
 	userID, ok := ct.currentSessionUserID(c)
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
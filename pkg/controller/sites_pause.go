@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// POST /api/sites/:id/pipeline/pause
+//
+// Pauses the pipeline of a site: approvals keep queueing runs, but they are held
+// back (state paused) until the pipeline is resumed.
+func (ct SitesController) PostPipelinePause(c *gin.Context) {
+	ct.setPipelinePaused(c, true)
+}
+
+// POST /api/sites/:id/pipeline/resume
+//
+// Resumes the pipeline of a site and starts the newest held-back run; older held runs
+// are coalesced into it.
+func (ct SitesController) PostPipelineResume(c *gin.Context) {
+	ct.setPipelinePaused(c, false)
+}
+
+// setPipelinePaused implements the pause and resume endpoints.
+func (ct SitesController) setPipelinePaused(c *gin.Context, paused bool) {
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	siteID, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || siteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, siteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+
+	site, found, err := ct.DB.GetSiteByID(ctx, siteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+
+	changed, err := ct.DB.SetPipelinePaused(ctx, siteID, paused)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	resp := gin.H{
+		"success": true,
+		"site_id": siteID,
+		"paused":  paused,
+		"changed": changed,
+	}
+
+	action := db.AuditPipelinePause
+	if !paused {
+		action = db.AuditPipelineResume
+		// Runs held back while the pipeline was paused are released now.
+		if runID, released, err := ct.releasePausedRun(ctx, siteID, site.SiteKey); err != nil {
+			resp["warning"] = "pipeline_enqueue_failed"
+		} else if released {
+			resp["released_run_id"] = runID
+		}
+	}
+
+	if changed {
+		if err := ct.DB.InsertAuditLog(ctx, db.AuditEntry{UserID: userID, SiteID: siteID, Action: action}); err != nil {
+			log.Printf("Audit log failed (site=%s action=%s): %v", site.SiteKey, action, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// releasePausedRun queues the newest held-back run of a site.
+func (ct SitesController) releasePausedRun(ctx context.Context, siteID int64, siteKey string) (int64, bool, error) {
+	runID, released, err := ct.DB.ReleasePausedRuns(ctx, siteID)
+	if err != nil || !released {
+		return 0, false, err
+	}
+	if ct.Enqueuer == nil {
+		return runID, true, nil
+	}
+	if err := ct.Enqueuer.EnqueueRun(runID, siteKey, ""); err != nil {
+		log.Printf("Enqueue released run failed (site=%s run_id=%d): %v", siteKey, runID, err)
+		_ = ct.DB.MarkRunFailed(runID, "enqueue", err.Error())
+		return 0, false, err
+	}
+	return runID, true, nil
+}
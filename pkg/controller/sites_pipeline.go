@@ -0,0 +1,272 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/git"
+	"github.com/geschke/fyndmark/pkg/hugo"
+	"github.com/geschke/fyndmark/pkg/pipeline"
+	"github.com/geschke/fyndmark/pkg/publish"
+	"github.com/geschke/fyndmark/pkg/runlog"
+	"github.com/geschke/fyndmark/pkg/secrets"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/sites/:id/pipeline-config
+//
+// Returns the effective pipeline settings of a site with all secrets masked.
+func (ct SitesController) GetPipelineConfig(c *gin.Context) {
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	siteID, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || siteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, siteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+
+	site, found, err := ct.DB.GetSiteByID(ctx, siteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+
+	siteCfg, ok := config.Cfg.CommentSites[site.SiteKey]
+	if !ok {
+		// The site exists in the database but was removed from the configuration.
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "SITE_NOT_CONFIGURED"})
+		return
+	}
+
+	pausedRuns, err := ct.DB.CountPausedRuns(ctx, siteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"site_id":     siteID,
+		"site_key":    site.SiteKey,
+		"pipeline":    effectivePipelineConfig(site.SiteKey, siteCfg),
+		"paused":      site.PipelinePausedAt != 0,
+		"paused_at":   site.PipelinePausedAt,
+		"paused_runs": pausedRuns,
+	})
+}
+
+// effectivePipelineConfig returns the pipeline settings of a site as they are used by
+// the pipeline, including defaults. Tokens and URL credentials are masked.
+func effectivePipelineConfig(siteKey string, siteCfg config.CommentsSiteConfig) gin.H {
+	gc := siteCfg.Git
+
+	cloneDir, err := git.ResolveWorkdir(siteKey)
+	if err != nil {
+		cloneDir = ""
+	}
+
+	themes := make([]gin.H, 0, len(gc.Themes))
+	for _, t := range gc.Themes {
+		themes = append(themes, gin.H{
+			"name":               strings.TrimSpace(t.Name),
+			"repo_url":           runlog.Redact(strings.TrimSpace(t.RepoURL)),
+			"branch":             strings.TrimSpace(t.Branch),
+			"target_path":        strings.TrimSpace(t.TargetPath),
+			"depth":              t.Depth,
+			"revision":           strings.TrimSpace(t.Revision),
+			"access_token":       secrets.Redact(t.AccessToken),
+			"token_username":     git.TokenUsername(t.RepoURL, t.TokenUsername, ""),
+			"recurse_submodules": t.RecurseSubmodules,
+		})
+	}
+
+	hugoArgs := make([]string, 0, len(siteCfg.Hugo.Args))
+	for _, arg := range siteCfg.Hugo.Args {
+		hugoArgs = append(hugoArgs, redactArg(arg))
+	}
+	hugoEnv := make([]string, 0, len(siteCfg.Hugo.Env))
+	for k := range siteCfg.Hugo.Env {
+		hugoEnv = append(hugoEnv, k)
+	}
+	sort.Strings(hugoEnv)
+
+	commands := make([]gin.H, 0, len(siteCfg.Pipeline.Commands))
+	for _, cmd := range siteCfg.Pipeline.Commands {
+		// Arguments and environment values may hold secrets, so only names are shown.
+		envNames := make([]string, 0, len(cmd.Env))
+		for k := range cmd.Env {
+			envNames = append(envNames, k)
+		}
+		sort.Strings(envNames)
+		commands = append(commands, gin.H{
+			"name":            strings.TrimSpace(cmd.Name),
+			"stage":           strings.TrimSpace(cmd.Stage),
+			"bin":             strings.TrimSpace(cmd.Command[0]),
+			"dir":             strings.TrimSpace(cmd.Dir),
+			"env":             envNames,
+			"timeout_seconds": int(pipeline.CommandTimeout(cmd) / time.Second),
+			"allow_failure":   cmd.AllowFailure,
+		})
+	}
+
+	sandboxed := map[string]bool{}
+	if sb := config.Cfg.Sandbox; sb.Enabled {
+		if len(sb.Commands) == 0 {
+			sandboxed["git"], sandboxed["hugo"], sandboxed["command"] = true, true, true
+		}
+		for _, cmd := range sb.Commands {
+			sandboxed[strings.ToLower(strings.TrimSpace(cmd))] = true
+		}
+	}
+
+	return gin.H{
+		"git": gin.H{
+			"repo_url": runlog.Redact(strings.TrimSpace(gc.RepoURL)),
+			// An empty branch means the default branch of the remote.
+			"branch":             strings.TrimSpace(gc.Branch),
+			"depth":              gc.Depth,
+			"min_revision":       strings.TrimSpace(gc.MinRevision),
+			"recurse_submodules": gc.RecurseSubmodules,
+			"checkout_mode":      git.CheckoutModeOf(gc),
+			"author_name":        strings.TrimSpace(gc.AuthorName),
+			"author_email":       strings.TrimSpace(gc.AuthorEmail),
+			"commit_message":     strings.TrimSpace(gc.CommitMessage),
+			"push_retries":       git.PushRetries(gc),
+			"pull_request":       pullRequestSettings(gc),
+			// The passphrase is never returned.
+			"signing": gin.H{
+				"format": strings.TrimSpace(gc.Signing.Format),
+				"key":    strings.TrimSpace(gc.Signing.Key),
+			},
+			"access_token":           secrets.Redact(gc.AccessToken),
+			"access_token_encrypted": secrets.IsEncrypted(gc.AccessToken),
+			"token_username":         git.TokenUsername(gc.RepoURL, gc.TokenUsername, gc.PullRequest.Provider),
+			"clone_dir":              cloneDir,
+			"themes":                 themes,
+		},
+		"hugo": gin.H{
+			"enabled":         !siteCfg.Hugo.Disabled,
+			"bin":             hugo.Bin(siteCfg.Hugo),
+			"args":            hugoArgs,
+			"env":             hugoEnv,
+			"timeout_seconds": int(pipeline.HugoTimeout(siteCfg) / time.Second),
+			"min_version":     strings.TrimSpace(siteCfg.Hugo.MinVersion),
+			"version":         strings.TrimSpace(siteCfg.Hugo.Version),
+			"extended":        siteCfg.Hugo.Extended,
+		},
+		"limits": gin.H{
+			"cooldown_seconds": siteCfg.Pipeline.CooldownSeconds,
+			"daily_budget":     siteCfg.Pipeline.DailyBudget,
+			"debounce_seconds": siteCfg.Pipeline.DebounceSeconds,
+			"min_free_mb":      siteCfg.Pipeline.MinFreeMB,
+			"max_workdir_mb":   siteCfg.Pipeline.MaxWorkdirMB,
+		},
+		"timeouts": gin.H{
+			"checkout_seconds": int(pipeline.StepTimeout(siteCfg.Pipeline, pipeline.StepCheckout) / time.Second),
+			"generate_seconds": int(pipeline.StepTimeout(siteCfg.Pipeline, pipeline.StepGenerate) / time.Second),
+			"hugo_seconds":     int(pipeline.HugoTimeout(siteCfg) / time.Second),
+			"commit_seconds":   int(pipeline.StepTimeout(siteCfg.Pipeline, pipeline.StepCommit) / time.Second),
+			"push_seconds":     int(pipeline.StepTimeout(siteCfg.Pipeline, pipeline.StepPush) / time.Second),
+			"deploy_seconds":   int(pipeline.StepTimeout(siteCfg.Pipeline, pipeline.StepDeploy) / time.Second),
+			"publish_seconds":  int(pipeline.StepTimeout(siteCfg.Pipeline, pipeline.StepPublish) / time.Second),
+		},
+		"push":     pipeline.PushEnabled(siteCfg.Pipeline),
+		"commands": commands,
+		"publish":  publishSettings(siteCfg.Pipeline.Publish),
+		"deploy_hook": gin.H{
+			"enabled":   strings.TrimSpace(siteCfg.Pipeline.DeployHook.URL) != "",
+			"method":    deployHookMethod(siteCfg.Pipeline.DeployHook),
+			"encrypted": secrets.IsEncrypted(siteCfg.Pipeline.DeployHook.URL),
+		},
+		"retention": gin.H{
+			"keep_runs": siteCfg.Pipeline.Retention.KeepRuns,
+			"keep_days": siteCfg.Pipeline.Retention.KeepDays,
+		},
+		"retry": gin.H{
+			"max_attempts":          max(siteCfg.Pipeline.MaxAttempts, 1),
+			"retry_backoff_seconds": int(pipeline.RetryBackoff(siteCfg.Pipeline, 1) / time.Second),
+		},
+		"sandbox": gin.H{
+			"git":     sandboxed["git"],
+			"hugo":    sandboxed["hugo"],
+			"command": sandboxed["command"],
+		},
+	}
+}
+
+// redactArg masks URL credentials and encrypted values in a command line argument.
+func redactArg(arg string) string {
+	if strings.Contains(arg, secrets.Prefix) {
+		return secrets.Redact(arg)
+	}
+	return runlog.Redact(arg)
+}
+
+// pullRequestSettings returns the effective pull request settings of a site. Provider
+// and API URL are empty if they cannot be determined.
+func pullRequestSettings(gc config.GitConfig) gin.H {
+	provider, apiURL, _, _ := git.PullRequestAPI(gc)
+	return gin.H{
+		"enabled":       git.PullRequestsEnabled(gc),
+		"provider":      provider,
+		"api_url":       runlog.Redact(apiURL),
+		"branch_prefix": git.BranchPrefix(gc),
+	}
+}
+
+// publishSettings describes the publish step of a site; credentials are never returned.
+func publishSettings(pc config.PublishConfig) gin.H {
+	if !publish.Enabled(pc) {
+		return gin.H{"enabled": false}
+	}
+	out := gin.H{
+		"enabled": true,
+		"type":    strings.TrimSpace(pc.Type),
+		"dir":     publish.Dir(pc),
+		"delete":  pc.Delete,
+	}
+	switch strings.TrimSpace(pc.Type) {
+	case publish.TypeRsync:
+		out["target"] = strings.TrimSpace(pc.Rsync.Target)
+	case publish.TypeS3:
+		out["bucket"] = strings.TrimSpace(pc.S3.Bucket)
+		out["prefix"] = strings.TrimSpace(pc.S3.Prefix)
+		out["region"] = strings.TrimSpace(pc.S3.Region)
+		out["endpoint"] = strings.TrimSpace(pc.S3.Endpoint)
+	}
+	return out
+}
+
+// deployHookMethod returns the effective HTTP method of a deploy hook.
+func deployHookMethod(hook config.DeployHookConfig) string {
+	if m := strings.ToUpper(strings.TrimSpace(hook.Method)); m != "" {
+		return m
+	}
+	return http.MethodPost
+}
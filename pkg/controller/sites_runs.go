@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/sites/:id/runs/:run_id/files
+//
+// Returns the comment files the generator created, updated or removed in a pipeline run.
+func (ct SitesController) GetRunFiles(c *gin.Context) {
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	siteID, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || siteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+		return
+	}
+	runID, err := strconv.ParseInt(strings.TrimSpace(c.Param("run_id")), 10, 64)
+	if err != nil || runID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_RUN_ID"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, siteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+
+	files, found, err := ct.DB.ListRunFiles(ctx, siteID, runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"site_id": siteID,
+		"run_id":  runID,
+		"files":   files,
+	})
+}
+
+// GET /api/pipeline/runs/:id/logs
+//
+// Returns the captured git and Hugo output of a pipeline run, per step in the order it
+// was written. With ?step=<name> only that step is returned, with ?format=text the log
+// is returned as plain text.
+func (ct SitesController) GetRunLogs(c *gin.Context) {
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	runID, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || runID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_RUN_ID"})
+		return
+	}
+	step := strings.TrimSpace(c.Query("step"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	siteID, found, err := ct.DB.GetRunSiteID(ctx, runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, userID, siteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		// Do not reveal runs of other sites.
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+
+	chunks, err := ct.DB.ListRunLogs(ctx, runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	logs := make([]db.RunLogChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if step == "" || chunk.Step == step {
+			logs = append(logs, chunk)
+		}
+	}
+
+	if c.Query("format") == "text" {
+		var b strings.Builder
+		current := ""
+		for _, chunk := range logs {
+			if chunk.Step != current {
+				current = chunk.Step
+				fmt.Fprintf(&b, "==> %s\n", current)
+			}
+			b.WriteString(chunk.Content)
+			if !strings.HasSuffix(chunk.Content, "\n") {
+				b.WriteString("\n")
+			}
+		}
+		c.String(http.StatusOK, b.String())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"site_id": siteID,
+		"run_id":  runID,
+		"logs":    logs,
+	})
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/generator"
+	"github.com/geschke/fyndmark/pkg/mailer"
+)
+
+// summaryTopPosts is the number of posts listed in the weekly summary.
+const summaryTopPosts = 5
+
+// SendWeeklySummaries mails the weekly summary of every site whose send time has passed
+// since the last summary. It is called periodically; each period is sent only once.
+func SendWeeklySummaries(ctx context.Context, database *db.DB) {
+	now := time.Now()
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		if !siteCfg.Summary.Enabled {
+			continue
+		}
+		periodEnd, err := lastSummaryTime(siteCfg, now)
+		if err != nil {
+			log.Printf("Weekly summary skipped (site=%s): %v", siteKey, err)
+			continue
+		}
+
+		siteID, found, err := database.GetSiteIDByKey(ctx, siteKey)
+		if err != nil || !found {
+			continue
+		}
+		claimed, err := database.ClaimSummary(ctx, siteID, periodEnd.Unix())
+		if err != nil {
+			log.Printf("Weekly summary claim failed (site=%s): %v", siteKey, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		periodStart := periodEnd.AddDate(0, 0, -7)
+		stats, err := database.SiteStats(ctx, siteID, periodStart.Unix(), periodEnd.Unix(), summaryTopPosts)
+		if err != nil {
+			log.Printf("Weekly summary stats failed (site=%s): %v", siteKey, err)
+			continue
+		}
+
+		subject, body := generator.BuildSummaryMail(generator.SummaryMailInput{
+			SiteID:    siteKey,
+			SiteTitle: siteCfg.Title,
+			From:      periodStart,
+			Until:     periodEnd,
+			Stats:     stats,
+		})
+		if err := mailer.SendTextMail(siteCfg.AdminRecipients, subject, body); err != nil {
+			log.Printf("Failed to send weekly summary (site=%s): %v", siteKey, err)
+			continue
+		}
+		log.Printf("Weekly summary sent (site=%s period_end=%s)", siteKey, periodEnd.Format(time.RFC3339))
+	}
+}
+
+// lastSummaryTime returns the most recent configured send time at or before now,
+// in the site's timezone.
+func lastSummaryTime(siteCfg config.CommentsSiteConfig, now time.Time) (time.Time, error) {
+	loc := time.UTC
+	if tz := strings.TrimSpace(siteCfg.Timezone); tz != "" && !strings.EqualFold(tz, "utc") {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc = l
+	}
+	weekday, _ := config.ParseWeekday(siteCfg.Summary.Weekday)
+
+	now = now.In(loc)
+	t := time.Date(now.Year(), now.Month(), now.Day(), siteCfg.Summary.Hour, 0, 0, 0, loc)
+	t = t.AddDate(0, 0, -((int(now.Weekday()) - int(weekday) + 7) % 7))
+	if t.After(now) {
+		t = t.AddDate(0, 0, -7)
+	}
+	return t, nil
+}
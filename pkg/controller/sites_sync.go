@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /api/admin/sync-status
+//
+// Returns the result of the site sync performed at startup, limited to the sites
+// the current user may access.
+func (ct SitesController) GetSyncStatus(c *gin.Context) {
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	summary, ok := ct.DB.LastSyncSummary()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_SYNCED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sites, err := ct.DB.ListSitesByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	allowed := make(map[string]bool, len(sites))
+	for _, s := range sites {
+		allowed[s.SiteKey] = true
+	}
+	filter := func(keys []string) []string {
+		out := make([]string, 0, len(keys))
+		for _, k := range keys {
+			if allowed[k] {
+				out = append(out, k)
+			}
+		}
+		return out
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"synced_at":    summary.SyncedAt,
+		"keep_missing": config.Cfg.SiteSync.KeepMissing,
+		"inserted":     filter(summary.Inserted),
+		"enabled":      filter(summary.Enabled),
+		"disabled":     filter(summary.Disabled),
+		"unchanged":    filter(summary.Unchanged),
+		"missing":      filter(summary.Missing),
+	})
+}
@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// Scopes of API tokens. A token without scopes may use all of them.
+const (
+	ScopeComments  = "comments"  // comment moderation and export
+	ScopeBlocklist = "blocklist" // blocklist entries
+	ScopePipeline  = "pipeline"  // sites, pipeline runs and sync status
+	ScopeUsers     = "users"     // user management
+)
+
+// TokenScopes lists all API token scopes.
+var TokenScopes = []string{ScopeComments, ScopeBlocklist, ScopePipeline, ScopeUsers}
+
+// apiTokenPrefix starts every API token, so leaked tokens are easy to recognize.
+const apiTokenPrefix = "fym_"
+
+// maxTokenExpiryDays limits ExpiresInDays of new tokens.
+const maxTokenExpiryDays = 3650
+
+type TokensController struct {
+	DB          *db.DB
+	Store       sessions.Store
+	SessionName string
+}
+
+type tokenAddRequest struct {
+	Name          string   `json:"Name"`
+	Scopes        []string `json:"Scopes"`
+	ExpiresInDays int      `json:"ExpiresInDays"` // 0 = never
+}
+
+// NewTokensController constructs and returns a new instance.
+func NewTokensController(database *db.DB, store sessions.Store, sessionName string) *TokensController {
+	return &TokensController{
+		DB:          database,
+		Store:       store,
+		SessionName: sessionName,
+	}
+}
+
+// newAPIToken returns a random API token.
+func newAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// normalizeScopes validates and deduplicates token scopes.
+func normalizeScopes(scopes []string) ([]string, bool) {
+	out := []string{}
+	for _, s := range scopes {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if !containsString(TokenScopes, s) {
+			return nil, false
+		}
+		if !containsString(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out, true
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /api/tokens/list
+func (ct TokensController) GetList(c *gin.Context) {
+	userID, ok := currentUserID(c, ct.Store, ct.SessionName)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	items, err := ct.DB.ListAPITokensByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"items":   items,
+		"scopes":  TokenScopes,
+	})
+}
+
+// POST /api/tokens/add
+// The token is only returned in this response.
+func (ct TokensController) PostAdd(c *gin.Context) {
+	var req tokenAddRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_NAME"})
+		return
+	}
+	scopes, ok := normalizeScopes(req.Scopes)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SCOPE"})
+		return
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxTokenExpiryDays {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_EXPIRY"})
+		return
+	}
+
+	userID, ok := currentUserID(c, ct.Store, ct.SessionName)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	token, err := newAPIToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "TOKEN_GENERATION_FAILED"})
+		return
+	}
+	t := db.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:len(apiTokenPrefix)+6],
+		Scopes:    scopes,
+		TokenHash: hashAPIToken(token),
+	}
+	if req.ExpiresInDays > 0 {
+		t.ExpiresAt = time.Now().AddDate(0, 0, req.ExpiresInDays).Unix()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := ct.DB.CreateAPIToken(ctx, t)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if err := ct.DB.InsertAuditLog(ctx, db.AuditEntry{UserID: userID, Action: db.AuditTokenCreate, Details: map[string]any{"token_id": id, "name": name, "scopes": scopes}}); err != nil {
+		log.Printf("Audit log failed (action=%s): %v", db.AuditTokenCreate, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"id":      id,
+		"token":   token,
+	})
+}
+
+// POST /api/tokens/revoke/:id
+func (ct TokensController) PostRevoke(c *gin.Context) {
+	id, err := strconv.ParseInt(strings.TrimSpace(c.Param("id")), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_ID"})
+		return
+	}
+
+	userID, ok := currentUserID(c, ct.Store, ct.SessionName)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	revoked, err := ct.DB.RevokeAPIToken(ctx, userID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "NOT_FOUND"})
+		return
+	}
+	if err := ct.DB.InsertAuditLog(ctx, db.AuditEntry{UserID: userID, Action: db.AuditTokenRevoke, Details: map[string]any{"token_id": id}}); err != nil {
+		log.Printf("Audit log failed (action=%s): %v", db.AuditTokenRevoke, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "TOKEN_REVOKED",
+	})
+}
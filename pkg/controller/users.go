@@ -2,14 +2,12 @@
 
 import (
 	"context"
-	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/geschke/fyndmark/config"
-	"github.com/geschke/fyndmark/pkg/cors"
 	"github.com/geschke/fyndmark/pkg/db"
 	"github.com/geschke/fyndmark/pkg/users"
 	"github.com/gin-gonic/gin"
@@ -31,70 +29,43 @@ func NewUsersController(database *db.DB, store sessions.Store, sessionName strin
 	}
 }
 
-// Options handles the CORS preflight request.
-func (ct UsersController) Options(c *gin.Context) {
-	// Allow preflight for browser-based clients.
-	_ = cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins)
-}
-
 type updateUserRequest struct {
-	Email     *string `json:"Email"`
-	FirstName *string `json:"FirstName"`
-	LastName  *string `json:"LastName"`
+	Email              *string `json:"Email"`
+	FirstName          *string `json:"FirstName"`
+	LastName           *string `json:"LastName"`
+	MustChangePassword *bool   `json:"MustChangePassword"`
 }
 
 type addUserRequest struct {
-	Email           string `json:"Email"`
-	Password        string `json:"Password"`
-	PasswordConfirm string `json:"PasswordConfirm"`
-	FirstName       string `json:"FirstName"`
-	LastName        string `json:"LastName"`
+	Email              string `json:"Email"`
+	Password           string `json:"Password"`
+	PasswordConfirm    string `json:"PasswordConfirm"`
+	FirstName          string `json:"FirstName"`
+	LastName           string `json:"LastName"`
+	MustChangePassword bool   `json:"MustChangePassword"`
 }
 
-type updatePasswordRequest struct {
+type updateMeRequest struct {
+	Email     *string `json:"Email"`
+	FirstName *string `json:"FirstName"`
+	LastName  *string `json:"LastName"`
+	// CurrentPassword is required to change the email address or the password.
+	CurrentPassword   string `json:"CurrentPassword"`
 	Password          string `json:"Password"`
 	PasswordDuplicate string `json:"PasswordDuplicate"`
 }
 
-// ensureAuthorized performs its package-specific operation.
-func (ct UsersController) ensureAuthorized(c *gin.Context) bool {
-	if ct.DB == nil || ct.DB.SQL == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_NOT_INITIALIZED"})
-		return false
-	}
-	if ct.Store == nil || strings.TrimSpace(ct.SessionName) == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "AUTH_NOT_CONFIGURED"})
-		return false
-	}
-
-	sess, _ := ct.Store.Get(c.Request, ct.SessionName)
-	if sess == nil || sess.IsNew {
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
-		return false
-	}
-	if _, ok := sess.Values["id"]; !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
-		return false
-	}
-
-	return true
+type updatePasswordRequest struct {
+	Password          string `json:"Password"`
+	PasswordDuplicate string `json:"PasswordDuplicate"`
+	// MustChangePassword overrides the default: set when resetting the password of
+	// another user, cleared when changing the own password.
+	MustChangePassword *bool `json:"MustChangePassword"`
 }
 
-// currentSessionUserID performs its package-specific operation.
+// currentSessionUserID returns the authenticated user, see currentUserID.
 func (ct UsersController) currentSessionUserID(c *gin.Context) (int64, bool) {
-	sess, _ := ct.Store.Get(c.Request, ct.SessionName)
-	if sess == nil {
-		return 0, false
-	}
-	raw, ok := sess.Values["id"]
-	if !ok {
-		return 0, false
-	}
-	id, ok := raw.(int64)
-	if !ok {
-		return 0, false
-	}
-	return id, true
+	return currentUserID(c, ct.Store, ct.SessionName)
 }
 
 // parseUserID performs its package-specific operation.
@@ -109,14 +80,6 @@ func parseUserID(c *gin.Context) (int64, bool) {
 
 // GET /api/users/list
 func (ct UsersController) GetList(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-
-	if !ct.ensureAuthorized(c) {
-		return
-	}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -138,49 +101,207 @@ func (ct UsersController) GetList(c *gin.Context) {
 
 // GET /api/users/:id
 func (ct UsersController) GetByID(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
+	id, ok := parseUserID(c)
+	if !ok {
 		return
 	}
 
-	if !ct.ensureAuthorized(c) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	item, found, err := ct.DB.GetUserByID(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "USER_NOT_FOUND"})
 		return
 	}
 
-	id, ok := parseUserID(c)
+	item.Password = ""
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"item":    item,
+	})
+}
+
+// GET /api/users/me
+// Returns the profile of the logged-in user.
+func (ct UsersController) GetMe(c *gin.Context) {
+	userID, ok := ct.currentSessionUserID(c)
 	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	item, found, err := ct.DB.GetUserByID(ctx, id)
+	item, found, err := ct.DB.GetUserByID(ctx, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
 		return
 	}
 	if !found {
-		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "USER_NOT_FOUND"})
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
 		return
 	}
 
 	item.Password = ""
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"item":    item,
+	})
+}
+
+// POST /api/users/me
+// Updates the profile of the logged-in user. Fields that are not sent stay unchanged;
+// changing the email address or the password requires CurrentPassword.
+func (ct UsersController) PostMe(c *gin.Context) {
+	userID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	var req updateMeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
+	current, found, err := ct.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	upd := db.User{
+		ID:        userID,
+		FirstName: current.FirstName,
+		LastName:  current.LastName,
+	}
+	if req.FirstName != nil {
+		upd.FirstName = strings.TrimSpace(*req.FirstName)
+	}
+	if req.LastName != nil {
+		upd.LastName = strings.TrimSpace(*req.LastName)
+	}
+
+	needsPassword := false
+	if req.Email != nil {
+		nextEmail := strings.ToLower(strings.TrimSpace(*req.Email))
+		if nextEmail == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_EMAIL"})
+			return
+		}
+		if nextEmail != strings.ToLower(strings.TrimSpace(current.Email)) {
+			other, otherFound, err := ct.DB.GetUserByEmail(ctx, nextEmail)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+				return
+			}
+			if otherFound && other.ID != userID {
+				c.JSON(http.StatusConflict, gin.H{"success": false, "message": "EMAIL_ALREADY_IN_USE"})
+				return
+			}
+			upd.Email = nextEmail
+			needsPassword = true
+		}
+	}
+	passwordChanged := req.Password != "" || req.PasswordDuplicate != ""
+	if passwordChanged {
+		if msg := newPasswordMessage(current, req.Password, req.PasswordDuplicate); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": msg})
+			return
+		}
+		needsPassword = true
+	}
+	if needsPassword && !currentPasswordValid(current, req.CurrentPassword) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "INVALID_CURRENT_PASSWORD"})
+		return
+	}
+	if passwordChanged {
+		hash, err := users.HashPassword(strings.TrimSpace(req.Password), users.DefaultArgon2idParams)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "PASSWORD_HASH_FAILED"})
+			return
+		}
+		upd.Password = hash
+	}
+
+	if _, err := ct.DB.UpdateUser(ctx, upd); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if passwordChanged {
+		if _, err := ct.DB.SetMustChangePassword(ctx, userID, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+			return
+		}
+		keepID := ""
+		if sess, _ := ct.Store.Get(c.Request, ct.SessionName); sess != nil {
+			keepID = sess.ID
+		}
+		revokeUserSessions(ctx, ct.Store, userID, keepID)
+	}
+
+	item, found, err := ct.DB.GetUserByID(ctx, userID)
+	if err != nil || !found {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	item.Password = ""
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"item":    item,
 	})
 }
 
-// POST /api/users/update/:id
-func (ct UsersController) PostUpdate(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
+// GET /api/users/logins/:id
+// Lists the recent logins of a user, newest first.
+func (ct UsersController) GetLoginHistory(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
 		return
 	}
-	if !ct.ensureAuthorized(c) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	u, found, err := ct.DB.GetUserByID(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "USER_NOT_FOUND"})
+		return
+	}
+	items, err := ct.DB.ListLoginHistory(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"last_login_at": u.LastLoginAt,
+		"items":         items,
+	})
+}
+
+// POST /api/users/update/:id
+func (ct UsersController) PostUpdate(c *gin.Context) {
 	id, ok := parseUserID(c)
 	if !ok {
 		return
@@ -250,6 +371,12 @@ func (ct UsersController) PostUpdate(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "USER_NOT_FOUND"})
 		return
 	}
+	if req.MustChangePassword != nil {
+		if _, err := ct.DB.SetMustChangePassword(ctx, id, *req.MustChangePassword); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+			return
+		}
+	}
 
 	item, found, err := ct.DB.GetUserByID(ctx, id)
 	if err != nil {
@@ -270,13 +397,6 @@ func (ct UsersController) PostUpdate(c *gin.Context) {
 
 // POST /api/users/update-password/:id
 func (ct UsersController) PostUpdatePassword(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-	if !ct.ensureAuthorized(c) {
-		return
-	}
-
 	id, ok := parseUserID(c)
 	if !ok {
 		return
@@ -295,14 +415,7 @@ func (ct UsersController) PostUpdatePassword(c *gin.Context) {
 		return
 	}
 	if err := users.ValidatePassword(password); err != nil {
-		switch {
-		case errors.Is(err, users.ErrPasswordRequired):
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_PASSWORD"})
-		case errors.Is(err, users.ErrPasswordTooShort):
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "PASSWORD_TOO_SHORT"})
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_PASSWORD"})
-		}
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": invalidPasswordMessage(err)})
 		return
 	}
 
@@ -340,6 +453,37 @@ func (ct UsersController) PostUpdatePassword(c *gin.Context) {
 		return
 	}
 
+	// A password reset by someone else is temporary and must be changed at the next login.
+	sessionUserID, hasSessionUserID := ct.currentSessionUserID(c)
+	own := hasSessionUserID && sessionUserID == id
+	mustChange := !own
+	if req.MustChangePassword != nil {
+		mustChange = *req.MustChangePassword
+	}
+	if _, err := ct.DB.SetMustChangePassword(ctx, id, mustChange); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+
+	// Log out everywhere else; users changing their own password keep this session.
+	keepID := ""
+	if own {
+		if sess, _ := ct.Store.Get(c.Request, ct.SessionName); sess != nil {
+			keepID = sess.ID
+		}
+	}
+	revokeUserSessions(ctx, ct.Store, id, keepID)
+
+	// A reset by someone else assumes the old password is lost or leaked, so the
+	// API tokens created with it are revoked too.
+	if !own {
+		if n, err := ct.DB.RevokeUserAPITokens(ctx, id); err != nil {
+			log.Printf("Revoke API tokens of user %d failed: %v", id, err)
+		} else if n > 0 {
+			log.Printf("Revoked %d API tokens of user %d", n, id)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "PASSWORD_UPDATED",
@@ -348,13 +492,6 @@ func (ct UsersController) PostUpdatePassword(c *gin.Context) {
 
 // POST /api/users/add
 func (ct UsersController) PostAdd(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-	if !ct.ensureAuthorized(c) {
-		return
-	}
-
 	var req addUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
@@ -376,14 +513,7 @@ func (ct UsersController) PostAdd(c *gin.Context) {
 		return
 	}
 	if err := users.ValidatePassword(password); err != nil {
-		switch {
-		case errors.Is(err, users.ErrPasswordRequired):
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "MISSING_PASSWORD"})
-		case errors.Is(err, users.ErrPasswordTooShort):
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "PASSWORD_TOO_SHORT"})
-		default:
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_PASSWORD"})
-		}
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": invalidPasswordMessage(err)})
 		return
 	}
 
@@ -405,10 +535,11 @@ func (ct UsersController) PostAdd(c *gin.Context) {
 	}
 
 	newID, err := ct.DB.CreateUser(ctx, db.User{
-		Email:     email,
-		Password:  hash,
-		FirstName: firstName,
-		LastName:  lastName,
+		Email:              email,
+		Password:           hash,
+		FirstName:          firstName,
+		LastName:           lastName,
+		MustChangePassword: req.MustChangePassword,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
@@ -435,13 +566,6 @@ func (ct UsersController) PostAdd(c *gin.Context) {
 
 // POST /api/users/delete/:id
 func (ct UsersController) PostDelete(c *gin.Context) {
-	if !cors.ApplyCORS(c, config.Cfg.WebAdmin.CORSAllowedOrigins) {
-		return
-	}
-	if !ct.ensureAuthorized(c) {
-		return
-	}
-
 	id, ok := parseUserID(c)
 	if !ok {
 		return
@@ -465,6 +589,7 @@ func (ct UsersController) PostDelete(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "USER_NOT_FOUND"})
 		return
 	}
+	revokeUserSessions(ctx, ct.Store, id, "")
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
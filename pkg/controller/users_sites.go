@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+type userSiteRequest struct {
+	SiteID int64  `json:"SiteID"`
+	Action string `json:"Action"` // assign|revoke
+}
+
+// userSiteItem is a site assigned to a user. Manageable tells whether the current
+// user may revoke it, i.e. has access to the site as well.
+type userSiteItem struct {
+	db.Site
+	Manageable bool `json:"Manageable"`
+}
+
+// GET /api/users/:id/sites
+func (ct UsersController) GetSites(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+	actorID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, found, err := ct.DB.GetUserByID(ctx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	} else if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "USER_NOT_FOUND"})
+		return
+	}
+
+	sites, err := ct.DB.ListSitesByUserID(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	allowed, err := ct.DB.ListAllowedSiteIDsByUserID(ctx, actorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	allowedSet := make(map[int64]bool, len(allowed))
+	for _, siteID := range allowed {
+		allowedSet[siteID] = true
+	}
+
+	items := make([]userSiteItem, 0, len(sites))
+	for _, s := range sites {
+		items = append(items, userSiteItem{Site: s, Manageable: allowedSet[s.ID] && actorID != id})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"items":   items,
+	})
+}
+
+// POST /api/users/:id/sites
+// Assigns a site to the user or revokes it. Users can only pass on access to sites
+// they have themselves, and cannot change their own assignments.
+func (ct UsersController) PostSites(c *gin.Context) {
+	id, ok := parseUserID(c)
+	if !ok {
+		return
+	}
+
+	var req userSiteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_JSON"})
+		return
+	}
+	if req.SiteID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_SITE_ID"})
+		return
+	}
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	if action != "assign" && action != "revoke" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "INVALID_ACTION"})
+		return
+	}
+
+	actorID, ok := ct.currentSessionUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		return
+	}
+	if actorID == id {
+		c.JSON(http.StatusConflict, gin.H{"success": false, "message": "CANNOT_CHANGE_OWN_SITES"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hasAccess, err := ct.DB.UserHasSiteAccess(ctx, actorID, req.SiteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "FORBIDDEN_SITE"})
+		return
+	}
+	if _, found, err := ct.DB.GetUserByID(ctx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	} else if !found {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": "USER_NOT_FOUND"})
+		return
+	}
+
+	var changed bool
+	auditAction := db.AuditUserSiteGrant
+	if action == "assign" {
+		changed, err = ct.DB.GrantUserSite(ctx, id, req.SiteID)
+	} else {
+		changed, err = ct.DB.RevokeUserSite(ctx, id, req.SiteID)
+		auditAction = db.AuditUserSiteRevoke
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "DB_ERROR"})
+		return
+	}
+	if changed {
+		entry := db.AuditEntry{UserID: actorID, SiteID: req.SiteID, Action: auditAction, Details: map[string]any{"user_id": id}}
+		if err := ct.DB.InsertAuditLog(ctx, entry); err != nil {
+			log.Printf("Audit log failed (action=%s): %v", auditAction, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"changed": changed,
+	})
+}
@@ -51,8 +51,8 @@ func ApplyCORS(c *gin.Context, allowedOrigins []string) bool {
 	c.Header("Access-Control-Allow-Credentials", "true")
 
 	// Allow typical headers and methods used by your frontend
-	c.Header("Access-Control-Allow-Methods", "POST, OPTIONS")
-	c.Header("Access-Control-Allow-Headers", "Content-Type, X-Requested-With, Accept, Origin")
+	c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	c.Header("Access-Control-Allow-Headers", "Content-Type, X-Requested-With, Accept, Origin, X-Fyndmark-Embed-Token, Authorization, X-CSRF-Token")
 
 	// Handle preflight
 	if c.Request.Method == http.MethodOptions {
@@ -62,3 +62,29 @@ func ApplyCORS(c *gin.Context, allowedOrigins []string) bool {
 
 	return true
 }
+
+// OriginsFunc returns the allowed origins for a request, e.g. of the site in its path.
+// ok is false if the site is unknown.
+type OriginsFunc func(c *gin.Context) (origins []string, ok bool)
+
+// Middleware applies CORS with the origins resolved per request and answers
+// preflights. Preflights for unknown sites get 404; other requests for unknown sites
+// are passed on, so the handler responds as usual.
+func Middleware(origins OriginsFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, ok := origins(c)
+		if !ok {
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			c.Next()
+			return
+		}
+		if !ApplyCORS(c, allowed) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
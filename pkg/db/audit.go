@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Audit log actions.
+const (
+	AuditCommentEdit         = "comment.edit"
+	AuditCommentPseudonymize = "comment.pseudonymize"
+	AuditCommentPurge        = "comment.purge"
+	AuditPipelinePause       = "pipeline.pause"
+	AuditPipelineResume      = "pipeline.resume"
+	AuditRunRetry            = "pipeline.run_retry"
+	AuditRunCancel           = "pipeline.run_cancel"
+	AuditTokenCreate         = "token.create"
+	AuditTokenRevoke         = "token.revoke"
+	AuditUserProvision       = "user.provision"
+	AuditSessionRevoke       = "session.revoke"
+	AuditUserSiteGrant       = "user.site_grant"
+	AuditUserSiteRevoke      = "user.site_revoke"
+)
+
+// AuditEntry is one entry of the admin audit log.
+type AuditEntry struct {
+	ID        int64          `json:"ID"`
+	UserID    int64          `json:"UserID"`
+	SiteID    int64          `json:"SiteID"`
+	Action    string         `json:"Action"`
+	Details   map[string]any `json:"Details"`
+	CreatedAt int64          `json:"CreatedAt"`
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertAuditLog writes an audit entry using db or a running transaction.
+func insertAuditLog(ctx context.Context, ex execer, e AuditEntry) error {
+	details := ""
+	if len(e.Details) > 0 {
+		b, err := json.Marshal(e.Details)
+		if err != nil {
+			return fmt.Errorf("encode audit details: %w", err)
+		}
+		details = string(b)
+	}
+
+	_, err := ex.ExecContext(ctx, `
+INSERT INTO audit_log (user_id, site_id, action, details, created_at)
+VALUES (?, ?, ?, ?, ?)
+`,
+		nullInt64(e.UserID),
+		nullInt64(e.SiteID),
+		e.Action,
+		details,
+		nowUnix(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit log: %w", err)
+	}
+	return nil
+}
+
+// InsertAuditLog writes an audit entry.
+func (d *DB) InsertAuditLog(ctx context.Context, e AuditEntry) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	return insertAuditLog(ctx, d.SQL, e)
+}
+
+// nullInt64 maps 0 to NULL.
+func nullInt64(v int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: v, Valid: v != 0}
+}
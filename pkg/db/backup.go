@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Backup writes a consistent copy of the SQLite database to path with VACUUM INTO.
+// The copy is read on a connection of its own, so writes go on while it is made.
+// path must not exist yet. Other backends are backed up with their own tools.
+func (d *DB) Backup(ctx context.Context, path string) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	if d.Driver() != DriverSQLite || d.path == "" {
+		return fmt.Errorf("backup needs SQLite, back up %s with its own tools or use state export", d.Driver())
+	}
+
+	conn, err := openPool(d.path, 1, "_pragma=busy_timeout(5000)")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.ExecContext(ctx, `VACUUM INTO ?;`, path); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	return nil
+}
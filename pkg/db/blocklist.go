@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	BlockEmail       = "email"
+	BlockEmailDomain = "email_domain"
+	BlockIP          = "ip"
+	BlockURLDomain   = "url_domain"
+)
+
+type BlocklistEntry struct {
+	ID        int64  `json:"ID"`
+	SiteID    int64  `json:"SiteID"`
+	Kind      string `json:"Kind"`
+	Value     string `json:"Value"`
+	Note      string `json:"Note"`
+	CreatedBy int64  `json:"CreatedBy"`
+	CreatedAt int64  `json:"CreatedAt"`
+}
+
+// IsValidBlockKind reports whether kind is a supported blocklist kind.
+func IsValidBlockKind(kind string) bool {
+	switch kind {
+	case BlockEmail, BlockEmailDomain, BlockIP, BlockURLDomain:
+		return true
+	default:
+		return false
+	}
+}
+
+// AddBlocklistEntry inserts an entry and returns its ID.
+// Returns (0, false, nil) if the same kind/value already exists for the site.
+func (d *DB) AddBlocklistEntry(ctx context.Context, e BlocklistEntry) (int64, bool, error) {
+	if d == nil || d.SQL == nil {
+		return 0, false, fmt.Errorf("db not initialized")
+	}
+	if e.SiteID <= 0 {
+		return 0, false, fmt.Errorf("siteID must be > 0")
+	}
+	if !IsValidBlockKind(e.Kind) {
+		return 0, false, fmt.Errorf("invalid blocklist kind %q", e.Kind)
+	}
+
+	var createdBy any
+	if e.CreatedBy > 0 {
+		createdBy = e.CreatedBy
+	}
+
+	id, err := d.dialect().insertID(ctx, d.SQL, d.dialect().upsert(`
+INSERT INTO blocklist (site_id, kind, value, note, created_by, created_at)
+VALUES (?, ?, ?, ?, ?, ?)`, "site_id, kind, value", ""), e.SiteID, e.Kind, e.Value, strings.TrimSpace(e.Note), createdBy, nowUnix())
+	if err != nil {
+		return 0, false, fmt.Errorf("add blocklist entry: %w", err)
+	}
+	if id == 0 {
+		return 0, false, nil
+	}
+	return id, true, nil
+}
+
+// GetBlocklistEntry returns a single entry by ID.
+func (d *DB) GetBlocklistEntry(ctx context.Context, id int64) (BlocklistEntry, bool, error) {
+	if d == nil || d.SQL == nil {
+		return BlocklistEntry{}, false, fmt.Errorf("db not initialized")
+	}
+
+	var (
+		e         BlocklistEntry
+		createdBy sql.NullInt64
+	)
+	err := d.reader().QueryRowContext(ctx, `
+SELECT id, site_id, kind, value, note, created_by, created_at
+  FROM blocklist
+ WHERE id = ?;
+`, id).Scan(&e.ID, &e.SiteID, &e.Kind, &e.Value, &e.Note, &createdBy, &e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return BlocklistEntry{}, false, nil
+	}
+	if err != nil {
+		return BlocklistEntry{}, false, fmt.Errorf("get blocklist entry: %w", err)
+	}
+	e.CreatedBy = createdBy.Int64
+	return e, true, nil
+}
+
+// DeleteBlocklistEntry removes an entry. Returns false if it did not exist.
+func (d *DB) DeleteBlocklistEntry(ctx context.Context, id int64) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `DELETE FROM blocklist WHERE id = ?;`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete blocklist entry: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete blocklist entry rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// ListBlocklist returns the entries of the given sites, newest first.
+func (d *DB) ListBlocklist(ctx context.Context, siteIDs []int64) ([]BlocklistEntry, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+	out := make([]BlocklistEntry, 0)
+	if len(siteIDs) == 0 {
+		return out, nil
+	}
+
+	inPlaceholders := strings.TrimSuffix(strings.Repeat("?,", len(siteIDs)), ",")
+	args := make([]any, 0, len(siteIDs))
+	for _, sid := range siteIDs {
+		args = append(args, sid)
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT id, site_id, kind, value, note, created_by, created_at
+  FROM blocklist
+ WHERE site_id IN (`+inPlaceholders+`)
+ ORDER BY created_at DESC, id DESC;
+`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list blocklist: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var (
+			e         BlocklistEntry
+			createdBy sql.NullInt64
+		)
+		if err := rows.Scan(&e.ID, &e.SiteID, &e.Kind, &e.Value, &e.Note, &createdBy, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan blocklist entry: %w", err)
+		}
+		e.CreatedBy = createdBy.Int64
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate blocklist: %w", err)
+	}
+	return out, nil
+}
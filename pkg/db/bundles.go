@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// ListBundleHashes returns the content hashes of the comment bundles pushed by the
+// last successful pipeline run of a site, keyed by post path.
+func (d *DB) ListBundleHashes(ctx context.Context, siteID int64) (map[string]string, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `SELECT post_path, hash FROM generated_bundles WHERE site_id = ?;`, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("list bundle hashes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := map[string]string{}
+	for rows.Next() {
+		var postPath, hash string
+		if err := rows.Scan(&postPath, &hash); err != nil {
+			return nil, fmt.Errorf("scan bundle hash: %w", err)
+		}
+		out[postPath] = hash
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate bundle hashes: %w", err)
+	}
+	return out, nil
+}
+
+// SaveBundleHashes replaces the stored bundle hashes of a site.
+func (d *DB) SaveBundleHashes(ctx context.Context, siteID int64, hashes map[string]string) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("save bundle hashes begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM generated_bundles WHERE site_id = ?;`, siteID); err != nil {
+		return fmt.Errorf("save bundle hashes delete: %w", err)
+	}
+	now := nowUnix()
+	for postPath, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO generated_bundles (site_id, post_path, hash, updated_at) VALUES (?, ?, ?, ?);`, siteID, postPath, hash, now); err != nil {
+			return fmt.Errorf("save bundle hash %q: %w", postPath, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save bundle hashes commit: %w", err)
+	}
+	return nil
+}
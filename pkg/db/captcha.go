@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// CreateCaptchaChallenge stores a challenge of the built-in captcha and removes expired ones.
+func (d *DB) CreateCaptchaChallenge(ctx context.Context, id, answer string, expiresAt int64) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	now := nowUnix()
+	if _, err := d.SQL.ExecContext(ctx, `DELETE FROM captcha_challenges WHERE expires_at < ?`, now); err != nil {
+		return fmt.Errorf("delete expired captcha challenges: %w", err)
+	}
+
+	_, err := d.SQL.ExecContext(ctx, `
+INSERT INTO captcha_challenges (id, answer, created_at, expires_at)
+VALUES (?, ?, ?, ?)
+`, id, answer, now, expiresAt)
+	if err != nil {
+		return fmt.Errorf("create captcha challenge: %w", err)
+	}
+	return nil
+}
+
+// TakeCaptchaChallenge returns the answer of an unexpired challenge and deletes it,
+// so each challenge can be used only once. Of concurrent calls for the same challenge,
+// only the one whose DELETE removes the row gets the answer.
+func (d *DB) TakeCaptchaChallenge(ctx context.Context, id string, now int64) (string, bool, error) {
+	if d == nil || d.SQL == nil {
+		return "", false, fmt.Errorf("db not initialized")
+	}
+
+	var answer string
+	err := d.SQL.QueryRowContext(ctx, `
+SELECT answer FROM captcha_challenges
+ WHERE id = ? AND expires_at >= ?;
+`, id, now).Scan(&answer)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("take captcha challenge: %w", err)
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `DELETE FROM captcha_challenges WHERE id = ?;`, id)
+	if err != nil {
+		return "", false, fmt.Errorf("take captcha challenge: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", false, fmt.Errorf("take captcha challenge: %w", err)
+	}
+	if n == 0 {
+		return "", false, nil
+	}
+	return answer, true, nil
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// CheckIssue is the result of one consistency check.
+type CheckIssue struct {
+	Check string `json:"check"`
+	// Count is the number of affected rows.
+	Count int64 `json:"count"`
+	// Fixable reports whether the check can be repaired with fix mode.
+	Fixable bool `json:"fixable"`
+	// Fixed is the number of rows repaired (only in fix mode).
+	Fixed int64 `json:"fixed"`
+	// Hint tells how to repair an issue that is not fixable.
+	Hint string `json:"hint,omitempty"`
+}
+
+// CheckReport is the result of Check.
+type CheckReport struct {
+	// Integrity holds the messages of PRAGMA integrity_check, ["ok"] for a sound file.
+	// PostgreSQL and MySQL check their storage themselves and always report ["ok"].
+	Integrity []string `json:"integrity"`
+	// Issues holds the checks that found affected rows.
+	Issues []CheckIssue `json:"issues"`
+}
+
+// OK reports whether the file is sound and no unrepaired issues remain.
+func (r CheckReport) OK() bool {
+	if len(r.Integrity) != 1 || r.Integrity[0] != "ok" {
+		return false
+	}
+	for _, is := range r.Issues {
+		if is.Fixed < is.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// consistencyCheck counts rows violating an invariant. fix repairs them; it is empty
+// for issues that need a manual decision, which hint describes.
+type consistencyCheck struct {
+	name  string
+	count string
+	fix   string
+	hint  string
+}
+
+var consistencyChecks = []consistencyCheck{
+	{
+		name:  "comments with missing parent",
+		count: `SELECT COUNT(*) FROM comments c WHERE c.parent_id IS NOT NULL AND c.parent_id <> '' AND NOT EXISTS (SELECT 1 FROM comments p WHERE p.id = c.parent_id);`,
+		// Keep the reply, it becomes a top-level comment. The derived table lets MySQL
+		// read the table it updates.
+		fix: `UPDATE comments SET parent_id = NULL WHERE parent_id IS NOT NULL AND parent_id <> '' AND parent_id NOT IN (SELECT id FROM (SELECT id FROM comments) AS existing);`,
+	},
+	{
+		name:  "comments with missing site",
+		count: `SELECT COUNT(*) FROM comments c WHERE NOT EXISTS (SELECT 1 FROM sites s WHERE s.id = c.site_id);`,
+		hint:  "add the site to comment_sites in the config again, or delete the comments",
+	},
+	{
+		name:  "comments with unknown status",
+		count: `SELECT COUNT(*) FROM comments WHERE status NOT IN ('pending', 'approved', 'rejected', 'spam', 'deleted', 'unconfirmed');`,
+		hint:  "set one of pending, approved, rejected, spam, deleted or unconfirmed",
+	},
+	{
+		name:  "approved comments without approved_at",
+		count: `SELECT COUNT(*) FROM comments WHERE status = 'approved' AND approved_at IS NULL;`,
+		fix:   `UPDATE comments SET approved_at = updated_at WHERE status = 'approved' AND approved_at IS NULL;`,
+	},
+	{
+		name:  "rejected comments without rejected_at",
+		count: `SELECT COUNT(*) FROM comments WHERE status = 'rejected' AND rejected_at IS NULL;`,
+		fix:   `UPDATE comments SET rejected_at = updated_at WHERE status = 'rejected' AND rejected_at IS NULL;`,
+	},
+	{
+		name:  "deleted comments without deleted_at",
+		count: `SELECT COUNT(*) FROM comments WHERE status = 'deleted' AND deleted_at IS NULL;`,
+		fix:   `UPDATE comments SET deleted_at = updated_at WHERE status = 'deleted' AND deleted_at IS NULL;`,
+	},
+	{
+		name:  "comments with stale approved_at",
+		count: `SELECT COUNT(*) FROM comments WHERE status <> 'approved' AND approved_at IS NOT NULL;`,
+		fix:   `UPDATE comments SET approved_at = NULL WHERE status <> 'approved' AND approved_at IS NOT NULL;`,
+	},
+	{
+		name:  "comments with stale rejected_at",
+		count: `SELECT COUNT(*) FROM comments WHERE status <> 'rejected' AND rejected_at IS NOT NULL;`,
+		fix:   `UPDATE comments SET rejected_at = NULL WHERE status <> 'rejected' AND rejected_at IS NOT NULL;`,
+	},
+	{
+		name:  "comments with stale deleted_at",
+		count: `SELECT COUNT(*) FROM comments WHERE status <> 'deleted' AND deleted_at IS NOT NULL;`,
+		fix:   `UPDATE comments SET deleted_at = NULL WHERE status <> 'deleted' AND deleted_at IS NOT NULL;`,
+	},
+	{
+		name:  "pipeline runs with missing site",
+		count: `SELECT COUNT(*) FROM pipeline_runs r WHERE NOT EXISTS (SELECT 1 FROM sites s WHERE s.id = r.site_id);`,
+		fix:   `DELETE FROM pipeline_runs WHERE NOT EXISTS (SELECT 1 FROM sites s WHERE s.id = pipeline_runs.site_id);`,
+	},
+	{
+		name:  "run logs with missing run",
+		count: `SELECT COUNT(*) FROM pipeline_run_logs l WHERE NOT EXISTS (SELECT 1 FROM pipeline_runs r WHERE r.id = l.run_id);`,
+		fix:   `DELETE FROM pipeline_run_logs WHERE NOT EXISTS (SELECT 1 FROM pipeline_runs r WHERE r.id = pipeline_run_logs.run_id);`,
+	},
+	{
+		name:  "run files with missing run",
+		count: `SELECT COUNT(*) FROM pipeline_run_files f WHERE NOT EXISTS (SELECT 1 FROM pipeline_runs r WHERE r.id = f.run_id);`,
+		fix:   `DELETE FROM pipeline_run_files WHERE NOT EXISTS (SELECT 1 FROM pipeline_runs r WHERE r.id = pipeline_run_files.run_id);`,
+	},
+}
+
+// coveredForeignKeys are the foreign keys ("table>parent") that consistencyChecks
+// already look at, with their own repair.
+var coveredForeignKeys = map[string]bool{
+	"comments>comments":                true,
+	"comments>sites":                   true,
+	"pipeline_run_logs>pipeline_runs":  true,
+	"pipeline_run_files>pipeline_runs": true,
+}
+
+// foreignKeyIssue returns the name of the issue of a foreign key violation, or "" if
+// a consistency check covers it.
+func foreignKeyIssue(v fkViolation) string {
+	if coveredForeignKeys[v.table+">"+v.parent] {
+		return ""
+	}
+	return fmt.Sprintf("%s with missing %s", v.table, v.parent)
+}
+
+// Check runs PRAGMA integrity_check and PRAGMA foreign_key_check (SQLite only) and the
+// consistency checks of the comment and run tables. With fix, repairable issues are
+// fixed in one transaction: rows violating a foreign key are deleted, as ON DELETE
+// CASCADE would have done. The file itself is never repaired.
+func (d *DB) Check(ctx context.Context, fix bool) (CheckReport, error) {
+	var report CheckReport
+	if d == nil || d.SQL == nil {
+		return report, fmt.Errorf("db not initialized")
+	}
+
+	integrity, err := d.dialect().integrityCheck(ctx, d.reader())
+	if err != nil {
+		return report, fmt.Errorf("integrity check: %w", err)
+	}
+	report.Integrity = integrity
+
+	for _, c := range consistencyChecks {
+		var n int64
+		if err := d.reader().QueryRowContext(ctx, c.count).Scan(&n); err != nil {
+			return report, fmt.Errorf("check %s: %w", c.name, err)
+		}
+		if n > 0 {
+			report.Issues = append(report.Issues, CheckIssue{Check: c.name, Count: n, Fixable: c.fix != "", Hint: c.hint})
+		}
+	}
+
+	violations, err := d.dialect().foreignKeyViolations(ctx, d.reader())
+	if err != nil {
+		return report, fmt.Errorf("foreign key check: %w", err)
+	}
+	counts := make(map[string]int64)
+	var names []string
+	for _, v := range violations {
+		name := foreignKeyIssue(v)
+		if name == "" {
+			continue
+		}
+		if counts[name] == 0 {
+			names = append(names, name)
+		}
+		counts[name]++
+	}
+	for _, name := range names {
+		report.Issues = append(report.Issues, CheckIssue{Check: name, Count: counts[name], Fixable: true})
+	}
+
+	if !fix || len(report.Issues) == 0 {
+		return report, nil
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return report, fmt.Errorf("check fix begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	fixed := make(map[string]int64)
+	for _, c := range consistencyChecks {
+		if c.fix == "" {
+			continue
+		}
+		res, err := tx.ExecContext(ctx, c.fix)
+		if err != nil {
+			return report, fmt.Errorf("fix %s: %w", c.name, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return report, fmt.Errorf("fix %s rows affected: %w", c.name, err)
+		}
+		fixed[c.name] = n
+	}
+
+	// Checked again, the fixes above may have deleted rows.
+	violations, err = d.dialect().foreignKeyViolations(ctx, tx)
+	if err != nil {
+		return report, fmt.Errorf("foreign key check: %w", err)
+	}
+	// A row may violate several foreign keys; it counts as fixed for each of them.
+	deleted := make(map[fkViolation]bool)
+	for _, v := range violations {
+		name := foreignKeyIssue(v)
+		if name == "" {
+			continue
+		}
+		row := fkViolation{table: v.table, rowID: v.rowID}
+		if !deleted[row] {
+			// Only SQLite reports violations, so the row is addressed by its rowid.
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+v.table+" WHERE rowid = ?;", v.rowID); err != nil {
+				return report, fmt.Errorf("fix %s: %w", name, err)
+			}
+			deleted[row] = true
+		}
+		fixed[name]++
+	}
+	if err := tx.Commit(); err != nil {
+		return report, fmt.Errorf("check fix commit: %w", err)
+	}
+
+	for i := range report.Issues {
+		report.Issues[i].Fixed = fixed[report.Issues[i].Check]
+	}
+	return report, nil
+}
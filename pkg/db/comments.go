@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,15 +25,32 @@ type Comment struct {
 	CreatedAt  int64          `json:"CreatedAt"`
 	ApprovedAt int64          `json:"ApprovedAt"`
 	RejectedAt int64          `json:"RejectedAt"`
+	// DeletedAt is when a moderator deleted the comment; deleted comments are kept until purged.
+	DeletedAt int64 `json:"DeletedAt"`
+	UpdatedAt int64 `json:"UpdatedAt"`
+	// DecidedBy and DecidedVia record the last moderation decision, see Decision.
+	DecidedBy  string `json:"DecidedBy"`
+	DecidedVia string `json:"DecidedVia"`
+	SpamScore  int    `json:"SpamScore"`
+	// SpamRules lists the heuristic rules that matched on submission (comma-separated).
+	SpamRules string `json:"SpamRules"`
+	// WordMatches lists the word filter matches on submission ("field:term", comma-separated).
+	WordMatches string `json:"WordMatches"`
+	// EmailMD5 and EmailSHA256 are hex hashes of the normalized email, for avatar services.
+	EmailMD5    string `json:"EmailMD5"`
+	EmailSHA256 string `json:"EmailSHA256"`
 }
 
 type CommentListFilter struct {
 	SiteID int64
 	// AllowedSiteIDs must contain all sites the current user may access.
 	AllowedSiteIDs []int64
-	// pending|approved|rejected|spam|deleted|all
+	// pending|approved|rejected|spam|deleted|unconfirmed|all
 	Status string
 	Query  string
+	// Since and Until limit created_at (unix seconds, inclusive); 0 = no bound.
+	Since  int64
+	Until  int64
 	Limit  int
 	Offset int
 }
@@ -43,12 +61,39 @@ const (
 	CommentStatusRejected = "rejected"
 	CommentStatusSpam     = "spam"
 	CommentStatusDeleted  = "deleted"
+	// CommentStatusUnconfirmed marks comments waiting for the commenter's email confirmation (double opt-in).
+	CommentStatusUnconfirmed = "unconfirmed"
 )
 
+// Channels of moderation decisions, stored as decided_via.
+const (
+	DecidedViaAdminAPI     = "admin-api"
+	DecidedViaDecisionLink = "decision-link"
+	// Automatic spam classification on submission, named after the check.
+	DecidedViaAkismet    = "akismet"
+	DecidedViaHeuristics = "heuristics"
+)
+
+// DecidedByEmailToken is stored as decided_by for decisions made with the signed link
+// of a moderation mail, which is not bound to a user.
+const DecidedByEmailToken = "email-token"
+
+// Decision records who moderated a comment and how. By is the ID of an admin user,
+// DecidedByEmailToken, or empty for automatic decisions.
+type Decision struct {
+	By  string
+	Via string
+}
+
+// AdminDecision is the decision of an admin user through the admin API.
+func AdminDecision(userID int64) Decision {
+	return Decision{By: strconv.FormatInt(userID, 10), Via: DecidedViaAdminAPI}
+}
+
 // isValidCommentStatus performs its package-specific operation.
 func isValidCommentStatus(status string) bool {
 	switch status {
-	case CommentStatusPending, CommentStatusApproved, CommentStatusRejected, CommentStatusSpam, CommentStatusDeleted:
+	case CommentStatusPending, CommentStatusApproved, CommentStatusRejected, CommentStatusSpam, CommentStatusDeleted, CommentStatusUnconfirmed:
 		return true
 	default:
 		return false
@@ -72,6 +117,11 @@ func (c Comment) MarshalJSON() ([]byte, error) {
 		CreatedAt  int64  `json:"CreatedAt"`
 		ApprovedAt int64  `json:"ApprovedAt"`
 		RejectedAt int64  `json:"RejectedAt"`
+		DeletedAt  int64  `json:"DeletedAt"`
+		UpdatedAt  int64  `json:"UpdatedAt"`
+		DecidedBy  string `json:"DecidedBy"`
+		DecidedVia string `json:"DecidedVia"`
+		SpamScore  int    `json:"SpamScore"`
 	}{
 		ID:         c.ID,
 		SiteID:     c.SiteID,
@@ -87,6 +137,11 @@ func (c Comment) MarshalJSON() ([]byte, error) {
 		CreatedAt:  c.CreatedAt,
 		ApprovedAt: c.ApprovedAt,
 		RejectedAt: c.RejectedAt,
+		DeletedAt:  c.DeletedAt,
+		UpdatedAt:  c.UpdatedAt,
+		DecidedBy:  c.DecidedBy,
+		DecidedVia: c.DecidedVia,
+		SpamScore:  c.SpamScore,
 	})
 }
 
@@ -120,6 +175,11 @@ func (d *DB) InsertComment(ctx context.Context, c Comment) error {
 	if d == nil || d.SQL == nil {
 		return fmt.Errorf("db not initialized")
 	}
+	return insertComment(ctx, d.SQL, c)
+}
+
+// insertComment inserts a comment with ex, which may be a transaction.
+func insertComment(ctx context.Context, ex execer, c Comment) error {
 	if c.SiteID <= 0 {
 		return fmt.Errorf("siteID must be > 0")
 	}
@@ -135,12 +195,17 @@ func (d *DB) InsertComment(ctx context.Context, c Comment) error {
 	if c.CreatedAt == 0 {
 		c.CreatedAt = time.Now().Unix()
 	}
+	c.EmailMD5, c.EmailSHA256 = EmailHashes(c.Email)
+	// Comments inserted as approved (admin replies) are published right away.
+	if c.Status == CommentStatusApproved && c.ApprovedAt == 0 {
+		c.ApprovedAt = c.CreatedAt
+	}
 
-	_, err := d.SQL.ExecContext(ctx, `
+	_, err := ex.ExecContext(ctx, `
 INSERT INTO comments (
-  id, site_id, entry_id, post_path, parent_id, status, author, email, author_url, body, ip, created_at
-) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
-`, c.ID, c.SiteID, c.EntryID, c.PostPath, c.ParentID, c.Status, c.Author, c.Email, c.AuthorUrl, c.Body, c.IP, c.CreatedAt)
+  id, site_id, entry_id, post_path, parent_id, status, author, email, author_url, body, ip, spam_score, spam_rules, word_matches, email_md5, email_sha256, decided_by, decided_via, created_at, approved_at, updated_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+`, c.ID, c.SiteID, c.EntryID, c.PostPath, c.ParentID, c.Status, c.Author, c.Email, c.AuthorUrl, c.Body, c.IP, c.SpamScore, c.SpamRules, c.WordMatches, c.EmailMD5, c.EmailSHA256, c.DecidedBy, c.DecidedVia, c.CreatedAt, nullInt64(c.ApprovedAt), c.CreatedAt)
 
 	if err != nil {
 		return fmt.Errorf("insert comment: %w", err)
@@ -149,9 +214,9 @@ INSERT INTO comments (
 	return nil
 }
 
-// SetCommentStatus updates a comment to the given status.
+// SetCommentStatus updates a comment to the given status and records the decision.
 // Returns true if a row was updated, false if nothing changed (not found or already in target status).
-func (d *DB) SetCommentStatus(ctx context.Context, siteID int64, commentID, status string) (bool, error) {
+func (d *DB) SetCommentStatus(ctx context.Context, siteID int64, commentID, status string, by Decision) (bool, error) {
 	if d == nil || d.SQL == nil {
 		return false, fmt.Errorf("db not initialized")
 	}
@@ -170,26 +235,29 @@ func (d *DB) SetCommentStatus(ctx context.Context, siteID int64, commentID, stat
 
 	now := time.Now().Unix()
 
-	setClause := "status = ?, updated_at = ?, approved_at = NULL, rejected_at = NULL"
+	setClause := "status = ?, updated_at = ?, approved_at = NULL, rejected_at = NULL, deleted_at = NULL"
 	args := []any{status, now}
 
 	switch status {
 	case CommentStatusApproved:
-		setClause = "status = ?, updated_at = ?, approved_at = ?, rejected_at = NULL"
+		setClause = "status = ?, updated_at = ?, approved_at = ?, rejected_at = NULL, deleted_at = NULL"
 		args = []any{status, now, now}
 	case CommentStatusRejected:
-		setClause = "status = ?, updated_at = ?, rejected_at = ?, approved_at = NULL"
+		setClause = "status = ?, updated_at = ?, rejected_at = ?, approved_at = NULL, deleted_at = NULL"
+		args = []any{status, now, now}
+	case CommentStatusDeleted:
+		setClause = "status = ?, updated_at = ?, deleted_at = ?, approved_at = NULL, rejected_at = NULL"
 		args = []any{status, now, now}
 	}
 
 	query := `
 UPDATE comments
-   SET ` + setClause + `
+   SET ` + setClause + `, decided_by = ?, decided_via = ?
  WHERE site_id = ?
    AND id = ?
    AND status <> ?;
 `
-	args = append(args, siteID, commentID, status)
+	args = append(args, by.By, by.Via, siteID, commentID, status)
 
 	res, err := d.SQL.ExecContext(ctx, query, args...)
 	if err != nil {
@@ -204,23 +272,90 @@ UPDATE comments
 }
 
 // ApproveComment sets a comment to approved.
-func (d *DB) ApproveComment(ctx context.Context, siteID int64, commentID string) (bool, error) {
-	return d.SetCommentStatus(ctx, siteID, commentID, CommentStatusApproved)
+func (d *DB) ApproveComment(ctx context.Context, siteID int64, commentID string, by Decision) (bool, error) {
+	return d.SetCommentStatus(ctx, siteID, commentID, CommentStatusApproved, by)
 }
 
 // RejectComment sets a comment to rejected.
-func (d *DB) RejectComment(ctx context.Context, siteID int64, commentID string) (bool, error) {
-	return d.SetCommentStatus(ctx, siteID, commentID, CommentStatusRejected)
+func (d *DB) RejectComment(ctx context.Context, siteID int64, commentID string, by Decision) (bool, error) {
+	return d.SetCommentStatus(ctx, siteID, commentID, CommentStatusRejected, by)
 }
 
 // SpamComment marks a comment as spam.
-func (d *DB) SpamComment(ctx context.Context, siteID int64, commentID string) (bool, error) {
-	return d.SetCommentStatus(ctx, siteID, commentID, CommentStatusSpam)
+func (d *DB) SpamComment(ctx context.Context, siteID int64, commentID string, by Decision) (bool, error) {
+	return d.SetCommentStatus(ctx, siteID, commentID, CommentStatusSpam, by)
 }
 
-// DeleteComment marks a comment as deleted (soft-delete, no row removal).
-func (d *DB) DeleteComment(ctx context.Context, siteID int64, commentID string) (bool, error) {
-	return d.SetCommentStatus(ctx, siteID, commentID, CommentStatusDeleted)
+// DeleteComment marks a comment as deleted. The row is kept, so the comment can be
+// moderated again, until PurgeComments removes it.
+func (d *DB) DeleteComment(ctx context.Context, siteID int64, commentID string, by Decision) (bool, error) {
+	return d.SetCommentStatus(ctx, siteID, commentID, CommentStatusDeleted, by)
+}
+
+// GetComment returns a single comment of a site by ID.
+func (d *DB) GetComment(ctx context.Context, siteID int64, commentID string) (Comment, bool, error) {
+	if d == nil || d.SQL == nil {
+		return Comment{}, false, fmt.Errorf("db not initialized")
+	}
+
+	var c Comment
+	err := d.reader().QueryRowContext(ctx, `
+SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, author_url, body, ip, spam_score, spam_rules, word_matches, email_md5, email_sha256, created_at, COALESCE(approved_at, 0), COALESCE(rejected_at, 0), COALESCE(deleted_at, 0), updated_at, decided_by, decided_via
+  FROM comments
+ WHERE site_id = ?
+   AND id = ?;
+`, siteID, commentID).Scan(
+		&c.ID,
+		&c.SiteID,
+		&c.EntryID,
+		&c.PostPath,
+		&c.ParentID,
+		&c.Status,
+		&c.Author,
+		&c.Email,
+		&c.AuthorUrl,
+		&c.Body,
+		&c.IP,
+		&c.SpamScore,
+		&c.SpamRules,
+		&c.WordMatches,
+		&c.EmailMD5,
+		&c.EmailSHA256,
+		&c.CreatedAt,
+		&c.ApprovedAt,
+		&c.RejectedAt,
+		&c.DeletedAt,
+		&c.UpdatedAt,
+		&c.DecidedBy,
+		&c.DecidedVia,
+	)
+	if err == sql.ErrNoRows {
+		return Comment{}, false, nil
+	}
+	if err != nil {
+		return Comment{}, false, fmt.Errorf("get comment: %w", err)
+	}
+	return c, true, nil
+}
+
+// CountRecentSubmissions counts comments of a site created since the given time,
+// once from the same IP and once with the same body. Used by spam heuristics.
+func (d *DB) CountRecentSubmissions(ctx context.Context, siteID int64, since int64, ip, body string) (sameIP int64, sameBody int64, err error) {
+	if d == nil || d.SQL == nil {
+		return 0, 0, fmt.Errorf("db not initialized")
+	}
+
+	err = d.reader().QueryRowContext(ctx, `
+SELECT COALESCE(SUM(CASE WHEN ip = ? AND ip <> '' THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN body = ? THEN 1 ELSE 0 END), 0)
+  FROM comments
+ WHERE site_id = ?
+   AND created_at >= ?;
+`, strings.TrimSpace(ip), strings.TrimSpace(body), siteID, since).Scan(&sameIP, &sameBody)
+	if err != nil {
+		return 0, 0, fmt.Errorf("count recent submissions: %w", err)
+	}
+	return sameIP, sameBody, nil
 }
 
 // ListApprovedComments returns all approved comments for a site, ordered deterministically.
@@ -235,8 +370,8 @@ func (d *DB) ListApprovedComments(ctx context.Context, siteID int64) ([]Comment,
 		return nil, fmt.Errorf("siteID must be > 0")
 	}
 
-	rows, err := d.SQL.QueryContext(ctx, `
-SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, author_url, body, created_at, COALESCE(approved_at, 0), COALESCE(rejected_at, 0)
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, author_url, body, email_md5, email_sha256, created_at, COALESCE(approved_at, 0), COALESCE(rejected_at, 0)
   FROM comments
  WHERE site_id = ?
    AND status = 'approved'
@@ -261,6 +396,8 @@ SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, autho
 			&c.Email,
 			&c.AuthorUrl,
 			&c.Body,
+			&c.EmailMD5,
+			&c.EmailSHA256,
 			&c.CreatedAt,
 			&c.ApprovedAt,
 			&c.RejectedAt,
@@ -277,6 +414,72 @@ SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, autho
 	return out, nil
 }
 
+// CountApprovedByPostPath returns the number of approved comments per post path.
+// Every requested path is present in the result, paths without comments map to 0.
+func (d *DB) CountApprovedByPostPath(ctx context.Context, siteID int64, postPaths []string) (map[string]int64, error) {
+	return d.CountApprovedByPostPathSince(ctx, siteID, postPaths, ApprovedMarker{})
+}
+
+// CountApprovedByPostPathSince counts approved comments per post path that were
+// approved after the marker (a zero marker counts all).
+func (d *DB) CountApprovedByPostPathSince(ctx context.Context, siteID int64, postPaths []string, since ApprovedMarker) (map[string]int64, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+	if siteID <= 0 {
+		return nil, fmt.Errorf("siteID must be > 0")
+	}
+
+	out := make(map[string]int64, len(postPaths))
+	args := make([]any, 0, len(postPaths)+1)
+	args = append(args, siteID)
+	for _, p := range postPaths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, exists := out[p]; exists {
+			continue
+		}
+		out[p] = 0
+		args = append(args, p)
+	}
+	if len(out) == 0 {
+		return out, nil
+	}
+
+	inPlaceholders := strings.TrimSuffix(strings.Repeat("?,", len(out)), ",")
+	sinceCond, sinceArgs := since.condition()
+	args = append(args, sinceArgs...)
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT post_path, COUNT(1)
+  FROM comments
+ WHERE site_id = ?
+   AND status = 'approved'
+   AND post_path IN (`+inPlaceholders+`)`+sinceCond+`
+ GROUP BY post_path;
+`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("count approved by post path: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var (
+			postPath string
+			count    int64
+		)
+		if err := rows.Scan(&postPath, &count); err != nil {
+			return nil, fmt.Errorf("scan approved count: %w", err)
+		}
+		out[postPath] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate approved counts: %w", err)
+	}
+	return out, nil
+}
+
 // ParentExists checks whether a parent comment exists for the given site and post path.
 // If requireApproved is true, the parent must have status = 'approved'.
 // Returns (true, nil) if a matching parent exists, (false, nil) if not found.
@@ -305,7 +508,7 @@ SELECT 1
 	query += " LIMIT 1;"
 
 	var one int
-	err := d.SQL.QueryRowContext(ctx, query, siteID, parentID, postPath).Scan(&one)
+	err := d.reader().QueryRowContext(ctx, query, siteID, parentID, postPath).Scan(&one)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -335,7 +538,7 @@ func normalizeCommentFilter(f CommentListFilter) (CommentListFilter, error) {
 		f.Status = CommentStatusPending
 	}
 	switch f.Status {
-	case CommentStatusPending, CommentStatusApproved, CommentStatusRejected, CommentStatusSpam, CommentStatusDeleted, "all":
+	case CommentStatusPending, CommentStatusApproved, CommentStatusRejected, CommentStatusSpam, CommentStatusDeleted, CommentStatusUnconfirmed, "all":
 	default:
 		return f, fmt.Errorf("invalid status %q", f.Status)
 	}
@@ -345,6 +548,9 @@ func normalizeCommentFilter(f CommentListFilter) (CommentListFilter, error) {
 	if f.Offset < 0 {
 		return f, fmt.Errorf("offset must be >= 0")
 	}
+	if f.Since < 0 || f.Until < 0 || (f.Until > 0 && f.Since > f.Until) {
+		return f, fmt.Errorf("invalid created_at range")
+	}
 	return f, nil
 }
 
@@ -388,9 +594,17 @@ SELECT COUNT(1)
 		pattern := "%" + f.Query + "%"
 		args = append(args, pattern, pattern, pattern)
 	}
+	if f.Since > 0 {
+		query += "   AND created_at >= ?\n"
+		args = append(args, f.Since)
+	}
+	if f.Until > 0 {
+		query += "   AND created_at <= ?\n"
+		args = append(args, f.Until)
+	}
 
 	var count int64
-	if err := d.SQL.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+	if err := d.reader().QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
 		return 0, fmt.Errorf("count comments: %w", err)
 	}
 	return count, nil
@@ -435,8 +649,7 @@ SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, autho
 			args = append(args, f.Offset)
 		}
 	} else if f.Offset > 0 {
-		// SQLite needs LIMIT when OFFSET is used.
-		query += " LIMIT -1 OFFSET ?\n"
+		query += " LIMIT " + d.dialect().noLimit() + " OFFSET ?\n"
 		args = append(args, f.Offset)
 	}
 
@@ -476,24 +689,39 @@ SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, autho
 }
 */
 
+// ListComments returns the comments matching the filter, newest first.
 func (d *DB) ListComments(ctx context.Context, f CommentListFilter) ([]Comment, error) {
+	var out []Comment
+	err := d.EachComment(ctx, f, func(c Comment) error {
+		out = append(out, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EachComment calls fn for every comment matching the filter, newest first, without
+// loading the whole result into memory. An error returned by fn stops the iteration.
+func (d *DB) EachComment(ctx context.Context, f CommentListFilter, fn func(Comment) error) error {
 	if d == nil || d.SQL == nil {
-		return nil, fmt.Errorf("db not initialized")
+		return fmt.Errorf("db not initialized")
 	}
 
 	f, err := normalizeCommentFilter(f)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// Guard: no allowed sites => no results (or return an auth error if that's your policy)
 	if len(f.AllowedSiteIDs) == 0 {
-		return []Comment{}, nil
+		return nil
 	}
 
 	baseSelect := `
 SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, author_url, body, ip, created_at,
-       COALESCE(approved_at, 0), COALESCE(rejected_at, 0)
+       COALESCE(approved_at, 0), COALESCE(rejected_at, 0), COALESCE(deleted_at, 0), updated_at, decided_by, decided_via, spam_score
   FROM comments
 `
 
@@ -515,7 +743,7 @@ SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, autho
 			}
 		}
 		if !allowed {
-			return []Comment{}, nil // or return a 403-style error upstream
+			return nil // or return a 403-style error upstream
 		}
 
 		query.WriteString("site_id = ?\n")
@@ -549,6 +777,14 @@ SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, autho
 		pattern := "%" + f.Query + "%"
 		args = append(args, pattern, pattern, pattern)
 	}
+	if f.Since > 0 {
+		query.WriteString(" AND created_at >= ?\n")
+		args = append(args, f.Since)
+	}
+	if f.Until > 0 {
+		query.WriteString(" AND created_at <= ?\n")
+		args = append(args, f.Until)
+	}
 
 	query.WriteString(" ORDER BY created_at DESC, id DESC\n")
 
@@ -560,17 +796,16 @@ SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, autho
 			args = append(args, f.Offset)
 		}
 	} else if f.Offset > 0 {
-		query.WriteString(" LIMIT -1 OFFSET ?\n")
+		query.WriteString(" LIMIT " + d.dialect().noLimit() + " OFFSET ?\n")
 		args = append(args, f.Offset)
 	}
 
-	rows, err := d.SQL.QueryContext(ctx, query.String(), args...)
+	rows, err := d.reader().QueryContext(ctx, query.String(), args...)
 	if err != nil {
-		return nil, fmt.Errorf("list comments: %w", err)
+		return fmt.Errorf("list comments: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
 
-	var out []Comment
 	for rows.Next() {
 		var c Comment
 		if err := rows.Scan(
@@ -588,13 +823,20 @@ SELECT id, site_id, entry_id, post_path, parent_id, status, author, email, autho
 			&c.CreatedAt,
 			&c.ApprovedAt,
 			&c.RejectedAt,
+			&c.DeletedAt,
+			&c.UpdatedAt,
+			&c.DecidedBy,
+			&c.DecidedVia,
+			&c.SpamScore,
 		); err != nil {
-			return nil, fmt.Errorf("scan comment: %w", err)
+			return fmt.Errorf("scan comment: %w", err)
+		}
+		if err := fn(c); err != nil {
+			return err
 		}
-		out = append(out, c)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate comments: %w", err)
+		return fmt.Errorf("iterate comments: %w", err)
 	}
-	return out, nil
+	return nil
 }
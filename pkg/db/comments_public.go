@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Public list orders.
+const (
+	// OrderCreated sorts by created_at, id (thread order, as generated into the site).
+	OrderCreated = "created"
+	// OrderApproved sorts by approved_at, id (the order used by since markers).
+	OrderApproved = "approved"
+)
+
+// ApprovedMarker is a position in the approval order. With an empty ID it means
+// "approved after ApprovedAt"; with an ID it points right after that comment.
+type ApprovedMarker struct {
+	ApprovedAt int64
+	ID         string
+}
+
+// IsZero reports whether the marker is unset.
+func (m ApprovedMarker) IsZero() bool {
+	return m.ApprovedAt == 0 && m.ID == ""
+}
+
+// condition returns the SQL condition (starting with AND) selecting comments after the marker.
+func (m ApprovedMarker) condition() (string, []any) {
+	switch {
+	case m.IsZero():
+		return "", nil
+	case m.ID == "":
+		return "\n   AND approved_at > ?", []any{m.ApprovedAt}
+	default:
+		return "\n   AND (approved_at > ? OR (approved_at = ? AND id > ?))", []any{m.ApprovedAt, m.ApprovedAt, m.ID}
+	}
+}
+
+// PublicCommentFilter selects approved comments for the public list endpoint.
+type PublicCommentFilter struct {
+	SiteID   int64
+	PostPath string
+	Since    ApprovedMarker
+	// Order is OrderCreated (default) or OrderApproved.
+	Order string
+	Limit int
+}
+
+// ListPublicComments returns approved comments of a post in the requested order.
+func (d *DB) ListPublicComments(ctx context.Context, f PublicCommentFilter) ([]Comment, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+	if f.SiteID <= 0 {
+		return nil, fmt.Errorf("siteID must be > 0")
+	}
+	f.PostPath = strings.TrimSpace(f.PostPath)
+	if f.PostPath == "" {
+		return nil, fmt.Errorf("postPath is required")
+	}
+
+	orderBy := "created_at ASC, id ASC"
+	switch f.Order {
+	case "", OrderCreated:
+	case OrderApproved:
+		orderBy = "approved_at ASC, id ASC"
+	default:
+		return nil, fmt.Errorf("invalid order %q", f.Order)
+	}
+
+	sinceCond, sinceArgs := f.Since.condition()
+	args := append([]any{f.SiteID, f.PostPath}, sinceArgs...)
+	query := `
+SELECT id, site_id, entry_id, post_path, parent_id, status, author, author_url, body, email_md5, email_sha256, created_at, COALESCE(approved_at, 0)
+  FROM comments
+ WHERE site_id = ?
+   AND status = 'approved'
+   AND post_path = ?` + sinceCond + `
+ ORDER BY ` + orderBy
+	if f.Limit > 0 {
+		query += "\n LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := d.reader().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list public comments: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []Comment{}
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(
+			&c.ID,
+			&c.SiteID,
+			&c.EntryID,
+			&c.PostPath,
+			&c.ParentID,
+			&c.Status,
+			&c.Author,
+			&c.AuthorUrl,
+			&c.Body,
+			&c.EmailMD5,
+			&c.EmailSHA256,
+			&c.CreatedAt,
+			&c.ApprovedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan public comment: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate public comments: %w", err)
+	}
+	return out, nil
+}
+
+// ListOwnComments returns the pending and approved comments one commenter (by email)
+// wrote on a post, in thread order. Used for the commenter's own view; spam and
+// rejected comments are not included.
+func (d *DB) ListOwnComments(ctx context.Context, siteID int64, postPath, email string) ([]Comment, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+	if siteID <= 0 {
+		return nil, fmt.Errorf("siteID must be > 0")
+	}
+	if strings.TrimSpace(email) == "" {
+		return nil, fmt.Errorf("email is required")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT id, site_id, entry_id, post_path, parent_id, status, author, author_url, body, email_md5, email_sha256, created_at, COALESCE(approved_at, 0)
+  FROM comments
+ WHERE site_id = ?
+   AND post_path = ?
+   AND email = ?
+   AND status IN ('pending', 'approved')
+ ORDER BY created_at ASC, id ASC;
+`, siteID, strings.TrimSpace(postPath), email)
+	if err != nil {
+		return nil, fmt.Errorf("list own comments: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []Comment{}
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(
+			&c.ID,
+			&c.SiteID,
+			&c.EntryID,
+			&c.PostPath,
+			&c.ParentID,
+			&c.Status,
+			&c.Author,
+			&c.AuthorUrl,
+			&c.Body,
+			&c.EmailMD5,
+			&c.EmailSHA256,
+			&c.CreatedAt,
+			&c.ApprovedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan own comment: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate own comments: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// confirmComment moves an unconfirmed comment created at or after notBefore into
+// the moderation queue. It returns false if the comment is unknown, already
+// confirmed or expired. ex may be a transaction.
+func confirmComment(ctx context.Context, ex execer, siteID int64, commentID string, notBefore int64) (bool, error) {
+	res, err := ex.ExecContext(ctx, `
+UPDATE comments
+   SET status = ?, updated_at = ?
+ WHERE site_id = ?
+   AND id = ?
+   AND status = ?
+   AND created_at >= ?;
+`, CommentStatusPending, time.Now().Unix(), siteID, commentID, CommentStatusUnconfirmed, notBefore)
+	if err != nil {
+		return false, fmt.Errorf("confirm comment: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("confirm comment rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// DeleteExpiredUnconfirmed removes unconfirmed comments of a site created before the given time.
+// Replies to them are removed by the foreign key cascade.
+func (d *DB) DeleteExpiredUnconfirmed(ctx context.Context, siteID int64, before int64) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `
+DELETE FROM comments
+ WHERE site_id = ?
+   AND status = ?
+   AND created_at < ?;
+`, siteID, CommentStatusUnconfirmed, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired unconfirmed comments: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete expired unconfirmed comments rows affected: %w", err)
+	}
+	return n, nil
+}
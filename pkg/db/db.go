@@ -1,60 +1,136 @@
 ﻿package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 
 	_ "modernc.org/sqlite"
 )
 
-// DB wraps *sql.DB for now (keeps options open for later).
+// SchemaVersion is stored by Migrate (in PRAGMA user_version on SQLite) and written
+// into state exports. Bump it whenever the schema changes.
+const SchemaVersion = 25
+
+// readConns is the size of the read pool.
+const readConns = 4
+
+// DB holds two pools on the same SQLite file: SQL is the single writer connection,
+// Read serves queries. SQLite allows only one writer at a time; funnelling all writes
+// through one connection whose transactions start with BEGIN IMMEDIATE makes them
+// queue in Go instead of failing with "database is locked" when a deferred
+// transaction tries to upgrade its lock. In WAL mode readers never block the writer.
+// Other backends (see OpenPostgres) use a single pool in SQL and leave Read nil.
 type DB struct {
-	SQL *sql.DB
+	SQL  *sql.DB
+	Read *sql.DB
+
+	sqlDialect dialect
+	// path is the SQLite file, "" for other backends.
+	path string
+
+	syncMu   sync.Mutex
+	lastSync *SyncSummary
 }
 
-// Open performs its package-specific operation.
+// Open opens the writer and the read pool.
 func Open(sqlitePath string) (*DB, error) {
+	// Pragmas (sane defaults for a small web backend) are part of the DSN, so they are
+	// applied to every connection of the pool, not only to the first one.
+	// WAL helps concurrency; foreign_keys for referential integrity; busy_timeout avoids "database is locked".
+	writer, err := openPool(sqlitePath, 1,
+		"_txlock=immediate",
+		"_pragma=journal_mode(WAL)",
+		"_pragma=foreign_keys(1)",
+		"_pragma=busy_timeout(5000)",
+		"_pragma=synchronous(NORMAL)",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Opened after the writer, which switches the file to WAL mode.
+	reader, err := openPool(sqlitePath, readConns,
+		"_pragma=foreign_keys(1)",
+		"_pragma=busy_timeout(5000)",
+		"_pragma=query_only(1)",
+	)
+	if err != nil {
+		_ = writer.Close()
+		return nil, err
+	}
+
+	return &DB{SQL: writer, Read: reader, sqlDialect: sqliteDialect{}, path: sqlitePath}, nil
+}
+
+// openPool opens a connection pool with the given DSN parameters and checks it.
+func openPool(sqlitePath string, maxConns int, params ...string) (*sql.DB, error) {
 	// modernc sqlite DSN: "file:<path>?_pragma=..."
-	// Keep it simple and apply pragmas explicitly after open.
-	dsn := fmt.Sprintf("file:%s", sqlitePath)
+	dsn := fmt.Sprintf("file:%s?%s", sqlitePath, strings.Join(params, "&"))
 
 	sqlDB, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite: %w", err)
 	}
+	sqlDB.SetMaxOpenConns(maxConns)
+	sqlDB.SetMaxIdleConns(maxConns)
 
 	// Basic health check
 	if err := sqlDB.Ping(); err != nil {
 		_ = sqlDB.Close()
 		return nil, fmt.Errorf("ping sqlite: %w", err)
 	}
+	return sqlDB, nil
+}
 
-	// Pragmas (sane defaults for a small web backend)
-	// WAL helps concurrency; foreign_keys for referential integrity; busy_timeout avoids "database is locked".
-	pragmas := []string{
-		"PRAGMA journal_mode = WAL;",
-		"PRAGMA foreign_keys = ON;",
-		"PRAGMA busy_timeout = 5000;",
-		"PRAGMA synchronous = NORMAL;",
-	}
-
-	for _, p := range pragmas {
-		if _, err := sqlDB.Exec(p); err != nil {
-			_ = sqlDB.Close()
-			return nil, fmt.Errorf("apply pragma (%s): %w", p, err)
-		}
+// reader returns the pool for read-only queries. Queries inside a write
+// transaction must use the transaction instead.
+func (d *DB) reader() *sql.DB {
+	if d.Read != nil {
+		return d.Read
 	}
-
-	return &DB{SQL: sqlDB}, nil
+	return d.SQL
 }
 
-// Close performs its package-specific operation.
+// Close closes both pools.
 func (d *DB) Close() error {
 	if d == nil || d.SQL == nil {
 		return nil
 	}
-	return d.SQL.Close()
+	var readErr error
+	if d.Read != nil {
+		readErr = d.Read.Close()
+	}
+	if err := d.SQL.Close(); err != nil {
+		return err
+	}
+	return readErr
+}
+
+// CheckWritable verifies that the database accepts writes: it rewrites the schema
+// version inside a transaction and rolls it back, so nothing changes.
+func (d *DB) CheckWritable(ctx context.Context) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	version, err := d.dialect().schemaVersion(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if err := d.dialect().setSchemaVersion(ctx, tx, version); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
 }
 
 // Migrate creates tables if they do not exist.
@@ -62,9 +138,82 @@ func (d *DB) Migrate() error {
 	if d == nil || d.SQL == nil {
 		return fmt.Errorf("db not initialized")
 	}
+	ctx := context.Background()
+
+	for _, s := range d.dialect().schema() {
+		if _, err := d.SQL.Exec(s); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+
+	// Columns added after the initial schema; existing databases get them via ALTER TABLE.
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"pipeline_runs", "coalesced_into", "INTEGER"},
+		{"pipeline_runs", "attempts", "INTEGER NOT NULL DEFAULT 0"},
+		{"pipeline_runs", "next_retry_at", "INTEGER"},
+		{"pipeline_runs", "deploy_status", "INTEGER"},
+		{"pipeline_runs", "dry_run", "INTEGER NOT NULL DEFAULT 0"},
+		{"comments", "spam_score", "INTEGER NOT NULL DEFAULT 0"},
+		{"comments", "spam_rules", "TEXT NOT NULL DEFAULT ''"},
+		{"comments", "word_matches", "TEXT NOT NULL DEFAULT ''"},
+		{"comments", "email_md5", "TEXT NOT NULL DEFAULT ''"},
+		{"comments", "email_sha256", "TEXT NOT NULL DEFAULT ''"},
+		{"comments", "deleted_at", "INTEGER"},
+		{"comments", "decided_by", "TEXT NOT NULL DEFAULT ''"},
+		{"comments", "decided_via", "TEXT NOT NULL DEFAULT ''"},
+		{"sites", "pipeline_paused_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"sites", "summary_sent_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "last_login_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "must_change_password", "INTEGER NOT NULL DEFAULT 0"},
+		{"users", "password_changed_at", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, col := range columns {
+		if err := d.addColumnIfMissing(ctx, col.table, col.column, col.definition); err != nil {
+			return fmt.Errorf("migrate: %w", err)
+		}
+	}
+
+	if err := d.backfillEmailHashes(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	// Comments deleted before deleted_at existed count as deleted at their last update.
+	if _, err := d.SQL.ExecContext(ctx, `UPDATE comments SET deleted_at = updated_at WHERE status = ? AND deleted_at IS NULL;`, CommentStatusDeleted); err != nil {
+		return fmt.Errorf("migrate: backfill deleted_at: %w", err)
+	}
 
-	stmts := []string{
-		`
+	if err := d.dialect().setSchemaVersion(ctx, d.SQL, SchemaVersion); err != nil {
+		return fmt.Errorf("migrate: set schema version: %w", err)
+	}
+
+	log.Printf("%s migration done", d.Driver())
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table. definition uses SQLite types.
+// SQLite has no "ADD COLUMN IF NOT EXISTS", so the table info is checked first.
+func (d *DB) addColumnIfMissing(ctx context.Context, table, column, definition string) error {
+	cols, err := d.dialect().tableColumns(ctx, d.SQL, table)
+	if err != nil {
+		return fmt.Errorf("table info %s: %w", table, err)
+	}
+	if _, ok := cols[column]; ok {
+		return nil
+	}
+
+	if _, err := d.SQL.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, d.dialect().columnType(definition))); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// sqliteSchema holds the statements of Migrate that create the tables and indexes.
+// Keep postgresSchema and mysqlSchema in sync.
+var sqliteSchema = []string{
+	`
 CREATE TABLE IF NOT EXISTS comments (
   id            TEXT PRIMARY KEY,
   site_id       INTEGER NOT NULL,
@@ -77,6 +226,7 @@ CREATE TABLE IF NOT EXISTS comments (
   author_url    TEXT,
   body          TEXT NOT NULL,
 	ip            TEXT NOT NULL DEFAULT '',
+  spam_score    INTEGER NOT NULL DEFAULT 0,
   created_at    INTEGER NOT NULL,
   approved_at   INTEGER,
   rejected_at   INTEGER,
@@ -88,28 +238,87 @@ CREATE TABLE IF NOT EXISTS comments (
 );
 
 `,
-		`CREATE INDEX IF NOT EXISTS idx_comments_site_status_created ON comments(site_id, status, created_at);`,
-		`CREATE INDEX IF NOT EXISTS idx_comments_site_post_created   ON comments(site_id, post_path, created_at);`,
-		`CREATE INDEX IF NOT EXISTS idx_comments_site_parent_created ON comments(site_id, parent_id, created_at);`,
-		`CREATE INDEX IF NOT EXISTS idx_comments_site_ip_created ON comments(site_id, ip, created_at);`,
-		`
+	`CREATE INDEX IF NOT EXISTS idx_comments_site_status_created ON comments(site_id, status, created_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_comments_site_post_created   ON comments(site_id, post_path, created_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_comments_site_status_approved ON comments(site_id, status, approved_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_comments_site_parent_created ON comments(site_id, parent_id, created_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_comments_site_ip_created ON comments(site_id, ip, created_at);`,
+	`
 CREATE TABLE IF NOT EXISTS pipeline_runs (
   id                  INTEGER PRIMARY KEY,
   site_id             INTEGER NOT NULL,
   trigger_comment_id  TEXT,
 
-  state               TEXT NOT NULL,        -- queued|running|success|failed
+  state               TEXT NOT NULL,        -- queued|running|success|failed|coalesced|paused|retrying|cancelled
   step                TEXT,                -- checkout|hugo|commit|push
   error_message       TEXT,
 
   created_at          INTEGER NOT NULL,
   started_at          INTEGER,
-  finished_at         INTEGER
+  finished_at         INTEGER,
+  coalesced_into      INTEGER,
+  deploy_status       INTEGER,              -- HTTP status of the deploy hook
+  dry_run             INTEGER NOT NULL DEFAULT 0  -- 1 = commit and push were skipped
 );
 `,
-		`CREATE INDEX IF NOT EXISTS idx_runs_site_created  ON pipeline_runs(site_id, created_at);`,
-		`CREATE INDEX IF NOT EXISTS idx_runs_state_created ON pipeline_runs(state, created_at);`,
-		`
+	`CREATE INDEX IF NOT EXISTS idx_runs_site_created  ON pipeline_runs(site_id, created_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_runs_state_created ON pipeline_runs(state, created_at);`,
+	`
+CREATE TABLE IF NOT EXISTS pipeline_run_logs (
+  id          INTEGER PRIMARY KEY,
+  run_id      INTEGER NOT NULL,
+  step        TEXT NOT NULL,
+  content     TEXT NOT NULL,
+  created_at  INTEGER NOT NULL,
+
+  FOREIGN KEY(run_id) REFERENCES pipeline_runs(id) ON DELETE CASCADE
+);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_run_logs_run ON pipeline_run_logs(run_id, id);`,
+	`
+CREATE TABLE IF NOT EXISTS pipeline_run_files (
+  run_id      INTEGER NOT NULL,
+  action      TEXT NOT NULL,              -- created|updated|removed
+  path        TEXT NOT NULL,              -- relative to the site root
+
+  PRIMARY KEY(run_id, path),
+  FOREIGN KEY(run_id) REFERENCES pipeline_runs(id) ON DELETE CASCADE
+);
+`,
+	`
+CREATE TABLE IF NOT EXISTS generated_bundles (
+  site_id     INTEGER NOT NULL,
+  post_path   TEXT NOT NULL,              -- bundle path below content/
+  hash        TEXT NOT NULL,              -- sha256 of the generated comment files
+  updated_at  INTEGER NOT NULL,
+
+  PRIMARY KEY(site_id, post_path),
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+);
+`,
+	`
+CREATE TABLE IF NOT EXISTS mail_outbox (
+  id               INTEGER PRIMARY KEY,
+  site_id          INTEGER NOT NULL,
+  comment_id       TEXT NOT NULL,
+  kind             TEXT NOT NULL,             -- moderation|confirmation
+  base_url         TEXT NOT NULL DEFAULT '',  -- public base URL for the links in the mail
+
+  status           TEXT NOT NULL,             -- pending|sent|failed|skipped
+  attempts         INTEGER NOT NULL DEFAULT 0,
+  last_error       TEXT,
+  next_attempt_at  INTEGER NOT NULL,
+
+  created_at       INTEGER NOT NULL,
+  updated_at       INTEGER NOT NULL,
+
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE,
+  FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_mail_outbox_status_next ON mail_outbox(status, next_attempt_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_mail_outbox_comment ON mail_outbox(comment_id);`,
+	`
 CREATE TABLE IF NOT EXISTS users (
   id            INTEGER PRIMARY KEY,
   password      TEXT NOT NULL,
@@ -120,9 +329,9 @@ CREATE TABLE IF NOT EXISTS users (
   updated_at  INTEGER NOT NULL
 );
 `,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email    ON users(email);`,
-		`CREATE INDEX        IF NOT EXISTS idx_users_updated  ON users(updated_at);`,
-		`
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email    ON users(email);`,
+	`CREATE INDEX        IF NOT EXISTS idx_users_updated  ON users(updated_at);`,
+	`
 CREATE TABLE IF NOT EXISTS sites (
   id            INTEGER PRIMARY KEY,
 	site_key			TEXT NOT NULL,
@@ -132,9 +341,9 @@ CREATE TABLE IF NOT EXISTS sites (
   updated_at  INTEGER NOT NULL
 	);
 `,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_sites_key ON sites(site_key);`,
-		`CREATE INDEX IF NOT EXISTS idx_sites_updated ON sites(updated_at);`,
-		`
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_sites_key ON sites(site_key);`,
+	`CREATE INDEX IF NOT EXISTS idx_sites_updated ON sites(updated_at);`,
+	`
 CREATE TABLE IF NOT EXISTS user_sites (
   user_id INTEGER NOT NULL,
   site_id INTEGER NOT NULL,
@@ -143,15 +352,152 @@ CREATE TABLE IF NOT EXISTS user_sites (
   FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
 );
 `,
-		`CREATE INDEX IF NOT EXISTS idx_user_sites_site ON user_sites(site_id);`,
-	}
+	`CREATE INDEX IF NOT EXISTS idx_user_sites_site ON user_sites(site_id);`,
+	`
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id            INTEGER PRIMARY KEY,
+  user_id       INTEGER NOT NULL,
+  name          TEXT NOT NULL DEFAULT '',
+  prefix        TEXT NOT NULL,
+  scopes        TEXT NOT NULL DEFAULT '',   -- comma-separated, empty = all
+  token_hash    TEXT NOT NULL,              -- hex SHA-256 of the token
+  expires_at    INTEGER,
+  last_used_at  INTEGER,
+  created_at    INTEGER NOT NULL,
+  revoked_at    INTEGER,
 
-	for _, s := range stmts {
-		if _, err := d.SQL.Exec(s); err != nil {
-			return fmt.Errorf("migrate: %w", err)
-		}
-	}
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_hash ON api_tokens(token_hash);`,
+	`CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);`,
+	`
+CREATE TABLE IF NOT EXISTS user_identities (
+  id             INTEGER PRIMARY KEY,
+  user_id        INTEGER NOT NULL,
+  issuer         TEXT NOT NULL,              -- OIDC issuer URL
+  subject        TEXT NOT NULL,              -- "sub" claim
+  email          TEXT NOT NULL DEFAULT '',
+  created_at     INTEGER NOT NULL,
+  last_login_at  INTEGER,
 
-	log.Println("sqlite migration done")
-	return nil
+  UNIQUE(issuer, subject),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);`,
+	`
+CREATE TABLE IF NOT EXISTS sessions (
+  id            TEXT PRIMARY KEY,
+  user_id       INTEGER,                    -- NULL before the login
+  data          BLOB NOT NULL,              -- encoded session values
+  ip            TEXT NOT NULL DEFAULT '',
+  user_agent    TEXT NOT NULL DEFAULT '',
+  created_at    INTEGER NOT NULL,
+  last_seen_at  INTEGER NOT NULL,
+  expires_at    INTEGER NOT NULL,
+
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions(expires_at);`,
+	`
+CREATE TABLE IF NOT EXISTS login_history (
+  id          INTEGER PRIMARY KEY,
+  user_id     INTEGER NOT NULL,
+  success     INTEGER NOT NULL,           -- 1 = logged in, 0 = rejected
+  method      TEXT NOT NULL,              -- password|oidc
+  ip          TEXT NOT NULL DEFAULT '',
+  user_agent  TEXT NOT NULL DEFAULT '',
+  created_at  INTEGER NOT NULL,
+
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_login_history_user ON login_history(user_id, id);`,
+	`
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id                INTEGER PRIMARY KEY,
+  site_id           INTEGER NOT NULL,
+  event             TEXT NOT NULL,
+  url               TEXT NOT NULL,
+  payload           TEXT NOT NULL,
+
+  status            TEXT NOT NULL,        -- pending|delivered|failed
+  attempts          INTEGER NOT NULL DEFAULT 0,
+  last_status_code  INTEGER,
+  last_error        TEXT,
+
+  created_at        INTEGER NOT NULL,
+  updated_at        INTEGER NOT NULL,
+
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+);
+`,
+	`
+CREATE TABLE IF NOT EXISTS blocklist (
+  id          INTEGER PRIMARY KEY,
+  site_id     INTEGER NOT NULL,
+  kind        TEXT NOT NULL,              -- email|email_domain|ip|url_domain
+  value       TEXT NOT NULL,
+  note        TEXT NOT NULL DEFAULT '',
+  created_by  INTEGER,
+  created_at  INTEGER NOT NULL,
+
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+);
+`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_blocklist_site_kind_value ON blocklist(site_id, kind, value);`,
+	`
+CREATE TABLE IF NOT EXISTS comment_revisions (
+  id          INTEGER PRIMARY KEY,
+  site_id     INTEGER NOT NULL,
+  comment_id  TEXT NOT NULL,
+  field       TEXT NOT NULL,              -- author|body|author_url|...
+  old_value   TEXT NOT NULL,
+  new_value   TEXT NOT NULL,
+  reason      TEXT NOT NULL DEFAULT '',
+  changed_by  INTEGER,                    -- users.id, NULL for system changes
+  created_at  INTEGER NOT NULL,
+
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_comment_revisions_comment ON comment_revisions(site_id, comment_id, id);`,
+	`
+CREATE TABLE IF NOT EXISTS audit_log (
+  id          INTEGER PRIMARY KEY,
+  user_id     INTEGER,                    -- users.id, NULL for system actions
+  site_id     INTEGER,
+  action      TEXT NOT NULL,
+  details     TEXT NOT NULL DEFAULT '',   -- JSON
+  created_at  INTEGER NOT NULL
+);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);`,
+	`
+CREATE TABLE IF NOT EXISTS captcha_challenges (
+  id          TEXT PRIMARY KEY,
+  answer      TEXT NOT NULL,
+  created_at  INTEGER NOT NULL,
+  expires_at  INTEGER NOT NULL
+);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_captcha_challenges_expires ON captcha_challenges(expires_at);`,
+	`
+CREATE TABLE IF NOT EXISTS spam_rule_feedback (
+  site_id     INTEGER NOT NULL,
+  rule        TEXT NOT NULL,
+  spam_count  INTEGER NOT NULL DEFAULT 0,   -- moderator confirmed spam
+  ham_count   INTEGER NOT NULL DEFAULT 0,   -- moderator rescued from spam
+  updated_at  INTEGER NOT NULL,
+
+  PRIMARY KEY(site_id, rule),
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+);
+`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_log_site_created ON audit_log(site_id, created_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_site_created ON webhook_deliveries(site_id, created_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status       ON webhook_deliveries(status, created_at);`,
 }
@@ -0,0 +1,1443 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestOpenSplitsReadersAndWriter(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.Read.ExecContext(ctx, `INSERT INTO sites (site_key, title, status, created_at, updated_at) VALUES ('x', '', 'active', 0, 0);`); err == nil {
+		t.Fatal("write through the read pool succeeded")
+	}
+
+	// Concurrent write transactions must queue instead of failing with SQLITE_BUSY.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := d.SyncSites(ctx, map[string]string{fmt.Sprintf("site%d", i): "t"}, SyncOptions{KeepMissing: true})
+			errs <- err
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.ListSites(ctx); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncSitesSummary(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	s, err := d.SyncSites(ctx, map[string]string{"a": "A", "b": "B"}, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(s.Inserted) != "[a b]" {
+		t.Fatalf("Inserted = %v", s.Inserted)
+	}
+
+	// b missing, kept active.
+	s, err = d.SyncSites(ctx, map[string]string{"a": "A"}, SyncOptions{KeepMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(s.Missing) != "[b]" || len(s.Disabled) != 0 || fmt.Sprint(s.Unchanged) != "[a]" {
+		t.Fatalf("summary = %+v", s)
+	}
+
+	// b missing, disabled.
+	s, err = d.SyncSites(ctx, map[string]string{"a": "A"}, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(s.Disabled) != "[b]" {
+		t.Fatalf("Disabled = %v", s.Disabled)
+	}
+
+	// b back, enabled.
+	s, err = d.SyncSites(ctx, map[string]string{"a": "A", "b": "B"}, SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(s.Enabled) != "[b]" {
+		t.Fatalf("Enabled = %v", s.Enabled)
+	}
+
+	last, ok := d.LastSyncSummary()
+	if !ok || fmt.Sprint(last.Enabled) != "[b]" {
+		t.Fatalf("LastSyncSummary = %+v, %v", last, ok)
+	}
+}
+
+func TestPausedRunsAreHeldAndReleased(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	first, _ := d.CreateRun(siteID, "")
+	if held, err := d.HoldRunIfPaused(ctx, first, siteID); err != nil || held {
+		t.Fatalf("run held on a running pipeline (held=%t err=%v)", held, err)
+	}
+
+	if changed, err := d.SetPipelinePaused(ctx, siteID, true); err != nil || !changed {
+		t.Fatalf("pause: changed=%t err=%v", changed, err)
+	}
+	if changed, _ := d.SetPipelinePaused(ctx, siteID, true); changed {
+		t.Fatal("pausing twice reported a change")
+	}
+
+	second, _ := d.CreateRun(siteID, "")
+	third, _ := d.CreateRun(siteID, "")
+	for _, id := range []int64{second, third} {
+		if held, err := d.HoldRunIfPaused(ctx, id, siteID); err != nil || !held {
+			t.Fatalf("run %d not held (err=%v)", id, err)
+		}
+	}
+	if n, _ := d.CountPausedRuns(ctx, siteID); n != 2 {
+		t.Fatalf("expected 2 paused runs, got %d", n)
+	}
+
+	if _, err := d.SetPipelinePaused(ctx, siteID, false); err != nil {
+		t.Fatal(err)
+	}
+	runID, released, err := d.ReleasePausedRuns(ctx, siteID)
+	if err != nil || !released || runID != third {
+		t.Fatalf("release: run=%d released=%t err=%v", runID, released, err)
+	}
+	var state string
+	_ = d.SQL.QueryRow(`SELECT state FROM pipeline_runs WHERE id = ?`, second).Scan(&state)
+	if state != RunCoalesced {
+		t.Fatalf("older paused run has state %q, want %q", state, RunCoalesced)
+	}
+	if _, released, _ := d.ReleasePausedRuns(ctx, siteID); released {
+		t.Fatal("second release found a paused run")
+	}
+}
+
+func TestSiteStatsAndSummaryClaim(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	for i, c := range []struct {
+		post, status string
+		created      int64
+	}{
+		{"/a/", CommentStatusPending, 100},
+		{"/a/", CommentStatusPending, 110},
+		{"/b/", CommentStatusPending, 120},
+		{"/b/", CommentStatusSpam, 130},
+		{"/c/", CommentStatusPending, 50}, // before the period
+	} {
+		cm := Comment{ID: fmt.Sprintf("c%d", i), SiteID: siteID, PostPath: c.post, Status: c.status, Author: "a", Email: "a@example.org", Body: "b", CreatedAt: c.created}
+		if err := d.InsertComment(ctx, cm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.ApproveComment(ctx, siteID, "c0", Decision{}); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := d.SiteStats(ctx, siteID, 100, 200, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.NewComments != 4 || st.Spam != 1 || st.Pending != 3 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+	if len(st.TopPosts) != 1 || st.TopPosts[0].PostPath != "/a/" || st.TopPosts[0].Comments != 2 {
+		t.Fatalf("unexpected top posts %+v", st.TopPosts)
+	}
+
+	if ok, err := d.ClaimSummary(ctx, siteID, 200); err != nil || !ok {
+		t.Fatalf("first claim: ok=%t err=%v", ok, err)
+	}
+	if ok, _ := d.ClaimSummary(ctx, siteID, 200); ok {
+		t.Fatal("summary claimed twice for the same period")
+	}
+}
+
+func TestCheckFindsAndFixesInconsistencies(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	report, err := d.Check(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || len(report.Issues) != 0 {
+		t.Fatalf("expected a clean report, got %+v", report)
+	}
+
+	// Orphans can only appear with foreign keys disabled, e.g. after manual edits.
+	for _, q := range []string{
+		`PRAGMA foreign_keys = OFF;`,
+		fmt.Sprintf(`INSERT INTO comments (id, site_id, post_path, parent_id, status, author, email, body, created_at, updated_at) VALUES ('reply', %d, '/a/', 'gone', 'pending', 'a', 'a@example.org', 'b', 1, 2);`, siteID),
+		fmt.Sprintf(`INSERT INTO comments (id, site_id, post_path, status, author, email, body, created_at, updated_at) VALUES ('ok', %d, '/a/', 'approved', 'a', 'a@example.org', 'b', 1, 5);`, siteID),
+		`INSERT INTO comments (id, site_id, post_path, status, author, email, body, created_at, updated_at) VALUES ('lost', 999, '/a/', 'pending', 'a', 'a@example.org', 'b', 1, 2);`,
+		`INSERT INTO pipeline_runs (id, site_id, state, created_at) VALUES (7, 999, 'success', 1);`,
+		`INSERT INTO pipeline_run_logs (run_id, step, content, created_at) VALUES (8, 'hugo', 'x', 1);`,
+		`INSERT INTO user_sites (user_id, site_id) VALUES (42, 999);`,
+		`INSERT INTO sessions (id, user_id, data, created_at, last_seen_at, expires_at) VALUES ('s', 42, x'00', 1, 1, 2);`,
+		`PRAGMA foreign_keys = ON;`,
+	} {
+		if _, err := d.SQL.ExecContext(ctx, q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	report, err = d.Check(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]CheckIssue{}
+	for _, is := range report.Issues {
+		got[is.Check] = is
+	}
+	for _, name := range []string{"comments with missing parent", "approved comments without approved_at", "pipeline runs with missing site", "run logs with missing run", "sessions with missing users", "user_sites with missing users", "user_sites with missing sites"} {
+		if is := got[name]; is.Count != 1 || is.Fixed != 1 {
+			t.Fatalf("%s: expected 1 fixed, got %+v", name, is)
+		}
+	}
+	if is := got["comments with missing site"]; is.Count != 1 || is.Fixable || is.Fixed != 0 || is.Hint == "" {
+		t.Fatalf("expected an unfixable missing site, got %+v", is)
+	}
+	if report.OK() {
+		t.Fatal("report with an unfixable issue must not be OK")
+	}
+
+	c, _, err := d.GetComment(ctx, siteID, "ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ApprovedAt != 5 {
+		t.Fatalf("expected approved_at from updated_at, got %v", c.ApprovedAt)
+	}
+
+	report, err = d.Check(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Check != "comments with missing site" {
+		t.Fatalf("expected only the missing site to remain, got %+v", report.Issues)
+	}
+}
+
+func TestPurgeComments(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+	for _, c := range []struct{ id, parent string }{{"old", ""}, {"p", ""}, {"r", "p"}, {"r2", "r"}} {
+		if err := d.InsertComment(ctx, Comment{ID: c.id, SiteID: siteID, PostPath: "/a/", ParentID: sql.NullString{String: c.parent, Valid: c.parent != ""}, Status: CommentStatusPending, Author: "a", Email: "a@example.org", Body: "b"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := insertCommentRevision(ctx, d.SQL, CommentRevision{SiteID: siteID, CommentID: "p", Field: "body", OldValue: "x", NewValue: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A deleted comment keeps its row and can be moderated again.
+	if changed, err := d.DeleteComment(ctx, siteID, "p", Decision{}); err != nil || !changed {
+		t.Fatalf("delete: %v, %v", changed, err)
+	}
+	if c, _, err := d.GetComment(ctx, siteID, "p"); err != nil || c.Status != CommentStatusDeleted || c.DeletedAt == 0 {
+		t.Fatalf("deleted comment: %+v, %v", c, err)
+	}
+	if _, err := d.ApproveComment(ctx, siteID, "p", AdminDecision(42)); err != nil {
+		t.Fatal(err)
+	}
+	if c, _, err := d.GetComment(ctx, siteID, "p"); err != nil || c.Status != CommentStatusApproved || c.DeletedAt != 0 {
+		t.Fatalf("restored comment: %+v, %v", c, err)
+	} else if c.DecidedBy != "42" || c.DecidedVia != DecidedViaAdminAPI || c.UpdatedAt == 0 {
+		t.Fatalf("decision of restored comment: by=%q via=%q updated=%d", c.DecidedBy, c.DecidedVia, c.UpdatedAt)
+	}
+	for _, id := range []string{"old", "p", "r2"} {
+		if _, err := d.DeleteComment(ctx, siteID, id, Decision{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.SQL.ExecContext(ctx, `UPDATE comments SET deleted_at = 100 WHERE id = 'old';`); err != nil {
+		t.Fatal(err)
+	}
+
+	before := PurgeFilter{SiteID: siteID, DeletedBefore: nowUnix() - 3600}
+	if n, err := d.CountPurgeableComments(ctx, before); err != nil || n != 1 {
+		t.Fatalf("count purgeable: %d, %v", n, err)
+	}
+	if ids, err := d.PurgeComments(ctx, before); err != nil || len(ids) != 1 || ids[0] != "old" {
+		t.Fatalf("purge by age: %v, %v", ids, err)
+	}
+	if ids, err := d.PurgeComments(ctx, PurgeFilter{SiteID: siteID, IDs: []string{"p", "r"}, UserID: 1}); err != nil || len(ids) != 1 || ids[0] != "p" {
+		t.Fatalf("purge by id: %v, %v", ids, err)
+	}
+
+	// The kept reply survives its purged parent as a top-level comment.
+	c, found, err := d.GetComment(ctx, siteID, "r")
+	if err != nil || !found || c.ParentID.Valid {
+		t.Fatalf("reply of purged comment: %+v, %v, %v", c, found, err)
+	}
+	if _, found, _ := d.GetComment(ctx, siteID, "r2"); !found {
+		t.Fatal("deleted comment not selected for the purge was removed")
+	}
+	if revs, err := d.ListCommentRevisions(ctx, siteID, "p"); err != nil || len(revs) != 0 {
+		t.Fatalf("revisions of purged comment: %v, %v", revs, err)
+	}
+	var audits int
+	if err := d.SQL.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_log WHERE action = ?;`, AuditCommentPurge).Scan(&audits); err != nil || audits != 2 {
+		t.Fatalf("purge audit entries: %d, %v", audits, err)
+	}
+	if ids, err := d.PurgeComments(ctx, PurgeFilter{SiteID: siteID, IDs: []string{"r"}}); err != nil || len(ids) != 0 {
+		t.Fatalf("purge of a comment that is not deleted: %v, %v", ids, err)
+	}
+}
+
+func TestEditPendingComment(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+	for _, c := range []Comment{
+		{ID: "c1", SiteID: siteID, PostPath: "/a/", Status: CommentStatusPending, Author: "Ada", Email: "a@example.org", AuthorUrl: sql.NullString{String: "https://ada.example", Valid: true}, Body: "call 555-1234"},
+		{ID: "c2", SiteID: siteID, PostPath: "/a/", Status: CommentStatusApproved, Author: "Bob", Email: "b@example.org", Body: "b"},
+	} {
+		if err := d.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	author, authorURL, body := "Ada", "", "call me"
+	fields, ok, err := d.EditPendingComment(ctx, CommentEdit{SiteID: siteID, CommentID: "c1", Author: &author, AuthorURL: &authorURL, Body: &body, UserID: 7})
+	if err != nil || !ok || fmt.Sprint(fields) != "[author_url body]" {
+		t.Fatalf("edit: %v, %v, %v", fields, ok, err)
+	}
+	c, _, _ := d.GetComment(ctx, siteID, "c1")
+	if c.Body != "call me" || c.AuthorUrl.Valid || c.Author != "Ada" {
+		t.Fatalf("edited comment: %+v", c)
+	}
+	revs, err := d.ListCommentRevisions(ctx, siteID, "c1")
+	if err != nil || len(revs) != 2 || revs[1].OldValue != "call 555-1234" || revs[1].Reason != RevisionReasonModeratorEdit || revs[1].ChangedBy != 7 {
+		t.Fatalf("revisions: %+v, %v", revs, err)
+	}
+
+	// Unchanged values write nothing; moderated comments cannot be edited.
+	if fields, ok, err := d.EditPendingComment(ctx, CommentEdit{SiteID: siteID, CommentID: "c1", Body: &body}); err != nil || !ok || len(fields) != 0 {
+		t.Fatalf("unchanged edit: %v, %v, %v", fields, ok, err)
+	}
+	if _, ok, err := d.EditPendingComment(ctx, CommentEdit{SiteID: siteID, CommentID: "c2", Body: &body}); err != nil || ok {
+		t.Fatalf("edit approved: %v, %v", ok, err)
+	}
+}
+
+func TestEmailHashes(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	// Reference values from the Gravatar documentation.
+	const wantMD5 = "0bc83cb571cd1c50ba6f3e8a78ef1346"
+	const wantSHA = "84059b07d4be67b806386c0aad8070a23f18836bbaae342275dc0a83414c32ee"
+	if m, s := EmailHashes(" MyEmailAddress@example.com "); m != wantMD5 || s != wantSHA {
+		t.Fatalf("unexpected hashes %s %s", m, s)
+	}
+
+	if err := d.InsertComment(ctx, Comment{ID: "c1", SiteID: siteID, PostPath: "/a/", Status: CommentStatusApproved, Author: "a", Email: "MyEmailAddress@example.com", Body: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := d.GetComment(ctx, siteID, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.EmailMD5 != wantMD5 || c.EmailSHA256 != wantSHA {
+		t.Fatalf("unexpected stored hashes %q %q", c.EmailMD5, c.EmailSHA256)
+	}
+
+	// Comments from before the hash columns are filled in by the next migration.
+	if _, err := d.SQL.ExecContext(ctx, `UPDATE comments SET email_md5 = '', email_sha256 = '';`); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	list, err := d.ListApprovedComments(ctx, siteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].EmailSHA256 != wantSHA {
+		t.Fatalf("expected backfilled hashes, got %+v", list)
+	}
+}
+
+func TestPseudonymizeAuthor(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog", "docs": "Docs"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	blogID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+	docsID, _, _ := d.GetSiteIDByKey(ctx, "docs")
+
+	homepage := sql.NullString{String: "https://bob.example/", Valid: true}
+	for _, c := range []Comment{
+		{ID: "c1", SiteID: blogID, PostPath: "/a/", Status: CommentStatusApproved, Author: "Bob", Email: "Bob@Example.org", AuthorUrl: homepage, IP: "192.0.2.1"},
+		{ID: "c2", SiteID: blogID, PostPath: "/b/", Status: CommentStatusPending, Author: "Bobby", Email: "bob@example.org", IP: "192.0.2.2"},
+		{ID: "c3", SiteID: blogID, PostPath: "/a/", Status: CommentStatusApproved, Author: "Anonymous", Email: "bob@example.org", IP: "192.0.2.3"},
+		{ID: "c4", SiteID: blogID, PostPath: "/a/", Status: CommentStatusApproved, Author: "Bob", Email: "other-bob@example.org", AuthorUrl: homepage, IP: "192.0.2.4"},
+		{ID: "c5", SiteID: docsID, PostPath: "/a/", Status: CommentStatusApproved, Author: "Bob", Email: "bob@example.org", AuthorUrl: homepage, IP: "192.0.2.5"},
+	} {
+		c.Body = "b"
+		if err := d.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := d.PseudonymizeAuthor(ctx, PseudonymizeRequest{SiteID: blogID, Email: " BOB@example.org", NewName: "Anonymous", Reason: "doxxing", UserID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Changed != 3 || !res.ApprovedChanged || len(res.PostPaths) != 1 || res.PostPaths[0] != "/a/" {
+		t.Fatalf("result = %+v", res)
+	}
+
+	// Every personal column of the matched comments is replaced or cleared.
+	for _, id := range []string{"c1", "c2", "c3"} {
+		c, _, err := d.GetComment(ctx, blogID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Author != "Anonymous" || c.Email != "" || c.EmailMD5 != "" || c.EmailSHA256 != "" || c.AuthorUrl.Valid || c.IP != "" {
+			t.Fatalf("comment %s keeps personal data: %+v", id, c)
+		}
+	}
+	// Other authors and other sites are untouched.
+	if c, _, _ := d.GetComment(ctx, blogID, "c4"); c.Author != "Bob" || c.Email != "other-bob@example.org" || c.AuthorUrl != homepage || c.IP != "192.0.2.4" || c.EmailSHA256 == "" {
+		t.Fatalf("other author changed: %+v", c)
+	}
+	if c, _, _ := d.GetComment(ctx, docsID, "c5"); c.Author != "Bob" || c.Email != "bob@example.org" || c.IP != "192.0.2.5" {
+		t.Fatalf("other site changed: %+v", c)
+	}
+
+	// Only the old name is kept, in one revision per renamed comment.
+	for id, old := range map[string]string{"c1": "Bob", "c2": "Bobby", "c3": ""} {
+		revs, err := d.ListCommentRevisions(ctx, blogID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if old == "" {
+			if len(revs) != 0 {
+				t.Fatalf("revisions of %s = %+v", id, revs)
+			}
+			continue
+		}
+		if len(revs) != 1 || revs[0].Field != "author" || revs[0].OldValue != old || revs[0].NewValue != "Anonymous" || revs[0].Reason != "doxxing" || revs[0].ChangedBy != 7 {
+			t.Fatalf("revisions of %s = %+v", id, revs)
+		}
+	}
+	var details string
+	if err := d.SQL.QueryRowContext(ctx, `SELECT details FROM audit_log WHERE action = ?;`, AuditCommentPseudonymize).Scan(&details); err != nil {
+		t.Fatal(err)
+	}
+	for _, pii := range []string{"Bob\"", "Bobby", "example.org", "192.0.2.", "bob.example"} {
+		if strings.Contains(details, pii) {
+			t.Fatalf("audit details %s contain %q", details, pii)
+		}
+	}
+
+	// A second run finds nothing left to change.
+	if res, err := d.PseudonymizeAuthor(ctx, PseudonymizeRequest{SiteID: blogID, Author: "Anonymous", NewName: "Anonymous"}); err != nil || res.Changed != 0 {
+		t.Fatalf("second run = %+v %v", res, err)
+	}
+	if _, err := d.PseudonymizeAuthor(ctx, PseudonymizeRequest{SiteID: blogID, NewName: "Anonymous"}); err == nil {
+		t.Fatal("pseudonymize without email and author succeeded")
+	}
+}
+
+func TestMailOutbox(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	now := nowUnix()
+	m, err := d.InsertCommentWithMail(ctx, Comment{ID: "c1", SiteID: siteID, PostPath: "/a/", Status: CommentStatusPending, Author: "a", Email: "a@example.org", Body: "b", CreatedAt: now}, MailModeration, "https://example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ID == 0 {
+		t.Fatal("expected an outbox id")
+	}
+
+	// A failing insert must not leave a queued mail behind.
+	if _, err := d.InsertCommentWithMail(ctx, Comment{ID: "c1", SiteID: siteID, PostPath: "/a/", Status: CommentStatusPending, Author: "a", Email: "a@example.org", Body: "b"}, MailModeration, ""); err == nil {
+		t.Fatal("expected a duplicate id error")
+	}
+
+	// New mails are left to the request that queued them for a grace period.
+	if due, err := d.ListDueMails(ctx, now, 10); err != nil || len(due) != 0 {
+		t.Fatalf("expected no due mails yet, got %v %v", due, err)
+	}
+	due, err := d.ListDueMails(ctx, now+int64(OutboxGrace.Seconds()), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].CommentID != "c1" || due[0].Kind != MailModeration || due[0].BaseURL != "https://example.org" {
+		t.Fatalf("unexpected due mails: %+v", due)
+	}
+
+	if err := d.RecordMailAttempt(ctx, m.ID, OutboxSent, 1, "", now); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := d.ListDueMails(ctx, now+3600, 10); len(due) != 0 {
+		t.Fatalf("expected no due mails after sending, got %+v", due)
+	}
+
+	// Confirming a double opt-in comment queues its moderation mail.
+	if err := d.InsertComment(ctx, Comment{ID: "c2", SiteID: siteID, PostPath: "/a/", Status: CommentStatusUnconfirmed, Author: "a", Email: "a@example.org", Body: "b", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	m2, changed, err := d.ConfirmCommentWithMail(ctx, siteID, "c2", now-60, "")
+	if err != nil || !changed || m2.ID == 0 {
+		t.Fatalf("confirm: %+v %v %v", m2, changed, err)
+	}
+	if _, changed, err := d.ConfirmCommentWithMail(ctx, siteID, "c2", now-60, ""); err != nil || changed {
+		t.Fatalf("expected no second confirmation, got %v %v", changed, err)
+	}
+	if due, _ := d.ListDueMails(ctx, now+3600, 10); len(due) != 1 || due[0].ID != m2.ID {
+		t.Fatalf("expected exactly the confirmation's mail, got %+v", due)
+	}
+
+	if n, err := d.DeleteOldOutboxMails(ctx, now+3600); err != nil || n != 1 {
+		t.Fatalf("expected the sent mail to be pruned, got %d %v", n, err)
+	}
+}
+
+func TestRunRetry(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	runID, err := d.CreateRun(siteID, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.MarkRunRunning(runID); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.MarkRunFailed(runID, "push", "network down"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.RunAttempts(ctx, runID); err != nil || n != 1 {
+		t.Fatalf("attempts = %d, %v", n, err)
+	}
+
+	now := nowUnix()
+	if err := d.ScheduleRunRetry(ctx, runID, now+60); err != nil {
+		t.Fatal(err)
+	}
+	if due, err := d.ClaimDueRetries(ctx, now); err != nil || len(due) != 0 {
+		t.Fatalf("expected no due retries, got %v %v", due, err)
+	}
+
+	due, err := d.ClaimDueRetries(ctx, now+60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0] != (DueRun{RunID: runID, SiteKey: "blog", TriggerCommentID: "c1"}) {
+		t.Fatalf("due retries = %+v", due)
+	}
+	var state string
+	if err := d.SQL.QueryRow(`SELECT state FROM pipeline_runs WHERE id = ?;`, runID).Scan(&state); err != nil || state != RunQueued {
+		t.Fatalf("state = %q, %v", state, err)
+	}
+	if due, err := d.ClaimDueRetries(ctx, now+60); err != nil || len(due) != 0 {
+		t.Fatalf("retry claimed twice: %v %v", due, err)
+	}
+
+	if err := d.MarkRunRunning(runID); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := d.RunAttempts(ctx, runID); n != 2 {
+		t.Fatalf("attempts = %d, want 2", n)
+	}
+}
+
+func TestRunLogs(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	runID, err := d.CreateRun(siteID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, found, err := d.GetRunSiteID(ctx, runID); err != nil || !found || got != siteID {
+		t.Fatalf("GetRunSiteID = %d %v %v", got, found, err)
+	}
+	if _, found, err := d.GetRunSiteID(ctx, runID+1); err != nil || found {
+		t.Fatalf("expected unknown run, got %v %v", found, err)
+	}
+
+	for _, l := range []struct{ step, text string }{{"checkout", "Cloning...\n"}, {"push", "rejected\n"}, {"push", "ERROR: push failed\n"}} {
+		if err := d.AppendRunLog(ctx, runID, l.step, l.text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logs, err := d.ListRunLogs(ctx, runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 3 || logs[0].Step != "checkout" || logs[2].Content != "ERROR: push failed\n" {
+		t.Fatalf("logs = %+v", logs)
+	}
+}
+
+func TestRunAdmin(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog", "docs": "Docs"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	blogID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+	docsID, _, _ := d.GetSiteIDByKey(ctx, "docs")
+
+	queued, _ := d.CreateRun(blogID, "c1")
+	failed, _ := d.CreateRun(blogID, "c2")
+	other, _ := d.CreateRun(docsID, "")
+	if err := d.MarkRunFailed(failed, "push", "rejected"); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := d.ListRuns(ctx, RunListFilter{SiteIDs: []int64{blogID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != failed || runs[0].SiteKey != "blog" || runs[0].ErrorMessage != "rejected" {
+		t.Fatalf("runs = %+v", runs)
+	}
+	if n, err := d.CountRuns(ctx, RunListFilter{SiteIDs: []int64{blogID, docsID}, State: RunQueued}); err != nil || n != 2 {
+		t.Fatalf("CountRuns = %d %v", n, err)
+	}
+	if runs, err := d.ListRuns(ctx, RunListFilter{SiteIDs: []int64{blogID, docsID}, Limit: 1, Offset: 1}); err != nil || len(runs) != 1 || runs[0].ID != failed {
+		t.Fatalf("paged runs = %+v %v", runs, err)
+	}
+	if runs, err := d.ListRuns(ctx, RunListFilter{}); err != nil || len(runs) != 0 {
+		t.Fatalf("expected no runs without sites, got %+v %v", runs, err)
+	}
+
+	if run, found, err := d.GetRun(ctx, other); err != nil || !found || run.SiteID != docsID || run.State != RunQueued {
+		t.Fatalf("GetRun = %+v %v %v", run, found, err)
+	}
+
+	// Only runs that have not started can be cancelled.
+	if ok, err := d.CancelRun(ctx, failed); err != nil || ok {
+		t.Fatalf("cancel failed run = %v %v", ok, err)
+	}
+	if ok, err := d.CancelRun(ctx, queued); err != nil || !ok {
+		t.Fatalf("cancel queued run = %v %v", ok, err)
+	}
+	if q, err := d.IsRunQueued(ctx, queued); err != nil || q {
+		t.Fatalf("cancelled run still queued: %v %v", q, err)
+	}
+
+	// A run that other runs were coalesced into cannot be cancelled.
+	covering, _ := d.CreateRun(blogID, "c3")
+	covered, _ := d.CreateRun(blogID, "c4")
+	if err := d.MarkRunCoalesced(covered, covering); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := d.CancelRun(ctx, covering); err != nil || ok {
+		t.Fatalf("cancel run with coalesced runs = %v %v", ok, err)
+	}
+	if n, err := d.CountCoalescedRuns(ctx, covering); err != nil || n != 1 {
+		t.Fatalf("CountCoalescedRuns = %d %v", n, err)
+	}
+	if q, err := d.IsRunQueued(ctx, covering); err != nil || !q {
+		t.Fatalf("covering run no longer queued: %v %v", q, err)
+	}
+	if _, err := d.SQL.ExecContext(ctx, `DELETE FROM pipeline_runs WHERE id IN (?, ?);`, covering, covered); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed and cancelled runs can be queued again.
+	for _, id := range []int64{failed, queued} {
+		if ok, err := d.RequeueRun(ctx, id); err != nil || !ok {
+			t.Fatalf("requeue run %d = %v %v", id, ok, err)
+		}
+	}
+	if ok, err := d.RequeueRun(ctx, other); err != nil || ok {
+		t.Fatalf("requeue queued run = %v %v", ok, err)
+	}
+	if run, _, _ := d.GetRun(ctx, failed); run.State != RunQueued || run.FinishedAt != 0 {
+		t.Fatalf("requeued run = %+v", run)
+	}
+}
+
+func TestPruneRuns(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	done, _ := d.CreateRun(siteID, "")
+	queued, _ := d.CreateRun(siteID, "")
+	if err := d.MarkRunSuccess(done); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AppendRunLog(ctx, done, "push", "ok\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	f := RunListFilter{SiteIDs: []int64{siteID}, Until: nowUnix() + 3600}
+	if n, err := d.CountPrunableRuns(ctx, f); err != nil || n != 1 {
+		t.Fatalf("CountPrunableRuns = %d %v", n, err)
+	}
+	if n, err := d.PruneRuns(ctx, f); err != nil || n != 1 {
+		t.Fatalf("PruneRuns = %d %v", n, err)
+	}
+	if _, found, _ := d.GetRun(ctx, done); found {
+		t.Fatal("finished run not pruned")
+	}
+	if _, found, _ := d.GetRun(ctx, queued); !found {
+		t.Fatal("queued run pruned")
+	}
+	if logs, err := d.ListRunLogs(ctx, done); err != nil || len(logs) != 0 {
+		t.Fatalf("logs of pruned run = %+v %v", logs, err)
+	}
+}
+
+func TestRunDeployStatus(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	runID, _ := d.CreateRun(siteID, "")
+	if run, _, err := d.GetRun(ctx, runID); err != nil || run.DeployStatus != 0 {
+		t.Fatalf("deploy status before hook = %d %v", run.DeployStatus, err)
+	}
+	if err := d.SetRunDeployStatus(ctx, runID, 201); err != nil {
+		t.Fatal(err)
+	}
+	if run, _, err := d.GetRun(ctx, runID); err != nil || run.DeployStatus != 201 {
+		t.Fatalf("deploy status = %d %v", run.DeployStatus, err)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	runID, _ := d.CreateRun(siteID, "")
+	if err := d.MarkRunDryRun(ctx, runID); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.MarkRunSuccess(runID); err != nil {
+		t.Fatal(err)
+	}
+	if run, _, err := d.GetRun(ctx, runID); err != nil || !run.DryRun || run.State != RunSuccess {
+		t.Fatalf("run = %+v %v", run, err)
+	}
+}
+
+func TestPruneRunsByRetention(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	var ids []int64
+	for i := 0; i < 4; i++ {
+		id, _ := d.CreateRun(siteID, "")
+		ids = append(ids, id)
+	}
+	// The oldest run is still queued and must survive any retention.
+	for _, id := range ids[1:] {
+		if err := d.MarkRunSuccess(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.SQL.Exec(`UPDATE pipeline_runs SET created_at = created_at - 86400 * 10 WHERE id <= ?;`, ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := d.PruneRunsByRetention(ctx, siteID, RunRetention{}); err != nil || n != 0 {
+		t.Fatalf("prune without limits = %d %v", n, err)
+	}
+
+	// Keep the newest run and everything from the last five days: the two old finished runs go.
+	r := RunRetention{KeepRuns: 1, Before: nowUnix() - 5*86400}
+	if n, err := d.CountRunsByRetention(ctx, siteID, r); err != nil || n != 2 {
+		t.Fatalf("CountRunsByRetention = %d %v", n, err)
+	}
+	if n, err := d.PruneRunsByRetention(ctx, siteID, r); err != nil || n != 2 {
+		t.Fatalf("PruneRunsByRetention = %d %v", n, err)
+	}
+	for i, want := range []bool{true, false, false, true} {
+		if _, found, _ := d.GetRun(ctx, ids[i]); found != want {
+			t.Fatalf("run %d found = %v, want %v", i, found, want)
+		}
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := d.CheckWritable(ctx); err != nil {
+		t.Fatalf("CheckWritable: %v", err)
+	}
+	var version int
+	if err := d.SQL.QueryRowContext(ctx, `PRAGMA user_version;`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != SchemaVersion {
+		t.Errorf("schema version changed to %d", version)
+	}
+
+	_ = d.Close()
+	if err := d.CheckWritable(ctx); err == nil {
+		t.Error("CheckWritable succeeded on a closed database")
+	}
+}
+
+func TestListQueuedRuns(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	first, _ := d.CreateRun(siteID, "c1")
+	running, _ := d.CreateRun(siteID, "c2")
+	interrupted, _ := d.CreateRun(siteID, "")
+	if err := d.MarkRunRunning(running); err != nil {
+		t.Fatal(err)
+	}
+	// A run cancelled by shutdown is marked failed and queued again.
+	if err := d.MarkRunRunning(interrupted); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.MarkRunFailed(interrupted, "push", "context canceled"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := d.RequeueRun(ctx, interrupted); err != nil || !ok {
+		t.Fatalf("requeue: %v %v", ok, err)
+	}
+
+	queued, err := d.ListQueuedRuns(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DueRun{{RunID: first, SiteKey: "blog", TriggerCommentID: "c1"}, {RunID: interrupted, SiteKey: "blog"}}
+	if len(queued) != len(want) || queued[0] != want[0] || queued[1] != want[1] {
+		t.Fatalf("queued runs = %+v, want %+v", queued, want)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	userID, err := d.CreateUser(ctx, User{Email: "ci@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := d.CreateAPIToken(ctx, APIToken{UserID: userID, Name: "ci", Prefix: "fym_abc", Scopes: []string{"comments", "pipeline"}, TokenHash: "h1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, found, err := d.GetAPITokenByHash(ctx, "h1")
+	if err != nil || !found {
+		t.Fatalf("get: %v %v", found, err)
+	}
+	if tok.ID != id || tok.UserID != userID || !tok.Active(nowUnix()) {
+		t.Fatalf("token = %+v", tok)
+	}
+	if !tok.HasScope("pipeline") || tok.HasScope("users") {
+		t.Fatalf("scopes = %v", tok.Scopes)
+	}
+	if err := d.TouchAPIToken(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// Other users cannot revoke the token.
+	if ok, err := d.RevokeAPIToken(ctx, userID+1, id); err != nil || ok {
+		t.Fatalf("revoke by other user: %v %v", ok, err)
+	}
+	if ok, err := d.RevokeAPIToken(ctx, userID, id); err != nil || !ok {
+		t.Fatalf("revoke: %v %v", ok, err)
+	}
+	if ok, _ := d.RevokeAPIToken(ctx, userID, id); ok {
+		t.Fatal("revoked twice")
+	}
+
+	items, err := d.ListAPITokensByUserID(ctx, userID)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("list: %v %v", items, err)
+	}
+	if items[0].Active(nowUnix()) || items[0].LastUsedAt == 0 {
+		t.Fatalf("listed token = %+v", items[0])
+	}
+
+	expired := APIToken{ExpiresAt: nowUnix() - 1}
+	if expired.Active(nowUnix()) {
+		t.Fatal("expired token is active")
+	}
+}
+
+func TestLoginHistory(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	userID, err := d.CreateUser(ctx, User{Email: "ada@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= LoginHistoryLimit+5; i++ {
+		e := LoginEvent{UserID: userID, Success: i%2 == 0, Method: LoginMethodPassword, IP: "192.0.2.1", CreatedAt: int64(1000 + i)}
+		if err := d.RecordLogin(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, err := d.ListLoginHistory(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != LoginHistoryLimit {
+		t.Fatalf("len = %d, want %d", len(items), LoginHistoryLimit)
+	}
+	if first := items[0]; first.CreatedAt != int64(1000+LoginHistoryLimit+5) || first.Success || first.IP != "192.0.2.1" {
+		t.Fatalf("newest = %+v", first)
+	}
+	if last := items[len(items)-1]; last.CreatedAt != 1006 {
+		t.Fatalf("oldest = %+v", last)
+	}
+
+	// last_login_at is the last successful login.
+	u, _, err := d.GetUserByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.LastLoginAt != int64(1000+LoginHistoryLimit+4) {
+		t.Fatalf("LastLoginAt = %d", u.LastLoginAt)
+	}
+}
+
+func TestRebindDollar(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{`SELECT 1;`, `SELECT 1;`},
+		{`SELECT * FROM t WHERE a = ? AND b IN (?, ?)`, `SELECT * FROM t WHERE a = $1 AND b IN ($2, $3)`},
+		{`WHERE x >= ?1 AND x < ?2 AND y = ?1`, `WHERE x >= $1 AND x < $2 AND y = $1`},
+		{`WHERE a = ?2 AND b = ?`, `WHERE a = $2 AND b = $3`},
+		{`WHERE a = '?' AND "b?" = ? -- why?` + "\nAND c = ?", `WHERE a = '?' AND "b?" = $1 -- why?` + "\nAND c = $2"},
+		{`WHERE a = 'it''s ?' AND b = ?`, `WHERE a = 'it''s ?' AND b = $1`},
+	} {
+		if got := rebindDollar(tc.in); got != tc.want {
+			t.Errorf("rebindDollar(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	d, err := Open(filepath.Join(dir, "live.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "backup.db")
+	if err := d.Backup(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Backup(ctx, path); err == nil {
+		t.Fatal("backup over an existing file succeeded")
+	}
+
+	copied, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copied.Close()
+	if _, found, err := copied.GetSiteIDByKey(ctx, "blog"); err != nil || !found {
+		t.Fatalf("site in backup: %v, %v", found, err)
+	}
+	if v, err := copied.CurrentSchemaVersion(ctx); err != nil || v != SchemaVersion {
+		t.Fatalf("schema version of backup = %d, %v", v, err)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	insert := "INSERT INTO t (a, b) VALUES (?, ?)"
+	for _, tc := range []struct {
+		d      dialect
+		update string
+		want   string
+	}{
+		{sqliteDialect{}, "", insert + "\nON CONFLICT(a) DO NOTHING;"},
+		{postgresDialect{}, "b = excluded.b", insert + "\nON CONFLICT(a) DO UPDATE SET b = excluded.b;"},
+		{mysqlDialect{}, "", "INSERT IGNORE INTO t (a, b) VALUES (?, ?);"},
+		{mysqlDialect{}, "b = b + excluded.b", insert + "\nON DUPLICATE KEY UPDATE b = b + VALUES(b);"},
+	} {
+		if got := tc.d.upsert(insert, "a", tc.update); got != tc.want {
+			t.Errorf("%s upsert(%q) = %q, want %q", tc.d.driver(), tc.update, got, tc.want)
+		}
+	}
+}
+
+func TestParentsFirst(t *testing.T) {
+	rows := []StateRow{
+		{"id": "c", "parent_id": "b"},
+		{"id": "b", "parent_id": "a"},
+		{"id": "x", "parent_id": "missing"},
+		{"id": "a", "parent_id": nil},
+	}
+	var got []any
+	for _, r := range parentsFirst(rows) {
+		got = append(got, r["id"])
+	}
+	if fmt.Sprint(got) != "[x a b c]" {
+		t.Fatalf("order = %v", got)
+	}
+}
+
+// TestSQLiteBackend runs the checks of the other backends against SQLite.
+func TestSQLiteBackend(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "backend.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	testBackend(t, d)
+}
+
+// TestPostgres runs against the PostgreSQL database in FYNDMARK_TEST_POSTGRES_DSN
+// (a postgres:// URL), in a schema that is dropped afterwards.
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("FYNDMARK_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("FYNDMARK_TEST_POSTGRES_DSN not set")
+	}
+	admin, err := OpenPostgres(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	schema := fmt.Sprintf("fyndmark_test_%d", time.Now().UnixNano())
+	if _, err := admin.SQL.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = admin.SQL.Exec("DROP SCHEMA " + schema + " CASCADE") }()
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	d, err := OpenPostgres(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	testBackend(t, d)
+}
+
+// TestMySQL runs against the MySQL or MariaDB database in FYNDMARK_TEST_MYSQL_DSN, in a
+// database that is dropped afterwards. The user needs the right to create databases.
+func TestMySQL(t *testing.T) {
+	dsn := os.Getenv("FYNDMARK_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("FYNDMARK_TEST_MYSQL_DSN not set")
+	}
+	admin, err := OpenMySQL(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+	name := fmt.Sprintf("fyndmark_test_%d", time.Now().UnixNano())
+	if _, err := admin.SQL.Exec("CREATE DATABASE " + name); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = admin.SQL.Exec("DROP DATABASE " + name) }()
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DBName = name
+	d, err := OpenMySQL(cfg.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	testBackend(t, d)
+}
+
+// testBackend migrates an empty database of another backend and runs the queries whose
+// SQL differs between the backends.
+func testBackend(t *testing.T, d *DB) {
+	t.Helper()
+	for i := 0; i < 2; i++ {
+		if err := d.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	if v, err := d.CurrentSchemaVersion(ctx); err != nil || v != SchemaVersion {
+		t.Fatalf("schema version = %d, %v", v, err)
+	}
+	if err := d.CheckWritable(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+	userID, err := d.CreateUser(ctx, User{Email: "ada@example.com", Password: "hash", MustChangePassword: true})
+	if err != nil || userID <= 0 {
+		t.Fatalf("create user: %d, %v", userID, err)
+	}
+	if granted, err := d.GrantUserSite(ctx, userID, siteID); err != nil || !granted {
+		t.Fatalf("grant user site: %v, %v", granted, err)
+	}
+	if granted, err := d.GrantUserSite(ctx, userID, siteID); err != nil || granted {
+		t.Fatalf("grant user site again: %v, %v", granted, err)
+	}
+	for i := 0; i < LoginHistoryLimit+2; i++ {
+		if err := d.RecordLogin(ctx, LoginEvent{UserID: userID, Success: true, Method: LoginMethodPassword}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events, err := d.ListLoginHistory(ctx, userID); err != nil || len(events) != LoginHistoryLimit {
+		t.Fatalf("login history: %d, %v", len(events), err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := d.PutSession(ctx, Session{ID: "s1", UserID: userID, Data: []byte{byte(i)}, ExpiresAt: nowUnix() + 60}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s, found, err := d.GetSession(ctx, "s1"); err != nil || !found || s.Data[0] != 1 {
+		t.Fatalf("session: %+v, %v, %v", s, found, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := d.RecordSpamFeedback(ctx, siteID, []string{"links"}, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats, err := d.ListSpamRuleStats(ctx, siteID); err != nil || stats["links"].Spam != 2 {
+		t.Fatalf("spam rule stats: %v, %v", stats, err)
+	}
+	if err := d.CreateCaptchaChallenge(ctx, "k1", "42", nowUnix()+60); err != nil {
+		t.Fatal(err)
+	}
+	if answer, found, err := d.TakeCaptchaChallenge(ctx, "k1", nowUnix()); err != nil || !found || answer != "42" {
+		t.Fatalf("take captcha: %q, %v, %v", answer, found, err)
+	}
+	if _, found, err := d.TakeCaptchaChallenge(ctx, "k1", nowUnix()); err != nil || found {
+		t.Fatalf("take captcha again: %v, %v", found, err)
+	}
+	if err := d.InsertComment(ctx, Comment{ID: "c1", SiteID: siteID, PostPath: "/a/", Status: CommentStatusPending, Author: "a", Email: "a@example.org", Body: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	reply := Comment{ID: "c0", SiteID: siteID, PostPath: "/a/", ParentID: sql.NullString{String: "c1", Valid: true}, Status: CommentStatusPending, Author: "b", Email: "b@example.org", Body: "r"}
+	if err := d.InsertComment(ctx, reply); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.SetCommentStatus(ctx, siteID, "c1", CommentStatusApproved, Decision{}); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := d.ListComments(ctx, CommentListFilter{SiteID: siteID, AllowedSiteIDs: []int64{siteID}, Status: "all"}); err != nil || len(list) != 2 {
+		t.Fatalf("list comments: %v, %v", list, err)
+	}
+	if stats, err := d.SiteStats(ctx, siteID, 0, nowUnix()+1, 5); err != nil || stats.Approved != 1 || stats.Pending != 1 {
+		t.Fatalf("site stats: %+v, %v", stats, err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := d.CreateRun(siteID, "c1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runs, err := d.ListRuns(ctx, RunListFilter{SiteIDs: []int64{siteID}, Offset: 1}); err != nil || len(runs) != 2 {
+		t.Fatalf("list runs with offset: %v, %v", runs, err)
+	}
+	if n, err := d.PruneRunsByRetention(ctx, siteID, RunRetention{KeepRuns: 1}); err != nil || n != 0 {
+		t.Fatalf("prune queued runs: %d, %v", n, err)
+	}
+	entry := BlocklistEntry{SiteID: siteID, Kind: BlockIP, Value: "192.0.2.1"}
+	if id, added, err := d.AddBlocklistEntry(ctx, entry); err != nil || !added || id <= 0 {
+		t.Fatalf("add blocklist entry: %d, %v, %v", id, added, err)
+	}
+	if _, added, err := d.AddBlocklistEntry(ctx, entry); err != nil || added {
+		t.Fatalf("add duplicate blocklist entry: %v, %v", added, err)
+	}
+	if report, err := d.Check(ctx, false); err != nil || !report.OK() {
+		t.Fatalf("check: %+v, %v", report, err)
+	}
+	if _, err := d.DeleteComment(ctx, siteID, "c1", Decision{}); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := d.PurgeComments(ctx, PurgeFilter{SiteID: siteID}); err != nil || len(ids) != 1 {
+		t.Fatalf("purge comments: %v, %v", ids, err)
+	}
+	if c, found, err := d.GetComment(ctx, siteID, "c0"); err != nil || !found || c.ParentID.Valid {
+		t.Fatalf("reply of purged comment: %+v, %v, %v", c, found, err)
+	}
+
+	// A dump restores into the same database, and new rows get fresh ids.
+	tables := map[string][]StateRow{}
+	for _, table := range StateTables {
+		if err := d.DumpTable(ctx, table, func(r StateRow) error {
+			tables[table] = append(tables[table], r)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.RestoreState(ctx, tables, true); err != nil {
+		t.Fatal(err)
+	}
+	got, found, err := d.GetUserByID(ctx, userID)
+	if err != nil || !found || !got.MustChangePassword || got.LastLoginAt == 0 {
+		t.Fatalf("restored user: %+v, %v, %v", got, found, err)
+	}
+	if id, err := d.CreateUser(ctx, User{Email: "grace@example.com", Password: "hash"}); err != nil || id <= userID {
+		t.Fatalf("create user after restore: %d, %v", id, err)
+	}
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Drivers of the supported database backends.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	execer
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// dialect covers the SQL that differs between the database backends. Queries are
+// written for SQLite with ? placeholders; the PostgreSQL connections rewrite them (see
+// rebindDollar).
+type dialect interface {
+	// driver returns the name of the backend, one of the Driver constants.
+	driver() string
+	// schema returns the statements that create the tables and indexes.
+	schema() []string
+	// columnType translates a SQLite column definition of Migrate.
+	columnType(definition string) string
+	// tableColumns returns the column names of a table.
+	tableColumns(ctx context.Context, q queryer, table string) (map[string]struct{}, error)
+	// schemaVersion returns the schema version written by setSchemaVersion.
+	schemaVersion(ctx context.Context, q queryer) (int, error)
+	setSchemaVersion(ctx context.Context, q queryer, version int) error
+	// noLimit is the LIMIT of queries that only have an OFFSET.
+	noLimit() string
+	// insertID runs an INSERT and returns the id of the new row, or 0 if the statement
+	// inserted nothing (ON CONFLICT DO NOTHING).
+	insertID(ctx context.Context, q queryer, query string, args ...any) (int64, error)
+	// upsert completes an INSERT statement for rows that collide with the unique key
+	// conflict: they are skipped if update is empty, otherwise the existing row is
+	// updated by the assignments in update, where excluded.<column> is the new value.
+	upsert(insert, conflict, update string) string
+	// deferForeignKeys makes a transaction check foreign keys on commit only.
+	deferForeignKeys(ctx context.Context, tx *sql.Tx) error
+	// integrityCheck returns the problems of the storage itself, ["ok"] if there are none.
+	integrityCheck(ctx context.Context, q queryer) ([]string, error)
+	// foreignKeyViolations returns the rows whose foreign keys point to missing rows.
+	foreignKeyViolations(ctx context.Context, q queryer) ([]fkViolation, error)
+	// dumpOrder returns the ORDER BY expression that lists a state table in insert order.
+	dumpOrder(table string) string
+	// afterRestore runs after rows with explicit ids were inserted into tables.
+	afterRestore(ctx context.Context, tx *sql.Tx, tables []string) error
+}
+
+// fkViolation is a row of table whose foreign key points to a missing row of parent.
+type fkViolation struct {
+	table  string
+	parent string
+	rowID  int64
+}
+
+// dialect returns the dialect of the database, SQLite if none was set.
+func (d *DB) dialect() dialect {
+	if d.sqlDialect == nil {
+		return sqliteDialect{}
+	}
+	return d.sqlDialect
+}
+
+// Driver returns the database backend, one of the Driver constants.
+func (d *DB) Driver() string {
+	return d.dialect().driver()
+}
+
+// sqliteDialect is the dialect of SQLite, which the queries are written for.
+type sqliteDialect struct{}
+
+func (sqliteDialect) driver() string { return DriverSQLite }
+
+func (sqliteDialect) schema() []string { return sqliteSchema }
+
+func (sqliteDialect) columnType(definition string) string { return definition }
+
+func (sqliteDialect) tableColumns(ctx context.Context, q queryer, table string) (map[string]struct{}, error) {
+	return scanColumnNames(q.QueryContext(ctx, "SELECT name FROM pragma_table_info(?);", table))
+}
+
+func (sqliteDialect) schemaVersion(ctx context.Context, q queryer) (int, error) {
+	var v int
+	err := q.QueryRowContext(ctx, `PRAGMA user_version;`).Scan(&v)
+	return v, err
+}
+
+func (sqliteDialect) setSchemaVersion(ctx context.Context, q queryer, version int) error {
+	_, err := q.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d;`, version))
+	return err
+}
+
+// noLimit is -1, SQLite needs LIMIT when OFFSET is used.
+func (sqliteDialect) noLimit() string { return "-1" }
+
+func (sqliteDialect) insertID(ctx context.Context, q queryer, query string, args ...any) (int64, error) {
+	res, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (sqliteDialect) upsert(insert, conflict, update string) string {
+	return onConflict(insert, conflict, update)
+}
+
+// onConflict is the upsert of SQLite and PostgreSQL.
+func onConflict(insert, conflict, update string) string {
+	if update == "" {
+		return insert + "\nON CONFLICT(" + conflict + ") DO NOTHING;"
+	}
+	return insert + "\nON CONFLICT(" + conflict + ") DO UPDATE SET " + update + ";"
+}
+
+func (sqliteDialect) deferForeignKeys(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "PRAGMA defer_foreign_keys = ON;")
+	return err
+}
+
+func (sqliteDialect) integrityCheck(ctx context.Context, q queryer) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `PRAGMA integrity_check;`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return nil, err
+		}
+		out = append(out, msg)
+	}
+	return out, rows.Err()
+}
+
+// foreignKeyViolations finds rows written while foreign keys were off, e.g. by manual
+// edits or by versions that did not enable them.
+func (sqliteDialect) foreignKeyViolations(ctx context.Context, q queryer) ([]fkViolation, error) {
+	rows, err := q.QueryContext(ctx, `PRAGMA foreign_key_check;`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []fkViolation
+	for rows.Next() {
+		var (
+			v    fkViolation
+			fkID int64
+		)
+		if err := rows.Scan(&v.table, &v.rowID, &v.parent, &fkID); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (sqliteDialect) dumpOrder(string) string { return "rowid" }
+
+func (sqliteDialect) afterRestore(context.Context, *sql.Tx, []string) error { return nil }
+
+// scanColumnNames reads a single-column result of column names.
+func scanColumnNames(rows *sql.Rows, err error) (map[string]struct{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out[name] = struct{}{}
+	}
+	return out, rows.Err()
+}
+
+// rebindDollar rewrites the ? and ?NNN placeholders of a query to $N. Like in SQLite,
+// a plain ? takes the number after the largest one used before it. Question marks in
+// string literals, quoted identifiers and comments are kept.
+func rebindDollar(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var (
+		b     strings.Builder
+		quote byte // ' or " while inside a literal or identifier
+		last  int
+	)
+	b.Grow(len(query) + 8)
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+			continue
+		case ch == '?':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			n := last + 1
+			if j > i+1 {
+				n, _ = strconv.Atoi(query[i+1 : j])
+			}
+			if n > last {
+				last = n
+			}
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			i = j - 1
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RevisionReasonModeratorEdit is stored with revisions made by EditPendingComment.
+const RevisionReasonModeratorEdit = "moderator_edit"
+
+// CommentEdit holds the fields a moderator changes on a pending comment.
+// Nil fields are kept; an empty AuthorURL removes the URL.
+type CommentEdit struct {
+	SiteID    int64
+	CommentID string
+	Author    *string
+	AuthorURL *string
+	Body      *string
+	UserID    int64
+}
+
+// EditPendingComment applies a moderator's edit to a pending comment in one
+// transaction, recording a revision per changed field and one audit log entry.
+// It returns the names of the changed fields, and false if the comment does not
+// exist or is not pending.
+func (d *DB) EditPendingComment(ctx context.Context, e CommentEdit) ([]string, bool, error) {
+	if d == nil || d.SQL == nil {
+		return nil, false, fmt.Errorf("db not initialized")
+	}
+	e.CommentID = strings.TrimSpace(e.CommentID)
+	if e.SiteID <= 0 || e.CommentID == "" {
+		return nil, false, fmt.Errorf("siteID and commentID are required")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("begin edit comment tx: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var author, body string
+	var authorURL sql.NullString
+	err = tx.QueryRowContext(ctx, `
+SELECT author, author_url, body
+  FROM comments
+ WHERE site_id = ? AND id = ? AND status = ?;
+`, e.SiteID, e.CommentID, CommentStatusPending).Scan(&author, &authorURL, &body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select comment: %w", err)
+	}
+
+	type change struct {
+		field, old, new string
+	}
+	var changes []change
+	if e.Author != nil && *e.Author != author {
+		changes = append(changes, change{"author", author, *e.Author})
+	}
+	if e.AuthorURL != nil && *e.AuthorURL != nullStringToString(authorURL) {
+		changes = append(changes, change{"author_url", nullStringToString(authorURL), *e.AuthorURL})
+	}
+	if e.Body != nil && *e.Body != body {
+		changes = append(changes, change{"body", body, *e.Body})
+	}
+	if len(changes) == 0 {
+		return []string{}, true, nil
+	}
+
+	fields := make([]string, 0, len(changes))
+	now := nowUnix()
+	for _, ch := range changes {
+		var value any = ch.new
+		if ch.field == "author_url" {
+			value = normalizeNullString(sql.NullString{String: ch.new, Valid: true})
+		}
+		if _, err := tx.ExecContext(ctx, `
+UPDATE comments
+   SET `+ch.field+` = ?, updated_at = ?
+ WHERE site_id = ? AND id = ?;
+`, value, now, e.SiteID, e.CommentID); err != nil {
+			return nil, false, fmt.Errorf("update comment %s: %w", ch.field, err)
+		}
+		if err := insertCommentRevision(ctx, tx, CommentRevision{
+			SiteID:    e.SiteID,
+			CommentID: e.CommentID,
+			Field:     ch.field,
+			OldValue:  ch.old,
+			NewValue:  ch.new,
+			Reason:    RevisionReasonModeratorEdit,
+			ChangedBy: e.UserID,
+		}); err != nil {
+			return nil, false, err
+		}
+		fields = append(fields, ch.field)
+	}
+
+	// The old and new values are kept only in the revisions.
+	if err := insertAuditLog(ctx, tx, AuditEntry{
+		UserID: e.UserID,
+		SiteID: e.SiteID,
+		Action: AuditCommentEdit,
+		Details: map[string]any{
+			"comment_id": e.CommentID,
+			"fields":     fields,
+		},
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("commit edit comment tx: %w", err)
+	}
+	committed = true
+	return fields, true, nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// EmailHashes returns the hex MD5 and SHA-256 hashes of the trimmed, lowercased
+// email, as expected by Gravatar and Libravatar. Both are empty for an empty email.
+func EmailHashes(email string) (md5Hex, sha256Hex string) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "", ""
+	}
+	m := md5.Sum([]byte(email))
+	s := sha256.Sum256([]byte(email))
+	return hex.EncodeToString(m[:]), hex.EncodeToString(s[:])
+}
+
+// backfillEmailHashes computes the email hashes of comments stored before the
+// hash columns existed. SQLite has no hash functions, so this is done in Go.
+func (d *DB) backfillEmailHashes() error {
+	rows, err := d.SQL.Query(`SELECT id, email FROM comments WHERE email_sha256 = '' AND email <> '';`)
+	if err != nil {
+		return fmt.Errorf("select comments without email hash: %w", err)
+	}
+	type pending struct{ id, email string }
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.email); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("scan comment without email hash: %w", err)
+		}
+		todo = append(todo, p)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return fmt.Errorf("iterate comments without email hash: %w", err)
+	}
+	_ = rows.Close()
+	if len(todo) == 0 {
+		return nil
+	}
+
+	tx, err := d.SQL.Begin()
+	if err != nil {
+		return fmt.Errorf("backfill email hashes begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, p := range todo {
+		m, s := EmailHashes(p.email)
+		if _, err := tx.Exec(`UPDATE comments SET email_md5 = ?, email_sha256 = ? WHERE id = ?;`, m, s, p.id); err != nil {
+			return fmt.Errorf("backfill email hash %s: %w", p.id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("backfill email hashes commit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// GetUserIDByIdentity returns the user linked to issuer and subject.
+func (d *DB) GetUserIDByIdentity(ctx context.Context, issuer, subject string) (int64, bool, error) {
+	if d == nil || d.SQL == nil {
+		return 0, false, fmt.Errorf("db not initialized")
+	}
+
+	var userID int64
+	err := d.reader().QueryRowContext(ctx, `
+SELECT user_id
+  FROM user_identities
+ WHERE issuer = ?
+   AND subject = ?;
+`, issuer, subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("get user identity: %w", err)
+	}
+	return userID, true, nil
+}
+
+// RecordUserIdentity links issuer and subject to a user, or updates the email and
+// the login time of an existing link.
+func (d *DB) RecordUserIdentity(ctx context.Context, userID int64, issuer, subject, email string) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	if userID <= 0 || issuer == "" || subject == "" {
+		return fmt.Errorf("userID, issuer and subject are required")
+	}
+
+	now := nowUnix()
+	if _, err := d.SQL.ExecContext(ctx, d.dialect().upsert(`
+INSERT INTO user_identities (user_id, issuer, subject, email, created_at, last_login_at)
+VALUES (?, ?, ?, ?, ?, ?)`, "issuer, subject", `
+  email = excluded.email,
+  last_login_at = excluded.last_login_at`), userID, issuer, subject, strings.ToLower(strings.TrimSpace(email)), now, now); err != nil {
+		return fmt.Errorf("record user identity: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Login methods of LoginEvent.
+const (
+	LoginMethodPassword = "password"
+	LoginMethodOIDC     = "oidc"
+)
+
+// LoginHistoryLimit is the number of login events kept per user.
+const LoginHistoryLimit = 50
+
+// LoginEvent is a successful or rejected login of a user.
+type LoginEvent struct {
+	ID        int64  `json:"ID"`
+	UserID    int64  `json:"UserID"`
+	Success   bool   `json:"Success"`
+	Method    string `json:"Method"`
+	IP        string `json:"IP"`
+	UserAgent string `json:"UserAgent"`
+	CreatedAt int64  `json:"CreatedAt"`
+}
+
+// RecordLogin stores a login event and drops the oldest events of the user beyond
+// LoginHistoryLimit. A successful login also sets users.last_login_at.
+func (d *DB) RecordLogin(ctx context.Context, e LoginEvent) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	if e.UserID <= 0 {
+		return fmt.Errorf("user_id must be > 0")
+	}
+	if e.CreatedAt == 0 {
+		e.CreatedAt = nowUnix()
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("record login: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO login_history (user_id, success, method, ip, user_agent, created_at)
+VALUES (?, ?, ?, ?, ?, ?);
+`, e.UserID, e.Success, e.Method, e.IP, e.UserAgent, e.CreatedAt); err != nil {
+		return fmt.Errorf("record login: %w", err)
+	}
+	if e.Success {
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET last_login_at = ? WHERE id = ?;`, e.CreatedAt, e.UserID); err != nil {
+			return fmt.Errorf("record login: %w", err)
+		}
+	}
+	// The derived table lets MySQL read the table it deletes from.
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM login_history
+ WHERE user_id = ?
+   AND id NOT IN (SELECT id FROM (SELECT id FROM login_history WHERE user_id = ? ORDER BY id DESC LIMIT ?) AS kept);
+`, e.UserID, e.UserID, LoginHistoryLimit); err != nil {
+		return fmt.Errorf("prune login history: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("record login: %w", err)
+	}
+	return nil
+}
+
+// ListLoginHistory returns the login events of a user, newest first.
+func (d *DB) ListLoginHistory(ctx context.Context, userID int64) ([]LoginEvent, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT id, user_id, success, method, ip, user_agent, created_at
+  FROM login_history
+ WHERE user_id = ?
+ ORDER BY id DESC;
+`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list login history: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []LoginEvent{}
+	for rows.Next() {
+		var e LoginEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Success, &e.Method, &e.IP, &e.UserAgent, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan login event: %w", err)
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate login history: %w", err)
+	}
+	return out, nil
+}
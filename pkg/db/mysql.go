@@ -0,0 +1,438 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlConns is the size of the connection pool of a MySQL database.
+const mysqlConns = 10
+
+// OpenMySQL opens a MySQL or MariaDB database. dsn is a connection string such as
+// "fyndmark:secret@tcp(localhost:3306)/fyndmark". Like SQLite, UPDATE statements report
+// the rows they matched, not only the rows they changed.
+func OpenMySQL(dsn string) (*DB, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open mysql: %w", err)
+	}
+	cfg.ClientFoundRows = true
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("open mysql: %w", err)
+	}
+	sqlDB := sql.OpenDB(connector)
+	sqlDB.SetMaxOpenConns(mysqlConns)
+	sqlDB.SetMaxIdleConns(mysqlConns)
+	// Servers close idle connections after wait_timeout.
+	sqlDB.SetConnMaxLifetime(3 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
+		return nil, fmt.Errorf("ping mysql: %w", err)
+	}
+	return &DB{SQL: sqlDB, sqlDialect: mysqlDialect{}}, nil
+}
+
+// mysqlDialect is the dialect of MySQL and MariaDB. The driver understands ?
+// placeholders and bool arguments, so queries are passed on unchanged.
+type mysqlDialect struct{}
+
+func (mysqlDialect) driver() string { return DriverMySQL }
+
+func (mysqlDialect) schema() []string { return mysqlSchema }
+
+// columnType maps SQLite types to MySQL; TEXT columns only take an expression as
+// default.
+func (mysqlDialect) columnType(definition string) string {
+	return strings.NewReplacer("INTEGER", "BIGINT", "DEFAULT ''", "DEFAULT ('')").Replace(definition)
+}
+
+func (mysqlDialect) tableColumns(ctx context.Context, q queryer, table string) (map[string]struct{}, error) {
+	return scanColumnNames(q.QueryContext(ctx, `
+SELECT column_name
+  FROM information_schema.columns
+ WHERE table_schema = DATABASE()
+   AND table_name = ?;
+`, table))
+}
+
+func (mysqlDialect) schemaVersion(ctx context.Context, q queryer) (int, error) {
+	var v int
+	err := q.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version;`).Scan(&v)
+	return v, err
+}
+
+func (mysqlDialect) setSchemaVersion(ctx context.Context, q queryer, version int) error {
+	_, err := q.ExecContext(ctx, `UPDATE schema_version SET version = ? WHERE id = 1;`, version)
+	return err
+}
+
+// noLimit is the largest row count, MySQL has no LIMIT ALL.
+func (mysqlDialect) noLimit() string { return "18446744073709551615" }
+
+func (mysqlDialect) insertID(ctx context.Context, q queryer, query string, args ...any) (int64, error) {
+	return sqliteDialect{}.insertID(ctx, q, query, args...)
+}
+
+// excludedColumn matches the excluded.<column> references of an upsert.
+var excludedColumn = regexp.MustCompile(`\bexcluded\.(\w+)`)
+
+// upsert uses INSERT IGNORE and ON DUPLICATE KEY UPDATE. MariaDB does not know the
+// row alias of MySQL 8, so the new values are read with VALUES().
+func (mysqlDialect) upsert(insert, _, update string) string {
+	if update == "" {
+		return strings.Replace(insert, "INSERT INTO", "INSERT IGNORE INTO", 1) + ";"
+	}
+	return insert + "\nON DUPLICATE KEY UPDATE " + excludedColumn.ReplaceAllString(update, "VALUES($1)") + ";"
+}
+
+// deferForeignKeys does nothing: MySQL checks foreign keys per row, and RestoreState
+// inserts parent comments before their replies.
+func (mysqlDialect) deferForeignKeys(context.Context, *sql.Tx) error { return nil }
+
+// integrityCheck reports no problems: the server checks its storage itself (see
+// mysqlcheck).
+func (mysqlDialect) integrityCheck(context.Context, queryer) ([]string, error) {
+	return []string{"ok"}, nil
+}
+
+// foreignKeyViolations finds nothing: InnoDB enforces foreign keys on every write.
+func (mysqlDialect) foreignKeyViolations(context.Context, queryer) ([]fkViolation, error) {
+	return nil, nil
+}
+
+// dumpOrder sorts by the primary key like PostgreSQL.
+func (mysqlDialect) dumpOrder(table string) string {
+	return postgresDialect{}.dumpOrder(table)
+}
+
+// afterRestore does nothing: InnoDB moves AUTO_INCREMENT behind explicitly inserted ids.
+func (mysqlDialect) afterRestore(context.Context, *sql.Tx, []string) error { return nil }
+
+// mysqlSchema is the schema of sqliteSchema for MySQL and MariaDB, including the
+// columns Migrate adds to older SQLite files. Indexed text columns are VARCHAR, and
+// the indexes are part of the tables because MySQL has no CREATE INDEX IF NOT EXISTS.
+// The binary collation compares strings like SQLite.
+var mysqlSchema = []string{
+	`
+CREATE TABLE IF NOT EXISTS schema_version (
+  id       INT PRIMARY KEY,
+  version  BIGINT NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`INSERT IGNORE INTO schema_version (id, version) VALUES (1, 0);`,
+	`
+CREATE TABLE IF NOT EXISTS sites (
+  id                  BIGINT AUTO_INCREMENT PRIMARY KEY,
+  site_key            VARCHAR(255) NOT NULL,
+  title               TEXT NOT NULL DEFAULT (''),
+  status              TEXT NOT NULL DEFAULT (''),
+  created_at          BIGINT NOT NULL,
+  updated_at          BIGINT NOT NULL,
+  pipeline_paused_at  BIGINT NOT NULL DEFAULT 0,
+  summary_sent_at     BIGINT NOT NULL DEFAULT 0,
+
+  UNIQUE KEY idx_sites_key (site_key),
+  KEY idx_sites_updated (updated_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS users (
+  id                    BIGINT AUTO_INCREMENT PRIMARY KEY,
+  password              TEXT NOT NULL,
+  firstname             TEXT,
+  lastname              TEXT,
+  email                 VARCHAR(255) NOT NULL,
+  created_at            BIGINT NOT NULL,
+  updated_at            BIGINT NOT NULL,
+  last_login_at         BIGINT NOT NULL DEFAULT 0,
+  must_change_password  BIGINT NOT NULL DEFAULT 0,
+  password_changed_at   BIGINT NOT NULL DEFAULT 0,
+
+  UNIQUE KEY idx_users_email (email),
+  KEY idx_users_updated (updated_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS comments (
+  id            VARCHAR(255) PRIMARY KEY,
+  site_id       BIGINT NOT NULL,
+  entry_id      TEXT,
+  post_path     VARCHAR(512) NOT NULL,
+  parent_id     VARCHAR(255),
+  status        VARCHAR(32) NOT NULL,
+  author        TEXT NOT NULL,
+  email         TEXT NOT NULL,
+  author_url    TEXT,
+  body          TEXT NOT NULL,
+  ip            VARCHAR(64) NOT NULL DEFAULT '',
+  spam_score    BIGINT NOT NULL DEFAULT 0,
+  spam_rules    TEXT NOT NULL DEFAULT (''),
+  word_matches  TEXT NOT NULL DEFAULT (''),
+  email_md5     TEXT NOT NULL DEFAULT (''),
+  email_sha256  TEXT NOT NULL DEFAULT (''),
+  decided_by    TEXT NOT NULL DEFAULT (''),
+  decided_via   TEXT NOT NULL DEFAULT (''),
+  created_at    BIGINT NOT NULL,
+  approved_at   BIGINT,
+  rejected_at   BIGINT,
+  deleted_at    BIGINT,
+  updated_at    BIGINT NOT NULL,
+
+  KEY idx_comments_site_status_created (site_id, status, created_at),
+  KEY idx_comments_site_post_created (site_id, post_path, created_at),
+  KEY idx_comments_site_status_approved (site_id, status, approved_at),
+  KEY idx_comments_site_parent_created (site_id, parent_id, created_at),
+  KEY idx_comments_site_ip_created (site_id, ip, created_at),
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE,
+  FOREIGN KEY(parent_id) REFERENCES comments(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS pipeline_runs (
+  id                  BIGINT AUTO_INCREMENT PRIMARY KEY,
+  site_id             BIGINT NOT NULL,
+  trigger_comment_id  TEXT,
+
+  state               VARCHAR(32) NOT NULL,
+  step                TEXT,
+  error_message       TEXT,
+
+  created_at          BIGINT NOT NULL,
+  started_at          BIGINT,
+  finished_at         BIGINT,
+  coalesced_into      BIGINT,
+  attempts            BIGINT NOT NULL DEFAULT 0,
+  next_retry_at       BIGINT,
+  deploy_status       BIGINT,
+  dry_run             BIGINT NOT NULL DEFAULT 0,
+
+  KEY idx_runs_site_created (site_id, created_at),
+  KEY idx_runs_state_created (state, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS pipeline_run_logs (
+  id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+  run_id      BIGINT NOT NULL,
+  step        TEXT NOT NULL,
+  content     MEDIUMTEXT NOT NULL,
+  created_at  BIGINT NOT NULL,
+
+  KEY idx_run_logs_run (run_id, id),
+  FOREIGN KEY(run_id) REFERENCES pipeline_runs(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS pipeline_run_files (
+  run_id      BIGINT NOT NULL,
+  action      TEXT NOT NULL,
+  path        VARCHAR(512) NOT NULL,
+
+  PRIMARY KEY(run_id, path),
+  FOREIGN KEY(run_id) REFERENCES pipeline_runs(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS generated_bundles (
+  site_id     BIGINT NOT NULL,
+  post_path   VARCHAR(512) NOT NULL,
+  hash        TEXT NOT NULL,
+  updated_at  BIGINT NOT NULL,
+
+  PRIMARY KEY(site_id, post_path),
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS mail_outbox (
+  id               BIGINT AUTO_INCREMENT PRIMARY KEY,
+  site_id          BIGINT NOT NULL,
+  comment_id       VARCHAR(255) NOT NULL,
+  kind             TEXT NOT NULL,
+  base_url         TEXT NOT NULL DEFAULT (''),
+
+  status           VARCHAR(32) NOT NULL,
+  attempts         BIGINT NOT NULL DEFAULT 0,
+  last_error       TEXT,
+  next_attempt_at  BIGINT NOT NULL,
+
+  created_at       BIGINT NOT NULL,
+  updated_at       BIGINT NOT NULL,
+
+  KEY idx_mail_outbox_status_next (status, next_attempt_at),
+  KEY idx_mail_outbox_comment (comment_id),
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE,
+  FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS user_sites (
+  user_id BIGINT NOT NULL,
+  site_id BIGINT NOT NULL,
+  PRIMARY KEY(user_id, site_id),
+  KEY idx_user_sites_site (site_id),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id            BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id       BIGINT NOT NULL,
+  name          TEXT NOT NULL DEFAULT (''),
+  prefix        TEXT NOT NULL,
+  scopes        TEXT NOT NULL DEFAULT (''),
+  token_hash    VARCHAR(128) NOT NULL,
+  expires_at    BIGINT,
+  last_used_at  BIGINT,
+  created_at    BIGINT NOT NULL,
+  revoked_at    BIGINT,
+
+  UNIQUE KEY idx_api_tokens_hash (token_hash),
+  KEY idx_api_tokens_user (user_id),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS user_identities (
+  id             BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id        BIGINT NOT NULL,
+  issuer         VARCHAR(255) NOT NULL,
+  subject        VARCHAR(255) NOT NULL,
+  email          TEXT NOT NULL DEFAULT (''),
+  created_at     BIGINT NOT NULL,
+  last_login_at  BIGINT,
+
+  UNIQUE KEY idx_user_identities_issuer_subject (issuer, subject),
+  KEY idx_user_identities_user (user_id),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS sessions (
+  id            VARCHAR(255) PRIMARY KEY,
+  user_id       BIGINT,
+  data          MEDIUMBLOB NOT NULL,
+  ip            VARCHAR(64) NOT NULL DEFAULT '',
+  user_agent    TEXT NOT NULL DEFAULT (''),
+  created_at    BIGINT NOT NULL,
+  last_seen_at  BIGINT NOT NULL,
+  expires_at    BIGINT NOT NULL,
+
+  KEY idx_sessions_user (user_id),
+  KEY idx_sessions_expires (expires_at),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS login_history (
+  id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id     BIGINT NOT NULL,
+  success     BIGINT NOT NULL,
+  method      TEXT NOT NULL,
+  ip          VARCHAR(64) NOT NULL DEFAULT '',
+  user_agent  TEXT NOT NULL DEFAULT (''),
+  created_at  BIGINT NOT NULL,
+
+  KEY idx_login_history_user (user_id, id),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id                BIGINT AUTO_INCREMENT PRIMARY KEY,
+  site_id           BIGINT NOT NULL,
+  event             TEXT NOT NULL,
+  url               TEXT NOT NULL,
+  payload           MEDIUMTEXT NOT NULL,
+
+  status            VARCHAR(32) NOT NULL,
+  attempts          BIGINT NOT NULL DEFAULT 0,
+  last_status_code  BIGINT,
+  last_error        TEXT,
+
+  created_at        BIGINT NOT NULL,
+  updated_at        BIGINT NOT NULL,
+
+  KEY idx_webhook_deliveries_site_created (site_id, created_at),
+  KEY idx_webhook_deliveries_status (status, created_at),
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS blocklist (
+  id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+  site_id     BIGINT NOT NULL,
+  kind        VARCHAR(32) NOT NULL,
+  value       VARCHAR(255) NOT NULL,
+  note        TEXT NOT NULL DEFAULT (''),
+  created_by  BIGINT,
+  created_at  BIGINT NOT NULL,
+
+  UNIQUE KEY idx_blocklist_site_kind_value (site_id, kind, value),
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS comment_revisions (
+  id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+  site_id     BIGINT NOT NULL,
+  comment_id  VARCHAR(255) NOT NULL,
+  field       TEXT NOT NULL,
+  old_value   TEXT NOT NULL,
+  new_value   TEXT NOT NULL,
+  reason      TEXT NOT NULL DEFAULT (''),
+  changed_by  BIGINT,
+  created_at  BIGINT NOT NULL,
+
+  KEY idx_comment_revisions_comment (site_id, comment_id, id),
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS audit_log (
+  id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+  user_id     BIGINT,
+  site_id     BIGINT,
+  action      TEXT NOT NULL,
+  details     TEXT NOT NULL DEFAULT (''),
+  created_at  BIGINT NOT NULL,
+
+  KEY idx_audit_log_created (created_at),
+  KEY idx_audit_log_site_created (site_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS captcha_challenges (
+  id          VARCHAR(255) PRIMARY KEY,
+  answer      TEXT NOT NULL,
+  created_at  BIGINT NOT NULL,
+  expires_at  BIGINT NOT NULL,
+
+  KEY idx_captcha_challenges_expires (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+	`
+CREATE TABLE IF NOT EXISTS spam_rule_feedback (
+  site_id     BIGINT NOT NULL,
+  rule        VARCHAR(255) NOT NULL,
+  spam_count  BIGINT NOT NULL DEFAULT 0,
+  ham_count   BIGINT NOT NULL DEFAULT 0,
+  updated_at  BIGINT NOT NULL,
+
+  PRIMARY KEY(site_id, rule),
+  FOREIGN KEY(site_id) REFERENCES sites(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+`,
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of notification mails queued in the mail outbox.
+const (
+	MailModeration   = "moderation"
+	MailConfirmation = "confirmation"
+)
+
+// Outbox states.
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+	// OutboxSkipped marks mails that became obsolete, e.g. the comment was moderated meanwhile.
+	OutboxSkipped = "skipped"
+)
+
+// OutboxGrace is the delay before the outbox worker picks up a new mail. The request
+// that queued it normally sends it right away and marks it sent within this time.
+const OutboxGrace = 2 * time.Minute
+
+// OutboxMail is a notification mail waiting to be sent. The mail itself is built
+// from the comment when it is sent.
+type OutboxMail struct {
+	ID        int64
+	SiteID    int64
+	CommentID string
+	Kind      string
+	BaseURL   string
+	Attempts  int
+}
+
+// insertOutboxMail queues a mail with q, which may be a transaction.
+func (d *DB) insertOutboxMail(ctx context.Context, q queryer, m OutboxMail) (int64, error) {
+	now := time.Now()
+	id, err := d.dialect().insertID(ctx, q, `
+INSERT INTO mail_outbox (site_id, comment_id, kind, base_url, status, attempts, next_attempt_at, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?);
+`, m.SiteID, m.CommentID, m.Kind, strings.TrimSpace(m.BaseURL), OutboxPending, now.Add(OutboxGrace).Unix(), now.Unix(), now.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("insert outbox mail: %w", err)
+	}
+	return id, nil
+}
+
+// InsertCommentWithMail stores a comment and queues its notification mail of the given
+// kind in one transaction, so a crash cannot leave a comment nobody is told about.
+func (d *DB) InsertCommentWithMail(ctx context.Context, c Comment, kind, baseURL string) (OutboxMail, error) {
+	m := OutboxMail{SiteID: c.SiteID, CommentID: c.ID, Kind: kind, BaseURL: baseURL}
+	if d == nil || d.SQL == nil {
+		return m, fmt.Errorf("db not initialized")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return m, fmt.Errorf("insert comment begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := insertComment(ctx, tx, c); err != nil {
+		return m, err
+	}
+	if m.ID, err = d.insertOutboxMail(ctx, tx, m); err != nil {
+		return m, err
+	}
+	if err := tx.Commit(); err != nil {
+		return m, fmt.Errorf("insert comment commit: %w", err)
+	}
+	return m, nil
+}
+
+// ConfirmCommentWithMail moves an unconfirmed comment created at or after notBefore
+// into the moderation queue and queues its moderation mail in the same transaction.
+// It returns false if the comment is unknown, already confirmed or expired.
+func (d *DB) ConfirmCommentWithMail(ctx context.Context, siteID int64, commentID string, notBefore int64, baseURL string) (OutboxMail, bool, error) {
+	m := OutboxMail{SiteID: siteID, CommentID: strings.TrimSpace(commentID), Kind: MailModeration, BaseURL: baseURL}
+	if d == nil || d.SQL == nil {
+		return m, false, fmt.Errorf("db not initialized")
+	}
+	if siteID <= 0 || m.CommentID == "" {
+		return m, false, fmt.Errorf("siteID and commentID are required")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return m, false, fmt.Errorf("confirm comment begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	changed, err := confirmComment(ctx, tx, siteID, m.CommentID, notBefore)
+	if err != nil || !changed {
+		return m, false, err
+	}
+	if m.ID, err = d.insertOutboxMail(ctx, tx, m); err != nil {
+		return m, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return m, false, fmt.Errorf("confirm comment commit: %w", err)
+	}
+	return m, true, nil
+}
+
+// ListDueMails returns pending outbox mails whose next attempt is due, oldest first.
+func (d *DB) ListDueMails(ctx context.Context, now int64, limit int) ([]OutboxMail, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT id, site_id, comment_id, kind, base_url, attempts
+  FROM mail_outbox
+ WHERE status = ?
+   AND next_attempt_at <= ?
+ ORDER BY next_attempt_at ASC, id ASC
+ LIMIT ?;
+`, OutboxPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list due mails: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []OutboxMail
+	for rows.Next() {
+		var m OutboxMail
+		if err := rows.Scan(&m.ID, &m.SiteID, &m.CommentID, &m.Kind, &m.BaseURL, &m.Attempts); err != nil {
+			return nil, fmt.Errorf("scan due mail: %w", err)
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate due mails: %w", err)
+	}
+	return out, nil
+}
+
+// RecordMailAttempt stores the result of a send attempt. For a pending mail,
+// nextAttempt is the time of the next try.
+func (d *DB) RecordMailAttempt(ctx context.Context, mailID int64, status string, attempts int, errMsg string, nextAttempt int64) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	var lastErr any
+	if errMsg != "" {
+		lastErr = errMsg
+	}
+	if _, err := d.SQL.ExecContext(ctx, `
+UPDATE mail_outbox
+   SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ?, updated_at = ?
+ WHERE id = ?;
+`, status, attempts, lastErr, nextAttempt, nowUnix(), mailID); err != nil {
+		return fmt.Errorf("record mail attempt: %w", err)
+	}
+	return nil
+}
+
+// DeleteOldOutboxMails removes sent and failed outbox mails last updated before the given time.
+func (d *DB) DeleteOldOutboxMails(ctx context.Context, before int64) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `DELETE FROM mail_outbox WHERE status <> ? AND updated_at < ?;`, OutboxPending, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete old outbox mails: %w", err)
+	}
+	return res.RowsAffected()
+}
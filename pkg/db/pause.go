@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetPipelinePaused pauses or resumes the pipeline of a site.
+// Returns false if the site was already in the requested state.
+func (d *DB) SetPipelinePaused(ctx context.Context, siteID int64, paused bool) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+
+	var (
+		query string
+		args  []any
+	)
+	if paused {
+		query = `UPDATE sites SET pipeline_paused_at = ?, updated_at = ? WHERE id = ? AND pipeline_paused_at = 0;`
+		now := nowUnix()
+		args = []any{now, now, siteID}
+	} else {
+		query = `UPDATE sites SET pipeline_paused_at = 0, updated_at = ? WHERE id = ? AND pipeline_paused_at <> 0;`
+		args = []any{nowUnix(), siteID}
+	}
+
+	res, err := d.SQL.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("set pipeline paused: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("set pipeline paused rows affected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// HoldRunIfPaused marks a run as paused if the pipeline of its site is paused.
+// The check and the update are one statement, so a concurrent resume cannot miss the run.
+func (d *DB) HoldRunIfPaused(ctx context.Context, runID, siteID int64) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `
+UPDATE pipeline_runs
+   SET state = ?
+ WHERE id = ?
+   AND EXISTS (SELECT 1 FROM sites WHERE id = ? AND pipeline_paused_at <> 0);
+`, RunPaused, runID, siteID)
+	if err != nil {
+		return false, fmt.Errorf("hold run: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("hold run rows affected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// ReleasePausedRuns puts the newest paused run of a site back into state queued and
+// coalesces the older ones into it, since every run regenerates all approved comments.
+// Returns the released run, or false if no run was held back.
+func (d *DB) ReleasePausedRuns(ctx context.Context, siteID int64) (int64, bool, error) {
+	if d == nil || d.SQL == nil {
+		return 0, false, fmt.Errorf("db not initialized")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("begin release paused runs: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var runID int64
+	err = tx.QueryRowContext(ctx, `
+SELECT COALESCE(MAX(id), 0)
+  FROM pipeline_runs
+ WHERE site_id = ?
+   AND state = ?;
+`, siteID, RunPaused).Scan(&runID)
+	if err != nil {
+		return 0, false, fmt.Errorf("find paused run: %w", err)
+	}
+	if runID == 0 {
+		return 0, false, nil
+	}
+
+	now := nowUnix()
+	if _, err := tx.ExecContext(ctx, `
+UPDATE pipeline_runs
+   SET state = ?, finished_at = ?, coalesced_into = ?
+ WHERE site_id = ?
+   AND state = ?
+   AND id <> ?;
+`, RunCoalesced, now, runID, siteID, RunPaused, runID); err != nil {
+		return 0, false, fmt.Errorf("coalesce paused runs: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE pipeline_runs SET state = ? WHERE id = ?;`, RunQueued, runID); err != nil {
+		return 0, false, fmt.Errorf("release paused run: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("commit release paused runs: %w", err)
+	}
+	committed = true
+	return runID, true, nil
+}
+
+// CountPausedRuns returns the number of runs held back for a site.
+func (d *DB) CountPausedRuns(ctx context.Context, siteID int64) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	var n int64
+	if err := d.reader().QueryRowContext(ctx, `
+SELECT COUNT(*) FROM pipeline_runs WHERE site_id = ? AND state = ?;
+`, siteID, RunPaused).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count paused runs: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PseudonymizeRequest selects the comments of one author on a site.
+// Email and Author are matched exactly (email case-insensitively); at least one must be set.
+type PseudonymizeRequest struct {
+	SiteID  int64
+	Email   string
+	Author  string
+	NewName string
+	Reason  string
+	UserID  int64
+}
+
+// PseudonymizeResult describes the changed comments.
+type PseudonymizeResult struct {
+	Changed int
+	// ApprovedChanged reports whether published (approved) comments were changed,
+	// i.e. whether the site's generated content must be rebuilt.
+	ApprovedChanged bool
+	PostPaths       []string
+}
+
+// PseudonymizeAuthor replaces the display name of all matching comments and clears
+// the other personal data of the author (email and its hashes, URL and IP) in one
+// transaction, recording a revision per comment and one audit log entry. Only the
+// old name is kept, in the revision.
+func (d *DB) PseudonymizeAuthor(ctx context.Context, req PseudonymizeRequest) (PseudonymizeResult, error) {
+	var res PseudonymizeResult
+	if d == nil || d.SQL == nil {
+		return res, fmt.Errorf("db not initialized")
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	author := strings.TrimSpace(req.Author)
+	if email == "" && author == "" {
+		return res, fmt.Errorf("email or author is required")
+	}
+	if strings.TrimSpace(req.NewName) == "" {
+		return res, fmt.Errorf("new name is required")
+	}
+
+	query := `
+SELECT id, author, status, post_path,
+       (email <> '' OR author_url IS NOT NULL OR ip <> '' OR email_md5 <> '' OR email_sha256 <> '')
+  FROM comments
+ WHERE site_id = ?
+`
+	args := []any{req.SiteID}
+	if email != "" {
+		query += "   AND LOWER(email) = ?\n"
+		args = append(args, email)
+	}
+	if author != "" {
+		query += "   AND author = ?\n"
+		args = append(args, author)
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return res, fmt.Errorf("begin pseudonymize tx: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	type match struct {
+		id, author, status, postPath string
+		hasPersonalData              bool
+	}
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return res, fmt.Errorf("select comments: %w", err)
+	}
+	var matches []match
+	for rows.Next() {
+		var m match
+		if err := rows.Scan(&m.id, &m.author, &m.status, &m.postPath, &m.hasPersonalData); err != nil {
+			_ = rows.Close()
+			return res, fmt.Errorf("scan comment: %w", err)
+		}
+		if m.author != req.NewName || m.hasPersonalData {
+			matches = append(matches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return res, fmt.Errorf("iterate comments: %w", err)
+	}
+	_ = rows.Close()
+
+	now := nowUnix()
+	paths := make(map[string]struct{})
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if _, err := tx.ExecContext(ctx, `
+UPDATE comments
+   SET author = ?, email = '', email_md5 = '', email_sha256 = '', author_url = NULL, ip = '', updated_at = ?
+ WHERE site_id = ? AND id = ?
+`, req.NewName, now, req.SiteID, m.id); err != nil {
+			return res, fmt.Errorf("update comment %s: %w", m.id, err)
+		}
+		// The cleared personal data is not copied into revisions.
+		if m.author != req.NewName {
+			if err := insertCommentRevision(ctx, tx, CommentRevision{
+				SiteID:    req.SiteID,
+				CommentID: m.id,
+				Field:     "author",
+				OldValue:  m.author,
+				NewValue:  req.NewName,
+				Reason:    req.Reason,
+				ChangedBy: req.UserID,
+			}); err != nil {
+				return res, err
+			}
+		}
+
+		ids = append(ids, m.id)
+		if m.status == CommentStatusApproved {
+			res.ApprovedChanged = true
+			if _, ok := paths[m.postPath]; !ok {
+				paths[m.postPath] = struct{}{}
+				res.PostPaths = append(res.PostPaths, m.postPath)
+			}
+		}
+	}
+	res.Changed = len(matches)
+
+	if res.Changed > 0 {
+		// The old name is kept only in the revisions; the audit entry does not repeat it.
+		if err := insertAuditLog(ctx, tx, AuditEntry{
+			UserID: req.UserID,
+			SiteID: req.SiteID,
+			Action: AuditCommentPseudonymize,
+			Details: map[string]any{
+				"comment_ids": ids,
+				"new_name":    req.NewName,
+				"reason":      req.Reason,
+			},
+		}); err != nil {
+			return res, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return res, fmt.Errorf("commit pseudonymize tx: %w", err)
+	}
+	committed = true
+	return res, nil
+}
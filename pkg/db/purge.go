@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PurgeFilter selects the deleted comments of a site removed by PurgeComments.
+type PurgeFilter struct {
+	SiteID int64
+	// IDs limits the purge to these comments; empty = all deleted comments of the site.
+	IDs []string
+	// DeletedBefore only selects comments deleted before this time (unix seconds); 0 = any.
+	DeletedBefore int64
+	// UserID is recorded in the audit log; 0 for the automatic purge.
+	UserID int64
+}
+
+// purgeWhere returns the condition selecting the comments of f.
+func purgeWhere(f PurgeFilter) (string, []any) {
+	where := "site_id = ? AND status = ?"
+	args := []any{f.SiteID, CommentStatusDeleted}
+	if f.DeletedBefore > 0 {
+		// Rows restored from exports of older versions may lack deleted_at.
+		where += " AND COALESCE(deleted_at, updated_at) < ?"
+		args = append(args, f.DeletedBefore)
+	}
+	if len(f.IDs) > 0 {
+		where += " AND id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(f.IDs)), ",") + ")"
+		for _, id := range f.IDs {
+			args = append(args, id)
+		}
+	}
+	return where, args
+}
+
+// CountPurgeableComments returns the number of comments PurgeComments would remove.
+func (d *DB) CountPurgeableComments(ctx context.Context, f PurgeFilter) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	if f.SiteID <= 0 {
+		return 0, fmt.Errorf("siteID must be > 0")
+	}
+
+	where, args := purgeWhere(f)
+	var n int64
+	if err := d.reader().QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE "+where+";", args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count purgeable comments: %w", err)
+	}
+	return n, nil
+}
+
+// PurgeComments permanently removes the deleted comments selected by f, with their
+// revisions and queued mails, in one transaction. Replies that are not purged
+// themselves become top-level comments instead of being removed by the foreign key
+// cascade. It returns the IDs of the removed comments.
+func (d *DB) PurgeComments(ctx context.Context, f PurgeFilter) ([]string, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+	if f.SiteID <= 0 {
+		return nil, fmt.Errorf("siteID must be > 0")
+	}
+	where, args := purgeWhere(f)
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin purge tx: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM comments WHERE "+where+" ORDER BY id;", args...)
+	if err != nil {
+		return nil, fmt.Errorf("select purged comments: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("scan purged comment: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, fmt.Errorf("iterate purged comments: %w", err)
+	}
+	_ = rows.Close()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	// The derived table lets MySQL read the table it updates.
+	reparent := append([]any{nowUnix(), f.SiteID}, args...)
+	reparent = append(reparent, args...)
+	if _, err := tx.ExecContext(ctx, `
+UPDATE comments
+   SET parent_id = NULL, updated_at = ?
+ WHERE site_id = ?
+   AND parent_id IN (SELECT id FROM (SELECT id FROM comments WHERE `+where+`) AS purged)
+   AND NOT (`+where+`);
+`, reparent...); err != nil {
+		return nil, fmt.Errorf("detach replies of purged comments: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+DELETE FROM comment_revisions
+ WHERE site_id = ?
+   AND comment_id IN (SELECT id FROM comments WHERE `+where+`);
+`, append([]any{f.SiteID}, args...)...); err != nil {
+		return nil, fmt.Errorf("delete revisions of purged comments: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE "+where+";", args...); err != nil {
+		return nil, fmt.Errorf("purge comments: %w", err)
+	}
+
+	if err := insertAuditLog(ctx, tx, AuditEntry{
+		UserID: f.UserID,
+		SiteID: f.SiteID,
+		Action: AuditCommentPurge,
+		Details: map[string]any{
+			"comment_ids": ids,
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit purge tx: %w", err)
+	}
+	committed = true
+	return ids, nil
+}
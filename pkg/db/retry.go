@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// DueRun is a pipeline run whose retry is due or that waits in state queued.
+type DueRun struct {
+	RunID            int64
+	SiteKey          string
+	TriggerCommentID string
+}
+
+// RunAttempts returns how often a run was started.
+func (d *DB) RunAttempts(ctx context.Context, runID int64) (int, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+
+	var n int
+	if err := d.reader().QueryRowContext(ctx, `SELECT attempts FROM pipeline_runs WHERE id = ?;`, runID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("get run attempts: %w", err)
+	}
+	return n, nil
+}
+
+// ScheduleRunRetry moves a failed run into state retrying; it is picked up again by
+// ClaimDueRetries at nextRetryAt. The error of the failed attempt is kept.
+func (d *DB) ScheduleRunRetry(ctx context.Context, runID int64, nextRetryAt int64) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	if _, err := d.SQL.ExecContext(ctx, `
+UPDATE pipeline_runs
+   SET state = ?, next_retry_at = ?
+ WHERE id = ?
+   AND state = ?;
+`, RunRetrying, nextRetryAt, runID, RunFailed); err != nil {
+		return fmt.Errorf("schedule run retry: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueRetries puts runs whose retry is due back into state queued and returns them.
+func (d *DB) ClaimDueRetries(ctx context.Context, now int64) ([]DueRun, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("claim retries begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `
+SELECT r.id, s.site_key, COALESCE(r.trigger_comment_id, '')
+  FROM pipeline_runs r
+  JOIN sites s ON s.id = r.site_id
+ WHERE r.state = ?
+   AND r.next_retry_at <= ?
+ ORDER BY r.next_retry_at ASC, r.id ASC;
+`, RunRetrying, now)
+	if err != nil {
+		return nil, fmt.Errorf("list due retries: %w", err)
+	}
+	var due []DueRun
+	for rows.Next() {
+		var r DueRun
+		if err := rows.Scan(&r.RunID, &r.SiteKey, &r.TriggerCommentID); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("scan due retry: %w", err)
+		}
+		due = append(due, r)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, fmt.Errorf("iterate due retries: %w", err)
+	}
+	_ = rows.Close()
+
+	for _, r := range due {
+		if _, err := tx.ExecContext(ctx, `UPDATE pipeline_runs SET state = ? WHERE id = ?;`, RunQueued, r.RunID); err != nil {
+			return nil, fmt.Errorf("claim retry: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("claim retries commit: %w", err)
+	}
+	return due, nil
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// CommentRevision records a change of one comment field.
+type CommentRevision struct {
+	ID        int64  `json:"ID"`
+	SiteID    int64  `json:"SiteID"`
+	CommentID string `json:"CommentID"`
+	Field     string `json:"Field"`
+	OldValue  string `json:"OldValue"`
+	NewValue  string `json:"NewValue"`
+	Reason    string `json:"Reason"`
+	ChangedBy int64  `json:"ChangedBy"`
+	// ChangedByEmail is the email of the ChangedBy user, empty for the commenter,
+	// system changes and deleted users.
+	ChangedByEmail string `json:"ChangedByEmail"`
+	CreatedAt      int64  `json:"CreatedAt"`
+}
+
+// insertCommentRevision writes a revision using db or a running transaction.
+func insertCommentRevision(ctx context.Context, ex execer, r CommentRevision) error {
+	_, err := ex.ExecContext(ctx, `
+INSERT INTO comment_revisions (site_id, comment_id, field, old_value, new_value, reason, changed_by, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`,
+		r.SiteID,
+		r.CommentID,
+		r.Field,
+		r.OldValue,
+		r.NewValue,
+		r.Reason,
+		nullInt64(r.ChangedBy),
+		nowUnix(),
+	)
+	if err != nil {
+		return fmt.Errorf("insert comment revision: %w", err)
+	}
+	return nil
+}
+
+// ListCommentRevisions returns the revisions of a comment, oldest first.
+func (d *DB) ListCommentRevisions(ctx context.Context, siteID int64, commentID string) ([]CommentRevision, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT r.id, r.site_id, r.comment_id, r.field, r.old_value, r.new_value, r.reason, COALESCE(r.changed_by, 0), COALESCE(u.email, ''), r.created_at
+  FROM comment_revisions r
+  LEFT JOIN users u ON u.id = r.changed_by
+ WHERE r.site_id = ? AND r.comment_id = ?
+ ORDER BY r.id ASC
+`, siteID, commentID)
+	if err != nil {
+		return nil, fmt.Errorf("list comment revisions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []CommentRevision
+	for rows.Next() {
+		var r CommentRevision
+		if err := rows.Scan(&r.ID, &r.SiteID, &r.CommentID, &r.Field, &r.OldValue, &r.NewValue, &r.Reason, &r.ChangedBy, &r.ChangedByEmail, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan comment revision: %w", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate comment revisions: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Actions of a generated file in a pipeline run manifest.
+const (
+	RunFileCreated = "created"
+	RunFileUpdated = "updated"
+	RunFileRemoved = "removed"
+)
+
+// RunFile is a comment file changed by the generator in a pipeline run.
+type RunFile struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+}
+
+// SaveRunFiles stores the file manifest of a run, replacing an earlier one.
+func (d *DB) SaveRunFiles(ctx context.Context, runID int64, files []RunFile) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("save run files begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM pipeline_run_files WHERE run_id = ?;`, runID); err != nil {
+		return fmt.Errorf("save run files delete: %w", err)
+	}
+	for _, f := range files {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO pipeline_run_files (run_id, action, path) VALUES (?, ?, ?);`, runID, f.Action, f.Path); err != nil {
+			return fmt.Errorf("save run file %q: %w", f.Path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("save run files commit: %w", err)
+	}
+	return nil
+}
+
+// ListRunFiles returns the file manifest of a run of the given site, ordered by path.
+// found is false if the run does not exist or belongs to another site.
+func (d *DB) ListRunFiles(ctx context.Context, siteID, runID int64) ([]RunFile, bool, error) {
+	if d == nil || d.SQL == nil {
+		return nil, false, fmt.Errorf("db not initialized")
+	}
+
+	var one int
+	err := d.reader().QueryRowContext(ctx, `SELECT 1 FROM pipeline_runs WHERE id = ? AND site_id = ?;`, runID, siteID).Scan(&one)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("get run: %w", err)
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT action, path
+  FROM pipeline_run_files
+ WHERE run_id = ?
+ ORDER BY path ASC;
+`, runID)
+	if err != nil {
+		return nil, false, fmt.Errorf("list run files: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := []RunFile{}
+	for rows.Next() {
+		var f RunFile
+		if err := rows.Scan(&f.Action, &f.Path); err != nil {
+			return nil, false, fmt.Errorf("scan run file: %w", err)
+		}
+		out = append(out, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("iterate run files: %w", err)
+	}
+	return out, true, nil
+}
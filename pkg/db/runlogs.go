@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// RunLogChunk is a chunk of subprocess output of a pipeline run step.
+type RunLogChunk struct {
+	ID        int64  `json:"ID"`
+	RunID     int64  `json:"RunID"`
+	Step      string `json:"Step"`
+	Content   string `json:"Content"`
+	CreatedAt int64  `json:"CreatedAt"`
+}
+
+// AppendRunLog stores a chunk of (already redacted) output for a run step.
+func (d *DB) AppendRunLog(ctx context.Context, runID int64, step, content string) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	_, err := d.SQL.ExecContext(ctx, `
+INSERT INTO pipeline_run_logs (run_id, step, content, created_at)
+VALUES (?, ?, ?, ?)
+`,
+		runID,
+		step,
+		content,
+		nowUnix(),
+	)
+	if err != nil {
+		return fmt.Errorf("append run log: %w", err)
+	}
+	return nil
+}
+
+// ListRunLogs returns the log chunks of a run in insertion order.
+func (d *DB) ListRunLogs(ctx context.Context, runID int64) ([]RunLogChunk, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT id, run_id, step, content, created_at
+FROM pipeline_run_logs
+WHERE run_id = ?
+ORDER BY id ASC
+`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("list run logs: %w", err)
+	}
+	defer rows.Close()
+
+	var out []RunLogChunk
+	for rows.Next() {
+		var c RunLogChunk
+		if err := rows.Scan(&c.ID, &c.RunID, &c.Step, &c.Content, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan run log: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate run logs: %w", err)
+	}
+	return out, nil
+}
@@ -1,17 +1,64 @@
 ﻿package db
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 )
 
 const (
-	RunQueued  = "queued"
-	RunRunning = "running"
-	RunSuccess = "success"
-	RunFailed  = "failed"
+	RunQueued    = "queued"
+	RunRunning   = "running"
+	RunSuccess   = "success"
+	RunFailed    = "failed"
+	RunCoalesced = "coalesced"
+	// RunPaused marks a run held back because the site's pipeline is paused.
+	RunPaused = "paused"
+	// RunRetrying marks a failed run that is started again at next_retry_at.
+	RunRetrying = "retrying"
+	// RunCancelled marks a run an admin cancelled before it started.
+	RunCancelled = "cancelled"
 )
 
+// RunStates lists all run states.
+var RunStates = []string{RunQueued, RunRunning, RunSuccess, RunFailed, RunCoalesced, RunPaused, RunRetrying, RunCancelled}
+
+// Run is a row of pipeline_runs.
+type Run struct {
+	ID               int64  `json:"ID"`
+	SiteID           int64  `json:"SiteID"`
+	SiteKey          string `json:"SiteKey"`
+	TriggerCommentID string `json:"TriggerCommentID"`
+	State            string `json:"State"`
+	Step             string `json:"Step"`
+	ErrorMessage     string `json:"ErrorMessage"`
+	Attempts         int    `json:"Attempts"`
+	CreatedAt        int64  `json:"CreatedAt"`
+	StartedAt        int64  `json:"StartedAt"`
+	FinishedAt       int64  `json:"FinishedAt"`
+	NextRetryAt      int64  `json:"NextRetryAt"`
+	CoalescedInto    int64  `json:"CoalescedInto"`
+	// DeployStatus is the HTTP status returned by the deploy hook, 0 if not called.
+	DeployStatus int `json:"DeployStatus"`
+	// DryRun reports that the run skipped commit, push and the later steps.
+	DryRun bool `json:"DryRun"`
+}
+
+// RunListFilter selects pipeline runs for ListRuns.
+type RunListFilter struct {
+	// SiteIDs limits the result to these sites; empty = no runs.
+	SiteIDs []int64
+	// State filters by state; empty = all.
+	State string
+	// Since and Until limit created_at (unix seconds, inclusive); 0 = no bound.
+	Since  int64
+	Until  int64
+	Limit  int
+	Offset int
+}
+
 // nowUnix performs its package-specific operation.
 func nowUnix() int64 {
 	return time.Now().Unix()
@@ -19,7 +66,7 @@ func nowUnix() int64 {
 
 // CreateRun inserts a new pipeline run with state=queued.
 func (d *DB) CreateRun(siteID int64, commentID string) (int64, error) {
-	res, err := d.SQL.Exec(`
+	id, err := d.dialect().insertID(context.Background(), d.SQL, `
 INSERT INTO pipeline_runs (
   site_id, trigger_comment_id, state, created_at
 ) VALUES (?, ?, ?, ?)
@@ -33,14 +80,14 @@ INSERT INTO pipeline_runs (
 		return 0, fmt.Errorf("create run: %w", err)
 	}
 
-	return res.LastInsertId()
+	return id, nil
 }
 
-// MarkRunRunning sets state=running.
+// MarkRunRunning sets state=running and counts the attempt.
 func (d *DB) MarkRunRunning(runID int64) error {
 	_, err := d.SQL.Exec(`
 UPDATE pipeline_runs
-SET state = ?, started_at = ?, step = NULL, error_message = NULL
+SET state = ?, started_at = ?, step = NULL, error_message = NULL, attempts = attempts + 1, next_retry_at = NULL
 WHERE id = ?
 `,
 		RunRunning,
@@ -92,3 +139,464 @@ WHERE id = ?
 	)
 	return err
 }
+
+// MarkRunCoalesced sets state=coalesced and records the run that will cover it.
+func (d *DB) MarkRunCoalesced(runID int64, intoRunID int64) error {
+	_, err := d.SQL.Exec(`
+UPDATE pipeline_runs
+SET state = ?, finished_at = ?, coalesced_into = ?
+WHERE id = ?
+`,
+		RunCoalesced,
+		nowUnix(),
+		intoRunID,
+		runID,
+	)
+	return err
+}
+
+// SetRunDeployStatus records the HTTP status returned by the deploy hook of a run.
+func (d *DB) SetRunDeployStatus(ctx context.Context, runID int64, status int) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	if _, err := d.SQL.ExecContext(ctx, `UPDATE pipeline_runs SET deploy_status = ? WHERE id = ?;`, status, runID); err != nil {
+		return fmt.Errorf("set run deploy status: %w", err)
+	}
+	return nil
+}
+
+// MarkRunDryRun flags a run that skipped commit and push.
+func (d *DB) MarkRunDryRun(ctx context.Context, runID int64) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	if _, err := d.SQL.ExecContext(ctx, `UPDATE pipeline_runs SET dry_run = 1 WHERE id = ?;`, runID); err != nil {
+		return fmt.Errorf("mark run dry run: %w", err)
+	}
+	return nil
+}
+
+// GetRunSiteID returns the site of a pipeline run; found is false for unknown runs.
+func (d *DB) GetRunSiteID(ctx context.Context, runID int64) (int64, bool, error) {
+	if d == nil || d.SQL == nil {
+		return 0, false, fmt.Errorf("db not initialized")
+	}
+
+	var siteID int64
+	err := d.reader().QueryRowContext(ctx, `SELECT site_id FROM pipeline_runs WHERE id = ?;`, runID).Scan(&siteID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("get run site: %w", err)
+	}
+	return siteID, true, nil
+}
+
+// cancellableStates are the states of runs that have not started yet.
+var cancellableStates = []string{RunQueued, RunPaused, RunRetrying}
+
+const runSelect = `
+SELECT r.id, r.site_id, s.site_key, COALESCE(r.trigger_comment_id, ''), r.state, COALESCE(r.step, ''),
+       COALESCE(r.error_message, ''), r.attempts, r.created_at, COALESCE(r.started_at, 0),
+       COALESCE(r.finished_at, 0), COALESCE(r.next_retry_at, 0), COALESCE(r.coalesced_into, 0),
+       COALESCE(r.deploy_status, 0), r.dry_run
+  FROM pipeline_runs r
+  JOIN sites s ON s.id = r.site_id
+`
+
+// scanRun scans a row selected with runSelect.
+func scanRun(row interface{ Scan(...any) error }) (Run, error) {
+	var r Run
+	err := row.Scan(&r.ID, &r.SiteID, &r.SiteKey, &r.TriggerCommentID, &r.State, &r.Step,
+		&r.ErrorMessage, &r.Attempts, &r.CreatedAt, &r.StartedAt,
+		&r.FinishedAt, &r.NextRetryAt, &r.CoalescedInto, &r.DeployStatus, &r.DryRun)
+	return r, err
+}
+
+// runFilterWhere returns the WHERE clause and arguments of a run filter.
+func runFilterWhere(f RunListFilter) (string, []any) {
+	where := " WHERE r.site_id IN (" + strings.TrimSuffix(strings.Repeat("?,", len(f.SiteIDs)), ",") + ")\n"
+	args := make([]any, 0, len(f.SiteIDs)+3)
+	for _, id := range f.SiteIDs {
+		args = append(args, id)
+	}
+	if f.State != "" {
+		where += "   AND r.state = ?\n"
+		args = append(args, f.State)
+	}
+	if f.Since > 0 {
+		where += "   AND r.created_at >= ?\n"
+		args = append(args, f.Since)
+	}
+	if f.Until > 0 {
+		where += "   AND r.created_at <= ?\n"
+		args = append(args, f.Until)
+	}
+	return where, args
+}
+
+// CountRuns returns the number of runs matching the filter (ignoring limit and offset).
+func (d *DB) CountRuns(ctx context.Context, f RunListFilter) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	if len(f.SiteIDs) == 0 {
+		return 0, nil
+	}
+
+	where, args := runFilterWhere(f)
+	var n int64
+	if err := d.reader().QueryRowContext(ctx, "SELECT COUNT(*) FROM pipeline_runs r\n"+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count runs: %w", err)
+	}
+	return n, nil
+}
+
+// ListRuns returns the runs matching the filter, newest first.
+func (d *DB) ListRuns(ctx context.Context, f RunListFilter) ([]Run, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+	out := []Run{}
+	if len(f.SiteIDs) == 0 {
+		return out, nil
+	}
+
+	where, args := runFilterWhere(f)
+	query := runSelect + where + " ORDER BY r.id DESC\n"
+	if f.Limit > 0 {
+		query += " LIMIT ? OFFSET ?\n"
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		query += " LIMIT " + d.dialect().noLimit() + " OFFSET ?\n"
+		args = append(args, f.Offset)
+	}
+
+	rows, err := d.reader().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list runs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan run: %w", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate runs: %w", err)
+	}
+	return out, nil
+}
+
+// GetRun returns a pipeline run; found is false for unknown runs.
+func (d *DB) GetRun(ctx context.Context, runID int64) (Run, bool, error) {
+	if d == nil || d.SQL == nil {
+		return Run{}, false, fmt.Errorf("db not initialized")
+	}
+
+	r, err := scanRun(d.reader().QueryRowContext(ctx, runSelect+" WHERE r.id = ?;", runID))
+	if err == sql.ErrNoRows {
+		return Run{}, false, nil
+	}
+	if err != nil {
+		return Run{}, false, fmt.Errorf("get run: %w", err)
+	}
+	return r, true, nil
+}
+
+// CancelRun marks a run that has not started yet (queued, paused or retrying) as
+// cancelled. It returns false if the run is unknown, already started or covers runs
+// that were coalesced into it, since cancelling it would drop their changes.
+func (d *DB) CancelRun(ctx context.Context, runID int64) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+
+	// The derived table keeps MySQL from rejecting the subquery on the updated table.
+	res, err := d.SQL.ExecContext(ctx, `
+UPDATE pipeline_runs
+   SET state = ?, finished_at = ?, next_retry_at = NULL
+ WHERE id = ?
+   AND state IN (?, ?, ?)
+   AND NOT EXISTS (
+       SELECT 1 FROM (SELECT id FROM pipeline_runs WHERE coalesced_into = ? AND state = ?) AS coalesced
+   );
+`, RunCancelled, nowUnix(), runID, cancellableStates[0], cancellableStates[1], cancellableStates[2], runID, RunCoalesced)
+	if err != nil {
+		return false, fmt.Errorf("cancel run: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("cancel run rows affected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// CountCoalescedRuns returns the number of runs that were coalesced into a run.
+func (d *DB) CountCoalescedRuns(ctx context.Context, runID int64) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+
+	var n int64
+	err := d.reader().QueryRowContext(ctx, `
+SELECT COUNT(*) FROM pipeline_runs WHERE coalesced_into = ? AND state = ?;
+`, runID, RunCoalesced).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count coalesced runs: %w", err)
+	}
+	return n, nil
+}
+
+// RequeueRun puts a failed or cancelled run back into state queued, e.g. for a manual
+// retry. It returns false if the run is unknown or in another state.
+func (d *DB) RequeueRun(ctx context.Context, runID int64) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `
+UPDATE pipeline_runs
+   SET state = ?, finished_at = NULL, next_retry_at = NULL
+ WHERE id = ?
+   AND state IN (?, ?, ?);
+`, RunQueued, runID, RunFailed, RunRetrying, RunCancelled)
+	if err != nil {
+		return false, fmt.Errorf("requeue run: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("requeue run rows affected: %w", err)
+	}
+	return n > 0, nil
+}
+
+// finishedStates are the states of runs that will not run again on their own.
+var finishedStates = []string{RunSuccess, RunFailed, RunCoalesced, RunCancelled}
+
+// pruneRunsWhere restricts a run filter to finished runs.
+func pruneRunsWhere(f RunListFilter) (string, []any) {
+	where, args := runFilterWhere(f)
+	where += "   AND r.state IN (?, ?, ?, ?)\n"
+	for _, s := range finishedStates {
+		args = append(args, s)
+	}
+	return where, args
+}
+
+// CountPrunableRuns returns the number of runs PruneRuns would delete.
+func (d *DB) CountPrunableRuns(ctx context.Context, f RunListFilter) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	if len(f.SiteIDs) == 0 {
+		return 0, nil
+	}
+
+	where, args := pruneRunsWhere(f)
+	var n int64
+	if err := d.reader().QueryRowContext(ctx, "SELECT COUNT(*) FROM pipeline_runs r\n"+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count prunable runs: %w", err)
+	}
+	return n, nil
+}
+
+// PruneRuns deletes finished runs matching the filter, with their logs and file
+// manifests. Limit and offset are ignored; queued, running, paused and retrying runs
+// are always kept.
+func (d *DB) PruneRuns(ctx context.Context, f RunListFilter) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	if len(f.SiteIDs) == 0 {
+		return 0, nil
+	}
+
+	where, args := pruneRunsWhere(f)
+	// The derived table lets MySQL read the table it deletes from.
+	res, err := d.SQL.ExecContext(ctx, "DELETE FROM pipeline_runs WHERE id IN (SELECT id FROM (SELECT r.id FROM pipeline_runs r\n"+where+") AS prunable);", args...)
+	if err != nil {
+		return 0, fmt.Errorf("prune runs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RunRetention selects the finished runs of a site deleted by PruneRunsByRetention.
+// A run is kept if it is one of the KeepRuns newest runs or was created at or after
+// Before; a zero field does not keep any runs.
+type RunRetention struct {
+	KeepRuns int
+	Before   int64
+}
+
+// retentionWhere returns the condition for finished runs of a site beyond the retention.
+// The derived table lets MySQL use it in a DELETE of pipeline_runs.
+func retentionWhere(siteID int64, r RunRetention) (string, []any) {
+	where := `
+ WHERE site_id = ?
+   AND state IN (?, ?, ?, ?)
+   AND id NOT IN (SELECT id FROM (SELECT id FROM pipeline_runs WHERE site_id = ? ORDER BY id DESC LIMIT ?) AS kept)
+`
+	args := []any{siteID}
+	for _, s := range finishedStates {
+		args = append(args, s)
+	}
+	args = append(args, siteID, r.KeepRuns)
+	if r.Before > 0 {
+		where += "   AND created_at < ?\n"
+		args = append(args, r.Before)
+	}
+	return where, args
+}
+
+// CountRunsByRetention returns the number of runs PruneRunsByRetention would delete.
+func (d *DB) CountRunsByRetention(ctx context.Context, siteID int64, r RunRetention) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	if r.KeepRuns <= 0 && r.Before <= 0 {
+		return 0, nil
+	}
+
+	where, args := retentionWhere(siteID, r)
+	var n int64
+	if err := d.reader().QueryRowContext(ctx, "SELECT COUNT(*) FROM pipeline_runs"+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count runs by retention: %w", err)
+	}
+	return n, nil
+}
+
+// PruneRunsByRetention deletes the finished runs of a site that the retention does
+// not keep, with their logs and file manifests. Without limits nothing is deleted.
+func (d *DB) PruneRunsByRetention(ctx context.Context, siteID int64, r RunRetention) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	if r.KeepRuns <= 0 && r.Before <= 0 {
+		return 0, nil
+	}
+
+	where, args := retentionWhere(siteID, r)
+	res, err := d.SQL.ExecContext(ctx, "DELETE FROM pipeline_runs"+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("prune runs by retention: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// IsRunQueued reports whether a run is still in state queued, so the worker can skip
+// runs cancelled while they waited in the queue.
+func (d *DB) IsRunQueued(ctx context.Context, runID int64) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+
+	var state string
+	err := d.reader().QueryRowContext(ctx, `SELECT state FROM pipeline_runs WHERE id = ?;`, runID).Scan(&state)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get run state: %w", err)
+	}
+	return state == RunQueued, nil
+}
+
+// ListQueuedRuns returns the runs in state queued, oldest first, so the worker can
+// queue them again after a restart.
+func (d *DB) ListQueuedRuns(ctx context.Context) ([]DueRun, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT r.id, s.site_key, COALESCE(r.trigger_comment_id, '')
+  FROM pipeline_runs r
+  JOIN sites s ON s.id = r.site_id
+ WHERE r.state = ?
+ ORDER BY r.id ASC;
+`, RunQueued)
+	if err != nil {
+		return nil, fmt.Errorf("list queued runs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []DueRun
+	for rows.Next() {
+		var r DueRun
+		if err := rows.Scan(&r.RunID, &r.SiteKey, &r.TriggerCommentID); err != nil {
+			return nil, fmt.Errorf("scan queued run: %w", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate queued runs: %w", err)
+	}
+	return out, nil
+}
+
+// LastRunStartedAt returns the start time of the most recently started run for a site.
+func (d *DB) LastRunStartedAt(ctx context.Context, siteID int64) (int64, bool, error) {
+	if d == nil || d.SQL == nil {
+		return 0, false, fmt.Errorf("db not initialized")
+	}
+	if siteID <= 0 {
+		return 0, false, fmt.Errorf("siteID must be > 0")
+	}
+
+	var startedAt sql.NullInt64
+	err := d.reader().QueryRowContext(ctx, `
+SELECT MAX(started_at)
+  FROM pipeline_runs
+ WHERE site_id = ?
+   AND started_at IS NOT NULL;
+`, siteID).Scan(&startedAt)
+	if err != nil {
+		return 0, false, fmt.Errorf("last run started at: %w", err)
+	}
+	if !startedAt.Valid {
+		return 0, false, nil
+	}
+	return startedAt.Int64, true, nil
+}
+
+// ListRunStartsSince returns the start times of all runs for a site started at or after since,
+// ordered ascending.
+func (d *DB) ListRunStartsSince(ctx context.Context, siteID int64, since int64) ([]int64, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+	if siteID <= 0 {
+		return nil, fmt.Errorf("siteID must be > 0")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT started_at
+  FROM pipeline_runs
+ WHERE site_id = ?
+   AND started_at >= ?
+ ORDER BY started_at ASC;
+`, siteID, since)
+	if err != nil {
+		return nil, fmt.Errorf("list run starts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make([]int64, 0)
+	for rows.Next() {
+		var startedAt int64
+		if err := rows.Scan(&startedAt); err != nil {
+			return nil, fmt.Errorf("scan run start: %w", err)
+		}
+		out = append(out, startedAt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate run starts: %w", err)
+	}
+	return out, nil
+}
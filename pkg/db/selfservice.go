@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RevisionReasonAuthorEdit is stored with revisions made by the commenter.
+const RevisionReasonAuthorEdit = "author_edit"
+
+// UpdateCommentBody replaces the body of a comment that has not been moderated yet
+// (pending, unconfirmed or spam) and records the old body as revision.
+// It returns false if the comment does not exist, was already moderated or the body
+// is unchanged.
+func (d *DB) UpdateCommentBody(ctx context.Context, siteID int64, commentID, body string) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+	commentID = strings.TrimSpace(commentID)
+	if siteID <= 0 || commentID == "" {
+		return false, fmt.Errorf("siteID and commentID are required")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin update body tx: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var oldBody string
+	err = tx.QueryRowContext(ctx, `
+SELECT body
+  FROM comments
+ WHERE site_id = ? AND id = ? AND status IN (?, ?, ?);
+`, siteID, commentID, CommentStatusPending, CommentStatusUnconfirmed, CommentStatusSpam).Scan(&oldBody)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("select comment body: %w", err)
+	}
+	if oldBody == body {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+UPDATE comments
+   SET body = ?, updated_at = ?
+ WHERE site_id = ? AND id = ?;
+`, body, nowUnix(), siteID, commentID); err != nil {
+		return false, fmt.Errorf("update comment body: %w", err)
+	}
+	if err := insertCommentRevision(ctx, tx, CommentRevision{
+		SiteID:    siteID,
+		CommentID: commentID,
+		Field:     "body",
+		OldValue:  oldBody,
+		NewValue:  body,
+		Reason:    RevisionReasonAuthorEdit,
+	}); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit update body tx: %w", err)
+	}
+	committed = true
+	return true, nil
+}
+
+// DeleteOwnComment removes a comment withdrawn by its author, together with its
+// revisions. Only comments that have not been moderated yet (pending, unconfirmed
+// or spam) are removed.
+func (d *DB) DeleteOwnComment(ctx context.Context, siteID int64, commentID string) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+	commentID = strings.TrimSpace(commentID)
+	if siteID <= 0 || commentID == "" {
+		return false, fmt.Errorf("siteID and commentID are required")
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin delete own comment tx: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	res, err := tx.ExecContext(ctx, `
+DELETE FROM comments
+ WHERE site_id = ? AND id = ? AND status IN (?, ?, ?);
+`, siteID, commentID, CommentStatusPending, CommentStatusUnconfirmed, CommentStatusSpam)
+	if err != nil {
+		return false, fmt.Errorf("delete own comment: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete own comment rows affected: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM comment_revisions WHERE site_id = ? AND comment_id = ?;`, siteID, commentID); err != nil {
+		return false, fmt.Errorf("delete comment revisions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("commit delete own comment tx: %w", err)
+	}
+	committed = true
+	return true, nil
+}
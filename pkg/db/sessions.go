@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Session is an admin login stored by the server-side session store. Data holds the
+// encoded session values.
+type Session struct {
+	ID         string
+	UserID     int64 // 0 for sessions without login, e.g. of a running OIDC login
+	Data       []byte
+	IP         string
+	UserAgent  string
+	CreatedAt  int64
+	LastSeenAt int64
+	ExpiresAt  int64
+}
+
+// GetSession returns the session with the given ID unless it has expired.
+func (d *DB) GetSession(ctx context.Context, id string) (Session, bool, error) {
+	if d == nil || d.SQL == nil {
+		return Session{}, false, fmt.Errorf("db not initialized")
+	}
+
+	var s Session
+	err := d.reader().QueryRowContext(ctx, `
+SELECT id, COALESCE(user_id, 0), data, ip, user_agent, created_at, last_seen_at, expires_at
+  FROM sessions
+ WHERE id = ?
+   AND expires_at > ?;
+`, id, nowUnix()).Scan(&s.ID, &s.UserID, &s.Data, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return Session{}, false, nil
+	}
+	if err != nil {
+		return Session{}, false, fmt.Errorf("get session: %w", err)
+	}
+	return s, true, nil
+}
+
+// PutSession creates or replaces a session. CreatedAt of an existing session is kept.
+func (d *DB) PutSession(ctx context.Context, s Session) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	if s.ID == "" {
+		return fmt.Errorf("session id is required")
+	}
+
+	if _, err := d.SQL.ExecContext(ctx, d.dialect().upsert(`
+INSERT INTO sessions (id, user_id, data, ip, user_agent, created_at, last_seen_at, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, "id", `
+  user_id = excluded.user_id,
+  data = excluded.data,
+  ip = excluded.ip,
+  user_agent = excluded.user_agent,
+  last_seen_at = excluded.last_seen_at,
+  expires_at = excluded.expires_at`), s.ID, nullInt64(s.UserID), s.Data, s.IP, s.UserAgent, s.CreatedAt, s.LastSeenAt, s.ExpiresAt); err != nil {
+		return fmt.Errorf("put session: %w", err)
+	}
+	return nil
+}
+
+// ListUserSessions returns the active sessions of a user, most recently used first.
+func (d *DB) ListUserSessions(ctx context.Context, userID int64) ([]Session, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT id, COALESCE(user_id, 0), data, ip, user_agent, created_at, last_seen_at, expires_at
+  FROM sessions
+ WHERE user_id = ?
+   AND expires_at > ?
+ ORDER BY last_seen_at DESC, created_at DESC;
+`, userID, nowUnix())
+	if err != nil {
+		return nil, fmt.Errorf("list user sessions: %w", err)
+	}
+	defer rows.Close()
+
+	out := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Data, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		out = append(out, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list user sessions: %w", err)
+	}
+	return out, nil
+}
+
+// DeleteSession removes a session.
+func (d *DB) DeleteSession(ctx context.Context, id string) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	if _, err := d.SQL.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?;`, id); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserSessions removes all sessions of a user except keepID and returns their number.
+func (d *DB) DeleteUserSessions(ctx context.Context, userID int64, keepID string) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	res, err := d.SQL.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND id <> ?;`, userID, keepID)
+	if err != nil {
+		return 0, fmt.Errorf("delete user sessions: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpiredSessions removes sessions that expired before now.
+func (d *DB) DeleteExpiredSessions(ctx context.Context, now int64) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	res, err := d.SQL.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= ?;`, now)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+	return res.RowsAffected()
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -15,6 +16,9 @@ type Site struct {
 	Status    string `json:"Status"`
 	CreatedAt int64  `json:"CreatedAt"`
 	UpdatedAt int64  `json:"UpdatedAt"`
+
+	// PipelinePausedAt is set while the site's pipeline is paused (0 = running).
+	PipelinePausedAt int64 `json:"PipelinePausedAt"`
 }
 
 const (
@@ -22,6 +26,30 @@ const (
 	SiteStatusDisabled = "disabled"
 )
 
+// SyncOptions controls how SyncSites handles sites missing from the configuration.
+type SyncOptions struct {
+	// KeepMissing leaves active sites that are missing from the configuration active
+	// and only reports them, e.g. to survive a temporarily broken config file.
+	KeepMissing bool
+}
+
+// SyncSummary lists the site keys by the action SyncSites applied to them.
+type SyncSummary struct {
+	Inserted  []string `json:"inserted"`
+	Enabled   []string `json:"enabled"`
+	Disabled  []string `json:"disabled"`
+	Unchanged []string `json:"unchanged"`
+	// Missing lists active sites missing from the configuration that were kept active (KeepMissing).
+	Missing  []string `json:"missing"`
+	SyncedAt int64    `json:"synced_at"`
+}
+
+// String returns a one-line summary for logs.
+func (s SyncSummary) String() string {
+	return fmt.Sprintf("inserted=%v enabled=%v disabled=%v unchanged=%d missing=%v",
+		s.Inserted, s.Enabled, s.Disabled, len(s.Unchanged), s.Missing)
+}
+
 type cfgSiteInfo struct {
 	seen  bool
 	title string
@@ -29,23 +57,26 @@ type cfgSiteInfo struct {
 
 // SyncSites reconciles config site keys with DB rows.
 // Rules:
-// - missing config key disables DB rows only when current status is "active"
+// - missing config key disables DB rows only when current status is "active" (unless opts.KeepMissing)
 // - existing config key enables DB rows only when current status is "disabled"
 // - other statuses remain untouched
 // - new config keys are inserted as active
-func (d *DB) SyncSites(ctx context.Context, configuredSiteKeys map[string]string) error {
+//
+// The summary is also kept for LastSyncSummary.
+func (d *DB) SyncSites(ctx context.Context, configuredSiteKeys map[string]string, opts SyncOptions) (SyncSummary, error) {
+	var summary SyncSummary
 	if d == nil || d.SQL == nil {
-		return fmt.Errorf("db not initialized")
+		return summary, fmt.Errorf("db not initialized")
 	}
 
 	cfgByKey := make(map[string]cfgSiteInfo, len(configuredSiteKeys))
 	for rawKey, rawTitle := range configuredSiteKeys {
 		siteKey := strings.TrimSpace(rawKey)
 		if siteKey == "" {
-			return fmt.Errorf("site key is required")
+			return summary, fmt.Errorf("site key is required")
 		}
 		if _, exists := cfgByKey[siteKey]; exists {
-			return fmt.Errorf("duplicate site key %q", siteKey)
+			return summary, fmt.Errorf("duplicate site key %q", siteKey)
 		}
 		cfgByKey[siteKey] = cfgSiteInfo{
 			seen:  false,
@@ -55,7 +86,7 @@ func (d *DB) SyncSites(ctx context.Context, configuredSiteKeys map[string]string
 
 	tx, err := d.SQL.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("begin sites sync tx: %w", err)
+		return summary, fmt.Errorf("begin sites sync tx: %w", err)
 	}
 	committed := false
 	defer func() {
@@ -71,18 +102,20 @@ SELECT site_key, status
  ORDER BY site_key ASC;
 `)
 	if err != nil {
-		return fmt.Errorf("query sites for sync: %w", err)
+		return summary, fmt.Errorf("query sites for sync: %w", err)
 	}
 
 	toEnable := make([]string, 0)
 	toDisable := make([]string, 0)
+	unchanged := make([]string, 0)
+	missing := make([]string, 0)
 
 	for rows.Next() {
 		var siteKey string
 		var status string
 		if err := rows.Scan(&siteKey, &status); err != nil {
 			_ = rows.Close()
-			return fmt.Errorf("scan site for sync: %w", err)
+			return summary, fmt.Errorf("scan site for sync: %w", err)
 		}
 
 		// site_key found in config?
@@ -91,21 +124,28 @@ SELECT site_key, status
 			cfgByKey[siteKey] = info
 			if status == SiteStatusDisabled {
 				toEnable = append(toEnable, siteKey)
+			} else {
+				unchanged = append(unchanged, siteKey)
 			}
 		} else {
 			// site_key not found: set to disabled if status is active in database
-			if status == SiteStatusActive {
+			switch {
+			case status == SiteStatusActive && opts.KeepMissing:
+				missing = append(missing, siteKey)
+			case status == SiteStatusActive:
 				toDisable = append(toDisable, siteKey)
+			default:
+				unchanged = append(unchanged, siteKey)
 			}
 		}
 
 	}
 	if err := rows.Err(); err != nil {
 		_ = rows.Close()
-		return fmt.Errorf("iterate sites for sync: %w", err)
+		return summary, fmt.Errorf("iterate sites for sync: %w", err)
 	}
 	if err := rows.Close(); err != nil {
-		return fmt.Errorf("close sites scan: %w", err)
+		return summary, fmt.Errorf("close sites scan: %w", err)
 	}
 
 	toInsert := make([]string, 0)
@@ -114,6 +154,7 @@ SELECT site_key, status
 			toInsert = append(toInsert, siteKey)
 		}
 	}
+	sort.Strings(toInsert)
 
 	// Apply
 	now := time.Now().Unix()
@@ -125,7 +166,7 @@ UPDATE sites
    AND status = ?;
 `)
 	if err != nil {
-		return fmt.Errorf("prepare enable site: %w", err)
+		return summary, fmt.Errorf("prepare enable site: %w", err)
 	}
 	defer func() { _ = enableStmt.Close() }()
 
@@ -136,7 +177,7 @@ UPDATE sites
    AND status = ?;
 `)
 	if err != nil {
-		return fmt.Errorf("prepare disable site: %w", err)
+		return summary, fmt.Errorf("prepare disable site: %w", err)
 	}
 	defer func() { _ = disableStmt.Close() }()
 
@@ -145,7 +186,7 @@ INSERT INTO sites (site_key, title, status, created_at, updated_at)
 VALUES (?, ?, ?, ?, ?);
 `)
 	if err != nil {
-		return fmt.Errorf("prepare insert site: %w", err)
+		return summary, fmt.Errorf("prepare insert site: %w", err)
 	}
 	defer func() { _ = insertStmt.Close() }()
 
@@ -158,25 +199,50 @@ VALUES (?, ?, ?, ?, ?);
 			siteKey,
 			SiteStatusDisabled,
 		); err != nil {
-			return fmt.Errorf("enable site %q: %w", siteKey, err)
+			return summary, fmt.Errorf("enable site %q: %w", siteKey, err)
 		}
 	}
 	for _, siteKey := range toDisable {
 		if _, err := disableStmt.ExecContext(ctx, SiteStatusDisabled, now, siteKey, SiteStatusActive); err != nil {
-			return fmt.Errorf("disable site %q: %w", siteKey, err)
+			return summary, fmt.Errorf("disable site %q: %w", siteKey, err)
 		}
 	}
 	for _, siteKey := range toInsert {
 		if _, err := insertStmt.ExecContext(ctx, siteKey, cfgByKey[siteKey].title, SiteStatusActive, now, now); err != nil {
-			return fmt.Errorf("insert site %q: %w", siteKey, err)
+			return summary, fmt.Errorf("insert site %q: %w", siteKey, err)
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit sites sync tx: %w", err)
+		return summary, fmt.Errorf("commit sites sync tx: %w", err)
 	}
 	committed = true
-	return nil
+
+	summary = SyncSummary{
+		Inserted:  toInsert,
+		Enabled:   toEnable,
+		Disabled:  toDisable,
+		Unchanged: unchanged,
+		Missing:   missing,
+		SyncedAt:  now,
+	}
+	d.syncMu.Lock()
+	d.lastSync = &summary
+	d.syncMu.Unlock()
+	return summary, nil
+}
+
+// LastSyncSummary returns the summary of the last SyncSites call of this process.
+func (d *DB) LastSyncSummary() (SyncSummary, bool) {
+	if d == nil {
+		return SyncSummary{}, false
+	}
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+	if d.lastSync == nil {
+		return SyncSummary{}, false
+	}
+	return *d.lastSync, true
 }
 
 // GetSiteIDByKey returns data for the requested input.
@@ -190,7 +256,7 @@ func (d *DB) GetSiteIDByKey(ctx context.Context, siteKey string) (int64, bool, e
 	}
 
 	var siteID int64
-	err := d.SQL.QueryRowContext(ctx, `
+	err := d.reader().QueryRowContext(ctx, `
 SELECT id
   FROM sites
  WHERE site_key = ?
@@ -215,12 +281,12 @@ func (d *DB) GetSiteByID(ctx context.Context, siteID int64) (Site, bool, error)
 	}
 
 	var s Site
-	err := d.SQL.QueryRowContext(ctx, `
-SELECT id, site_key, title, status, created_at, updated_at
+	err := d.reader().QueryRowContext(ctx, `
+SELECT id, site_key, title, status, created_at, updated_at, pipeline_paused_at
   FROM sites
  WHERE id = ?
  LIMIT 1;
-`, siteID).Scan(&s.ID, &s.SiteKey, &s.Title, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+`, siteID).Scan(&s.ID, &s.SiteKey, &s.Title, &s.Status, &s.CreatedAt, &s.UpdatedAt, &s.PipelinePausedAt)
 	if err == sql.ErrNoRows {
 		return Site{}, false, nil
 	}
@@ -245,7 +311,7 @@ func (d *DB) SiteExistsByID(ctx context.Context, siteID int64) (bool, error) {
 		return false, fmt.Errorf("site id must be > 0")
 	}
 	var one int
-	err := d.SQL.QueryRowContext(ctx, `
+	err := d.reader().QueryRowContext(ctx, `
 SELECT 1
   FROM sites
  WHERE id = ?
@@ -266,8 +332,8 @@ func (d *DB) ListSites(ctx context.Context) ([]Site, error) {
 		return nil, fmt.Errorf("db not initialized")
 	}
 
-	rows, err := d.SQL.QueryContext(ctx, `
-SELECT id, site_key, title, status, created_at, updated_at
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT id, site_key, title, status, created_at, updated_at, pipeline_paused_at
   FROM sites
  ORDER BY id ASC;
 `)
@@ -286,6 +352,7 @@ SELECT id, site_key, title, status, created_at, updated_at
 			&s.Status,
 			&s.CreatedAt,
 			&s.UpdatedAt,
+			&s.PipelinePausedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan site: %w", err)
 		}
@@ -307,8 +374,8 @@ func (d *DB) ListSitesByUserID(ctx context.Context, userID int64) ([]Site, error
 		return nil, fmt.Errorf("userID must be > 0")
 	}
 
-	rows, err := d.SQL.QueryContext(ctx, `
-SELECT s.id, s.site_key, s.title, s.status, s.created_at, s.updated_at
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT s.id, s.site_key, s.title, s.status, s.created_at, s.updated_at, s.pipeline_paused_at
   FROM sites s
   JOIN user_sites us ON us.site_id = s.id
  WHERE us.user_id = ?
@@ -322,7 +389,7 @@ SELECT s.id, s.site_key, s.title, s.status, s.created_at, s.updated_at
 	out := make([]Site, 0)
 	for rows.Next() {
 		var s Site
-		if err := rows.Scan(&s.ID, &s.SiteKey, &s.Title, &s.Status, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		if err := rows.Scan(&s.ID, &s.SiteKey, &s.Title, &s.Status, &s.CreatedAt, &s.UpdatedAt, &s.PipelinePausedAt); err != nil {
 			return nil, fmt.Errorf("scan site by user: %w", err)
 		}
 		out = append(out, s)
@@ -342,7 +409,7 @@ func (d *DB) ListAllowedSiteIDsByUserID(ctx context.Context, userID int64) ([]in
 		return nil, fmt.Errorf("userID must be > 0")
 	}
 
-	rows, err := d.SQL.QueryContext(ctx, `
+	rows, err := d.reader().QueryContext(ctx, `
 SELECT site_id
   FROM user_sites
  WHERE user_id = ?
@@ -380,7 +447,7 @@ func (d *DB) UserHasSiteAccess(ctx context.Context, userID int64, siteID int64)
 	}
 
 	var one int
-	err := d.SQL.QueryRowContext(ctx, `
+	err := d.reader().QueryRowContext(ctx, `
 SELECT 1
   FROM user_sites
  WHERE user_id = ?
@@ -408,11 +475,9 @@ func (d *DB) AssignUserSite(ctx context.Context, userID int64, siteID int64) err
 		return fmt.Errorf("siteID must be > 0")
 	}
 
-	_, err := d.SQL.ExecContext(ctx, `
+	_, err := d.SQL.ExecContext(ctx, d.dialect().upsert(`
 INSERT INTO user_sites (user_id, site_id)
-VALUES (?, ?)
-ON CONFLICT(user_id, site_id) DO NOTHING;
-`, userID, siteID)
+VALUES (?, ?)`, "user_id, site_id", ""), userID, siteID)
 	if err != nil {
 		return fmt.Errorf("assign user site: %w", err)
 	}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SpamRuleStat counts moderator decisions on comments a heuristic rule matched.
+type SpamRuleStat struct {
+	Rule string `json:"Rule"`
+	Spam int64  `json:"Spam"`
+	Ham  int64  `json:"Ham"`
+}
+
+// RecordSpamFeedback counts a moderator decision (spam or not spam) for every rule
+// that matched the comment.
+func (d *DB) RecordSpamFeedback(ctx context.Context, siteID int64, rules []string, spam bool) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	spamInc, hamInc := 0, 1
+	if spam {
+		spamInc, hamInc = 1, 0
+	}
+	now := nowUnix()
+
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if _, err := d.SQL.ExecContext(ctx, d.dialect().upsert(`
+INSERT INTO spam_rule_feedback (site_id, rule, spam_count, ham_count, updated_at)
+VALUES (?, ?, ?, ?, ?)`, "site_id, rule", `
+  spam_count = spam_count + excluded.spam_count,
+  ham_count  = ham_count + excluded.ham_count,
+  updated_at = excluded.updated_at`), siteID, rule, spamInc, hamInc, now); err != nil {
+			return fmt.Errorf("record spam feedback (%s): %w", rule, err)
+		}
+	}
+	return nil
+}
+
+// ListSpamRuleStats returns the feedback counts of a site by rule.
+func (d *DB) ListSpamRuleStats(ctx context.Context, siteID int64) (map[string]SpamRuleStat, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT rule, spam_count, ham_count
+  FROM spam_rule_feedback
+ WHERE site_id = ?;
+`, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("list spam rule stats: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	out := make(map[string]SpamRuleStat)
+	for rows.Next() {
+		var s SpamRuleStat
+		if err := rows.Scan(&s.Rule, &s.Spam, &s.Ham); err != nil {
+			return nil, fmt.Errorf("scan spam rule stat: %w", err)
+		}
+		out[s.Rule] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate spam rule stats: %w", err)
+	}
+	return out, nil
+}
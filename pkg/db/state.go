@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// StateTables lists all tables that belong to the server state, in an order
+// that satisfies foreign keys on insert. Pending notification mails and webhook
+// deliveries are part of it, so they are still sent after a move.
+var StateTables = []string{"sites", "users", "user_sites", "api_tokens", "user_identities", "login_history", "comments", "mail_outbox", "pipeline_runs", "pipeline_run_files", "blocklist", "comment_revisions", "audit_log", "spam_rule_feedback", "webhook_deliveries"}
+
+// TransientTables lists the tables left out of the state on purpose. RestoreState
+// empties them where they reference a state table:
+//   - sessions: logins are bound to the old host; users log in again.
+//   - pipeline_run_logs: subprocess output, up to a megabyte per step and only
+//     needed to debug a run on the host it ran on.
+//   - generated_bundles: hashes of the written comment files, recomputed by the
+//     next pipeline run.
+//   - captcha_challenges: expire after minutes.
+var TransientTables = []string{"sessions", "pipeline_run_logs", "generated_bundles", "captcha_challenges"}
+
+// StateRow is one table row keyed by column name.
+type StateRow map[string]any
+
+// CurrentSchemaVersion returns the schema version stored in the database.
+func (d *DB) CurrentSchemaVersion(ctx context.Context) (int, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	v, err := d.dialect().schemaVersion(ctx, d.reader())
+	if err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return v, nil
+}
+
+// DumpTable calls fn for every row of the given state table.
+func (d *DB) DumpTable(ctx context.Context, table string, fn func(StateRow) error) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	if !isStateTable(table) {
+		return fmt.Errorf("unknown state table %q", table)
+	}
+
+	rows, err := d.reader().QueryContext(ctx, "SELECT * FROM "+table+" ORDER BY "+d.dialect().dumpOrder(table)+";")
+	if err != nil {
+		return fmt.Errorf("dump %s: %w", table, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("dump %s columns: %w", table, err)
+	}
+
+	for rows.Next() {
+		values := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("scan %s: %w", table, err)
+		}
+
+		row := make(StateRow, len(cols))
+		for i, col := range cols {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+				continue
+			}
+			row[col] = values[i]
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate %s: %w", table, err)
+	}
+	return nil
+}
+
+// RestoreState inserts the given rows (keyed by table name) in a single transaction.
+// If replace is false, the target must not contain users, comments or pipeline runs yet.
+// Sites are always replaced, because they are recreated from config on every start.
+// Columns unknown to the current schema are ignored.
+func (d *DB) RestoreState(ctx context.Context, tables map[string][]StateRow, replace bool) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+	for table := range tables {
+		if !isStateTable(table) {
+			return fmt.Errorf("unknown state table %q", table)
+		}
+	}
+
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin restore tx: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Comments reference their parents; check foreign keys on commit only where the
+	// backend can, and insert parents first for the others.
+	if err := d.dialect().deferForeignKeys(ctx, tx); err != nil {
+		return fmt.Errorf("defer foreign keys: %w", err)
+	}
+
+	if !replace {
+		for _, table := range []string{"users", "comments", "pipeline_runs"} {
+			var count int64
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(1) FROM "+table+";").Scan(&count); err != nil {
+				return fmt.Errorf("count %s: %w", table, err)
+			}
+			if count > 0 {
+				return fmt.Errorf("table %s is not empty (use replace to overwrite existing data)", table)
+			}
+		}
+	}
+
+	// Delete in reverse insert order.
+	for i := len(StateTables) - 1; i >= 0; i-- {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+StateTables[i]+";"); err != nil {
+			return fmt.Errorf("clear %s: %w", StateTables[i], err)
+		}
+	}
+
+	for _, table := range StateTables {
+		rows := tables[table]
+		if len(rows) == 0 {
+			continue
+		}
+		if table == "comments" {
+			rows = parentsFirst(rows)
+		}
+
+		known, err := d.dialect().tableColumns(ctx, tx, table)
+		if err != nil {
+			return fmt.Errorf("table info %s: %w", table, err)
+		}
+
+		for _, row := range rows {
+			cols := make([]string, 0, len(row))
+			args := make([]any, 0, len(row))
+			for col, v := range row {
+				if _, ok := known[col]; !ok {
+					continue
+				}
+				if n, ok := v.(json.Number); ok {
+					if i, err := n.Int64(); err == nil {
+						v = i
+					} else if f, err := n.Float64(); err == nil {
+						v = f
+					}
+				}
+				cols = append(cols, col)
+				args = append(args, v)
+			}
+			if len(cols) == 0 {
+				continue
+			}
+
+			placeholders := strings.TrimSuffix(strings.Repeat("?,", len(cols)), ",")
+			query := "INSERT INTO " + table + " (" + strings.Join(cols, ", ") + ") VALUES (" + placeholders + ");"
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				return fmt.Errorf("restore %s: %w", table, err)
+			}
+		}
+	}
+
+	if err := d.dialect().afterRestore(ctx, tx, StateTables); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit restore tx: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// isStateTable performs its package-specific operation.
+func isStateTable(table string) bool {
+	for _, t := range StateTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// parentsFirst orders comment rows so that every reply follows its parent. Replies
+// whose parent is missing are treated like top-level comments.
+func parentsFirst(rows []StateRow) []StateRow {
+	ids := make(map[any]bool, len(rows))
+	for _, row := range rows {
+		ids[row["id"]] = true
+	}
+
+	out := make([]StateRow, 0, len(rows))
+	placed := make(map[any]bool, len(rows))
+	for len(rows) > 0 {
+		var waiting []StateRow
+		for _, row := range rows {
+			parent := row["parent_id"]
+			if parent == nil || parent == "" || !ids[parent] || placed[parent] {
+				out = append(out, row)
+				placed[row["id"]] = true
+				continue
+			}
+			waiting = append(waiting, row)
+		}
+		if len(waiting) == len(rows) {
+			// A cycle; let the foreign key check report it.
+			return append(out, waiting...)
+		}
+		rows = waiting
+	}
+	return out
+}
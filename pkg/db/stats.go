@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// PostActivity counts the new comments of a post.
+type PostActivity struct {
+	PostPath string `json:"post_path"`
+	Comments int64  `json:"comments"`
+}
+
+// SiteStats summarizes the activity of a site within a period.
+type SiteStats struct {
+	// NewComments counts submissions created in the period (without unconfirmed and deleted ones).
+	NewComments int64 `json:"new_comments"`
+	Approved    int64 `json:"approved"`
+	Rejected    int64 `json:"rejected"`
+	Spam        int64 `json:"spam"`
+	// Pending counts all comments currently waiting for moderation, regardless of the period.
+	Pending int64 `json:"pending"`
+
+	PipelineRuns     int64 `json:"pipeline_runs"`
+	PipelineFailures int64 `json:"pipeline_failures"`
+
+	// TopPosts lists the posts with the most new comments in the period.
+	TopPosts []PostActivity `json:"top_posts"`
+}
+
+// SiteStats returns the activity of a site between since (inclusive) and until (exclusive).
+func (d *DB) SiteStats(ctx context.Context, siteID, since, until int64, topPosts int) (SiteStats, error) {
+	var s SiteStats
+	if d == nil || d.SQL == nil {
+		return s, fmt.Errorf("db not initialized")
+	}
+
+	err := d.reader().QueryRowContext(ctx, `
+SELECT
+  COALESCE(SUM(CASE WHEN created_at >= ? AND created_at < ? AND status NOT IN (?, ?) THEN 1 ELSE 0 END), 0),
+  COALESCE(SUM(CASE WHEN approved_at >= ? AND approved_at < ? AND status = ? THEN 1 ELSE 0 END), 0),
+  COALESCE(SUM(CASE WHEN rejected_at >= ? AND rejected_at < ? AND status = ? THEN 1 ELSE 0 END), 0),
+  COALESCE(SUM(CASE WHEN created_at >= ? AND created_at < ? AND status = ? THEN 1 ELSE 0 END), 0),
+  COALESCE(SUM(CASE WHEN status = ? THEN 1 ELSE 0 END), 0)
+  FROM comments
+ WHERE site_id = ?;
+`, since, until, CommentStatusUnconfirmed, CommentStatusDeleted,
+		since, until, CommentStatusApproved,
+		since, until, CommentStatusRejected,
+		since, until, CommentStatusSpam,
+		CommentStatusPending, siteID).Scan(&s.NewComments, &s.Approved, &s.Rejected, &s.Spam, &s.Pending)
+	if err != nil {
+		return s, fmt.Errorf("comment stats: %w", err)
+	}
+
+	err = d.reader().QueryRowContext(ctx, `
+SELECT COUNT(*), COALESCE(SUM(CASE WHEN state = ? THEN 1 ELSE 0 END), 0)
+  FROM pipeline_runs
+ WHERE site_id = ?
+   AND created_at >= ?
+   AND created_at < ?
+   AND state <> ?;
+`, RunFailed, siteID, since, until, RunCoalesced).Scan(&s.PipelineRuns, &s.PipelineFailures)
+	if err != nil {
+		return s, fmt.Errorf("pipeline stats: %w", err)
+	}
+
+	if topPosts <= 0 {
+		return s, nil
+	}
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT post_path, COUNT(*) AS n
+  FROM comments
+ WHERE site_id = ?
+   AND created_at >= ?
+   AND created_at < ?
+   AND status IN (?, ?)
+ GROUP BY post_path
+ ORDER BY n DESC, post_path ASC
+ LIMIT ?;
+`, siteID, since, until, CommentStatusPending, CommentStatusApproved, topPosts)
+	if err != nil {
+		return s, fmt.Errorf("top posts: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var p PostActivity
+		if err := rows.Scan(&p.PostPath, &p.Comments); err != nil {
+			return s, fmt.Errorf("scan top post: %w", err)
+		}
+		s.TopPosts = append(s.TopPosts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return s, fmt.Errorf("iterate top posts: %w", err)
+	}
+	return s, nil
+}
+
+// ClaimSummary records that the summary for the period ending at periodEnd is sent.
+// It returns false if it was already claimed, so several instances send it only once.
+func (d *DB) ClaimSummary(ctx context.Context, siteID, periodEnd int64) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `UPDATE sites SET summary_sent_at = ? WHERE id = ? AND summary_sent_at < ?;`, periodEnd, siteID, periodEnd)
+	if err != nil {
+		return false, fmt.Errorf("claim summary: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("claim summary rows affected: %w", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// APIToken is a personal API token. Only the SHA-256 hash of the token is stored.
+type APIToken struct {
+	ID     int64  `json:"ID"`
+	UserID int64  `json:"UserID"`
+	Name   string `json:"Name"`
+	// Prefix is the start of the token, shown to tell tokens apart.
+	Prefix string `json:"Prefix"`
+	// Scopes limits the token to these route groups; empty grants all.
+	Scopes     []string `json:"Scopes"`
+	TokenHash  string   `json:"-"`
+	ExpiresAt  int64    `json:"ExpiresAt"` // 0 = never
+	LastUsedAt int64    `json:"LastUsedAt"`
+	CreatedAt  int64    `json:"CreatedAt"`
+	RevokedAt  int64    `json:"RevokedAt"`
+}
+
+// Active reports whether the token is neither revoked nor expired at now.
+func (t APIToken) Active(now int64) bool {
+	return t.RevokedAt == 0 && (t.ExpiresAt == 0 || t.ExpiresAt > now)
+}
+
+// HasScope reports whether the token grants scope.
+func (t APIToken) HasScope(scope string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+const apiTokenSelect = `
+SELECT id, user_id, name, prefix, scopes, token_hash, COALESCE(expires_at, 0), COALESCE(last_used_at, 0), created_at, COALESCE(revoked_at, 0)
+  FROM api_tokens`
+
+// scanAPIToken scans a row of apiTokenSelect.
+func scanAPIToken(row interface{ Scan(...any) error }) (APIToken, error) {
+	var (
+		t      APIToken
+		scopes string
+	)
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &scopes, &t.TokenHash, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt, &t.RevokedAt); err != nil {
+		return APIToken{}, err
+	}
+	if scopes != "" {
+		t.Scopes = strings.Split(scopes, ",")
+	}
+	return t, nil
+}
+
+// CreateAPIToken stores a token and returns its ID.
+func (d *DB) CreateAPIToken(ctx context.Context, t APIToken) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+	if t.UserID <= 0 || t.TokenHash == "" {
+		return 0, fmt.Errorf("userID and token hash are required")
+	}
+
+	var expiresAt any
+	if t.ExpiresAt > 0 {
+		expiresAt = t.ExpiresAt
+	}
+	id, err := d.dialect().insertID(ctx, d.SQL, `
+INSERT INTO api_tokens (user_id, name, prefix, scopes, token_hash, expires_at, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+`, t.UserID, strings.TrimSpace(t.Name), t.Prefix, strings.Join(t.Scopes, ","), t.TokenHash, expiresAt, nowUnix())
+	if err != nil {
+		return 0, fmt.Errorf("create api token: %w", err)
+	}
+	return id, nil
+}
+
+// GetAPITokenByHash returns the token with the given hash, including revoked and
+// expired ones.
+func (d *DB) GetAPITokenByHash(ctx context.Context, tokenHash string) (APIToken, bool, error) {
+	if d == nil || d.SQL == nil {
+		return APIToken{}, false, fmt.Errorf("db not initialized")
+	}
+
+	t, err := scanAPIToken(d.reader().QueryRowContext(ctx, apiTokenSelect+" WHERE token_hash = ?;", tokenHash))
+	if err == sql.ErrNoRows {
+		return APIToken{}, false, nil
+	}
+	if err != nil {
+		return APIToken{}, false, fmt.Errorf("get api token: %w", err)
+	}
+	return t, true, nil
+}
+
+// ListAPITokensByUserID returns the tokens of a user, newest first.
+func (d *DB) ListAPITokensByUserID(ctx context.Context, userID int64) ([]APIToken, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, apiTokenSelect+" WHERE user_id = ? ORDER BY id DESC;", userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	items := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api token: %w", err)
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate api tokens: %w", err)
+	}
+	return items, nil
+}
+
+// RevokeAPIToken revokes a token of the given user. Returns false if the user has no
+// active token with this ID.
+func (d *DB) RevokeAPIToken(ctx context.Context, userID, tokenID int64) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `
+UPDATE api_tokens
+   SET revoked_at = ?
+ WHERE id = ?
+   AND user_id = ?
+   AND revoked_at IS NULL;
+`, nowUnix(), tokenID, userID)
+	if err != nil {
+		return false, fmt.Errorf("revoke api token: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("revoke api token rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RevokeUserAPITokens revokes all active tokens of a user and returns their number.
+func (d *DB) RevokeUserAPITokens(ctx context.Context, userID int64) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `
+UPDATE api_tokens
+   SET revoked_at = ?
+ WHERE user_id = ?
+   AND revoked_at IS NULL;
+`, nowUnix(), userID)
+	if err != nil {
+		return 0, fmt.Errorf("revoke user api tokens: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("revoke user api tokens rows affected: %w", err)
+	}
+	return affected, nil
+}
+
+// TouchAPIToken records the use of a token. To spare writes, last_used_at is only
+// updated if it is older than a minute.
+func (d *DB) TouchAPIToken(ctx context.Context, tokenID int64) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	now := nowUnix()
+	if _, err := d.SQL.ExecContext(ctx, `
+UPDATE api_tokens
+   SET last_used_at = ?
+ WHERE id = ?
+   AND (last_used_at IS NULL OR last_used_at < ?);
+`, now, tokenID, now-60); err != nil {
+		return fmt.Errorf("touch api token: %w", err)
+	}
+	return nil
+}
@@ -16,6 +16,12 @@ type User struct {
 	Email     string `json:"Email,omitempty"`
 	CreatedAt int64  `json:"CreatedAt,omitempty"`
 	UpdatedAt int64  `json:"UpdatedAt,omitempty"`
+	// LastLoginAt is the time of the last successful login, 0 if none.
+	LastLoginAt int64 `json:"LastLoginAt"`
+	// MustChangePassword restricts the sessions of the user to changing the password.
+	MustChangePassword bool `json:"MustChangePassword"`
+	// PasswordChangedAt is the time the password was last set, 0 if unknown.
+	PasswordChangedAt int64 `json:"PasswordChangedAt"`
 }
 
 // normalizeUser performs its package-specific operation.
@@ -53,19 +59,14 @@ func (d *DB) CreateUser(ctx context.Context, u User) (int64, error) {
 		return 0, err
 	}
 
-	res, err := d.SQL.ExecContext(ctx, `
+	id, err := d.dialect().insertID(ctx, d.SQL, `
 INSERT INTO users (
-  password, firstname, lastname, email, created_at, updated_at
-) VALUES (?, ?, ?, ?, ?, ?);
-`, u.Password, u.FirstName, u.LastName, u.Email, u.CreatedAt, u.UpdatedAt)
+  password, firstname, lastname, email, created_at, updated_at, must_change_password, password_changed_at
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+`, u.Password, u.FirstName, u.LastName, u.Email, u.CreatedAt, u.UpdatedAt, u.MustChangePassword, u.CreatedAt)
 	if err != nil {
 		return 0, fmt.Errorf("create user: %w", err)
 	}
-
-	id, err := res.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("create user last_insert_id: %w", err)
-	}
 	return id, nil
 }
 
@@ -80,6 +81,9 @@ func scanUser(row *sql.Row) (User, error) {
 		&u.Email,
 		&u.CreatedAt,
 		&u.UpdatedAt,
+		&u.LastLoginAt,
+		&u.MustChangePassword,
+		&u.PasswordChangedAt,
 	); err != nil {
 		return User{}, err
 	}
@@ -95,8 +99,8 @@ func (d *DB) GetUserByID(ctx context.Context, id int64) (User, bool, error) {
 		return User{}, false, fmt.Errorf("id must be > 0")
 	}
 
-	row := d.SQL.QueryRowContext(ctx, `
-SELECT id, password, firstname, lastname, email, created_at, updated_at
+	row := d.reader().QueryRowContext(ctx, `
+SELECT id, password, firstname, lastname, email, created_at, updated_at, last_login_at, must_change_password, password_changed_at
   FROM users
  WHERE id = ?
  LIMIT 1;
@@ -124,8 +128,8 @@ func (d *DB) GetUserByEmail(ctx context.Context, email string) (User, bool, erro
 		return User{}, false, fmt.Errorf("email is required")
 	}
 
-	row := d.SQL.QueryRowContext(ctx, `
-SELECT id, password, firstname, lastname, email, created_at, updated_at
+	row := d.reader().QueryRowContext(ctx, `
+SELECT id, password, firstname, lastname, email, created_at, updated_at, last_login_at, must_change_password, password_changed_at
   FROM users
  WHERE email = ?
  LIMIT 1;
@@ -173,8 +177,8 @@ func (d *DB) UpdateUser(ctx context.Context, u User) (bool, error) {
 		args = append(args, u.Email)
 	}
 	if u.Password != "" {
-		setParts = append(setParts, "password = ?")
-		args = append(args, u.Password)
+		setParts = append(setParts, "password = ?", "password_changed_at = ?")
+		args = append(args, u.Password, now)
 	}
 
 	args = append(args, u.ID)
@@ -233,14 +237,32 @@ func (d *DB) DeleteUser(ctx context.Context, id int64) (bool, error) {
 	return affected > 0, nil
 }
 
+// SetMustChangePassword sets or clears the forced password change of a user.
+// Returns false if the user was not found.
+func (d *DB) SetMustChangePassword(ctx context.Context, id int64, must bool) (bool, error) {
+	if d == nil || d.SQL == nil {
+		return false, fmt.Errorf("db not initialized")
+	}
+
+	res, err := d.SQL.ExecContext(ctx, `UPDATE users SET must_change_password = ? WHERE id = ?;`, must, id)
+	if err != nil {
+		return false, fmt.Errorf("set must_change_password: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("set must_change_password rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
 // ListUsers returns a list for the requested filter.
 func (d *DB) ListUsers(ctx context.Context) ([]User, error) {
 	if d == nil || d.SQL == nil {
 		return nil, fmt.Errorf("db not initialized")
 	}
 
-	rows, err := d.SQL.QueryContext(ctx, `
-SELECT id, firstname, lastname, email, created_at, updated_at
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT id, firstname, lastname, email, created_at, updated_at, last_login_at, must_change_password, password_changed_at
   FROM users
  ORDER BY id ASC;
 `)
@@ -259,6 +281,9 @@ SELECT id, firstname, lastname, email, created_at, updated_at
 			&u.Email,
 			&u.CreatedAt,
 			&u.UpdatedAt,
+			&u.LastLoginAt,
+			&u.MustChangePassword,
+			&u.PasswordChangedAt,
 		); err != nil {
 			return nil, fmt.Errorf("scan user: %w", err)
 		}
@@ -283,7 +308,7 @@ func (d *DB) GetUserIDByEmail(ctx context.Context, email string) (int64, bool, e
 	}
 
 	var id int64
-	err := d.SQL.QueryRowContext(ctx, `
+	err := d.reader().QueryRowContext(ctx, `
 SELECT id
   FROM users
  WHERE email = ?
@@ -308,7 +333,7 @@ func (d *DB) UserExistsByID(ctx context.Context, userID int64) (bool, error) {
 	}
 
 	var one int
-	err := d.SQL.QueryRowContext(ctx, `
+	err := d.reader().QueryRowContext(ctx, `
 SELECT 1
   FROM users
  WHERE id = ?
@@ -335,11 +360,9 @@ func (d *DB) GrantUserSite(ctx context.Context, userID int64, siteID int64) (boo
 		return false, fmt.Errorf("siteID must be > 0")
 	}
 
-	res, err := d.SQL.ExecContext(ctx, `
+	res, err := d.SQL.ExecContext(ctx, d.dialect().upsert(`
 INSERT INTO user_sites (user_id, site_id)
-VALUES (?, ?)
-ON CONFLICT(user_id, site_id) DO NOTHING;
-`, userID, siteID)
+VALUES (?, ?)`, "user_id, site_id", ""), userID, siteID)
 	if err != nil {
 		return false, fmt.Errorf("grant user site: %w", err)
 	}
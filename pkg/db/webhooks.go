@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// CreateWebhookDelivery logs a new outbound webhook delivery with status=pending.
+// The payload is stored afterwards via SetWebhookDeliveryPayload, because it contains the delivery ID.
+func (d *DB) CreateWebhookDelivery(ctx context.Context, siteID int64, event, url string) (int64, error) {
+	if d == nil || d.SQL == nil {
+		return 0, fmt.Errorf("db not initialized")
+	}
+
+	now := nowUnix()
+	id, err := d.dialect().insertID(ctx, d.SQL, `
+INSERT INTO webhook_deliveries (
+  site_id, event, url, payload, status, attempts, created_at, updated_at
+) VALUES (?, ?, ?, '', ?, 0, ?, ?)
+`,
+		siteID,
+		event,
+		url,
+		DeliveryPending,
+		now,
+		now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("create webhook delivery: %w", err)
+	}
+	return id, nil
+}
+
+// SetWebhookDeliveryPayload stores the request body of a delivery.
+func (d *DB) SetWebhookDeliveryPayload(ctx context.Context, deliveryID int64, payload string) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	if _, err := d.SQL.ExecContext(ctx, `
+UPDATE webhook_deliveries
+SET payload = ?, updated_at = ?
+WHERE id = ?
+`, payload, nowUnix(), deliveryID); err != nil {
+		return fmt.Errorf("set webhook delivery payload: %w", err)
+	}
+	return nil
+}
+
+// RecordWebhookAttempt stores the result of a delivery attempt.
+// statusCode is 0 if no HTTP response was received.
+func (d *DB) RecordWebhookAttempt(ctx context.Context, deliveryID int64, status string, attempts int, statusCode int, errMsg string) error {
+	if d == nil || d.SQL == nil {
+		return fmt.Errorf("db not initialized")
+	}
+
+	var code any
+	if statusCode > 0 {
+		code = statusCode
+	}
+	var lastErr any
+	if errMsg != "" {
+		lastErr = errMsg
+	}
+
+	if _, err := d.SQL.ExecContext(ctx, `
+UPDATE webhook_deliveries
+SET status = ?, attempts = ?, last_status_code = ?, last_error = ?, updated_at = ?
+WHERE id = ?
+`, status, attempts, code, lastErr, nowUnix(), deliveryID); err != nil {
+		return fmt.Errorf("record webhook attempt: %w", err)
+	}
+	return nil
+}
+
+// WebhookDelivery is a logged delivery that has not reached a final status yet.
+type WebhookDelivery struct {
+	ID       int64
+	SiteKey  string
+	Event    string
+	URL      string
+	Payload  string
+	Attempts int
+}
+
+// ListPendingWebhookDeliveries returns all pending deliveries, oldest first, so they can
+// be resumed after a restart.
+func (d *DB) ListPendingWebhookDeliveries(ctx context.Context) ([]WebhookDelivery, error) {
+	if d == nil || d.SQL == nil {
+		return nil, fmt.Errorf("db not initialized")
+	}
+
+	rows, err := d.reader().QueryContext(ctx, `
+SELECT w.id, s.site_key, w.event, w.url, w.payload, w.attempts
+  FROM webhook_deliveries w
+  JOIN sites s ON s.id = w.site_id
+ WHERE w.status = ?
+ ORDER BY w.id ASC;
+`, DeliveryPending)
+	if err != nil {
+		return nil, fmt.Errorf("list pending webhook deliveries: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []WebhookDelivery
+	for rows.Next() {
+		var w WebhookDelivery
+		if err := rows.Scan(&w.ID, &w.SiteKey, &w.Event, &w.URL, &w.Payload, &w.Attempts); err != nil {
+			return nil, fmt.Errorf("scan pending webhook delivery: %w", err)
+		}
+		out = append(out, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate pending webhook deliveries: %w", err)
+	}
+	return out, nil
+}
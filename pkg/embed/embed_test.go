@@ -0,0 +1,37 @@
+package embed
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIssueVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+
+	tok := Issue("secret", "blog", time.Time{})
+	if err := Verify("secret", "blog", tok, now); err != nil {
+		t.Fatalf("non-expiring token: %v", err)
+	}
+	if err := Verify("secret", "other", tok, now); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("other site: got %v, want ErrInvalid", err)
+	}
+	if err := Verify("rotated", "blog", tok, now); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("other secret: got %v, want ErrInvalid", err)
+	}
+
+	tok = Issue("secret", "blog", now.Add(time.Hour))
+	if err := Verify("secret", "blog", tok, now); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+	if err := Verify("secret", "blog", tok, now.Add(2*time.Hour)); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expired token: got %v, want ErrExpired", err)
+	}
+
+	if err := Verify("secret", "blog", "", now); !errors.Is(err, ErrMissing) {
+		t.Fatalf("empty token: got %v, want ErrMissing", err)
+	}
+	if err := Verify("secret", "blog", "e1.abc.def", now); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("malformed token: got %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Package events distributes newly approved comments to live subscribers
+// (for example Server-Sent-Events clients). Delivery is best effort: slow
+// subscribers miss events instead of blocking moderation.
+package events
+
+import (
+	"errors"
+	"sync"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber.
+const subscriberBuffer = 16
+
+// Comment is the public representation of an approved comment.
+// It intentionally excludes email and IP address.
+type Comment struct {
+	ID        string `json:"id"`
+	EntryID   string `json:"entry_id,omitempty"`
+	PostPath  string `json:"post_path"`
+	ParentID  string `json:"parent_id,omitempty"`
+	Author    string `json:"author"`
+	AuthorURL string `json:"author_url,omitempty"`
+	// EmailMD5 and EmailSHA256 are avatar hashes of the commenter's email (never the email itself).
+	EmailMD5    string `json:"email_md5,omitempty"`
+	EmailSHA256 string `json:"email_sha256,omitempty"`
+	Body        string `json:"body"`
+	CreatedAt   int64  `json:"created_at"`
+	ApprovedAt  int64  `json:"approved_at"`
+}
+
+// ErrTooManySubscribers is returned by Subscribe if the site or the client IP
+// already has the maximum number of subscribers.
+var ErrTooManySubscribers = errors.New("too many subscribers")
+
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[int64]map[chan Comment]struct{}
+	perIP  map[string]int
+	closed bool
+
+	maxPerSite int
+	maxPerIP   int
+}
+
+// NewBroker returns a broker that accepts at most maxPerSite subscribers per site
+// and maxPerIP subscribers per client IP over all sites; 0 means no limit.
+func NewBroker(maxPerSite, maxPerIP int) *Broker {
+	return &Broker{
+		subs:       make(map[int64]map[chan Comment]struct{}),
+		perIP:      make(map[string]int),
+		maxPerSite: maxPerSite,
+		maxPerIP:   maxPerIP,
+	}
+}
+
+// Subscribe registers a subscriber for a site on behalf of the client ip. The
+// returned channel is closed when cancel is called or the broker is closed.
+// It returns ErrTooManySubscribers if a limit is reached.
+func (b *Broker) Subscribe(siteID int64, ip string) (<-chan Comment, func(), error) {
+	ch := make(chan Comment, subscriberBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(ch)
+		return ch, func() {}, nil
+	}
+	if b.maxPerSite > 0 && len(b.subs[siteID]) >= b.maxPerSite {
+		return nil, nil, ErrTooManySubscribers
+	}
+	if b.maxPerIP > 0 && b.perIP[ip] >= b.maxPerIP {
+		return nil, nil, ErrTooManySubscribers
+	}
+	if b.subs[siteID] == nil {
+		b.subs[siteID] = make(map[chan Comment]struct{})
+	}
+	b.subs[siteID][ch] = struct{}{}
+	b.perIP[ip]++
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subs[siteID][ch]; ok {
+				delete(b.subs[siteID], ch)
+				if len(b.subs[siteID]) == 0 {
+					delete(b.subs, siteID)
+				}
+				if b.perIP[ip]--; b.perIP[ip] <= 0 {
+					delete(b.perIP, ip)
+				}
+				close(ch)
+			}
+		})
+	}
+	return ch, cancel, nil
+}
+
+// Publish sends a comment to all subscribers of the site without blocking.
+func (b *Broker) Publish(siteID int64, c Comment) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[siteID] {
+		select {
+		case ch <- c:
+		default:
+			// Subscriber is too slow, drop the event.
+		}
+	}
+}
+
+// Close disconnects all subscribers. Further subscriptions are closed immediately.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for siteID, subs := range b.subs {
+		for ch := range subs {
+			close(ch)
+		}
+		delete(b.subs, siteID)
+	}
+	clear(b.perIP)
+}
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+// drain returns the events buffered in ch without blocking.
+func drain(ch <-chan Comment) []Comment {
+	var out []Comment
+	for {
+		select {
+		case c, open := <-ch:
+			if !open {
+				return out
+			}
+			out = append(out, c)
+		default:
+			return out
+		}
+	}
+}
+
+func TestPublishFanOut(t *testing.T) {
+	b := NewBroker(0, 0)
+	a1, cancelA1, _ := b.Subscribe(1, "192.0.2.1")
+	defer cancelA1()
+	a2, cancelA2, _ := b.Subscribe(1, "192.0.2.2")
+	defer cancelA2()
+	other, cancelOther, _ := b.Subscribe(2, "192.0.2.1")
+	defer cancelOther()
+
+	b.Publish(1, Comment{ID: "c1", PostPath: "/a/"})
+	b.Publish(3, Comment{ID: "c2"})
+
+	for name, ch := range map[string]<-chan Comment{"first": a1, "second": a2} {
+		if got := drain(ch); len(got) != 1 || got[0].ID != "c1" {
+			t.Errorf("%s subscriber got %+v, want c1", name, got)
+		}
+	}
+	if got := drain(other); len(got) != 0 {
+		t.Errorf("subscriber of another site got %+v", got)
+	}
+}
+
+func TestPublishDropsForSlowSubscribers(t *testing.T) {
+	b := NewBroker(0, 0)
+	slow, cancelSlow, _ := b.Subscribe(1, "192.0.2.1")
+	defer cancelSlow()
+	fast, cancelFast, _ := b.Subscribe(1, "192.0.2.2")
+	defer cancelFast()
+
+	received := 0
+	for i := 0; i < subscriberBuffer+5; i++ {
+		b.Publish(1, Comment{ID: "c"})
+		received += len(drain(fast))
+	}
+	if received != subscriberBuffer+5 {
+		t.Errorf("fast subscriber got %d events, want %d", received, subscriberBuffer+5)
+	}
+	if got := len(drain(slow)); got != subscriberBuffer {
+		t.Errorf("slow subscriber got %d events, want the %d buffered", got, subscriberBuffer)
+	}
+}
+
+func TestUnsubscribeAndClose(t *testing.T) {
+	b := NewBroker(0, 0)
+	ch, cancel, _ := b.Subscribe(1, "192.0.2.1")
+	cancel()
+	cancel() // cancelling twice is harmless
+	if _, open := <-ch; open {
+		t.Fatal("channel still open after cancel")
+	}
+	b.Publish(1, Comment{ID: "c1"}) // no send on the closed channel
+
+	ch, cancel, _ = b.Subscribe(1, "192.0.2.1")
+	b.Close()
+	if _, open := <-ch; open {
+		t.Fatal("channel still open after Close")
+	}
+	cancel()
+	b.Close()
+
+	ch, _, err := b.Subscribe(1, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, open := <-ch; open {
+		t.Fatal("subscription after Close is open")
+	}
+}
+
+func TestSubscriberLimits(t *testing.T) {
+	b := NewBroker(3, 2)
+	_, cancel1, err := b.Subscribe(1, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := b.Subscribe(2, "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	// The limit per IP counts the streams of all sites.
+	if _, _, err := b.Subscribe(3, "192.0.2.1"); !errors.Is(err, ErrTooManySubscribers) {
+		t.Fatalf("third stream of one IP: err = %v", err)
+	}
+	for _, ip := range []string{"192.0.2.2", "192.0.2.3"} {
+		if _, _, err := b.Subscribe(1, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := b.Subscribe(1, "192.0.2.4"); !errors.Is(err, ErrTooManySubscribers) {
+		t.Fatalf("fourth stream of a site: err = %v", err)
+	}
+
+	// Cancelling frees the slot of the site and of the IP.
+	cancel1()
+	if _, _, err := b.Subscribe(1, "192.0.2.1"); err != nil {
+		t.Fatalf("stream after cancel: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"go.yaml.in/yaml/v3"
+)
+
+// Output modes of the generator.
+const (
+	// OutputBundle writes one markdown file per comment into content/<post>/comments/.
+	OutputBundle = "bundle"
+	// OutputData writes one Hugo data file per post into data/comments/<site>/.
+	OutputData = "data"
+)
+
+// Formats of data files.
+const (
+	DataFormatJSON = "json"
+	DataFormatYAML = "yaml"
+)
+
+// dataFile is the content of a data file: the approved comments of one post, oldest first.
+type dataFile struct {
+	PostPath string        `json:"post_path" yaml:"post_path"`
+	Comments []dataComment `json:"comments" yaml:"comments"`
+}
+
+// dataComment uses the keys of the default front matter.
+type dataComment struct {
+	ID          string `json:"comment_id" yaml:"comment_id"`
+	Date        string `json:"date" yaml:"date"`
+	AuthorName  string `json:"author_name" yaml:"author_name"`
+	AuthorURL   string `json:"author_url" yaml:"author_url"`
+	EmailMD5    string `json:"email_md5" yaml:"email_md5"`
+	EmailSHA256 string `json:"email_sha256" yaml:"email_sha256"`
+	Status      string `json:"status" yaml:"status"`
+	ReplyTo     string `json:"reply_to" yaml:"reply_to"`
+	ThreadID    string `json:"thread_id" yaml:"thread_id"`
+	Depth       int    `json:"depth" yaml:"depth"`
+	Children    int    `json:"children" yaml:"children"`
+	ThreadOrder int    `json:"thread_order" yaml:"thread_order"`
+	EntryID     string `json:"entry_id,omitempty" yaml:"entry_id,omitempty"`
+	Body        string `json:"body" yaml:"body"`
+}
+
+// outputMode returns the configured output mode, OutputBundle by default.
+func outputMode(cfg config.GeneratorConfig) string {
+	if m := strings.ToLower(strings.TrimSpace(cfg.Output)); m != "" {
+		return m
+	}
+	return OutputBundle
+}
+
+// dataFormat returns the configured data file format, DataFormatJSON by default.
+func dataFormat(cfg config.GeneratorConfig) string {
+	switch f := strings.ToLower(strings.TrimSpace(cfg.DataFormat)); f {
+	case "":
+		return DataFormatJSON
+	case "yml":
+		return DataFormatYAML
+	default:
+		return f
+	}
+}
+
+// DataFileKey returns the name (without extension) of the data file of a post: the
+// hex SHA-256 of the post path without leading and trailing slashes ("posts/foo").
+func DataFileKey(postPath string) string {
+	sum := sha256.Sum256([]byte(postPath))
+	return hex.EncodeToString(sum[:])
+}
+
+// dataFilePath returns the slash-separated path of a post's data file below the site root.
+func (r renderer) dataFilePath(postPath string) string {
+	return path.Join("data", "comments", r.siteKey, DataFileKey(postPath)+"."+r.dataFormat)
+}
+
+// dataFile renders the data file of a post.
+func (r renderer) dataFile(postPath string, cs []db.Comment) ([]byte, error) {
+	f := dataFile{PostPath: postPath, Comments: make([]dataComment, 0, len(cs))}
+	threads := buildThreads(cs)
+	for _, c := range cs {
+		d := r.commentData(postPath, c, threads[c.ID])
+		f.Comments = append(f.Comments, dataComment{
+			ID:          d.ID,
+			Date:        d.Date.Format(time.RFC3339),
+			AuthorName:  d.Author,
+			AuthorURL:   d.AuthorURL,
+			EmailMD5:    d.EmailMD5,
+			EmailSHA256: d.EmailSHA256,
+			Status:      d.Status,
+			ReplyTo:     d.ReplyTo,
+			ThreadID:    d.ThreadID,
+			Depth:       d.Depth,
+			Children:    d.Children,
+			ThreadOrder: d.ThreadOrder,
+			EntryID:     d.EntryID,
+			Body:        d.Body,
+		})
+	}
+
+	var buf bytes.Buffer
+	switch r.dataFormat {
+	case DataFormatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(f); err != nil {
+			return nil, fmt.Errorf("encode data file for post_path %q: %w", postPath, err)
+		}
+		if err := enc.Close(); err != nil {
+			return nil, fmt.Errorf("encode data file for post_path %q: %w", postPath, err)
+		}
+	default:
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f); err != nil {
+			return nil, fmt.Errorf("encode data file for post_path %q: %w", postPath, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// writeDataFile replaces the data file at p, or removes it if data is nil, and records
+// the change in the manifest.
+func (g *Generator) writeDataFile(out Output, p string, data []byte) error {
+	var before []byte
+	reader, canRead := out.(CommentReader)
+	if canRead {
+		var err error
+		if before, err = reader.ReadFile(p); err != nil {
+			return err
+		}
+	}
+
+	if data == nil {
+		if err := out.RemoveFile(p); err != nil {
+			return err
+		}
+	} else if err := out.WriteFile(p, data); err != nil {
+		return err
+	}
+
+	if canRead {
+		g.Manifest.addFile(p, before, data)
+	}
+	return nil
+}
@@ -2,12 +2,14 @@
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"sort"
+	"text/template"
 	"time"
 
 	"github.com/geschke/fyndmark/config"
@@ -16,17 +18,60 @@ import (
 	"github.com/geschke/fyndmark/pkg/sanitize"
 )
 
+// maxAuthorURLLen matches the limit applied on submission.
+const maxAuthorURLLen = 2048
+
 type Generator struct {
 	DB      *db.DB
 	SiteKey string
+
+	// Output receives the generated files (default: DirOutput on the site's git workdir).
+	Output Output
+
+	// Manifest is filled by Generate with the files it changed. It stays empty
+	// if the output does not implement CommentReader.
+	Manifest Manifest
+
+	// Incremental skips bundles whose generated files match the hash stored by the
+	// last successful pipeline run (see db.SaveBundleHashes).
+	Incremental bool
+
+	// BundleHashes is filled by Generate with the content hash of every bundle
+	// with comments, keyed by post path.
+	BundleHashes map[string]string
+
+	// Strict fails the run if approved comments belong to invalid post paths or
+	// missing page bundles, in addition to comment_sites.<site>.generator.strict.
+	Strict bool
+
+	// Orphans is filled by Generate with the post paths whose comments were not
+	// written, sorted by post path.
+	Orphans []Orphan
 }
 
+// Orphan is a post path whose approved comments have no place in the site.
+type Orphan struct {
+	PostPath string `json:"post_path"`
+	Comments int    `json:"comments"`
+	Reason   string `json:"reason"`
+}
+
+// Orphan reasons.
+const (
+	OrphanInvalidPath   = "invalid post_path"
+	OrphanMissingBundle = "bundle not found"
+)
+
 // Generate reads approved comments from SQLite and writes them as markdown
 // files into each Hugo page bundle under <bundle>/comments/*.md.
 //
 // Bundle mapping:
 //   - comments.post_path like "/posts/foo/" maps to "<workDir>/content/posts/foo/"
 //   - within that directory, files are written to "<bundle>/comments/YYYY-MM-DD-NNN.md"
+//
+// Files go to g.Output, by default the site's git workdir. Bundles that were
+// generated before but have no approved comments left are emptied; with
+// g.Incremental, bundles whose files are unchanged are not touched.
 func (g *Generator) Generate(ctx context.Context) error {
 	if g == nil || g.DB == nil {
 		return fmt.Errorf("generator: DB is nil")
@@ -42,14 +87,39 @@ func (g *Generator) Generate(ctx context.Context) error {
 		return fmt.Errorf("unknown site_id %q (not found in comment_sites)", siteKey)
 	}
 
-	// Resolve repo working directory
-	workDir, _ := git.ResolveWorkdir(siteKey)
+	out := g.Output
+	if out == nil {
+		// Resolve repo working directory
+		workDir, _ := git.ResolveWorkdir(siteKey)
+		out = DirOutput{Root: workDir}
+	}
 
 	// Load timezone for markdown timestamps.
 	loc, err := resolveLocation(strings.TrimSpace(siteCfg.Timezone))
 	if err != nil {
 		return fmt.Errorf("invalid timezone for comment_sites.%s.timezone: %w", siteKey, err)
 	}
+	r := renderer{
+		siteKey:   siteKey,
+		loc:       loc,
+		policy:    sanitize.PolicyFromConfig(siteCfg.Sanitize),
+		urlPolicy: sanitize.URLPolicyFromConfig(siteCfg.Sanitize.AuthorURL),
+	}
+	dataMode := outputMode(siteCfg.Generator) == OutputData
+	if dataMode {
+		r.dataFormat = dataFormat(siteCfg.Generator)
+	} else {
+		if r.tmpl, err = loadCommentTemplate(siteKey, siteCfg.Generator); err != nil {
+			return err
+		}
+		if r.filename, err = loadFilenameTemplate(siteCfg.Generator); err != nil {
+			return err
+		}
+	}
+
+	g.Manifest = Manifest{}
+	g.BundleHashes = map[string]string{}
+	g.Orphans = nil
 
 	siteNumericID, found, err := g.DB.GetSiteIDByKey(ctx, siteKey)
 	if err != nil {
@@ -63,26 +133,54 @@ func (g *Generator) Generate(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	stored, err := g.DB.ListBundleHashes(ctx, siteNumericID)
+	if err != nil {
+		return err
+	}
 
 	// Group by post_path.
 	byPostPath := map[string][]db.Comment{}
+	invalid := map[string]int{}
 	for _, c := range comments {
-		postPath := normalizePostPath(c.PostPath)
-		if postPath == "" {
-			return fmt.Errorf("invalid post_path in DB (empty after normalization)")
+		postPath, err := normalizePostPath(c.PostPath)
+		if err != nil {
+			fmt.Printf("WARN: invalid post_path %q for comment %s: %v (skipping)\n", c.PostPath, c.ID, err)
+			invalid[c.PostPath]++
+			continue
 		}
 		c.PostPath = postPath
 		byPostPath[postPath] = append(byPostPath[postPath], c)
 	}
+	for p, n := range invalid {
+		g.Orphans = append(g.Orphans, Orphan{PostPath: p, Comments: n, Reason: OrphanInvalidPath})
+	}
 
-	// Deterministic iteration over bundles.
+	// Deterministic iteration over bundles. Data files need no page bundle.
 	postPaths := make([]string, 0, len(byPostPath))
-	for p := range byPostPath {
+	for p, cs := range byPostPath {
+		if !dataMode && !out.BundleExists(p) {
+			fmt.Printf("WARN: bundle directory not found for post_path %q (skipping)\n", p)
+			g.Orphans = append(g.Orphans, Orphan{PostPath: p, Comments: len(cs), Reason: OrphanMissingBundle})
+			continue
+		}
 		postPaths = append(postPaths, p)
 	}
 	sort.Strings(postPaths)
+	sort.Slice(g.Orphans, func(i, j int) bool { return g.Orphans[i].PostPath < g.Orphans[j].PostPath })
+
+	// Strict mode: fail before anything is written.
+	if len(g.Orphans) > 0 && (g.Strict || siteCfg.Generator.Strict) {
+		list := make([]string, 0, len(g.Orphans))
+		for _, o := range g.Orphans {
+			list = append(list, fmt.Sprintf("%q (%s, %d comments)", o.PostPath, o.Reason, o.Comments))
+		}
+		return fmt.Errorf("strict mode: approved comments without page bundle: %s", strings.Join(list, ", "))
+	}
 
 	for _, postPath := range postPaths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		cs := byPostPath[postPath]
 
 		// Ensure deterministic within bundle.
@@ -93,62 +191,200 @@ func (g *Generator) Generate(ctx context.Context) error {
 			return cs[i].ID < cs[j].ID
 		})
 
-		bundleDir := filepath.Join(workDir, "content", filepath.FromSlash(postPath))
-		if !dirExists(bundleDir) {
-			// Non-strict mode: skip comments for missing bundles.
-			fmt.Printf("WARN: bundle directory not found for post_path %q → %q (skipping)\n", postPath, bundleDir)
+		var files map[string][]byte
+		if dataMode {
+			// Data files are looked up by the theme; the post needs no page bundle.
+			b, err := r.dataFile(postPath, cs)
+			if err != nil {
+				return err
+			}
+			files = map[string][]byte{r.dataFilePath(postPath): b}
+		} else if files, err = r.bundleFiles(postPath, cs); err != nil {
+			return err
+		}
+
+		hash := bundleHash(files)
+		g.BundleHashes[postPath] = hash
+		if g.Incremental && stored[postPath] == hash {
+			g.Manifest.Unchanged += len(files)
 			continue
 		}
 
-		commentsDir := filepath.Join(bundleDir, "comments")
+		if dataMode {
+			p := r.dataFilePath(postPath)
+			err = g.writeDataFile(out, p, files[p])
+		} else {
+			err = g.writeBundle(out, postPath, files)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-		// Rebuild mode: remove and recreate comments directory to match DB exactly.
-		if err := os.RemoveAll(commentsDir); err != nil {
-			return fmt.Errorf("remove comments dir %q: %w", commentsDir, err)
+	// Bundles generated before that have no approved comments left.
+	var stale []string
+	for postPath := range stored {
+		if _, ok := g.BundleHashes[postPath]; !ok && (dataMode || out.BundleExists(postPath)) {
+			stale = append(stale, postPath)
 		}
-		if err := os.MkdirAll(commentsDir, 0o755); err != nil {
-			return fmt.Errorf("create comments dir %q: %w", commentsDir, err)
+	}
+	sort.Strings(stale)
+	for _, postPath := range stale {
+		if dataMode {
+			err = g.writeDataFile(out, r.dataFilePath(postPath), nil)
+		} else {
+			err = g.writeBundle(out, postPath, nil)
+		}
+		if err != nil {
+			return err
 		}
+	}
+	g.Manifest.sort()
+
+	return nil
+}
 
-		// Counter per local day (in configured timezone).
-		dayCounters := map[string]int{}
+// renderer turns the approved comments of a post into files.
+type renderer struct {
+	siteKey    string
+	loc        *time.Location
+	policy     sanitize.Policy
+	urlPolicy  *sanitize.URLPolicy
+	tmpl       *template.Template // bundle output
+	filename   *template.Template // bundle output, nil = default scheme
+	dataFormat string             // data output
+}
 
-		for _, c := range cs {
-			tLocal := time.Unix(c.CreatedAt, 0).In(loc)
-			dayKey := tLocal.Format("2006-01-02")
+// commentData prepares a comment for output.
+func (r renderer) commentData(postPath string, c db.Comment, t threadMeta) CommentData {
+	replyTo := ""
+	if c.ParentID.Valid {
+		replyTo = strings.TrimSpace(c.ParentID.String)
+	}
 
-			dayCounters[dayKey]++
-			if dayCounters[dayKey] > 999 {
-				return fmt.Errorf("more than 999 comments on %s for post_path %q", dayKey, postPath)
-			}
+	// Normalize newlines and ensure trailing newline.
+	body, _ := sanitize.SanitizeCommentBodyWithPolicy(c.Body, r.policy)
+
+	return CommentData{
+		ID:          c.ID,
+		SiteKey:     r.siteKey,
+		PostPath:    postPath,
+		EntryID:     strings.TrimSpace(c.EntryID.String),
+		ReplyTo:     replyTo,
+		Status:      "approved",
+		Date:        time.Unix(c.CreatedAt, 0).In(r.loc),
+		Author:      strings.TrimSpace(c.Author),
+		AuthorURL:   authorURL(c, r.urlPolicy),
+		EmailMD5:    c.EmailMD5,
+		EmailSHA256: c.EmailSHA256,
+		Body:        body,
+		ThreadID:    t.ThreadID,
+		Depth:       t.Depth,
+		Children:    t.Children,
+		ThreadOrder: t.Order,
+	}
+}
 
-			filename := fmt.Sprintf("%s-%03d.md", dayKey, dayCounters[dayKey])
-			outPath := filepath.Join(commentsDir, filename)
+// bundleFiles renders the comment files of a page bundle, named by the site's file name
+// template (default YYYY-MM-DD-NNN.md).
+func (r renderer) bundleFiles(postPath string, cs []db.Comment) (map[string][]byte, error) {
+	files := map[string][]byte{}
 
-			replyTo := ""
-			if c.ParentID.Valid {
-				replyTo = strings.TrimSpace(c.ParentID.String)
-			}
+	// Counter per local day (in configured timezone).
+	dayCounters := map[string]int{}
+	threads := buildThreads(cs)
 
-			md := renderCommentMarkdown(
-				c.ID,
-				tLocal,
-				c.Author,
-				c.AuthorURLString(),
-				replyTo,
-				"approved",
-				c.Body,
-			)
-
-			if err := os.WriteFile(outPath, []byte(md), 0o644); err != nil {
-				return fmt.Errorf("write comment file %q: %w", outPath, err)
-			}
+	for _, c := range cs {
+		data := r.commentData(postPath, c, threads[c.ID])
+		dayKey := data.Date.Format("2006-01-02")
+
+		dayCounters[dayKey]++
+		if r.filename == nil && dayCounters[dayKey] > 999 {
+			return nil, fmt.Errorf("more than 999 comments on %s for post_path %q", dayKey, postPath)
+		}
+
+		name, err := renderFilename(r.filename, FilenameData{CommentData: data, Counter: dayCounters[dayKey]})
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := files[name]; dup {
+			return nil, fmt.Errorf("file name %q used twice for post_path %q", name, postPath)
+		}
+
+		md, err := renderComment(r.tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = md
+	}
+	return files, nil
+}
+
+// writeBundle replaces the comment files of a bundle and records the changes in the manifest.
+func (g *Generator) writeBundle(out Output, postPath string, files map[string][]byte) error {
+	// Remember the current files for the manifest.
+	var before map[string][]byte
+	reader, canRead := out.(CommentReader)
+	if canRead {
+		var err error
+		if before, err = reader.ReadComments(postPath); err != nil {
+			return err
+		}
+	}
+
+	// Remove and recreate the comments directory to match the DB exactly.
+	if err := out.ResetComments(postPath); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := out.WriteComment(postPath, name, files[name]); err != nil {
+			return err
 		}
 	}
 
+	if canRead {
+		g.Manifest.addBundle(postPath, before, files)
+	}
 	return nil
 }
 
+// bundleHash returns the content hash of the comment files of a bundle.
+func bundleHash(files map[string][]byte) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(files[name]))
+		h.Write(files[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// authorURL re-validates the stored author URL against the current rules and domain
+// lists of the site, so URLs stored under older rules or blocked since are not
+// published. It returns "" for URLs that no longer pass.
+func authorURL(c db.Comment, policy *sanitize.URLPolicy) string {
+	raw := c.AuthorURLString()
+	if raw == "" {
+		return ""
+	}
+	u, _, err := sanitize.SanitizeAuthorURLWithPolicy(raw, maxAuthorURLLen, policy)
+	if err != nil {
+		fmt.Printf("WARN: author_url of comment %s no longer valid: %v (omitted)\n", c.ID, err)
+		return ""
+	}
+	return u
+}
+
 // resolveLocation performs its package-specific operation.
 func resolveLocation(tz string) (*time.Location, error) {
 	if tz == "" {
@@ -160,12 +396,11 @@ func resolveLocation(tz string) (*time.Location, error) {
 	return time.LoadLocation(tz)
 }
 
-// normalizePostPath converts DB post_path like "/posts/foo/" to "posts/foo".
-func normalizePostPath(p string) string {
-	p = strings.TrimSpace(p)
-	p = strings.ReplaceAll(p, "\\", "/")
+// normalizePostPath converts DB post_path like "/posts/foo/" or "\\posts\\foo" to "posts/foo".
+func normalizePostPath(p string) (string, error) {
+	p = strings.ReplaceAll(strings.TrimSpace(p), "\\", "/")
 	p = strings.Trim(p, "/")
-	return p
+	return sanitize.RelativePath(p)
 }
 
 // dirExists performs its package-specific operation.
@@ -176,26 +411,3 @@ func dirExists(path string) bool {
 	}
 	return st.IsDir()
 }
-
-// renderCommentMarkdown matches your established front matter structure.
-// Note: author_url is currently empty as your DB doesn't contain a URL field.
-func renderCommentMarkdown(commentID string, date time.Time, authorName, authorUrl, replyTo, status, body string) string {
-	authorName = strings.TrimSpace(authorName)
-	authorUrl = strings.TrimSpace(authorUrl)
-	replyTo = strings.TrimSpace(replyTo)
-	status = strings.TrimSpace(status)
-
-	// Normalize newlines and ensure trailing newline.
-	body = sanitize.SanitizeCommentBody(body)
-
-	return fmt.Sprintf(`---
-comment_id: %q
-date: %s
-author_name: %q
-author_url: %q
-status: %q
-reply_to: %q
----
-
-%s`, commentID, date.Format(time.RFC3339), authorName, authorUrl, status, replyTo, body)
-}
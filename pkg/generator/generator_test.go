@@ -0,0 +1,543 @@
+package generator
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+func TestNormalizePostPath(t *testing.T) {
+	valid := map[string]string{
+		"/posts/foo/":     "posts/foo",
+		`\posts\foo\`:     "posts/foo",
+		"posts/foo":       "posts/foo",
+		" /posts/a/../b ": "posts/b",
+	}
+	for in, want := range valid {
+		got, err := normalizePostPath(in)
+		if err != nil {
+			t.Errorf("normalizePostPath(%q): unexpected error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("normalizePostPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "/", "/../etc", `..\..\x`, "C:/posts"} {
+		if got, err := normalizePostPath(in); err == nil {
+			t.Errorf("normalizePostPath(%q) = %q, want error", in, got)
+		}
+	}
+}
+
+func TestGenerateToMemoryOutput(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, err := d.GetSiteIDByKey(ctx, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := config.Cfg.CommentSites
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {}}
+	defer func() { config.Cfg.CommentSites = prev }()
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC).Unix()
+	for _, id := range []string{"c1", "c2"} {
+		if err := d.InsertComment(ctx, db.Comment{ID: id, SiteID: siteID, PostPath: "/posts/foo/", Status: "pending", Author: "Ann", Body: "Hello " + id, CreatedAt: created}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.ApproveComment(ctx, siteID, id, db.Decision{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := NewMemoryOutput()
+	_ = out.WriteComment("posts/foo", "stale.md", []byte("old"))
+	g := Generator{DB: d, SiteKey: "blog", Output: out}
+	if err := g.Generate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	files := out.Files()
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+	md := string(files["content/posts/foo/comments/2025-03-01-002.md"])
+	if !strings.Contains(md, `comment_id: "c2"`) || !strings.Contains(md, "Hello c2") {
+		t.Fatalf("unexpected file content:\n%s", md)
+	}
+
+	m := g.Manifest
+	if len(m.Created) != 2 || len(m.Removed) != 1 || m.Removed[0] != "content/posts/foo/comments/stale.md" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	// A second run over the same output changes nothing.
+	if err := g.Generate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Manifest.Empty() || g.Manifest.Unchanged != 2 {
+		t.Fatalf("expected unchanged manifest, got %+v", g.Manifest)
+	}
+}
+
+func TestGenerateRevalidatesAuthorURL(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	prev := config.Cfg.CommentSites
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {
+		Sanitize: config.SanitizeConfig{AuthorURL: config.AuthorURLConfig{BlockedDomains: []string{"spam.example"}}},
+	}}
+	defer func() { config.Cfg.CommentSites = prev }()
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC).Unix()
+	urls := map[string]string{
+		"c1": "https://ann.example/blog",
+		"c2": "https://www.spam.example/", // blocked after the comment was stored
+		"c3": "javascript:alert(1)",       // stored under older rules
+	}
+	for _, id := range []string{"c1", "c2", "c3"} {
+		cm := db.Comment{ID: id, SiteID: siteID, PostPath: "/posts/foo/", Status: "pending", Author: "Ann", Body: "Hi", CreatedAt: created,
+			AuthorUrl: sql.NullString{String: urls[id], Valid: true}}
+		if err := d.InsertComment(ctx, cm); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.ApproveComment(ctx, siteID, id, db.Decision{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := NewMemoryOutput()
+	g := Generator{DB: d, SiteKey: "blog", Output: out}
+	if err := g.Generate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	files := out.Files()
+	want := map[string]string{
+		"001": `author_url: "https://ann.example/blog"`,
+		"002": `author_url: ""`,
+		"003": `author_url: ""`,
+	}
+	for n, line := range want {
+		md := string(files["content/posts/foo/comments/2025-03-01-"+n+".md"])
+		if !strings.Contains(md, line) {
+			t.Fatalf("file %s: expected %s in\n%s", n, line, md)
+		}
+	}
+}
+
+func TestGenerateWithTemplate(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC).Unix()
+	if err := d.InsertComment(ctx, db.Comment{ID: "c1", SiteID: siteID, PostPath: "/posts/foo/", Status: "pending", Author: "Ann", Body: "Line one\nLine two", CreatedAt: created}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ApproveComment(ctx, siteID, "c1", db.Decision{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tmplFile := filepath.Join(t.TempDir(), "comment.tmpl")
+	if err := os.WriteFile(tmplFile, []byte(`{{ json . }}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	prev := config.Cfg.CommentSites
+	defer func() { config.Cfg.CommentSites = prev }()
+
+	for _, tc := range []struct {
+		cfg  config.GeneratorConfig
+		want string
+	}{
+		{
+			cfg:  config.GeneratorConfig{Template: "+++\nid = {{ quote .ID }}\nday = {{ date \"2006-01-02\" .Date }}\n+++\n{{ indent 2 .Body }}\n"},
+			want: "+++\nid = \"c1\"\nday = 2025-03-01\n+++\n  Line one\n  Line two\n",
+		},
+		{
+			cfg:  config.GeneratorConfig{TemplateFile: tmplFile},
+			want: `"ID":"c1","SiteKey":"blog","PostPath":"posts/foo"`,
+		},
+	} {
+		config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {Generator: tc.cfg}}
+		if err := ValidateConfig(); err != nil {
+			t.Fatal(err)
+		}
+
+		out := NewMemoryOutput()
+		g := Generator{DB: d, SiteKey: "blog", Output: out}
+		if err := g.Generate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		md := string(out.Files()["content/posts/foo/comments/2025-03-01-001.md"])
+		if !strings.Contains(md, tc.want) {
+			t.Fatalf("expected %q in\n%s", tc.want, md)
+		}
+	}
+
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {Generator: config.GeneratorConfig{Template: "{{ .Nope "}}}
+	if err := ValidateConfig(); err == nil {
+		t.Fatal("expected a parse error")
+	}
+}
+
+func TestGenerateFilenameTemplate(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC).Unix()
+	for _, id := range []string{"01B", "01A"} {
+		if err := d.InsertComment(ctx, db.Comment{ID: id, SiteID: siteID, PostPath: "/posts/foo/", Status: "pending", Author: "Ann", Body: "hi", CreatedAt: created}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.ApproveComment(ctx, siteID, id, db.Decision{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prev := config.Cfg.CommentSites
+	defer func() { config.Cfg.CommentSites = prev }()
+
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {Generator: config.GeneratorConfig{Filename: `{{ date "2006-01-02" .Date }}-{{ .ID }}.md`}}}
+	out := NewMemoryOutput()
+	g := Generator{DB: d, SiteKey: "blog", Output: out}
+	if err := g.Generate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"content/posts/foo/comments/2025-03-01-01A.md", "content/posts/foo/comments/2025-03-01-01B.md"}
+	if !reflect.DeepEqual(g.Manifest.Created, want) {
+		t.Fatalf("created = %v, want %v", g.Manifest.Created, want)
+	}
+
+	for _, pattern := range []string{"{{ .PostPath }}.md", "{{ .SiteKey }}.md"} {
+		config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {Generator: config.GeneratorConfig{Filename: pattern}}}
+		g := Generator{DB: d, SiteKey: "blog", Output: NewMemoryOutput()}
+		if err := g.Generate(ctx); err == nil {
+			t.Fatalf("expected error for file name template %q", pattern)
+		}
+	}
+}
+
+func TestGenerateStrict(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	prev := config.Cfg.CommentSites
+	defer func() { config.Cfg.CommentSites = prev }()
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {}}
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC).Unix()
+	for _, c := range []db.Comment{
+		{ID: "c1", SiteID: siteID, PostPath: "/posts/foo/", Status: "pending", Author: "Ann", Body: "foo", CreatedAt: created},
+		{ID: "c2", SiteID: siteID, PostPath: "/posts/typo/", Status: "pending", Author: "Bob", Body: "bar", CreatedAt: created},
+	} {
+		if err := d.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.ApproveComment(ctx, siteID, c.ID, db.Decision{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newRoot := func() string {
+		root := t.TempDir()
+		if err := os.MkdirAll(filepath.Join(root, "content", "posts", "foo"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+	wantOrphans := []Orphan{{PostPath: "posts/typo", Comments: 1, Reason: OrphanMissingBundle}}
+
+	g := Generator{DB: d, SiteKey: "blog", Output: DirOutput{Root: newRoot()}}
+	if err := g.Generate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.Orphans, wantOrphans) || len(g.Manifest.Created) != 1 {
+		t.Fatalf("orphans %+v, manifest %+v", g.Orphans, g.Manifest)
+	}
+
+	root := newRoot()
+	g = Generator{DB: d, SiteKey: "blog", Output: DirOutput{Root: root}, Strict: true}
+	err = g.Generate(ctx)
+	if err == nil || !strings.Contains(err.Error(), "posts/typo") {
+		t.Fatalf("expected strict mode error, got %v", err)
+	}
+	if !reflect.DeepEqual(g.Orphans, wantOrphans) {
+		t.Fatalf("orphans %+v", g.Orphans)
+	}
+	if _, err := os.Stat(filepath.Join(root, "content", "posts", "foo", "comments")); !os.IsNotExist(err) {
+		t.Fatalf("strict mode wrote files before failing: %v", err)
+	}
+}
+
+func TestBuildThreads(t *testing.T) {
+	reply := func(id, parent string) db.Comment {
+		return db.Comment{ID: id, ParentID: sql.NullString{String: parent, Valid: parent != ""}}
+	}
+	// Oldest first: a, b, a1 (reply to a), a1x (reply to a1), b1 (reply to b),
+	// a2 (reply to a), o (reply to an unpublished comment).
+	cs := []db.Comment{reply("a", ""), reply("b", ""), reply("a1", "a"), reply("a1x", "a1"), reply("b1", "b"), reply("a2", "a"), reply("o", "gone")}
+
+	got := buildThreads(cs)
+	want := map[string]threadMeta{
+		"a":   {ThreadID: "a", Depth: 0, Children: 2, Order: 1},
+		"a1":  {ThreadID: "a", Depth: 1, Children: 1, Order: 2},
+		"a1x": {ThreadID: "a", Depth: 2, Children: 0, Order: 3},
+		"a2":  {ThreadID: "a", Depth: 1, Children: 0, Order: 4},
+		"b":   {ThreadID: "b", Depth: 0, Children: 1, Order: 5},
+		"b1":  {ThreadID: "b", Depth: 1, Children: 0, Order: 6},
+		"o":   {ThreadID: "o", Depth: 0, Children: 0, Order: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("buildThreads =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestGenerateIncremental(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	prev := config.Cfg.CommentSites
+	defer func() { config.Cfg.CommentSites = prev }()
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {}}
+
+	root := t.TempDir()
+	for _, p := range []string{"posts/foo", "posts/bar"} {
+		if err := os.MkdirAll(filepath.Join(root, "content", filepath.FromSlash(p)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC).Unix()
+	for _, c := range []db.Comment{
+		{ID: "c1", SiteID: siteID, PostPath: "/posts/foo/", Status: "pending", Author: "Ann", Body: "foo", CreatedAt: created},
+		{ID: "c2", SiteID: siteID, PostPath: "/posts/bar/", Status: "pending", Author: "Bob", Body: "bar", CreatedAt: created},
+	} {
+		if err := d.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.ApproveComment(ctx, siteID, c.ID, db.Decision{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := Generator{DB: d, SiteKey: "blog", Output: DirOutput{Root: root}, Incremental: true}
+	if err := g.Generate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Manifest.Created) != 2 || len(g.BundleHashes) != 2 {
+		t.Fatalf("first run: manifest %+v, hashes %v", g.Manifest, g.BundleHashes)
+	}
+	if err := d.SaveBundleHashes(ctx, siteID, g.BundleHashes); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file edited in the workdir shows that unchanged bundles are not rewritten.
+	fooFile := filepath.Join(root, "content", "posts", "foo", "comments", "2025-03-01-001.md")
+	if err := os.WriteFile(fooFile, []byte("local edit"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.RejectComment(ctx, siteID, "c2", db.Decision{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Generate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if g.Manifest.Unchanged != 1 || len(g.Manifest.Created) != 0 || len(g.Manifest.Updated) != 0 {
+		t.Fatalf("second run: manifest %+v", g.Manifest)
+	}
+	if want := []string{"content/posts/bar/comments/2025-03-01-001.md"}; !reflect.DeepEqual(g.Manifest.Removed, want) {
+		t.Fatalf("removed = %v, want %v", g.Manifest.Removed, want)
+	}
+	if b, _ := os.ReadFile(fooFile); string(b) != "local edit" {
+		t.Fatalf("unchanged bundle was rewritten: %q", b)
+	}
+	if _, ok := g.BundleHashes["posts/bar"]; ok {
+		t.Fatalf("hash of emptied bundle kept: %v", g.BundleHashes)
+	}
+
+	// A full run rewrites every bundle.
+	g.Incremental = false
+	if err := g.Generate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"content/posts/foo/comments/2025-03-01-001.md"}; !reflect.DeepEqual(g.Manifest.Updated, want) {
+		t.Fatalf("full run updated = %v, want %v", g.Manifest.Updated, want)
+	}
+}
+
+func TestGenerateDataFiles(t *testing.T) {
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := d.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	siteID, _, _ := d.GetSiteIDByKey(ctx, "blog")
+
+	created := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC).Unix()
+	for _, c := range []db.Comment{
+		{ID: "c1", SiteID: siteID, PostPath: "/posts/foo/", Status: "pending", Author: "Ann", Body: "<b>first</b>", CreatedAt: created},
+		{ID: "c2", SiteID: siteID, PostPath: "/posts/foo/", ParentID: sql.NullString{String: "c1", Valid: true}, Status: "pending", Author: "Bob", Body: "reply", CreatedAt: created + 60},
+	} {
+		if err := d.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.ApproveComment(ctx, siteID, c.ID, db.Decision{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prev := config.Cfg.CommentSites
+	defer func() { config.Cfg.CommentSites = prev }()
+
+	key := DataFileKey("posts/foo")
+	for _, tc := range []struct {
+		format string
+		path   string
+		want   []string
+	}{
+		{"", "data/comments/blog/" + key + ".json", []string{`"post_path": "posts/foo"`, `"comment_id": "c2"`, `"reply_to": "c1"`}},
+		{"yaml", "data/comments/blog/" + key + ".yaml", []string{"post_path: posts/foo", "comment_id: c2", "reply_to: c1"}},
+	} {
+		config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {Generator: config.GeneratorConfig{Output: OutputData, DataFormat: tc.format}}}
+		if err := ValidateConfig(); err != nil {
+			t.Fatal(err)
+		}
+
+		out := NewMemoryOutput()
+		g := Generator{DB: d, SiteKey: "blog", Output: out}
+		if err := g.Generate(ctx); err != nil {
+			t.Fatal(err)
+		}
+		files := out.Files()
+		if len(files) != 1 || !reflect.DeepEqual(g.Manifest.Created, []string{tc.path}) {
+			t.Fatalf("files %v, manifest %+v", files, g.Manifest)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(string(files[tc.path]), want) {
+				t.Fatalf("expected %q in\n%s", want, files[tc.path])
+			}
+		}
+	}
+
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {Generator: config.GeneratorConfig{Output: OutputData, Template: "{{ .ID }}"}}}
+	if err := ValidateConfig(); err == nil {
+		t.Fatal("expected error for template with data output")
+	}
+}
+
+func TestTarOutput(t *testing.T) {
+	var buf bytes.Buffer
+	out := NewTarOutput(&buf)
+	_ = out.WriteComment("posts/foo", "2025-03-01-001.md", []byte("x"))
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, err := tar.NewReader(gz).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != "content/posts/foo/comments/2025-03-01-001.md" || hdr.Size != 1 {
+		t.Fatalf("unexpected entry %s (%d bytes)", hdr.Name, hdr.Size)
+	}
+}
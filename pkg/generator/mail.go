@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/geschke/fyndmark/pkg/db"
 	"github.com/geschke/fyndmark/pkg/sanitize"
 )
 
@@ -23,6 +24,16 @@ type ModerationMailInput struct {
 	CreatedAt  time.Time
 	ApproveURL string
 	RejectURL  string
+
+	// Policy is the site's sanitize policy (nil = default).
+	Policy *sanitize.Policy
+
+	// WordMatches are the word filter matches ("field:term"); WordAction is the filter's action.
+	WordAction  string
+	WordMatches []string
+
+	// DisposableEmail flags an address at a throwaway mail service.
+	DisposableEmail bool
 }
 
 // BuildModerationMail returns (subject, body, report) for the admin moderation email.
@@ -30,7 +41,7 @@ type ModerationMailInput struct {
 func BuildModerationMail(in ModerationMailInput) (string, string, sanitize.CommentBodyReport) {
 	subject := fmt.Sprintf("[Fyndmark] New comment pending (%s)", in.SiteID)
 
-	sanitized, report := sanitize.SanitizeCommentBodyWithReport(in.Body)
+	sanitized, report := sanitize.SanitizeCommentBodyWithPolicy(in.Body, mailPolicy(in.Policy))
 
 	var sb strings.Builder
 
@@ -75,6 +86,9 @@ func BuildModerationMail(in ModerationMailInput) (string, string, sanitize.Comme
 	if report.RemovedNULBytes {
 		sb.WriteString("- Removed NUL bytes\n")
 	}
+	if report.RemovedInvisibleChars > 0 {
+		sb.WriteString(fmt.Sprintf("- Removed invisible/bidi control characters: %d\n", report.RemovedInvisibleChars))
+	}
 	if report.HTMLTagTokens > 0 || report.HTMLCommentTokens > 0 || report.HTMLDoctypeTokens > 0 {
 		sb.WriteString(fmt.Sprintf("- HTML tokens removed: tags=%d, comments=%d, doctypes=%d\n",
 			report.HTMLTagTokens, report.HTMLCommentTokens, report.HTMLDoctypeTokens))
@@ -85,6 +99,24 @@ func BuildModerationMail(in ModerationMailInput) (string, string, sanitize.Comme
 	if report.MarkdownImages > 0 {
 		sb.WriteString(fmt.Sprintf("- Markdown images degraded: %d\n", report.MarkdownImages))
 	}
+	if len(report.KeptLinks) > 0 {
+		sb.WriteString(fmt.Sprintf("- Links kept (rel=%q): %s\n", report.LinkRel, strings.Join(report.KeptLinks, ", ")))
+	}
+	if report.StrippedTrackingParams > 0 {
+		sb.WriteString(fmt.Sprintf("- Tracking parameters removed: %d\n", report.StrippedTrackingParams))
+	}
+	if report.DisallowedFormatting > 0 {
+		sb.WriteString(fmt.Sprintf("- Formatting removed by site policy: %d\n", report.DisallowedFormatting))
+	}
+	if report.Truncated {
+		sb.WriteString("- Truncated to the maximum body length\n")
+	}
+	if in.DisposableEmail {
+		sb.WriteString("- Email address uses a disposable domain\n")
+	}
+	if len(in.WordMatches) > 0 {
+		sb.WriteString(fmt.Sprintf("- Word filter matches (%s): %s\n", in.WordAction, strings.Join(in.WordMatches, ", ")))
+	}
 	sb.WriteString("\n")
 
 	sb.WriteString("Approve:\n")
@@ -97,3 +129,110 @@ func BuildModerationMail(in ModerationMailInput) (string, string, sanitize.Comme
 
 	return subject, sb.String(), report
 }
+
+// ConfirmationMailInput contains the data of the double opt-in mail sent to the commenter.
+type ConfirmationMailInput struct {
+	SiteTitle  string
+	PostPath   string
+	Author     string
+	Body       string
+	ConfirmURL string
+	ExpiresAt  time.Time
+
+	// ViewURL optionally links to the post, showing the commenter's own pending comments.
+	ViewURL string
+
+	// Policy is the site's sanitize policy (nil = default).
+	Policy *sanitize.Policy
+}
+
+// BuildConfirmationMail returns (subject, body) for the email asking the commenter to confirm
+// their address. The comment text is included sanitized, so the recipient can recognize it.
+func BuildConfirmationMail(in ConfirmationMailInput) (string, string) {
+	site := strings.TrimSpace(in.SiteTitle)
+	subject := "Please confirm your comment"
+	if site != "" {
+		subject += " on " + site
+	}
+
+	sanitized, _ := sanitize.SanitizeCommentBodyWithPolicy(in.Body, mailPolicy(in.Policy))
+
+	var sb strings.Builder
+	sb.WriteString("Hello " + in.Author + ",\n\n")
+	sb.WriteString("you wrote a comment on " + in.PostPath)
+	if site != "" {
+		sb.WriteString(" (" + site + ")")
+	}
+	sb.WriteString(". Please confirm your email address with the following link, then the comment is passed on for moderation:\n\n")
+	sb.WriteString(in.ConfirmURL)
+	sb.WriteString("\n\n")
+	if !in.ExpiresAt.IsZero() {
+		sb.WriteString("The link is valid until " + in.ExpiresAt.Format(time.RFC1123) + ". Unconfirmed comments are deleted afterwards.\n\n")
+	}
+	if in.ViewURL != "" {
+		sb.WriteString("After confirming, you can see your comment on the page while it awaits moderation (only you see it, with this link):\n\n")
+		sb.WriteString(in.ViewURL)
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("If you did not write this comment, ignore this mail.\n\n")
+	sb.WriteString("Your comment:\n")
+	sb.WriteString(sanitized)
+	if !strings.HasSuffix(sanitized, "\n") {
+		sb.WriteString("\n")
+	}
+	return subject, sb.String()
+}
+
+// SummaryMailInput contains the data of the weekly site summary.
+type SummaryMailInput struct {
+	SiteID    string
+	SiteTitle string
+	From      time.Time
+	Until     time.Time
+	Stats     db.SiteStats
+}
+
+// BuildSummaryMail returns (subject, body) for the weekly activity summary sent to the site admins.
+func BuildSummaryMail(in SummaryMailInput) (string, string) {
+	name := strings.TrimSpace(in.SiteTitle)
+	if name == "" {
+		name = in.SiteID
+	}
+	subject := fmt.Sprintf("[Fyndmark] Weekly summary (%s)", name)
+
+	const day = "2006-01-02"
+	st := in.Stats
+
+	var sb strings.Builder
+	sb.WriteString("Weekly summary for " + name + "\n")
+	sb.WriteString("Period: " + in.From.Format(day) + " to " + in.Until.Add(-time.Second).Format(day) + "\n\n")
+
+	sb.WriteString("Comments:\n")
+	sb.WriteString(fmt.Sprintf("- New submissions: %d\n", st.NewComments))
+	sb.WriteString(fmt.Sprintf("- Approved: %d\n", st.Approved))
+	sb.WriteString(fmt.Sprintf("- Rejected: %d\n", st.Rejected))
+	sb.WriteString(fmt.Sprintf("- Classified as spam: %d\n", st.Spam))
+	sb.WriteString(fmt.Sprintf("- Waiting for moderation now: %d\n\n", st.Pending))
+
+	if len(st.TopPosts) > 0 {
+		sb.WriteString("Most discussed posts:\n")
+		for _, p := range st.TopPosts {
+			sb.WriteString(fmt.Sprintf("- %s (%d)\n", p.PostPath, p.Comments))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("Pipeline:\n")
+	sb.WriteString(fmt.Sprintf("- Runs: %d\n", st.PipelineRuns))
+	sb.WriteString(fmt.Sprintf("- Failed: %d\n", st.PipelineFailures))
+
+	return subject, sb.String()
+}
+
+// mailPolicy returns the given sanitize policy or the default one.
+func mailPolicy(p *sanitize.Policy) sanitize.Policy {
+	if p == nil {
+		return sanitize.DefaultPolicy()
+	}
+	return *p
+}
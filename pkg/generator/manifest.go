@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Manifest lists the comment files a generator run created, updated or removed,
+// as slash-separated paths below the site root (content/<post>/comments/<name>).
+type Manifest struct {
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Removed   []string `json:"removed"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// Empty reports whether the run changed no files.
+func (m Manifest) Empty() bool {
+	return len(m.Created) == 0 && len(m.Updated) == 0 && len(m.Removed) == 0
+}
+
+// addBundle compares the files of a bundle before and after it was rewritten.
+func (m *Manifest) addBundle(postPath string, before, after map[string][]byte) {
+	for name, data := range after {
+		old, existed := before[name]
+		switch {
+		case !existed:
+			m.Created = append(m.Created, commentPath(postPath, name))
+		case !bytes.Equal(old, data):
+			m.Updated = append(m.Updated, commentPath(postPath, name))
+		default:
+			m.Unchanged++
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			m.Removed = append(m.Removed, commentPath(postPath, name))
+		}
+	}
+}
+
+// addFile compares a single file before and after it was written; nil means missing.
+func (m *Manifest) addFile(p string, before, after []byte) {
+	switch {
+	case after == nil && before != nil:
+		m.Removed = append(m.Removed, p)
+	case after == nil:
+	case before == nil:
+		m.Created = append(m.Created, p)
+	case !bytes.Equal(before, after):
+		m.Updated = append(m.Updated, p)
+	default:
+		m.Unchanged++
+	}
+}
+
+// sort orders the file lists for stable output.
+func (m *Manifest) sort() {
+	sort.Strings(m.Created)
+	sort.Strings(m.Updated)
+	sort.Strings(m.Removed)
+}
@@ -0,0 +1,278 @@
+package generator
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Output receives the generated comment files. Post paths are normalized
+// (see normalizePostPath), names are file names within the bundle's comments directory.
+type Output interface {
+	// BundleExists reports whether the page bundle of a post path exists;
+	// comments of missing bundles are skipped.
+	BundleExists(postPath string) bool
+	// ResetComments removes all comment files of a bundle before it is rewritten.
+	ResetComments(postPath string) error
+	// WriteComment stores one comment file.
+	WriteComment(postPath, name string, data []byte) error
+	// WriteFile stores a file at a slash-separated path below the site root (data files).
+	WriteFile(p string, data []byte) error
+	// RemoveFile deletes a file below the site root; a missing file is no error.
+	RemoveFile(p string) error
+}
+
+// CommentReader is implemented by outputs that can return the existing comment files
+// of a bundle. The generator uses it to record which files a run changed (see Manifest).
+type CommentReader interface {
+	ReadComments(postPath string) (map[string][]byte, error)
+	// ReadFile returns the file at a slash-separated path below the site root,
+	// nil if it does not exist.
+	ReadFile(p string) ([]byte, error)
+}
+
+// commentPath returns the slash-separated path of a comment file below content/.
+func commentPath(postPath, name string) string {
+	return path.Join("content", postPath, "comments", name)
+}
+
+// DirOutput writes into the content/ tree of a Hugo site directory (the git workdir).
+type DirOutput struct {
+	Root string
+}
+
+// BundleExists reports whether content/<postPath> exists below Root.
+func (o DirOutput) BundleExists(postPath string) bool {
+	return dirExists(filepath.Join(o.Root, "content", filepath.FromSlash(postPath)))
+}
+
+// ResetComments removes and recreates the comments directory of a bundle.
+func (o DirOutput) ResetComments(postPath string) error {
+	commentsDir := filepath.Join(o.Root, "content", filepath.FromSlash(postPath), "comments")
+	if err := os.RemoveAll(commentsDir); err != nil {
+		return fmt.Errorf("remove comments dir %q: %w", commentsDir, err)
+	}
+	if err := os.MkdirAll(commentsDir, 0o755); err != nil {
+		return fmt.Errorf("create comments dir %q: %w", commentsDir, err)
+	}
+	return nil
+}
+
+// ReadComments returns the files of the bundle's comments directory by name.
+func (o DirOutput) ReadComments(postPath string) (map[string][]byte, error) {
+	commentsDir := filepath.Join(o.Root, "content", filepath.FromSlash(postPath), "comments")
+	entries, err := os.ReadDir(commentsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read comments dir %q: %w", commentsDir, err)
+	}
+
+	out := make(map[string][]byte, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(commentsDir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read comment file: %w", err)
+		}
+		out[e.Name()] = b
+	}
+	return out, nil
+}
+
+// WriteComment writes a comment file into the bundle's comments directory.
+func (o DirOutput) WriteComment(postPath, name string, data []byte) error {
+	outPath := filepath.Join(o.Root, filepath.FromSlash(commentPath(postPath, name)))
+	if err := os.WriteFile(outPath, data, 0o644); err != nil {
+		return fmt.Errorf("write comment file %q: %w", outPath, err)
+	}
+	return nil
+}
+
+// WriteFile writes a file below Root, creating its directory.
+func (o DirOutput) WriteFile(p string, data []byte) error {
+	outPath := filepath.Join(o.Root, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+		return fmt.Errorf("create dir for %q: %w", outPath, err)
+	}
+	if err := os.WriteFile(outPath, data, 0o644); err != nil {
+		return fmt.Errorf("write file %q: %w", outPath, err)
+	}
+	return nil
+}
+
+// RemoveFile deletes a file below Root.
+func (o DirOutput) RemoveFile(p string) error {
+	outPath := filepath.Join(o.Root, filepath.FromSlash(p))
+	if err := os.Remove(outPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove file %q: %w", outPath, err)
+	}
+	return nil
+}
+
+// ReadFile reads a file below Root.
+func (o DirOutput) ReadFile(p string) ([]byte, error) {
+	outPath := filepath.Join(o.Root, filepath.FromSlash(p))
+	b, err := os.ReadFile(outPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read file %q: %w", outPath, err)
+	}
+	return b, nil
+}
+
+// MemoryOutput keeps the generated files in memory, keyed by their path below the
+// site root (content/<post>/comments/<name>). All bundles are treated as existing.
+type MemoryOutput struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemoryOutput returns an empty in-memory output.
+func NewMemoryOutput() *MemoryOutput {
+	return &MemoryOutput{files: make(map[string][]byte)}
+}
+
+// BundleExists always reports true.
+func (o *MemoryOutput) BundleExists(string) bool { return true }
+
+// ResetComments drops the stored files of a bundle.
+func (o *MemoryOutput) ResetComments(postPath string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	prefix := path.Join("content", postPath, "comments") + "/"
+	for p := range o.files {
+		if len(p) > len(prefix) && p[:len(prefix)] == prefix {
+			delete(o.files, p)
+		}
+	}
+	return nil
+}
+
+// ReadComments returns the stored files of a bundle by name.
+func (o *MemoryOutput) ReadComments(postPath string) (map[string][]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	prefix := path.Join("content", postPath, "comments") + "/"
+	out := make(map[string][]byte)
+	for p, b := range o.files {
+		if len(p) > len(prefix) && p[:len(prefix)] == prefix {
+			out[p[len(prefix):]] = b
+		}
+	}
+	return out, nil
+}
+
+// WriteComment stores a copy of the file.
+func (o *MemoryOutput) WriteComment(postPath, name string, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.files[commentPath(postPath, name)] = append([]byte(nil), data...)
+	return nil
+}
+
+// WriteFile stores a copy of the file.
+func (o *MemoryOutput) WriteFile(p string, data []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.files[p] = append([]byte(nil), data...)
+	return nil
+}
+
+// RemoveFile drops a stored file.
+func (o *MemoryOutput) RemoveFile(p string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.files, p)
+	return nil
+}
+
+// ReadFile returns a stored file.
+func (o *MemoryOutput) ReadFile(p string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.files[p], nil
+}
+
+// Files returns a copy of the stored files.
+func (o *MemoryOutput) Files() map[string][]byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := make(map[string][]byte, len(o.files))
+	for p, b := range o.files {
+		out[p] = b
+	}
+	return out
+}
+
+// TarOutput collects the generated files and writes them as a gzip-compressed tarball
+// on Close, e.g. as an artifact for a downstream CI job. Paths in the archive are
+// relative to the site root, so the tarball can be extracted over a Hugo checkout.
+type TarOutput struct {
+	w   io.Writer
+	mem *MemoryOutput
+}
+
+// NewTarOutput returns an output writing the archive to w.
+func NewTarOutput(w io.Writer) *TarOutput {
+	return &TarOutput{w: w, mem: NewMemoryOutput()}
+}
+
+// BundleExists always reports true; the archive does not know the site's bundles.
+func (o *TarOutput) BundleExists(postPath string) bool { return o.mem.BundleExists(postPath) }
+
+// ResetComments drops the collected files of a bundle.
+func (o *TarOutput) ResetComments(postPath string) error { return o.mem.ResetComments(postPath) }
+
+// WriteComment adds a file to the archive.
+func (o *TarOutput) WriteComment(postPath, name string, data []byte) error {
+	return o.mem.WriteComment(postPath, name, data)
+}
+
+// WriteFile adds a file to the archive.
+func (o *TarOutput) WriteFile(p string, data []byte) error { return o.mem.WriteFile(p, data) }
+
+// RemoveFile drops a collected file.
+func (o *TarOutput) RemoveFile(p string) error { return o.mem.RemoveFile(p) }
+
+// Close writes the archive, with files in sorted order.
+func (o *TarOutput) Close() error {
+	files := o.mem.Files()
+	names := make([]string, 0, len(files))
+	for p := range files {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+
+	gz := gzip.NewWriter(o.w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, name := range names {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name])), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write tar header %q: %w", name, err)
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return fmt.Errorf("write tar entry %q: %w", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("close tar: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("close gzip: %w", err)
+	}
+	return nil
+}
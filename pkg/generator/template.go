@@ -0,0 +1,202 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/git"
+)
+
+// DefaultCommentTemplate is the built-in comment file format.
+// The email itself is never written, only its hashes for avatar services.
+const DefaultCommentTemplate = `---
+comment_id: {{ quote .ID }}
+date: {{ rfc3339 .Date }}
+author_name: {{ quote .Author }}
+author_url: {{ quote .AuthorURL }}
+email_md5: {{ quote .EmailMD5 }}
+email_sha256: {{ quote .EmailSHA256 }}
+status: {{ quote .Status }}
+reply_to: {{ quote .ReplyTo }}
+thread_id: {{ quote .ThreadID }}
+depth: {{ .Depth }}
+children: {{ .Children }}
+thread_order: {{ .ThreadOrder }}
+---
+
+{{ .Body }}`
+
+// CommentData is passed to comment file templates.
+type CommentData struct {
+	ID       string
+	SiteKey  string
+	PostPath string // bundle path below content/, e.g. "posts/foo"
+	EntryID  string
+	ReplyTo  string // ID of the parent comment, "" for top-level comments
+	Status   string
+
+	// Date is the creation time in the site's timezone.
+	Date time.Time
+
+	Author      string
+	AuthorURL   string // re-validated, "" if not set or no longer valid
+	EmailMD5    string
+	EmailSHA256 string
+
+	// Body is the sanitized comment text, ending with a newline.
+	Body string
+
+	// Thread position among the published comments of the post. Replies to
+	// unpublished comments count as top-level.
+	ThreadID    string // ID of the top-level comment of the thread
+	Depth       int    // 0 for top-level comments
+	Children    int    // number of direct replies
+	ThreadOrder int    // position in depth-first order (parent before replies), from 1
+}
+
+// FilenameData is passed to file name templates.
+type FilenameData struct {
+	CommentData
+
+	// Counter numbers the comments of a post per day, starting at 1.
+	Counter int
+}
+
+// templateFuncs are available in comment templates.
+var templateFuncs = template.FuncMap{
+	// quote returns s as double-quoted string, valid in YAML and TOML.
+	"quote": strconv.Quote,
+	// json returns v as JSON, e.g. for front matter in JSON format.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"rfc3339": func(t time.Time) string { return t.Format(time.RFC3339) },
+	// date formats t with a Go layout, e.g. {{ date "2006-01-02" .Date }}.
+	"date": func(layout string, t time.Time) string { return t.Format(layout) },
+	// indent prefixes every line of s with n spaces, e.g. for YAML block scalars.
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n"+pad)
+	},
+	"trim": strings.TrimSpace,
+}
+
+// parseCommentTemplate parses a comment file template.
+func parseCommentTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// loadCommentTemplate returns the comment template of a site: the template file,
+// the inline template or the built-in format.
+func loadCommentTemplate(siteKey string, cfg config.GeneratorConfig) (*template.Template, error) {
+	if path := strings.TrimSpace(cfg.TemplateFile); path != "" {
+		if !filepath.IsAbs(path) {
+			workDir, err := git.ResolveWorkdir(siteKey)
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(workDir, path)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("comment template: %w", err)
+		}
+		tmpl, err := parseCommentTemplate(filepath.Base(path), string(b))
+		if err != nil {
+			return nil, fmt.Errorf("comment template %s: %w", path, err)
+		}
+		return tmpl, nil
+	}
+
+	text := DefaultCommentTemplate
+	if strings.TrimSpace(cfg.Template) != "" {
+		text = cfg.Template
+	}
+	tmpl, err := parseCommentTemplate("comment", text)
+	if err != nil {
+		return nil, fmt.Errorf("comment template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderComment executes the comment template.
+func renderComment(tmpl *template.Template, data CommentData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("render comment %s: %w", data.ID, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// loadFilenameTemplate returns the file name template of a site, nil for the default
+// scheme YYYY-MM-DD-NNN.md.
+func loadFilenameTemplate(cfg config.GeneratorConfig) (*template.Template, error) {
+	if strings.TrimSpace(cfg.Filename) == "" {
+		return nil, nil
+	}
+	tmpl, err := parseCommentTemplate("filename", strings.TrimSpace(cfg.Filename))
+	if err != nil {
+		return nil, fmt.Errorf("filename template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderFilename returns the file name of a comment. Names must stay within the
+// bundle's comments directory.
+func renderFilename(tmpl *template.Template, data FilenameData) (string, error) {
+	if tmpl == nil {
+		return fmt.Sprintf("%s-%03d.md", data.Date.Format("2006-01-02"), data.Counter), nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render file name of comment %s: %w", data.ID, err)
+	}
+	name := strings.TrimSpace(buf.String())
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return "", fmt.Errorf("invalid file name %q for comment %s", name, data.ID)
+	}
+	return name, nil
+}
+
+// ValidateConfig checks the output settings and parses the inline comment templates of
+// all sites. Template files live in the site repositories and are checked when the
+// generator runs.
+func ValidateConfig() error {
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		gc := siteCfg.Generator
+		if strings.TrimSpace(gc.Template) != "" && strings.TrimSpace(gc.TemplateFile) != "" {
+			return fmt.Errorf("comment_sites.%s.generator: set either template or template_file", siteKey)
+		}
+		switch outputMode(gc) {
+		case OutputBundle:
+		case OutputData:
+			if f := dataFormat(gc); f != DataFormatJSON && f != DataFormatYAML {
+				return fmt.Errorf("comment_sites.%s.generator.data_format must be json or yaml, got %q", siteKey, gc.DataFormat)
+			}
+			if strings.TrimSpace(gc.Template) != "" || strings.TrimSpace(gc.TemplateFile) != "" || strings.TrimSpace(gc.Filename) != "" {
+				return fmt.Errorf("comment_sites.%s.generator: templates only apply to output %q", siteKey, OutputBundle)
+			}
+		default:
+			return fmt.Errorf("comment_sites.%s.generator.output must be %s or %s, got %q", siteKey, OutputBundle, OutputData, gc.Output)
+		}
+		if _, err := loadFilenameTemplate(gc); err != nil {
+			return fmt.Errorf("comment_sites.%s.generator.filename: %w", siteKey, err)
+		}
+		if strings.TrimSpace(gc.Template) == "" {
+			continue
+		}
+		if _, err := parseCommentTemplate("comment", gc.Template); err != nil {
+			return fmt.Errorf("comment_sites.%s.generator.template: %w", siteKey, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package generator
+
+import (
+	"strings"
+
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// threadMeta describes the position of a comment in the reply tree of its post.
+type threadMeta struct {
+	ThreadID string // ID of the top-level comment of the thread
+	Depth    int    // 0 for top-level comments
+	Children int    // number of direct replies
+	Order    int    // position in depth-first thread order, starting at 1
+}
+
+// buildThreads computes the thread metadata of the approved comments of a post. cs must
+// be sorted oldest first; replies follow their parent in the same order. Replies whose
+// parent is not published (pending, rejected, another post) are treated as top-level.
+func buildThreads(cs []db.Comment) map[string]threadMeta {
+	known := make(map[string]bool, len(cs))
+	for _, c := range cs {
+		known[c.ID] = true
+	}
+
+	var roots []string
+	children := map[string][]string{}
+	for _, c := range cs {
+		parent := ""
+		if c.ParentID.Valid {
+			parent = strings.TrimSpace(c.ParentID.String)
+		}
+		if parent == "" || parent == c.ID || !known[parent] {
+			roots = append(roots, c.ID)
+			continue
+		}
+		children[parent] = append(children[parent], c.ID)
+	}
+
+	out := make(map[string]threadMeta, len(cs))
+	var walk func(id, threadID string, depth int)
+	walk = func(id, threadID string, depth int) {
+		if _, seen := out[id]; seen {
+			return
+		}
+		out[id] = threadMeta{ThreadID: threadID, Depth: depth, Children: len(children[id]), Order: len(out) + 1}
+		for _, child := range children[id] {
+			walk(child, threadID, depth+1)
+		}
+	}
+	for _, id := range roots {
+		walk(id, id, 0)
+	}
+
+	// Comments in a reply cycle are not reachable from a root; list them as top-level.
+	for _, c := range cs {
+		if _, seen := out[c.ID]; !seen {
+			walk(c.ID, c.ID, 0)
+		}
+	}
+	return out
+}
@@ -0,0 +1,161 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// AuditConfig validates the repository URLs and working directories of all comment sites.
+// Checkout removes the clone dir before cloning, so a mis-typed clone_dir must never
+// point to another site's workdir, the application directory or the database.
+// All problems are reported at once.
+func AuditConfig() error {
+	var errs []error
+
+	baseDir := ""
+	if b := strings.TrimSpace(config.Cfg.Workspace.BaseDir); b != "" {
+		abs, err := filepath.Abs(b)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("workspace.base_dir: %w", err))
+		} else {
+			baseDir = abs
+		}
+	}
+
+	cwd, _ := os.Getwd()
+	dbDir := ""
+	if p := strings.TrimSpace(config.Cfg.SQLite.Path); p != "" {
+		if abs, err := filepath.Abs(p); err == nil {
+			dbDir = filepath.Dir(abs)
+		}
+	}
+
+	siteKeys := make([]string, 0, len(config.Cfg.CommentSites))
+	for siteKey := range config.Cfg.CommentSites {
+		siteKeys = append(siteKeys, siteKey)
+	}
+	sort.Strings(siteKeys)
+
+	workdirs := make(map[string]string, len(siteKeys))
+	for _, siteKey := range siteKeys {
+		gc := config.Cfg.CommentSites[siteKey].Git
+		if strings.TrimSpace(gc.RepoURL) == "" {
+			// Site without git pipeline.
+			continue
+		}
+
+		if err := checkRepoURL(gc.RepoURL); err != nil {
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.repo_url: %w", siteKey, err))
+		}
+		if m := CheckoutModeOf(gc); m != CheckoutClone && m != CheckoutFetch {
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.checkout_mode must be %s or %s, got %q", siteKey, CheckoutClone, CheckoutFetch, gc.CheckoutMode))
+		}
+		if email := strings.TrimSpace(gc.AuthorEmail); email != "" && !strings.Contains(email, "@") {
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.author_email: %q is not an email address", siteKey, email))
+		}
+		if strings.TrimSpace(gc.Revision) != "" {
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.revision is not supported: the site branch cannot be pinned because the pipeline pushes to it; use min_revision to require a commit in its history", siteKey))
+		}
+		if gc.PushRetries != nil && *gc.PushRetries < 0 {
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.push_retries must be >= 0", siteKey))
+		}
+		if err := auditSigning(gc); err != nil {
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.signing: %w", siteKey, err))
+		}
+		if err := auditPullRequest(gc); err != nil {
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.pull_request: %w", siteKey, err))
+		}
+		if text := strings.TrimSpace(gc.CommitMessage); text != "" {
+			if _, err := parseCommitMessage(text); err != nil {
+				errs = append(errs, fmt.Errorf("comment_sites.%s.git.commit_message: %w", siteKey, err))
+			}
+		}
+
+		dir, _ := ResolveWorkdir(siteKey)
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.clone_dir: %w", siteKey, err))
+			continue
+		}
+
+		switch {
+		case absDir == filepath.Dir(absDir):
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.clone_dir: must not be the filesystem root", siteKey))
+		case cwd != "" && isWithin(cwd, absDir):
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.clone_dir: must not contain the working directory %q", siteKey, cwd))
+		case dbDir != "" && isWithin(dbDir, absDir):
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.clone_dir: must not contain the sqlite database", siteKey))
+		case baseDir != "" && (absDir == baseDir || !isWithin(absDir, baseDir)):
+			errs = append(errs, fmt.Errorf("comment_sites.%s.git.clone_dir: %q is outside workspace.base_dir %q", siteKey, absDir, baseDir))
+		}
+
+		for otherKey, otherDir := range workdirs {
+			if isWithin(absDir, otherDir) || isWithin(otherDir, absDir) {
+				errs = append(errs, fmt.Errorf("comment_sites.%s.git.clone_dir: overlaps with the clone dir of site %q", siteKey, otherKey))
+			}
+		}
+		workdirs[siteKey] = absDir
+
+		targets := make(map[string]struct{}, len(gc.Themes))
+		for i, t := range gc.Themes {
+			if err := checkRepoURL(t.RepoURL); err != nil {
+				errs = append(errs, fmt.Errorf("comment_sites.%s.git.themes[%d].repo_url: %w", siteKey, i, err))
+			}
+			rel, err := sanitizeRelativePath(strings.TrimSpace(t.TargetPath))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("comment_sites.%s.git.themes[%d].target_path: %w", siteKey, i, err))
+				continue
+			}
+			if _, dup := targets[rel]; dup {
+				errs = append(errs, fmt.Errorf("comment_sites.%s.git.themes[%d].target_path: %q is used twice", siteKey, i, rel))
+			}
+			targets[rel] = struct{}{}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkRepoURL requires an absolute URL whose host is in workspace.allowed_hosts (if configured).
+func checkRepoURL(raw string) error {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fmt.Errorf("must be set")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("must be an absolute URL")
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	allowed := config.Cfg.Workspace.AllowedHosts
+	if len(allowed) == 0 {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range allowed {
+		if strings.ToLower(strings.TrimSpace(h)) == host {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q is not in workspace.allowed_hosts", host)
+}
+
+// isWithin reports whether path equals dir or is located below it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,191 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestIsWithin(t *testing.T) {
+	base := filepath.Join("srv", "sites")
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{base, true},
+		{filepath.Join(base, "a"), true},
+		{filepath.Join("srv", "sites-other"), false},
+		{"srv", false},
+	}
+	for _, c := range cases {
+		if got := isWithin(c.path, base); got != c.want {
+			t.Errorf("isWithin(%q, %q) = %t, want %t", c.path, base, got, c.want)
+		}
+	}
+}
+
+func TestAuditConfigCheckoutMode(t *testing.T) {
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+
+	for mode, ok := range map[string]bool{"": true, CheckoutClone: true, CheckoutFetch: true, "pull": false} {
+		config.Cfg = config.AppConfig{CommentSites: map[string]config.CommentsSiteConfig{
+			"blog": {Git: config.GitConfig{
+				RepoURL:      "https://example.org/blog.git",
+				CloneDir:     filepath.Join(t.TempDir(), "blog"),
+				CheckoutMode: mode,
+			}},
+		}}
+		err := AuditConfig()
+		if ok && err != nil {
+			t.Errorf("checkout_mode %q: unexpected error: %v", mode, err)
+		}
+		if !ok && (err == nil || !strings.Contains(err.Error(), "checkout_mode")) {
+			t.Errorf("checkout_mode %q: err = %v, want checkout_mode error", mode, err)
+		}
+	}
+}
+
+func TestAuditSigning(t *testing.T) {
+	key := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(key, []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		signing config.GitSigningConfig
+		ok      bool
+	}{
+		{config.GitSigningConfig{}, true},
+		{config.GitSigningConfig{Format: "ssh", Key: key}, true},
+		{config.GitSigningConfig{Format: "gpg", Key: "0xDEADBEEF"}, true},
+		{config.GitSigningConfig{Format: "ssh", Key: key + ".missing"}, false},
+		{config.GitSigningConfig{Format: "ssh"}, false},
+		{config.GitSigningConfig{Format: "x509", Key: key}, false},
+		{config.GitSigningConfig{Key: key}, false},
+	}
+	for _, c := range cases {
+		err := auditSigning(config.GitConfig{Signing: c.signing})
+		if (err == nil) != c.ok {
+			t.Errorf("auditSigning(%+v) = %v, want ok=%t", c.signing, err, c.ok)
+		}
+	}
+}
+
+func TestAuditConfigWorkdirsAndHosts(t *testing.T) {
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+
+	// site returns a site whose repository lives on host and is cloned to dir.
+	site := func(host, dir string) config.CommentsSiteConfig {
+		return config.CommentsSiteConfig{Git: config.GitConfig{RepoURL: "https://" + host + "/acme/site.git", CloneDir: dir}}
+	}
+	cases := []struct {
+		name      string
+		workspace config.WorkspaceConfig
+		sqlite    string
+		sites     map[string]config.CommentsSiteConfig
+		wantErr   string
+	}{
+		{
+			name:      "valid",
+			workspace: config.WorkspaceConfig{BaseDir: work, AllowedHosts: []string{"GitHub.com", "gitlab.com"}},
+			sqlite:    filepath.Join(root, "data", "fyndmark.sqlite"),
+			sites: map[string]config.CommentsSiteConfig{
+				"blog": site("github.com", filepath.Join(work, "blog")),
+				"docs": site("gitlab.com", filepath.Join(work, "docs")),
+				// Sites without repository are not checked.
+				"forms": {},
+			},
+		},
+		{
+			name: "overlapping clone dirs",
+			sites: map[string]config.CommentsSiteConfig{
+				"blog": site("github.com", filepath.Join(work, "blog")),
+				"docs": site("github.com", filepath.Join(work, "blog", "docs")),
+			},
+			wantErr: `comment_sites.docs.git.clone_dir: overlaps with the clone dir of site "blog"`,
+		},
+		{
+			name: "same clone dir",
+			sites: map[string]config.CommentsSiteConfig{
+				"blog": site("github.com", filepath.Join(work, "site")),
+				"docs": site("github.com", filepath.Join(work, "site", ".")),
+			},
+			wantErr: "overlaps with the clone dir",
+		},
+		{
+			name:      "clone dir outside base dir",
+			workspace: config.WorkspaceConfig{BaseDir: work},
+			sites:     map[string]config.CommentsSiteConfig{"blog": site("github.com", filepath.Join(root, "elsewhere"))},
+			wantErr:   "comment_sites.blog.git.clone_dir: " + `"` + filepath.Join(root, "elsewhere") + `" is outside workspace.base_dir`,
+		},
+		{
+			name:      "clone dir is the base dir",
+			workspace: config.WorkspaceConfig{BaseDir: work},
+			sites:     map[string]config.CommentsSiteConfig{"blog": site("github.com", work)},
+			wantErr:   "is outside workspace.base_dir",
+		},
+		{
+			name:      "host not allowed",
+			workspace: config.WorkspaceConfig{AllowedHosts: []string{"github.com"}},
+			sites:     map[string]config.CommentsSiteConfig{"blog": site("git.example.org", filepath.Join(work, "blog"))},
+			wantErr:   `comment_sites.blog.git.repo_url: host "git.example.org" is not in workspace.allowed_hosts`,
+		},
+		{
+			name:      "theme host not allowed",
+			workspace: config.WorkspaceConfig{AllowedHosts: []string{"github.com"}},
+			sites: map[string]config.CommentsSiteConfig{"blog": {Git: config.GitConfig{
+				RepoURL:  "https://github.com/acme/blog.git",
+				CloneDir: filepath.Join(work, "blog"),
+				Themes:   []config.GitThemeConfig{{RepoURL: "https://evil.example.org/theme.git", TargetPath: "themes/t"}},
+			}}},
+			wantErr: `comment_sites.blog.git.themes[0].repo_url: host "evil.example.org" is not in workspace.allowed_hosts`,
+		},
+		{
+			name:    "unsupported scheme",
+			sites:   map[string]config.CommentsSiteConfig{"blog": {Git: config.GitConfig{RepoURL: "ssh://git@github.com/acme/blog.git", CloneDir: filepath.Join(work, "blog")}}},
+			wantErr: `comment_sites.blog.git.repo_url: unsupported scheme "ssh"`,
+		},
+		{
+			name:    "clone dir contains the working directory",
+			sites:   map[string]config.CommentsSiteConfig{"blog": site("github.com", filepath.Dir(cwd))},
+			wantErr: "comment_sites.blog.git.clone_dir: must not contain the working directory",
+		},
+		{
+			name:    "clone dir contains the database",
+			sqlite:  filepath.Join(work, "blog", "data", "fyndmark.sqlite"),
+			sites:   map[string]config.CommentsSiteConfig{"blog": site("github.com", filepath.Join(work, "blog"))},
+			wantErr: "comment_sites.blog.git.clone_dir: must not contain the sqlite database",
+		},
+		{
+			name:    "clone dir is the filesystem root",
+			sites:   map[string]config.CommentsSiteConfig{"blog": site("github.com", string(filepath.Separator))},
+			wantErr: "comment_sites.blog.git.clone_dir: must not be the filesystem root",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config.Cfg = config.AppConfig{Workspace: c.workspace, CommentSites: c.sites}
+			config.Cfg.SQLite.Path = c.sqlite
+			err := AuditConfig()
+			if c.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Fatalf("err = %v, want %q", err, c.wantErr)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -11,6 +12,23 @@ import (
 	"github.com/geschke/fyndmark/pkg/gitcli"
 )
 
+// Checkout modes of git.checkout_mode.
+const (
+	// CheckoutClone removes the working copy and clones it again on every run.
+	CheckoutClone = "clone"
+	// CheckoutFetch reuses an existing working copy: fetch, hard reset to the remote
+	// branch and clean. It falls back to a clone if the working copy is unusable.
+	CheckoutFetch = "fetch"
+)
+
+// CheckoutModeOf returns the effective checkout mode of a site.
+func CheckoutModeOf(gc config.GitConfig) string {
+	if m := strings.TrimSpace(gc.CheckoutMode); m != "" {
+		return m
+	}
+	return CheckoutClone
+}
+
 type GitRunner struct {
 	SiteID string
 }
@@ -41,28 +59,57 @@ func CheckoutWithContext(ctx context.Context, siteID string) error {
 		return fmt.Errorf("comment_sites.%s.git.repo_url must be set", siteID)
 	}
 
+	// Re-check paths right before the workdir is removed.
+	if err := AuditConfig(); err != nil {
+		return fmt.Errorf("workspace audit failed: %w", err)
+	}
+
 	// Determine target directory.
 	targetDir, _ := ResolveWorkdir(siteID)
 
-	// Idempotent behavior: always start with a clean directory.
-	_ = os.RemoveAll(targetDir)
-	if err := os.MkdirAll(targetDir, 0o755); err != nil {
-		return fmt.Errorf("failed to create clone dir %q: %w", targetDir, err)
+	reused := false
+	if CheckoutModeOf(gc) == CheckoutFetch && existsDir(filepath.Join(targetDir, ".git")) {
+		if err := updateWorkdir(ctx, siteID, targetDir); err != nil {
+			fmt.Printf("Updating working copy failed, cloning again: %v\n", err)
+		} else {
+			reused = true
+		}
 	}
 
-	fmt.Printf("Cloning repo into: %s\n", targetDir)
+	if !reused {
+		// Idempotent behavior: always start with a clean directory.
+		_ = os.RemoveAll(targetDir)
+		if err := os.MkdirAll(targetDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create clone dir %q: %w", targetDir, err)
+		}
 
-	// Clone website repo (optionally with submodules).
-	if err := gitcli.Clone(ctx, gitcli.CloneOptions{
-		RepoURL:           repoURL,
-		Branch:            strings.TrimSpace(gc.Branch),
-		AccessToken:       strings.TrimSpace(gc.AccessToken),
-		TargetDir:         targetDir,
-		Depth:             gc.Depth,
-		Timeout:           2 * time.Minute,
-		RecurseSubmodules: gc.RecurseSubmodules,
+		fmt.Printf("Cloning repo into: %s\n", targetDir)
+
+		// Clone website repo (optionally with submodules).
+		if err := gitcli.Clone(ctx, gitcli.CloneOptions{
+			RepoURL:           repoURL,
+			Branch:            strings.TrimSpace(gc.Branch),
+			AccessToken:       strings.TrimSpace(gc.AccessToken),
+			TokenUsername:     siteTokenUsername(gc),
+			TargetDir:         targetDir,
+			Depth:             gc.Depth,
+			Timeout:           commandTimeout(ctx, 2*time.Minute),
+			RecurseSubmodules: gc.RecurseSubmodules,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Verify the branch contains the minimum revision (optional).
+	if err := ensurePinnedRevision(ctx, pinOptions{
+		RepoDir:       targetDir,
+		RepoURL:       repoURL,
+		AccessToken:   strings.TrimSpace(gc.AccessToken),
+		TokenUsername: siteTokenUsername(gc),
+		Revision:      gc.MinRevision,
+		Depth:         gc.Depth,
 	}); err != nil {
-		return err
+		return fmt.Errorf("comment_sites.%s.git.min_revision: %w", siteID, err)
 	}
 
 	// Ensure additional themes/components (optional).
@@ -73,3 +120,60 @@ func CheckoutWithContext(ctx context.Context, siteID string) error {
 	fmt.Printf("Checkout completed. Workdir: %s\n", targetDir)
 	return nil
 }
+
+// updateWorkdir brings an existing working copy to the head of the remote branch:
+// fetch, hard reset and clean, which also removes build output. Theme clones (not
+// tracked theme directories or submodules) are kept; ensureThemes updates them.
+// It fails if origin no longer matches repo_url, so the caller clones again.
+func updateWorkdir(ctx context.Context, siteID string, targetDir string) error {
+	gc := config.Cfg.CommentSites[siteID].Git
+	repoURL := strings.TrimSpace(gc.RepoURL)
+
+	origin, err := gitcli.RemoteURL(ctx, targetDir, commandTimeout(ctx, 30*time.Second))
+	if err != nil {
+		return err
+	}
+	if origin != repoURL {
+		return fmt.Errorf("origin of %q does not match repo_url", targetDir)
+	}
+
+	fmt.Printf("Updating repo in: %s\n", targetDir)
+
+	// An empty branch fetches the default branch of the remote.
+	branch := strings.TrimSpace(gc.Branch)
+	ref := branch
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := gitcli.Fetch(ctx, gitcli.FetchOptions{
+		RepoDir:       targetDir,
+		Ref:           ref,
+		Depth:         gc.Depth,
+		RepoURL:       repoURL,
+		AccessToken:   strings.TrimSpace(gc.AccessToken),
+		TokenUsername: siteTokenUsername(gc),
+		Timeout:       commandTimeout(ctx, 2*time.Minute),
+	}); err != nil {
+		return err
+	}
+
+	var keep []string
+	for _, t := range gc.Themes {
+		rel, err := sanitizeRelativePath(strings.TrimSpace(t.TargetPath))
+		if err != nil {
+			return fmt.Errorf("invalid theme target_path %q: %w", t.TargetPath, err)
+		}
+		if existsDir(filepath.Join(targetDir, rel, ".git")) {
+			keep = append(keep, filepath.ToSlash(rel))
+		}
+	}
+
+	return gitcli.ResetToRef(ctx, gitcli.ResetOptions{
+		RepoDir:           targetDir,
+		Ref:               "FETCH_HEAD",
+		Branch:            branch,
+		Keep:              keep,
+		Timeout:           commandTimeout(ctx, 2*time.Minute),
+		RecurseSubmodules: gc.RecurseSubmodules,
+	})
+}
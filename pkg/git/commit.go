@@ -1,14 +1,93 @@
 ﻿package git
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"strings"
+	"text/template"
 	"time"
 
+	"github.com/geschke/fyndmark/config"
 	"github.com/geschke/fyndmark/pkg/gitcli"
 )
 
+// DefaultCommitMessage is used if git.commit_message is not set.
+const DefaultCommitMessage = "Update generated content"
+
+// CommitMessageData is passed to commit message templates. Run and comment fields
+// are empty for commits outside of a pipeline run.
+type CommitMessageData struct {
+	SiteKey string
+	RunID   int64
+
+	// Triggering comment of the run; coalesced runs keep the first trigger.
+	CommentID     string
+	CommentAuthor string
+	PostPath      string
+}
+
+// siteSigning returns the commit signing settings of a site.
+func siteSigning(gc config.GitConfig) gitcli.Signing {
+	return gitcli.Signing{
+		Format:     strings.TrimSpace(gc.Signing.Format),
+		Key:        strings.TrimSpace(gc.Signing.Key),
+		Passphrase: strings.TrimSpace(gc.Signing.Passphrase),
+	}
+}
+
+// auditSigning checks the commit signing settings of a site. Key files are required
+// for SSH keys and for the go-git backend.
+func auditSigning(gc config.GitConfig) error {
+	s := siteSigning(gc)
+	switch s.Format {
+	case "":
+		if s.Key != "" {
+			return fmt.Errorf("format must be set with key")
+		}
+		return nil
+	case gitcli.SignSSH, gitcli.SignGPG:
+	default:
+		return fmt.Errorf("format must be %s or %s, got %q", gitcli.SignSSH, gitcli.SignGPG, gc.Signing.Format)
+	}
+	if s.Key == "" {
+		return fmt.Errorf("key must be set")
+	}
+	if s.Format == gitcli.SignSSH || strings.TrimSpace(config.Cfg.Workspace.GitBackend) == gitcli.BackendGoGit {
+		if _, err := os.Stat(s.Key); err != nil {
+			return fmt.Errorf("key: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseCommitMessage parses a commit message template.
+func parseCommitMessage(text string) (*template.Template, error) {
+	return template.New("commit_message").Option("missingkey=error").Parse(text)
+}
+
+// CommitMessage renders the commit message of a site from git.commit_message.
+func CommitMessage(siteID string, data CommitMessageData) (string, error) {
+	text := strings.TrimSpace(config.Cfg.CommentSites[siteID].Git.CommitMessage)
+	if text == "" {
+		return DefaultCommitMessage, nil
+	}
+	tmpl, err := parseCommitMessage(text)
+	if err != nil {
+		return "", fmt.Errorf("comment_sites.%s.git.commit_message: %w", siteID, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("comment_sites.%s.git.commit_message: %w", siteID, err)
+	}
+	msg := strings.TrimSpace(buf.String())
+	if msg == "" {
+		return DefaultCommitMessage, nil
+	}
+	return msg, nil
+}
+
 // Commit performs its package-specific operation.
 func (r *GitRunner) Commit(ctx context.Context, message string) error {
 	if r == nil {
@@ -17,38 +96,55 @@ func (r *GitRunner) Commit(ctx context.Context, message string) error {
 	return CommitWithContext(ctx, r.SiteID, message)
 }
 
-// CommitWithContext performs its package-specific operation.
+// CommitWithContext commits all changes with the configured author. Without message,
+// git.commit_message is rendered with the site key only.
 func CommitWithContext(ctx context.Context, siteID string, message string) error {
+	_, err := CommitChanges(ctx, siteID, message)
+	return err
+}
+
+// CommitChanges is CommitWithContext and reports whether a commit was created.
+func CommitChanges(ctx context.Context, siteID string, message string) (bool, error) {
 	siteID = strings.TrimSpace(siteID)
 	if siteID == "" {
-		return fmt.Errorf("site_id is required (use --site-id)")
+		return false, fmt.Errorf("site_id is required (use --site-id)")
 	}
 
 	workDir, _ := ResolveWorkdir(siteID)
 
 	// If nothing changed, do nothing.
-	status, err := gitcli.StatusPorcelain(ctx, workDir, 30*time.Second)
+	status, err := gitcli.StatusPorcelain(ctx, workDir, commandTimeout(ctx, 30*time.Second))
 	if err != nil {
-		return err
+		return false, err
 	}
 	if strings.TrimSpace(status) == "" {
 		fmt.Println("Nothing to commit.")
-		return nil
+		return false, nil
 	}
 
 	// Stage everything (including new files) and commit.
-	if err := gitcli.AddAll(ctx, workDir, 30*time.Second); err != nil {
-		return err
+	if err := gitcli.AddAll(ctx, workDir, commandTimeout(ctx, 30*time.Second)); err != nil {
+		return false, err
 	}
 
 	if strings.TrimSpace(message) == "" {
-		message = "Update generated content"
+		if message, err = CommitMessage(siteID, CommitMessageData{SiteKey: siteID}); err != nil {
+			return false, err
+		}
 	}
 
-	if err := gitcli.Commit(ctx, workDir, message, 30*time.Second); err != nil {
-		return err
+	gc := config.Cfg.CommentSites[siteID].Git
+	if err := gitcli.Commit(ctx, gitcli.CommitOptions{
+		RepoDir:     workDir,
+		Message:     message,
+		Timeout:     commandTimeout(ctx, 30*time.Second),
+		AuthorName:  gc.AuthorName,
+		AuthorEmail: gc.AuthorEmail,
+		Signing:     siteSigning(gc),
+	}); err != nil {
+		return false, err
 	}
 
 	fmt.Println("Commit created.")
-	return nil
+	return true, nil
 }
@@ -0,0 +1,39 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestCommitMessage(t *testing.T) {
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+
+	data := CommitMessageData{SiteKey: "blog", RunID: 7, CommentID: "c1", CommentAuthor: "Ada", PostPath: "posts/foo"}
+	cases := []struct {
+		tmpl string
+		want string
+	}{
+		{"", DefaultCommitMessage},
+		{"{{ if .CommentID }}{{ end }}", DefaultCommitMessage},
+		{"Comment by {{ .CommentAuthor }} on {{ .PostPath }} ({{ .SiteKey }}, run {{ .RunID }}, {{ .CommentID }})", "Comment by Ada on posts/foo (blog, run 7, c1)"},
+	}
+	for _, c := range cases {
+		config.Cfg = config.AppConfig{CommentSites: map[string]config.CommentsSiteConfig{
+			"blog": {Git: config.GitConfig{CommitMessage: c.tmpl}},
+		}}
+		got, err := CommitMessage("blog", data)
+		if err != nil {
+			t.Fatalf("CommitMessage(%q): %v", c.tmpl, err)
+		}
+		if got != c.want {
+			t.Errorf("CommitMessage(%q) = %q, want %q", c.tmpl, got, c.want)
+		}
+	}
+
+	config.Cfg.CommentSites["blog"] = config.CommentsSiteConfig{Git: config.GitConfig{CommitMessage: "{{ .Unknown }}"}}
+	if _, err := CommitMessage("blog", data); err == nil {
+		t.Error("CommitMessage with unknown field: want error")
+	}
+}
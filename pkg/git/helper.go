@@ -1,13 +1,49 @@
 ﻿package git
 
 import (
+	"context"
 	"fmt"
+	"net/url"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/gitcli"
 )
 
+// commandTimeout returns the time left until the deadline of ctx, so the step timeout of
+// a pipeline run applies to all git commands of the step. Without deadline it returns def.
+func commandTimeout(ctx context.Context, def time.Duration) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return def
+	}
+	// An expired context makes the command fail right away.
+	return max(time.Until(deadline), time.Millisecond)
+}
+
+// TokenUsername returns the user name sent with the access token of a repository:
+// the configured name, "oauth2" for GitLab (gitlab.com or provider gitlab), otherwise
+// the GitHub convention gitcli.DefaultTokenUsername.
+func TokenUsername(repoURL, configured, provider string) string {
+	if u := strings.TrimSpace(configured); u != "" {
+		return u
+	}
+	if strings.EqualFold(strings.TrimSpace(provider), ProviderGitLab) {
+		return "oauth2"
+	}
+	if u, err := url.Parse(strings.TrimSpace(repoURL)); err == nil && strings.EqualFold(u.Hostname(), "gitlab.com") {
+		return "oauth2"
+	}
+	return gitcli.DefaultTokenUsername
+}
+
+// siteTokenUsername returns the token user name of a site repository.
+func siteTokenUsername(gc config.GitConfig) string {
+	return TokenUsername(gc.RepoURL, gc.TokenUsername, gc.PullRequest.Provider)
+}
+
 // ResolveWorkdir performs its package-specific operation.
 func ResolveWorkdir(siteID string) (string, error) {
 	siteID = strings.TrimSpace(siteID)
@@ -0,0 +1,22 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestTokenUsername(t *testing.T) {
+	cases := []struct {
+		repoURL, configured, provider, want string
+	}{
+		{"https://github.com/acme/blog.git", "", "", "x-access-token"},
+		{"https://gitlab.com/acme/blog.git", "", "", "oauth2"},
+		{"https://git.example.org/acme/blog.git", "", "gitlab", "oauth2"},
+		{"https://gitea.example.org/acme/blog.git", "ada", "", "ada"},
+		{"https://gitlab.com/acme/blog.git", " bot ", "", "bot"},
+	}
+	for _, c := range cases {
+		if got := TokenUsername(c.repoURL, c.configured, c.provider); got != c.want {
+			t.Errorf("TokenUsername(%q, %q, %q) = %q, want %q", c.repoURL, c.configured, c.provider, got, c.want)
+		}
+	}
+}
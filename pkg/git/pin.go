@@ -0,0 +1,87 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/gitcli"
+)
+
+type pinOptions struct {
+	RepoDir       string
+	RepoURL       string
+	AccessToken   string
+	TokenUsername string
+	Revision      string
+	Depth         int
+
+	// Detach checks out the pinned revision (themes). Without it, HEAD is only
+	// verified to contain it (git.min_revision of site repositories).
+	Detach bool
+}
+
+// ensurePinnedRevision resolves the pinned tag or commit (fetching it if a shallow
+// clone does not contain it) and optionally checks it out. A detached checkout must
+// point to exactly that commit; a branch must only contain it, because the pipeline
+// commits and pushes on top of it.
+func ensurePinnedRevision(ctx context.Context, opts pinOptions) error {
+	rev := strings.TrimSpace(opts.Revision)
+	if rev == "" {
+		return nil
+	}
+
+	want, err := gitcli.RevParse(ctx, opts.RepoDir, rev, commandTimeout(ctx, 30*time.Second))
+	if err != nil {
+		if err := gitcli.Fetch(ctx, gitcli.FetchOptions{
+			RepoDir:       opts.RepoDir,
+			Ref:           rev,
+			Depth:         opts.Depth,
+			RepoURL:       opts.RepoURL,
+			AccessToken:   opts.AccessToken,
+			TokenUsername: opts.TokenUsername,
+			Timeout:       commandTimeout(ctx, 2*time.Minute),
+		}); err != nil {
+			return fmt.Errorf("pinned revision %q not found: %w", rev, err)
+		}
+		want, err = gitcli.RevParse(ctx, opts.RepoDir, "FETCH_HEAD", commandTimeout(ctx, 30*time.Second))
+		if err != nil {
+			return fmt.Errorf("pinned revision %q not found: %w", rev, err)
+		}
+	}
+
+	if opts.Detach {
+		if err := gitcli.CheckoutDetached(ctx, opts.RepoDir, want, commandTimeout(ctx, 30*time.Second)); err != nil {
+			return err
+		}
+	}
+
+	head, err := gitcli.RevParse(ctx, opts.RepoDir, "HEAD", commandTimeout(ctx, 30*time.Second))
+	if err != nil {
+		return err
+	}
+	if opts.Detach {
+		if head != want {
+			return fmt.Errorf("HEAD %s does not match pinned revision %q (%s)", shortHash(head), rev, shortHash(want))
+		}
+		return nil
+	}
+
+	contained, err := gitcli.IsAncestor(ctx, opts.RepoDir, want, head, commandTimeout(ctx, 30*time.Second))
+	if err != nil {
+		return err
+	}
+	if !contained {
+		return fmt.Errorf("HEAD %s does not contain pinned revision %q (%s); with a shallow clone, increase git.depth", shortHash(head), rev, shortHash(want))
+	}
+	return nil
+}
+
+// shortHash performs its package-specific operation.
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
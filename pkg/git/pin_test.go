@@ -0,0 +1,109 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/gitcli"
+)
+
+// gitT runs git for test setup and returns its trimmed output.
+func gitT(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.org",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.org",
+		"GIT_CONFIG_NOSYSTEM=1",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// TestPinnedBranchSurvivesPush sets a minimum revision on a site repo, pushes a
+// pipeline commit on top of it and checks out again: it is still contained in the branch.
+func TestPinnedBranchSurvivesPush(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	ctx := context.Background()
+	root := t.TempDir()
+	origin := filepath.Join(root, "origin.git")
+	gitT(t, root, "init", "--bare", "-b", "main", origin)
+	seed := filepath.Join(root, "seed")
+	gitT(t, root, "clone", origin, seed)
+	if err := os.WriteFile(filepath.Join(seed, "index.md"), []byte("hello\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitT(t, seed, "add", "-A")
+	gitT(t, seed, "commit", "-m", "initial")
+	gitT(t, seed, "push", "origin", "HEAD:main")
+	pin := gitT(t, seed, "rev-parse", "HEAD")
+
+	first := filepath.Join(root, "first")
+	gitT(t, root, "clone", origin, first)
+	if err := ensurePinnedRevision(ctx, pinOptions{RepoDir: first, Revision: pin}); err != nil {
+		t.Fatalf("pin after clone: %v", err)
+	}
+
+	// The pipeline commits generated comments on top of the pin and pushes them.
+	if err := os.WriteFile(filepath.Join(first, "comment.md"), []byte("comment\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitcli.AddAll(ctx, first, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitcli.Commit(ctx, gitcli.CommitOptions{RepoDir: first, Message: "Add comment", AuthorName: "fyndmark", AuthorEmail: "fyndmark@localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitcli.Push(ctx, gitcli.PushOptions{RepoDir: first}); err != nil {
+		t.Fatal(err)
+	}
+
+	second := filepath.Join(root, "second")
+	gitT(t, root, "clone", origin, second)
+	if head := gitT(t, second, "rev-parse", "HEAD"); head == pin {
+		t.Fatal("push did not move the branch")
+	}
+	if err := ensurePinnedRevision(ctx, pinOptions{RepoDir: second, Revision: pin}); err != nil {
+		t.Fatalf("pin after push: %v", err)
+	}
+
+	// Rewritten upstream history no longer contains the pin.
+	gitT(t, second, "checkout", "--orphan", "rewritten")
+	gitT(t, second, "commit", "-m", "rewritten")
+	err := ensurePinnedRevision(ctx, pinOptions{RepoDir: second, Revision: pin})
+	if err == nil || !strings.Contains(err.Error(), "does not contain") {
+		t.Fatalf("pin on rewritten history: err = %v", err)
+	}
+}
+
+// TestAuditConfigRevision rejects git.revision on site repositories, which cannot be
+// pinned, and accepts min_revision.
+func TestAuditConfigRevision(t *testing.T) {
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+
+	for _, gc := range []config.GitConfig{{Revision: "v1.0"}, {MinRevision: "v1.0"}} {
+		gc.RepoURL = "https://example.org/blog.git"
+		gc.CloneDir = filepath.Join(t.TempDir(), "blog")
+		config.Cfg = config.AppConfig{CommentSites: map[string]config.CommentsSiteConfig{"blog": {Git: gc}}}
+
+		err := AuditConfig()
+		if gc.Revision != "" && (err == nil || !strings.Contains(err.Error(), "git.revision is not supported")) {
+			t.Errorf("revision: err = %v, want rejection", err)
+		}
+		if gc.MinRevision != "" && err != nil {
+			t.Errorf("min_revision: unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/gitcli"
+	"github.com/geschke/fyndmark/pkg/runlog"
+	"github.com/geschke/fyndmark/pkg/secrets"
+)
+
+// Pull request providers of git.pull_request.provider.
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+// DefaultBranchPrefix is the prefix of run branches if git.pull_request.branch_prefix is unset.
+const DefaultBranchPrefix = "fyndmark/run-"
+
+// maxAPIErrorBytes limits the part of an API error response kept in the error.
+const maxAPIErrorBytes = 1024
+
+var branchPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]*$`)
+
+// PullRequest describes the pull request of a run.
+type PullRequest struct {
+	// Branch is the run branch pushed to the remote.
+	Branch string
+	Title  string
+	Body   string
+}
+
+// PullRequestsEnabled reports whether runs of a site open pull requests instead of
+// pushing to the site branch.
+func PullRequestsEnabled(gc config.GitConfig) bool {
+	return gc.PullRequest.Enabled
+}
+
+// BranchPrefix returns the effective prefix of run branches.
+func BranchPrefix(gc config.GitConfig) string {
+	if prefix := strings.TrimSpace(gc.PullRequest.BranchPrefix); prefix != "" {
+		return prefix
+	}
+	return DefaultBranchPrefix
+}
+
+// RunBranch returns the branch name of a pipeline run.
+func RunBranch(gc config.GitConfig, runID int64) string {
+	return fmt.Sprintf("%s%d", BranchPrefix(gc), runID)
+}
+
+// PullRequestAPI returns the provider, the API base URL and the project path
+// ("owner/repo") of a site repository.
+func PullRequestAPI(gc config.GitConfig) (provider, apiURL, project string, err error) {
+	u, err := url.Parse(strings.TrimSpace(gc.RepoURL))
+	if err != nil || u.Host == "" {
+		return "", "", "", fmt.Errorf("repo_url must be an absolute URL")
+	}
+	project = strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if !strings.Contains(project, "/") {
+		return "", "", "", fmt.Errorf("repo_url must contain the owner and repository name")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	provider = strings.ToLower(strings.TrimSpace(gc.PullRequest.Provider))
+	if provider == "" {
+		switch host {
+		case "github.com":
+			provider = ProviderGitHub
+		case "gitlab.com":
+			provider = ProviderGitLab
+		default:
+			return "", "", "", fmt.Errorf("provider must be set for host %q", host)
+		}
+	}
+
+	apiURL = strings.TrimRight(strings.TrimSpace(gc.PullRequest.APIURL), "/")
+	switch provider {
+	case ProviderGitHub:
+		if apiURL == "" && host == "github.com" {
+			apiURL = "https://api.github.com"
+		} else if apiURL == "" {
+			apiURL = "https://" + u.Host + "/api/v3"
+		}
+	case ProviderGitLab:
+		if apiURL == "" {
+			apiURL = "https://" + u.Host + "/api/v4"
+		}
+	default:
+		return "", "", "", fmt.Errorf("provider must be %s or %s, got %q", ProviderGitHub, ProviderGitLab, gc.PullRequest.Provider)
+	}
+	return provider, apiURL, project, nil
+}
+
+// auditPullRequest checks the pull request settings of a site.
+func auditPullRequest(gc config.GitConfig) error {
+	prefix := strings.TrimSpace(gc.PullRequest.BranchPrefix)
+	if !branchPrefixPattern.MatchString(prefix) || strings.Contains(prefix, "..") || strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("branch_prefix %q is not a valid branch name prefix", prefix)
+	}
+	if raw := strings.TrimSpace(gc.PullRequest.APIURL); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("api_url must be an http(s) URL")
+		}
+	}
+	if !gc.PullRequest.Enabled {
+		return nil
+	}
+	if strings.TrimSpace(gc.AccessToken) == "" {
+		return fmt.Errorf("requires git.access_token")
+	}
+	_, _, _, err := PullRequestAPI(gc)
+	return err
+}
+
+// PushPullRequest pushes HEAD to the run branch and opens a pull request against the
+// site branch. It returns the web URL of the pull request.
+func PushPullRequest(ctx context.Context, siteID string, pr PullRequest) (string, error) {
+	siteID = strings.TrimSpace(siteID)
+	siteCfg, ok := config.Cfg.CommentSites[siteID]
+	if !ok {
+		return "", fmt.Errorf("unknown site_id %q (not found in comment_sites)", siteID)
+	}
+	gc := siteCfg.Git
+	workDir, _ := ResolveWorkdir(siteID)
+
+	provider, apiURL, project, err := PullRequestAPI(gc)
+	if err != nil {
+		return "", fmt.Errorf("comment_sites.%s.git.pull_request: %w", siteID, err)
+	}
+	token, err := secrets.Decrypt(strings.TrimSpace(gc.AccessToken))
+	if err != nil {
+		return "", fmt.Errorf("access token: %w", err)
+	}
+
+	// The pull request targets the branch that was checked out.
+	base := strings.TrimSpace(gc.Branch)
+	if base == "" {
+		if base, err = gitcli.CurrentBranch(ctx, workDir, commandTimeout(ctx, 30*time.Second)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := gitcli.Push(ctx, gitcli.PushOptions{
+		RepoDir:       workDir,
+		Timeout:       commandTimeout(ctx, 2*time.Minute),
+		RepoURL:       strings.TrimSpace(gc.RepoURL),
+		AccessToken:   strings.TrimSpace(gc.AccessToken),
+		TokenUsername: siteTokenUsername(gc),
+		Branch:        pr.Branch,
+	}); err != nil {
+		return "", err
+	}
+	fmt.Printf("Pushed branch %s.\n", pr.Branch)
+
+	var (
+		endpoint string
+		payload  map[string]string
+		header   = http.Header{}
+	)
+	switch provider {
+	case ProviderGitHub:
+		endpoint = apiURL + "/repos/" + project + "/pulls"
+		payload = map[string]string{"title": pr.Title, "body": pr.Body, "head": pr.Branch, "base": base}
+		header.Set("Authorization", "Bearer "+token)
+		header.Set("Accept", "application/vnd.github+json")
+	case ProviderGitLab:
+		endpoint = apiURL + "/projects/" + url.PathEscape(project) + "/merge_requests"
+		payload = map[string]string{"title": pr.Title, "description": pr.Body, "source_branch": pr.Branch, "target_branch": base}
+		header.Set("PRIVATE-TOKEN", token)
+	}
+
+	var created struct {
+		HTMLURL string `json:"html_url"` // GitHub
+		WebURL  string `json:"web_url"`  // GitLab
+	}
+	if err := postJSON(ctx, endpoint, header, payload, &created); err != nil {
+		return "", fmt.Errorf("open pull request: %s", strings.ReplaceAll(err.Error(), token, "<access_token>"))
+	}
+	if created.HTMLURL != "" {
+		return created.HTMLURL, nil
+	}
+	return created.WebURL, nil
+}
+
+// postJSON posts payload as JSON and decodes a 2xx response into out.
+func postJSON(ctx context.Context, endpoint string, header http.Header, payload any, out any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fyndmark-pipeline")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxAPIErrorBytes))
+		return fmt.Errorf("%s responded %s: %s", endpoint, resp.Status, runlog.Redact(strings.TrimSpace(string(body))))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
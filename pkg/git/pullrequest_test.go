@@ -0,0 +1,168 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestPullRequestAPI(t *testing.T) {
+	cases := []struct {
+		gc                        config.GitConfig
+		provider, apiURL, project string
+	}{
+		{config.GitConfig{RepoURL: "https://github.com/acme/blog.git"}, ProviderGitHub, "https://api.github.com", "acme/blog"},
+		{config.GitConfig{RepoURL: "https://gitlab.com/acme/sites/blog"}, ProviderGitLab, "https://gitlab.com/api/v4", "acme/sites/blog"},
+		{config.GitConfig{RepoURL: "https://git.example.org/acme/blog.git", PullRequest: config.GitPullRequestConfig{Provider: "github"}}, ProviderGitHub, "https://git.example.org/api/v3", "acme/blog"},
+		{config.GitConfig{RepoURL: "https://git.example.org/acme/blog.git", PullRequest: config.GitPullRequestConfig{Provider: "gitlab", APIURL: "https://api.example.org/v4/"}}, ProviderGitLab, "https://api.example.org/v4", "acme/blog"},
+	}
+	for _, c := range cases {
+		provider, apiURL, project, err := PullRequestAPI(c.gc)
+		if err != nil {
+			t.Fatalf("PullRequestAPI(%q): %v", c.gc.RepoURL, err)
+		}
+		if provider != c.provider || apiURL != c.apiURL || project != c.project {
+			t.Errorf("PullRequestAPI(%q) = %q, %q, %q, want %q, %q, %q", c.gc.RepoURL, provider, apiURL, project, c.provider, c.apiURL, c.project)
+		}
+	}
+
+	if _, _, _, err := PullRequestAPI(config.GitConfig{RepoURL: "https://git.example.org/acme/blog.git"}); err == nil {
+		t.Error("unknown host without provider: want error")
+	}
+	if got := RunBranch(config.GitConfig{}, 42); got != DefaultBranchPrefix+"42" {
+		t.Errorf("RunBranch = %q", got)
+	}
+}
+
+func TestPushPullRequest(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+	ctx := context.Background()
+	const token = "ghp_t0k3n"
+
+	cases := []struct {
+		name     string
+		repoURL  string
+		provider string
+		branch   string
+		// path is the escaped request path of the API call.
+		path    string
+		check   func(r *http.Request, body map[string]string) error
+		status  int
+		reply   string
+		wantURL string
+		wantErr string
+	}{
+		{
+			name: "github", repoURL: "https://github.com/acme/blog.git", provider: ProviderGitHub, branch: "main",
+			path: "/repos/acme/blog/pulls",
+			check: func(r *http.Request, body map[string]string) error {
+				if r.Header.Get("Authorization") != "Bearer "+token || r.Header.Get("Accept") != "application/vnd.github+json" {
+					return fmt.Errorf("headers %v", r.Header)
+				}
+				want := map[string]string{"title": "New comment", "body": "Run 7", "head": "fyndmark/run-7", "base": "main"}
+				if !reflect.DeepEqual(body, want) {
+					return fmt.Errorf("body %v", body)
+				}
+				return nil
+			},
+			status: http.StatusCreated, reply: `{"html_url":"https://github.com/acme/blog/pull/1"}`,
+			wantURL: "https://github.com/acme/blog/pull/1",
+		},
+		{
+			// Without git.branch the pull request targets the checked out branch.
+			name: "gitlab", repoURL: "https://gitlab.com/acme/sites/blog.git", provider: ProviderGitLab,
+			path: "/projects/acme%2Fsites%2Fblog/merge_requests",
+			check: func(r *http.Request, body map[string]string) error {
+				if r.Header.Get("PRIVATE-TOKEN") != token || r.Header.Get("Authorization") != "" {
+					return fmt.Errorf("headers %v", r.Header)
+				}
+				want := map[string]string{"title": "New comment", "description": "Run 7", "source_branch": "fyndmark/run-7", "target_branch": "main"}
+				if !reflect.DeepEqual(body, want) {
+					return fmt.Errorf("body %v", body)
+				}
+				return nil
+			},
+			status: http.StatusCreated, reply: `{"web_url":"https://gitlab.com/acme/sites/blog/-/merge_requests/1"}`,
+			wantURL: "https://gitlab.com/acme/sites/blog/-/merge_requests/1",
+		},
+		{
+			name: "api error", repoURL: "https://github.com/acme/blog.git", provider: ProviderGitHub, branch: "main",
+			path:   "/repos/acme/blog/pulls",
+			status: http.StatusUnprocessableEntity, reply: `{"message":"Validation Failed for ` + token + `"}`,
+			wantErr: "422 Unprocessable Entity",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("decode request: %v", err)
+				}
+				if r.Method != http.MethodPost || r.URL.EscapedPath() != c.path || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("request %s %s (%s)", r.Method, r.URL.EscapedPath(), r.Header.Get("Content-Type"))
+				}
+				if c.check != nil {
+					if err := c.check(r, body); err != nil {
+						t.Errorf("request: %v", err)
+					}
+				}
+				w.WriteHeader(c.status)
+				_, _ = w.Write([]byte(c.reply))
+			}))
+			defer srv.Close()
+
+			root := t.TempDir()
+			origin := filepath.Join(root, "origin.git")
+			gitT(t, root, "init", "--bare", "-b", "main", origin)
+			work := filepath.Join(root, "work")
+			gitT(t, root, "clone", origin, work)
+			writeAndCommit(t, work, "comment.md", "Add comment")
+			// The push with the token in the URL goes to the local origin instead.
+			pushURL := "https://" + TokenUsername(c.repoURL, "", c.provider) + ":" + token + "@" + strings.TrimPrefix(c.repoURL, "https://")
+			gitT(t, work, "config", "url."+origin+".insteadOf", pushURL)
+
+			config.Cfg = config.AppConfig{CommentSites: map[string]config.CommentsSiteConfig{
+				"blog": {Git: config.GitConfig{
+					RepoURL:     c.repoURL,
+					CloneDir:    work,
+					Branch:      c.branch,
+					AccessToken: token,
+					PullRequest: config.GitPullRequestConfig{Enabled: true, Provider: c.provider, APIURL: srv.URL},
+				}},
+			}}
+			got, err := PushPullRequest(ctx, "blog", PullRequest{Branch: RunBranch(config.GitConfig{}, 7), Title: "New comment", Body: "Run 7"})
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Fatalf("err = %v, want %q", err, c.wantErr)
+				}
+				if strings.Contains(err.Error(), token) {
+					t.Fatalf("err %q contains the access token", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.wantURL {
+				t.Fatalf("URL = %q, want %q", got, c.wantURL)
+			}
+			if head, pushed := gitT(t, work, "rev-parse", "HEAD"), gitT(t, root, "--git-dir", origin, "rev-parse", "fyndmark/run-7"); pushed != head {
+				t.Fatalf("run branch = %s, want %s", pushed, head)
+			}
+		})
+	}
+}
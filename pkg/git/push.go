@@ -2,13 +2,26 @@
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/geschke/fyndmark/config"
 	"github.com/geschke/fyndmark/pkg/gitcli"
 )
 
+// DefaultPushRetries is the number of rebase-and-retry attempts if git.push_retries is unset.
+const DefaultPushRetries = 3
+
+// PushRetries returns how often a rejected push is retried after rebasing.
+func PushRetries(gc config.GitConfig) int {
+	if gc.PushRetries == nil {
+		return DefaultPushRetries
+	}
+	return max(*gc.PushRetries, 0)
+}
+
 // Push performs its package-specific operation.
 func (r *GitRunner) Push(ctx context.Context) error {
 	if r == nil {
@@ -24,12 +37,64 @@ func PushWithContext(ctx context.Context, siteID string) error {
 		return fmt.Errorf("site_id is required (use --site-id)")
 	}
 
+	siteCfg, ok := config.Cfg.CommentSites[siteID]
+	if !ok {
+		return fmt.Errorf("unknown site_id %q (not found in comment_sites)", siteID)
+	}
+
 	workDir, _ := ResolveWorkdir(siteID)
+	gc := siteCfg.Git
+	retries := PushRetries(gc)
 
-	if err := gitcli.Push(ctx, workDir, 2*time.Minute); err != nil {
-		return err
+	for attempt := 0; ; attempt++ {
+		err := gitcli.Push(ctx, gitcli.PushOptions{
+			RepoDir:       workDir,
+			Timeout:       commandTimeout(ctx, 2*time.Minute),
+			RepoURL:       strings.TrimSpace(gc.RepoURL),
+			AccessToken:   strings.TrimSpace(gc.AccessToken),
+			TokenUsername: siteTokenUsername(gc),
+		})
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, gitcli.ErrPushRejected) || attempt >= retries {
+			return err
+		}
+
+		fmt.Printf("Push rejected, rebasing onto the remote branch (retry %d of %d).\n", attempt+1, retries)
+		if err := pullRebase(ctx, workDir, gc); err != nil {
+			return fmt.Errorf("rebase after rejected push: %w", err)
+		}
 	}
 
 	fmt.Println("Push completed.")
 	return nil
 }
+
+// pullRebase fetches the remote branch and rebases the local commits onto it.
+func pullRebase(ctx context.Context, workDir string, gc config.GitConfig) error {
+	// An empty branch fetches the default branch of the remote. The fetch is not
+	// limited by depth, so it reaches back to the commits of the shallow clone.
+	ref := strings.TrimSpace(gc.Branch)
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := gitcli.Fetch(ctx, gitcli.FetchOptions{
+		RepoDir:       workDir,
+		Ref:           ref,
+		RepoURL:       strings.TrimSpace(gc.RepoURL),
+		AccessToken:   strings.TrimSpace(gc.AccessToken),
+		TokenUsername: siteTokenUsername(gc),
+		Timeout:       commandTimeout(ctx, 2*time.Minute),
+	}); err != nil {
+		return err
+	}
+	return gitcli.Rebase(ctx, gitcli.RebaseOptions{
+		RepoDir:        workDir,
+		Onto:           "FETCH_HEAD",
+		Timeout:        commandTimeout(ctx, 30*time.Second),
+		CommitterName:  gc.AuthorName,
+		CommitterEmail: gc.AuthorEmail,
+		Signing:        siteSigning(gc),
+	})
+}
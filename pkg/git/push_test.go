@@ -0,0 +1,95 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/gitcli"
+)
+
+func TestPushRetries(t *testing.T) {
+	n := func(v int) *int { return &v }
+	cases := []struct {
+		gc   config.GitConfig
+		want int
+	}{
+		{config.GitConfig{}, DefaultPushRetries},
+		{config.GitConfig{PushRetries: n(0)}, 0},
+		{config.GitConfig{PushRetries: n(5)}, 5},
+		{config.GitConfig{PushRetries: n(5), MinRevision: "v1.0"}, 5},
+	}
+	for _, c := range cases {
+		if got := PushRetries(c.gc); got != c.want {
+			t.Errorf("PushRetries(%+v) = %d, want %d", c.gc, got, c.want)
+		}
+	}
+}
+
+// TestPushRebasesRejectedPush lets another clone push to the site branch after the
+// pipeline committed: the push is rejected, rebased onto the remote branch and retried.
+func TestPushRebasesRejectedPush(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+	ctx := context.Background()
+
+	for _, retries := range []int{1, 0} {
+		root := t.TempDir()
+		origin := filepath.Join(root, "origin.git")
+		gitT(t, root, "init", "--bare", "-b", "main", origin)
+		seed := filepath.Join(root, "seed")
+		gitT(t, root, "clone", origin, seed)
+		writeAndCommit(t, seed, "index.md", "initial")
+		gitT(t, seed, "push", "origin", "HEAD:main")
+
+		work := filepath.Join(root, "work")
+		gitT(t, root, "clone", origin, work)
+		writeAndCommit(t, work, "comment.md", "Add comment")
+
+		// Someone else pushes to the branch in the meantime.
+		writeAndCommit(t, seed, "post.md", "Add post")
+		gitT(t, seed, "push", "origin", "HEAD:main")
+
+		config.Cfg = config.AppConfig{CommentSites: map[string]config.CommentsSiteConfig{
+			"blog": {Git: config.GitConfig{
+				RepoURL:     origin,
+				CloneDir:    work,
+				Branch:      "main",
+				AuthorName:  "fyndmark",
+				AuthorEmail: "fyndmark@localhost",
+				PushRetries: &retries,
+			}},
+		}}
+		err := PushWithContext(ctx, "blog")
+		if retries == 0 {
+			if !errors.Is(err, gitcli.ErrPushRejected) {
+				t.Fatalf("push without retries: err = %v, want ErrPushRejected", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("push with retries: %v", err)
+		}
+		log := gitT(t, root, "--git-dir", origin, "log", "--format=%s", "main")
+		if log != "Add comment\nAdd post\ninitial" {
+			t.Fatalf("origin history = %q, want the comment rebased onto the post", log)
+		}
+	}
+}
+
+// writeAndCommit writes name into dir and commits it with message.
+func writeAndCommit(t *testing.T, dir, name, message string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(message+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitT(t, dir, "add", "-A")
+	gitT(t, dir, "commit", "-m", message)
+}
@@ -10,9 +10,14 @@ import (
 
 	"github.com/geschke/fyndmark/config"
 	"github.com/geschke/fyndmark/pkg/gitcli"
+	"github.com/geschke/fyndmark/pkg/runlog"
+	"github.com/geschke/fyndmark/pkg/sanitize"
 )
 
-// ensureThemes performs its package-specific operation.
+// ensureThemes clones the configured themes into the working copy, or updates theme
+// clones left from a previous run (see checkout_mode fetch). Theme directories that
+// are not clones, e.g. tracked in the site repository or submodules, are left alone.
+// The checked out version of every theme is written to the run log.
 func ensureThemes(ctx context.Context, siteID string, workDir string) error {
 	siteCfg, ok := config.Cfg.CommentSites[siteID]
 	if !ok {
@@ -41,39 +46,152 @@ func ensureThemes(ctx context.Context, siteID string, workDir string) error {
 		}
 
 		targetAbs := filepath.Join(workDir, targetRelClean)
+		name := strings.TrimSpace(t.Name)
+		if name == "" {
+			name = repoURL
+		}
 
-		// If the directory already exists, assume it's present and skip.
-		if existsDir(targetAbs) {
+		cloned := existsDir(filepath.Join(targetAbs, ".git"))
+		if !cloned && existsDir(targetAbs) {
+			runlog.Printf(ctx, "Theme %q: %s exists and is not a theme clone, leaving it unchanged.\n", name, targetRel)
 			continue
 		}
 
-		// Ensure parent directory exists.
-		if err := os.MkdirAll(filepath.Dir(targetAbs), 0o755); err != nil {
-			return fmt.Errorf("failed to create theme parent dir for %q: %w", targetAbs, err)
+		if cloned {
+			if err := updateTheme(ctx, t, targetAbs); err != nil {
+				runlog.Printf(ctx, "Updating theme %q failed, cloning again: %v\n", name, err)
+				if err := os.RemoveAll(targetAbs); err != nil {
+					return fmt.Errorf("remove theme dir %q: %w", targetRel, err)
+				}
+				cloned = false
+			}
 		}
 
-		fmt.Printf("Cloning theme into: %s\n", targetAbs)
+		if !cloned {
+			if err := cloneTheme(ctx, t, targetAbs); err != nil {
+				return fmt.Errorf("failed to clone theme %q: %w", name, err)
+			}
+		}
 
-		if err := gitcli.Clone(ctx, gitcli.CloneOptions{
-			RepoURL:     repoURL,
-			Branch:      strings.TrimSpace(t.Branch),
-			AccessToken: strings.TrimSpace(t.AccessToken),
-			TargetDir:   targetAbs,
-			Depth:       t.Depth,
-			Timeout:     2 * time.Minute,
-			// RecurseSubmodules intentionally not applied to theme clones by default.
+		// Check out the pinned tag or commit (optional).
+		if err := ensurePinnedRevision(ctx, pinOptions{
+			RepoDir:       targetAbs,
+			RepoURL:       repoURL,
+			AccessToken:   strings.TrimSpace(t.AccessToken),
+			TokenUsername: TokenUsername(repoURL, t.TokenUsername, ""),
+			Revision:      t.Revision,
+			Depth:         t.Depth,
+			Detach:        true,
 		}); err != nil {
-			name := strings.TrimSpace(t.Name)
-			if name == "" {
-				name = repoURL
+			return fmt.Errorf("theme %q: %w", name, err)
+		}
+
+		// Submodules of the pinned commit; without pin, clone and update already did it.
+		if strings.TrimSpace(t.Revision) != "" && t.RecurseSubmodules {
+			if err := gitcli.ResetToRef(ctx, gitcli.ResetOptions{
+				RepoDir:           targetAbs,
+				Ref:               "HEAD",
+				Timeout:           commandTimeout(ctx, 2*time.Minute),
+				RecurseSubmodules: true,
+			}); err != nil {
+				return fmt.Errorf("theme %q: %w", name, err)
 			}
-			return fmt.Errorf("failed to clone theme %q: %w", name, err)
 		}
+
+		head, err := gitcli.RevParse(ctx, targetAbs, "HEAD", commandTimeout(ctx, 30*time.Second))
+		if err != nil {
+			return fmt.Errorf("theme %q: %w", name, err)
+		}
+		runlog.Printf(ctx, "Theme %q at %s (%s).\n", name, shortHash(head), themeRef(t))
 	}
 
 	return nil
 }
 
+// cloneTheme clones a theme into targetAbs.
+func cloneTheme(ctx context.Context, t config.GitThemeConfig, targetAbs string) error {
+	// Ensure parent directory exists.
+	if err := os.MkdirAll(filepath.Dir(targetAbs), 0o755); err != nil {
+		return fmt.Errorf("failed to create theme parent dir for %q: %w", targetAbs, err)
+	}
+
+	fmt.Printf("Cloning theme into: %s\n", targetAbs)
+
+	repoURL := strings.TrimSpace(t.RepoURL)
+	return gitcli.Clone(ctx, gitcli.CloneOptions{
+		RepoURL:           repoURL,
+		Branch:            strings.TrimSpace(t.Branch),
+		AccessToken:       strings.TrimSpace(t.AccessToken),
+		TokenUsername:     TokenUsername(repoURL, t.TokenUsername, ""),
+		TargetDir:         targetAbs,
+		Depth:             t.Depth,
+		Timeout:           commandTimeout(ctx, 2*time.Minute),
+		RecurseSubmodules: t.RecurseSubmodules,
+	})
+}
+
+// updateTheme brings an existing theme clone to the head of the remote branch, like
+// updateWorkdir for the site. With a pinned revision, local changes are discarded and
+// ensurePinnedRevision checks out the pin afterwards.
+// It fails if origin no longer matches the theme's repo_url, so the caller clones again.
+func updateTheme(ctx context.Context, t config.GitThemeConfig, targetAbs string) error {
+	repoURL := strings.TrimSpace(t.RepoURL)
+	origin, err := gitcli.RemoteURL(ctx, targetAbs, commandTimeout(ctx, 30*time.Second))
+	if err != nil {
+		return err
+	}
+	if origin != repoURL {
+		return fmt.Errorf("origin of %q does not match repo_url", targetAbs)
+	}
+
+	fmt.Printf("Updating theme in: %s\n", targetAbs)
+
+	if strings.TrimSpace(t.Revision) != "" {
+		return gitcli.ResetToRef(ctx, gitcli.ResetOptions{
+			RepoDir: targetAbs,
+			Ref:     "HEAD",
+			Timeout: commandTimeout(ctx, 2*time.Minute),
+		})
+	}
+
+	// An empty branch fetches the default branch of the remote.
+	branch := strings.TrimSpace(t.Branch)
+	ref := branch
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := gitcli.Fetch(ctx, gitcli.FetchOptions{
+		RepoDir:       targetAbs,
+		Ref:           ref,
+		Depth:         t.Depth,
+		RepoURL:       repoURL,
+		AccessToken:   strings.TrimSpace(t.AccessToken),
+		TokenUsername: TokenUsername(repoURL, t.TokenUsername, ""),
+		Timeout:       commandTimeout(ctx, 2*time.Minute),
+	}); err != nil {
+		return err
+	}
+
+	return gitcli.ResetToRef(ctx, gitcli.ResetOptions{
+		RepoDir:           targetAbs,
+		Ref:               "FETCH_HEAD",
+		Branch:            branch,
+		Timeout:           commandTimeout(ctx, 2*time.Minute),
+		RecurseSubmodules: t.RecurseSubmodules,
+	})
+}
+
+// themeRef describes the configured version of a theme for the run log.
+func themeRef(t config.GitThemeConfig) string {
+	if rev := strings.TrimSpace(t.Revision); rev != "" {
+		return "revision " + rev
+	}
+	if branch := strings.TrimSpace(t.Branch); branch != "" {
+		return "branch " + branch
+	}
+	return "default branch"
+}
+
 // existsDir performs its package-specific operation.
 func existsDir(path string) bool {
 	st, err := os.Stat(path)
@@ -83,25 +201,12 @@ func existsDir(path string) bool {
 	return st.IsDir()
 }
 
-// sanitizeRelativePath performs its package-specific operation.
+// sanitizeRelativePath validates a path relative to the repository and returns it
+// in OS-specific form.
 func sanitizeRelativePath(p string) (string, error) {
-	// Reject absolute paths.
-	if filepath.IsAbs(p) {
-		return "", fmt.Errorf("absolute paths are not allowed")
-	}
-
-	clean := filepath.Clean(p)
-
-	// Reject anything that escapes the repo (../...).
-	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
-		return "", fmt.Errorf("path escapes repository (.. is not allowed)")
-	}
-
-	// Normalize "./x" -> "x"
-	clean = strings.TrimPrefix(clean, "."+string(filepath.Separator))
-	if clean == "." || clean == "" {
-		return "", fmt.Errorf("invalid relative path")
+	clean, err := sanitize.RelativePath(p)
+	if err != nil {
+		return "", err
 	}
-
-	return clean, nil
+	return filepath.FromSlash(clean), nil
 }
@@ -0,0 +1,36 @@
+package git
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestSanitizeRelativePathUsesOSSeparator(t *testing.T) {
+	for _, in := range []string{"themes/foo", `themes\foo`} {
+		got, err := sanitizeRelativePath(in)
+		if err != nil {
+			t.Fatalf("sanitizeRelativePath(%q): %v", in, err)
+		}
+		if want := filepath.Join("themes", "foo"); got != want {
+			t.Errorf("sanitizeRelativePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestThemeRef(t *testing.T) {
+	cases := []struct {
+		theme config.GitThemeConfig
+		want  string
+	}{
+		{config.GitThemeConfig{}, "default branch"},
+		{config.GitThemeConfig{Branch: "main"}, "branch main"},
+		{config.GitThemeConfig{Branch: "main", Revision: "v1.2.0"}, "revision v1.2.0"},
+	}
+	for _, c := range cases {
+		if got := themeRef(c.theme); got != c.want {
+			t.Errorf("themeRef(%+v) = %q, want %q", c.theme, got, c.want)
+		}
+	}
+}
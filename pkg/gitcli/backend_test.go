@@ -0,0 +1,210 @@
+package gitcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/runlog"
+)
+
+// gitT runs the git binary for test setup and returns its trimmed output.
+func gitT(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.org",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.org",
+		"GIT_CONFIG_NOSYSTEM=1",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// writeFile writes a file below dir, creating its directories.
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commitAll stages and commits all changes with the functions under test.
+func commitAll(t *testing.T, ctx context.Context, dir, msg string) {
+	t.Helper()
+	if err := AddAll(ctx, dir, 0); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := Commit(ctx, CommitOptions{RepoDir: dir, Message: msg, AuthorName: "fyndmark", AuthorEmail: "fyndmark@localhost"}); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+// TestBackends runs clone, commit, push, fetch and rebase through the exec and the
+// go-git backend against a local origin.
+func TestBackends(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	for _, backend := range []string{BackendExec, BackendGoGit} {
+		t.Run(backend, func(t *testing.T) {
+			oldCfg := config.Cfg
+			t.Cleanup(func() { config.Cfg = oldCfg })
+			config.Cfg.Workspace.GitBackend = backend
+
+			ctx := context.Background()
+			root := t.TempDir()
+			origin := filepath.Join(root, "origin.git")
+			gitT(t, root, "init", "--bare", "-b", "main", origin)
+			seed := filepath.Join(root, "seed")
+			gitT(t, root, "clone", origin, seed)
+			writeFile(t, seed, "index.md", "hello\n")
+			writeFile(t, seed, "content/post.md", "post\n")
+			gitT(t, seed, "add", "-A")
+			gitT(t, seed, "commit", "-m", "initial")
+			gitT(t, seed, "push", "origin", "HEAD:main")
+
+			// Clone
+			work := filepath.Join(root, "work")
+			if err := Clone(ctx, CloneOptions{RepoURL: origin, Branch: "main", TargetDir: work}); err != nil {
+				t.Fatalf("clone: %v", err)
+			}
+			if branch, err := CurrentBranch(ctx, work, 0); err != nil || branch != "main" {
+				t.Fatalf("current branch = %q, %v", branch, err)
+			}
+			if u, err := RemoteURL(ctx, work, 0); err != nil || u != origin {
+				t.Fatalf("remote url = %q, %v", u, err)
+			}
+			if head, err := RevParse(ctx, work, "HEAD", 0); err != nil || head != gitT(t, origin, "rev-parse", "main") {
+				t.Fatalf("rev-parse HEAD = %q, %v", head, err)
+			}
+
+			// Commit
+			writeFile(t, work, "comments/c1.md", "first\n")
+			if err := os.Remove(filepath.Join(work, "content", "post.md")); err != nil {
+				t.Fatal(err)
+			}
+			if st, err := StatusPorcelain(ctx, work, 0); err != nil || st == "" {
+				t.Fatalf("status of dirty tree = %q, %v", st, err)
+			}
+			commitAll(t, ctx, work, "Add comment c1")
+			if st, err := StatusPorcelain(ctx, work, 0); err != nil || st != "" {
+				t.Fatalf("status after commit = %q, %v", st, err)
+			}
+			if author := gitT(t, work, "log", "-1", "--format=%an <%ae>"); author != "fyndmark <fyndmark@localhost>" {
+				t.Fatalf("author = %q", author)
+			}
+			if files := gitT(t, work, "show", "--name-status", "--format=", "HEAD"); files != "A\tcomments/c1.md\nD\tcontent/post.md" {
+				t.Fatalf("committed changes:\n%s", files)
+			}
+
+			// Push
+			if err := Push(ctx, PushOptions{RepoDir: work}); err != nil {
+				t.Fatalf("push: %v", err)
+			}
+			local, _ := RevParse(ctx, work, "HEAD", 0)
+			if remote := gitT(t, origin, "rev-parse", "main"); remote != local {
+				t.Fatalf("origin main = %s, want %s", remote, local)
+			}
+
+			// Someone else pushes first: the push is rejected.
+			gitT(t, seed, "pull", "--ff-only", "origin", "main")
+			writeFile(t, seed, "index.md", "hello, world\n")
+			gitT(t, seed, "commit", "-am", "Edit index")
+			gitT(t, seed, "push", "origin", "HEAD:main")
+			writeFile(t, work, "comments/c2.md", "second\n")
+			commitAll(t, ctx, work, "Add comment c2")
+			if err := Push(ctx, PushOptions{RepoDir: work}); !errors.Is(err, ErrPushRejected) {
+				t.Fatalf("push behind origin: err = %v, want ErrPushRejected", err)
+			}
+
+			// Fetch and rebase, then the push succeeds.
+			if err := Fetch(ctx, FetchOptions{RepoDir: work, Ref: "main"}); err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+			if fetched, err := RevParse(ctx, work, "FETCH_HEAD", 0); err != nil || fetched != gitT(t, origin, "rev-parse", "main") {
+				t.Fatalf("FETCH_HEAD = %q, %v", fetched, err)
+			}
+			if err := Rebase(ctx, RebaseOptions{RepoDir: work, Onto: "FETCH_HEAD", CommitterName: "fyndmark", CommitterEmail: "fyndmark@localhost"}); err != nil {
+				t.Fatalf("rebase: %v", err)
+			}
+			if ok, err := IsAncestor(ctx, work, "FETCH_HEAD", "HEAD", 0); err != nil || !ok {
+				t.Fatalf("FETCH_HEAD is not an ancestor after rebase: %v", err)
+			}
+			if msg := gitT(t, work, "log", "-1", "--format=%s"); msg != "Add comment c2" {
+				t.Fatalf("rebased commit = %q", msg)
+			}
+			if err := Push(ctx, PushOptions{RepoDir: work}); err != nil {
+				t.Fatalf("push after rebase: %v", err)
+			}
+			if log := gitT(t, origin, "log", "--format=%s", "main"); log != "Add comment c2\nEdit index\nAdd comment c1\ninitial" {
+				t.Fatalf("origin history:\n%s", log)
+			}
+
+			// A conflicting rebase fails and leaves the branch unchanged.
+			gitT(t, seed, "pull", "--ff-only", "origin", "main")
+			writeFile(t, seed, "index.md", "theirs\n")
+			gitT(t, seed, "commit", "-am", "Their edit")
+			gitT(t, seed, "push", "origin", "HEAD:main")
+			writeFile(t, work, "index.md", "ours\n")
+			commitAll(t, ctx, work, "Our edit")
+			before, _ := RevParse(ctx, work, "HEAD", 0)
+			if err := Fetch(ctx, FetchOptions{RepoDir: work, Ref: "main"}); err != nil {
+				t.Fatalf("fetch: %v", err)
+			}
+			if err := Rebase(ctx, RebaseOptions{RepoDir: work, Onto: "FETCH_HEAD"}); err == nil {
+				t.Fatal("conflicting rebase succeeded")
+			}
+			if after, _ := RevParse(ctx, work, "HEAD", 0); after != before {
+				t.Fatalf("HEAD after failed rebase = %s, want %s", after, before)
+			}
+			if st, err := StatusPorcelain(ctx, work, 0); err != nil || st != "" {
+				t.Fatalf("status after failed rebase = %q, %v", st, err)
+			}
+		})
+	}
+}
+
+// TestRunGitReturnsFullOutput checks that output beyond the log tail limit still
+// reaches the caller: only the logged copy is truncated.
+func TestRunGitReturnsFullOutput(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.Workspace.GitBackend = BackendExec
+
+	dir := t.TempDir()
+	gitT(t, dir, "init", "-b", "main", dir)
+	const files = 3000
+	for i := 0; i < files; i++ {
+		writeFile(t, dir, fmt.Sprintf("comment-%05d-with-a-long-file-name.md", i), "x\n")
+	}
+
+	st, err := StatusPorcelain(context.Background(), dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st) <= runlog.DefaultTailLimit {
+		t.Fatalf("status output has %d bytes, want more than the tail limit %d", len(st), runlog.DefaultTailLimit)
+	}
+	lines := strings.Split(strings.TrimSpace(st), "\n")
+	if len(lines) != files || lines[0] != "?? comment-00000-with-a-long-file-name.md" || strings.Contains(st, "omitted") {
+		t.Fatalf("status has %d lines, first %q", len(lines), lines[0])
+	}
+}
@@ -0,0 +1,640 @@
+package gitcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/runlog"
+	"github.com/geschke/fyndmark/pkg/secrets"
+	gogit "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// Author used for commits of the go-git backend if user.name/user.email are neither
+// given nor set in the global git config.
+const (
+	defaultAuthorName  = "fyndmark"
+	defaultAuthorEmail = "fyndmark@localhost"
+)
+
+// fetchHeadRef mirrors the FETCH_HEAD written by git fetch.
+const fetchHeadRef = plumbing.ReferenceName("FETCH_HEAD")
+
+// goGitAuth returns the HTTPS auth for a token, nil without token. Like the exec
+// backend, tokens are only sent to https URLs.
+func goGitAuth(repoURL string, username string, encryptedToken string) (transport.AuthMethod, error) {
+	token, err := secrets.Decrypt(encryptedToken)
+	if err != nil {
+		return nil, fmt.Errorf("access token: %w", err)
+	}
+	if strings.TrimSpace(token) == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(strings.TrimSpace(repoURL), "https://") {
+		return nil, fmt.Errorf("only https repo URLs are supported for token auth: %q", repoURL)
+	}
+	return &githttp.BasicAuth{Username: tokenUsername(username), Password: token}, nil
+}
+
+// goGitClone implements Clone with go-git. The token is passed as auth, so origin
+// never contains it.
+func goGitClone(ctx context.Context, opts CloneOptions) error {
+	auth, err := goGitAuth(opts.RepoURL, opts.TokenUsername, opts.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	out := runlog.NewCapture(ctx, 0)
+	defer out.Close()
+
+	co := &gogit.CloneOptions{
+		URL:      strings.TrimSpace(opts.RepoURL),
+		Auth:     auth,
+		Depth:    max(opts.Depth, 0),
+		Progress: out,
+	}
+	if branch := strings.TrimSpace(opts.Branch); branch != "" {
+		co.ReferenceName = plumbing.NewBranchReferenceName(branch)
+		co.SingleBranch = true
+	}
+	if opts.RecurseSubmodules {
+		co.RecurseSubmodules = gogit.DefaultSubmoduleRecursionDepth
+	}
+
+	if _, err := gogit.PlainCloneContext(ctx, opts.TargetDir, false, co); err != nil {
+		return fmt.Errorf("git clone failed: %w: %s", err, out.Tail())
+	}
+	return nil
+}
+
+// goGitStatusPorcelain implements StatusPorcelain with go-git.
+func goGitStatusPorcelain(repoDir string) (string, error) {
+	_, wt, err := goGitOpen(repoDir)
+	if err != nil {
+		return "", err
+	}
+	st, err := wt.Status()
+	if err != nil {
+		return "", fmt.Errorf("git status failed: %w", err)
+	}
+	if st.IsClean() {
+		return "", nil
+	}
+	return st.String(), nil
+}
+
+// goGitAddAll implements AddAll with go-git: new and modified files are added,
+// deleted files are removed from the index.
+func goGitAddAll(repoDir string) error {
+	_, wt, err := goGitOpen(repoDir)
+	if err != nil {
+		return err
+	}
+	st, err := wt.Status()
+	if err != nil {
+		return fmt.Errorf("git add -A failed: %w", err)
+	}
+
+	paths := make([]string, 0, len(st))
+	for p := range st {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		switch st[p].Worktree {
+		case gogit.Unmodified:
+			continue
+		case gogit.Deleted:
+			_, err = wt.Remove(p)
+		default:
+			_, err = wt.Add(p)
+		}
+		if err != nil {
+			return fmt.Errorf("git add -A failed (%s): %w", p, err)
+		}
+	}
+	return nil
+}
+
+// goGitCommit implements Commit with go-git.
+func goGitCommit(opts CommitOptions) error {
+	repo, wt, err := goGitOpen(opts.RepoDir)
+	if err != nil {
+		return err
+	}
+
+	author := &object.Signature{Name: defaultAuthorName, Email: defaultAuthorEmail, When: time.Now()}
+	if cfg, err := repo.ConfigScoped(gitconfig.GlobalScope); err == nil {
+		if name := strings.TrimSpace(cfg.User.Name); name != "" {
+			author.Name = name
+		}
+		if email := strings.TrimSpace(cfg.User.Email); email != "" {
+			author.Email = email
+		}
+	}
+	if name := strings.TrimSpace(opts.AuthorName); name != "" {
+		author.Name = name
+	}
+	if email := strings.TrimSpace(opts.AuthorEmail); email != "" {
+		author.Email = email
+	}
+
+	signer, err := goGitSigner(opts.Signing)
+	if err != nil {
+		return err
+	}
+
+	if _, err := wt.Commit(opts.Message, &gogit.CommitOptions{Author: author, Signer: signer}); err != nil {
+		return fmt.Errorf("git commit failed: %w", err)
+	}
+	return nil
+}
+
+// goGitPush implements Push with go-git: the current branch is pushed to the branch
+// of the same name (or opts.Branch) on origin (or the authenticated URL).
+func goGitPush(ctx context.Context, opts PushOptions) error {
+	repo, _, err := goGitOpen(opts.RepoDir)
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("git push failed: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return fmt.Errorf("git push failed: HEAD is not on a branch")
+	}
+
+	dst := head.Name()
+	if branch := strings.TrimSpace(opts.Branch); branch != "" {
+		dst = plumbing.NewBranchReferenceName(branch)
+	}
+	po := &gogit.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{gitconfig.RefSpec(head.Name().String() + ":" + dst.String())},
+	}
+	if strings.TrimSpace(opts.AccessToken) != "" && strings.TrimSpace(opts.RepoURL) != "" {
+		if po.Auth, err = goGitAuth(opts.RepoURL, opts.TokenUsername, opts.AccessToken); err != nil {
+			return err
+		}
+		po.RemoteURL = strings.TrimSpace(opts.RepoURL)
+	}
+
+	out := runlog.NewCapture(ctx, 0)
+	defer out.Close()
+	po.Progress = out
+
+	if err := repo.PushContext(ctx, po); err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		// go-git reports rejections as plain "non-fast-forward update: <ref>" errors.
+		if strings.HasPrefix(err.Error(), gogit.ErrNonFastForwardUpdate.Error()) {
+			return fmt.Errorf("git push failed: %w: %w", ErrPushRejected, err)
+		}
+		return fmt.Errorf("git push failed: %w: %s", err, out.Tail())
+	}
+	return nil
+}
+
+// goGitFetch implements Fetch with go-git. Branches and tags are looked up on the
+// remote; other refs are treated as commit hashes. The result is stored as FETCH_HEAD.
+func goGitFetch(ctx context.Context, opts FetchOptions) error {
+	repo, _, err := goGitOpen(opts.RepoDir)
+	if err != nil {
+		return err
+	}
+
+	fo := &gogit.FetchOptions{RemoteName: "origin", Depth: max(opts.Depth, 0), Tags: gogit.NoTags}
+	if strings.TrimSpace(opts.AccessToken) != "" && strings.TrimSpace(opts.RepoURL) != "" {
+		if fo.Auth, err = goGitAuth(opts.RepoURL, opts.TokenUsername, opts.AccessToken); err != nil {
+			return err
+		}
+		fo.RemoteURL = strings.TrimSpace(opts.RepoURL)
+	}
+
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return fmt.Errorf("git fetch failed: %w", err)
+	}
+	refs, err := remote.ListContext(ctx, &gogit.ListOptions{Auth: fo.Auth})
+	if err != nil {
+		return fmt.Errorf("git fetch failed: %w", err)
+	}
+
+	ref := strings.TrimSpace(opts.Ref)
+	for _, r := range refs {
+		// The remote HEAD is usually advertised as symbolic ref to the default branch.
+		if r.Type() == plumbing.SymbolicReference && r.Name().String() == ref {
+			ref = r.Target().String()
+			break
+		}
+	}
+	var want plumbing.Hash
+	for _, r := range refs {
+		if r.Type() == plumbing.HashReference && (r.Name().String() == ref || r.Name().Short() == ref) {
+			fo.RefSpecs = []gitconfig.RefSpec{gitconfig.RefSpec("+" + r.Name().String() + ":refs/fyndmark/fetch-head")}
+			want = r.Hash()
+			break
+		}
+	}
+	if fo.RefSpecs == nil {
+		if !plumbing.IsHash(ref) {
+			return fmt.Errorf("git fetch failed: ref %q not found on remote", ref)
+		}
+		// Commits are fetched with the whole history of the remote branches.
+		fo.Depth = 0
+		want = plumbing.NewHash(ref)
+	}
+
+	out := runlog.NewCapture(ctx, 0)
+	defer out.Close()
+	fo.Progress = out
+
+	if err := repo.FetchContext(ctx, fo); err != nil && !errors.Is(err, gogit.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("git fetch failed: %w: %s", err, out.Tail())
+	}
+	if want.IsZero() {
+		return fmt.Errorf("git fetch failed: ref %q not found", ref)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(fetchHeadRef, want)); err != nil {
+		return fmt.Errorf("git fetch failed: %w", err)
+	}
+	return nil
+}
+
+// goGitRevParse implements RevParse with go-git; annotated tags resolve to their commit.
+func goGitRevParse(repoDir string, ref string) (string, error) {
+	repo, _, err := goGitOpen(repoDir)
+	if err != nil {
+		return "", err
+	}
+	h, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse %s failed: %w", ref, err)
+	}
+	if tag, err := repo.TagObject(*h); err == nil {
+		c, err := tag.Commit()
+		if err != nil {
+			return "", fmt.Errorf("git rev-parse %s failed: %w", ref, err)
+		}
+		return c.Hash.String(), nil
+	}
+	if _, err := repo.CommitObject(*h); err != nil {
+		return "", fmt.Errorf("git rev-parse %s failed: %w", ref, err)
+	}
+	return h.String(), nil
+}
+
+// goGitIsAncestor implements IsAncestor with go-git. Like git, it treats commits
+// missing from a shallow clone as unreachable.
+func goGitIsAncestor(repoDir string, ancestor string, ref string) (bool, error) {
+	repo, _, err := goGitOpen(repoDir)
+	if err != nil {
+		return false, err
+	}
+	var commits [2]*object.Commit
+	for i, r := range []string{ancestor, ref} {
+		h, err := goGitRevParse(repoDir, r)
+		if err != nil {
+			return false, fmt.Errorf("git merge-base %s %s failed: %w", ancestor, ref, err)
+		}
+		if commits[i], err = repo.CommitObject(plumbing.NewHash(h)); err != nil {
+			return false, fmt.Errorf("git merge-base %s %s failed: %w", ancestor, ref, err)
+		}
+	}
+	ok, err := commits[0].IsAncestor(commits[1])
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("git merge-base %s %s failed: %w", ancestor, ref, err)
+	}
+	return ok, nil
+}
+
+// goGitCheckoutDetached implements CheckoutDetached with go-git.
+func goGitCheckoutDetached(repoDir string, ref string) error {
+	_, wt, err := goGitOpen(repoDir)
+	if err != nil {
+		return err
+	}
+	h, err := goGitRevParse(repoDir, ref)
+	if err != nil {
+		return fmt.Errorf("git checkout %s failed: %w", ref, err)
+	}
+	if err := wt.Checkout(&gogit.CheckoutOptions{Hash: plumbing.NewHash(h)}); err != nil {
+		return fmt.Errorf("git checkout %s failed: %w", ref, err)
+	}
+	return nil
+}
+
+// goGitCurrentBranch implements CurrentBranch with go-git.
+func goGitCurrentBranch(repoDir string) (string, error) {
+	repo, _, err := goGitOpen(repoDir)
+	if err != nil {
+		return "", err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("git symbolic-ref failed: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return "", fmt.Errorf("git symbolic-ref failed: HEAD is not on a branch")
+	}
+	return head.Name().Short(), nil
+}
+
+// goGitRemoteURL implements RemoteURL with go-git.
+func goGitRemoteURL(repoDir string) (string, error) {
+	repo, _, err := goGitOpen(repoDir)
+	if err != nil {
+		return "", err
+	}
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return "", fmt.Errorf("git remote get-url failed: %w", err)
+	}
+	if urls := remote.Config().URLs; len(urls) > 0 {
+		return urls[0], nil
+	}
+	return "", fmt.Errorf("git remote get-url failed: origin has no URL")
+}
+
+// goGitResetToRef implements ResetToRef with go-git. Untracked files are removed,
+// files ignored by .gitignore are kept. go-git's clean has no excludes, so kept
+// directories are moved into .git meanwhile.
+func goGitResetToRef(ctx context.Context, opts ResetOptions) (err error) {
+	repo, wt, err := goGitOpen(opts.RepoDir)
+	if err != nil {
+		return err
+	}
+
+	keepDir := filepath.Join(opts.RepoDir, ".git", "fyndmark-keep")
+	for i, k := range opts.Keep {
+		src := filepath.Join(opts.RepoDir, filepath.FromSlash(strings.Trim(k, "/")))
+		if _, statErr := os.Stat(src); statErr != nil {
+			continue
+		}
+		if err := os.MkdirAll(keepDir, 0o755); err != nil {
+			return fmt.Errorf("git clean failed: %w", err)
+		}
+		tmp := filepath.Join(keepDir, strconv.Itoa(i))
+		if err := os.Rename(src, tmp); err != nil {
+			return fmt.Errorf("git clean failed: %w", err)
+		}
+		defer func() {
+			if mkErr := os.MkdirAll(filepath.Dir(src), 0o755); mkErr != nil && err == nil {
+				err = fmt.Errorf("restore %s: %w", k, mkErr)
+			}
+			if mvErr := os.Rename(tmp, src); mvErr != nil && err == nil {
+				err = fmt.Errorf("restore %s: %w", k, mvErr)
+			}
+		}()
+	}
+	h, err := goGitRevParse(opts.RepoDir, opts.Ref)
+	if err != nil {
+		return fmt.Errorf("git reset failed: %w", err)
+	}
+	hash := plumbing.NewHash(h)
+
+	if branch := strings.TrimSpace(opts.Branch); branch != "" {
+		name := plumbing.NewBranchReferenceName(branch)
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+			return fmt.Errorf("git checkout failed: %w", err)
+		}
+		if err := wt.Checkout(&gogit.CheckoutOptions{Branch: name, Force: true}); err != nil {
+			return fmt.Errorf("git checkout failed: %w", err)
+		}
+	}
+	if err := wt.Reset(&gogit.ResetOptions{Commit: hash, Mode: gogit.HardReset}); err != nil {
+		return fmt.Errorf("git reset failed: %w", err)
+	}
+	if err := wt.Clean(&gogit.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("git clean failed: %w", err)
+	}
+
+	if opts.RecurseSubmodules {
+		subs, err := wt.Submodules()
+		if err != nil {
+			return fmt.Errorf("git submodule update failed: %w", err)
+		}
+		if err := subs.UpdateContext(ctx, &gogit.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: gogit.DefaultSubmoduleRecursionDepth,
+		}); err != nil {
+			return fmt.Errorf("git submodule update failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// goGitRebase implements Rebase with go-git, which has no rebase: the local commits
+// are replayed file by file onto the new base. A file changed both locally and on the
+// new base is a conflict. Merge commits and symlinks are not supported.
+func goGitRebase(opts RebaseOptions) (err error) {
+	repo, wt, err := goGitOpen(opts.RepoDir)
+	if err != nil {
+		return err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("git rebase failed: %w", err)
+	}
+	if !head.Name().IsBranch() {
+		return fmt.Errorf("git rebase failed: HEAD is not on a branch")
+	}
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("git rebase failed: %w", err)
+	}
+	ontoHash, err := goGitRevParse(opts.RepoDir, opts.Onto)
+	if err != nil {
+		return fmt.Errorf("git rebase failed: %w", err)
+	}
+	onto, err := repo.CommitObject(plumbing.NewHash(ontoHash))
+	if err != nil {
+		return fmt.Errorf("git rebase failed: %w", err)
+	}
+
+	bases, err := headCommit.MergeBase(onto)
+	if err != nil {
+		return fmt.Errorf("git rebase failed: %w", err)
+	}
+	if len(bases) == 0 {
+		return fmt.Errorf("git rebase failed: no common ancestor with %s", opts.Onto)
+	}
+	base := bases[0]
+	if base.Hash == onto.Hash {
+		// Nothing new on the remote.
+		return nil
+	}
+
+	var local []*object.Commit
+	for c := headCommit; c.Hash != base.Hash; {
+		if c.NumParents() != 1 {
+			return fmt.Errorf("git rebase failed: commit %s is a merge or root commit", c.Hash)
+		}
+		local = append(local, c)
+		if c, err = c.Parent(0); err != nil {
+			return fmt.Errorf("git rebase failed: %w", err)
+		}
+	}
+
+	// From here on, any failure restores the branch.
+	reset := func(h plumbing.Hash) error {
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), h)); err != nil {
+			return err
+		}
+		return wt.Reset(&gogit.ResetOptions{Commit: h, Mode: gogit.HardReset})
+	}
+	defer func() {
+		if err != nil {
+			_ = reset(head.Hash())
+		}
+	}()
+	if err := reset(onto.Hash); err != nil {
+		return fmt.Errorf("git rebase failed: %w", err)
+	}
+
+	committer := object.Signature{Name: defaultAuthorName, Email: defaultAuthorEmail}
+	if cfg, err := repo.ConfigScoped(gitconfig.GlobalScope); err == nil {
+		if name := strings.TrimSpace(cfg.User.Name); name != "" {
+			committer.Name = name
+		}
+		if email := strings.TrimSpace(cfg.User.Email); email != "" {
+			committer.Email = email
+		}
+	}
+	if name := strings.TrimSpace(opts.CommitterName); name != "" {
+		committer.Name = name
+	}
+	if email := strings.TrimSpace(opts.CommitterEmail); email != "" {
+		committer.Email = email
+	}
+
+	signer, err := goGitSigner(opts.Signing)
+	if err != nil {
+		return err
+	}
+
+	for i := len(local) - 1; i >= 0; i-- {
+		if err := goGitReplayCommit(repo, wt, opts.RepoDir, local[i], committer, signer); err != nil {
+			return fmt.Errorf("git rebase failed: commit %s: %w", local[i].Hash, err)
+		}
+	}
+	return nil
+}
+
+// goGitReplayCommit applies the changes of c to the worktree and commits them with
+// the original author and message. Commits that became empty are dropped.
+func goGitReplayCommit(repo *gogit.Repository, wt *gogit.Worktree, repoDir string, c *object.Commit, committer object.Signature, signer gogit.Signer) error {
+	parent, err := c.Parent(0)
+	if err != nil {
+		return err
+	}
+	from, err := parent.Tree()
+	if err != nil {
+		return err
+	}
+	to, err := c.Tree()
+	if err != nil {
+		return err
+	}
+	changes, err := object.DiffTree(from, to)
+	if err != nil {
+		return err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return err
+	}
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	current, err := headCommit.Tree()
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range changes {
+		name := ch.To.Name
+		if name == "" {
+			name = ch.From.Name
+		}
+		// The file on the new base must still be the one the commit started from.
+		var have plumbing.Hash
+		if e, err := current.FindEntry(name); err == nil {
+			have = e.Hash
+		}
+		if have != ch.From.TreeEntry.Hash && have != ch.To.TreeEntry.Hash {
+			return fmt.Errorf("conflict in %s", name)
+		}
+
+		path := filepath.Join(repoDir, filepath.FromSlash(name))
+		if ch.To.Name == "" {
+			if _, err := wt.Remove(name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f, err := to.File(name)
+		if err != nil {
+			return err
+		}
+		if !f.Mode.IsFile() {
+			return fmt.Errorf("%s: only regular files are supported", name)
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		perm := os.FileMode(0o644)
+		if f.Mode == filemode.Executable {
+			perm = 0o755
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), perm); err != nil {
+			return err
+		}
+		if _, err := wt.Add(name); err != nil {
+			return err
+		}
+	}
+
+	committer.When = time.Now()
+	author := c.Author
+	_, err = wt.Commit(c.Message, &gogit.CommitOptions{Author: &author, Committer: &committer, Signer: signer})
+	if errors.Is(err, gogit.ErrEmptyCommit) {
+		return nil
+	}
+	return err
+}
+
+// goGitOpen opens the repository and its worktree.
+func goGitOpen(repoDir string) (*gogit.Repository, *gogit.Worktree, error) {
+	repo, err := gogit.PlainOpen(repoDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open repository %s: %w", repoDir, err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, nil, fmt.Errorf("open worktree %s: %w", repoDir, err)
+	}
+	return repo, wt, nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -11,6 +13,15 @@ import (
 	"github.com/geschke/fyndmark/pkg/hugocli"
 )
 
+const (
+	// DefaultBin is the Hugo executable used by the pipeline.
+	DefaultBin = "hugo"
+	// DefaultTimeout limits a single Hugo build.
+	DefaultTimeout = 5 * time.Minute
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type HugoRunner struct {
 	SiteID string
 }
@@ -45,12 +56,79 @@ func RunWithContext(ctx context.Context, siteId string) error {
 
 	fmt.Printf("Running Hugo in: %s\n", workDir)
 
-	// Prototype defaults: just run "hugo" with no args.
-	// (Later we can add optional config-driven args if needed.)
+	hc := siteCfg.Hugo
 	return hugocli.Run(ctx, hugocli.RunOptions{
 		WorkingDir: workDir,
-		HugoBin:    "hugo",
-		Args:       nil,
-		Timeout:    5 * time.Minute,
+		HugoBin:    Bin(hc),
+		Args:       hc.Args,
+		Env:        envList(hc.Env),
+		Timeout:    commandTimeout(ctx, Timeout(hc)),
 	})
 }
+
+// Bin returns the Hugo binary of a site.
+func Bin(cfg config.HugoConfig) string {
+	if bin := strings.TrimSpace(cfg.Bin); bin != "" {
+		return bin
+	}
+	return DefaultBin
+}
+
+// Timeout returns the time limit of a Hugo build of a site.
+func Timeout(cfg config.HugoConfig) time.Duration {
+	if cfg.TimeoutSeconds > 0 {
+		return time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	return DefaultTimeout
+}
+
+// envList returns env in "KEY=value" form, sorted by name.
+func envList(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k+"="+env[k])
+	}
+	return out
+}
+
+// ValidateConfig checks the Hugo settings of all sites.
+func ValidateConfig() error {
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		hc := siteCfg.Hugo
+		if hc.TimeoutSeconds < 0 {
+			return fmt.Errorf("comment_sites.%s.hugo.timeout_seconds must be >= 0", siteKey)
+		}
+		for k := range hc.Env {
+			if !envNamePattern.MatchString(k) {
+				return fmt.Errorf("comment_sites.%s.hugo.env: invalid variable name %q", siteKey, k)
+			}
+		}
+		if s := strings.TrimSpace(hc.MinVersion); s != "" {
+			if _, err := parseVersionSpec(s); err != nil {
+				return fmt.Errorf("comment_sites.%s.hugo.min_version %w", siteKey, err)
+			}
+		}
+		if s := strings.TrimSpace(hc.Version); s != "" {
+			if _, err := parseVersionSpec(s); err != nil {
+				return fmt.Errorf("comment_sites.%s.hugo.version %w", siteKey, err)
+			}
+		}
+	}
+	return nil
+}
+
+// commandTimeout returns limit, or the time left until the deadline of ctx if that is
+// shorter, so the step timeout of a pipeline run applies.
+func commandTimeout(ctx context.Context, limit time.Duration) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return limit
+	}
+	// An expired context makes Hugo fail right away.
+	return min(max(time.Until(deadline), time.Millisecond), limit)
+}
@@ -0,0 +1,128 @@
+package hugo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/hugocli"
+)
+
+// versionTimeout limits "hugo version".
+const versionTimeout = 30 * time.Second
+
+var (
+	// versionPattern finds the version in the output of "hugo version", e.g.
+	// "hugo v0.128.0-e6d2712e+extended linux/amd64" or
+	// "Hugo Static Site Generator v0.80.0/extended linux/amd64".
+	versionPattern = regexp.MustCompile(`v(\d+)\.(\d+)\.(\d+)`)
+	// versionSpecPattern matches configured versions: "0.120", "0.120.1" or "v0.120.1".
+	versionSpecPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?$`)
+)
+
+// Version is a Hugo version.
+type Version struct {
+	Major, Minor, Patch int
+	Extended            bool
+}
+
+// String returns v as "v0.128.0" or "v0.128.0+extended".
+func (v Version) String() string {
+	s := fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Extended {
+		s += "+extended"
+	}
+	return s
+}
+
+// compare returns -1, 0 or 1 if v is older, equal or newer than o (editions are ignored).
+func (v Version) compare(o Version) int {
+	for _, d := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// ParseVersion reads the version from the output of "hugo version".
+func ParseVersion(out string) (Version, error) {
+	m := versionPattern.FindStringSubmatch(out)
+	if m == nil {
+		return Version{}, fmt.Errorf("no version found in %q", strings.TrimSpace(out))
+	}
+	v := Version{Extended: strings.Contains(out, "+extended") || strings.Contains(out, "/extended")}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	return v, nil
+}
+
+// parseVersionSpec parses a configured version; a missing patch level is 0.
+func parseVersionSpec(s string) (Version, error) {
+	m := versionSpecPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Version{}, fmt.Errorf("must be a version like 0.120.0, got %q", s)
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+	return v, nil
+}
+
+// CheckVersion checks v against the version requirements of a site.
+func CheckVersion(cfg config.HugoConfig, v Version) error {
+	if s := strings.TrimSpace(cfg.Version); s != "" {
+		want, err := parseVersionSpec(s)
+		if err != nil {
+			return fmt.Errorf("version: %w", err)
+		}
+		if v.compare(want) != 0 {
+			return fmt.Errorf("hugo %s does not match the configured version %s", v, want)
+		}
+	}
+	if s := strings.TrimSpace(cfg.MinVersion); s != "" {
+		want, err := parseVersionSpec(s)
+		if err != nil {
+			return fmt.Errorf("min_version: %w", err)
+		}
+		if v.compare(want) < 0 {
+			return fmt.Errorf("hugo %s is older than min_version %s", v, want)
+		}
+	}
+	if cfg.Extended && !v.Extended {
+		return fmt.Errorf("hugo %s is not the extended edition required by the site", v)
+	}
+	return nil
+}
+
+// Preflight runs "hugo version" with the binary and environment of a site and checks
+// the version requirements, so a run fails before the checkout if Hugo is missing or
+// incompatible.
+func Preflight(ctx context.Context, siteID string) (Version, error) {
+	siteCfg, ok := config.Cfg.CommentSites[strings.TrimSpace(siteID)]
+	if !ok {
+		return Version{}, fmt.Errorf("unknown site_id %q (not found in comment_sites)", siteID)
+	}
+	hc := siteCfg.Hugo
+
+	out, err := hugocli.Version(ctx, Bin(hc), envList(hc.Env), commandTimeout(ctx, versionTimeout))
+	if err != nil {
+		return Version{}, err
+	}
+	v, err := ParseVersion(out)
+	if err != nil {
+		return Version{}, err
+	}
+	return v, CheckVersion(hc, v)
+}
@@ -0,0 +1,52 @@
+package hugo
+
+import (
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		out  string
+		want Version
+	}{
+		{"hugo v0.128.0-e6d2712ee062321dc2fc49e963597dd5a6157660+extended linux/amd64 BuildDate=2024-06-25T16:14:56Z", Version{0, 128, 0, true}},
+		{"hugo v0.111.3-5d4eb5154e1fed125ca8e9b5a0315c4180dab192 linux/amd64 BuildDate=unknown", Version{0, 111, 3, false}},
+		{"Hugo Static Site Generator v0.80.0/extended linux/amd64 BuildDate: unknown", Version{0, 80, 0, true}},
+	}
+	for _, c := range cases {
+		got, err := ParseVersion(c.out)
+		if err != nil {
+			t.Fatalf("ParseVersion(%q): %v", c.out, err)
+		}
+		if got != c.want {
+			t.Errorf("ParseVersion(%q) = %+v, want %+v", c.out, got, c.want)
+		}
+	}
+	if _, err := ParseVersion("command not found"); err == nil {
+		t.Error("expected error for output without version")
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	v := Version{0, 128, 0, false}
+	cases := []struct {
+		cfg config.HugoConfig
+		ok  bool
+	}{
+		{config.HugoConfig{}, true},
+		{config.HugoConfig{MinVersion: "0.120"}, true},
+		{config.HugoConfig{MinVersion: "v0.128.0"}, true},
+		{config.HugoConfig{MinVersion: "0.128.1"}, false},
+		{config.HugoConfig{Version: "0.128.0"}, true},
+		{config.HugoConfig{Version: "0.127.0"}, false},
+		{config.HugoConfig{Extended: true}, false},
+		{config.HugoConfig{MinVersion: "latest"}, false},
+	}
+	for _, c := range cases {
+		if err := CheckVersion(c.cfg, v); (err == nil) != c.ok {
+			t.Errorf("CheckVersion(%+v, %s) = %v, want ok=%v", c.cfg, v, err, c.ok)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package hugocli
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/geschke/fyndmark/pkg/runlog"
+	"github.com/geschke/fyndmark/pkg/sandbox"
 )
 
 type RunOptions struct {
@@ -19,6 +20,9 @@ type RunOptions struct {
 	// Args are additional hugo args, e.g. []string{"--minify"}.
 	Args []string
 
+	// Env holds additional environment variables in "KEY=value" form.
+	Env []string
+
 	// Timeout is the maximum runtime. If <= 0, a default is used.
 	Timeout time.Duration
 }
@@ -44,15 +48,44 @@ func Run(ctx context.Context, opts RunOptions) error {
 	runCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
 	defer cancel()
 
-	var out bytes.Buffer
-	cmd := exec.CommandContext(runCtx, bin, args...)
-	cmd.Dir = opts.WorkingDir
-	cmd.Stdout = &out
-	cmd.Stderr = &out
+	out := runlog.NewCapture(runCtx, 0)
+	defer out.Close()
+
+	cmd, err := sandbox.Command(runCtx, "hugo", bin, opts.WorkingDir, opts.Env, args...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("hugo failed: %w: %s", err, out.String())
+		return fmt.Errorf("hugo failed: %w: %s", err, out.Tail())
 	}
 
 	return nil
 }
+
+// Version runs "hugo version" and returns its output, e.g.
+// "hugo v0.128.0-e6d2712e+extended linux/amd64 BuildDate=...".
+func Version(ctx context.Context, hugoBin string, env []string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	bin := strings.TrimSpace(hugoBin)
+	if bin == "" {
+		bin = "hugo"
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd, err := sandbox.Command(runCtx, "hugo", bin, "", env, "version")
+	if err != nil {
+		return "", err
+	}
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("hugo version failed: %w: %s", err, runlog.Redact(strings.TrimSpace(string(b))))
+	}
+	return strings.TrimSpace(string(b)), nil
+}
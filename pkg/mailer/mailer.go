@@ -1,6 +1,7 @@
 package mailer
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -8,8 +9,8 @@ import (
 	mail "github.com/wneessen/go-mail"
 )
 
-// SendTextMail sends a plain text email using the global SMTP config.
-func SendTextMail(recipients []string, subject, body string) error {
+// newClient returns a mail client for the global SMTP config.
+func newClient() (*mail.Client, error) {
 	smtpCfg := config.Cfg.SMTP
 
 	var opts []mail.Option
@@ -31,7 +32,7 @@ func SendTextMail(recipients []string, subject, body string) error {
 
 	client, err := mail.NewClient(smtpCfg.Host, opts...)
 	if err != nil {
-		return fmt.Errorf("failed to create mail client: %w", err)
+		return nil, fmt.Errorf("failed to create mail client: %w", err)
 	}
 
 	if smtpCfg.Username != "" && smtpCfg.Password != "" {
@@ -39,6 +40,29 @@ func SendTextMail(recipients []string, subject, body string) error {
 		client.SetUsername(smtpCfg.Username)
 		client.SetPassword(smtpCfg.Password)
 	}
+	return client, nil
+}
+
+// Ping connects to the SMTP server, including STARTTLS and authentication, and
+// closes the connection again without sending a mail.
+func Ping(ctx context.Context) error {
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
+	if err := client.DialWithContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	return client.Close()
+}
+
+// SendTextMail sends a plain text email using the global SMTP config.
+func SendTextMail(recipients []string, subject, body string) error {
+	smtpCfg := config.Cfg.SMTP
+	client, err := newClient()
+	if err != nil {
+		return err
+	}
 
 	msg := mail.NewMsg()
 	if err := msg.From(smtpCfg.From); err != nil {
@@ -0,0 +1,199 @@
+// Package oidc implements the parts of OpenID Connect the admin login needs: discovery,
+// the authorization code flow with PKCE and the verification of ID tokens.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultScopes are requested if Provider.Scopes is empty.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// maxResponseBytes limits the responses read from the provider.
+const maxResponseBytes = 1 << 20
+
+// Provider is an OpenID Connect provider, configured by its discovery document.
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients
+	RedirectURL  string
+	Scopes       []string
+	// HTTPClient is used for requests to the provider; nil uses a client with a 10s timeout.
+	HTTPClient *http.Client
+
+	mu   sync.Mutex
+	meta *metadata
+	keys *keySet
+}
+
+// metadata is the part of the discovery document that is used.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// New returns a provider. The discovery document is read on first use, so a provider
+// that is down at startup does not prevent the server from starting.
+func New(issuer, clientID, clientSecret, redirectURL string, scopes []string) *Provider {
+	return &Provider{
+		Issuer:       strings.TrimRight(strings.TrimSpace(issuer), "/"),
+		ClientID:     strings.TrimSpace(clientID),
+		ClientSecret: clientSecret,
+		RedirectURL:  strings.TrimSpace(redirectURL),
+		Scopes:       scopes,
+	}
+}
+
+// RandomString returns a random URL-safe string for state, nonce and PKCE verifiers.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeChallenge returns the S256 PKCE challenge of verifier.
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// discover returns the discovery document, fetching it once.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var m metadata
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	// The issuer must match exactly (OpenID Connect Discovery 1.0, section 4.3).
+	if strings.TrimRight(m.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", m.Issuer, p.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc discovery: endpoints missing")
+	}
+	p.meta = &m
+	return p.meta, nil
+}
+
+// AuthCodeURL returns the URL of the provider's login page.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified claims of the
+// ID token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.ClientSecret == "" {
+		form.Set("client_id", p.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		// client_secret_basic, with the form encoding of RFC 6749, section 2.3.1.
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var tok struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return Claims{}, fmt.Errorf("oidc token request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&tok); err != nil {
+		return Claims{}, fmt.Errorf("oidc token response: %s: %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.Error != "" {
+		return Claims{}, fmt.Errorf("oidc token request: %s: %s %s", resp.Status, tok.Error, tok.ErrorDescription)
+	}
+	if tok.IDToken == "" {
+		return Claims{}, fmt.Errorf("oidc token response without id_token")
+	}
+	return p.Verify(ctx, tok.IDToken, nonce)
+}
+
+// getJSON fetches url and decodes the JSON response into out.
+func (p *Provider) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(out)
+}
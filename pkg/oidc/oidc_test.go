@@ -0,0 +1,189 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIdP is a minimal OpenID Connect provider signing with an RSA key.
+type testIdP struct {
+	srv      *httptest.Server
+	key      *rsa.PrivateKey
+	claims   map[string]any // claims of the next ID token
+	verifier string         // PKCE verifier of the last token request
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString([]byte{1, 0, 1}),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		idp.verifier = r.PostFormValue("code_verifier")
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, "RS256", "k1", idp.claims)})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+func (idp *testIdP) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (idp *testIdP) validClaims() map[string]any {
+	return map[string]any{
+		"iss": idp.srv.URL, "sub": "user-1", "aud": "client", "exp": time.Now().Add(time.Hour).Unix(),
+		"nonce": "n1", "email": "ada@example.com", "email_verified": "true",
+	}
+}
+
+func TestAuthCodeFlow(t *testing.T) {
+	idp := newTestIdP(t)
+	p := New(idp.srv.URL+"/", "client", "s3cret", "https://fyndmark.example/api/auth/oidc/callback", nil)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "st", "n1", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("state") != "st" || q.Get("nonce") != "n1" || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("auth URL = %s", authURL)
+	}
+	if q.Get("code_challenge") != codeChallenge("verifier") || q.Get("scope") != "openid email profile" {
+		t.Fatalf("auth URL = %s", authURL)
+	}
+
+	idp.claims = idp.validClaims()
+	c, err := p.Exchange(ctx, "code", "verifier", "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Subject != "user-1" || c.Email != "ada@example.com" || !bool(c.EmailVerified) {
+		t.Fatalf("claims = %+v", c)
+	}
+	if idp.verifier != "verifier" {
+		t.Fatalf("token request verifier = %q", idp.verifier)
+	}
+
+	p.ClientSecret = "wrong"
+	if _, err := p.Exchange(ctx, "code", "verifier", "n1"); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+		t.Fatalf("wrong secret: %v", err)
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	p := New(idp.srv.URL, "client", "", "", nil)
+	ctx := context.Background()
+
+	if _, err := p.Verify(ctx, idp.sign(t, "RS256", "k1", idp.validClaims()), "n1"); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+
+	with := func(k string, v any) map[string]any {
+		c := idp.validClaims()
+		c[k] = v
+		return c
+	}
+	cases := map[string]string{
+		"issuer":   idp.sign(t, "RS256", "k1", with("iss", "https://evil.example")),
+		"audience": idp.sign(t, "RS256", "k1", with("aud", []string{"other"})),
+		"azp":      idp.sign(t, "RS256", "k1", with("aud", []string{"client", "other"})),
+		"expired":  idp.sign(t, "RS256", "k1", with("exp", time.Now().Add(-time.Hour).Unix())),
+		"nonce":    idp.sign(t, "RS256", "k1", with("nonce", "n2")),
+		"subject":  idp.sign(t, "RS256", "k1", with("sub", "")),
+		"key":      idp.sign(t, "RS256", "k2", idp.validClaims()),
+		"alg":      idp.sign(t, "none", "k1", idp.validClaims()),
+	}
+	valid := idp.sign(t, "RS256", "k1", idp.validClaims())
+	parts := strings.Split(valid, ".")
+	tampered, _ := json.Marshal(with("sub", "admin"))
+	cases["tampered"] = parts[0] + "." + base64.RawURLEncoding.EncodeToString(tampered) + "." + parts[2]
+
+	for name, tok := range cases {
+		if _, err := p.Verify(ctx, tok, "n1"); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestVerifyECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := jwk{
+		Kty: "EC", Crv: "P-256",
+		X: base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y: base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}.publicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := []byte("header.payload")
+	sum := sha256.Sum256(signed)
+	r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	if err := verifySignature("ES256", pub, signed, sig); err != nil {
+		t.Fatalf("valid signature: %v", err)
+	}
+	if err := verifySignature("RS256", pub, signed, sig); err == nil {
+		t.Fatal("algorithm of another key type accepted")
+	}
+	sig[0] ^= 1
+	if err := verifySignature("ES256", pub, signed, sig); err == nil {
+		t.Fatal("invalid signature accepted")
+	}
+}
@@ -0,0 +1,289 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is the tolerance for the expiry of ID tokens.
+const clockSkew = time.Minute
+
+// keyRefreshInterval limits how often the keys are fetched again for an unknown key ID.
+const keyRefreshInterval = time.Minute
+
+// Claims are the verified claims of an ID token.
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	Expiry          int64    `json:"exp"`
+	Nonce           string   `json:"nonce"`
+
+	Email         string    `json:"email"`
+	EmailVerified boolClaim `json:"email_verified"`
+	GivenName     string    `json:"given_name"`
+	FamilyName    string    `json:"family_name"`
+}
+
+// audience is a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// boolClaim accepts true and "true"; some providers send booleans as strings.
+type boolClaim bool
+
+func (v *boolClaim) UnmarshalJSON(b []byte) error {
+	*v = boolClaim(strings.Trim(string(b), `"`) == "true")
+	return nil
+}
+
+// keySet holds the signing keys of the provider by key ID.
+type keySet struct {
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+// jwk is a JSON Web Key (RFC 7517) of type RSA or EC.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Verify checks the signature and the claims of an ID token issued to this client
+// for the given nonce.
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("id token: malformed")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, fmt.Errorf("id token header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("id token signature: %w", err)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return Claims{}, fmt.Errorf("id token signature: %w", err)
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return Claims{}, fmt.Errorf("id token claims: %w", err)
+	}
+	switch {
+	case strings.TrimRight(c.Issuer, "/") != p.Issuer:
+		return Claims{}, fmt.Errorf("id token: issuer %q does not match", c.Issuer)
+	case !c.Audience.contains(p.ClientID):
+		return Claims{}, fmt.Errorf("id token: not issued for this client")
+	case len(c.Audience) > 1 && c.AuthorizedParty != p.ClientID:
+		return Claims{}, fmt.Errorf("id token: authorized party %q does not match", c.AuthorizedParty)
+	case time.Unix(c.Expiry, 0).Add(clockSkew).Before(time.Now()):
+		return Claims{}, fmt.Errorf("id token: expired")
+	case c.Nonce != nonce:
+		return Claims{}, fmt.Errorf("id token: nonce does not match")
+	case c.Subject == "":
+		return Claims{}, fmt.Errorf("id token: subject missing")
+	}
+	return c, nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT.
+func decodeSegment(seg string, out any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// key returns the signing key with the given ID. Unknown IDs fetch the keys again,
+// since providers rotate them.
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	m, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.keys != nil {
+		if k, ok := p.keys.lookup(kid); ok {
+			return k, nil
+		}
+		if time.Since(p.keys.fetched) < keyRefreshInterval {
+			return nil, fmt.Errorf("id token: unknown key %q", kid)
+		}
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, m.JWKSURI, &doc); err != nil {
+		return nil, fmt.Errorf("oidc keys: %w", err)
+	}
+	ks := &keySet{keys: make(map[string]crypto.PublicKey), fetched: time.Now()}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			ks.keys[k.Kid] = pub
+		}
+	}
+	p.keys = ks
+
+	if k, ok := ks.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("id token: unknown key %q", kid)
+}
+
+// lookup returns the key with the given ID; without an ID, the only key of the set.
+func (ks *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// publicKey converts the JWK to an RSA or ECDSA public key.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// verifySignature checks a JWS signature with the algorithms of RFC 7518.
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %q does not match the key", alg)
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("algorithm %q does not match the key", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key")
+	}
+}
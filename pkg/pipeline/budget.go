@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+const budgetWindow = 24 * time.Hour
+
+// nextAllowedRun returns the earliest time a new run for the site may start,
+// based on the configured cooldown and daily budget. A zero time means "now".
+func nextAllowedRun(ctx context.Context, database *db.DB, siteID int64, cfg config.PipelineConfig, now time.Time) (time.Time, error) {
+	var next time.Time
+
+	if cfg.CooldownSeconds > 0 {
+		last, found, err := database.LastRunStartedAt(ctx, siteID)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if found {
+			next = time.Unix(last, 0).Add(time.Duration(cfg.CooldownSeconds) * time.Second)
+		}
+	}
+
+	if cfg.DailyBudget > 0 {
+		starts, err := database.ListRunStartsSince(ctx, siteID, now.Add(-budgetWindow).Unix())
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(starts) >= cfg.DailyBudget {
+			// The slot frees up when the oldest run that still counts leaves the window.
+			slot := time.Unix(starts[len(starts)-cfg.DailyBudget], 0).Add(budgetWindow)
+			if slot.After(next) {
+				next = slot
+			}
+		}
+	}
+
+	if !next.After(now) {
+		return time.Time{}, nil
+	}
+	return next, nil
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// openBudgetDB returns a database with the site "blog" and its ID.
+func openBudgetDB(t *testing.T) (*db.DB, int64) {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "budget.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	siteID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	return database, siteID
+}
+
+func TestNextAllowedRun(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+
+	tests := []struct {
+		name     string
+		cooldown int
+		budget   int
+		starts   []time.Time
+		want     time.Time
+	}{
+		{"no limits", 0, 0, []time.Time{ago(time.Second)}, time.Time{}},
+		{"no runs yet", 60, 1, nil, time.Time{}},
+		{"cooldown only", 60, 0, []time.Time{ago(time.Hour), ago(20 * time.Second)}, now.Add(40 * time.Second)},
+		{"cooldown elapsed", 60, 0, []time.Time{ago(time.Minute)}, time.Time{}},
+		{"budget not reached", 0, 3, []time.Time{ago(10 * time.Hour), ago(time.Hour)}, time.Time{}},
+		// The oldest of the three runs frees its slot when it leaves the window.
+		{"budget exactly reached", 0, 3, []time.Time{ago(10 * time.Hour), ago(5 * time.Hour), ago(time.Hour)}, now.Add(14 * time.Hour)},
+		// Two runs have to leave the window before one more may start.
+		{"budget exceeded", 0, 3, []time.Time{ago(20 * time.Hour), ago(10 * time.Hour), ago(5 * time.Hour), ago(time.Hour)}, now.Add(14 * time.Hour)},
+		{"budget of one", 0, 1, []time.Time{ago(23 * time.Hour)}, now.Add(time.Hour)},
+		// Runs older than the window no longer count.
+		{"window slides", 0, 2, []time.Time{ago(30 * time.Hour), ago(25 * time.Hour), ago(23 * time.Hour), ago(time.Hour)}, now.Add(time.Hour)},
+		{"run leaves the window now", 0, 1, []time.Time{ago(budgetWindow)}, time.Time{}},
+		{"budget later than cooldown", 3600, 2, []time.Time{ago(23 * time.Hour), ago(50 * time.Minute)}, now.Add(time.Hour)},
+		{"cooldown later than budget", 3600, 2, []time.Time{ago(23*time.Hour + 55*time.Minute), ago(time.Minute)}, now.Add(59 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, siteID := openBudgetDB(t)
+			ctx := context.Background()
+			for _, s := range tt.starts {
+				if _, err := database.SQL.ExecContext(ctx, `INSERT INTO pipeline_runs (site_id, state, created_at, started_at, finished_at) VALUES (?, ?, ?, ?, ?);`,
+					siteID, db.RunSuccess, s.Unix(), s.Unix(), s.Unix()+30); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Queued runs have not started and never count.
+			if _, err := database.CreateRun(siteID, "c1"); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := config.PipelineConfig{CooldownSeconds: tt.cooldown, DailyBudget: tt.budget}
+			got, err := nextAllowedRun(ctx, database, siteID, cfg, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("nextAllowedRun = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDeferIfThrottled checks that a throttled run waits for its slot and later runs
+// are coalesced into it.
+func TestDeferIfThrottled(t *testing.T) {
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	siteCfg := config.CommentsSiteConfig{}
+	siteCfg.Pipeline.CooldownSeconds = 3600
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": siteCfg, "docs": {}}
+
+	database, siteID := openBudgetDB(t)
+	w := NewWorker(database, 0, nil)
+	t.Cleanup(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for _, d := range w.deferred {
+			d.timer.Stop()
+		}
+	})
+
+	first, _ := database.CreateRun(siteID, "c1")
+	if w.deferIfThrottled(RunRequest{RunID: first, SiteID: "blog"}) {
+		t.Fatal("first run throttled without earlier runs")
+	}
+	if err := database.MarkRunRunning(first); err != nil {
+		t.Fatal(err)
+	}
+	if w.deferIfThrottled(RunRequest{RunID: 99, SiteID: "docs"}) {
+		t.Fatal("run of a site without limits was throttled")
+	}
+
+	second, _ := database.CreateRun(siteID, "c2")
+	third, _ := database.CreateRun(siteID, "c3")
+	if !w.deferIfThrottled(RunRequest{RunID: second, SiteID: "blog"}) {
+		t.Fatal("second run not deferred during the cooldown")
+	}
+	w.mu.Lock()
+	waiting := w.deferred["blog"].runID
+	w.mu.Unlock()
+	if waiting != second {
+		t.Fatalf("deferred run = %d, want %d", waiting, second)
+	}
+	if !w.deferIfThrottled(RunRequest{RunID: third, SiteID: "blog"}) {
+		t.Fatal("third run not deferred during the cooldown")
+	}
+	if run := runState(t, database, third); run.State != db.RunCoalesced || run.CoalescedInto != second {
+		t.Fatalf("third run = %+v", run)
+	}
+	if run := runState(t, database, second); run.State != db.RunQueued {
+		t.Fatalf("deferred run state = %q", run.State)
+	}
+}
@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/publish"
+	"github.com/geschke/fyndmark/pkg/runlog"
+	"github.com/geschke/fyndmark/pkg/sandbox"
+)
+
+// Stages of custom command steps.
+const (
+	StagePreBuild  = "pre_build"  // after generate, before Hugo
+	StagePostBuild = "post_build" // after Hugo, before commit
+	StagePostPush  = "post_push"  // after a successful push
+)
+
+// DefaultCommandTimeout applies to custom commands without timeout_seconds.
+const DefaultCommandTimeout = 5 * time.Minute
+
+// reservedSteps are step names custom commands cannot use.
+var reservedSteps = []string{StepCheckout, StepGenerate, StepHugo, StepCommit, StepPush, StepPublish, StepDeploy, StepDisk, "pipeline", "enqueue"}
+
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidateConfig checks the custom command steps and deploy hooks of all sites.
+func ValidateConfig() error {
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		if err := validateDeployHook(siteCfg.Pipeline.DeployHook); err != nil {
+			return fmt.Errorf("comment_sites.%s.pipeline.deploy_hook: %w", siteKey, err)
+		}
+		if err := publish.Validate(siteCfg.Pipeline.Publish); err != nil {
+			return fmt.Errorf("comment_sites.%s.pipeline.publish: %w", siteKey, err)
+		}
+		if publish.Enabled(siteCfg.Pipeline.Publish) && siteCfg.Git.PullRequest.Enabled {
+			return fmt.Errorf("comment_sites.%s.pipeline.publish cannot be combined with git.pull_request", siteKey)
+		}
+		seen := map[string]bool{}
+		for i, c := range siteCfg.Pipeline.Commands {
+			prefix := fmt.Sprintf("comment_sites.%s.pipeline.commands[%d]", siteKey, i)
+			name := strings.TrimSpace(c.Name)
+			if !commandNamePattern.MatchString(name) {
+				return fmt.Errorf("%s.name must match %s, got %q", prefix, commandNamePattern, c.Name)
+			}
+			if slices.Contains(reservedSteps, name) {
+				return fmt.Errorf("%s.name %q is a built-in step", prefix, name)
+			}
+			if seen[name] {
+				return fmt.Errorf("%s.name %q is used twice", prefix, name)
+			}
+			seen[name] = true
+
+			switch strings.TrimSpace(c.Stage) {
+			case StagePreBuild, StagePostBuild, StagePostPush:
+			default:
+				return fmt.Errorf("%s.stage must be %s, %s or %s, got %q", prefix, StagePreBuild, StagePostBuild, StagePostPush, c.Stage)
+			}
+			if len(c.Command) == 0 || strings.TrimSpace(c.Command[0]) == "" {
+				return fmt.Errorf("%s.command is required", prefix)
+			}
+			if c.TimeoutSeconds < 0 {
+				return fmt.Errorf("%s.timeout_seconds must be >= 0", prefix)
+			}
+			if dir := strings.TrimSpace(c.Dir); dir != "" && !filepath.IsLocal(dir) {
+				return fmt.Errorf("%s.dir must be a relative path inside the workdir, got %q", prefix, c.Dir)
+			}
+		}
+	}
+	return nil
+}
+
+// CommandTimeout returns the timeout of a custom command step.
+func CommandTimeout(c config.PipelineCommandConfig) time.Duration {
+	if c.TimeoutSeconds > 0 {
+		return time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return DefaultCommandTimeout
+}
+
+// runCommands runs the custom commands of a stage in configured order. On failure it
+// returns the name of the failed step.
+func (r *Runner) runCommands(ctx context.Context, runID int64, cfg config.PipelineConfig, workdir, stage string) (string, error) {
+	for _, c := range cfg.Commands {
+		if strings.TrimSpace(c.Stage) != stage {
+			continue
+		}
+		name := strings.TrimSpace(c.Name)
+		if err := r.DB.MarkRunStep(runID, name); err != nil {
+			return name, err
+		}
+		err := r.runStepTimeout(ctx, runID, name, CommandTimeout(c), func(ctx context.Context) error {
+			return runCommand(ctx, workdir, c)
+		})
+		if err == nil {
+			continue
+		}
+		if !c.AllowFailure {
+			return name, err
+		}
+		r.appendRunLog(ctx, runID, name, "WARN: "+err.Error()+" (allow_failure, continuing)\n")
+	}
+	return "", nil
+}
+
+// runCommand runs a custom command in the site's workdir.
+func runCommand(ctx context.Context, workdir string, c config.PipelineCommandConfig) error {
+	dir := workdir
+	if d := strings.TrimSpace(c.Dir); d != "" {
+		dir = filepath.Join(workdir, d)
+	}
+
+	keys := make([]string, 0, len(c.Env))
+	for k := range c.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, k+"="+c.Env[k])
+	}
+
+	out := runlog.NewCapture(ctx, 0)
+	defer out.Close()
+
+	cmd, err := sandbox.Command(ctx, "command", c.Command[0], dir, env, c.Command[1:]...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command %s failed: %w: %s", strings.TrimSpace(c.Name), err, out.Tail())
+	}
+	return nil
+}
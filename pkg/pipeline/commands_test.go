@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+func TestValidateConfigCommands(t *testing.T) {
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+
+	valid := config.PipelineCommandConfig{Name: "css", Stage: StagePreBuild, Command: []string{"npm", "run", "css"}, Dir: "themes/blog"}
+	with := func(change func(*config.PipelineCommandConfig)) config.PipelineCommandConfig {
+		c := valid
+		change(&c)
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		commands []config.PipelineCommandConfig
+		wantErr  string
+	}{
+		{"valid", []config.PipelineCommandConfig{valid, with(func(c *config.PipelineCommandConfig) { c.Name = "purge"; c.Stage = StagePostPush; c.Dir = "" })}, ""},
+		{"bad name", []config.PipelineCommandConfig{with(func(c *config.PipelineCommandConfig) { c.Name = "Build CSS" })}, "name must match"},
+		{"built-in step", []config.PipelineCommandConfig{with(func(c *config.PipelineCommandConfig) { c.Name = StepHugo })}, "is a built-in step"},
+		{"reserved name", []config.PipelineCommandConfig{with(func(c *config.PipelineCommandConfig) { c.Name = "pipeline" })}, "is a built-in step"},
+		{"duplicate name", []config.PipelineCommandConfig{valid, with(func(c *config.PipelineCommandConfig) { c.Stage = StagePostBuild })}, "is used twice"},
+		{"bad stage", []config.PipelineCommandConfig{with(func(c *config.PipelineCommandConfig) { c.Stage = "pre_push" })}, "stage must be"},
+		{"no command", []config.PipelineCommandConfig{with(func(c *config.PipelineCommandConfig) { c.Command = nil })}, "command is required"},
+		{"blank command", []config.PipelineCommandConfig{with(func(c *config.PipelineCommandConfig) { c.Command = []string{" "} })}, "command is required"},
+		{"negative timeout", []config.PipelineCommandConfig{with(func(c *config.PipelineCommandConfig) { c.TimeoutSeconds = -1 })}, "timeout_seconds must be >= 0"},
+		{"dir outside workdir", []config.PipelineCommandConfig{with(func(c *config.PipelineCommandConfig) { c.Dir = "../other" })}, "dir must be a relative path"},
+		{"absolute dir", []config.PipelineCommandConfig{with(func(c *config.PipelineCommandConfig) { c.Dir = "/tmp" })}, "dir must be a relative path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			siteCfg := config.CommentsSiteConfig{}
+			siteCfg.Pipeline.Commands = tt.commands
+			config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": siteCfg}
+
+			err := ValidateConfig()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	if got := CommandTimeout(config.PipelineCommandConfig{}); got != DefaultCommandTimeout {
+		t.Fatalf("default timeout = %s", got)
+	}
+	if got := CommandTimeout(config.PipelineCommandConfig{TimeoutSeconds: 30}); got != 30*time.Second {
+		t.Fatalf("timeout = %s", got)
+	}
+}
+
+// TestRunCommands runs shell commands as custom steps against a scratch workdir.
+func TestRunCommands(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {}}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "commands.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	siteID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	r := &Runner{DB: database, SiteKey: "blog"}
+
+	workdir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(workdir, "themes"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	readFile := func(rel string) string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(workdir, rel))
+		if err != nil {
+			t.Fatalf("read %s: %v", rel, err)
+		}
+		return strings.TrimSpace(string(b))
+	}
+	stepLogs := func(runID int64, step string) string {
+		t.Helper()
+		chunks, err := database.ListRunLogs(ctx, runID)
+		if err != nil {
+			t.Fatalf("list run logs: %v", err)
+		}
+		var b strings.Builder
+		for _, c := range chunks {
+			if c.Step == step {
+				b.WriteString(c.Content)
+			}
+		}
+		return b.String()
+	}
+
+	cfg := config.PipelineConfig{Commands: []config.PipelineCommandConfig{
+		{Name: "css", Stage: StagePreBuild, Command: []string{"sh", "-c", "echo css >> order.txt; echo hello $GREETING"}, Env: map[string]string{"GREETING": "world"}},
+		{Name: "theme", Stage: StagePreBuild, Dir: "themes", Command: []string{"sh", "-c", "echo theme >> ../order.txt; pwd > where.txt"}},
+		{Name: "flaky", Stage: StagePostBuild, AllowFailure: true, Command: []string{"sh", "-c", "echo oops >&2; exit 3"}},
+		{Name: "after", Stage: StagePostBuild, Command: []string{"sh", "-c", "echo after > after.txt"}},
+		{Name: "purge", Stage: StagePostPush, Command: []string{"sh", "-c", "echo purge >> order.txt"}},
+	}}
+
+	// Only the commands of the stage run, in configured order, with their dir and env.
+	runID, _ := database.CreateRun(siteID, "c1")
+	if step, err := r.runCommands(ctx, runID, cfg, workdir, StagePreBuild); err != nil {
+		t.Fatalf("pre_build failed in %s: %v", step, err)
+	}
+	if got := readFile("order.txt"); got != "css\ntheme" {
+		t.Fatalf("order = %q", got)
+	}
+	if got := readFile("themes/where.txt"); filepath.Base(got) != "themes" {
+		t.Fatalf("theme ran in %q", got)
+	}
+	if logs := stepLogs(runID, "css"); !strings.Contains(logs, "hello world") {
+		t.Fatalf("css logs = %q", logs)
+	}
+	if run := runState(t, database, runID); run.Step != "theme" {
+		t.Fatalf("run step = %q, want theme", run.Step)
+	}
+
+	// A failing command with allow_failure is logged and the stage continues.
+	if step, err := r.runCommands(ctx, runID, cfg, workdir, StagePostBuild); err != nil {
+		t.Fatalf("post_build failed in %s: %v", step, err)
+	}
+	if logs := stepLogs(runID, "flaky"); !strings.Contains(logs, "oops") || !strings.Contains(logs, "WARN: command flaky failed") || !strings.Contains(logs, "(allow_failure, continuing)") {
+		t.Fatalf("flaky logs = %q", logs)
+	}
+	if got := readFile("after.txt"); got != "after" {
+		t.Fatalf("after.txt = %q", got)
+	}
+
+	// Any other failure stops the stage and names the failed step.
+	failing := config.PipelineConfig{Commands: []config.PipelineCommandConfig{
+		{Name: "lint", Stage: StagePreBuild, Command: []string{"sh", "-c", "echo broken link; exit 2"}},
+		{Name: "never", Stage: StagePreBuild, Command: []string{"sh", "-c", "echo never > never.txt"}},
+	}}
+	step, err := r.runCommands(ctx, runID, failing, workdir, StagePreBuild)
+	if step != "lint" || err == nil || !strings.Contains(err.Error(), "command lint failed") || !strings.Contains(err.Error(), "broken link") {
+		t.Fatalf("step %q, err %v", step, err)
+	}
+	if _, err := os.Stat(filepath.Join(workdir, "never.txt")); !os.IsNotExist(err) {
+		t.Fatalf("command after the failed step ran: %v", err)
+	}
+
+	// Commands are stopped after their timeout.
+	slow := config.PipelineConfig{Commands: []config.PipelineCommandConfig{
+		{Name: "slow", Stage: StagePostPush, TimeoutSeconds: 1, Command: []string{"sleep", "5"}},
+	}}
+	start := time.Now()
+	step, err = r.runCommands(ctx, runID, slow, workdir, StagePostPush)
+	if step != "slow" || err == nil || !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Fatalf("step %q, err %v", step, err)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("slow command ran for %s", elapsed)
+	}
+}
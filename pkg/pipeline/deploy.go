@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"net/url"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/runlog"
+	"github.com/geschke/fyndmark/pkg/secrets"
+)
+
+// StepDeploy calls the deploy hook of a site after the push.
+const StepDeploy = "deploy"
+
+// maxDeployResponseBytes limits the part of the hook response kept in the run log.
+const maxDeployResponseBytes = 4 * 1024
+
+// validateDeployHook checks the method and, unless encrypted, the URL of a deploy hook.
+func validateDeployHook(hook config.DeployHookConfig) error {
+	switch strings.ToUpper(strings.TrimSpace(hook.Method)) {
+	case "", http.MethodPost, http.MethodGet, http.MethodPut:
+	default:
+		return fmt.Errorf("method must be POST, GET or PUT, got %q", hook.Method)
+	}
+	raw := strings.TrimSpace(hook.URL)
+	if raw == "" || secrets.IsEncrypted(raw) {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("url must be an http(s) URL")
+	}
+	return nil
+}
+
+// callDeployHook calls the build hook URL of a site and records the response status
+// in the run. Responses other than 2xx fail the step.
+func (r *Runner) callDeployHook(ctx context.Context, runID int64, hook config.DeployHookConfig) error {
+	hookURL, err := secrets.Decrypt(strings.TrimSpace(hook.URL))
+	if err != nil {
+		return fmt.Errorf("deploy_hook.url: %w", err)
+	}
+	method := strings.ToUpper(strings.TrimSpace(hook.Method))
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, hookURL, nil)
+	if err != nil {
+		// The URL usually holds a secret token, so it is not part of the error.
+		return fmt.Errorf("build deploy hook request failed")
+	}
+	req.Header.Set("User-Agent", "fyndmark-pipeline")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("deploy hook request failed: %s", runlog.Redact(strings.ReplaceAll(err.Error(), hookURL, "<deploy_hook.url>")))
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxDeployResponseBytes))
+
+	if err := r.DB.SetRunDeployStatus(context.WithoutCancel(ctx), runID, resp.StatusCode); err != nil {
+		return err
+	}
+	r.appendRunLog(ctx, runID, StepDeploy, fmt.Sprintf("deploy hook responded %s\n%s\n", resp.Status, runlog.Redact(strings.TrimSpace(string(body)))))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("deploy hook responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"expvar"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// StepDisk is recorded as failed step when a disk space or workdir quota check fails.
+const StepDisk = "disk"
+
+const mib = 1024 * 1024
+
+// DiskCheckFailures counts failed disk checks per "<site>/<setting>", where setting is
+// min_free_mb or max_workdir_mb. It is published as expvar fyndmark_disk_check_failures.
+var DiskCheckFailures = expvar.NewMap("fyndmark_disk_check_failures")
+
+// checkDiskSpace verifies the free space on the file system holding the workdir and,
+// if checkWorkdir is set, the size of the workdir itself against the site's limits.
+// It runs before cloning and before Hugo, so a full disk fails the run with a clear
+// message instead of a half-written build.
+func checkDiskSpace(siteKey, workdir string, cfg config.PipelineConfig, checkWorkdir bool) error {
+	if cfg.MinFreeMB > 0 {
+		// The workdir may not exist yet (before the first clone); check the nearest existing parent.
+		dir := existingParent(workdir)
+		free, ok, err := freeBytes(dir)
+		if err != nil {
+			return fmt.Errorf("check free disk space in %q: %w", dir, err)
+		}
+		if ok && free < uint64(cfg.MinFreeMB)*mib {
+			DiskCheckFailures.Add(siteKey+"/min_free_mb", 1)
+			return fmt.Errorf("not enough free disk space in %q: %d MB free, %d MB required (pipeline.min_free_mb)", dir, free/mib, cfg.MinFreeMB)
+		}
+	}
+
+	if checkWorkdir && cfg.MaxWorkdirMB > 0 {
+		size, err := dirSize(workdir)
+		if err != nil {
+			return fmt.Errorf("measure workdir %q: %w", workdir, err)
+		}
+		if size > int64(cfg.MaxWorkdirMB)*mib {
+			DiskCheckFailures.Add(siteKey+"/max_workdir_mb", 1)
+			return fmt.Errorf("workdir %q uses %d MB, limit is %d MB (pipeline.max_workdir_mb)", workdir, size/mib, cfg.MaxWorkdirMB)
+		}
+	}
+
+	return nil
+}
+
+// existingParent returns path or its nearest existing parent directory.
+func existingParent(path string) string {
+	p := filepath.Clean(path)
+	for {
+		if st, err := os.Stat(p); err == nil && st.IsDir() {
+			return p
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return p
+		}
+		p = parent
+	}
+}
+
+// dirSize returns the total size of regular files below dir (0 if dir does not exist).
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
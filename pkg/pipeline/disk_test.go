@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"expvar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// diskFailures returns the value of a DiskCheckFailures counter.
+func diskFailures(key string) int64 {
+	if v, ok := DiskCheckFailures.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	// The counters are process-wide; start from zero with -count > 1.
+	DiskCheckFailures.Init()
+
+	workdir := filepath.Join(t.TempDir(), "site")
+	if err := os.MkdirAll(workdir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workdir, "big.bin"), make([]byte, 2*mib), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Limits that hold count nothing.
+	if err := checkDiskSpace("ok", workdir, config.PipelineConfig{MinFreeMB: 1, MaxWorkdirMB: 3}, true); err != nil {
+		t.Fatalf("within limits: %v", err)
+	}
+	if diskFailures("ok/min_free_mb") != 0 || diskFailures("ok/max_workdir_mb") != 0 {
+		t.Fatal("passed check counted as failure")
+	}
+
+	// The workdir quota is only checked when asked for.
+	cfg := config.PipelineConfig{MaxWorkdirMB: 1}
+	if err := checkDiskSpace("quota", workdir, cfg, false); err != nil {
+		t.Fatalf("quota checked before clone: %v", err)
+	}
+	err := checkDiskSpace("quota", workdir, cfg, true)
+	if err == nil || !strings.Contains(err.Error(), "pipeline.max_workdir_mb") {
+		t.Fatalf("quota: err = %v", err)
+	}
+	if n := diskFailures("quota/max_workdir_mb"); n != 1 {
+		t.Fatalf("quota failures = %d, want 1", n)
+	}
+
+	// No file system has an exabyte free; the check works for workdirs not yet cloned.
+	if _, ok, _ := freeBytes(workdir); !ok {
+		t.Skip("free disk space not available on this platform")
+	}
+	err = checkDiskSpace("full", filepath.Join(workdir, "not", "cloned"), config.PipelineConfig{MinFreeMB: 1 << 40}, false)
+	if err == nil || !strings.Contains(err.Error(), "pipeline.min_free_mb") {
+		t.Fatalf("free space: err = %v", err)
+	}
+	if n := diskFailures("full/min_free_mb"); n != 1 {
+		t.Fatalf("free space failures = %d, want 1", n)
+	}
+}
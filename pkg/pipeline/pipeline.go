@@ -2,13 +2,19 @@
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/geschke/fyndmark/config"
 	"github.com/geschke/fyndmark/pkg/db"
 	"github.com/geschke/fyndmark/pkg/generator"
 	"github.com/geschke/fyndmark/pkg/git"
 	"github.com/geschke/fyndmark/pkg/hugo"
+	"github.com/geschke/fyndmark/pkg/publish"
+	"github.com/geschke/fyndmark/pkg/runlog"
 )
 
 const (
@@ -17,11 +23,31 @@ const (
 	StepHugo     = "hugo"
 	StepCommit   = "commit"
 	StepPush     = "push"
+	// StepPublish uploads the Hugo output after the push (see package publish).
+	StepPublish = "publish"
 )
 
+// StepError is returned by a run that failed in a step.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string { return e.Step + ": " + e.Err.Error() }
+
+func (e *StepError) Unwrap() error { return e.Err }
+
 type Runner struct {
 	DB      *db.DB
 	SiteKey string
+
+	// DryRun skips commit, push and the later steps; see also pipeline.push.
+	DryRun bool
+}
+
+// PushEnabled reports whether runs of a site commit and push (pipeline.push, default true).
+func PushEnabled(cfg config.PipelineConfig) bool {
+	return cfg.Push == nil || *cfg.Push
 }
 
 // Run runs the configured operation.
@@ -78,14 +104,39 @@ func (r *Runner) runWithID(ctx context.Context, runID int64, siteCfg config.Comm
 
 	fail := func(step string, e error) error {
 		_ = r.DB.MarkRunFailed(runID, step, e.Error())
-		return fmt.Errorf("%s: %w", step, e)
+		// Keep the error next to the output of the step.
+		r.appendRunLog(ctx, runID, step, "ERROR: "+e.Error()+"\n")
+		return &StepError{Step: step, Err: e}
+	}
+
+	workdir, err := git.ResolveWorkdir(r.SiteKey)
+	if err != nil {
+		return fail(StepCheckout, err)
 	}
 
-	// 1) Checkout (fresh clone)
+	// Hugo preflight: a missing or incompatible Hugo fails the run before the checkout.
+	if !siteCfg.Hugo.Disabled {
+		if err := r.runStepTimeout(ctx, runID, StepHugo, HugoTimeout(siteCfg), func(ctx context.Context) error {
+			v, err := hugo.Preflight(ctx, r.SiteKey)
+			if err == nil {
+				runlog.Printf(ctx, "Using Hugo %s.\n", v)
+			}
+			return err
+		}); err != nil {
+			return fail(StepHugo, err)
+		}
+	}
+
+	// 1) Checkout (fresh clone). The old workdir is removed, so only free space matters here.
+	if err := checkDiskSpace(r.SiteKey, workdir, siteCfg.Pipeline, false); err != nil {
+		return fail(StepDisk, err)
+	}
 	if err := r.DB.MarkRunStep(runID, StepCheckout); err != nil {
 		return err
 	}
-	if err := git.CheckoutWithContext(ctx, r.SiteKey); err != nil {
+	if err := r.runStep(ctx, runID, siteCfg.Pipeline, StepCheckout, func(ctx context.Context) error {
+		return git.CheckoutWithContext(ctx, r.SiteKey)
+	}); err != nil {
 		return fail(StepCheckout, err)
 	}
 
@@ -94,42 +145,240 @@ func (r *Runner) runWithID(ctx context.Context, runID int64, siteCfg config.Comm
 		return err
 	}
 	g := generator.Generator{
-		DB:      r.DB,
-		SiteKey: r.SiteKey,
+		DB:          r.DB,
+		SiteKey:     r.SiteKey,
+		Incremental: !siteCfg.Generator.FullRebuild,
 	}
-	if err := g.Generate(ctx); err != nil {
+	if err := r.runStep(ctx, runID, siteCfg.Pipeline, StepGenerate, g.Generate); err != nil {
 		return fail(StepGenerate, err)
 	}
+	if len(g.Orphans) > 0 {
+		r.logOrphans(ctx, runID, g.Orphans)
+	}
+	if err := r.DB.SaveRunFiles(ctx, runID, runFiles(g.Manifest)); err != nil {
+		log.Printf("save file manifest failed (site=%s run_id=%d): %v", r.SiteKey, runID, err)
+	}
+
+	if step, err := r.runCommands(ctx, runID, siteCfg.Pipeline, workdir, StagePreBuild); err != nil {
+		return fail(step, err)
+	}
 
 	// 3) Hugo (optional)
 	if !siteCfg.Hugo.Disabled {
+		if err := checkDiskSpace(r.SiteKey, workdir, siteCfg.Pipeline, true); err != nil {
+			return fail(StepDisk, err)
+		}
 		if err := r.DB.MarkRunStep(runID, StepHugo); err != nil {
 			return err
 		}
-		if err := hugo.RunWithContext(ctx, r.SiteKey); err != nil {
+		if err := r.runStepTimeout(ctx, runID, StepHugo, HugoTimeout(siteCfg), func(ctx context.Context) error {
+			return hugo.RunWithContext(ctx, r.SiteKey)
+		}); err != nil {
 			return fail(StepHugo, err)
 		}
 	}
 
+	if step, err := r.runCommands(ctx, runID, siteCfg.Pipeline, workdir, StagePostBuild); err != nil {
+		return fail(step, err)
+	}
+
+	if r.DryRun || !PushEnabled(siteCfg.Pipeline) {
+		reason := "dry run"
+		if !r.DryRun {
+			reason = "pipeline.push is false"
+		}
+		if err := r.DB.MarkRunDryRun(ctx, runID); err != nil {
+			return err
+		}
+		r.appendRunLog(ctx, runID, StepCommit, "Skipping commit and push ("+reason+").\n")
+		// Bundle hashes are not saved: the repository was not updated.
+		return r.DB.MarkRunSuccess(runID)
+	}
+
 	// 4) Commit
 	if err := r.DB.MarkRunStep(runID, StepCommit); err != nil {
 		return err
 	}
-	if err := git.CommitWithContext(ctx, r.SiteKey, "Update generated content"); err != nil {
+	var commitMsg string
+	committed := false
+	if err := r.runStep(ctx, runID, siteCfg.Pipeline, StepCommit, func(ctx context.Context) error {
+		var err error
+		if commitMsg, err = git.CommitMessage(r.SiteKey, r.commitMessageData(ctx, runID)); err != nil {
+			return err
+		}
+		committed, err = git.CommitChanges(ctx, r.SiteKey, commitMsg)
+		return err
+	}); err != nil {
 		return fail(StepCommit, err)
 	}
 
-	// 5) Push
+	// 5) Push, to the site branch or to a run branch with a pull request
+	pullRequest := git.PullRequestsEnabled(siteCfg.Git)
 	if err := r.DB.MarkRunStep(runID, StepPush); err != nil {
 		return err
 	}
-	if err := git.PushWithContext(ctx, r.SiteKey); err != nil {
+	if err := r.runStep(ctx, runID, siteCfg.Pipeline, StepPush, func(ctx context.Context) error {
+		if !pullRequest {
+			return git.PushWithContext(ctx, r.SiteKey)
+		}
+		if !committed {
+			// A pull request without commits is rejected by the providers.
+			r.appendRunLog(ctx, runID, StepPush, "Nothing committed, no pull request opened.\n")
+			return nil
+		}
+		prURL, err := git.PushPullRequest(ctx, r.SiteKey, git.PullRequest{
+			Branch: git.RunBranch(siteCfg.Git, runID),
+			Title:  strings.SplitN(commitMsg, "\n", 2)[0],
+			Body:   fmt.Sprintf("%s\n\nOpened by fyndmark for pipeline run %d of site %s.", commitMsg, runID, r.SiteKey),
+		})
+		if err != nil {
+			return err
+		}
+		r.appendRunLog(ctx, runID, StepPush, "Opened pull request: "+prURL+"\n")
+		return nil
+	}); err != nil {
 		return fail(StepPush, err)
 	}
 
+	// 6) Publish the Hugo output (optional). With pull requests, the site only changes on merge.
+	if publish.Enabled(siteCfg.Pipeline.Publish) && !pullRequest {
+		if err := r.DB.MarkRunStep(runID, StepPublish); err != nil {
+			return err
+		}
+		if err := r.runStep(ctx, runID, siteCfg.Pipeline, StepPublish, func(ctx context.Context) error {
+			return publish.Run(ctx, workdir, siteCfg.Pipeline.Publish)
+		}); err != nil {
+			return fail(StepPublish, err)
+		}
+	}
+
+	// 7) Deploy hook (optional)
+	if strings.TrimSpace(siteCfg.Pipeline.DeployHook.URL) != "" {
+		if err := r.DB.MarkRunStep(runID, StepDeploy); err != nil {
+			return err
+		}
+		if err := r.runStep(ctx, runID, siteCfg.Pipeline, StepDeploy, func(ctx context.Context) error {
+			return r.callDeployHook(ctx, runID, siteCfg.Pipeline.DeployHook)
+		}); err != nil {
+			return fail(StepDeploy, err)
+		}
+	}
+
+	if step, err := r.runCommands(ctx, runID, siteCfg.Pipeline, workdir, StagePostPush); err != nil {
+		return fail(step, err)
+	}
+
 	if err := r.DB.MarkRunSuccess(runID); err != nil {
 		return err
 	}
 
+	// The next run starts from a fresh clone of what was pushed, so the hashes only
+	// describe the repository once the push succeeded. With pull requests, the site
+	// branch only changes on merge, so every run regenerates all bundles.
+	if !pullRequest {
+		if err := r.saveBundleHashes(ctx, g.BundleHashes); err != nil {
+			log.Printf("save bundle hashes failed (site=%s run_id=%d): %v", r.SiteKey, runID, err)
+		}
+	}
+
 	return nil
 }
+
+// commitMessageData returns the commit message data of a run. Lookup errors are
+// logged; the message is then rendered without comment details.
+func (r *Runner) commitMessageData(ctx context.Context, runID int64) git.CommitMessageData {
+	data := git.CommitMessageData{SiteKey: r.SiteKey, RunID: runID}
+
+	run, found, err := r.DB.GetRun(ctx, runID)
+	if err != nil {
+		log.Printf("load run failed (site=%s run_id=%d): %v", r.SiteKey, runID, err)
+		return data
+	}
+	if !found || run.TriggerCommentID == "" {
+		return data
+	}
+	data.CommentID = run.TriggerCommentID
+
+	cm, found, err := r.DB.GetComment(ctx, run.SiteID, run.TriggerCommentID)
+	if err != nil {
+		log.Printf("load trigger comment failed (site=%s run_id=%d): %v", r.SiteKey, runID, err)
+		return data
+	}
+	if found {
+		data.CommentAuthor = cm.Author
+		data.PostPath = cm.PostPath
+	}
+	return data
+}
+
+// runStep runs a step with its timeout and its subprocess output streamed to the run log.
+func (r *Runner) runStep(ctx context.Context, runID int64, cfg config.PipelineConfig, step string, fn func(context.Context) error) error {
+	return r.runStepTimeout(ctx, runID, step, StepTimeout(cfg, step), fn)
+}
+
+// runStepTimeout runs a step with the given timeout and its output streamed to the run log.
+func (r *Runner) runStepTimeout(ctx context.Context, runID int64, step string, timeout time.Duration, fn func(context.Context) error) error {
+	stepCtx, cancel := context.WithTimeout(r.stepContext(ctx, runID, step), timeout)
+	defer cancel()
+
+	err := fn(stepCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", timeout, err)
+	}
+	return err
+}
+
+// stepContext returns a context that streams subprocess output of the step to the run log.
+func (r *Runner) stepContext(ctx context.Context, runID int64, step string) context.Context {
+	return runlog.WithSink(ctx, func(text string) {
+		logCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.DB.AppendRunLog(logCtx, runID, step, text); err != nil {
+			log.Printf("store run log failed (run_id=%d step=%s): %v", runID, step, err)
+		}
+	})
+}
+
+// logOrphans writes the post paths whose comments were skipped to the run log.
+func (r *Runner) logOrphans(ctx context.Context, runID int64, orphans []generator.Orphan) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "WARN: %d post_paths skipped, their approved comments were not written:\n", len(orphans))
+	for _, o := range orphans {
+		fmt.Fprintf(&b, "  %s (%s, %d comments)\n", o.PostPath, o.Reason, o.Comments)
+	}
+	r.appendRunLog(ctx, runID, StepGenerate, b.String())
+}
+
+// appendRunLog writes a message to the run log of a step; failures are only logged.
+func (r *Runner) appendRunLog(ctx context.Context, runID int64, step, text string) {
+	if err := r.DB.AppendRunLog(context.WithoutCancel(ctx), runID, step, text); err != nil {
+		log.Printf("store run log failed (run_id=%d step=%s): %v", runID, step, err)
+	}
+}
+
+// saveBundleHashes stores the bundle hashes of a pushed run for the next incremental run.
+func (r *Runner) saveBundleHashes(ctx context.Context, hashes map[string]string) error {
+	siteID, found, err := r.DB.GetSiteIDByKey(ctx, r.SiteKey)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("site key %q not found in sites table", r.SiteKey)
+	}
+	return r.DB.SaveBundleHashes(ctx, siteID, hashes)
+}
+
+// runFiles converts a generator manifest into the rows stored with the run.
+func runFiles(m generator.Manifest) []db.RunFile {
+	files := make([]db.RunFile, 0, len(m.Created)+len(m.Updated)+len(m.Removed))
+	for _, p := range m.Created {
+		files = append(files, db.RunFile{Action: db.RunFileCreated, Path: p})
+	}
+	for _, p := range m.Updated {
+		files = append(files, db.RunFile{Action: db.RunFileUpdated, Path: p})
+	}
+	for _, p := range m.Removed {
+		files = append(files, db.RunFile{Action: db.RunFileRemoved, Path: p})
+	}
+	return files
+}
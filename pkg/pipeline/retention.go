@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// Retention returns the run retention configured for a site, relative to now.
+func Retention(cfg config.PipelineConfig, now time.Time) db.RunRetention {
+	r := db.RunRetention{KeepRuns: cfg.Retention.KeepRuns}
+	if cfg.Retention.KeepDays > 0 {
+		r.Before = now.AddDate(0, 0, -cfg.Retention.KeepDays).Unix()
+	}
+	return r
+}
+
+// PruneRuns deletes the finished runs of all sites beyond their retention settings.
+func PruneRuns(ctx context.Context, database *db.DB) {
+	now := time.Now()
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		r := Retention(siteCfg.Pipeline, now)
+		if r.KeepRuns <= 0 && r.Before <= 0 {
+			continue
+		}
+		siteID, found, err := database.GetSiteIDByKey(ctx, siteKey)
+		if err != nil || !found {
+			continue
+		}
+		n, err := database.PruneRunsByRetention(ctx, siteID, r)
+		if err != nil {
+			log.Printf("Pruning pipeline runs failed (site=%s): %v", siteKey, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("Deleted %d pipeline runs beyond retention (site=%s)", n, siteKey)
+		}
+	}
+}
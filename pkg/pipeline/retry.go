@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+const (
+	defaultRetryBackoff = time.Minute
+	maxRetryBackoff     = time.Hour
+
+	// retryPollInterval is the time between two checks for due retries.
+	retryPollInterval = 30 * time.Second
+)
+
+// RetryBackoff returns the delay before the next attempt after the given number of
+// failed attempts: the configured backoff, doubled with every further attempt.
+func RetryBackoff(cfg config.PipelineConfig, attempts int) time.Duration {
+	d := defaultRetryBackoff
+	if cfg.RetryBackoffSeconds > 0 {
+		d = time.Duration(cfg.RetryBackoffSeconds) * time.Second
+	}
+	for i := 1; i < attempts && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRetryBackoff)
+}
+
+// scheduleRetry puts a failed run into state retrying if the site allows another
+// attempt. Failures in the generate step are not retried, they do not go away by
+// themselves. Returns true if a retry was scheduled.
+func (w *Worker) scheduleRetry(req RunRequest, runErr error) bool {
+	siteCfg, ok := config.Cfg.CommentSites[req.SiteID]
+	if !ok || siteCfg.Pipeline.MaxAttempts <= 1 {
+		return false
+	}
+	var stepErr *StepError
+	if errors.As(runErr, &stepErr) && stepErr.Step == StepGenerate {
+		return false
+	}
+	if w.stopped.Load() {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	attempts, err := w.db.RunAttempts(ctx, req.RunID)
+	if err != nil {
+		log.Printf("pipeline retry check failed (site=%s run_id=%d): %v", req.SiteID, req.RunID, err)
+		return false
+	}
+	if attempts >= siteCfg.Pipeline.MaxAttempts {
+		return false
+	}
+
+	next := time.Now().Add(RetryBackoff(siteCfg.Pipeline, attempts))
+	if err := w.db.ScheduleRunRetry(ctx, req.RunID, next.Unix()); err != nil {
+		log.Printf("schedule pipeline retry failed (site=%s run_id=%d): %v", req.SiteID, req.RunID, err)
+		return false
+	}
+	log.Printf("pipeline run failed (site=%s run_id=%d attempt=%d/%d): retrying at %s", req.SiteID, req.RunID, attempts, siteCfg.Pipeline.MaxAttempts, next.Format(time.RFC3339))
+	return true
+}
+
+// retryLoop queues runs whose retry is due until the worker stops. Retries are kept
+// in the DB, so they survive a restart.
+func (w *Worker) retryLoop() {
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		due, err := w.db.ClaimDueRetries(ctx, time.Now().Unix())
+		if err != nil {
+			log.Printf("claim pipeline retries failed: %v", err)
+		}
+		for _, r := range due {
+			// Retries skip the debounce window, they waited long enough.
+			req := RunRequest{RunID: r.RunID, SiteID: r.SiteKey, CommentID: r.TriggerCommentID, debounced: true}
+			if err := w.enqueue(req); err != nil {
+				_ = w.db.MarkRunFailed(r.RunID, "enqueue", err.Error())
+			}
+		}
+		cancel()
+	}
+}
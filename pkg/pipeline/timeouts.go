@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/hugo"
+)
+
+// DefaultStepTimeouts apply to steps without configured timeout.
+var DefaultStepTimeouts = map[string]time.Duration{
+	StepCheckout: 5 * time.Minute,
+	StepGenerate: 5 * time.Minute,
+	StepHugo:     hugo.DefaultTimeout,
+	StepCommit:   2 * time.Minute,
+	StepPush:     2 * time.Minute,
+	StepDeploy:   30 * time.Second,
+	StepPublish:  10 * time.Minute,
+}
+
+// StepTimeout returns the timeout of a pipeline step for the given site settings.
+func StepTimeout(cfg config.PipelineConfig, step string) time.Duration {
+	seconds := 0
+	switch step {
+	case StepCheckout:
+		seconds = cfg.Timeouts.CheckoutSeconds
+	case StepGenerate:
+		seconds = cfg.Timeouts.GenerateSeconds
+	case StepHugo:
+		seconds = cfg.Timeouts.HugoSeconds
+	case StepCommit:
+		seconds = cfg.Timeouts.CommitSeconds
+	case StepPush:
+		seconds = cfg.Timeouts.PushSeconds
+	case StepDeploy:
+		seconds = cfg.Timeouts.DeploySeconds
+	case StepPublish:
+		seconds = cfg.Timeouts.PublishSeconds
+	}
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return DefaultStepTimeouts[step]
+}
+
+// HugoTimeout returns the timeout of the Hugo step of a site: pipeline.timeouts.hugo_seconds
+// if set, otherwise hugo.timeout_seconds.
+func HugoTimeout(siteCfg config.CommentsSiteConfig) time.Duration {
+	if siteCfg.Pipeline.Timeouts.HugoSeconds > 0 {
+		return StepTimeout(siteCfg.Pipeline, StepHugo)
+	}
+	return hugo.Timeout(siteCfg.Hugo)
+}
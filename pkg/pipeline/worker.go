@@ -4,14 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/geschke/fyndmark/config"
 	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/webhooks"
 )
 
 const DefaultQueueSize = 32
 
+// interruptGrace is how long Stop waits for a run to return after its drain timeout
+// cancelled it.
+const interruptGrace = 10 * time.Second
+
 var (
 	ErrQueueFull     = errors.New("pipeline queue is full")
 	ErrWorkerStopped = errors.New("pipeline worker stopped")
@@ -21,25 +29,62 @@ type RunRequest struct {
 	RunID     int64
 	SiteID    string
 	CommentID string
+
+	// debounced is set once the run waited out the site's debounce window.
+	debounced bool
 }
 
+// maxDebounceWindows caps how long a stream of runs can postpone a debounced run,
+// in multiples of the debounce window.
+const maxDebounceWindows = 5
+
 type Worker struct {
-	db      *db.DB
-	queue   chan RunRequest
-	stopCh  chan struct{}
-	stopped atomic.Bool
-	wg      sync.WaitGroup
+	db       *db.DB
+	webhooks *webhooks.Dispatcher
+	queue    chan RunRequest
+	stopCh   chan struct{}
+	started  atomic.Bool
+	stopped  atomic.Bool
+	wg       sync.WaitGroup
+
+	// runCtx is the context of pipeline runs; Stop cancels it when the drain timeout ends.
+	runCtx     context.Context
+	cancelRuns context.CancelFunc
+
+	// deferred holds at most one run per site key that waits for the next allowed slot.
+	mu       sync.Mutex
+	deferred map[string]deferredRun
+
+	// debouncing holds at most one run per site key that waits for its debounce window to end.
+	debouncing map[string]*debouncedRun
+}
+
+type debouncedRun struct {
+	runID    int64
+	deadline time.Time
+	timer    *time.Timer
+}
+
+type deferredRun struct {
+	runID int64
+	timer *time.Timer
 }
 
 // NewWorker constructs and returns a new instance.
-func NewWorker(database *db.DB, queueSize int) *Worker {
+func NewWorker(database *db.DB, queueSize int, hooks *webhooks.Dispatcher) *Worker {
 	if queueSize <= 0 {
 		queueSize = DefaultQueueSize
 	}
+	runCtx, cancelRuns := context.WithCancel(context.Background())
 	return &Worker{
-		db:     database,
-		queue:  make(chan RunRequest, queueSize),
-		stopCh: make(chan struct{}),
+		runCtx:     runCtx,
+		cancelRuns: cancelRuns,
+		db:         database,
+		webhooks:   hooks,
+		queue:      make(chan RunRequest, queueSize),
+		stopCh:     make(chan struct{}),
+		deferred:   make(map[string]deferredRun),
+		debouncing: make(map[string]*debouncedRun),
 	}
 }
 
@@ -48,6 +93,8 @@ func (w *Worker) Start() {
 	if w == nil {
 		return
 	}
+	w.started.Store(true)
+	w.requeueStored()
 	w.wg.Add(1)
 	go func() {
 		defer w.wg.Done()
@@ -56,13 +103,55 @@ func (w *Worker) Start() {
 			case <-w.stopCh:
 				return
 			case req := <-w.queue:
+				if w.stopped.Load() {
+					// Stop raced with the queue; the run keeps state queued in the DB.
+					return
+				}
 				w.runOne(req)
 			}
 		}
 	}()
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.retryLoop()
+	}()
 }
 
-// Stop stops processing and releases resources.
+// Running reports whether the worker was started and not stopped.
+func (w *Worker) Running() bool {
+	return w != nil && w.started.Load() && !w.stopped.Load()
+}
+
+// requeueStored queues the runs left in state queued by the previous process, e.g.
+// runs that waited in the queue or were interrupted when it stopped.
+func (w *Worker) requeueStored() {
+	if w.db == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	queued, err := w.db.ListQueuedRuns(ctx)
+	if err != nil {
+		log.Printf("list queued pipeline runs failed: %v", err)
+		return
+	}
+	for i, r := range queued {
+		if err := w.enqueue(RunRequest{RunID: r.RunID, SiteID: r.SiteKey, CommentID: r.TriggerCommentID}); err != nil {
+			log.Printf("pipeline queue full: %d stored runs stay queued until the next start", len(queued)-i)
+			return
+		}
+	}
+	if len(queued) > 0 {
+		log.Printf("queued %d stored pipeline runs", len(queued))
+	}
+}
+
+// Stop stops taking runs from the queue and waits until the running run finished
+// (drains). Runs still in the queue keep state queued and are started by the next
+// process. If ctx ends first, the running run is cancelled and queued again.
 func (w *Worker) Stop(ctx context.Context) error {
 	if w == nil {
 		return nil
@@ -71,6 +160,18 @@ func (w *Worker) Stop(ctx context.Context) error {
 		close(w.stopCh)
 	}
 
+	// Deferred and debounced runs stay queued in the DB; the next process queues them again.
+	w.mu.Lock()
+	for siteKey, d := range w.deferred {
+		d.timer.Stop()
+		delete(w.deferred, siteKey)
+	}
+	for siteKey, d := range w.debouncing {
+		d.timer.Stop()
+		delete(w.debouncing, siteKey)
+	}
+	w.mu.Unlock()
+
 	done := make(chan struct{})
 	go func() {
 		w.wg.Wait()
@@ -79,10 +180,19 @@ func (w *Worker) Stop(ctx context.Context) error {
 
 	select {
 	case <-done:
-		return nil
 	case <-ctx.Done():
+		w.cancelRuns()
+		select {
+		case <-done:
+		case <-time.After(interruptGrace):
+		}
 		return ctx.Err()
 	}
+	w.cancelRuns()
+	if n := len(w.queue); n > 0 {
+		log.Printf("%d pipeline runs stay queued for the next start", n)
+	}
+	return nil
 }
 
 // EnqueueRun performs its package-specific operation.
@@ -94,12 +204,15 @@ func (w *Worker) EnqueueRun(runID int64, siteID, commentID string) error {
 		return ErrWorkerStopped
 	}
 
-	req := RunRequest{
+	return w.enqueue(RunRequest{
 		RunID:     runID,
 		SiteID:    siteID,
 		CommentID: commentID,
-	}
+	})
+}
 
+// enqueue adds a run to the queue without blocking.
+func (w *Worker) enqueue(req RunRequest) error {
 	select {
 	case w.queue <- req:
 		return nil
@@ -114,12 +227,251 @@ func (w *Worker) runOne(req RunRequest) {
 		return
 	}
 
+	// Runs cancelled while they waited in the queue are not started.
+	if queued, err := w.db.IsRunQueued(context.Background(), req.RunID); err != nil {
+		log.Printf("pipeline run state check failed (site=%s run_id=%d): %v", req.SiteID, req.RunID, err)
+	} else if !queued {
+		return
+	}
+
+	if w.holdIfPaused(req) {
+		return
+	}
+	if w.debounce(req) {
+		return
+	}
+	if w.deferIfThrottled(req) {
+		return
+	}
+
 	runner := Runner{
 		DB:      w.db,
 		SiteKey: req.SiteID,
 	}
 
-	if err := runner.RunExisting(context.Background(), req.RunID); err != nil {
+	err := runner.RunExisting(w.runCtx, req.RunID)
+	if err != nil {
 		_ = w.db.MarkRunFailed(req.RunID, "pipeline", fmt.Sprintf("run failed: %v", err))
+		if w.runCtx.Err() != nil {
+			w.requeueInterrupted(req)
+			return
+		}
+		if w.scheduleRetry(req, err) {
+			return
+		}
+	}
+	w.notifyRunFinished(req, err)
+}
+
+// requeueInterrupted puts a run cancelled by Stop back into state queued, so the
+// next process runs it again from the start.
+func (w *Worker) requeueInterrupted(req RunRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := w.db.RequeueRun(ctx, req.RunID); err != nil {
+		log.Printf("requeue interrupted pipeline run failed (site=%s run_id=%d): %v", req.SiteID, req.RunID, err)
+		return
+	}
+	if err := w.db.AppendRunLog(ctx, req.RunID, "pipeline", "Interrupted by shutdown, queued again.\n"); err != nil {
+		log.Printf("append run log failed (run_id=%d): %v", req.RunID, err)
+	}
+	log.Printf("pipeline run interrupted by shutdown (site=%s run_id=%d): queued again", req.SiteID, req.RunID)
+}
+
+// notifyRunFinished fires the pipeline webhook event for a finished run.
+func (w *Worker) notifyRunFinished(req RunRequest, runErr error) {
+	if w.webhooks == nil {
+		return
+	}
+
+	event := webhooks.EventPipelineSuccess
+	data := map[string]any{
+		"run_id":             req.RunID,
+		"trigger_comment_id": req.CommentID,
+		"state":              db.RunSuccess,
+	}
+	if runErr != nil {
+		event = webhooks.EventPipelineFailed
+		data["state"] = db.RunFailed
+		data["error"] = runErr.Error()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	w.webhooks.Fire(ctx, req.SiteID, event, data)
+}
+
+// holdIfPaused keeps a run in state paused while the site's pipeline is paused.
+// Resuming the site releases the newest held run (see db.ReleasePausedRuns).
+func (w *Worker) holdIfPaused(req RunRequest) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	siteID, found, err := w.db.GetSiteIDByKey(ctx, req.SiteID)
+	if err != nil || !found {
+		return false
+	}
+	held, err := w.db.HoldRunIfPaused(ctx, req.RunID, siteID)
+	if err != nil {
+		log.Printf("pipeline pause check failed (site=%s run_id=%d): %v", req.SiteID, req.RunID, err)
+		return false
+	}
+	if held {
+		log.Printf("pipeline paused (site=%s run_id=%d): run held back", req.SiteID, req.RunID)
+	}
+	return held
+}
+
+// debounce holds a run back until the site's debounce window passed without another
+// run being queued. Runs arriving in the meantime are coalesced into the waiting run and
+// restart the window, at most maxDebounceWindows windows after the first one arrived.
+// Returns true if the run was held back or coalesced.
+func (w *Worker) debounce(req RunRequest) bool {
+	if req.debounced {
+		return false
+	}
+	siteCfg, ok := config.Cfg.CommentSites[req.SiteID]
+	if !ok || siteCfg.Pipeline.DebounceSeconds <= 0 {
+		return false
+	}
+	window := time.Duration(siteCfg.Pipeline.DebounceSeconds) * time.Second
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped.Load() {
+		return true
+	}
+
+	now := time.Now()
+	if d, exists := w.debouncing[req.SiteID]; exists && d.runID != req.RunID && !w.isWaiting(d.runID) {
+		// The waiting run was cancelled; this run takes its place.
+		d.timer.Stop()
+		delete(w.debouncing, req.SiteID)
+	}
+	if d, exists := w.debouncing[req.SiteID]; exists {
+		if d.runID != req.RunID {
+			// Generation always rebuilds from the DB, so the waiting run covers this one too.
+			if err := w.db.MarkRunCoalesced(req.RunID, d.runID); err != nil {
+				log.Printf("mark run coalesced failed (site=%s run_id=%d): %v", req.SiteID, req.RunID, err)
+			}
+		}
+		d.timer.Reset(min(window, d.deadline.Sub(now)))
+		return true
+	}
+
+	req.debounced = true
+	w.debouncing[req.SiteID] = &debouncedRun{
+		runID:    req.RunID,
+		deadline: now.Add(maxDebounceWindows * window),
+		timer:    time.AfterFunc(window, func() { w.releaseDebounced(req) }),
+	}
+	return true
+}
+
+// isWaiting reports whether a debounced or deferred run is still queued, i.e. was
+// not cancelled while it waited. Check errors count as waiting.
+func (w *Worker) isWaiting(runID int64) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	queued, err := w.db.IsRunQueued(ctx, runID)
+	if err != nil {
+		log.Printf("pipeline run state check failed (run_id=%d): %v", runID, err)
+		return true
+	}
+	return queued
+}
+
+// releaseDebounced puts a debounced run back into the queue once its window ended.
+func (w *Worker) releaseDebounced(req RunRequest) {
+	w.mu.Lock()
+	d, exists := w.debouncing[req.SiteID]
+	if !exists || d.runID != req.RunID {
+		// Already released; the timer was reset while it fired.
+		w.mu.Unlock()
+		return
+	}
+	d.timer.Stop()
+	delete(w.debouncing, req.SiteID)
+	w.mu.Unlock()
+
+	select {
+	case <-w.stopCh:
+	case w.queue <- req:
+	}
+}
+
+// deferIfThrottled checks the site's cooldown and daily budget. If the run may not
+// start yet, it is either scheduled for the next allowed slot or, when another run
+// is already waiting for that slot, coalesced into it. Returns true if the run was
+// deferred or coalesced.
+func (w *Worker) deferIfThrottled(req RunRequest) bool {
+	siteCfg, ok := config.Cfg.CommentSites[req.SiteID]
+	if !ok {
+		return false
+	}
+	if siteCfg.Pipeline.CooldownSeconds <= 0 && siteCfg.Pipeline.DailyBudget <= 0 {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	siteID, found, err := w.db.GetSiteIDByKey(ctx, req.SiteID)
+	if err != nil || !found {
+		return false
+	}
+
+	now := time.Now()
+	next, err := nextAllowedRun(ctx, w.db, siteID, siteCfg.Pipeline, now)
+	if err != nil {
+		log.Printf("pipeline budget check failed (site=%s run_id=%d): %v", req.SiteID, req.RunID, err)
+		return false
+	}
+	if next.IsZero() {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stopped.Load() {
+		return true
+	}
+
+	if d, exists := w.deferred[req.SiteID]; exists && d.runID != req.RunID && !w.isWaiting(d.runID) {
+		// The waiting run was cancelled; this run takes its place.
+		d.timer.Stop()
+		delete(w.deferred, req.SiteID)
+	}
+	if d, exists := w.deferred[req.SiteID]; exists && d.runID != req.RunID {
+		// Generation always rebuilds from the DB, so the waiting run covers this one too.
+		if err := w.db.MarkRunCoalesced(req.RunID, d.runID); err != nil {
+			log.Printf("mark run coalesced failed (site=%s run_id=%d): %v", req.SiteID, req.RunID, err)
+		}
+		return true
+	}
+
+	log.Printf("pipeline throttled (site=%s run_id=%d): deferred until %s", req.SiteID, req.RunID, next.Format(time.RFC3339))
+	w.deferred[req.SiteID] = deferredRun{
+		runID: req.RunID,
+		timer: time.AfterFunc(next.Sub(now), func() { w.releaseDeferred(req) }),
+	}
+	return true
+}
+
+// releaseDeferred puts a deferred run back into the queue once its slot is reached.
+func (w *Worker) releaseDeferred(req RunRequest) {
+	w.mu.Lock()
+	if d, exists := w.deferred[req.SiteID]; exists && d.runID == req.RunID {
+		delete(w.deferred, req.SiteID)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.stopCh:
+	case w.queue <- req:
 	}
 }
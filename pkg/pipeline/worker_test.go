@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// newDebounceWorker returns a worker that is not started, for the sites "blog" with
+// the given debounce window and "docs" without one.
+func newDebounceWorker(t *testing.T, debounceSeconds int) (*Worker, *db.DB, int64) {
+	t.Helper()
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	siteCfg := config.CommentsSiteConfig{}
+	siteCfg.Pipeline.DebounceSeconds = debounceSeconds
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": siteCfg, "docs": {}}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "worker.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "docs": "Docs"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	siteID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+
+	w := NewWorker(database, 0, nil)
+	t.Cleanup(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for _, d := range w.debouncing {
+			d.timer.Stop()
+		}
+	})
+	return w, database, siteID
+}
+
+// waitingRun returns the run of the site that waits for its debounce window, or 0.
+func waitingRun(w *Worker, siteKey string) int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if d, ok := w.debouncing[siteKey]; ok {
+		return d.runID
+	}
+	return 0
+}
+
+// runState returns a run or fails the test.
+func runState(t *testing.T, database *db.DB, runID int64) db.Run {
+	t.Helper()
+	run, found, err := database.GetRun(context.Background(), runID)
+	if err != nil || !found {
+		t.Fatalf("get run %d: %v %v", runID, found, err)
+	}
+	return run
+}
+
+// TestDebounce checks that runs arriving during the window are coalesced into the
+// waiting run, which is queued again once the window ends.
+func TestDebounce(t *testing.T) {
+	w, database, siteID := newDebounceWorker(t, 1)
+
+	// Sites without a window are not held back.
+	if w.debounce(RunRequest{RunID: 99, SiteID: "docs"}) {
+		t.Fatal("run of a site without debounce window was held back")
+	}
+
+	first, _ := database.CreateRun(siteID, "c1")
+	second, _ := database.CreateRun(siteID, "c2")
+	start := time.Now()
+	if !w.debounce(RunRequest{RunID: first, SiteID: "blog"}) || waitingRun(w, "blog") != first {
+		t.Fatalf("first run not held back, waiting run %d", waitingRun(w, "blog"))
+	}
+	if !w.debounce(RunRequest{RunID: second, SiteID: "blog"}) {
+		t.Fatal("second run not held back")
+	}
+	if run := runState(t, database, second); run.State != db.RunCoalesced || run.CoalescedInto != first {
+		t.Fatalf("second run = %+v", run)
+	}
+	if run := runState(t, database, first); run.State != db.RunQueued {
+		t.Fatalf("waiting run state = %q", run.State)
+	}
+
+	// The waiting run is queued again after the window, marked as debounced.
+	select {
+	case req := <-w.queue:
+		if req.RunID != first || !req.debounced || time.Since(start) < 900*time.Millisecond {
+			t.Fatalf("released %+v after %s", req, time.Since(start))
+		}
+		if w.debounce(req) {
+			t.Fatal("released run held back again")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("debounced run not released")
+	}
+	if waitingRun(w, "blog") != 0 {
+		t.Fatalf("run %d still waiting", waitingRun(w, "blog"))
+	}
+
+	// A steady stream of runs cannot postpone the waiting run past its deadline.
+	third, _ := database.CreateRun(siteID, "c3")
+	fourth, _ := database.CreateRun(siteID, "c4")
+	w.debounce(RunRequest{RunID: third, SiteID: "blog"})
+	w.mu.Lock()
+	w.debouncing["blog"].deadline = time.Now().Add(100 * time.Millisecond)
+	w.mu.Unlock()
+	start = time.Now()
+	w.debounce(RunRequest{RunID: fourth, SiteID: "blog"})
+	select {
+	case req := <-w.queue:
+		if req.RunID != third || time.Since(start) > 700*time.Millisecond {
+			t.Fatalf("released %+v after %s", req, time.Since(start))
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("debounced run not released at its deadline")
+	}
+}
+
+// TestDebounceCancelledRun checks that runs are not coalesced into a debounced run
+// that was cancelled while it waited, and that a run covering coalesced runs cannot
+// be cancelled.
+func TestDebounceCancelledRun(t *testing.T) {
+	w, database, siteID := newDebounceWorker(t, 3600)
+	ctx := context.Background()
+	state := func(runID int64) db.Run {
+		t.Helper()
+		return runState(t, database, runID)
+	}
+	waiting := func() int64 {
+		return waitingRun(w, "blog")
+	}
+
+	first, _ := database.CreateRun(siteID, "c1")
+	w.runOne(RunRequest{RunID: first, SiteID: "blog"})
+	if waiting() != first {
+		t.Fatalf("debounced run = %d, want %d", waiting(), first)
+	}
+
+	// The waiting run is cancelled; the next run replaces it instead of being
+	// coalesced into it.
+	if ok, err := database.CancelRun(ctx, first); err != nil || !ok {
+		t.Fatalf("cancel first run = %v %v", ok, err)
+	}
+	second, _ := database.CreateRun(siteID, "c2")
+	w.runOne(RunRequest{RunID: second, SiteID: "blog"})
+	if waiting() != second || state(second).State != db.RunQueued {
+		t.Fatalf("debounced run = %d, second run state %q", waiting(), state(second).State)
+	}
+
+	// Once a run is coalesced into it, the waiting run cannot be cancelled.
+	third, _ := database.CreateRun(siteID, "c3")
+	w.runOne(RunRequest{RunID: third, SiteID: "blog"})
+	if run := state(third); run.State != db.RunCoalesced || run.CoalescedInto != second {
+		t.Fatalf("third run = %+v", run)
+	}
+	if ok, err := database.CancelRun(ctx, second); err != nil || ok {
+		t.Fatalf("cancel run with coalesced runs = %v %v", ok, err)
+	}
+	if waiting() != second || state(second).State != db.RunQueued {
+		t.Fatalf("debounced run = %d, second run state %q", waiting(), state(second).State)
+	}
+}
@@ -0,0 +1,95 @@
+// Package publish uploads the Hugo output of a site to a web server (rsync) or an S3
+// compatible bucket, for sites that are built by Fyndmark instead of an external CI.
+package publish
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// Publish types of pipeline.publish.type.
+const (
+	TypeRsync = "rsync"
+	TypeS3    = "s3"
+)
+
+// DefaultDir is the Hugo output directory published if pipeline.publish.dir is unset.
+const DefaultDir = "public"
+
+// Enabled reports whether a site publishes its Hugo output.
+func Enabled(cfg config.PublishConfig) bool {
+	return strings.TrimSpace(cfg.Type) != ""
+}
+
+// Dir returns the published directory relative to the workdir.
+func Dir(cfg config.PublishConfig) string {
+	if dir := strings.TrimSpace(cfg.Dir); dir != "" {
+		return dir
+	}
+	return DefaultDir
+}
+
+// Validate checks the publish settings of a site.
+func Validate(cfg config.PublishConfig) error {
+	if !Enabled(cfg) {
+		return nil
+	}
+	if !filepath.IsLocal(Dir(cfg)) {
+		return fmt.Errorf("dir must be a relative path inside the workdir, got %q", cfg.Dir)
+	}
+
+	switch strings.TrimSpace(cfg.Type) {
+	case TypeRsync:
+		target := strings.TrimSpace(cfg.Rsync.Target)
+		if target == "" {
+			return fmt.Errorf("rsync.target is required")
+		}
+		if strings.HasPrefix(target, "-") {
+			return fmt.Errorf("rsync.target must not start with -")
+		}
+	case TypeS3:
+		s3 := cfg.S3
+		if strings.TrimSpace(s3.Bucket) == "" {
+			return fmt.Errorf("s3.bucket is required")
+		}
+		if strings.TrimSpace(s3.AccessKeyID) == "" || strings.TrimSpace(s3.SecretAccessKey) == "" {
+			return fmt.Errorf("s3.access_key_id and s3.secret_access_key are required")
+		}
+		if strings.HasPrefix(strings.TrimSpace(s3.Prefix), "/") {
+			return fmt.Errorf("s3.prefix must not start with /")
+		}
+		if raw := strings.TrimSpace(s3.Endpoint); raw != "" {
+			u, err := url.Parse(raw)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("s3.endpoint must be an http(s) URL")
+			}
+		}
+	default:
+		return fmt.Errorf("type must be %s or %s, got %q", TypeRsync, TypeS3, cfg.Type)
+	}
+	return nil
+}
+
+// Run publishes the output directory of a site's workdir.
+func Run(ctx context.Context, workdir string, cfg config.PublishConfig) error {
+	src := filepath.Join(workdir, Dir(cfg))
+	st, err := os.Stat(src)
+	if err != nil || !st.IsDir() {
+		return fmt.Errorf("output directory %s not found (is the Hugo step enabled?)", Dir(cfg))
+	}
+
+	switch strings.TrimSpace(cfg.Type) {
+	case TypeRsync:
+		return runRsync(ctx, src, cfg)
+	case TypeS3:
+		return syncS3(ctx, src, cfg)
+	default:
+		return fmt.Errorf("unknown publish type %q", cfg.Type)
+	}
+}
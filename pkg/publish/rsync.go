@@ -0,0 +1,56 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/runlog"
+	"github.com/geschke/fyndmark/pkg/sandbox"
+)
+
+// rsyncArgs returns the arguments of
+// rsync -az [--delete] -e "ssh ..." [args...] <src>/ <target>
+func rsyncArgs(src string, cfg config.PublishConfig) []string {
+	rc := cfg.Rsync
+	args := []string{"-az"}
+	if cfg.Delete {
+		args = append(args, "--delete")
+	}
+
+	// ssh must never prompt; rsync splits the command at spaces but honors quotes.
+	rsh := []string{"ssh", "-o", "BatchMode=yes"}
+	if key := strings.TrimSpace(rc.SSHKey); key != "" {
+		rsh = append(rsh, "-i", "'"+key+"'", "-o", "IdentitiesOnly=yes")
+	}
+	if kh := strings.TrimSpace(rc.KnownHosts); kh != "" {
+		rsh = append(rsh, "-o", "'UserKnownHostsFile="+kh+"'", "-o", "StrictHostKeyChecking=yes")
+	} else {
+		rsh = append(rsh, "-o", "StrictHostKeyChecking=accept-new")
+	}
+	args = append(args, "-e", strings.Join(rsh, " "))
+
+	args = append(args, rc.Args...)
+	return append(args, strings.TrimRight(src, "/")+"/", strings.TrimSpace(rc.Target))
+}
+
+// runRsync copies src to the rsync target. It runs like custom pipeline commands,
+// including the sandbox setting for "command".
+func runRsync(ctx context.Context, src string, cfg config.PublishConfig) error {
+	out := runlog.NewCapture(ctx, 0)
+	defer out.Close()
+
+	cmd, err := sandbox.Command(ctx, "command", "rsync", src, nil, rsyncArgs(src, cfg)...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rsync failed: %w: %s", err, out.Tail())
+	}
+	runlog.Printf(ctx, "Published %s to %s.\n", Dir(cfg), strings.TrimSpace(cfg.Rsync.Target))
+	return nil
+}
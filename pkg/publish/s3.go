@@ -0,0 +1,371 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/runlog"
+	"github.com/geschke/fyndmark/pkg/secrets"
+)
+
+// DefaultRegion is used if pipeline.publish.s3.region is unset.
+const DefaultRegion = "us-east-1"
+
+// maxS3ErrorBytes limits the part of an S3 error response kept in the error.
+const maxS3ErrorBytes = 1024
+
+// s3Client is a minimal S3 client: list, put and delete objects, signed with AWS
+// Signature Version 4. It supports AWS and S3 compatible services (R2, MinIO).
+type s3Client struct {
+	cfg    config.PublishS3Config
+	secret string
+	client *http.Client
+}
+
+// s3Object is an object of a bucket listing.
+type s3Object struct {
+	ETag string
+	Size int64
+}
+
+// syncS3 uploads new and changed files of src and, with delete, removes objects that
+// no longer exist locally. Unchanged files are detected by their MD5 ETag.
+func syncS3(ctx context.Context, src string, cfg config.PublishConfig) error {
+	c, err := newS3Client(cfg.S3)
+	if err != nil {
+		return err
+	}
+	prefix := strings.TrimSpace(cfg.S3.Prefix)
+
+	remote, err := c.list(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	uploaded, unchanged, deleted := 0, 0, 0
+	local := map[string]bool{}
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		key := prefix + filepath.ToSlash(rel)
+		local[key] = true
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(b)
+		if obj, ok := remote[key]; ok && obj.Size == int64(len(b)) && obj.ETag == hex.EncodeToString(sum[:]) {
+			unchanged++
+			return nil
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(path))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := http.Header{}
+		header.Set("Content-Type", contentType)
+		if err := c.put(ctx, key, b, header); err != nil {
+			return err
+		}
+		uploaded++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.Delete {
+		keys := make([]string, 0, len(remote))
+		for key := range remote {
+			if !local[key] {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := c.delete(ctx, key); err != nil {
+				return err
+			}
+			deleted++
+		}
+	}
+
+	runlog.Printf(ctx, "Published to s3://%s/%s: %d uploaded, %d unchanged, %d deleted.\n",
+		strings.TrimSpace(cfg.S3.Bucket), prefix, uploaded, unchanged, deleted)
+	return nil
+}
+
+// newS3Client returns a client of the bucket in cfg; the secret key may be encrypted.
+func newS3Client(cfg config.PublishS3Config) (*s3Client, error) {
+	secret, err := secrets.Decrypt(strings.TrimSpace(cfg.SecretAccessKey))
+	if err != nil {
+		return nil, fmt.Errorf("s3.secret_access_key: %w", err)
+	}
+	return &s3Client{cfg: cfg, secret: secret, client: &http.Client{Timeout: 2 * time.Minute}}, nil
+}
+
+// S3Bucket gives other packages, such as the database backups, access to a bucket
+// configured like the S3 publish target. Keys are used as given, without cfg.Prefix.
+type S3Bucket struct {
+	c *s3Client
+}
+
+// NewS3Bucket returns the bucket of cfg.
+func NewS3Bucket(cfg config.PublishS3Config) (*S3Bucket, error) {
+	c, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3Bucket{c: c}, nil
+}
+
+// Keys returns the sorted keys of the objects below prefix.
+func (b *S3Bucket) Keys(ctx context.Context, prefix string) ([]string, error) {
+	objects, err := b.c.list(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Put uploads an object.
+func (b *S3Bucket) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	return b.c.put(ctx, key, body, header)
+}
+
+// Delete removes an object.
+func (b *S3Bucket) Delete(ctx context.Context, key string) error {
+	return b.c.delete(ctx, key)
+}
+
+// list returns the objects below prefix by key.
+func (c *s3Client) list(ctx context.Context, prefix string) (map[string]s3Object, error) {
+	out := map[string]s3Object{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key  string
+				ETag string
+				Size int64
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list: decode response: %w", err)
+		}
+		for _, o := range result.Contents {
+			out[o.Key] = s3Object{ETag: strings.Trim(o.ETag, `"`), Size: o.Size}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return out, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// put uploads an object.
+func (c *s3Client) put(ctx context.Context, key string, body []byte, header http.Header) error {
+	resp, err := c.do(ctx, http.MethodPut, key, nil, body, header)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// delete removes an object.
+func (c *s3Client) delete(ctx context.Context, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// do sends a signed request for an object key ("" for the bucket). Responses other
+// than 2xx are returned as error.
+func (c *s3Client) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	u, err := c.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	payload := sha256.Sum256(body)
+	signV4(req, hex.EncodeToString(payload[:]), strings.TrimSpace(c.cfg.AccessKeyID), c.secret, c.region(), time.Now())
+	req.Header.Set("User-Agent", "fyndmark-pipeline")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", method, key, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxS3ErrorBytes))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
+
+// region returns the configured region or DefaultRegion.
+func (c *s3Client) region() string {
+	if region := strings.TrimSpace(c.cfg.Region); region != "" {
+		return region
+	}
+	return DefaultRegion
+}
+
+// objectURL returns the URL of an object: virtual-hosted style for AWS, path style
+// for custom endpoints.
+func (c *s3Client) objectURL(key string) (*url.URL, error) {
+	bucket := strings.TrimSpace(c.cfg.Bucket)
+	var u *url.URL
+	if endpoint := strings.TrimSpace(c.cfg.Endpoint); endpoint != "" {
+		var err error
+		if u, err = url.Parse(strings.TrimRight(endpoint, "/")); err != nil {
+			return nil, fmt.Errorf("s3.endpoint: %w", err)
+		}
+		u.Path += "/" + bucket + "/" + key
+	} else {
+		u = &url.URL{Scheme: "https", Host: bucket + ".s3." + c.region() + ".amazonaws.com", Path: "/" + key}
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	return u, nil
+}
+
+// signV4 sets the x-amz-date, x-amz-content-sha256 and Authorization headers of req.
+// All headers set on req except User-Agent are signed.
+func signV4(req *http.Request, payloadHash, accessKey, secret, region string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		name := strings.ToLower(k)
+		if name == "authorization" || name == "user-agent" {
+			continue
+		}
+		headers[name] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secret), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		",SignedHeaders="+signedHeaders+",Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by name, as required by Signature Version 4.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, v := range query[name] {
+			parts = append(parts, s3Escape(name, true)+"="+s3Escape(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes all bytes except unreserved characters (RFC 3986) and,
+// unless encodeSlash, the slash.
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+// Package ratelimit implements an in-memory token bucket limiter keyed by arbitrary strings.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is the minimum time between two removals of idle buckets.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is the time at which the bucket is refilled completely and can be forgotten.
+	full time.Time
+}
+
+// Limiter holds one token bucket per key. The zero value is not usable; use New.
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New returns an empty limiter.
+func New() *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key. The bucket holds up to limit tokens and
+// is refilled at limit tokens per window. If no token is available, Allow returns false
+// and the time until the next token is available.
+// A limit <= 0 or window <= 0 always allows.
+func (l *Limiter) Allow(key string, limit int, window time.Duration) (bool, time.Duration) {
+	if l == nil || limit <= 0 || window <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	rate := float64(limit) / window.Seconds() // tokens per second
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit), updated: now}
+		l.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.updated).Seconds()
+		if elapsed > 0 {
+			b.tokens = math.Min(float64(limit), b.tokens+elapsed*rate)
+		}
+		b.updated = now
+	}
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	b.full = now.Add(time.Duration((float64(limit) - b.tokens) / rate * float64(time.Second)))
+	return true, 0
+}
+
+// sweep removes buckets that are full again, so idle keys do not accumulate.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowRefill(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := New()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("ip|1.2.3.4", 3, time.Minute); !ok {
+			t.Fatalf("request %d: expected allow", i+1)
+		}
+	}
+
+	ok, wait := l.Allow("ip|1.2.3.4", 3, time.Minute)
+	if ok {
+		t.Fatal("expected limit after 3 requests")
+	}
+	if wait != 20*time.Second {
+		t.Fatalf("wait = %v, want 20s", wait)
+	}
+
+	if ok, _ := l.Allow("ip|5.6.7.8", 3, time.Minute); !ok {
+		t.Fatal("other key must not be limited")
+	}
+
+	now = now.Add(20 * time.Second)
+	if ok, _ := l.Allow("ip|1.2.3.4", 3, time.Minute); !ok {
+		t.Fatal("expected allow after refill")
+	}
+}
+
+func TestAllowSweep(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := New()
+	l.now = func() time.Time { return now }
+
+	l.Allow("a", 2, time.Minute)
+	now = now.Add(2 * time.Minute)
+	l.Allow("b", 2, time.Minute)
+
+	if _, ok := l.buckets["a"]; ok {
+		t.Fatal("idle bucket was not removed")
+	}
+}
+
+func TestAllowDisabled(t *testing.T) {
+	var l *Limiter
+	if ok, _ := l.Allow("x", 0, 0); !ok {
+		t.Fatal("nil limiter must allow")
+	}
+}
@@ -0,0 +1,198 @@
+// Package redis is a minimal Redis client. It speaks the subset of the protocol
+// fyndmark needs over a single connection that is re-established after errors.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultTimeout is used for commands whose context has no deadline.
+const defaultTimeout = 2 * time.Second
+
+// ErrNil is returned by Do for a null bulk reply, e.g. GET of a missing key.
+var ErrNil = errors.New("redis: nil")
+
+// Error is an error reply sent by the server. The connection stays usable.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// Client sends commands to one Redis server.
+type Client struct {
+	addr     string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewClient returns a client for the Redis server at addr (host:port).
+// The connection is opened on first use.
+func NewClient(addr, password string, db int) *Client {
+	return &Client{addr: addr, password: password, db: db}
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeLocked()
+}
+
+// Do sends a command and returns its reply: string (simple string), int64, []byte
+// (bulk string) or []any (array).
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+
+	if c.conn == nil {
+		if err := c.connect(ctx, deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	v, err := c.roundTrip(deadline, args...)
+	var re Error
+	if err != nil && !errors.Is(err, ErrNil) && !errors.As(err, &re) {
+		// Connection state is unknown after I/O errors.
+		_ = c.closeLocked()
+	}
+	return v, err
+}
+
+func (c *Client) connect(ctx context.Context, deadline time.Time) error {
+	d := net.Dialer{Deadline: deadline}
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("connect redis: %w", err)
+	}
+	c.conn = conn
+	c.rd = bufio.NewReader(conn)
+
+	if c.password != "" {
+		if _, err := c.roundTrip(deadline, "AUTH", c.password); err != nil {
+			_ = c.closeLocked()
+			return fmt.Errorf("redis AUTH: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.roundTrip(deadline, "SELECT", strconv.Itoa(c.db)); err != nil {
+			_ = c.closeLocked()
+			return fmt.Errorf("redis SELECT: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) closeLocked() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	c.rd = nil
+	return err
+}
+
+func (c *Client) roundTrip(deadline time.Time, args ...string) (any, error) {
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, a := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(a)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, a...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, fmt.Errorf("write redis command: %w", err)
+	}
+	return readReply(c.rd)
+}
+
+// readReply reads one simple string, error, integer, bulk string or array reply.
+// Null elements of arrays are returned as nil, error elements as Error.
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read redis reply: %w", err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("read redis reply: malformed line %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, Error(payload)
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("read redis reply: %w", err)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("read redis reply: %w", err)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return nil, fmt.Errorf("read redis reply: %w", err)
+		}
+		return b[:n], nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("read redis reply: %w", err)
+		}
+		if n < 0 {
+			return nil, ErrNil
+		}
+		items := make([]any, n)
+		for i := range items {
+			v, err := readReply(rd)
+			if errors.Is(err, ErrNil) {
+				continue
+			}
+			var re Error
+			if errors.As(err, &re) {
+				items[i] = re
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = v
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("read redis reply: unsupported type %q", kind)
+	}
+}
@@ -0,0 +1,228 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeReply writes raw to one end of a pipe and reads a reply from the other.
+func pipeReply(t *testing.T, raw string) (any, error) {
+	t.Helper()
+	server, client := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		_, _ = io.WriteString(server, raw)
+	}()
+	return readReply(bufio.NewReader(client))
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    any
+		wantErr error
+	}{
+		{"simple string", "+OK\r\n", "OK", nil},
+		{"integer", ":-42\r\n", int64(-42), nil},
+		{"bulk", "$5\r\nhe\r\no\r\n", []byte("he\r\no"), nil},
+		{"empty bulk", "$0\r\n\r\n", []byte{}, nil},
+		{"nil bulk", "$-1\r\n", nil, ErrNil},
+		{"nil array", "*-1\r\n", nil, ErrNil},
+		{"error", "-WRONGTYPE Operation against a key\r\n", nil, Error("WRONGTYPE Operation against a key")},
+		{"empty array", "*0\r\n", []any{}, nil},
+		{"nested array with nulls", "*4\r\n$1\r\na\r\n*3\r\n$-1\r\n:5\r\n*-1\r\n$-1\r\n+x\r\n",
+			[]any{[]byte("a"), []any{nil, int64(5), nil}, nil, "x"}, nil},
+		{"error element", "*2\r\n-ERR no\r\n:1\r\n", []any{Error("ERR no"), int64(1)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pipeReply(t, tt.raw)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("reply = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadReplyMalformed(t *testing.T) {
+	for _, raw := range []string{
+		"OK\r\n",         // unknown type
+		"+OK\n",          // missing \r
+		":abc\r\n",       // bad integer
+		"$5\r\nab",       // bulk cut short
+		"*2\r\n:1\r\n",   // array cut short
+		"$x\r\nab\r\n",   // bad length
+		"*2\r\n!bad\r\n", // bad element
+	} {
+		if v, err := pipeReply(t, raw); err == nil {
+			t.Errorf("reply %q = %#v, want error", raw, v)
+		}
+	}
+}
+
+// scriptedServer answers the commands of each connection with handle, which gets
+// the connection number (from 1) and returns the raw reply or "" to drop the
+// connection. It records the commands received.
+type scriptedServer struct {
+	addr string
+
+	mu       sync.Mutex
+	conns    int
+	commands []string
+}
+
+func newScriptedServer(t *testing.T, handle func(conn int, args []string) string) *scriptedServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &scriptedServer{addr: ln.Addr().String()}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			n := s.conns
+			s.mu.Unlock()
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(rd)
+					if err != nil {
+						return
+					}
+					s.mu.Lock()
+					s.commands = append(s.commands, strconv.Itoa(n)+":"+strings.Join(args, " "))
+					s.mu.Unlock()
+					reply := handle(n, args)
+					if reply == "" {
+						return
+					}
+					if _, err := io.WriteString(conn, reply); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+// readCommand reads an array of bulk strings.
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	v, err := readReply(rd)
+	if err != nil {
+		return nil, err
+	}
+	items, _ := v.([]any)
+	args := make([]string, len(items))
+	for i, it := range items {
+		b, _ := it.([]byte)
+		args[i] = string(b)
+	}
+	return args, nil
+}
+
+func TestClientReconnectsAfterIOError(t *testing.T) {
+	srv := newScriptedServer(t, func(conn int, args []string) string {
+		switch args[0] {
+		case "AUTH", "SELECT":
+			return "+OK\r\n"
+		case "GET":
+			if conn == 1 && args[1] == "drop" {
+				return ""
+			}
+			return "$5\r\nvalue\r\n"
+		case "HGET":
+			return "-WRONGTYPE Operation against a key\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+
+	c := NewClient(srv.addr, "s3cret", 2)
+	defer c.Close()
+	ctx := context.Background()
+
+	// An error reply keeps the connection.
+	var re Error
+	if _, err := c.Do(ctx, "HGET", "k", "f"); !errors.As(err, &re) {
+		t.Fatalf("HGET err = %v, want error reply", err)
+	}
+	if v, err := c.Do(ctx, "GET", "k"); err != nil || string(v.([]byte)) != "value" {
+		t.Fatalf("GET = %v, %v", v, err)
+	}
+
+	// The server drops the connection: the command fails and the next one reconnects.
+	if _, err := c.Do(ctx, "GET", "drop"); err == nil {
+		t.Fatal("GET on a dropped connection succeeded")
+	}
+	if v, err := c.Do(ctx, "GET", "k"); err != nil || string(v.([]byte)) != "value" {
+		t.Fatalf("GET after reconnect = %v, %v", v, err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	want := []string{"1:AUTH s3cret", "1:SELECT 2", "1:HGET k f", "1:GET k", "1:GET drop", "2:AUTH s3cret", "2:SELECT 2", "2:GET k"}
+	if srv.conns != 2 || !reflect.DeepEqual(srv.commands, want) {
+		t.Fatalf("connections = %d, commands = %q", srv.conns, srv.commands)
+	}
+}
+
+func TestClientTimeoutAndAuthError(t *testing.T) {
+	srv := newScriptedServer(t, func(conn int, args []string) string {
+		switch {
+		case args[0] == "AUTH" && args[1] != "s3cret":
+			return "-WRONGPASS invalid password\r\n"
+		case args[0] == "AUTH":
+			return "+OK\r\n"
+		case args[0] == "BLPOP" && conn == 2:
+			time.Sleep(time.Second)
+		}
+		return ":1\r\n"
+	})
+	ctx := context.Background()
+
+	bad := NewClient(srv.addr, "wrong", 0)
+	defer bad.Close()
+	if _, err := bad.Do(ctx, "PING"); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("Do with wrong password: err = %v", err)
+	}
+
+	c := NewClient(srv.addr, "s3cret", 0)
+	defer c.Close()
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Do(short, "BLPOP", "q", "0"); err == nil {
+		t.Fatal("Do past the deadline succeeded")
+	}
+	if v, err := c.Do(ctx, "INCR", "n"); err != nil || v != int64(1) {
+		t.Fatalf("INCR after timeout = %v, %v", v, err)
+	}
+}
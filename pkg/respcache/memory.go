@@ -0,0 +1,103 @@
+package respcache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMaxEntries is the capacity of a MemoryStore created with maxEntries <= 0.
+const DefaultMaxEntries = 10000
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStore keeps entries in process memory. When full, expired entries are
+// removed first, then arbitrary ones. Counters are kept separately and never evicted.
+type MemoryStore struct {
+	mu         sync.Mutex
+	entries    map[string]memoryEntry
+	counters   map[string]int64
+	maxEntries int
+	now        func() time.Time
+}
+
+// NewMemoryStore returns an empty store holding up to maxEntries values.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &MemoryStore{
+		entries:    make(map[string]memoryEntry),
+		counters:   make(map[string]int64),
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n, ok := s.counters[key]; ok {
+		return []byte(strconv.FormatInt(n, 10)), true, nil
+	}
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !s.now().Before(e.expires) {
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Set implements Store.
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if _, exists := s.entries[key]; !exists && len(s.entries) >= s.maxEntries {
+		s.evict(now)
+	}
+	s.entries[key] = memoryEntry{value: value, expires: now.Add(ttl)}
+	return nil
+}
+
+// Incr implements Store.
+func (s *MemoryStore) Incr(_ context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counters[key]++
+	return s.counters[key], nil
+}
+
+// Len returns the number of stored values (without counters).
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// evict makes room for at least one entry. Callers must hold s.mu.
+func (s *MemoryStore) evict(now time.Time) {
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+	for k := range s.entries {
+		if len(s.entries) < s.maxEntries {
+			break
+		}
+		delete(s.entries, k)
+	}
+}
@@ -0,0 +1,66 @@
+package respcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/redis"
+)
+
+// RedisStore shares the cache between several fyndmark instances (GET, SET PX, INCR).
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore returns a store for the Redis server at addr (host:port).
+// The connection is opened on first use.
+func NewRedisStore(addr, password string, db int) *RedisStore {
+	return &RedisStore{client: redis.NewClient(addr, password, db)}
+}
+
+// Get implements Store.
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, err := s.client.Do(ctx, "GET", key)
+	if errors.Is(err, redis.ErrNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("redis GET: unexpected reply %T", v)
+	}
+	return b, true, nil
+}
+
+// Set implements Store.
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	_, err := s.client.Do(ctx, "SET", key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// Incr implements Store.
+func (s *RedisStore) Incr(ctx context.Context, key string) (int64, error) {
+	v, err := s.client.Do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis INCR: unexpected reply %T", v)
+	}
+	return n, nil
+}
+
+// Close closes the connection.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,109 @@
+// Package respcache caches public read responses per site.
+//
+// Every site has a generation counter that is part of each cache key. Moderation
+// decisions bump the counter, so entries of the previous state are never read again
+// and simply expire. Because the counter is read before the database query, a result
+// computed concurrently with an approval is stored under the old generation.
+package respcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTTL bounds the staleness of entries for changes that do not invalidate the
+// cache (for example comments modified through the CLI in another process).
+const DefaultTTL = 5 * time.Minute
+
+// Store is the storage backend of a Cache.
+type Store interface {
+	// Get returns the value of key. A missing or expired key is not an error.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Incr increments the counter stored under key and returns the new value.
+	// Counters do not expire.
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+// Cache is a response cache keyed by site, request and the site's generation.
+// A nil *Cache is valid and caches nothing.
+type Cache struct {
+	store  Store
+	ttl    time.Duration
+	prefix string
+}
+
+// New returns a cache on store. ttl <= 0 uses DefaultTTL.
+func New(store Store, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Cache{store: store, ttl: ttl, prefix: "fyndmark:cache:"}
+}
+
+// Key returns the cache key of a request for siteID. parts identify the request
+// (endpoint name and normalized parameters).
+func (c *Cache) Key(ctx context.Context, siteID int64, parts ...string) (string, error) {
+	if c == nil {
+		return "", nil
+	}
+
+	gen, err := c.generation(ctx, siteID)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	site := strconv.FormatInt(siteID, 10)
+	return c.prefix + "r:" + site + ":" + strconv.FormatInt(gen, 10) + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Get returns the cached value of key.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if c == nil || key == "" {
+		return nil, false, nil
+	}
+	return c.store.Get(ctx, key)
+}
+
+// Set stores value under key.
+func (c *Cache) Set(ctx context.Context, key string, value []byte) error {
+	if c == nil || key == "" {
+		return nil
+	}
+	return c.store.Set(ctx, key, value, c.ttl)
+}
+
+// Invalidate drops all cached responses of siteID.
+func (c *Cache) Invalidate(ctx context.Context, siteID int64) error {
+	if c == nil {
+		return nil
+	}
+	_, err := c.store.Incr(ctx, c.generationKey(siteID))
+	return err
+}
+
+func (c *Cache) generation(ctx context.Context, siteID int64) (int64, error) {
+	v, ok, err := c.store.Get(ctx, c.generationKey(siteID))
+	if err != nil || !ok {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(v)), 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+	return n, nil
+}
+
+func (c *Cache) generationKey(siteID int64) string {
+	return c.prefix + "gen:" + strconv.FormatInt(siteID, 10)
+}
@@ -0,0 +1,224 @@
+package respcache
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheInvalidateChangesKey(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewMemoryStore(0), time.Minute)
+
+	k1, err := c.Key(ctx, 1, "count", "/a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, k1, []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, _ := c.Get(ctx, k1); !ok || string(v) != "3" {
+		t.Fatalf("Get = %q, %v; want 3, true", v, ok)
+	}
+
+	other, _ := c.Key(ctx, 2, "count", "/a/")
+	if err := c.Invalidate(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := c.Key(ctx, 1, "count", "/a/"); again != k1 {
+		t.Fatal("invalidating another site changed the key")
+	}
+	if after, _ := c.Key(ctx, 2, "count", "/a/"); after == other {
+		t.Fatal("key did not change after Invalidate")
+	}
+
+	if err := c.Invalidate(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	k2, _ := c.Key(ctx, 1, "count", "/a/")
+	if k2 == k1 {
+		t.Fatal("key did not change after Invalidate")
+	}
+	if _, ok, _ := c.Get(ctx, k2); ok {
+		t.Fatal("stale entry returned after Invalidate")
+	}
+}
+
+func TestCacheKeySeparatesParts(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewMemoryStore(0), time.Minute)
+
+	a, _ := c.Key(ctx, 1, "ab", "c")
+	b, _ := c.Key(ctx, 1, "a", "bc")
+	if a == b {
+		t.Fatal("different parts produced the same key")
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	ctx := context.Background()
+
+	key, err := c.Key(ctx, 1, "x")
+	if err != nil || key != "" {
+		t.Fatalf("Key = %q, %v", key, err)
+	}
+	if err := c.Set(ctx, key, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.Get(ctx, key); ok {
+		t.Fatal("nil cache returned a value")
+	}
+	if err := c.Invalidate(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryStoreExpiryAndEviction(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+	s := NewMemoryStore(2)
+	s.now = func() time.Time { return now }
+
+	_ = s.Set(ctx, "a", []byte("1"), time.Second)
+	_ = s.Set(ctx, "b", []byte("2"), time.Minute)
+
+	now = now.Add(2 * time.Second)
+	if _, ok, _ := s.Get(ctx, "a"); ok {
+		t.Fatal("expired entry returned")
+	}
+
+	_ = s.Set(ctx, "c", []byte("3"), time.Minute)
+	_ = s.Set(ctx, "d", []byte("4"), time.Minute)
+	if n := s.Len(); n > 2 {
+		t.Fatalf("Len = %d, want <= 2", n)
+	}
+	if _, ok, _ := s.Get(ctx, "d"); !ok {
+		t.Fatal("newest entry was evicted")
+	}
+
+	if n, _ := s.Incr(ctx, "gen"); n != 1 {
+		t.Fatalf("Incr = %d, want 1", n)
+	}
+	for i := 0; i < 5; i++ {
+		_ = s.Set(ctx, "k"+strconv.Itoa(i), nil, time.Minute)
+	}
+	if v, ok, _ := s.Get(ctx, "gen"); !ok || string(v) != "1" {
+		t.Fatalf("counter = %q, %v; want 1, true", v, ok)
+	}
+}
+
+// fakeRedis serves GET, SET and INCR for one connection at a time.
+func fakeRedis(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	data := map[string]string{}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(rd)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					var reply string
+					switch strings.ToUpper(args[0]) {
+					case "GET":
+						if v, ok := data[args[1]]; ok {
+							reply = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+						} else {
+							reply = "$-1\r\n"
+						}
+					case "SET":
+						data[args[1]] = args[2]
+						reply = "+OK\r\n"
+					case "INCR":
+						n, _ := strconv.ParseInt(data[args[1]], 10, 64)
+						n++
+						data[args[1]] = strconv.FormatInt(n, 10)
+						reply = ":" + data[args[1]] + "\r\n"
+					default:
+						reply = "-ERR unknown command\r\n"
+					}
+					mu.Unlock()
+					if _, err := conn.Write([]byte(reply)); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		hdr, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(hdr[1:]))
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return nil, err
+		}
+		args = append(args, string(b[:size]))
+	}
+	return args, nil
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewRedisStore(fakeRedis(t), "", 0)
+	defer s.Close()
+
+	if _, ok, err := s.Get(ctx, "missing"); err != nil || ok {
+		t.Fatalf("Get(missing) = %v, %v", ok, err)
+	}
+	if err := s.Set(ctx, "k", []byte("a\r\nb"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, err := s.Get(ctx, "k"); err != nil || !ok || string(v) != "a\r\nb" {
+		t.Fatalf("Get = %q, %v, %v", v, ok, err)
+	}
+	if n, err := s.Incr(ctx, "gen"); err != nil || n != 1 {
+		t.Fatalf("Incr = %d, %v", n, err)
+	}
+
+	c := New(s, time.Minute)
+	k1, err := c.Key(ctx, 7, "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = c.Invalidate(ctx, 7)
+	if k2, _ := c.Key(ctx, 7, "list"); k2 == k1 {
+		t.Fatal("key did not change after Invalidate")
+	}
+}
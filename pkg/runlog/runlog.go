@@ -0,0 +1,185 @@
+// Package runlog captures the output of git and hugo subprocesses. Output is kept in
+// memory only up to a limit (the tail is used for error messages), always redacted,
+// and streamed to an optional sink, for example the log table of a pipeline run.
+package runlog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultTailLimit is the number of bytes kept in memory per subprocess.
+	DefaultTailLimit = 64 * 1024
+
+	// maxSinkBytes limits the output streamed to the sink per subprocess.
+	maxSinkBytes = 1024 * 1024
+
+	// flushBytes is the chunk size in which complete lines are passed to the sink.
+	flushBytes = 4 * 1024
+)
+
+// Sink receives redacted output in chunks of complete lines.
+type Sink func(text string)
+
+type sinkKey struct{}
+
+// WithSink returns a context whose subprocess output is streamed to sink.
+func WithSink(ctx context.Context, sink Sink) context.Context {
+	return context.WithValue(ctx, sinkKey{}, sink)
+}
+
+// SinkFromContext returns the sink of ctx or nil.
+func SinkFromContext(ctx context.Context) Sink {
+	if ctx == nil {
+		return nil
+	}
+	sink, _ := ctx.Value(sinkKey{}).(Sink)
+	return sink
+}
+
+var (
+	accessTokenPattern = regexp.MustCompile(`x-access-token:[^@\s]*@`)
+	userinfoPattern    = regexp.MustCompile(`://[^/@\s:]+:[^/@\s]+@`)
+)
+
+// Redact removes credentials embedded in URLs.
+func Redact(s string) string {
+	s = accessTokenPattern.ReplaceAllString(s, "x-access-token:***REDACTED***@")
+	return userinfoPattern.ReplaceAllString(s, "://***REDACTED***@")
+}
+
+// Printf prints a message to stdout and, redacted, to the sink of ctx if present.
+func Printf(ctx context.Context, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Print(msg)
+	if sink := SinkFromContext(ctx); sink != nil {
+		sink(Redact(msg))
+	}
+}
+
+// Capture is an io.Writer for the combined stdout/stderr of a subprocess. Output is
+// redacted line by line as it arrives, so truncating the tail never splits a
+// credential before it was redacted.
+type Capture struct {
+	mu sync.Mutex
+
+	limit   int
+	tail    []byte
+	dropped int64
+	pending []byte
+
+	sink      Sink
+	sinkBuf   []byte
+	sinkBytes int
+	sinkFull  bool
+}
+
+// NewCapture returns a capture keeping the last limit bytes (DefaultTailLimit if <= 0),
+// streaming to the sink of ctx if present.
+func NewCapture(ctx context.Context, limit int) *Capture {
+	if limit <= 0 {
+		limit = DefaultTailLimit
+	}
+	return &Capture{limit: limit, sink: SinkFromContext(ctx)}
+}
+
+// Write implements io.Writer.
+func (c *Capture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = append(c.pending, p...)
+	if i := bytes.LastIndexAny(c.pending, "\r\n"); i >= 0 {
+		c.emitLocked(c.pending[:i+1])
+		c.pending = append(c.pending[:0], c.pending[i+1:]...)
+	}
+	if len(c.pending) > maxSinkBytes {
+		// Output without line breaks: pass it on up to the last blank, which never
+		// occurs inside a credential, or completely if there is none.
+		cut := len(c.pending)
+		if i := bytes.LastIndexAny(c.pending, " \t"); i >= 0 {
+			cut = i + 1
+		}
+		c.emitLocked(c.pending[:cut])
+		c.pending = append(c.pending[:0], c.pending[cut:]...)
+	}
+	return len(p), nil
+}
+
+// Close passes remaining output to the sink.
+func (c *Capture) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pending) > 0 {
+		c.emitLocked(c.pending)
+		c.pending = nil
+	}
+	c.flushLocked()
+}
+
+// Tail returns the redacted output for error messages, marked if it was truncated.
+func (c *Capture) Tail() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := string(c.tail) + Redact(string(c.pending))
+	dropped := c.dropped
+	if len(out) > c.limit {
+		dropped += int64(len(out) - c.limit)
+		out = out[len(out)-c.limit:]
+	}
+	out = strings.TrimSpace(out)
+	if dropped > 0 {
+		return fmt.Sprintf("[%d bytes of earlier output omitted]\n%s", dropped, out)
+	}
+	return out
+}
+
+// emitLocked redacts complete output and adds it to the tail and the sink buffer.
+func (c *Capture) emitLocked(chunk []byte) {
+	if len(chunk) == 0 {
+		return
+	}
+	text := Redact(string(chunk))
+
+	c.tail = append(c.tail, text...)
+	if over := len(c.tail) - c.limit; over > 0 {
+		// Drop the partial first line left over by the cut.
+		if c.tail[over-1] != '\n' {
+			if i := bytes.IndexByte(c.tail[over:], '\n'); i >= 0 && over+i+1 < len(c.tail) {
+				over += i + 1
+			}
+		}
+		c.dropped += int64(over)
+		c.tail = append(c.tail[:0], c.tail[over:]...)
+	}
+
+	if c.sink != nil && !c.sinkFull {
+		c.sinkBuf = append(c.sinkBuf, text...)
+		if len(c.sinkBuf) >= flushBytes {
+			c.flushLocked()
+		}
+	}
+}
+
+// flushLocked passes the sink buffer to the sink until maxSinkBytes are reached.
+func (c *Capture) flushLocked() {
+	if c.sink == nil || c.sinkFull || len(c.sinkBuf) == 0 {
+		return
+	}
+	if c.sinkBytes+len(c.sinkBuf) > maxSinkBytes {
+		c.sinkFull = true
+		c.sinkBuf = nil
+		c.sink(fmt.Sprintf("[output truncated after %d bytes]\n", c.sinkBytes))
+		return
+	}
+	c.sinkBytes += len(c.sinkBuf)
+	c.sink(string(c.sinkBuf))
+	c.sinkBuf = c.sinkBuf[:0]
+}
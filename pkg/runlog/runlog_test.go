@@ -0,0 +1,137 @@
+package runlog
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+const secret = "ghp_s3cr3tT0k3n"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"github token", "fatal: unable to access 'https://x-access-token:" + secret + "@github.com/o/r.git/'",
+			"fatal: unable to access 'https://***REDACTED***@github.com/o/r.git/'"},
+		{"gitlab oauth2", "remote: https://oauth2:" + secret + "@gitlab.com/o/r.git",
+			"remote: https://***REDACTED***@gitlab.com/o/r.git"},
+		{"custom user name", "From https://ci-bot:" + secret + "@git.example.org/r",
+			"From https://***REDACTED***@git.example.org/r"},
+		{"gitlab ci token", "https://gitlab-ci-token:" + secret + "@gitlab.example.org/r",
+			"https://***REDACTED***@gitlab.example.org/r"},
+		{"bare access token", "x-access-token:" + secret + "@", "x-access-token:***REDACTED***@"},
+		{"no credentials", "https://github.com/o/r.git and user@example.org", "https://github.com/o/r.git and user@example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.in); got != tt.want {
+				t.Fatalf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapture(t *testing.T) {
+	url := "https://oauth2:" + secret + "@gitlab.com/o/r.git"
+	tests := []struct {
+		name   string
+		limit  int
+		writes []string
+		want   string
+	}{
+		{"token split across writes", 0,
+			[]string{"cloning " + url[:20], url[20:] + "\ndone\n"},
+			"cloning https://***REDACTED***@gitlab.com/o/r.git\ndone"},
+		{"access token split across writes", 0,
+			[]string{"x-access-tok", "en:" + secret, "@github.com\n"},
+			"x-access-token:***REDACTED***@github.com"},
+		{"no newline", 0,
+			[]string{"progress " + url[:30], url[30:]},
+			"progress https://***REDACTED***@gitlab.com/o/r.git"},
+		{"carriage returns", 0,
+			[]string{"10%\r", "50% " + url + "\r", "100%\r"},
+			"10%\r50% https://***REDACTED***@gitlab.com/o/r.git\r100%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCapture(context.Background(), tt.limit)
+			for _, w := range tt.writes {
+				if _, err := c.Write([]byte(w)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := c.Tail(); got != tt.want {
+				t.Fatalf("Tail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureTruncationBoundary(t *testing.T) {
+	// The token line straddles the cut of the 40 byte tail at every offset.
+	line := "https://oauth2:" + secret + "@gitlab.com/o/r.git\n"
+	for pad := 0; pad < len(line); pad++ {
+		c := NewCapture(context.Background(), 40)
+		c.Write([]byte(strings.Repeat("x", pad) + "\n" + line + "ok\n"))
+		got := c.Tail()
+		if strings.Contains(got, secret) || strings.Contains(got, secret[4:]) {
+			t.Fatalf("pad %d: token leaked into tail %q", pad, got)
+		}
+		if !strings.HasPrefix(got, "[") || !strings.HasSuffix(got, "ok") {
+			t.Fatalf("pad %d: unexpected tail %q", pad, got)
+		}
+	}
+}
+
+func TestCaptureDropsPartialFirstLine(t *testing.T) {
+	// The cut lands on a line start: nothing more is dropped.
+	c := NewCapture(context.Background(), 13)
+	c.Write([]byte("first line\nsecond\nthird\n"))
+	if got := c.Tail(); got != "[11 bytes of earlier output omitted]\nsecond\nthird" {
+		t.Fatalf("unexpected tail %q", got)
+	}
+
+	c = NewCapture(context.Background(), 12)
+	c.Write([]byte("first line\nsecond\nthird\n"))
+	if got := c.Tail(); got != "[18 bytes of earlier output omitted]\nthird" {
+		t.Fatalf("unexpected tail %q", got)
+	}
+
+	c = NewCapture(context.Background(), 10)
+	c.Write([]byte("aaaaaaaa\nbbbbbbbbbbbbbbb\ncc\n"))
+	if got := c.Tail(); got != "[25 bytes of earlier output omitted]\ncc" {
+		t.Fatalf("unexpected tail %q", got)
+	}
+}
+
+func TestCapturePendingIsBounded(t *testing.T) {
+	c := NewCapture(context.Background(), 0)
+	chunk := []byte(strings.Repeat("#", 64*1024) + " ")
+	for range 40 {
+		c.Write(chunk)
+	}
+	if len(c.pending) > maxSinkBytes {
+		t.Fatalf("pending grew to %d bytes", len(c.pending))
+	}
+	if len(c.tail) > DefaultTailLimit {
+		t.Fatalf("tail grew to %d bytes", len(c.tail))
+	}
+}
+
+func TestCaptureSink(t *testing.T) {
+	var got strings.Builder
+	ctx := WithSink(context.Background(), func(text string) { got.WriteString(text) })
+
+	c := NewCapture(ctx, 16)
+	url := "https://ci-bot:" + secret + "@git.example.org/r"
+	c.Write([]byte("fetch " + url[:18]))
+	c.Write([]byte(url[18:] + "\nno newline"))
+	c.Close()
+
+	if want := "fetch https://***REDACTED***@git.example.org/r\nno newline"; got.String() != want {
+		t.Fatalf("sink got %q, want %q", got.String(), want)
+	}
+}
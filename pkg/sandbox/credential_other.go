@@ -0,0 +1,13 @@
+//go:build !unix
+
+package sandbox
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// setCredential is not supported on this platform.
+func setCredential(cmd *exec.Cmd, uid, gid int) error {
+	return fmt.Errorf("sandbox.uid/sandbox.gid are only supported on Unix systems")
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package sandbox
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setCredential runs the command as the given user and group (0 keeps the current ID).
+func setCredential(cmd *exec.Cmd, uid, gid int) error {
+	if uid == 0 {
+		uid = syscall.Getuid()
+	}
+	if gid == 0 {
+		gid = syscall.Getgid()
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)},
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Package sandbox builds the exec.Cmd for git and hugo subprocesses. Subprocesses
+// always get a minimal environment instead of inheriting the parent's (which may hold
+// SMTP passwords or tokens). The optional sandbox config adds a different UID/GID and
+// a wrapper such as bubblewrap or nsjail.
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// baseEnv are the variables passed from the parent environment to every subprocess.
+var baseEnv = []string{
+	"PATH", "HOME", "USER", "LANG", "LC_ALL", "TZ", "TMPDIR",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	"SSL_CERT_FILE", "SSL_CERT_DIR",
+	// Required by many programs on Windows.
+	"SYSTEMROOT", "TEMP", "TMP", "USERPROFILE", "APPDATA", "LOCALAPPDATA", "PATHEXT", "COMSPEC",
+}
+
+// Command returns a command running bin in dir with a minimal environment plus env
+// (per-step variables in "KEY=value" form). kind names the program for the
+// sandbox.commands setting ("git", "hugo" or "command" for custom pipeline
+// commands), bin is the binary name or path.
+func Command(ctx context.Context, kind string, bin string, dir string, env []string, args ...string) (*exec.Cmd, error) {
+	cfg := config.Cfg.Sandbox
+	if !cfg.Enabled || !applies(cfg, kind) {
+		cmd := exec.CommandContext(ctx, bin, args...)
+		cmd.Dir = dir
+		cmd.Env = append(minimalEnv(config.Cfg.Subprocess.EnvPassthrough), env...)
+		return cmd, nil
+	}
+
+	argv := append([]string{bin}, args...)
+	if len(cfg.Wrapper) > 0 {
+		placeholderDir := dir
+		if placeholderDir == "" {
+			placeholderDir, _ = os.Getwd()
+		}
+		wrapped := make([]string, 0, len(cfg.Wrapper)+len(argv))
+		for _, w := range cfg.Wrapper {
+			wrapped = append(wrapped, strings.ReplaceAll(w, "{dir}", placeholderDir))
+		}
+		argv = append(wrapped, argv...)
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(minimalEnv(config.Cfg.Subprocess.EnvPassthrough), env...)
+
+	if cfg.UID > 0 || cfg.GID > 0 {
+		if err := setCredential(cmd, cfg.UID, cfg.GID); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.UID > 0 && cfg.UID != os.Getuid() {
+		home, err := sandboxHome(cfg)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = setEnv(cmd.Env, "HOME", home)
+	}
+
+	return cmd, nil
+}
+
+// sandboxHome returns the HOME of subprocesses running as sandbox.uid: sandbox.home,
+// or a directory in the system temp dir that is created for and owned by the UID.
+func sandboxHome(cfg config.SandboxConfig) (string, error) {
+	if home := strings.TrimSpace(cfg.Home); home != "" {
+		return home, nil
+	}
+	home := filepath.Join(os.TempDir(), fmt.Sprintf("fyndmark-sandbox-%d", cfg.UID))
+	if err := os.MkdirAll(home, 0o700); err != nil {
+		return "", fmt.Errorf("sandbox home: %w", err)
+	}
+	gid := cfg.GID
+	if gid == 0 {
+		gid = -1
+	}
+	if err := os.Chown(home, cfg.UID, gid); err != nil {
+		return "", fmt.Errorf("sandbox home: %w", err)
+	}
+	return home, nil
+}
+
+// setEnv sets name in env, replacing an inherited value.
+func setEnv(env []string, name, value string) []string {
+	out := env[:0:0]
+	for _, e := range env {
+		if k, _, _ := strings.Cut(e, "="); k != name {
+			out = append(out, e)
+		}
+	}
+	return append(out, name+"="+value)
+}
+
+// ValidateConfig checks that the sandbox wrapper can be found.
+func ValidateConfig() error {
+	cfg := config.Cfg.Sandbox
+	if !cfg.Enabled {
+		return nil
+	}
+	for _, c := range cfg.Commands {
+		switch strings.TrimSpace(c) {
+		case "git", "hugo", "command":
+		default:
+			return fmt.Errorf("sandbox.commands: unknown command %q (allowed: git, hugo, command)", c)
+		}
+	}
+	if cfg.UID < 0 || cfg.GID < 0 {
+		return fmt.Errorf("sandbox.uid and sandbox.gid must be >= 0")
+	}
+	if home := strings.TrimSpace(cfg.Home); home != "" {
+		if fi, err := os.Stat(home); err != nil || !fi.IsDir() {
+			return fmt.Errorf("sandbox.home: %q is not a directory", home)
+		}
+	}
+	if len(cfg.Wrapper) > 0 {
+		if _, err := exec.LookPath(cfg.Wrapper[0]); err != nil {
+			return fmt.Errorf("sandbox.wrapper: %w", err)
+		}
+	}
+	return nil
+}
+
+// applies reports whether the sandbox is configured for the named command.
+func applies(cfg config.SandboxConfig, name string) bool {
+	if len(cfg.Commands) == 0 {
+		return true
+	}
+	for _, c := range cfg.Commands {
+		if strings.TrimSpace(c) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// minimalEnv returns baseEnv and the passthrough variables that are set in the parent environment.
+func minimalEnv(passthrough []string) []string {
+	names := append(append([]string{}, baseEnv...), passthrough...)
+	env := make([]string, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if _, ok := seen[n]; ok {
+			continue
+		}
+		seen[n] = struct{}{}
+		if v, ok := os.LookupEnv(n); ok {
+			env = append(env, n+"="+v)
+		}
+	}
+	return env
+}
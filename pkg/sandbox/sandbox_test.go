@@ -0,0 +1,133 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestCommandMinimalEnv(t *testing.T) {
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+
+	t.Setenv("PATH", "/usr/bin:/bin")
+	t.Setenv("LANG", "C.UTF-8")
+	t.Setenv("FYNDMARK_SMTP_PASSWORD", "smtp-secret")
+	t.Setenv("GITHUB_TOKEN", "ghp_secret")
+	t.Setenv("HUGO_ENV", "production")
+
+	for _, enabled := range []bool{false, true} {
+		config.Cfg = config.AppConfig{
+			Sandbox:    config.SandboxConfig{Enabled: enabled},
+			Subprocess: config.SubprocessConfig{EnvPassthrough: []string{" HUGO_ENV ", "UNSET_VARIABLE", "PATH"}},
+		}
+
+		cmd, err := Command(context.Background(), "hugo", "hugo", t.TempDir(), []string{"STEP=1"}, "version")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"PATH=/usr/bin:/bin", "LANG=C.UTF-8", "HUGO_ENV=production", "STEP=1"} {
+			if !slices.Contains(cmd.Env, want) {
+				t.Errorf("sandbox=%v: env %v lacks %s", enabled, cmd.Env, want)
+			}
+		}
+		for _, e := range cmd.Env {
+			switch name, _, _ := strings.Cut(e, "="); name {
+			case "FYNDMARK_SMTP_PASSWORD", "GITHUB_TOKEN", "UNSET_VARIABLE":
+				t.Errorf("sandbox=%v: %s leaked into the subprocess environment", enabled, name)
+			}
+		}
+		if n := countName(cmd.Env, "PATH"); n != 1 {
+			t.Errorf("sandbox=%v: PATH passed %d times", enabled, n)
+		}
+	}
+}
+
+func TestCommandWrapper(t *testing.T) {
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+	config.Cfg = config.AppConfig{Sandbox: config.SandboxConfig{
+		Enabled:  true,
+		Commands: []string{"hugo"},
+		Wrapper:  []string{"bwrap", "--bind", "{dir}", "{dir}", "--chdir={dir}", "--"},
+	}}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		kind string
+		dir  string
+		want []string
+	}{
+		{"wrapped", "hugo", dir, []string{"bwrap", "--bind", dir, dir, "--chdir=" + dir, "--", "hugo", "--minify"}},
+		{"empty dir is the working directory", "hugo", "", []string{"bwrap", "--bind", cwd, cwd, "--chdir=" + cwd, "--", "hugo", "--minify"}},
+		{"not sandboxed", "git", dir, []string{"hugo", "--minify"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := Command(context.Background(), tt.kind, "hugo", tt.dir, nil, "--minify")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(cmd.Args, tt.want) {
+				t.Fatalf("argv = %q, want %q", cmd.Args, tt.want)
+			}
+			if cmd.Dir != tt.dir {
+				t.Fatalf("dir = %q, want %q", cmd.Dir, tt.dir)
+			}
+		})
+	}
+}
+
+func TestCommandHomeOfSandboxUser(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sandbox.uid is Unix only")
+	}
+	saved := config.Cfg
+	t.Cleanup(func() { config.Cfg = saved })
+	t.Setenv("HOME", "/home/fyndmark")
+
+	home := t.TempDir()
+	uid := os.Getuid() + 1000
+	config.Cfg = config.AppConfig{Sandbox: config.SandboxConfig{Enabled: true, UID: uid, Home: home}}
+	cmd, err := Command(context.Background(), "git", "git", t.TempDir(), []string{"GIT_TERMINAL_PROMPT=0"}, "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countName(cmd.Env, "HOME") != 1 || !slices.Contains(cmd.Env, "HOME="+home) {
+		t.Fatalf("env = %v, want HOME=%s only", cmd.Env, home)
+	}
+	if !slices.Contains(cmd.Env, "GIT_TERMINAL_PROMPT=0") {
+		t.Fatalf("env = %v lacks the step variables", cmd.Env)
+	}
+
+	// Without a UID switch the subprocess keeps the HOME of the Fyndmark user.
+	config.Cfg.Sandbox.UID = 0
+	cmd, err = Command(context.Background(), "git", "git", t.TempDir(), nil, "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(cmd.Env, "HOME=/home/fyndmark") {
+		t.Fatalf("env = %v, want the inherited HOME", cmd.Env)
+	}
+}
+
+// countName counts the entries of env named name.
+func countName(env []string, name string) int {
+	n := 0
+	for _, e := range env {
+		if k, _, _ := strings.Cut(e, "="); k == name {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,133 @@
+package sanitize
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed disposable_domains.txt
+var embeddedDisposableDomains string
+
+// Disposable email handling selected per site (see EmailOptions).
+const (
+	DisposableOff    = ""
+	DisposableFlag   = "flag"
+	DisposableReject = "reject"
+)
+
+// EmailOptions are the site-specific checks of SanitizeEmailWithOptions.
+type EmailOptions struct {
+	// Disposable is DisposableOff, DisposableFlag or DisposableReject.
+	Disposable string
+
+	// DisposableFile is a domain list (one per line) checked in addition to the
+	// built-in list. It is read again when it changes.
+	DisposableFile string
+
+	// CheckMX rejects addresses whose domain cannot receive mail (see CheckMailDomain).
+	CheckMX bool
+	// MXTimeout limits the DNS lookup (DefaultMXTimeout if zero).
+	MXTimeout time.Duration
+}
+
+var (
+	builtinDisposableOnce sync.Once
+	builtinDisposable     map[string]bool
+
+	disposableFileMu    sync.Mutex
+	disposableFileCache = map[string]disposableFile{}
+)
+
+type disposableFile struct {
+	modTime time.Time
+	domains map[string]bool
+}
+
+// IsDisposableEmail reports whether the domain of an email address (or a parent domain)
+// is on the built-in list or in the given list file.
+func IsDisposableEmail(email, file string) (bool, error) {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false, nil
+	}
+	domain := strings.TrimSuffix(strings.ToLower(email[at+1:]), ".")
+
+	builtinDisposableOnce.Do(func() {
+		builtinDisposable = parseDomainList(bufio.NewScanner(strings.NewReader(embeddedDisposableDomains)))
+	})
+	if matchDomainList(builtinDisposable, domain) {
+		return true, nil
+	}
+
+	if strings.TrimSpace(file) == "" {
+		return false, nil
+	}
+	extra, err := loadDisposableFile(strings.TrimSpace(file))
+	if err != nil {
+		return false, err
+	}
+	return matchDomainList(extra, domain), nil
+}
+
+// matchDomainList reports whether domain or one of its parent domains is in the list.
+func matchDomainList(list map[string]bool, domain string) bool {
+	for domain != "" {
+		if list[domain] {
+			return true
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+	return false
+}
+
+// loadDisposableFile returns the domains of a list file, cached by modification time.
+func loadDisposableFile(path string) (map[string]bool, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("disposable domain list: %w", err)
+	}
+
+	disposableFileMu.Lock()
+	defer disposableFileMu.Unlock()
+	if c, ok := disposableFileCache[path]; ok && c.modTime.Equal(st.ModTime()) {
+		return c.domains, nil
+	}
+
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("disposable domain list: %w", err)
+	}
+	defer func() { _ = fh.Close() }()
+
+	sc := bufio.NewScanner(fh)
+	domains := parseDomainList(sc)
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("disposable domain list %s: %w", path, err)
+	}
+	disposableFileCache[path] = disposableFile{modTime: st.ModTime(), domains: domains}
+	return domains, nil
+}
+
+// parseDomainList reads one domain per line; empty lines and "#" comments are skipped.
+func parseDomainList(sc *bufio.Scanner) map[string]bool {
+	out := make(map[string]bool)
+	for sc.Scan() {
+		line := strings.ToLower(strings.TrimSpace(sc.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "@")
+		line = strings.TrimPrefix(line, "*.")
+		out[strings.Trim(line, ".")] = true
+	}
+	return out
+}
@@ -23,6 +23,12 @@ type AuthorNameReport struct {
 	CollapsedWhitespace bool
 	Trimmed             bool
 	RejectedFrontmatter bool // input was exactly "---" (or became that after trim)
+
+	// Unicode hardening
+	NormalizedNFC         bool
+	RemovedInvisibleChars int      // bidi controls and zero-width characters
+	MixedScriptWords      []string // words mixing e.g. Latin and Cyrillic letters (possible homograph)
+	Scripts               []string // scripts used in the name
 }
 
 // AuthorURLReport describes what was detected/changed while validating an author URL.
@@ -32,8 +38,15 @@ type AuthorURLReport struct {
 	InvalidUTF8Fixed bool
 	RemovedNULBytes  bool
 
-	Trimmed bool
+	Trimmed       bool
+	NormalizedNFC bool
+
+	// Host details for homograph detection (the URL is accepted nonetheless).
+	PunycodeHost    bool     // host contains IDN labels (xn--)
+	MixedScriptHost bool     // a host label mixes scripts, e.g. Latin and Cyrillic
+	HostScripts     []string // scripts used in the (decoded) host
 
+	RejectedInvisibleChars bool
 	RejectedTooLong        bool
 	RejectedWhitespace     bool
 	RejectedControlChars   bool
@@ -43,6 +56,11 @@ type AuthorURLReport struct {
 	RejectedHasUserInfo    bool
 	RejectedLocalhost      bool
 	RejectedPrivateOrLocal bool
+
+	// Site domain policy (see URLPolicy).
+	RejectedBlockedDomain bool
+	RejectedBlockedTLD    bool
+	RejectedNotAllowed    bool
 }
 
 // EmailReport describes what was detected/changed while validating an email address.
@@ -62,6 +80,17 @@ type EmailReport struct {
 	RejectedBadFormat     bool
 	RejectedNotPlainAddr  bool
 	RejectedEmpty         bool
+
+	// Disposable is set if the domain is a known throwaway mail service (see EmailOptions).
+	Disposable         bool
+	RejectedDisposable bool
+	// DisposableListError is set if the site's domain list could not be read;
+	// only the built-in list was checked then.
+	DisposableListError error
+
+	RejectedNoMX bool
+	// MXLookupError is set if the MX lookup failed or timed out; the address was accepted.
+	MXLookupError error
 }
 
 // SanitizeAuthorName applies a strict, unicode-aware whitelist to author names.
@@ -89,6 +118,10 @@ func SanitizeAuthorName(input string, maxLen int) (string, AuthorNameReport) {
 		input = strings.ToValidUTF8(input, "")
 	}
 
+	// Unicode hardening: compose characters, drop invisible and direction-changing ones.
+	input, rep.NormalizedNFC = normalizeNFC(input)
+	input, rep.RemovedInvisibleChars = stripInvisible(input, true)
+
 	trimmed := strings.TrimSpace(input)
 	if trimmed != input {
 		rep.Trimmed = true
@@ -191,6 +224,8 @@ func SanitizeAuthorName(input string, maxLen int) (string, AuthorNameReport) {
 		}
 	}
 
+	rep.MixedScriptWords, rep.Scripts = mixedScriptWords(out)
+
 	// Changed flag (compare to original input, not only trimmed).
 	if out != original {
 		rep.Changed = true
@@ -212,6 +247,12 @@ func SanitizeAuthorName(input string, maxLen int) (string, AuthorNameReport) {
 //
 // It returns the normalized URL string (u.String()) or an error if invalid.
 func SanitizeAuthorURL(input string, maxLen int) (string, AuthorURLReport, error) {
+	return SanitizeAuthorURLWithPolicy(input, maxLen, nil)
+}
+
+// SanitizeAuthorURLWithPolicy validates an author URL like SanitizeAuthorURL and
+// additionally checks the host against the site's domain policy (nil = no restriction).
+func SanitizeAuthorURLWithPolicy(input string, maxLen int, policy *URLPolicy) (string, AuthorURLReport, error) {
 	var rep AuthorURLReport
 	original := input
 
@@ -239,12 +280,20 @@ func SanitizeAuthorURL(input string, maxLen int) (string, AuthorURLReport, error
 		input = strings.ToValidUTF8(input, "")
 	}
 
+	input, rep.NormalizedNFC = normalizeNFC(input)
+
 	// Length limit (after trimming / UTF-8 fix).
 	if maxLen > 0 && len(input) > maxLen {
 		rep.RejectedTooLong = true
 		return "", rep, fmt.Errorf("author_url too long")
 	}
 
+	// Invisible characters have no legitimate use in a URL but can disguise it.
+	if _, n := stripInvisible(input, true); n > 0 {
+		rep.RejectedInvisibleChars = true
+		return "", rep, fmt.Errorf("author_url contains invisible characters")
+	}
+
 	// Reject any whitespace or control chars anywhere in the URL.
 	for _, r := range input {
 		if unicode.IsControl(r) {
@@ -302,6 +351,12 @@ func SanitizeAuthorURL(input string, maxLen int) (string, AuthorURLReport, error
 		}
 	}
 
+	rep.PunycodeHost, rep.MixedScriptHost, rep.HostScripts = inspectHost(host)
+
+	if err := policy.check(host, &rep); err != nil {
+		return "", rep, err
+	}
+
 	normalized := u.String()
 	if normalized != original {
 		rep.Changed = true
@@ -454,3 +509,32 @@ func SanitizeEmail(input string, maxLen int) (string, EmailReport, error) {
 	rep.Changed = (input != original)
 	return input, rep, nil
 }
+
+// SanitizeEmailWithOptions validates an email address like SanitizeEmail and applies
+// the site's disposable domain check: DisposableFlag only sets rep.Disposable,
+// DisposableReject also rejects the address. With CheckMX, addresses at domains
+// without mail exchanger are rejected.
+func SanitizeEmailWithOptions(input string, maxLen int, opts EmailOptions) (string, EmailReport, error) {
+	email, rep, err := SanitizeEmail(input, maxLen)
+	if err != nil {
+		return email, rep, err
+	}
+
+	if opts.Disposable != DisposableOff {
+		rep.Disposable, rep.DisposableListError = IsDisposableEmail(email, opts.DisposableFile)
+		if rep.Disposable && opts.Disposable == DisposableReject {
+			rep.RejectedDisposable = true
+			return "", rep, fmt.Errorf("email uses a disposable domain")
+		}
+	}
+
+	if opts.CheckMX {
+		var deliverable bool
+		deliverable, rep.MXLookupError = CheckMailDomain(email, opts.MXTimeout)
+		if !deliverable {
+			rep.RejectedNoMX = true
+			return "", rep, fmt.Errorf("email domain does not accept mail")
+		}
+	}
+	return email, rep, nil
+}
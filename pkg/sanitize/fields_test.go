@@ -0,0 +1,159 @@
+package sanitize
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestSanitizeAuthorNameUnicode(t *testing.T) {
+	// "Jose" with a combining acute accent, a zero-width space and a right-to-left override.
+	out, rep := SanitizeAuthorName("Jose\u0301\u200B \u202EAdmin", 0)
+	if out != "Jos\u00E9 Admin" {
+		t.Fatalf("unexpected name %q", out)
+	}
+	if !rep.NormalizedNFC || rep.RemovedInvisibleChars != 2 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+
+	// Cyrillic "а" in an otherwise Latin word.
+	_, rep = SanitizeAuthorName("pаypal support", 0)
+	if len(rep.MixedScriptWords) != 1 || rep.MixedScriptWords[0] != "pаypal" {
+		t.Fatalf("mixed script word not detected: %+v", rep)
+	}
+
+	// Different scripts in separate words are fine.
+	_, rep = SanitizeAuthorName("Анна Smith", 0)
+	if len(rep.MixedScriptWords) != 0 || len(rep.Scripts) != 2 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+}
+
+func TestSanitizeAuthorURLUnicode(t *testing.T) {
+	if _, rep, err := SanitizeAuthorURL("https://exa\u200Bmple.org/", 0); err == nil || !rep.RejectedInvisibleChars {
+		t.Fatalf("URL with zero-width space accepted (err=%v)", err)
+	}
+
+	// xn--pypal-4ve.com is "pаypal.com" with a Cyrillic а.
+	_, rep, err := SanitizeAuthorURL("https://xn--pypal-4ve.com/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.PunycodeHost || !rep.MixedScriptHost {
+		t.Fatalf("homograph host not detected: %+v", rep)
+	}
+}
+
+func TestSanitizeBodyInvisible(t *testing.T) {
+	out, rep := SanitizeCommentBodyWithReport("safe\u202E txt\u200B\n")
+	if out != "safe txt\n" || rep.RemovedInvisibleChars != 2 {
+		t.Fatalf("unexpected output %q (%+v)", out, rep)
+	}
+}
+
+func TestSanitizeAuthorURLPolicy(t *testing.T) {
+	policy := URLPolicyFromConfig(config.AuthorURLConfig{
+		AllowedDomains: []string{"example.org", "*.bücher.example"},
+		BlockedDomains: []string{"spam.example.org"},
+		BlockedTLDs:    []string{".zip"},
+	})
+
+	for _, ok := range []string{"https://example.org/", "https://blog.example.org/me", "https://shop.xn--bcher-kva.example/"} {
+		if _, _, err := SanitizeAuthorURLWithPolicy(ok, 0, policy); err != nil {
+			t.Fatalf("%s rejected: %v", ok, err)
+		}
+	}
+
+	if _, rep, err := SanitizeAuthorURLWithPolicy("https://www.spam.example.org/", 0, policy); err == nil || !rep.RejectedBlockedDomain {
+		t.Fatalf("blocked subdomain accepted (err=%v)", err)
+	}
+	if _, rep, err := SanitizeAuthorURLWithPolicy("https://example.zip/", 0, policy); err == nil || !rep.RejectedBlockedTLD {
+		t.Fatalf("blocked TLD accepted (err=%v)", err)
+	}
+	if _, rep, err := SanitizeAuthorURLWithPolicy("https://notexample.org/", 0, policy); err == nil || !rep.RejectedNotAllowed {
+		t.Fatalf("domain outside allowlist accepted (err=%v)", err)
+	}
+
+	if URLPolicyFromConfig(config.AuthorURLConfig{}) != nil {
+		t.Fatal("expected nil policy without lists")
+	}
+}
+
+func TestSanitizeEmailDisposable(t *testing.T) {
+	if _, rep, err := SanitizeEmailWithOptions("Someone@Sub.Mailinator.com", 0, EmailOptions{Disposable: DisposableReject}); err == nil || !rep.RejectedDisposable {
+		t.Fatalf("disposable address accepted (err=%v)", err)
+	}
+
+	email, rep, err := SanitizeEmailWithOptions("someone@yopmail.com", 0, EmailOptions{Disposable: DisposableFlag})
+	if err != nil || email != "someone@yopmail.com" || !rep.Disposable {
+		t.Fatalf("flag mode: email=%q rep=%+v err=%v", email, rep, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(path, []byte("# local list\nthrowaway.example\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts := EmailOptions{Disposable: DisposableReject, DisposableFile: path}
+	if _, _, err := SanitizeEmailWithOptions("me@throwaway.example", 0, opts); err == nil {
+		t.Fatal("domain from list file accepted")
+	}
+	if _, rep, err := SanitizeEmailWithOptions("me@example.org", 0, opts); err != nil || rep.Disposable {
+		t.Fatalf("regular address rejected: rep=%+v err=%v", rep, err)
+	}
+}
+
+func TestSanitizeEmailMX(t *testing.T) {
+	calls := 0
+	lookupMX = func(ctx context.Context, name string) ([]*net.MX, error) {
+		calls++
+		switch name {
+		case "mail.example":
+			return []*net.MX{{Host: "mx.mail.example.", Pref: 10}}, nil
+		case "nullmx.example":
+			return []*net.MX{{Host: ".", Pref: 0}}, nil
+		case "slow.example":
+			return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host == "web.example" {
+			return []string{"192.0.2.1"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	defer func() {
+		lookupMX = net.DefaultResolver.LookupMX
+		lookupHost = net.DefaultResolver.LookupHost
+		mxCache = map[string]mxEntry{}
+	}()
+
+	opts := EmailOptions{CheckMX: true, MXTimeout: time.Second}
+	for _, ok := range []string{"a@mail.example", "a@web.example", "a@slow.example"} {
+		if _, rep, err := SanitizeEmailWithOptions(ok, 254, opts); err != nil || rep.RejectedNoMX {
+			t.Fatalf("%s: expected accepted, got %v %+v", ok, err, rep)
+		}
+	}
+	for _, bad := range []string{"a@nullmx.example", "a@gone.example"} {
+		if _, rep, err := SanitizeEmailWithOptions(bad, 254, opts); err == nil || !rep.RejectedNoMX {
+			t.Fatalf("%s: expected rejected, got %v %+v", bad, err, rep)
+		}
+	}
+
+	// Answers are cached, failed lookups are not.
+	before := calls
+	_, _, _ = SanitizeEmailWithOptions("b@mail.example", 254, opts)
+	_, _, _ = SanitizeEmailWithOptions("b@gone.example", 254, opts)
+	if calls != before {
+		t.Fatalf("expected cached lookups, got %d new calls", calls-before)
+	}
+	_, rep, _ := SanitizeEmailWithOptions("b@slow.example", 254, opts)
+	if calls != before+1 || rep.MXLookupError == nil {
+		t.Fatalf("expected an uncached failing lookup, got %d calls %+v", calls-before, rep)
+	}
+}
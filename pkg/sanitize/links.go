@@ -0,0 +1,70 @@
+package sanitize
+
+import (
+	"net/url"
+	"strings"
+)
+
+// LinkRel is the rel attribute kept links should be rendered with.
+const LinkRel = "nofollow ugc"
+
+// trackingParams are query parameters removed from kept links (prefixes end with "_").
+var trackingParams = []string{"utm_", "fbclid", "gclid", "dclid", "msclkid", "yclid", "igshid", "mc_cid", "mc_eid", "_ga", "_hsenc", "_hsmi"}
+
+// safeLinkURL normalizes a link destination for output: only absolute http(s) URLs
+// with a host and without user info are accepted, http is upgraded to https and
+// tracking parameters are removed. Characters that could end a Markdown link
+// destination are percent-encoded.
+func safeLinkURL(raw string, rep *CommentBodyReport) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(strings.ToLower(raw), "www.") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		u.Scheme = "https"
+	default:
+		return "", false
+	}
+
+	if u.RawQuery != "" {
+		q := u.Query()
+		for key := range q {
+			if isTrackingParam(key) {
+				q.Del(key)
+				if rep != nil {
+					rep.StrippedTrackingParams++
+				}
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	s := strings.NewReplacer("(", "%28", ")", "%29", "<", "%3C", ">", "%3E", " ", "%20", "\\", "%5C").Replace(u.String())
+	return s, true
+}
+
+// isTrackingParam reports whether a query parameter only serves tracking.
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range trackingParams {
+		if key == p || (strings.HasSuffix(p, "_") && strings.HasPrefix(key, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepLink records a kept link in the report.
+func keepLink(rep *CommentBodyReport, u string) {
+	if rep == nil {
+		return
+	}
+	rep.KeptLinks = append(rep.KeptLinks, u)
+	rep.LinkRel = LinkRel
+}
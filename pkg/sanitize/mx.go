@@ -0,0 +1,122 @@
+package sanitize
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMXTimeout limits the DNS lookup of CheckMailDomain if no timeout is given.
+const DefaultMXTimeout = 2 * time.Second
+
+// Cache lifetimes of MX lookup results. Failed lookups (timeouts, SERVFAIL) are not cached.
+const (
+	mxPositiveTTL = 6 * time.Hour
+	mxNegativeTTL = 30 * time.Minute
+	mxCacheMax    = 10000
+)
+
+// Resolver functions, replaced in tests.
+var (
+	lookupMX   = net.DefaultResolver.LookupMX
+	lookupHost = net.DefaultResolver.LookupHost
+)
+
+type mxEntry struct {
+	deliverable bool
+	expires     time.Time
+}
+
+var (
+	mxMu    sync.Mutex
+	mxCache = map[string]mxEntry{}
+)
+
+// CheckMailDomain reports whether the domain of an email address can receive mail:
+// it has an MX record other than the null MX ("."), or no MX but an address record
+// (implicit MX, RFC 5321). Results are cached in memory. err is set if the lookup
+// failed or timed out; deliverable is true then, so callers fail open.
+func CheckMailDomain(email string, timeout time.Duration) (deliverable bool, err error) {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return true, nil
+	}
+	domain := strings.TrimSuffix(strings.ToLower(email[at+1:]), ".")
+	if domain == "" {
+		return true, nil
+	}
+
+	now := time.Now()
+	mxMu.Lock()
+	if e, ok := mxCache[domain]; ok && now.Before(e.expires) {
+		mxMu.Unlock()
+		return e.deliverable, nil
+	}
+	mxMu.Unlock()
+
+	if timeout <= 0 {
+		timeout = DefaultMXTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	deliverable, err = lookupMailDomain(ctx, domain)
+	if err != nil {
+		return true, err
+	}
+
+	ttl := mxPositiveTTL
+	if !deliverable {
+		ttl = mxNegativeTTL
+	}
+	mxMu.Lock()
+	if len(mxCache) >= mxCacheMax {
+		for k, e := range mxCache {
+			if now.After(e.expires) {
+				delete(mxCache, k)
+			}
+		}
+		if len(mxCache) >= mxCacheMax {
+			mxCache = map[string]mxEntry{}
+		}
+	}
+	mxCache[domain] = mxEntry{deliverable: deliverable, expires: now.Add(ttl)}
+	mxMu.Unlock()
+
+	return deliverable, nil
+}
+
+// lookupMailDomain resolves the MX records of domain, falling back to address records.
+func lookupMailDomain(ctx context.Context, domain string) (bool, error) {
+	mxs, err := lookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return false, err
+	}
+	if len(mxs) > 0 {
+		for _, mx := range mxs {
+			if mx.Host != "." && mx.Host != "" {
+				return true, nil
+			}
+		}
+		// Null MX: the domain explicitly accepts no mail.
+		return false, nil
+	}
+
+	addrs, err := lookupHost(ctx, domain)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(addrs) > 0, nil
+}
+
+// isNotFound reports whether err is an authoritative "no such host/record" answer.
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
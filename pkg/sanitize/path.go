@@ -0,0 +1,48 @@
+package sanitize
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RelativePath validates a path that must stay inside a base directory (a theme
+// target_path or a post_path below content/) and returns it in slash form, e.g.
+// "themes/foo". Backslashes are treated as separators on every OS, so config and DB
+// values behave the same on Linux and Windows hosts. Callers convert the result with
+// filepath.FromSlash before joining it with a directory.
+func RelativePath(p string) (string, error) {
+	p = strings.ReplaceAll(strings.TrimSpace(p), "\\", "/")
+	if p == "" {
+		return "", fmt.Errorf("path is empty")
+	}
+
+	// Reject absolute paths, including Windows drive letters ("C:/x", "C:x") and UNC paths.
+	if strings.HasPrefix(p, "/") || hasDriveLetter(p) {
+		return "", fmt.Errorf("absolute paths are not allowed")
+	}
+	if strings.ContainsRune(p, 0) {
+		return "", fmt.Errorf("path contains NUL byte")
+	}
+
+	clean := path.Clean(p)
+
+	// Reject anything that escapes the base directory (../...).
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("path escapes base directory (.. is not allowed)")
+	}
+	if clean == "." {
+		return "", fmt.Errorf("invalid relative path")
+	}
+
+	return clean, nil
+}
+
+// hasDriveLetter reports whether p starts with a Windows volume name like "C:".
+func hasDriveLetter(p string) bool {
+	if len(p) < 2 || p[1] != ':' {
+		return false
+	}
+	c := p[0]
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
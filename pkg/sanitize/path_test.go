@@ -0,0 +1,42 @@
+package sanitize
+
+import "testing"
+
+func TestRelativePath(t *testing.T) {
+	valid := map[string]string{
+		"themes/foo":        "themes/foo",
+		`themes\foo`:        "themes/foo",
+		"./themes//foo/":    "themes/foo",
+		`posts\2024\..\bar`: "posts/bar",
+		"a/./b":             "a/b",
+	}
+	for in, want := range valid {
+		got, err := RelativePath(in)
+		if err != nil {
+			t.Errorf("RelativePath(%q): unexpected error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("RelativePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		".",
+		"..",
+		"../x",
+		`..\x`,
+		"a/../../x",
+		"/etc/passwd",
+		`\\server\share`,
+		`C:\themes`,
+		"c:themes",
+		"a\x00b",
+	}
+	for _, in := range invalid {
+		if got, err := RelativePath(in); err == nil {
+			t.Errorf("RelativePath(%q) = %q, want error", in, got)
+		}
+	}
+}
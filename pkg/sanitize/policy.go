@@ -0,0 +1,66 @@
+package sanitize
+
+import (
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// Policy selects the Markdown formatting kept in comment bodies.
+// Disallowed formatting is degraded to plain text.
+type Policy struct {
+	Bold          bool
+	Italic        bool
+	InlineCode    bool
+	Blockquote    bool
+	Headings      bool
+	FencedCode    bool
+	Strikethrough bool
+
+	// Links keeps Markdown links and linkifies plain URLs (https only, see safeLinkURL).
+	Links bool
+
+	// MaxLength truncates the sanitized body to this many bytes (0 = no limit).
+	MaxLength int
+}
+
+// DefaultPolicy keeps bold, italic, inline code and blockquotes.
+func DefaultPolicy() Policy {
+	return Policy{Bold: true, Italic: true, InlineCode: true, Blockquote: true}
+}
+
+// PolicyFromConfig applies a site's allow/deny lists to the default policy.
+// Unknown element names are ignored (they are rejected when the config is loaded).
+func PolicyFromConfig(cfg config.SanitizeConfig) Policy {
+	p := DefaultPolicy()
+	for _, name := range cfg.Allow {
+		p.set(name, true)
+	}
+	for _, name := range cfg.Deny {
+		p.set(name, false)
+	}
+	p.MaxLength = cfg.MaxBodyLength
+	return p
+}
+
+// set enables or disables an element by its config name (see config.SanitizeElements).
+func (p *Policy) set(name string, allowed bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "bold":
+		p.Bold = allowed
+	case "italic":
+		p.Italic = allowed
+	case "code":
+		p.InlineCode = allowed
+	case "blockquote":
+		p.Blockquote = allowed
+	case "heading":
+		p.Headings = allowed
+	case "code_block":
+		p.FencedCode = allowed
+	case "strikethrough":
+		p.Strikethrough = allowed
+	case "link":
+		p.Links = allowed
+	}
+}
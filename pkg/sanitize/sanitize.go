@@ -7,6 +7,8 @@ import (
 
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
 	gmtext "github.com/yuin/goldmark/text"
 	"golang.org/x/net/html"
 )
@@ -19,6 +21,8 @@ type CommentBodyReport struct {
 	InvalidUTF8Fixed         bool
 	DroppedFrontmatterBreaks int // number of standalone "---" lines removed
 	RemovedNULBytes          bool
+	NormalizedNFC            bool
+	RemovedInvisibleChars    int // bidi controls and zero-width characters
 
 	// HTML detected (tags/comments/doctypes are removed from output)
 	HTMLTagTokens     int
@@ -28,14 +32,32 @@ type CommentBodyReport struct {
 	// Markdown constructs detected and degraded/removed
 	MarkdownLinks  int
 	MarkdownImages int
+
+	// Links kept by the policy (normalized URLs). Templates should render them with LinkRel.
+	KeptLinks []string
+	LinkRel   string
+	// StrippedTrackingParams counts query parameters removed from kept links.
+	StrippedTrackingParams int
+
+	// Formatting removed because the policy does not allow it.
+	DisallowedFormatting int
+
+	// Truncated is set if the body exceeded Policy.MaxLength.
+	Truncated bool
 }
 
-// SanitizeCommentBodyWithReport sanitizes comment text and returns a report
-// describing what was detected/changed.
+// SanitizeCommentBodyWithReport sanitizes comment text with the default policy
+// and returns a report describing what was detected/changed.
 //
 // Allowed formatting: bold, italic, inline code, blockquotes.
 // Disallowed: links, images, raw HTML.
 func SanitizeCommentBodyWithReport(input string) (string, CommentBodyReport) {
+	return SanitizeCommentBodyWithPolicy(input, DefaultPolicy())
+}
+
+// SanitizeCommentBodyWithPolicy sanitizes comment text, keeping the formatting the policy
+// allows. Links, images and raw HTML are never kept.
+func SanitizeCommentBodyWithPolicy(input string, policy Policy) (string, CommentBodyReport) {
 	var rep CommentBodyReport
 
 	original := input
@@ -68,6 +90,10 @@ func SanitizeCommentBodyWithReport(input string) (string, CommentBodyReport) {
 		input = strings.ReplaceAll(input, "\x00", "")
 	}
 
+	// Compose characters and drop bidi overrides and zero-width characters.
+	input, rep.NormalizedNFC = normalizeNFC(input)
+	input, rep.RemovedInvisibleChars = stripInvisible(input, false)
+
 	// Step 1: remove HTML markup by extracting only text tokens + collect HTML token stats.
 	plain, htmlTags, htmlComments, htmlDoctypes := stripHTMLToTextWithStats(input)
 	rep.HTMLTagTokens = htmlTags
@@ -75,16 +101,28 @@ func SanitizeCommentBodyWithReport(input string) (string, CommentBodyReport) {
 	rep.HTMLDoctypeTokens = htmlDoctypes
 
 	// Step 2: parse Markdown into AST.
-	md := goldmark.New()
+	var exts []goldmark.Extender
+	if policy.Strikethrough {
+		exts = append(exts, extension.Strikethrough)
+	}
+	if policy.Links {
+		exts = append(exts, extension.Linkify)
+	}
+	md := goldmark.New(goldmark.WithExtensions(exts...))
 	reader := gmtext.NewReader([]byte(plain))
 	doc := md.Parser().Parse(reader)
 
 	// Step 3: re-render allowlisted nodes back to "safe markdown", collecting AST stats.
-	out := renderAllowedMarkdownWithReport(doc, []byte(plain), &rep)
+	out := renderAllowedMarkdownWithReport(doc, []byte(plain), &rep, policy)
 
 	// Normalize trailing newline (exactly one).
 	out = strings.ReplaceAll(out, "\r\n", "\n")
-	out = strings.TrimRight(out, "\n") + "\n"
+	out = strings.TrimRight(out, "\n")
+	if policy.MaxLength > 0 && len(out) > policy.MaxLength {
+		rep.Truncated = true
+		out = truncateUTF8(out, policy.MaxLength)
+	}
+	out += "\n"
 
 	// Compute changed flag against original (also account for normalization).
 	if out != original {
@@ -100,6 +138,14 @@ func SanitizeCommentBody(input string) string {
 	return out
 }
 
+// truncateUTF8 cuts s to at most n bytes without splitting a rune.
+func truncateUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
 // stripHTMLToTextWithStats performs its package-specific operation.
 func stripHTMLToTextWithStats(s string) (text string, tagTokens int, commentTokens int, doctypeTokens int) {
 	var b strings.Builder
@@ -131,11 +177,11 @@ func stripHTMLToTextWithStats(s string) (text string, tagTokens int, commentToke
 }
 
 // renderAllowedMarkdownWithReport performs its package-specific operation.
-func renderAllowedMarkdownWithReport(doc ast.Node, source []byte, rep *CommentBodyReport) string {
+func renderAllowedMarkdownWithReport(doc ast.Node, source []byte, rep *CommentBodyReport, p Policy) string {
 	var b strings.Builder
 
 	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
-		b.WriteString(renderNodeWithReport(n, source, rep))
+		b.WriteString(renderNodeWithReport(n, source, rep, p))
 		if n.NextSibling() != nil && isBlockNode(n) {
 			b.WriteString("\n")
 		}
@@ -145,10 +191,10 @@ func renderAllowedMarkdownWithReport(doc ast.Node, source []byte, rep *CommentBo
 }
 
 // renderNodeWithReport performs its package-specific operation.
-func renderNodeWithReport(n ast.Node, source []byte, rep *CommentBodyReport) string {
+func renderNodeWithReport(n ast.Node, source []byte, rep *CommentBodyReport, p Policy) string {
 	switch x := n.(type) {
 	case *ast.Paragraph:
-		s := renderInlineChildrenWithReport(n, source, rep)
+		s := renderInlineChildrenWithReport(n, source, rep, p)
 		s = strings.TrimRight(s, " \t")
 		if s == "" {
 			return ""
@@ -165,19 +211,36 @@ func renderNodeWithReport(n ast.Node, source []byte, rep *CommentBodyReport) str
 		return out
 
 	case *ast.Emphasis:
-		content := renderInlineChildrenWithReport(n, source, rep)
+		content := renderInlineChildrenWithReport(n, source, rep, p)
 		if content == "" {
 			return ""
 		}
 		// goldmark: Level 1 = italic, Level 2 = bold
 		if x.Level == 2 {
+			if !p.Bold {
+				return disallowed(rep, content)
+			}
 			return "**" + content + "**"
 		}
+		if !p.Italic {
+			return disallowed(rep, content)
+		}
 		return "*" + content + "*"
 
+	case *east.Strikethrough:
+		// Only parsed if the policy allows strikethrough.
+		content := renderInlineChildrenWithReport(n, source, rep, p)
+		if content == "" {
+			return ""
+		}
+		return "~~" + content + "~~"
+
 	case *ast.CodeSpan:
 		seg := x.Text(source)
 		code := string(seg)
+		if !p.InlineCode {
+			return disallowed(rep, escapeText(code))
+		}
 		code = strings.ReplaceAll(code, "\r\n", "\n")
 		code = strings.ReplaceAll(code, "\r", "\n")
 
@@ -191,11 +254,14 @@ func renderNodeWithReport(n ast.Node, source []byte, rep *CommentBodyReport) str
 		return delim + code + delim
 
 	case *ast.Blockquote:
-		raw := renderBlockChildrenWithReport(n, source, rep)
+		raw := renderBlockChildrenWithReport(n, source, rep, p)
 		raw = strings.TrimRight(raw, "\n")
 		if raw == "" {
 			return ""
 		}
+		if !p.Blockquote {
+			return disallowed(rep, raw+"\n")
+		}
 		lines := strings.Split(raw, "\n")
 		for i := range lines {
 			if strings.TrimSpace(lines[i]) == "" {
@@ -206,44 +272,126 @@ func renderNodeWithReport(n ast.Node, source []byte, rep *CommentBodyReport) str
 		}
 		return strings.Join(lines, "\n") + "\n"
 
-	// Disallowed / degraded nodes:
+	case *ast.Heading:
+		s := strings.TrimRight(renderInlineChildrenWithReport(n, source, rep, p), " \t\n")
+		if s == "" {
+			return ""
+		}
+		if !p.Headings {
+			return disallowed(rep, s+"\n")
+		}
+		return strings.Repeat("#", x.Level) + " " + s + "\n"
+
+	case *ast.FencedCodeBlock:
+		if !p.FencedCode {
+			if rep != nil {
+				rep.DisallowedFormatting++
+			}
+			return ""
+		}
+		return renderFencedCode(x, source)
+
+	case *ast.AutoLink:
+		// Only kept if the policy allows links; otherwise plain URLs stay text.
+		raw := string(x.URL(source))
+		if x.AutoLinkType == ast.AutoLinkEmail {
+			return escapeText(raw)
+		}
+		if !p.Links {
+			return disallowed(rep, escapeText(raw))
+		}
+		u, ok := safeLinkURL(raw, rep)
+		if !ok {
+			return escapeText(raw)
+		}
+		keepLink(rep, u)
+		return "<" + u + ">"
+
 	case *ast.Link:
+		content := renderInlineChildrenWithReport(n, source, rep, p)
+		if p.Links {
+			if u, ok := safeLinkURL(string(x.Destination), rep); ok && strings.TrimSpace(content) != "" {
+				keepLink(rep, u)
+				return "[" + content + "](" + u + ")"
+			}
+		}
+		// Disallowed / degraded nodes:
 		if rep != nil {
 			rep.MarkdownLinks++
 		}
-		return renderInlineChildrenWithReport(n, source, rep)
+		return content
 
 	case *ast.Image:
 		if rep != nil {
 			rep.MarkdownImages++
 		}
-		return renderInlineChildrenWithReport(n, source, rep)
+		return renderInlineChildrenWithReport(n, source, rep, p)
 
 	default:
 		if n.HasChildren() {
 			if isBlockNode(n) {
-				return renderBlockChildrenWithReport(n, source, rep)
+				return renderBlockChildrenWithReport(n, source, rep, p)
 			}
-			return renderInlineChildrenWithReport(n, source, rep)
+			return renderInlineChildrenWithReport(n, source, rep, p)
 		}
 		return ""
 	}
 }
 
+// disallowed counts formatting removed by the policy and returns its plain content.
+func disallowed(rep *CommentBodyReport, content string) string {
+	if rep != nil {
+		rep.DisallowedFormatting++
+	}
+	return content
+}
+
+// renderFencedCode renders a fenced code block verbatim, with a fence longer than any
+// backtick run in the code and a language tag restricted to safe characters.
+func renderFencedCode(x *ast.FencedCodeBlock, source []byte) string {
+	var code strings.Builder
+	lines := x.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		code.Write(seg.Value(source))
+	}
+	body := strings.TrimRight(code.String(), "\n")
+
+	fence := "```"
+	for strings.Contains(body, fence) {
+		fence += "`"
+	}
+
+	lang := ""
+	if x.Info != nil {
+		info := strings.Fields(string(x.Info.Segment.Value(source)))
+		if len(info) > 0 {
+			lang = strings.Map(func(r rune) rune {
+				if r == '-' || r == '_' || r == '+' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+					return r
+				}
+				return -1
+			}, info[0])
+		}
+	}
+
+	return fence + lang + "\n" + body + "\n" + fence + "\n"
+}
+
 // renderInlineChildrenWithReport performs its package-specific operation.
-func renderInlineChildrenWithReport(n ast.Node, source []byte, rep *CommentBodyReport) string {
+func renderInlineChildrenWithReport(n ast.Node, source []byte, rep *CommentBodyReport, p Policy) string {
 	var b strings.Builder
 	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
-		b.WriteString(renderNodeWithReport(c, source, rep))
+		b.WriteString(renderNodeWithReport(c, source, rep, p))
 	}
 	return b.String()
 }
 
 // renderBlockChildrenWithReport performs its package-specific operation.
-func renderBlockChildrenWithReport(n ast.Node, source []byte, rep *CommentBodyReport) string {
+func renderBlockChildrenWithReport(n ast.Node, source []byte, rep *CommentBodyReport, p Policy) string {
 	var b strings.Builder
 	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
-		b.WriteString(renderNodeWithReport(c, source, rep))
+		b.WriteString(renderNodeWithReport(c, source, rep, p))
 		if c.NextSibling() != nil && isBlockNode(c) {
 			b.WriteString("\n")
 		}
@@ -276,7 +424,7 @@ func escapeText(s string) string {
 // isBlockNode performs its package-specific operation.
 func isBlockNode(n ast.Node) bool {
 	switch n.(type) {
-	case *ast.Paragraph, *ast.Blockquote:
+	case *ast.Paragraph, *ast.Blockquote, *ast.Heading, *ast.FencedCodeBlock:
 		return true
 	default:
 		return false
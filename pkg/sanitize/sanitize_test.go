@@ -0,0 +1,53 @@
+package sanitize
+
+import (
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestSanitizeDefaultPolicy(t *testing.T) {
+	out, rep := SanitizeCommentBodyWithReport("# Title\n\n**bold** ~~gone~~ [link](https://example.org)\n")
+	want := "Title\n\n**bold** ~~gone~~ link\n"
+	if out != want {
+		t.Fatalf("unexpected output %q, want %q", out, want)
+	}
+	if rep.DisallowedFormatting != 1 || rep.MarkdownLinks != 1 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+}
+
+func TestSanitizeAllowedExtras(t *testing.T) {
+	policy := PolicyFromConfig(config.SanitizeConfig{
+		Allow: []string{"heading", "code_block", "strikethrough"},
+		Deny:  []string{"bold"},
+	})
+	in := "## Title\n\n**bold** ~~old~~\n\n```go <script>\nfmt.Println(\"```\")\n```\n"
+	want := "## Title\n\nbold ~~old~~\n\n````go\nfmt.Println(\"```\")\n````\n"
+
+	out, _ := SanitizeCommentBodyWithPolicy(in, policy)
+	if out != want {
+		t.Fatalf("unexpected output %q, want %q", out, want)
+	}
+}
+
+func TestSanitizeMaxLength(t *testing.T) {
+	out, rep := SanitizeCommentBodyWithPolicy("äöü äöü", Policy{MaxLength: 5})
+	if out != "äö\n" || !rep.Truncated {
+		t.Fatalf("unexpected output %q (truncated=%t)", out, rep.Truncated)
+	}
+}
+
+func TestSanitizeLinks(t *testing.T) {
+	policy := PolicyFromConfig(config.SanitizeConfig{Allow: []string{"link"}})
+	in := "See [docs](http://example.org/a?utm_source=x&id=1) and www.example.com/b?fbclid=1 or [bad](javascript:alert(1))\n"
+	want := "See [docs](https://example.org/a?id=1) and <https://www.example.com/b> or bad\n"
+
+	out, rep := SanitizeCommentBodyWithPolicy(in, policy)
+	if out != want {
+		t.Fatalf("unexpected output %q, want %q", out, want)
+	}
+	if len(rep.KeptLinks) != 2 || rep.LinkRel != LinkRel || rep.StrippedTrackingParams != 2 || rep.MarkdownLinks != 1 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+}
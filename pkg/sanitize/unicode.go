@@ -0,0 +1,122 @@
+package sanitize
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// isBidiControl reports whether r is an explicit bidi embedding, override or isolate
+// (or a directional mark), which can visually reorder text ("Trojan Source").
+func isBidiControl(r rune) bool {
+	switch {
+	case r >= '\u202A' && r <= '\u202E', r >= '\u2066' && r <= '\u2069':
+		return true
+	case r == '\u200E', r == '\u200F', r == '\u061C':
+		return true
+	}
+	return false
+}
+
+// isZeroWidth reports whether r is an invisible character that can hide or split words.
+// Zero-width (non-)joiners are not included; scripts and emoji sequences need them.
+func isZeroWidth(r rune) bool {
+	switch r {
+	case '\u200B', '\u2060', '\uFEFF', '\u180E', '\u00AD':
+		return true
+	}
+	return false
+}
+
+// stripInvisible removes bidi controls and zero-width characters. With joiners set,
+// zero-width (non-)joiners are removed as well.
+func stripInvisible(s string, joiners bool) (string, int) {
+	removed := 0
+	out := strings.Map(func(r rune) rune {
+		if isBidiControl(r) || isZeroWidth(r) || (joiners && (r == '\u200C' || r == '\u200D')) {
+			removed++
+			return -1
+		}
+		return r
+	}, s)
+	return out, removed
+}
+
+// normalizeNFC returns s in Unicode normalization form C and whether it changed.
+func normalizeNFC(s string) (string, bool) {
+	if norm.NFC.IsNormalString(s) {
+		return s, false
+	}
+	return norm.NFC.String(s), true
+}
+
+// confusableScripts are scripts whose letters are commonly used to imitate Latin ones.
+var confusableScripts = []string{"Latin", "Cyrillic", "Greek", "Armenian", "Cherokee"}
+
+// scriptOf returns the name of the script of a letter, or "" for common/inherited characters.
+func scriptOf(r rune) string {
+	if !unicode.IsLetter(r) {
+		return ""
+	}
+	for _, name := range confusableScripts {
+		if unicode.Is(unicode.Scripts[name], r) {
+			return name
+		}
+	}
+	for name, table := range unicode.Scripts {
+		if name == "Common" || name == "Inherited" {
+			continue
+		}
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// mixedScriptWords returns the words of s (split at spaces and punctuation) that mix
+// letters of several scripts, and the sorted list of all scripts used in s.
+// A single word in several scripts is a typical homograph ("pаypal" with a Cyrillic а).
+func mixedScriptWords(s string) ([]string, []string) {
+	all := map[string]struct{}{}
+	var mixed []string
+
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	for _, w := range words {
+		scripts := map[string]struct{}{}
+		for _, r := range w {
+			if sc := scriptOf(r); sc != "" {
+				scripts[sc] = struct{}{}
+				all[sc] = struct{}{}
+			}
+		}
+		if len(scripts) > 1 {
+			mixed = append(mixed, w)
+		}
+	}
+
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return mixed, names
+}
+
+// inspectHost decodes IDN labels of a host and checks them for mixed scripts.
+func inspectHost(host string) (punycode bool, mixed bool, scripts []string) {
+	decoded := strings.ToLower(host)
+	if strings.Contains(decoded, "xn--") {
+		punycode = true
+		if u, err := idna.Lookup.ToUnicode(decoded); err == nil {
+			decoded = u
+		}
+	}
+	words, scripts := mixedScriptWords(decoded)
+	return punycode, len(words) > 0, scripts
+}
@@ -0,0 +1,98 @@
+package sanitize
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+	"golang.org/x/net/idna"
+)
+
+// URLPolicy restricts the hosts of author URLs. Domains are stored in their ASCII
+// (punycode) form and also match subdomains.
+type URLPolicy struct {
+	AllowedDomains []string
+	BlockedDomains []string
+	BlockedTLDs    []string
+}
+
+// URLPolicyFromConfig builds the author URL policy of a site.
+// It returns nil if no list is configured.
+func URLPolicyFromConfig(cfg config.AuthorURLConfig) *URLPolicy {
+	if len(cfg.AllowedDomains) == 0 && len(cfg.BlockedDomains) == 0 && len(cfg.BlockedTLDs) == 0 {
+		return nil
+	}
+	return &URLPolicy{
+		AllowedDomains: normalizeDomains(cfg.AllowedDomains),
+		BlockedDomains: normalizeDomains(cfg.BlockedDomains),
+		BlockedTLDs:    normalizeDomains(cfg.BlockedTLDs),
+	}
+}
+
+// check rejects hosts that are blocked or not allowed by the policy.
+// IP literals only pass if no allowlist is configured.
+func (p *URLPolicy) check(host string, rep *AuthorURLReport) error {
+	if p == nil {
+		return nil
+	}
+	host = normalizeDomain(host)
+
+	if net.ParseIP(host) == nil {
+		tld := host
+		if i := strings.LastIndex(host, "."); i >= 0 {
+			tld = host[i+1:]
+		}
+		for _, t := range p.BlockedTLDs {
+			if tld == t {
+				rep.RejectedBlockedTLD = true
+				return fmt.Errorf("author_url top-level domain is blocked")
+			}
+		}
+		for _, d := range p.BlockedDomains {
+			if matchesDomain(host, d) {
+				rep.RejectedBlockedDomain = true
+				return fmt.Errorf("author_url domain is blocked")
+			}
+		}
+	}
+
+	if len(p.AllowedDomains) == 0 {
+		return nil
+	}
+	for _, d := range p.AllowedDomains {
+		if matchesDomain(host, d) {
+			return nil
+		}
+	}
+	rep.RejectedNotAllowed = true
+	return fmt.Errorf("author_url domain is not allowed")
+}
+
+// matchesDomain reports whether host is domain or one of its subdomains.
+func matchesDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// normalizeDomains normalizes a list of config entries, dropping empty ones.
+func normalizeDomains(in []string) []string {
+	out := make([]string, 0, len(in))
+	for _, d := range in {
+		if d = normalizeDomain(d); d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// normalizeDomain lowercases a domain, strips "*." and dots at both ends and
+// converts IDN labels to punycode, so "bücher.example" and "xn--bcher-kva.example" match.
+func normalizeDomain(d string) string {
+	d = strings.ToLower(strings.TrimSpace(d))
+	d = strings.TrimPrefix(d, "*.")
+	d = strings.Trim(d, ".")
+	if ascii, err := idna.Lookup.ToASCII(d); err == nil {
+		return ascii
+	}
+	return d
+}
@@ -0,0 +1,193 @@
+// Package secrets encrypts and decrypts sensitive settings such as git access
+// tokens, so they can be stored at rest without exposing the plaintext.
+//
+// Encrypted values have the form "enc:v1:<base64url(nonce|ciphertext)>" and use
+// AES-256-GCM. The key is read from the FYNDMARK_SECRETS_KEY environment variable
+// or from the file configured as secrets.key_file. Values without the prefix are
+// treated as plaintext, so existing configurations keep working.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+const (
+	// Prefix marks an encrypted value.
+	Prefix = "enc:v1:"
+
+	// KeyEnv is the environment variable holding the secrets key.
+	KeyEnv = "FYNDMARK_SECRETS_KEY"
+
+	redacted = "***REDACTED***"
+)
+
+var ErrNoKey = errors.New("secrets key is not configured (set " + KeyEnv + " or secrets.key_file)")
+
+// IsEncrypted reports whether v carries the encryption prefix.
+func IsEncrypted(v string) bool {
+	return strings.HasPrefix(strings.TrimSpace(v), Prefix)
+}
+
+// Encrypt encrypts plaintext with the configured key.
+func Encrypt(plaintext string) (string, error) {
+	aead, err := loadAEAD()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("read nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return Prefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of an encrypted value.
+// Values without the prefix are returned unchanged.
+func Decrypt(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	aead, err := loadAEAD()
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value encoding")
+	}
+	if len(raw) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value length")
+	}
+
+	nonce, ciphertext := raw[:aead.NonceSize()], raw[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: wrong key or corrupted value")
+	}
+	return string(plain), nil
+}
+
+// Redact returns a placeholder for non-empty secrets, suitable for logs and API output.
+func Redact(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GenerateKey returns a new random key suitable for FYNDMARK_SECRETS_KEY.
+func GenerateKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("read key: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// rawKey performs its package-specific operation.
+func rawKey() (string, error) {
+	if v := strings.TrimSpace(os.Getenv(KeyEnv)); v != "" {
+		return v, nil
+	}
+
+	path := strings.TrimSpace(config.Cfg.Secrets.KeyFile)
+	if path == "" {
+		return "", ErrNoKey
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secrets key file: %w", err)
+	}
+	v := strings.TrimSpace(string(b))
+	if v == "" {
+		return "", ErrNoKey
+	}
+	return v, nil
+}
+
+// loadAEAD derives the AES-256 key from the configured key material.
+func loadAEAD() (cipher.AEAD, error) {
+	key, err := rawKey()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("init cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("init gcm: %w", err)
+	}
+	return aead, nil
+}
+
+// ValidateConfig checks that all encrypted values in the comment site config can be
+// decrypted with the configured key. Errors name the setting, never the value.
+func ValidateConfig() error {
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		if IsEncrypted(siteCfg.Git.AccessToken) {
+			if _, err := Decrypt(siteCfg.Git.AccessToken); err != nil {
+				return fmt.Errorf("comment_sites.%s.git.access_token: %w", siteKey, err)
+			}
+		}
+		if IsEncrypted(siteCfg.Git.Signing.Passphrase) {
+			if _, err := Decrypt(siteCfg.Git.Signing.Passphrase); err != nil {
+				return fmt.Errorf("comment_sites.%s.git.signing.passphrase: %w", siteKey, err)
+			}
+		}
+		for i, t := range siteCfg.Git.Themes {
+			if IsEncrypted(t.AccessToken) {
+				if _, err := Decrypt(t.AccessToken); err != nil {
+					return fmt.Errorf("comment_sites.%s.git.themes[%d].access_token: %w", siteKey, i, err)
+				}
+			}
+		}
+		if ak := siteCfg.Antispam.Akismet; ak != nil && IsEncrypted(ak.APIKey) {
+			if _, err := Decrypt(ak.APIKey); err != nil {
+				return fmt.Errorf("comment_sites.%s.antispam.akismet.api_key: %w", siteKey, err)
+			}
+		}
+		if IsEncrypted(siteCfg.Embed.Secret) {
+			if _, err := Decrypt(siteCfg.Embed.Secret); err != nil {
+				return fmt.Errorf("comment_sites.%s.embed.secret: %w", siteKey, err)
+			}
+		}
+		if IsEncrypted(siteCfg.Pipeline.DeployHook.URL) {
+			if _, err := Decrypt(siteCfg.Pipeline.DeployHook.URL); err != nil {
+				return fmt.Errorf("comment_sites.%s.pipeline.deploy_hook.url: %w", siteKey, err)
+			}
+		}
+		if IsEncrypted(siteCfg.Pipeline.Publish.S3.SecretAccessKey) {
+			if _, err := Decrypt(siteCfg.Pipeline.Publish.S3.SecretAccessKey); err != nil {
+				return fmt.Errorf("comment_sites.%s.pipeline.publish.s3.secret_access_key: %w", siteKey, err)
+			}
+		}
+		for i, hook := range siteCfg.Webhooks {
+			if IsEncrypted(hook.Secret) {
+				if _, err := Decrypt(hook.Secret); err != nil {
+					return fmt.Errorf("comment_sites.%s.webhooks[%d].secret: %w", siteKey, i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestEncryptDecryptRoundTrip tests the expected behavior of this component.
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	t.Setenv(KeyEnv, "test-key")
+
+	enc, err := Encrypt("github_pat_secret")
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if !strings.HasPrefix(enc, Prefix) {
+		t.Fatalf("encrypted value should start with %q, got %q", Prefix, enc)
+	}
+	if strings.Contains(enc, "github_pat_secret") {
+		t.Fatalf("encrypted value must not contain the plaintext")
+	}
+
+	plain, err := Decrypt(enc)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if plain != "github_pat_secret" {
+		t.Fatalf("decrypt mismatch: got %q", plain)
+	}
+
+	t.Setenv(KeyEnv, "other-key")
+	if _, err := Decrypt(enc); err == nil {
+		t.Fatalf("decrypt with wrong key should fail")
+	}
+}
+
+// TestDecryptPlaintextPassthrough tests the expected behavior of this component.
+func TestDecryptPlaintextPassthrough(t *testing.T) {
+	t.Setenv(KeyEnv, "")
+
+	plain, err := Decrypt("  plain-token ")
+	if err != nil {
+		t.Fatalf("decrypt plaintext: %v", err)
+	}
+	if plain != "plain-token" {
+		t.Fatalf("plaintext should pass through, got %q", plain)
+	}
+}
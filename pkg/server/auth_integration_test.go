@@ -3,6 +3,7 @@
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/cookiejar"
@@ -62,7 +63,7 @@ func TestAuthLoginLogoutFlow(t *testing.T) {
 	r := gin.New()
 	r.POST("/api/auth/login", authCtl.PostLogin)
 	r.POST("/api/auth/logout", authCtl.PostLogout)
-	r.GET("/api/users/list", usersCtl.GetList)
+	r.GET("/api/users/list", controller.RequireAuth(database, store, config.Cfg.WebAdmin.SessionName, controller.ScopeUsers), usersCtl.GetList)
 
 	srv := httptest.NewServer(r)
 	defer srv.Close()
@@ -92,6 +93,12 @@ func TestAuthLoginLogoutFlow(t *testing.T) {
 	if !strings.Contains(strings.Join(loginRes.Header.Values("Set-Cookie"), ";"), config.Cfg.WebAdmin.SessionName+"=") {
 		t.Fatalf("login should set session cookie")
 	}
+	var login struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	if err := json.NewDecoder(loginRes.Body).Decode(&login); err != nil || login.CSRFToken == "" {
+		t.Fatalf("login csrf_token: %v", err)
+	}
 
 	listReqBefore, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/users/list", nil)
 	listReqBefore.Header.Set("Origin", origin)
@@ -108,6 +115,7 @@ func TestAuthLoginLogoutFlow(t *testing.T) {
 
 	logoutReq, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/auth/logout", nil)
 	logoutReq.Header.Set("Origin", origin)
+	logoutReq.Header.Set(controller.CSRFHeader, login.CSRFToken)
 
 	logoutRes, err := client.Do(logoutReq)
 	if err != nil {
@@ -154,6 +162,110 @@ func TestAuthLoginLogoutFlow(t *testing.T) {
 	}
 }
 
+// TestAuthCSRF checks the CSRF token of state-changing requests with a session.
+func TestAuthCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "csrf-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	if _, err := users.Create(context.Background(), database, users.CreateParams{Email: "admin@example.com", Password: "Secret123!"}); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	usersCtl := controller.NewUsersController(database, store, sessionName)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/auth/me", authCtl.GetMe)
+	r.POST("/api/auth/logout", authCtl.PostLogout)
+	r.POST("/api/users/delete/:id", controller.RequireAuth(database, store, sessionName, controller.ScopeUsers), usersCtl.PostDelete)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	do := func(method, path, csrfToken string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(`{"email":"admin@example.com","password":"Secret123!"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if csrfToken != "" {
+			req.Header.Set(controller.CSRFHeader, csrfToken)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+
+	code, out := do(http.MethodPost, "/api/auth/login", "")
+	csrfToken, _ := out["csrf_token"].(string)
+	if code != http.StatusOK || csrfToken == "" {
+		t.Fatalf("login: status=%d body=%v", code, out)
+	}
+	if _, out := do(http.MethodGet, "/api/auth/me", ""); out["csrf_token"] != csrfToken {
+		t.Fatalf("me: csrf_token=%v, want the token of the login", out["csrf_token"])
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"missing", "", http.StatusForbidden},
+		{"wrong", csrfToken + "x", http.StatusForbidden},
+		{"valid", csrfToken, http.StatusNotFound},
+	} {
+		if code, out := do(http.MethodPost, "/api/users/delete/999", tc.token); code != tc.want {
+			t.Errorf("%s token: status=%d body=%v, want %d", tc.name, code, out, tc.want)
+		}
+	}
+
+	// Logout needs the token as well; a rejected logout keeps the session.
+	for _, token := range []string{"", csrfToken + "x"} {
+		if code, out := do(http.MethodPost, "/api/auth/logout", token); code != http.StatusForbidden || out["message"] != "CSRF_TOKEN_INVALID" {
+			t.Errorf("logout with token %q: status=%d body=%v, want 403", token, code, out)
+		}
+	}
+	if code, out := do(http.MethodGet, "/api/auth/me", ""); code != http.StatusOK {
+		t.Fatalf("me after rejected logout: status=%d body=%v", code, out)
+	}
+	if code, out := do(http.MethodPost, "/api/auth/logout", csrfToken); code != http.StatusOK {
+		t.Fatalf("logout with token: status=%d body=%v", code, out)
+	}
+	if code, _ := do(http.MethodGet, "/api/auth/me", ""); code != http.StatusUnauthorized {
+		t.Fatalf("me after logout: status=%d, want 401", code)
+	}
+
+	code, out = do(http.MethodPost, "/api/auth/login", "")
+	if code != http.StatusOK {
+		t.Fatalf("second login: status=%d body=%v", code, out)
+	}
+	config.Cfg.WebAdmin.DisableCSRF = true
+	if code, _ := do(http.MethodPost, "/api/users/delete/999", ""); code != http.StatusNotFound {
+		t.Errorf("disabled: status=%d, want 404", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/auth/logout", ""); code != http.StatusOK {
+		t.Errorf("disabled: logout status=%d, want 200", code)
+	}
+}
+
 // mustReadBody performs its package-specific operation.
 func mustReadBody(t *testing.T, res *http.Response) string {
 	t.Helper()
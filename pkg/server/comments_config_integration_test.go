@@ -0,0 +1,118 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// TestCommentsConfig checks the public site config, its ETag revalidation and the
+// answer for unknown sites.
+func TestCommentsConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.Server.BasePath = ""
+	siteCfg := config.CommentsSiteConfig{Title: "Blog"}
+	siteCfg.RateLimit.PerIP = 5
+	siteCfg.Captcha = &config.CaptchaConfig{
+		Enabled:   true,
+		Provider:  "Turnstile",
+		SiteKey:   " 0x4AAA ",
+		SecretKey: "captcha-secret",
+		Fallbacks: []config.CaptchaConfig{{Enabled: true, Provider: "builtin"}},
+	}
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": siteCfg, "unsynced": {}}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "config-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	if _, err := database.SyncSites(context.Background(), map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+
+	r := gin.New()
+	r.GET("/api/comments/:sitekey/config", controller.NewCommentsController(database, nil, nil, nil, nil).GetConfig)
+	get := func(siteKey, ifNoneMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/comments/"+siteKey+"/config", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("blog", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+	}
+	var out struct {
+		SiteKey string         `json:"site_key"`
+		Limits  map[string]int `json:"limits"`
+		Captcha struct {
+			Enabled   bool                `json:"enabled"`
+			Provider  string              `json:"provider"`
+			SiteKey   string              `json:"site_key"`
+			Fallbacks []map[string]string `json:"fallbacks"`
+		} `json:"captcha"`
+		RateLimit map[string]int `json:"rate_limit"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.SiteKey != "blog" {
+		t.Errorf("site_key = %q", out.SiteKey)
+	}
+	for k, want := range map[string]int{"author_max_chars": 80, "email_max_length": 254, "author_url_max_length": 2048, "body_max_length": 20000} {
+		if got := out.Limits[k]; got != want {
+			t.Errorf("limits.%s = %d, want %d", k, got, want)
+		}
+	}
+	if !out.Captcha.Enabled || out.Captcha.Provider != "turnstile" || out.Captcha.SiteKey != "0x4AAA" {
+		t.Errorf("captcha = %+v", out.Captcha)
+	}
+	if len(out.Captcha.Fallbacks) != 1 || out.Captcha.Fallbacks[0]["challenge_url"] != "/api/captcha/blog/new" {
+		t.Errorf("captcha fallbacks = %v", out.Captcha.Fallbacks)
+	}
+	if out.RateLimit["per_ip"] != 5 || out.RateLimit["window_seconds"] != 3600 {
+		t.Errorf("rate_limit = %v, want per_ip 5 and the default window of 3600", out.RateLimit)
+	}
+	if strings.Contains(w.Body.String(), "captcha-secret") {
+		t.Errorf("config leaks the captcha secret: %s", w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" || w.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Fatalf("etag=%q cache-control=%q", etag, w.Header().Get("Cache-Control"))
+	}
+
+	if w := get("blog", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("matching If-None-Match: status=%d body=%s, want 304", w.Code, w.Body.String())
+	}
+	if w := get("blog", `"other"`); w.Code != http.StatusOK {
+		t.Errorf("stale If-None-Match: status=%d, want 200", w.Code)
+	}
+
+	// Sites missing from the config or from the database are unknown.
+	for _, siteKey := range []string{"nope", "unsynced"} {
+		if w := get(siteKey, ""); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "unknown_site") {
+			t.Errorf("%s: status=%d body=%s, want 404", siteKey, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/commentid"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// TestCommentCounts checks that the count endpoints only count approved comments of
+// the requested site and post.
+func TestCommentCounts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog":     {},
+		"shop":     {},
+		"unsynced": {},
+	}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "count-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	shopID, _, _ := database.GetSiteIDByKey(ctx, "shop")
+	// Comments used as since markers need valid comment IDs.
+	b1, _ := commentid.New()
+	b3, _ := commentid.New()
+	for _, c := range []db.Comment{
+		{ID: b1, SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusApproved, CreatedAt: 1000},
+		{ID: "b2", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusApproved, CreatedAt: 2000},
+		{ID: b3, SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusPending, CreatedAt: 2100},
+		{ID: "b4", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusRejected, CreatedAt: 2200},
+		{ID: "b5", SiteID: blogID, PostPath: "/b/", Status: db.CommentStatusApproved, CreatedAt: 3000},
+		{ID: "b6", SiteID: blogID, PostPath: "/c/", Status: db.CommentStatusPending, CreatedAt: 3100},
+		{ID: "s1", SiteID: shopID, PostPath: "/a/", Status: db.CommentStatusApproved, CreatedAt: 1500},
+	} {
+		c.Author, c.Email, c.Body = "Bob", "bob@example.org", "b"
+		if err := database.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commentsCtl := controller.NewCommentsController(database, nil, nil, nil, nil)
+	r := gin.New()
+	r.GET("/api/comments/:sitekey/count", commentsCtl.GetCount)
+	r.GET("/api/comments/:sitekey/counts", commentsCtl.GetCounts)
+
+	type countResponse struct {
+		Error  string           `json:"error"`
+		Count  int64            `json:"count"`
+		Counts map[string]int64 `json:"counts"`
+	}
+	get := func(path string, q url.Values) (int, countResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?"+q.Encode(), nil))
+		var out countResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %s: %v: %s", path, err, w.Body.String())
+		}
+		return w.Code, out
+	}
+
+	// Per post: only approved comments of the site count.
+	for _, tc := range []struct {
+		site, post string
+		since      string
+		want       int64
+	}{
+		{"blog", "/a/", "", 2},
+		{"blog", "/b/", "", 1},
+		{"blog", "/c/", "", 0},
+		{"blog", "/nope/", "", 0},
+		{"shop", "/a/", "", 1},
+		{"blog", "/a/", "1500", 1},
+		{"blog", "/a/", b1, 1},
+	} {
+		q := url.Values{"post_path": {tc.post}}
+		if tc.since != "" {
+			q.Set("since", tc.since)
+		}
+		code, out := get("/api/comments/"+tc.site+"/count", q)
+		if code != http.StatusOK || out.Count != tc.want {
+			t.Errorf("count %s %s since %q: status=%d count=%d, want %d", tc.site, tc.post, tc.since, code, out.Count, tc.want)
+		}
+	}
+
+	// Batch: every requested post is listed, also those without comments.
+	code, out := get("/api/comments/blog/counts", url.Values{"post_path": {"/a/", "/b/", "/c/", " ", "/a/"}})
+	if code != http.StatusOK || len(out.Counts) != 3 || out.Counts["/a/"] != 2 || out.Counts["/b/"] != 1 || out.Counts["/c/"] != 0 {
+		t.Fatalf("counts: status=%d counts=%v", code, out.Counts)
+	}
+	code, out = get("/api/comments/shop/counts", url.Values{"post_path": {"/a/", "/b/"}})
+	if code != http.StatusOK || out.Counts["/a/"] != 1 || out.Counts["/b/"] != 0 {
+		t.Fatalf("shop counts: status=%d counts=%v", code, out.Counts)
+	}
+
+	tooMany := url.Values{}
+	for i := 0; i <= 100; i++ {
+		tooMany.Add("post_path", "/p"+strconv.Itoa(i)+"/")
+	}
+	for _, tc := range []struct {
+		name string
+		path string
+		q    url.Values
+		code int
+		err  string
+	}{
+		{"unknown site", "/api/comments/nope/count", url.Values{"post_path": {"/a/"}}, http.StatusNotFound, "unknown_site"},
+		{"unknown site, batch", "/api/comments/nope/counts", url.Values{"post_path": {"/a/"}}, http.StatusNotFound, "unknown_site"},
+		{"site not in database", "/api/comments/unsynced/count", url.Values{"post_path": {"/a/"}}, http.StatusNotFound, "unknown_site"},
+		{"missing post path", "/api/comments/blog/count", url.Values{}, http.StatusBadRequest, "missing_post_path"},
+		{"blank post paths", "/api/comments/blog/counts", url.Values{"post_path": {" "}}, http.StatusBadRequest, "missing_post_path"},
+		{"too many post paths", "/api/comments/blog/counts", tooMany, http.StatusBadRequest, "too_many_post_paths"},
+		{"pending since marker", "/api/comments/blog/count", url.Values{"post_path": {"/a/"}, "since": {b3}}, http.StatusBadRequest, "invalid_since"},
+	} {
+		if code, out := get(tc.path, tc.q); code != tc.code || out.Error != tc.err {
+			t.Errorf("%s: status=%d error=%q, want %d %q", tc.name, code, out.Error, tc.code, tc.err)
+		}
+	}
+}
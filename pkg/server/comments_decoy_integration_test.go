@@ -0,0 +1,152 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeSMTP accepts every mail on a local port and returns its address.
+func fakeSMTP(t *testing.T) (string, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+				reply("220 localhost ESMTP")
+				for {
+					line, err := rd.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						reply("250 localhost")
+					case cmd == "DATA":
+						reply("354 go ahead")
+						for {
+							l, err := rd.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if l == ".\r\n" {
+								break
+							}
+						}
+						reply("250 queued")
+					case cmd == "QUIT":
+						reply("221 bye")
+						return
+					default:
+						reply("250 ok")
+					}
+				}
+			}()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// TestDecoyResponsesWithDoubleOptIn checks that spam and silently blocked submissions
+// are answered exactly like accepted ones while double opt-in is enabled.
+func TestDecoyResponsesWithDoubleOptIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	akismet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		_, _ = w.Write([]byte(map[bool]string{true: "true", false: "false"}[r.PostForm.Get("comment_content") == "Cheap pills"]))
+	}))
+	defer akismet.Close()
+	host, port := fakeSMTP(t)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.SMTP = config.SMTPConfig{Host: host, Port: port, From: "fyndmark@example.org", TLSPolicy: "none"}
+	siteCfg := config.CommentsSiteConfig{TokenSecret: "blog-secret"}
+	siteCfg.DoubleOptIn = config.DoubleOptInConfig{Enabled: true, TTLHours: 24}
+	siteCfg.Antispam.Akismet = &config.AkismetConfig{Enabled: true, APIKey: "k3y", BlogURL: "https://blog.example.org/", APIURL: akismet.URL}
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": siteCfg}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "decoy-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	if _, _, err := database.AddBlocklistEntry(ctx, db.BlocklistEntry{SiteID: blogID, Kind: db.BlockEmail, Value: "blocked@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/api/comments/:sitekey/", controller.NewCommentsController(database, nil, nil, nil, nil).PostComment)
+	post := func(email, body string) (int, map[string]any) {
+		t.Helper()
+		payload, _ := json.Marshal(map[string]string{"post_path": "/a/", "author": "Bob", "email": email, "body": body})
+		req := httptest.NewRequest(http.MethodPost, "/api/comments/blog/", strings.NewReader(string(payload)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var out map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		// Only the comment ID differs between the responses.
+		delete(out, "id")
+		return w.Code, out
+	}
+
+	code, normal := post("bob@example.org", "Nice post")
+	if code != http.StatusCreated || normal["status"] != db.CommentStatusUnconfirmed || normal["confirmation_sent"] != true {
+		t.Fatalf("normal submission: status=%d body=%v", code, normal)
+	}
+	for name, got := range map[string][]string{"spam": {"bob@example.org", "Cheap pills"}, "blocked": {"blocked@example.org", "Nice post"}} {
+		code, out := post(got[0], got[1])
+		if code != http.StatusCreated || !reflect.DeepEqual(out, normal) {
+			t.Errorf("%s submission: status=%d body=%v, want %v", name, code, out, normal)
+		}
+	}
+
+	var statuses []string
+	rows, err := database.SQL.QueryContext(ctx, `SELECT status FROM comments ORDER BY status;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s string
+		_ = rows.Scan(&s)
+		statuses = append(statuses, s)
+	}
+	if !reflect.DeepEqual(statuses, []string{"spam", db.CommentStatusUnconfirmed}) {
+		t.Fatalf("stored comments = %v, want one spam and one unconfirmed", statuses)
+	}
+}
@@ -0,0 +1,122 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// TestCommentDetailRevisions lists the revisions of a comment edited by its author and
+// by a moderator.
+func TestCommentDetailRevisions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "detail-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	shopID, _, _ := database.GetSiteIDByKey(ctx, "shop")
+	adaID, err := users.Create(ctx, database, users.CreateParams{Email: "ada@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	if _, err := database.GrantUserSite(ctx, adaID, blogID); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.InsertComment(ctx, db.Comment{ID: "c1", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusPending, Author: "Bob", Email: "bob@example.org", Body: "teh body"}); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := database.UpdateCommentBody(ctx, blogID, "c1", "the body"); err != nil || !changed {
+		t.Fatalf("author edit: %v, %v", changed, err)
+	}
+	if _, err := database.PseudonymizeAuthor(ctx, db.PseudonymizeRequest{SiteID: blogID, Email: "bob@example.org", NewName: "Anonymous", UserID: adaID}); err != nil {
+		t.Fatal(err)
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	commentsCtl := controller.NewCommentsAdminController(database, store, sessionName, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/comments/detail", controller.RequireAuth(database, store, sessionName, controller.ScopeComments), commentsCtl.GetDetail)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	do := func(method, path, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+	do(http.MethodPost, "/api/auth/login", `{"email":"ada@example.com","password":"Secret123!"}`)
+
+	blog := strconv.FormatInt(blogID, 10)
+	cases := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"site without access", "site_id=" + strconv.FormatInt(shopID, 10) + "&id=c1", http.StatusForbidden},
+		{"unknown comment", "site_id=" + blog + "&id=nope", http.StatusNotFound},
+		{"missing id", "site_id=" + blog, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if code, out := do(http.MethodGet, "/api/comments/detail?"+tc.query, ""); code != tc.want {
+			t.Errorf("%s: status=%d body=%v, want %d", tc.name, code, out, tc.want)
+		}
+	}
+
+	code, out := do(http.MethodGet, "/api/comments/detail?site_id="+blog+"&id=c1", "")
+	revisions, _ := out["revisions"].([]any)
+	if code != http.StatusOK || len(revisions) != 2 {
+		t.Fatalf("detail: status=%d body=%v", code, out)
+	}
+	first, second := revisions[0].(map[string]any), revisions[1].(map[string]any)
+	if first["Field"] != "body" || first["OldValue"] != "teh body" || first["Reason"] != db.RevisionReasonAuthorEdit || first["ChangedByEmail"] != "" {
+		t.Fatalf("author edit revision: %v", first)
+	}
+	if second["Field"] != "author" || second["OldValue"] != "Bob" || second["ChangedByEmail"] != "ada@example.com" {
+		t.Fatalf("moderator revision: %v", second)
+	}
+	if comment, _ := out["comment"].(map[string]any); comment["Author"] != "Anonymous" || comment["Body"] != "the body" {
+		t.Fatalf("comment: %v", out["comment"])
+	}
+}
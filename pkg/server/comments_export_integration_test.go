@@ -0,0 +1,173 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// TestCommentExport exports comments as CSV and NDJSON with the filters of the list
+// endpoint and checks that only sites of the user are exported.
+func TestCommentExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "export-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	shopID, _, _ := database.GetSiteIDByKey(ctx, "shop")
+	adaID, err := users.Create(ctx, database, users.CreateParams{Email: "ada@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	if _, err := database.GrantUserSite(ctx, adaID, blogID); err != nil {
+		t.Fatal(err)
+	}
+	// 2026-10-01, 2026-10-08 and 2026-10-15 at noon UTC.
+	const oct1, oct8, oct15 = 1790856000, 1791460800, 1792065600
+	for _, c := range []db.Comment{
+		{ID: "c1", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusSpam, Author: "=HYPERLINK(\"x\")", Body: "buy, now\nplease", CreatedAt: oct1},
+		{ID: "c2", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusSpam, Author: "Spammer", Body: "cheap pills", CreatedAt: oct8},
+		{ID: "c3", SiteID: blogID, PostPath: "/b/", Status: db.CommentStatusApproved, Author: "Bob", Body: "nice post", CreatedAt: oct8},
+		{ID: "c4", SiteID: blogID, PostPath: "/b/", Status: db.CommentStatusSpam, Author: "Spammer", Body: "more pills", CreatedAt: oct15},
+		{ID: "s1", SiteID: shopID, PostPath: "/a/", Status: db.CommentStatusSpam, Author: "Spammer", Body: "pills", CreatedAt: oct8},
+	} {
+		c.Email, c.IP = "x@example.org", "192.0.2.1"
+		if err := database.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	commentsCtl := controller.NewCommentsAdminController(database, store, sessionName, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/comments/export", controller.RequireAuth(database, store, sessionName, controller.ScopeComments), commentsCtl.GetExport)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	get := func(query string) (*http.Response, []byte) {
+		t.Helper()
+		res, err := client.Get(srv.URL + "/api/comments/export?" + query)
+		if err != nil {
+			t.Fatalf("export %s: %v", query, err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res, body
+	}
+	res, err := client.Post(srv.URL+"/api/auth/login", "application/json", bytes.NewBufferString(`{"email":"ada@example.com","password":"Secret123!"}`))
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("login: %v %v", res, err)
+	}
+	res.Body.Close()
+
+	blog := strconv.FormatInt(blogID, 10)
+
+	// CSV: header, one row per comment, newest first, formulas defused.
+	res, body := get("format=csv&status=all&site_id=" + blog)
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/csv; charset=utf-8" || !strings.HasPrefix(res.Header.Get("Content-Disposition"), "attachment;") {
+		t.Fatalf("csv export: status=%d headers=%v", res.StatusCode, res.Header)
+	}
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v\n%s", err, body)
+	}
+	if len(records) != 5 || !strings.HasPrefix(strings.Join(records[0], ","), "id,site_id,entry_id,post_path,parent_id,status,author,email,author_url,body,ip,created_at,") {
+		t.Fatalf("csv records: %q", records)
+	}
+	var ids []string
+	for _, rec := range records[1:] {
+		ids = append(ids, rec[0])
+	}
+	if strings.Join(ids, " ") != "c4 c3 c2 c1" {
+		t.Fatalf("csv ids = %v", ids)
+	}
+	if last := records[4]; last[6] != "'=HYPERLINK(\"x\")" || last[9] != "buy, now\nplease" || last[11] != strconv.Itoa(oct1) {
+		t.Fatalf("csv row c1: %q", last)
+	}
+
+	// NDJSON with status and date filters: the spam of the week of October 8.
+	ndjson := func(query string) []string {
+		t.Helper()
+		res, body := get(query)
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Fatalf("ndjson export %s: status=%d body=%s", query, res.StatusCode, body)
+		}
+		var ids []string
+		sc := bufio.NewScanner(bytes.NewReader(body))
+		for sc.Scan() {
+			var c struct{ ID string }
+			if err := json.Unmarshal(sc.Bytes(), &c); err != nil {
+				t.Fatalf("decode line %q: %v", sc.Text(), err)
+			}
+			ids = append(ids, c.ID)
+		}
+		return ids
+	}
+	if got := ndjson("format=ndjson&status=spam&site_id=" + blog + "&since=2026-10-02&until=2026-10-08"); strings.Join(got, " ") != "c2" {
+		t.Fatalf("spam of the week = %v", got)
+	}
+	if got := ndjson("format=ndjson&status=spam&q=pills"); strings.Join(got, " ") != "c4 c2" {
+		t.Fatalf("spam with pills on all own sites = %v", got)
+	}
+	if got := ndjson("format=ndjson&status=all&limit=1&offset=1&site_id=" + blog); strings.Join(got, " ") != "c3" {
+		t.Fatalf("paged export = %v", got)
+	}
+
+	cases := []struct {
+		name  string
+		query string
+		want  int
+		msg   string
+	}{
+		{"site without access", "site_id=" + strconv.FormatInt(shopID, 10), http.StatusForbidden, "FORBIDDEN_SITE"},
+		{"invalid format", "format=xml", http.StatusBadRequest, "INVALID_FORMAT"},
+		{"invalid status", "status=hidden", http.StatusBadRequest, "INVALID_STATUS"},
+		{"invalid since", "since=last-week", http.StatusBadRequest, "INVALID_SINCE"},
+		{"inverted range", "since=2026-10-08&until=2026-10-01", http.StatusBadRequest, "INVALID_RANGE"},
+	}
+	for _, tc := range cases {
+		res, body := get(tc.query)
+		var out map[string]any
+		_ = json.Unmarshal(body, &out)
+		if res.StatusCode != tc.want || out["message"] != tc.msg {
+			t.Errorf("%s: status=%d body=%s, want %d %s", tc.name, res.StatusCode, body, tc.want, tc.msg)
+		}
+	}
+}
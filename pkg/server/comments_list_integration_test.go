@@ -0,0 +1,158 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/commentid"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// TestPublicListSince checks the orders of the public list and polling with since
+// markers, including comments approved in the same second.
+func TestPublicListSince(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {}}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "list-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+
+	// Since markers need valid comment IDs; ties in approved_at are broken by ID.
+	ids := make([]string, 6)
+	for i := range ids {
+		ids[i], _ = commentid.New()
+	}
+	sort.Strings(ids)
+	k1, k2, k3, k4, k5, p1 := ids[0], ids[1], ids[2], ids[3], ids[4], ids[5]
+	name := map[string]string{k1: "k1", k2: "k2", k3: "k3", k4: "k4", k5: "k5", p1: "p1"}
+	for _, c := range []db.Comment{
+		{ID: k1, PostPath: "/a/", Status: db.CommentStatusApproved, CreatedAt: 100, ApprovedAt: 400},
+		{ID: k2, PostPath: "/a/", Status: db.CommentStatusApproved, CreatedAt: 200, ApprovedAt: 300},
+		{ID: k3, PostPath: "/a/", Status: db.CommentStatusApproved, CreatedAt: 300, ApprovedAt: 400},
+		{ID: k4, PostPath: "/a/", Status: db.CommentStatusApproved, CreatedAt: 400, ApprovedAt: 500},
+		{ID: k5, PostPath: "/b/", Status: db.CommentStatusApproved, CreatedAt: 450, ApprovedAt: 450},
+		{ID: p1, PostPath: "/a/", Status: db.CommentStatusPending, CreatedAt: 250},
+	} {
+		c.SiteID, c.Author, c.Email, c.Body = blogID, "Bob", "bob@example.org", "b"
+		if err := database.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commentsCtl := controller.NewCommentsController(database, nil, nil, nil, nil)
+	r := gin.New()
+	r.GET("/api/comments/:sitekey/list", commentsCtl.GetPublicList)
+	r.GET("/api/comments/:sitekey/counts", commentsCtl.GetCounts)
+
+	type listResponse struct {
+		Error string `json:"error"`
+		Order string `json:"order"`
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+		NextSince *string          `json:"next_since"`
+		Counts    map[string]int64 `json:"counts"`
+	}
+	get := func(path string, q url.Values) (int, listResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path+"?"+q.Encode(), nil))
+		var out listResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %s: %v: %s", path, err, w.Body.String())
+		}
+		return w.Code, out
+	}
+	list := func(params ...string) (string, string, string) {
+		t.Helper()
+		q := url.Values{"post_path": {"/a/"}}
+		for i := 0; i+1 < len(params); i += 2 {
+			q.Set(params[i], params[i+1])
+		}
+		code, out := get("/api/comments/blog/list", q)
+		if code != http.StatusOK {
+			t.Fatalf("list %v: status=%d error=%q", params, code, out.Error)
+		}
+		var got []string
+		for _, it := range out.Items {
+			got = append(got, name[it.ID])
+		}
+		next := "-"
+		if out.NextSince != nil {
+			next = name[*out.NextSince]
+		}
+		return out.Order, strings.Join(got, " "), next
+	}
+
+	cases := []struct {
+		name      string
+		params    []string
+		order     string
+		items     string
+		nextSince string
+	}{
+		{"thread order", nil, db.OrderCreated, "k1 k2 k3 k4", "-"},
+		{"approval order", []string{"order", "approved"}, db.OrderApproved, "k2 k1 k3 k4", "k4"},
+		{"since unix seconds", []string{"since", "300"}, db.OrderApproved, "k1 k3 k4", "k4"},
+		{"since overrides order", []string{"since", "300", "order", "created"}, db.OrderApproved, "k1 k3 k4", "k4"},
+		{"since comment, same second", []string{"since", k1}, db.OrderApproved, "k3 k4", "k4"},
+		{"since comment, limited", []string{"since", k1, "limit", "1"}, db.OrderApproved, "k3", "k3"},
+		{"next poll", []string{"since", k3}, db.OrderApproved, "k4", "k4"},
+		{"nothing new", []string{"since", k4}, db.OrderApproved, "", "-"},
+		{"since other post's comment", []string{"since", k5}, db.OrderApproved, "k4", "k4"},
+	}
+	for _, tc := range cases {
+		order, items, next := list(tc.params...)
+		if order != tc.order || items != tc.items || next != tc.nextSince {
+			t.Errorf("%s: order=%s items=%q next_since=%s, want %s %q %s", tc.name, order, items, next, tc.order, tc.items, tc.nextSince)
+		}
+	}
+
+	// The counts accept the same markers.
+	code, out := get("/api/comments/blog/counts", url.Values{"post_path": {"/a/", "/b/"}, "since": {k1}})
+	if code != http.StatusOK || out.Counts["/a/"] != 2 || out.Counts["/b/"] != 1 {
+		t.Fatalf("counts since k1: status=%d counts=%v", code, out.Counts)
+	}
+
+	for _, tc := range []struct {
+		name string
+		q    url.Values
+		err  string
+	}{
+		{"pending comment as marker", url.Values{"post_path": {"/a/"}, "since": {p1}}, "invalid_since"},
+		{"unknown comment as marker", url.Values{"post_path": {"/a/"}, "since": {"not-an-id"}}, "invalid_since"},
+		{"negative since", url.Values{"post_path": {"/a/"}, "since": {"-1"}}, "invalid_since"},
+		{"unknown order", url.Values{"post_path": {"/a/"}, "order": {"newest"}}, "invalid_order"},
+		{"zero limit", url.Values{"post_path": {"/a/"}, "limit": {"0"}}, "invalid_limit"},
+		{"limit too large", url.Values{"post_path": {"/a/"}, "limit": {"501"}}, "invalid_limit"},
+		{"missing post path", url.Values{}, "missing_post_path"},
+	} {
+		if code, out := get("/api/comments/blog/list", tc.q); code != http.StatusBadRequest || out.Error != tc.err {
+			t.Errorf("%s: status=%d error=%q, want 400 %q", tc.name, code, out.Error, tc.err)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// recordingEnqueuer records the site keys of enqueued pipeline runs.
+type recordingEnqueuer struct {
+	sites []string
+}
+
+func (e *recordingEnqueuer) EnqueueRun(runID int64, siteID, commentID string) error {
+	e.sites = append(e.sites, siteID)
+	return nil
+}
+
+// TestAdminReply publishes a moderator's reply and queues a pipeline run.
+func TestAdminReply(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog": {AdminReply: config.AdminReplyConfig{Author: "The Editors", AuthorURL: "https://blog.example/about/"}},
+		"shop": {},
+	}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "reply-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	shopID, _, _ := database.GetSiteIDByKey(ctx, "shop")
+	adaID, err := users.Create(ctx, database, users.CreateParams{Email: "ada@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	if _, err := database.GrantUserSite(ctx, adaID, blogID); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []db.Comment{
+		{ID: "c1", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusApproved, Author: "Bob", Email: "bob@example.org", Body: "Question?"},
+		{ID: "c2", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusPending, Author: "Bob", Email: "bob@example.org", Body: "b"},
+		{ID: "s1", SiteID: shopID, PostPath: "/a/", Status: db.CommentStatusApproved, Author: "Bob", Email: "bob@example.org", Body: "b"},
+	} {
+		if err := database.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	enqueuer := &recordingEnqueuer{}
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	commentsCtl := controller.NewCommentsAdminController(database, store, sessionName, enqueuer, nil, nil, nil)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.POST("/api/comments/reply", controller.RequireAuth(database, store, sessionName, controller.ScopeComments), commentsCtl.PostReply)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	csrfToken := ""
+	do := func(path, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(controller.CSRFHeader, csrfToken)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+	_, out := do("/api/auth/login", `{"email":"ada@example.com","password":"Secret123!"}`)
+	csrfToken, _ = out["csrf_token"].(string)
+
+	blog := strconv.FormatInt(blogID, 10)
+	cases := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"site without access", `{"SiteID":` + strconv.FormatInt(shopID, 10) + `,"ParentID":"s1","Body":"x"}`, http.StatusForbidden},
+		{"missing body", `{"SiteID":` + blog + `,"ParentID":"c1","Body":" "}`, http.StatusBadRequest},
+		{"unknown parent", `{"SiteID":` + blog + `,"ParentID":"nope","Body":"x"}`, http.StatusNotFound},
+		{"pending parent", `{"SiteID":` + blog + `,"ParentID":"c2","Body":"x"}`, http.StatusConflict},
+	}
+	for _, tc := range cases {
+		if code, out := do("/api/comments/reply", tc.body); code != tc.want {
+			t.Errorf("%s: status=%d body=%v, want %d", tc.name, code, out, tc.want)
+		}
+	}
+	if len(enqueuer.sites) != 0 {
+		t.Fatalf("rejected replies enqueued runs: %v", enqueuer.sites)
+	}
+
+	code, out := do("/api/comments/reply", `{"SiteID":`+blog+`,"ParentID":"c1","Body":"Answer."}`)
+	if code != http.StatusCreated || out["run_id"] == nil {
+		t.Fatalf("reply: status=%d body=%v", code, out)
+	}
+	id, _ := out["comment"].(map[string]any)["ID"].(string)
+	c, found, err := database.GetComment(ctx, blogID, id)
+	if err != nil || !found {
+		t.Fatalf("reply not stored: %v, %v", found, err)
+	}
+	if c.Status != db.CommentStatusApproved || c.ApprovedAt == 0 || c.ParentID.String != "c1" || c.PostPath != "/a/" ||
+		c.Author != "The Editors" || c.AuthorURLString() != "https://blog.example/about/" || c.DecidedBy != strconv.FormatInt(adaID, 10) {
+		t.Fatalf("reply: %+v", c)
+	}
+	if len(enqueuer.sites) != 1 || enqueuer.sites[0] != "blog" {
+		t.Fatalf("enqueued runs: %v", enqueuer.sites)
+	}
+}
@@ -0,0 +1,106 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// TestAkismetClassification submits comments that Akismet classifies as spam or ham
+// or cannot classify, and checks their status and moderation mails.
+func TestAkismetClassification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var checked []string
+	akismet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		checked = append(checked, r.PostForm.Get("comment_content"))
+		if r.URL.Path != "/comment-check" || r.PostForm.Get("api_key") != "k3y" || r.PostForm.Get("user_ip") != "192.0.2.7" {
+			t.Errorf("request %s %v", r.URL.Path, r.PostForm)
+		}
+		switch r.PostForm.Get("comment_content") {
+		case "Cheap pills":
+			_, _ = w.Write([]byte("true"))
+		case "Nice post":
+			_, _ = w.Write([]byte("false"))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer akismet.Close()
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	siteCfg := config.CommentsSiteConfig{}
+	siteCfg.Antispam.Akismet = &config.AkismetConfig{Enabled: true, APIKey: "k3y", BlogURL: "https://blog.example.org/", APIURL: akismet.URL}
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": siteCfg}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "akismet-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+
+	r := gin.New()
+	r.POST("/api/comments/:sitekey/", controller.NewCommentsController(database, nil, nil, nil, nil).PostComment)
+
+	cases := []struct {
+		body       string
+		wantStatus string
+		wantMails  int
+	}{
+		{"Cheap pills", "spam", 0},
+		{"Nice post", db.CommentStatusPending, 1},
+		// Akismet errors fall back to normal moderation.
+		{"Unavailable", db.CommentStatusPending, 1},
+	}
+	for _, tc := range cases {
+		payload, _ := json.Marshal(map[string]string{"post_path": "/a/", "author": "Bob", "email": "bob@example.org", "body": tc.body})
+		req := httptest.NewRequest(http.MethodPost, "/api/comments/blog/", strings.NewReader(string(payload)))
+		req.RemoteAddr = "192.0.2.7:40000"
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var out struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		// The response does not reveal the classification.
+		if w.Code != http.StatusCreated || out.Status != "pending" {
+			t.Fatalf("%s: status=%d body=%s", tc.body, w.Code, w.Body.String())
+		}
+		c, found, err := database.GetComment(ctx, blogID, out.ID)
+		if err != nil || !found {
+			t.Fatalf("%s: get comment: %v %v", tc.body, found, err)
+		}
+		if c.Status != tc.wantStatus {
+			t.Errorf("%s: comment status = %q, want %q", tc.body, c.Status, tc.wantStatus)
+		}
+		var mails int
+		if err := database.SQL.QueryRowContext(ctx, `SELECT COUNT(*) FROM mail_outbox WHERE comment_id = ? AND kind = ?;`, out.ID, db.MailModeration).Scan(&mails); err != nil || mails != tc.wantMails {
+			t.Errorf("%s: moderation mails = %d, %v, want %d", tc.body, mails, err, tc.wantMails)
+		}
+	}
+	if len(checked) != len(cases) {
+		t.Fatalf("Akismet checked %q", checked)
+	}
+}
@@ -0,0 +1,108 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/events"
+	"github.com/gin-gonic/gin"
+)
+
+// TestCommentStream filters the stream by post_path, limits the streams per client
+// IP and ends the stream when the broker is closed.
+func TestCommentStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{"blog": {}}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "stream-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+
+	broker := events.NewBroker(0, 1)
+	commentsCtl := controller.NewCommentsController(database, nil, broker, nil, nil)
+	r := gin.New()
+	r.GET("/api/comments/:sitekey/stream", commentsCtl.GetStream)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	open := func(ctx context.Context) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/comments/blog/stream?post_path=/a/", nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	// next returns the next message of the stream, without its trailing blank line.
+	next := func(rd *bufio.Reader) string {
+		t.Helper()
+		var lines []string
+		for {
+			line, err := rd.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read stream: %v (got %q)", err, lines)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	streamCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	res := open(streamCtx)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status=%d content-type=%q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	rd := bufio.NewReader(res.Body)
+	// The handler subscribes before it sends the retry interval.
+	if msg := next(rd); msg != "retry: 5000\n" {
+		t.Fatalf("first message = %q", msg)
+	}
+
+	broker.Publish(blogID, events.Comment{ID: "c1", PostPath: "/b/", Body: "other thread"})
+	broker.Publish(blogID, events.Comment{ID: "c2", PostPath: "/a/", Body: "this thread"})
+	if msg := next(rd); !strings.HasPrefix(msg, "id: c2\nevent: comment\ndata: {") || !strings.Contains(msg, `"body":"this thread"`) {
+		t.Fatalf("event = %q, want c2 only", msg)
+	}
+
+	// A second stream of the same client exceeds the limit of one.
+	second := open(ctx)
+	body, _ := io.ReadAll(second.Body)
+	second.Body.Close()
+	if second.StatusCode != http.StatusTooManyRequests || !strings.Contains(string(body), "too_many_streams") {
+		t.Fatalf("second stream: status=%d body=%s", second.StatusCode, body)
+	}
+
+	// Closing the broker ends the stream.
+	broker.Close()
+	if _, err := io.ReadAll(rd); err != nil {
+		t.Fatalf("stream after Close: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// TestUpdatePendingComment edits a pending comment as moderator and checks the
+// sanitization and the recorded revisions.
+func TestUpdatePendingComment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "update-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	shopID, _, _ := database.GetSiteIDByKey(ctx, "shop")
+	adaID, err := users.Create(ctx, database, users.CreateParams{Email: "ada@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	if _, err := database.GrantUserSite(ctx, adaID, blogID); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []db.Comment{
+		{ID: "c1", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusPending, Author: "Bob", Email: "bob@example.org", Body: "teh body, call 555-1234"},
+		{ID: "c2", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusApproved, Author: "Bob", Email: "bob@example.org", Body: "b"},
+		{ID: "s1", SiteID: shopID, PostPath: "/a/", Status: db.CommentStatusPending, Author: "Bob", Email: "bob@example.org", Body: "b"},
+	} {
+		if err := database.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	commentsCtl := controller.NewCommentsAdminController(database, store, sessionName, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.POST("/api/comments/update", controller.RequireAuth(database, store, sessionName, controller.ScopeComments), commentsCtl.PostUpdate)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	csrfToken := ""
+	do := func(body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/comments/update", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(controller.CSRFHeader, csrfToken)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+	res, err := client.Post(srv.URL+"/api/auth/login", "application/json", strings.NewReader(`{"email":"ada@example.com","password":"Secret123!"}`))
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	var login map[string]any
+	_ = json.NewDecoder(res.Body).Decode(&login)
+	_ = res.Body.Close()
+	csrfToken, _ = login["csrf_token"].(string)
+
+	blog := strconv.FormatInt(blogID, 10)
+	cases := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"site without access", `{"SiteID":` + strconv.FormatInt(shopID, 10) + `,"CommentID":"s1","Body":"x"}`, http.StatusForbidden},
+		{"no fields", `{"SiteID":` + blog + `,"CommentID":"c1"}`, http.StatusBadRequest},
+		{"empty body", `{"SiteID":` + blog + `,"CommentID":"c1","Body":"  "}`, http.StatusBadRequest},
+		{"invalid url", `{"SiteID":` + blog + `,"CommentID":"c1","AuthorUrl":"javascript:alert(1)"}`, http.StatusBadRequest},
+		{"approved comment", `{"SiteID":` + blog + `,"CommentID":"c2","Body":"x"}`, http.StatusConflict},
+		{"unknown comment", `{"SiteID":` + blog + `,"CommentID":"nope","Body":"x"}`, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		if code, out := do(tc.body); code != tc.want {
+			t.Errorf("%s: status=%d body=%v, want %d", tc.name, code, out, tc.want)
+		}
+	}
+
+	code, out := do(`{"SiteID":` + blog + `,"CommentID":"c1","Author":" Bob\u0007 ","AuthorUrl":"https://bob.example","Body":"  the body  "}`)
+	if code != http.StatusOK {
+		t.Fatalf("update: status=%d body=%v", code, out)
+	}
+	if changed, _ := out["changed"].([]any); len(changed) != 2 {
+		t.Fatalf("changed fields: %v", out["changed"])
+	}
+	c, _, _ := database.GetComment(ctx, blogID, "c1")
+	if c.Author != "Bob" || c.Body != "the body" || c.AuthorURLString() != "https://bob.example" || c.Status != db.CommentStatusPending {
+		t.Fatalf("updated comment: %+v", c)
+	}
+	revs, err := database.ListCommentRevisions(ctx, blogID, "c1")
+	if err != nil || len(revs) != 2 || revs[0].ChangedBy != adaID || revs[0].Reason != db.RevisionReasonModeratorEdit {
+		t.Fatalf("revisions: %+v, %v", revs, err)
+	}
+}
@@ -0,0 +1,135 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// TestDoubleOptInConfirm confirms unconfirmed comments with signed links and checks
+// that expired, replayed and foreign tokens change nothing and that the cleanup
+// deletes only expired unconfirmed comments.
+func TestDoubleOptInConfirm(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	optIn := config.DoubleOptInConfig{Enabled: true, TTLHours: 24}
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog": {TokenSecret: "blog-secret", DoubleOptIn: optIn},
+		"shop": {TokenSecret: "shop-secret", DoubleOptIn: optIn},
+	}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "confirm-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	now := time.Now()
+	for _, c := range []db.Comment{
+		{ID: "fresh", Status: db.CommentStatusUnconfirmed, CreatedAt: now.Add(-time.Hour).Unix()},
+		{ID: "other", Status: db.CommentStatusUnconfirmed, CreatedAt: now.Add(-time.Hour).Unix()},
+		{ID: "stale", Status: db.CommentStatusUnconfirmed, CreatedAt: now.Add(-25 * time.Hour).Unix()},
+		{ID: "old-pending", Status: db.CommentStatusPending, CreatedAt: now.Add(-25 * time.Hour).Unix()},
+	} {
+		c.SiteID, c.PostPath, c.Author, c.Email, c.Body = blogID, "/a/", "Bob", "bob@example.org", "b"
+		if err := database.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commentsCtl := controller.NewCommentsController(database, nil, nil, nil, nil)
+	r := gin.New()
+	r.GET("/api/comments/:sitekey/confirm", commentsCtl.GetConfirm)
+	r.GET("/api/comments/:sitekey/decision", commentsCtl.GetDecision)
+
+	get := func(path, siteKey, token string) (int, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/comments/"+siteKey+"/"+path+"?"+url.Values{"token": {token}}.Encode(), nil))
+		return w.Code, w.Body.String()
+	}
+	status := func(id string) string {
+		t.Helper()
+		c, found, err := database.GetComment(ctx, blogID, id)
+		if err != nil || !found {
+			t.Fatalf("get comment %s: %v %v", id, found, err)
+		}
+		return c.Status
+	}
+	valid := func(id string) string {
+		return viewToken("blog", id, "confirm", now.Add(time.Hour), "blog-secret")
+	}
+
+	// Tokens that must not confirm anything.
+	rejected := []struct {
+		name    string
+		path    string
+		siteKey string
+		token   string
+		want    int
+	}{
+		{"expired", "confirm", "blog", viewToken("blog", "other", "confirm", now.Add(-time.Minute), "blog-secret"), http.StatusForbidden},
+		{"wrong action", "confirm", "blog", viewToken("blog", "other", "approve", now.Add(time.Hour), "blog-secret"), http.StatusBadRequest},
+		{"other site", "confirm", "shop", valid("other"), http.StatusForbidden},
+		{"other site's secret", "confirm", "blog", viewToken("blog", "other", "confirm", now.Add(time.Hour), "shop-secret"), http.StatusForbidden},
+		{"garbage", "confirm", "blog", "not-a-token", http.StatusBadRequest},
+		{"confirm token as decision", "decision", "blog", valid("other"), http.StatusBadRequest},
+	}
+	for _, tc := range rejected {
+		if code, body := get(tc.path, tc.siteKey, tc.token); code != tc.want {
+			t.Errorf("%s: status=%d body=%q, want %d", tc.name, code, body, tc.want)
+		}
+		if s := status("other"); s != db.CommentStatusUnconfirmed {
+			t.Fatalf("%s: comment status = %q", tc.name, s)
+		}
+	}
+
+	// A valid link moves the comment into the moderation queue, once.
+	if code, body := get("confirm", "blog", valid("fresh")); code != http.StatusOK || status("fresh") != db.CommentStatusPending {
+		t.Fatalf("confirm: status=%d body=%q comment=%s", code, body, status("fresh"))
+	}
+	var mails int
+	if err := database.SQL.QueryRowContext(ctx, `SELECT COUNT(*) FROM mail_outbox WHERE comment_id = 'fresh' AND kind = ?;`, db.MailModeration).Scan(&mails); err != nil || mails != 1 {
+		t.Fatalf("moderation mails = %d, %v", mails, err)
+	}
+	if code, body := get("confirm", "blog", valid("fresh")); code != http.StatusOK || body != "nothing to confirm (already confirmed or expired)" {
+		t.Fatalf("replayed confirm: status=%d body=%q", code, body)
+	}
+	if err := database.SQL.QueryRowContext(ctx, `SELECT COUNT(*) FROM mail_outbox WHERE comment_id = 'fresh';`).Scan(&mails); err != nil || mails != 1 {
+		t.Fatalf("replay queued another mail: %d, %v", mails, err)
+	}
+
+	// A link that outlives the TTL of its comment does not confirm it.
+	if code, body := get("confirm", "blog", valid("stale")); code != http.StatusOK || status("stale") != db.CommentStatusUnconfirmed {
+		t.Fatalf("confirm stale comment: status=%d body=%q comment=%s", code, body, status("stale"))
+	}
+
+	// The cleanup deletes expired unconfirmed comments only.
+	controller.CleanupUnconfirmed(ctx, database)
+	if _, found, _ := database.GetComment(ctx, blogID, "stale"); found {
+		t.Fatal("expired unconfirmed comment kept")
+	}
+	for _, id := range []string{"fresh", "other", "old-pending"} {
+		if _, found, _ := database.GetComment(ctx, blogID, id); !found {
+			t.Fatalf("comment %s deleted", id)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/mailer"
+	"github.com/geschke/fyndmark/pkg/pipeline"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// checkTimeout limits each readiness check.
+	checkTimeout = 5 * time.Second
+	// smtpCheckInterval is how long an SMTP check result is reused, so frequent probes
+	// do not open a connection to the mail server every time.
+	smtpCheckInterval = time.Minute
+)
+
+// checkResult is the outcome of one readiness check.
+type checkResult struct {
+	Status string `json:"status"` // ok or fail
+	Error  string `json:"error,omitempty"`
+}
+
+// probes serves the liveness and readiness endpoints.
+type probes struct {
+	db     *db.DB
+	worker *pipeline.Worker
+	// smtp enables the SMTP check.
+	smtp bool
+	// pingSMTP connects to the SMTP server; replaced in tests.
+	pingSMTP func(ctx context.Context) error
+
+	mu          sync.Mutex
+	smtpChecked time.Time
+	smtpErr     error
+}
+
+// newProbes returns the probe handlers.
+func newProbes(database *db.DB, worker *pipeline.Worker, smtp bool) *probes {
+	return &probes{db: database, worker: worker, smtp: smtp, pingSMTP: mailer.Ping}
+}
+
+// getHealthz reports that the process is alive.
+func (p *probes) getHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// getReadyz runs the readiness checks and responds 503 if one fails.
+func (p *probes) getReadyz(c *gin.Context) {
+	checks := map[string]checkResult{
+		"database":        p.checkDatabase(c.Request.Context()),
+		"pipeline_worker": p.checkWorker(),
+	}
+	if p.smtp {
+		checks["smtp"] = p.checkSMTP(c.Request.Context())
+	}
+
+	status, code := "ok", http.StatusOK
+	for _, r := range checks {
+		if r.Status != "ok" {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
+
+// checkDatabase verifies that the database accepts writes.
+func (p *probes) checkDatabase(ctx context.Context) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	return result(p.db.CheckWritable(ctx))
+}
+
+// checkWorker verifies that the pipeline worker is running.
+func (p *probes) checkWorker() checkResult {
+	if !p.worker.Running() {
+		return checkResult{Status: "fail", Error: "not running"}
+	}
+	return checkResult{Status: "ok"}
+}
+
+// checkSMTP verifies that the SMTP server accepts a connection, at most once per
+// smtpCheckInterval.
+func (p *probes) checkSMTP(ctx context.Context) checkResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.smtpChecked) >= smtpCheckInterval {
+		ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+		defer cancel()
+		p.smtpErr = p.pingSMTP(ctx)
+		p.smtpChecked = time.Now()
+	}
+	return result(p.smtpErr)
+}
+
+// result converts the error of a check.
+func result(err error) checkResult {
+	if err != nil {
+		return checkResult{Status: "fail", Error: err.Error()}
+	}
+	return checkResult{Status: "ok"}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/pipeline"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "ready.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	worker := pipeline.NewWorker(database, 1, nil)
+	p := newProbes(database, worker, true)
+	pings := 0
+	smtpErr := errors.New("connection refused")
+	p.pingSMTP = func(context.Context) error {
+		pings++
+		return smtpErr
+	}
+
+	router := gin.New()
+	router.GET("/readyz", p.getReadyz)
+	readyz := func() (int, map[string]checkResult) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body struct {
+			Checks map[string]checkResult `json:"checks"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return rec.Code, body.Checks
+	}
+
+	// Worker not started yet, SMTP failing.
+	code, checks := readyz()
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("got %d, want 503", code)
+	}
+	if checks["database"].Status != "ok" || checks["pipeline_worker"].Status != "fail" || checks["smtp"].Error != smtpErr.Error() {
+		t.Errorf("unexpected checks: %+v", checks)
+	}
+
+	worker.Start()
+	t.Cleanup(func() { _ = worker.Stop(context.Background()) })
+	p.smtpChecked = p.smtpChecked.Add(-smtpCheckInterval)
+	smtpErr = nil
+	if code, checks = readyz(); code != http.StatusOK {
+		t.Fatalf("got %d, want 200: %+v", code, checks)
+	}
+
+	// The SMTP result is reused within the check interval.
+	smtpErr = errors.New("down")
+	if code, _ = readyz(); code != http.StatusOK || pings != 2 {
+		t.Errorf("got %d after %d pings, want 200 after 2", code, pings)
+	}
+
+	_ = worker.Stop(context.Background())
+	if code, _ = readyz(); code != http.StatusServiceUnavailable {
+		t.Errorf("stopped worker: got %d, want 503", code)
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults of the server settings.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultDrainTimeout      = 2 * time.Minute
+
+	// Comment bodies are limited to 20000 bytes, which JSON escaping may expand.
+	defaultCommentsBodyBytes = 128 << 10
+	defaultFormsBodyBytes    = 64 << 10
+	defaultAdminBodyBytes    = 1 << 20
+
+	defaultStreamsPerSite = 1000
+	defaultStreamsPerIP   = 10
+)
+
+// seconds returns n seconds, or def if n is 0.
+func seconds(n int, def time.Duration) time.Duration {
+	if n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return def
+}
+
+// bytesOr returns n, or def if n is 0.
+func bytesOr(n, def int64) int64 {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// countOr returns n, or def if n is 0.
+func countOr(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// newHTTPServer returns the HTTP server with the configured timeouts and header limit.
+func newHTTPServer(sc config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              sc.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: seconds(sc.ReadHeaderTimeoutSeconds, defaultReadHeaderTimeout),
+		ReadTimeout:       seconds(sc.ReadTimeoutSeconds, defaultReadTimeout),
+		WriteTimeout:      seconds(sc.WriteTimeoutSeconds, defaultWriteTimeout),
+		IdleTimeout:       seconds(sc.IdleTimeoutSeconds, defaultIdleTimeout),
+		MaxHeaderBytes:    sc.MaxHeaderBytes, // 0 = http.DefaultMaxHeaderBytes
+	}
+}
+
+// limitBody rejects requests whose declared body exceeds limit bytes with 413 and
+// caps the body of the others, so handlers never read more than limit bytes.
+func limitBody(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "body_too_large"})
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
+
+// noWriteTimeout lifts the write timeout for long-running responses such as event
+// streams and exports.
+func noWriteTimeout(c *gin.Context) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Clear write deadline failed: %v", err)
+	}
+	c.Next()
+}
@@ -0,0 +1,212 @@
+package server_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// fakeIdP is an OpenID Connect provider that issues an ID token for the claims set
+// by the test, with the nonce of the last authorization request.
+type fakeIdP struct {
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString([]byte{1, 0, 1}),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+		payload, _ := json.Marshal(idp.claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		sum := sha256.Sum256([]byte(signed))
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed + "." + base64.RawURLEncoding.EncodeToString(sig)})
+	})
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+// TestOIDCLogin runs the login flow with auto-provisioning against a fake provider.
+func TestOIDCLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+
+	idp := newFakeIdP(t)
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+	config.Cfg.WebAdmin.OIDC = config.OIDCConfig{
+		Enabled:              true,
+		Issuer:               idp.srv.URL,
+		ClientID:             "fyndmark",
+		RedirectURL:          "http://fyndmark.test/api/auth/oidc/callback",
+		SuccessURL:           "https://admin.example/",
+		AutoProvision:        true,
+		AllowedDomains:       []string{"example.com"},
+		DisablePasswordLogin: true,
+	}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "oidc-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	if _, err := users.Create(context.Background(), database, users.CreateParams{Email: "ada@example.org", Password: "Secret123!"}); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	oidcCtl := controller.NewOIDCController(database, store, sessionName)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/auth/me", authCtl.GetMe)
+	r.GET("/api/auth/oidc/login", oidcCtl.GetLogin)
+	r.GET("/api/auth/oidc/callback", oidcCtl.GetCallback)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// login runs the flow for the given claims and returns the final redirect and the
+	// email of the logged-in user ("" if none).
+	login := func(claims map[string]any, tamperState bool) (*url.URL, string) {
+		t.Helper()
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+		res, err := client.Get(srv.URL + "/api/auth/oidc/login")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		authURL, _ := url.Parse(res.Header.Get("Location"))
+		if res.StatusCode != http.StatusFound || !strings.HasPrefix(authURL.String(), idp.srv.URL+"/authorize") {
+			t.Fatalf("login: status=%d location=%s", res.StatusCode, authURL)
+		}
+		q := authURL.Query()
+		if q.Get("code_challenge") == "" || q.Get("client_id") != "fyndmark" {
+			t.Fatalf("authorization request = %s", authURL)
+		}
+
+		claims["nonce"] = q.Get("nonce")
+		idp.claims = claims
+		state := q.Get("state")
+		if tamperState {
+			state += "x"
+		}
+		res, err = client.Get(srv.URL + "/api/auth/oidc/callback?code=c1&state=" + url.QueryEscape(state))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusFound {
+			t.Fatalf("callback: status=%d", res.StatusCode)
+		}
+		next, _ := url.Parse(res.Header.Get("Location"))
+
+		res, err = client.Get(srv.URL + "/api/auth/me")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var me struct {
+			Item struct{ Email string } `json:"item"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&me)
+		return next, me.Item.Email
+	}
+	claims := func(sub, email string, verified bool) map[string]any {
+		return map[string]any{"iss": idp.srv.URL, "aud": "fyndmark", "exp": time.Now().Add(time.Hour).Unix(), "sub": sub, "email": email, "email_verified": verified, "given_name": "Grace"}
+	}
+
+	// Existing user, matched by the verified email address.
+	next, email := login(claims("sub-ada", "Ada@example.org", true), false)
+	if next.String() != "https://admin.example/" || email != "ada@example.org" {
+		t.Fatalf("existing user: redirect=%s email=%q", next, email)
+	}
+	// The subject stays linked when the email changes.
+	if _, email := login(claims("sub-ada", "ada@new.example", false), false); email != "ada@example.org" {
+		t.Fatalf("linked subject: email=%q", email)
+	}
+	// New user from an allowed domain.
+	if _, email := login(claims("sub-grace", "grace@example.com", true), false); email != "grace@example.com" {
+		t.Fatalf("provisioned user: email=%q", email)
+	}
+	u, found, err := database.GetUserByEmail(context.Background(), "grace@example.com")
+	if err != nil || !found || u.FirstName != "Grace" {
+		t.Fatalf("provisioned user = %+v, %v, %v", u, found, err)
+	}
+
+	cases := []struct {
+		name    string
+		claims  map[string]any
+		tamper  bool
+		wantErr string
+	}{
+		{"other domain", claims("sub-eve", "eve@evil.example", true), false, "no_account"},
+		{"unverified email", claims("sub-mallory", "ada@example.org", false), false, "no_account"},
+		{"state", claims("sub-ada", "ada@example.org", true), true, "invalid_state"},
+	}
+	for _, tc := range cases {
+		next, email := login(tc.claims, tc.tamper)
+		if got := next.Query().Get("oidc_error"); got != tc.wantErr || email != "" {
+			t.Errorf("%s: oidc_error=%q email=%q, want %q", tc.name, got, email, tc.wantErr)
+		}
+	}
+
+	res, err := http.Post(srv.URL+"/api/auth/login", "application/json", strings.NewReader(`{"email":"ada@example.org","password":"Secret123!"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("password login: status=%d, want 403", res.StatusCode)
+	}
+}
@@ -0,0 +1,138 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// TestForcedPasswordChange resets the password of a user, who then has to change it
+// before using the admin API.
+func TestForcedPasswordChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "password-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := users.Create(ctx, database, users.CreateParams{Email: "ada@example.com", Password: "Secret123!"}); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	bobID, err := users.Create(ctx, database, users.CreateParams{Email: "bob@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	usersCtl := controller.NewUsersController(database, store, sessionName)
+	requireUsers := controller.RequireAuth(database, store, sessionName, controller.ScopeUsers)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/auth/me", authCtl.GetMe)
+	r.POST("/api/auth/change-password", authCtl.PostChangePassword)
+	r.GET("/api/users/list", requireUsers, usersCtl.GetList)
+	r.POST("/api/users/update-password/:id", requireUsers, usersCtl.PostUpdatePassword)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	csrfTokens := map[*http.Client]string{}
+	do := func(client *http.Client, method, path, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(controller.CSRFHeader, csrfTokens[client])
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+	login := func(email, password string) (*http.Client, map[string]any) {
+		t.Helper()
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		code, out := do(client, http.MethodPost, "/api/auth/login", `{"email":"`+email+`","password":"`+password+`"}`)
+		if code != http.StatusOK {
+			t.Fatalf("login %s: status=%d", email, code)
+		}
+		csrfTokens[client], _ = out["csrf_token"].(string)
+		return client, out
+	}
+
+	ada, _ := login("ada@example.com", "Secret123!")
+	if code, _ := do(ada, http.MethodPost, "/api/users/update-password/"+strconv.FormatInt(bobID, 10), `{"Password":"Temporary1!","PasswordDuplicate":"Temporary1!"}`); code != http.StatusOK {
+		t.Fatalf("reset password: status=%d", code)
+	}
+
+	bob, out := login("bob@example.com", "Temporary1!")
+	if out["password_change_required"] != true || out["password_change_reason"] != "PASSWORD_CHANGE_REQUIRED" {
+		t.Fatalf("login: %v", out)
+	}
+	if code, out := do(bob, http.MethodGet, "/api/users/list", ""); code != http.StatusForbidden || out["message"] != "PASSWORD_CHANGE_REQUIRED" {
+		t.Fatalf("restricted session: status=%d body=%v", code, out)
+	}
+	if code, _ := do(bob, http.MethodGet, "/api/auth/me", ""); code != http.StatusOK {
+		t.Fatalf("me: status=%d", code)
+	}
+
+	cases := []struct {
+		body string
+		want string
+	}{
+		{`{"CurrentPassword":"wrong","Password":"Secret456!","PasswordDuplicate":"Secret456!"}`, "INVALID_CURRENT_PASSWORD"},
+		{`{"CurrentPassword":"Temporary1!","Password":"Temporary1!","PasswordDuplicate":"Temporary1!"}`, "PASSWORD_UNCHANGED"},
+		{`{"CurrentPassword":"Temporary1!","Password":"Secret456!","PasswordDuplicate":"Other456!"}`, "PASSWORD_MISMATCH"},
+		{`{"CurrentPassword":"Temporary1!","Password":"Secret456!","PasswordDuplicate":"Secret456!"}`, "PASSWORD_UPDATED"},
+	}
+	for _, tc := range cases {
+		if _, out := do(bob, http.MethodPost, "/api/auth/change-password", tc.body); out["message"] != tc.want {
+			t.Errorf("change password %s: %v, want %s", tc.body, out, tc.want)
+		}
+	}
+	if code, _ := do(bob, http.MethodGet, "/api/users/list", ""); code != http.StatusOK {
+		t.Fatalf("after change: status=%d", code)
+	}
+
+	// Password expiry.
+	config.Cfg.WebAdmin.MaxPasswordAgeDays = 30
+	old := time.Now().AddDate(0, 0, -31).Unix()
+	if _, err := database.SQL.Exec(`UPDATE users SET password_changed_at = ? WHERE id = ?;`, old, bobID); err != nil {
+		t.Fatal(err)
+	}
+	if code, out := do(bob, http.MethodGet, "/api/users/list", ""); code != http.StatusForbidden || out["message"] != "PASSWORD_EXPIRED" {
+		t.Fatalf("expired password: status=%d body=%v", code, out)
+	}
+	if code, _ := do(ada, http.MethodGet, "/api/users/list", ""); code != http.StatusOK {
+		t.Fatalf("other user: status=%d", code)
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/geschke/fyndmark/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pprofHandler returns the net/http/pprof handlers below /debug/pprof/ and the
+// expvar metrics (e.g. pipeline.DiskCheckFailures) at /debug/vars.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// registerPprofRoutes adds the profiling endpoints to r. CPU profiles and traces
+// run for a given number of seconds, so the write timeout is lifted.
+func registerPprofRoutes(r *routes) {
+	// The handlers expect paths starting with /debug/pprof/.
+	h := gin.WrapH(http.StripPrefix(config.Cfg.Server.BasePath, pprofHandler()))
+	r = r.with(noWriteTimeout)
+	r.handle(http.MethodGet, "/debug/pprof/*name", h)
+	r.handle(http.MethodPost, "/debug/pprof/*name", h)
+	r.handle(http.MethodGet, "/debug/vars", h)
+}
+
+// startPprofServer serves the profiling endpoints on a separate listener and returns
+// a function that shuts it down.
+func startPprofServer(listen string) func(ctx context.Context) {
+	srv := &http.Server{
+		Addr:              listen,
+		Handler:           pprofHandler(),
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+	}
+	go func() {
+		log.Printf("pprof listening on %s", listen)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("pprof server failed: %v", err)
+		}
+	}()
+	return func(ctx context.Context) {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("pprof server shutdown failed: %v", err)
+		}
+	}
+}
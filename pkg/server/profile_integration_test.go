@@ -0,0 +1,113 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// TestUserProfile updates the own profile through /api/users/me.
+func TestUserProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "profile-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	for _, email := range []string{"ada@example.com", "bob@example.com"} {
+		if _, err := users.Create(context.Background(), database, users.CreateParams{Email: email, Password: "Secret123!"}); err != nil {
+			t.Fatalf("seed user: %v", err)
+		}
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	usersCtl := controller.NewUsersController(database, store, sessionName)
+	sessionOnly := controller.RequireAuth(database, store, sessionName, "")
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/users/me", sessionOnly, usersCtl.GetMe)
+	r.POST("/api/users/me", sessionOnly, usersCtl.PostMe)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	csrfToken := ""
+	do := func(method, path, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(controller.CSRFHeader, csrfToken)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+	login := func(email, password string) int {
+		t.Helper()
+		code, out := do(http.MethodPost, "/api/auth/login", `{"email":"`+email+`","password":"`+password+`"}`)
+		csrfToken, _ = out["csrf_token"].(string)
+		return code
+	}
+
+	if code := login("ada@example.com", "Secret123!"); code != http.StatusOK {
+		t.Fatalf("login: status=%d", code)
+	}
+	if code, out := do(http.MethodGet, "/api/users/me", ""); code != http.StatusOK || out["item"].(map[string]any)["Email"] != "ada@example.com" {
+		t.Fatalf("get: status=%d body=%v", code, out)
+	}
+
+	cases := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"name", `{"FirstName":"Ada","LastName":"Lovelace"}`, http.StatusOK},
+		{"email without password", `{"Email":"ada@example.org"}`, http.StatusForbidden},
+		{"email in use", `{"Email":"bob@example.com","CurrentPassword":"Secret123!"}`, http.StatusConflict},
+		{"email", `{"Email":"ada@example.org","CurrentPassword":"Secret123!"}`, http.StatusOK},
+		{"password mismatch", `{"CurrentPassword":"Secret123!","Password":"Secret456!","PasswordDuplicate":"x"}`, http.StatusBadRequest},
+		{"password", `{"CurrentPassword":"Secret123!","Password":"Secret456!","PasswordDuplicate":"Secret456!"}`, http.StatusOK},
+	}
+	for _, tc := range cases {
+		if code, out := do(http.MethodPost, "/api/users/me", tc.body); code != tc.want {
+			t.Errorf("%s: status=%d body=%v, want %d", tc.name, code, out, tc.want)
+		}
+	}
+
+	u, found, err := database.GetUserByEmail(context.Background(), "ada@example.org")
+	if err != nil || !found || u.FirstName != "Ada" || u.LastName != "Lovelace" {
+		t.Fatalf("user = %+v, %v, %v", u, found, err)
+	}
+	if code := login("ada@example.org", "Secret456!"); code != http.StatusOK {
+		t.Fatalf("login with new password: status=%d", code)
+	}
+}
@@ -0,0 +1,134 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// TestDeleteAndPurgeComments soft-deletes comments and purges them afterwards.
+func TestDeleteAndPurgeComments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "purge-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	shopID, _, _ := database.GetSiteIDByKey(ctx, "shop")
+	adaID, err := users.Create(ctx, database, users.CreateParams{Email: "ada@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	if _, err := database.GrantUserSite(ctx, adaID, blogID); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []db.Comment{
+		{ID: "c1", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusPending, Author: "a", Email: "a@example.org", Body: "b"},
+		{ID: "c2", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusPending, Author: "a", Email: "a@example.org", Body: "b"},
+		{ID: "s1", SiteID: shopID, PostPath: "/a/", Status: db.CommentStatusDeleted, Author: "a", Email: "a@example.org", Body: "b"},
+	} {
+		if err := database.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	commentsCtl := controller.NewCommentsAdminController(database, store, sessionName, nil, nil, nil, nil)
+	requireComments := controller.RequireAuth(database, store, sessionName, controller.ScopeComments)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/comments/list", requireComments, commentsCtl.GetList)
+	r.POST("/api/comments/delete", requireComments, commentsCtl.PostDelete)
+	r.POST("/api/comments/purge", requireComments, commentsCtl.PostPurge)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	csrfToken := ""
+	do := func(method, path, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(controller.CSRFHeader, csrfToken)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+	_, out := do(http.MethodPost, "/api/auth/login", `{"email":"ada@example.com","password":"Secret123!"}`)
+	csrfToken, _ = out["csrf_token"].(string)
+
+	blog := strconv.FormatInt(blogID, 10)
+	if code, out := do(http.MethodPost, "/api/comments/delete", `{"Items":[{"SiteID":`+blog+`,"CommentID":"c1"},{"SiteID":`+blog+`,"CommentID":"c2"}]}`); code != http.StatusOK {
+		t.Fatalf("delete: status=%d body=%v", code, out)
+	}
+	code, out := do(http.MethodGet, "/api/comments/list?status=deleted&site_id="+blog, "")
+	items, _ := out["items"].([]any)
+	if code != http.StatusOK || len(items) != 2 || items[0].(map[string]any)["DeletedAt"].(float64) == 0 {
+		t.Fatalf("list deleted: status=%d body=%v", code, out)
+	}
+
+	cases := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"site without access", `{"SiteID":` + strconv.FormatInt(shopID, 10) + `}`, http.StatusForbidden},
+		{"item of a site without access", `{"Items":[{"SiteID":` + blog + `,"CommentID":"c1"},{"SiteID":` + strconv.FormatInt(shopID, 10) + `,"CommentID":"s1"}]}`, http.StatusForbidden},
+		{"missing site", `{}`, http.StatusBadRequest},
+		{"empty items", `{"Items":[{"SiteID":0,"CommentID":""}]}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if code, out := do(http.MethodPost, "/api/comments/purge", tc.body); code != tc.want {
+			t.Errorf("%s: status=%d body=%v, want %d", tc.name, code, out, tc.want)
+		}
+	}
+	if _, found, _ := database.GetComment(ctx, blogID, "c1"); !found {
+		t.Fatal("rejected purge removed a comment")
+	}
+
+	if code, out := do(http.MethodPost, "/api/comments/purge", `{"Items":[{"SiteID":`+blog+`,"CommentID":"c1"}]}`); code != http.StatusOK || out["count"].(float64) != 1 {
+		t.Fatalf("purge item: status=%d body=%v", code, out)
+	}
+	if code, out := do(http.MethodPost, "/api/comments/purge", `{"SiteID":`+blog+`}`); code != http.StatusOK || out["count"].(float64) != 1 {
+		t.Fatalf("purge site: status=%d body=%v", code, out)
+	}
+	if n, err := database.CountComments(ctx, db.CommentListFilter{AllowedSiteIDs: []int64{blogID, shopID}, Status: "all"}); err != nil || n != 1 {
+		t.Fatalf("comments left: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,74 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// TestSubmissionRateLimitIgnoresSpoofedForwardedFor checks that the per-IP limit
+// keys on the resolved client IP: X-Forwarded-For only counts from trusted proxies.
+func TestSubmissionRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog": {RateLimit: config.RateLimitConfig{PerIP: 1}},
+	}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "ratelimit-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+
+	post := func(h http.Handler, forwardedFor string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/comments/blog/", strings.NewReader(`{}`))
+		req.RemoteAddr = "127.0.0.1:40000"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+	router := func() http.Handler {
+		r := gin.New()
+		r.POST("/api/comments/:sitekey/", controller.NewCommentsController(database, nil, nil, nil, nil).PostComment)
+		return r
+	}
+
+	// Untrusted peer: a different X-Forwarded-For per request does not reset the limit.
+	config.Cfg.Server.TrustedProxies = nil
+	r := router()
+	if code := post(r, "203.0.113.1"); code == http.StatusTooManyRequests {
+		t.Fatalf("first request limited")
+	}
+	if code := post(r, "203.0.113.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For: status=%d, want 429", code)
+	}
+
+	// Trusted proxy: the forwarded addresses are separate clients.
+	config.Cfg.Server.TrustedProxies = []string{"127.0.0.0/8"}
+	r = router()
+	if code := post(r, "203.0.113.1"); code == http.StatusTooManyRequests {
+		t.Fatalf("first client limited")
+	}
+	if code := post(r, "203.0.113.2"); code == http.StatusTooManyRequests {
+		t.Fatalf("second client behind trusted proxy limited")
+	}
+	if code := post(r, "203.0.113.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("repeated client behind trusted proxy: status=%d, want 429", code)
+	}
+}
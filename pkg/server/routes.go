@@ -0,0 +1,154 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/cors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// siteOrigins resolves the CORS origins of the comment site in :sitekey.
+func siteOrigins(c *gin.Context) ([]string, bool) {
+	siteCfg, ok := config.Cfg.CommentSites[c.Param("sitekey")]
+	return siteCfg.CORSAllowedOrigins, ok
+}
+
+// formOrigins resolves the CORS origins of the feedback form in :formid.
+func formOrigins(c *gin.Context) ([]string, bool) {
+	formCfg, ok := config.Cfg.Forms[c.Param("formid")]
+	return formCfg.CORSAllowedOrigins, ok
+}
+
+// adminOrigins returns the CORS origins of the admin API.
+func adminOrigins(_ *gin.Context) ([]string, bool) {
+	return config.Cfg.WebAdmin.CORSAllowedOrigins, true
+}
+
+// routes registers endpoints on a route group with CORS middleware, together with a
+// preflight handler, so every path answers OPTIONS with its CORS config. Preflights
+// skip the further middleware of the group, e.g. session auth.
+type routes struct {
+	group *gin.RouterGroup
+	// cors is the group with only the CORS middleware, used for preflights.
+	cors *gin.RouterGroup
+	// preflight tracks paths with a registered OPTIONS handler (one per path).
+	preflight map[string]bool
+}
+
+// newRoutes returns a registrar for routes on router with the given CORS middleware.
+func newRoutes(router gin.IRouter, corsMiddleware gin.HandlerFunc) *routes {
+	group := router.Group("", corsMiddleware)
+	return &routes{group: group, cors: group, preflight: make(map[string]bool)}
+}
+
+// with returns a registrar whose routes additionally use the given middleware.
+func (r *routes) with(middleware ...gin.HandlerFunc) *routes {
+	return &routes{group: r.group.Group("", middleware...), cors: r.cors, preflight: r.preflight}
+}
+
+// handle registers a handler and, once per path, its preflight handler.
+func (r *routes) handle(method, path string, h gin.HandlerFunc) {
+	r.group.Handle(method, path, h)
+	if r.preflight[path] {
+		return
+	}
+	r.preflight[path] = true
+	// The CORS middleware answers preflights; this only covers requests without Origin.
+	r.cors.OPTIONS(path, func(c *gin.Context) { c.Status(http.StatusNoContent) })
+}
+
+// registerPublicRoutes registers the public API used by embeds and forms.
+func registerPublicRoutes(router gin.IRouter, comments *controller.CommentsController, feedback *controller.FeedbackController, captchaCtl *controller.CaptchaController) {
+	limits := config.Cfg.Server.MaxBodyBytes
+	forms := newRoutes(router, cors.Middleware(formOrigins)).with(limitBody(bytesOr(limits.Forms, defaultFormsBodyBytes)))
+	forms.handle(http.MethodPost, "/api/feedbackmail/:formid", feedback.PostMail)
+
+	public := newRoutes(router, cors.Middleware(siteOrigins)).with(limitBody(bytesOr(limits.Comments, defaultCommentsBodyBytes)))
+	public.handle(http.MethodGet, "/api/comments/:sitekey/decision", comments.GetDecision)
+	public.handle(http.MethodGet, "/api/comments/:sitekey/confirm", comments.GetConfirm)
+	public.handle(http.MethodGet, "/api/comments/:sitekey/count", comments.GetCount)
+	public.handle(http.MethodGet, "/api/comments/:sitekey/counts", comments.GetCounts)
+	public.handle(http.MethodGet, "/api/comments/:sitekey/list", comments.GetPublicList)
+	public.with(noWriteTimeout).handle(http.MethodGet, "/api/comments/:sitekey/stream", comments.GetStream)
+	public.handle(http.MethodGet, "/api/comments/:sitekey/config", comments.GetConfig)
+	public.handle(http.MethodGet, "/api/captcha/:sitekey/new", captchaCtl.GetNew)
+
+	public.handle(http.MethodPost, "/api/comments/:sitekey/", comments.PostComment)
+	public.handle(http.MethodPost, "/api/comments/:sitekey/edit", comments.PostEdit)
+	public.handle(http.MethodPost, "/api/comments/:sitekey/withdraw", comments.PostWithdraw)
+}
+
+// registerAdminRoutes registers the admin API. Except for the auth endpoints, all
+// routes are guarded by requireAuth: the session of a logged-in user, or an API token
+// with the scope of the route. Routes with the empty scope accept sessions only.
+func registerAdminRoutes(router gin.IRouter, auth *controller.AuthController, requireAuth func(scope string) gin.HandlerFunc, usersCtl *controller.UsersController, sitesCtl *controller.SitesController, blocklistCtl *controller.BlocklistController, commentsAdminCtl *controller.CommentsAdminController, tokensCtl *controller.TokensController, oidcCtl *controller.OIDCController) {
+	admin := newRoutes(router, cors.Middleware(adminOrigins)).with(limitBody(bytesOr(config.Cfg.Server.MaxBodyBytes.Admin, defaultAdminBodyBytes)))
+	admin.handle(http.MethodPost, "/api/auth/login", auth.PostLogin)
+	admin.handle(http.MethodPost, "/api/auth/logout", auth.PostLogout)
+	admin.handle(http.MethodGet, "/api/auth/me", auth.GetMe)
+	admin.handle(http.MethodPost, "/api/auth/change-password", auth.PostChangePassword)
+	admin.handle(http.MethodGet, "/api/auth/providers", auth.GetProviders)
+	admin.handle(http.MethodGet, "/api/auth/oidc/login", oidcCtl.GetLogin)
+	admin.handle(http.MethodGet, "/api/auth/oidc/callback", oidcCtl.GetCallback)
+
+	users := admin.with(requireAuth(controller.ScopeUsers))
+	users.handle(http.MethodGet, "/api/users/list", usersCtl.GetList)
+	users.handle(http.MethodPost, "/api/users/add", usersCtl.PostAdd)
+	users.handle(http.MethodGet, "/api/users/:id", usersCtl.GetByID)
+	users.handle(http.MethodGet, "/api/users/logins/:id", usersCtl.GetLoginHistory)
+	users.handle(http.MethodGet, "/api/users/:id/sites", usersCtl.GetSites)
+	users.handle(http.MethodPost, "/api/users/:id/sites", usersCtl.PostSites)
+	users.handle(http.MethodPost, "/api/users/update/:id", usersCtl.PostUpdate)
+	users.handle(http.MethodPost, "/api/users/update-password/:id", usersCtl.PostUpdatePassword)
+	users.handle(http.MethodPost, "/api/users/delete/:id", usersCtl.PostDelete)
+
+	pipeline := admin.with(requireAuth(controller.ScopePipeline))
+	pipeline.handle(http.MethodGet, "/api/sites", sitesCtl.GetList)
+	pipeline.handle(http.MethodGet, "/api/sites/:id/pipeline-config", sitesCtl.GetPipelineConfig)
+	pipeline.handle(http.MethodGet, "/api/admin/sync-status", sitesCtl.GetSyncStatus)
+	pipeline.handle(http.MethodPost, "/api/sites/:id/pipeline/pause", sitesCtl.PostPipelinePause)
+	pipeline.handle(http.MethodPost, "/api/sites/:id/pipeline/resume", sitesCtl.PostPipelineResume)
+	pipeline.handle(http.MethodGet, "/api/sites/:id/runs/:run_id/files", sitesCtl.GetRunFiles)
+	pipeline.handle(http.MethodGet, "/api/pipeline/runs", sitesCtl.GetRuns)
+	pipeline.handle(http.MethodGet, "/api/pipeline/runs/:id", sitesCtl.GetRun)
+	pipeline.handle(http.MethodPost, "/api/pipeline/runs/:id/retry", sitesCtl.PostRunRetry)
+	pipeline.handle(http.MethodPost, "/api/pipeline/runs/:id/cancel", sitesCtl.PostRunCancel)
+	pipeline.handle(http.MethodGet, "/api/pipeline/runs/:id/logs", sitesCtl.GetRunLogs)
+
+	blocklist := admin.with(requireAuth(controller.ScopeBlocklist))
+	blocklist.handle(http.MethodGet, "/api/blocklist/list", blocklistCtl.GetList)
+	blocklist.handle(http.MethodPost, "/api/blocklist/add", blocklistCtl.PostAdd)
+	blocklist.handle(http.MethodPost, "/api/blocklist/delete/:id", blocklistCtl.PostDelete)
+
+	comments := admin.with(requireAuth(controller.ScopeComments))
+	comments.handle(http.MethodGet, "/api/comments/list", commentsAdminCtl.GetList)
+	comments.handle(http.MethodGet, "/api/comments/detail", commentsAdminCtl.GetDetail)
+	comments.with(noWriteTimeout).handle(http.MethodGet, "/api/comments/export", commentsAdminCtl.GetExport)
+	comments.handle(http.MethodPost, "/api/comments/approve", commentsAdminCtl.PostApprove)
+	comments.handle(http.MethodPost, "/api/comments/reject", commentsAdminCtl.PostReject)
+	comments.handle(http.MethodPost, "/api/comments/spam", commentsAdminCtl.PostSpam)
+	comments.handle(http.MethodPost, "/api/comments/delete", commentsAdminCtl.PostDelete)
+	comments.handle(http.MethodPost, "/api/comments/purge", commentsAdminCtl.PostPurge)
+	comments.handle(http.MethodPost, "/api/comments/update", commentsAdminCtl.PostUpdate)
+	comments.handle(http.MethodPost, "/api/comments/reply", commentsAdminCtl.PostReply)
+	comments.handle(http.MethodPost, "/api/comments/pseudonymize", commentsAdminCtl.PostPseudonymize)
+
+	// Tokens cannot manage tokens or reach the profiler. The own profile needs no
+	// users scope.
+	session := admin.with(requireAuth(""))
+	session.handle(http.MethodGet, "/api/tokens/list", tokensCtl.GetList)
+	session.handle(http.MethodPost, "/api/tokens/add", tokensCtl.PostAdd)
+	session.handle(http.MethodPost, "/api/tokens/revoke/:id", tokensCtl.PostRevoke)
+	session.handle(http.MethodGet, "/api/users/me", usersCtl.GetMe)
+	session.handle(http.MethodPost, "/api/users/me", usersCtl.PostMe)
+	session.handle(http.MethodGet, "/api/auth/sessions", auth.GetSessions)
+	session.handle(http.MethodPost, "/api/auth/sessions/revoke", auth.PostRevokeSessions)
+
+	if p := config.Cfg.Server.Pprof; p.Enabled && strings.TrimSpace(p.Listen) == "" {
+		registerPprofRoutes(session)
+	}
+}
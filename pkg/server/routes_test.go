@@ -0,0 +1,191 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPublicRoutesPreflight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog": {CORSAllowedOrigins: []string{"https://blog.example"}},
+	}
+	config.Cfg.Forms = map[string]config.FormConfig{
+		"contact": {CORSAllowedOrigins: []string{"https://blog.example"}},
+	}
+
+	router := gin.New()
+	// Admin routes share the /api/comments prefix with the public ones.
+	router.OPTIONS("/api/comments/list", func(c *gin.Context) {})
+	registerPublicRoutes(router, controller.NewCommentsController(nil, nil, nil, nil, nil), controller.NewFeedbackController(), controller.NewCaptchaController())
+
+	cases := []struct {
+		path   string
+		origin string
+		want   int
+	}{
+		{"/api/comments/blog/decision", "https://blog.example", http.StatusNoContent},
+		{"/api/comments/blog/count", "https://blog.example", http.StatusNoContent},
+		{"/api/comments/blog/", "https://blog.example", http.StatusNoContent},
+		{"/api/comments/blog/edit", "https://blog.example", http.StatusNoContent},
+		{"/api/captcha/blog/new", "https://blog.example", http.StatusNoContent},
+		{"/api/feedbackmail/contact", "https://blog.example", http.StatusNoContent},
+		{"/api/comments/blog/list", "https://evil.example", http.StatusForbidden},
+		{"/api/comments/other/list", "https://blog.example", http.StatusNotFound},
+		{"/api/feedbackmail/other", "https://blog.example", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodOptions, tc.path, nil)
+		req.Header.Set("Origin", tc.origin)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("OPTIONS %s (origin %s): got %d, want %d", tc.path, tc.origin, rec.Code, tc.want)
+		}
+		if tc.want == http.StatusNoContent && rec.Header().Get("Access-Control-Allow-Origin") != tc.origin {
+			t.Errorf("OPTIONS %s: missing Access-Control-Allow-Origin", tc.path)
+		}
+	}
+}
+
+func TestAdminRoutesMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.CORSAllowedOrigins = []string{"https://admin.example"}
+
+	router := gin.New()
+	requireAuth := func(scope string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Header("X-Scope", scope)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"success": false, "message": "UNAUTHORIZED"})
+		}
+	}
+	registerAdminRoutes(router, &controller.AuthController{}, requireAuth, &controller.UsersController{}, &controller.SitesController{}, &controller.BlocklistController{}, &controller.CommentsAdminController{}, &controller.TokensController{}, &controller.OIDCController{})
+
+	cases := []struct {
+		method string
+		path   string
+		origin string
+		want   int
+		scope  string
+	}{
+		{http.MethodOptions, "/api/users/list", "https://admin.example", http.StatusNoContent, ""},
+		{http.MethodOptions, "/api/pipeline/runs/1/logs", "https://admin.example", http.StatusNoContent, ""},
+		{http.MethodOptions, "/api/auth/login", "https://admin.example", http.StatusNoContent, ""},
+		{http.MethodOptions, "/api/users/list", "https://evil.example", http.StatusForbidden, ""},
+		{http.MethodGet, "/api/users/list", "https://evil.example", http.StatusForbidden, ""},
+		{http.MethodGet, "/api/users/list", "https://admin.example", http.StatusUnauthorized, controller.ScopeUsers},
+		{http.MethodPost, "/api/comments/approve", "", http.StatusUnauthorized, controller.ScopeComments},
+		{http.MethodGet, "/api/comments/export", "", http.StatusUnauthorized, controller.ScopeComments},
+		{http.MethodPost, "/api/pipeline/runs/1/retry", "", http.StatusUnauthorized, controller.ScopePipeline},
+		{http.MethodGet, "/api/admin/sync-status", "", http.StatusUnauthorized, controller.ScopePipeline},
+		{http.MethodPost, "/api/blocklist/add", "", http.StatusUnauthorized, controller.ScopeBlocklist},
+		{http.MethodPost, "/api/tokens/add", "", http.StatusUnauthorized, ""},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s (origin %s): got %d, want %d", tc.method, tc.path, tc.origin, rec.Code, tc.want)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("X-Scope") != tc.scope {
+			t.Errorf("%s %s: got scope %q, want %q", tc.method, tc.path, rec.Header().Get("X-Scope"), tc.scope)
+		}
+	}
+}
+
+func TestPprofRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.CORSAllowedOrigins = []string{"https://admin.example"}
+	config.Cfg.Server.Pprof.Enabled = true
+
+	loggedIn := false
+	requireAuth := func(scope string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			if !loggedIn || scope != "" {
+				c.AbortWithStatus(http.StatusUnauthorized)
+			}
+		}
+	}
+	router := gin.New()
+	registerAdminRoutes(router, &controller.AuthController{}, requireAuth, &controller.UsersController{}, &controller.SitesController{}, &controller.BlocklistController{}, &controller.CommentsAdminController{}, &controller.TokensController{}, &controller.OIDCController{})
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	if code := get("/debug/pprof/"); code != http.StatusUnauthorized {
+		t.Errorf("without session: got %d, want 401", code)
+	}
+	loggedIn = true
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/cmdline", "/debug/vars"} {
+		if code := get(path); code != http.StatusOK {
+			t.Errorf("GET %s: got %d, want 200", path, code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	if !strings.Contains(rec.Body.String(), `"fyndmark_disk_check_failures"`) {
+		t.Errorf("GET /debug/vars misses the disk check metric: %s", rec.Body.String())
+	}
+}
+
+func TestRoutesBelowBasePath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.Server.BasePath = "/fyndmark"
+	config.Cfg.Server.Pprof.Enabled = true
+	config.Cfg.WebAdmin.CORSAllowedOrigins = []string{"https://blog.example"}
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog": {CORSAllowedOrigins: []string{"https://blog.example"}},
+	}
+
+	router := gin.New()
+	api := router.Group(config.Cfg.Server.BasePath)
+	registerPublicRoutes(api, controller.NewCommentsController(nil, nil, nil, nil, nil), controller.NewFeedbackController(), controller.NewCaptchaController())
+	registerAdminRoutes(api, &controller.AuthController{}, func(string) gin.HandlerFunc { return func(*gin.Context) {} }, &controller.UsersController{}, &controller.SitesController{}, &controller.BlocklistController{}, &controller.CommentsAdminController{}, &controller.TokensController{}, &controller.OIDCController{})
+
+	cases := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodOptions, "/fyndmark/api/comments/blog/count", http.StatusNoContent},
+		{http.MethodOptions, "/api/comments/blog/count", http.StatusNotFound},
+		{http.MethodGet, "/fyndmark/debug/pprof/heap", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Origin", "https://blog.example")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s %s: got %d, want %d", tc.method, tc.path, rec.Code, tc.want)
+		}
+		// pprof serves its index page for paths it does not recognize.
+		if strings.HasSuffix(tc.path, "/heap") && strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("%s %s: got the pprof index instead of the profile", tc.method, tc.path)
+		}
+	}
+}
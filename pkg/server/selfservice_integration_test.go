@@ -0,0 +1,168 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+// TestSelfServiceEditAndWithdraw edits and withdraws comments with edit tokens and
+// checks that tokens of the wrong type, expired, foreign or replayed tokens are
+// refused.
+func TestSelfServiceEditAndWithdraw(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	selfService := config.SelfServiceConfig{Enabled: true, WindowMinutes: 15}
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog":  {TokenSecret: "blog-secret", SelfService: selfService},
+		"shop":  {TokenSecret: "shop-secret", SelfService: selfService},
+		"plain": {TokenSecret: "blog-secret"},
+	}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "selfservice-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop", "plain": "Plain"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	for _, id := range []string{"c1", "c2", "c3"} {
+		if err := database.InsertComment(ctx, db.Comment{ID: id, SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusPending, Author: "Bob", Email: "bob@example.org", Body: "teh body"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commentsCtl := controller.NewCommentsController(database, nil, nil, nil, nil)
+	r := gin.New()
+	r.POST("/api/comments/:sitekey/edit", commentsCtl.PostEdit)
+	r.POST("/api/comments/:sitekey/withdraw", commentsCtl.PostWithdraw)
+
+	type response struct {
+		Error   string `json:"error"`
+		ID      string `json:"id"`
+		Changed bool   `json:"changed"`
+	}
+	post := func(action, siteKey, token, body string) (int, response) {
+		t.Helper()
+		payload, _ := json.Marshal(map[string]string{"edit_token": token, "body": body})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/comments/"+siteKey+"/"+action, strings.NewReader(string(payload)))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		var out response
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %s: %v: %s", action, err, w.Body.String())
+		}
+		return w.Code, out
+	}
+	comment := func(id string) (db.Comment, bool) {
+		t.Helper()
+		c, found, err := database.GetComment(ctx, blogID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c, found
+	}
+	inWindow := time.Now().Add(10 * time.Minute)
+	editToken := func(id string) string {
+		return viewToken("blog", id, "edit", inWindow, "blog-secret")
+	}
+
+	// Refused tokens change nothing, on both endpoints.
+	refused := []struct {
+		name    string
+		siteKey string
+		token   string
+		code    int
+		err     string
+	}{
+		{"missing token", "blog", "", http.StatusBadRequest, "missing_edit_token"},
+		{"garbage", "blog", "not-a-token", http.StatusForbidden, "invalid_edit_token"},
+		{"view token", "blog", viewToken("blog", "c1", "view", inWindow, "blog-secret"), http.StatusForbidden, "invalid_edit_token"},
+		{"confirm token", "blog", viewToken("blog", "c1", "confirm", inWindow, "blog-secret"), http.StatusForbidden, "invalid_edit_token"},
+		{"approve token", "blog", viewToken("blog", "c1", "approve", inWindow, "blog-secret"), http.StatusForbidden, "invalid_edit_token"},
+		{"expired", "blog", viewToken("blog", "c1", "edit", time.Now().Add(-time.Second), "blog-secret"), http.StatusForbidden, "edit_window_expired"},
+		{"wrong secret", "blog", viewToken("blog", "c1", "edit", inWindow, "shop-secret"), http.StatusForbidden, "invalid_edit_token"},
+		{"used on other site", "shop", editToken("c1"), http.StatusForbidden, "invalid_edit_token"},
+		{"self-service disabled", "plain", viewToken("plain", "c1", "edit", inWindow, "blog-secret"), http.StatusForbidden, "self_service_disabled"},
+	}
+	for _, tc := range refused {
+		for _, action := range []string{"edit", "withdraw"} {
+			if code, out := post(action, tc.siteKey, tc.token, "hacked"); code != tc.code || out.Error != tc.err {
+				t.Errorf("%s %s: status=%d error=%q, want %d %q", action, tc.name, code, out.Error, tc.code, tc.err)
+			}
+		}
+	}
+	if c, found := comment("c1"); !found || c.Body != "teh body" {
+		t.Fatalf("refused tokens changed c1: %+v", c)
+	}
+
+	// Edits within the window are recorded as revisions; the token can be reused
+	// while the comment is pending.
+	if code, out := post("edit", "blog", editToken("c1"), "the body"); code != http.StatusOK || !out.Changed || out.ID != "c1" {
+		t.Fatalf("edit: status=%d %+v", code, out)
+	}
+	if code, out := post("edit", "blog", editToken("c1"), "the body"); code != http.StatusOK || out.Changed {
+		t.Fatalf("unchanged edit: status=%d %+v", code, out)
+	}
+	if code, out := post("edit", "blog", editToken("c1"), " "); code != http.StatusBadRequest || out.Error != "missing_body" {
+		t.Fatalf("empty edit: status=%d %+v", code, out)
+	}
+	revs, err := database.ListCommentRevisions(ctx, blogID, "c1")
+	if err != nil || len(revs) != 1 || revs[0].OldValue != "teh body" || revs[0].NewValue != "the body" || revs[0].Reason != db.RevisionReasonAuthorEdit {
+		t.Fatalf("revisions = %+v %v", revs, err)
+	}
+
+	// Once moderated, the token no longer works.
+	if changed, err := database.ApproveComment(ctx, blogID, "c2", db.Decision{}); err != nil || !changed {
+		t.Fatalf("approve c2: %v %v", changed, err)
+	}
+	for _, action := range []string{"edit", "withdraw"} {
+		if code, out := post(action, "blog", editToken("c2"), "changed after approval"); code != http.StatusConflict || out.Error != "not_editable" {
+			t.Errorf("%s approved comment: status=%d %+v", action, code, out)
+		}
+	}
+	if c, found := comment("c2"); !found || c.Body != "teh body" || c.Status != db.CommentStatusApproved {
+		t.Fatalf("approved comment changed: %+v", c)
+	}
+
+	// Withdrawing deletes the comment with its revisions; replaying the token fails.
+	if code, out := post("edit", "blog", editToken("c3"), "typo fixed"); code != http.StatusOK || !out.Changed {
+		t.Fatalf("edit c3: status=%d %+v", code, out)
+	}
+	if code, out := post("withdraw", "blog", editToken("c3"), ""); code != http.StatusOK || out.ID != "c3" {
+		t.Fatalf("withdraw: status=%d %+v", code, out)
+	}
+	if _, found := comment("c3"); found {
+		t.Fatal("withdrawn comment kept")
+	}
+	if revs, err := database.ListCommentRevisions(ctx, blogID, "c3"); err != nil || len(revs) != 0 {
+		t.Fatalf("revisions of withdrawn comment = %+v %v", revs, err)
+	}
+	for _, action := range []string{"withdraw", "edit"} {
+		if code, out := post(action, "blog", editToken("c3"), "back again"); code != http.StatusConflict || out.Error != "not_editable" {
+			t.Errorf("replayed %s: status=%d %+v", action, code, out)
+		}
+	}
+	if _, found := comment("c3"); found {
+		t.Fatal("replayed token restored the withdrawn comment")
+	}
+}
@@ -7,16 +7,23 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/backup"
+	"github.com/geschke/fyndmark/pkg/captcha"
 	"github.com/geschke/fyndmark/pkg/controller"
 	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/events"
+	"github.com/geschke/fyndmark/pkg/hugo"
 	"github.com/geschke/fyndmark/pkg/pipeline"
+	"github.com/geschke/fyndmark/pkg/respcache"
+	"github.com/geschke/fyndmark/pkg/sessionstore"
+	"github.com/geschke/fyndmark/pkg/webhooks"
 
 	"github.com/gin-gonic/gin"
-	"github.com/gorilla/sessions"
 )
 
 // Start starts processing.
@@ -28,73 +35,74 @@ func Start(database *db.DB) error {
 	//}
 
 	router := gin.New()
+	// All routes are mounted below server.base_path.
+	api := router.Group(config.Cfg.Server.BasePath)
 	feedback := controller.NewFeedbackController()
 
-	worker := pipeline.NewWorker(database, pipeline.DefaultQueueSize)
+	if config.Cfg.Backup.IntervalHours > 0 {
+		if err := backup.Validate(config.Cfg.Backup); err != nil {
+			return err
+		}
+	}
+	checkHugo()
+
+	hooks := webhooks.NewDispatcher(database)
+	hooks.Start()
+	worker := pipeline.NewWorker(database, pipeline.DefaultQueueSize, hooks)
 	worker.Start()
-	comments := controller.NewCommentsController(database, worker)
+	broker := events.NewBroker(countOr(config.Cfg.Server.MaxStreams.PerSite, defaultStreamsPerSite), countOr(config.Cfg.Server.MaxStreams.PerIP, defaultStreamsPerIP))
+	cache := newResponseCache()
+	comments := controller.NewCommentsController(database, worker, broker, hooks, cache)
+	captcha.SetChallengeStore(database)
+	captchaCtl := controller.NewCaptchaController()
 
 	if config.Cfg.WebAdmin.Enabled {
 		sessionName := config.Cfg.WebAdmin.SessionName
 		if sessionName == "" {
 			sessionName = "fyndmark_session"
 		}
-		store := sessions.NewCookieStore([]byte(config.Cfg.WebAdmin.SessionKey))
-		auth := controller.NewAuthController(database, store, sessionName)
-		router.POST("/api/auth/login", auth.PostLogin)
-		router.OPTIONS("/api/auth/login", auth.OptionsLogin)
-		router.POST("/api/auth/logout", auth.PostLogout)
-		router.OPTIONS("/api/auth/logout", auth.OptionsLogout)
-		router.GET("/api/auth/me", auth.GetMe)
-		router.OPTIONS("/api/auth/me", auth.OptionsMe)
-
-		usersCtl := controller.NewUsersController(database, store, sessionName)
-		router.GET("/api/users/list", usersCtl.GetList)
-		router.OPTIONS("/api/users/list", usersCtl.Options)
-		router.POST("/api/users/add", usersCtl.PostAdd)
-		router.OPTIONS("/api/users/add", usersCtl.Options)
-		router.GET("/api/users/:id", usersCtl.GetByID)
-		router.OPTIONS("/api/users/:id", usersCtl.Options)
-		router.POST("/api/users/update/:id", usersCtl.PostUpdate)
-		router.OPTIONS("/api/users/update/:id", usersCtl.Options)
-		router.POST("/api/users/update-password/:id", usersCtl.PostUpdatePassword)
-		router.OPTIONS("/api/users/update-password/:id", usersCtl.Options)
-		router.POST("/api/users/delete/:id", usersCtl.PostDelete)
-		router.OPTIONS("/api/users/delete/:id", usersCtl.Options)
-
-		sitesCtl := controller.NewSitesController(database, store, sessionName)
-		router.GET("/api/sites", sitesCtl.GetList)
-		router.OPTIONS("/api/sites", sitesCtl.Options)
-
-		commentsAdminCtl := controller.NewCommentsAdminController(database, store, sessionName, worker)
-		router.GET("/api/comments/list", commentsAdminCtl.GetList)
-		router.OPTIONS("/api/comments/list", commentsAdminCtl.Options)
-		router.POST("/api/comments/approve", commentsAdminCtl.PostApprove)
-		router.OPTIONS("/api/comments/approve", commentsAdminCtl.Options)
-		router.POST("/api/comments/reject", commentsAdminCtl.PostReject)
-		router.OPTIONS("/api/comments/reject", commentsAdminCtl.Options)
-		router.POST("/api/comments/spam", commentsAdminCtl.PostSpam)
-		router.OPTIONS("/api/comments/spam", commentsAdminCtl.Options)
-		router.POST("/api/comments/delete", commentsAdminCtl.PostDelete)
-		router.OPTIONS("/api/comments/delete", commentsAdminCtl.Options)
+		store, err := sessionstore.New(config.Cfg.WebAdmin, database)
+		if err != nil {
+			return err
+		}
+		registerAdminRoutes(api,
+			controller.NewAuthController(database, store, sessionName),
+			func(scope string) gin.HandlerFunc {
+				return controller.RequireAuth(database, store, sessionName, scope)
+			},
+			controller.NewUsersController(database, store, sessionName),
+			controller.NewSitesController(database, store, sessionName, worker),
+			controller.NewBlocklistController(database, store, sessionName),
+			controller.NewCommentsAdminController(database, store, sessionName, worker, broker, hooks, cache),
+			controller.NewTokensController(database, store, sessionName),
+			controller.NewOIDCController(database, store, sessionName),
+		)
 	}
 
 	// public routes
-	router.GET("/", getMain)
-	router.POST("/api/feedbackmail/:formid", feedback.PostMail)
-	router.GET("/api/comments/:sitekey/decision", comments.GetDecision)
-
-	router.POST("/api/comments/:sitekey/", comments.PostComment)
-	router.OPTIONS("/api/comments/:sitekey/", comments.OptionsComment)
-
-	// Basic health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok"})
-	})
-
-	srv := &http.Server{
-		Addr:    config.Cfg.Server.Listen,
-		Handler: router,
+	api.GET("/", getMain)
+	registerPublicRoutes(api, comments, feedback, captchaCtl)
+
+	// Liveness and readiness probes; /health is kept for existing setups.
+	probes := newProbes(database, worker, config.Cfg.Server.Readiness.SMTP)
+	api.GET("/health", probes.getHealthz)
+	api.GET("/healthz", probes.getHealthz)
+	api.GET("/readyz", probes.getReadyz)
+
+	srv := newHTTPServer(config.Cfg.Server, router)
+	stopPprof := func(context.Context) {}
+	if p := config.Cfg.Server.Pprof; p.Enabled && strings.TrimSpace(p.Listen) != "" {
+		stopPprof = startPprofServer(strings.TrimSpace(p.Listen))
+	}
+	// Close open event streams on shutdown, otherwise Shutdown waits for them until the timeout.
+	srv.RegisterOnShutdown(broker.Close)
+
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go runCleanup(cleanupCtx, database)
+	go runMailOutbox(cleanupCtx, database)
+	if config.Cfg.Backup.IntervalHours > 0 {
+		go runBackups(cleanupCtx, database, config.Cfg.Backup)
 	}
 
 	errCh := make(chan error, 1)
@@ -114,19 +122,128 @@ func Start(database *db.DB) error {
 		}
 	}
 
+	// Stop accepting requests first, then let the running pipeline run finish.
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("server shutdown failed: %v", err)
 	}
-	if err := worker.Stop(shutdownCtx); err != nil {
+	stopPprof(shutdownCtx)
+
+	drain := seconds(config.Cfg.Server.DrainTimeoutSeconds, defaultDrainTimeout)
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), drain)
+	defer cancelDrain()
+	log.Printf("draining pipeline worker (timeout %s)", drain)
+	if err := worker.Stop(drainCtx); err != nil {
 		log.Printf("pipeline worker shutdown failed: %v", err)
 	}
 
+	// Webhooks of the last run are still delivered.
+	hooksCtx, cancelHooks := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelHooks()
+	if err := hooks.Stop(hooksCtx); err != nil {
+		log.Printf("webhook dispatcher shutdown failed: %v", err)
+	}
+
 	return serveErr
 }
 
+// cleanupInterval is the time between two runs of the periodic cleanup.
+const cleanupInterval = 15 * time.Minute
+
+// runCleanup periodically removes expired data, deleted comments past their trash
+// period and old pipeline runs and sends due site summaries until ctx is cancelled.
+func runCleanup(ctx context.Context, database *db.DB) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		controller.CleanupUnconfirmed(ctx, database)
+		controller.PurgeTrash(ctx, database)
+		controller.SendWeeklySummaries(ctx, database)
+		pipeline.PruneRuns(ctx, database)
+		if _, err := database.DeleteExpiredSessions(ctx, time.Now().Unix()); err != nil {
+			log.Printf("Delete expired sessions failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// mailOutboxInterval is the time between two passes over the mail outbox.
+const mailOutboxInterval = time.Minute
+
+// runMailOutbox periodically sends queued notification mails until ctx is cancelled.
+func runMailOutbox(ctx context.Context, database *db.DB) {
+	ticker := time.NewTicker(mailOutboxInterval)
+	defer ticker.Stop()
+
+	for {
+		controller.ProcessMailOutbox(ctx, database)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runBackups makes a backup on start and then every cfg.IntervalHours until ctx is
+// cancelled. Failures are logged; the next backup is tried after the interval.
+func runBackups(ctx context.Context, database *db.DB, cfg config.BackupConfig) {
+	ticker := time.NewTicker(time.Duration(cfg.IntervalHours) * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if locations, err := backup.Run(ctx, database, cfg); err != nil {
+			log.Printf("Database backup failed: %v", err)
+		} else {
+			log.Printf("Database backup written to %s", strings.Join(locations, ", "))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHugo logs the Hugo version of every site that runs Hugo. Problems are only
+// logged; pipeline runs check again before the checkout.
+func checkHugo() {
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		if siteCfg.Hugo.Disabled {
+			continue
+		}
+		v, err := hugo.Preflight(context.Background(), siteKey)
+		if err != nil {
+			log.Printf("WARN: Hugo check failed for site %s: %v", siteKey, err)
+			continue
+		}
+		log.Printf("Site %s uses Hugo %s", siteKey, v)
+	}
+}
+
+// newResponseCache creates the response cache of the public read endpoints, or nil if it is disabled.
+func newResponseCache() *respcache.Cache {
+	cc := config.Cfg.Cache
+	if !cc.Enabled {
+		return nil
+	}
+
+	ttl := time.Duration(cc.TTLSeconds) * time.Second
+	if strings.EqualFold(strings.TrimSpace(cc.Backend), "redis") {
+		log.Printf("Response cache enabled (backend=redis addr=%s)", cc.Redis.Addr)
+		return respcache.New(respcache.NewRedisStore(cc.Redis.Addr, cc.Redis.Password, cc.Redis.DB), ttl)
+	}
+	log.Printf("Response cache enabled (backend=memory)")
+	return respcache.New(respcache.NewMemoryStore(cc.MaxEntries), ttl)
+}
+
 // getMain returns data for the requested input.
 func getMain(c *gin.Context) {
 	c.Header("Access-Control-Allow-Methods", "PUT, POST, GET, DELETE, OPTIONS")
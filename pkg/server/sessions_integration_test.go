@@ -0,0 +1,255 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/sessionstore"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// TestSessionRevocation lists and revokes sessions kept in SQLite.
+func TestSessionRevocation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "sessions-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	var graceID int64
+	for _, email := range []string{"ada@example.com", "grace@example.com"} {
+		id, err := users.Create(context.Background(), database, users.CreateParams{Email: email, Password: "Secret123!"})
+		if err != nil {
+			t.Fatalf("seed user: %v", err)
+		}
+		graceID = id
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	newServer := func(store sessions.Store) *httptest.Server {
+		authCtl := controller.NewAuthController(database, store, sessionName)
+		usersCtl := controller.NewUsersController(database, store, sessionName)
+		sessionOnly := controller.RequireAuth(database, store, sessionName, "")
+		r := gin.New()
+		r.POST("/api/auth/login", authCtl.PostLogin)
+		r.GET("/api/auth/me", authCtl.GetMe)
+		r.GET("/api/auth/sessions", sessionOnly, authCtl.GetSessions)
+		r.POST("/api/auth/sessions/revoke", sessionOnly, authCtl.PostRevokeSessions)
+		r.POST("/api/users/update-password/:id", sessionOnly, usersCtl.PostUpdatePassword)
+		srv := httptest.NewServer(r)
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	srv := newServer(sessionstore.NewStore(database, 3600))
+
+	csrfTokens := map[*http.Client]string{}
+	do := func(client *http.Client, method, path, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(controller.CSRFHeader, csrfTokens[client])
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+	login := func(email string) *http.Client {
+		t.Helper()
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		code, out := do(client, http.MethodPost, "/api/auth/login", `{"email":"`+email+`","password":"Secret123!"}`)
+		if code != http.StatusOK {
+			t.Fatalf("login %s: status=%d", email, code)
+		}
+		csrfTokens[client], _ = out["csrf_token"].(string)
+		return client
+	}
+	loggedIn := func(client *http.Client) bool {
+		code, _ := do(client, http.MethodGet, "/api/auth/me", "")
+		return code == http.StatusOK
+	}
+
+	ada1, ada2, grace := login("ada@example.com"), login("ada@example.com"), login("grace@example.com")
+
+	code, out := do(ada1, http.MethodGet, "/api/auth/sessions", "")
+	items, _ := out["items"].([]any)
+	if code != http.StatusOK || len(items) != 2 {
+		t.Fatalf("list: status=%d body=%v", code, out)
+	}
+	otherID := ""
+	for _, it := range items {
+		item := it.(map[string]any)
+		if item["Current"] != true {
+			otherID, _ = item["ID"].(string)
+		}
+	}
+	if otherID == "" {
+		t.Fatalf("list: no other session in %v", items)
+	}
+
+	if code, _ := do(ada1, http.MethodPost, "/api/auth/sessions/revoke", `{"ID":"`+otherID+`"}`); code != http.StatusOK {
+		t.Fatalf("revoke: status=%d", code)
+	}
+	if loggedIn(ada2) || !loggedIn(ada1) {
+		t.Fatal("revoke: wrong session ended")
+	}
+	if code, _ := do(ada1, http.MethodPost, "/api/auth/sessions/revoke", `{"ID":"`+otherID+`"}`); code != http.StatusNotFound {
+		t.Fatalf("revoke again: status=%d, want 404", code)
+	}
+
+	// Sessions of another user.
+	graceQuery := "?user_id=" + strconv.FormatInt(graceID, 10)
+	if code, out := do(ada1, http.MethodGet, "/api/auth/sessions"+graceQuery, ""); code != http.StatusOK || len(out["items"].([]any)) != 1 {
+		t.Fatalf("list other user: status=%d body=%v", code, out)
+	}
+	if code, out := do(ada1, http.MethodPost, "/api/auth/sessions/revoke", `{"UserID":`+strconv.FormatInt(graceID, 10)+`,"All":true}`); code != http.StatusOK || out["revoked"] != float64(1) {
+		t.Fatalf("revoke other user: status=%d body=%v", code, out)
+	}
+	if loggedIn(grace) {
+		t.Fatal("session of other user still valid")
+	}
+	if code, _ := do(ada1, http.MethodGet, "/api/auth/sessions?user_id=999", ""); code != http.StatusNotFound {
+		t.Fatalf("unknown user: status=%d, want 404", code)
+	}
+
+	// Changing the own password ends the other sessions only.
+	ada3 := login("ada@example.com")
+	if code, _ := do(ada1, http.MethodPost, "/api/users/update-password/1", `{"Password":"Secret456!","PasswordDuplicate":"Secret456!"}`); code != http.StatusOK {
+		t.Fatalf("update password: status=%d", code)
+	}
+	if loggedIn(ada3) || !loggedIn(ada1) {
+		t.Fatal("password change: wrong sessions ended")
+	}
+
+	// The cookie store cannot list sessions.
+	srv = newServer(sessions.NewCookieStore([]byte(strings.Repeat("k", 32))))
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	if code, _ := do(client, http.MethodPost, "/api/auth/login", `{"email":"grace@example.com","password":"Secret123!"}`); code != http.StatusOK {
+		t.Fatalf("cookie login: status=%d", code)
+	}
+	if code, _ := do(client, http.MethodGet, "/api/auth/sessions", ""); code != http.StatusNotImplemented {
+		t.Fatalf("cookie store: status=%d, want 501", code)
+	}
+}
+
+// TestLoginIssuesNewSessionID logs in with a session ID known before the login
+// (session fixation): the login must issue a new ID and drop the old one. The session
+// records the client IP forwarded by a trusted proxy.
+func TestLoginIssuesNewSessionID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+	config.Cfg.Server.TrustedProxies = []string{"127.0.0.1"}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "fixation-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	adaID, err := users.Create(ctx, database, users.CreateParams{Email: "ada@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessionstore.NewStore(database, 3600)
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/auth/me", authCtl.GetMe)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	// A session created before the login, e.g. planted by an attacker.
+	pre := httptest.NewRequest(http.MethodGet, "/", nil)
+	sess, _ := store.Get(pre, sessionName)
+	sess.Values["planted"] = true
+	if err := sess.Save(pre, httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+	planted := sess.ID
+
+	jar, _ := cookiejar.New(nil)
+	u, _ := url.Parse(srv.URL)
+	jar.SetCookies(u, []*http.Cookie{{Name: sessionName, Value: planted, Path: "/"}})
+	client := &http.Client{Jar: jar}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/auth/login", strings.NewReader(`{"email":"ada@example.com","password":"Secret123!"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("login: status=%d", res.StatusCode)
+	}
+
+	current := ""
+	for _, c := range jar.Cookies(u) {
+		if c.Name == sessionName {
+			current = c.Value
+		}
+	}
+	if current == "" || current == planted {
+		t.Fatalf("login kept the session ID %q", planted)
+	}
+	if _, found, err := database.GetSession(ctx, planted); err != nil || found {
+		t.Fatalf("planted session still stored: %v, %v", found, err)
+	}
+
+	list, err := store.ListUser(ctx, adaID)
+	if err != nil || len(list) != 1 || list[0].ID != current || list[0].IP != "203.0.113.7" {
+		t.Fatalf("sessions of user: %+v, %v", list, err)
+	}
+	logins, err := database.ListLoginHistory(ctx, adaID)
+	if err != nil || len(logins) != 1 || logins[0].IP != "203.0.113.7" {
+		t.Fatalf("login history: %+v, %v", logins, err)
+	}
+
+	// The planted ID does not authenticate.
+	other, _ := cookiejar.New(nil)
+	other.SetCookies(u, []*http.Cookie{{Name: sessionName, Value: planted, Path: "/"}})
+	res, err = (&http.Client{Jar: other}).Get(srv.URL + "/api/auth/me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		t.Fatal("planted session ID is logged in")
+	}
+}
@@ -0,0 +1,276 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// TestAPITokenAuth creates tokens with a session and uses them as Bearer tokens.
+func TestAPITokenAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+	config.Cfg.WebAdmin.CookieSameSite = "lax"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "tokens-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	if _, err := users.Create(context.Background(), database, users.CreateParams{Email: "admin@example.com", Password: "Secret123!"}); err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	usersCtl := controller.NewUsersController(database, store, sessionName)
+	tokensCtl := controller.NewTokensController(database, store, sessionName)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/users/list", controller.RequireAuth(database, store, sessionName, controller.ScopeUsers), usersCtl.GetList)
+	sessionOnly := controller.RequireAuth(database, store, sessionName, "")
+	r.GET("/api/tokens/list", sessionOnly, tokensCtl.GetList)
+	r.POST("/api/tokens/add", sessionOnly, tokensCtl.PostAdd)
+	r.POST("/api/tokens/revoke/:id", sessionOnly, tokensCtl.PostRevoke)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	session := &http.Client{Jar: jar}
+	csrfToken := ""
+	do := func(client *http.Client, method, path, bearer, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		} else if client == session {
+			req.Header.Set(controller.CSRFHeader, csrfToken)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+
+	code, out := do(session, http.MethodPost, "/api/auth/login", "", `{"email":"admin@example.com","password":"Secret123!"}`)
+	if code != http.StatusOK {
+		t.Fatalf("login status=%d", code)
+	}
+	csrfToken, _ = out["csrf_token"].(string)
+
+	code, out = do(session, http.MethodPost, "/api/tokens/add", "", `{"Name":"ci","Scopes":["comments"]}`)
+	if code != http.StatusOK {
+		t.Fatalf("add token status=%d body=%v", code, out)
+	}
+	commentsToken, _ := out["token"].(string)
+	if !strings.HasPrefix(commentsToken, "fym_") {
+		t.Fatalf("token = %q", commentsToken)
+	}
+	code, out = do(session, http.MethodPost, "/api/tokens/add", "", `{"Name":"build","Scopes":["users"],"ExpiresInDays":30}`)
+	if code != http.StatusOK {
+		t.Fatalf("add token status=%d body=%v", code, out)
+	}
+	usersToken, _ := out["token"].(string)
+	usersTokenID := int64(out["id"].(float64))
+
+	if code, _ := do(session, http.MethodPost, "/api/tokens/add", "", `{"Name":"x","Scopes":["root"]}`); code != http.StatusBadRequest {
+		t.Errorf("unknown scope: status=%d", code)
+	}
+
+	anonymous := &http.Client{}
+	cases := []struct {
+		path   string
+		bearer string
+		want   int
+	}{
+		{"/api/users/list", usersToken, http.StatusOK},
+		{"/api/users/list", commentsToken, http.StatusForbidden},
+		{"/api/users/list", "fym_unknown", http.StatusUnauthorized},
+		{"/api/users/list", "", http.StatusUnauthorized},
+		{"/api/tokens/list", usersToken, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		if code, out := do(anonymous, http.MethodGet, tc.path, tc.bearer, ""); code != tc.want {
+			t.Errorf("GET %s with %q: status=%d body=%v, want %d", tc.path, tc.bearer, code, out, tc.want)
+		}
+	}
+
+	if code, _ := do(session, http.MethodPost, "/api/tokens/revoke/"+strconv.FormatInt(usersTokenID, 10), "", ""); code != http.StatusOK {
+		t.Fatalf("revoke status=%d", code)
+	}
+	if code, _ := do(anonymous, http.MethodGet, "/api/users/list", usersToken, ""); code != http.StatusUnauthorized {
+		t.Errorf("revoked token: status=%d, want 401", code)
+	}
+
+	code, out = do(session, http.MethodGet, "/api/tokens/list", "", "")
+	if code != http.StatusOK {
+		t.Fatalf("list status=%d", code)
+	}
+	items, _ := out["items"].([]any)
+	if len(items) != 2 {
+		t.Fatalf("items = %v", items)
+	}
+	for _, it := range items {
+		if _, leaked := it.(map[string]any)["TokenHash"]; leaked {
+			t.Fatal("token hash is listed")
+		}
+	}
+}
+
+// TestAPITokenPasswordReset checks that tokens are rejected while their user must
+// change the password and revoked when an admin resets it.
+func TestAPITokenPasswordReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+	config.Cfg.WebAdmin.CookieSameSite = "lax"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "tokens-reset-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	adminID, err := users.Create(ctx, database, users.CreateParams{Email: "admin@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed admin: %v", err)
+	}
+	bobID, err := users.Create(ctx, database, users.CreateParams{Email: "bob@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed bob: %v", err)
+	}
+	// createToken stores a token like POST /api/tokens/add.
+	createToken := func(userID int64, token string) {
+		t.Helper()
+		sum := sha256.Sum256([]byte(token))
+		if _, err := database.CreateAPIToken(ctx, db.APIToken{UserID: userID, Name: "ci", Prefix: token[:8], TokenHash: hex.EncodeToString(sum[:])}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	adminToken, bobToken := "fym_admin_token", "fym_bob_token"
+	createToken(adminID, adminToken)
+	createToken(bobID, bobToken)
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	usersCtl := controller.NewUsersController(database, store, sessionName)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	requireUsers := controller.RequireAuth(database, store, sessionName, controller.ScopeUsers)
+	r.GET("/api/users/list", requireUsers, usersCtl.GetList)
+	r.POST("/api/users/update-password/:id", requireUsers, usersCtl.PostUpdatePassword)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	session := &http.Client{Jar: jar}
+	csrfToken := ""
+	do := func(client *http.Client, method, path, bearer, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		} else if client == session {
+			req.Header.Set(controller.CSRFHeader, csrfToken)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+	anonymous := &http.Client{}
+	expect := func(name, token string, want int, wantMsg string) {
+		t.Helper()
+		code, out := do(anonymous, http.MethodGet, "/api/users/list", token, "")
+		if msg, _ := out["message"].(string); code != want || msg != wantMsg {
+			t.Errorf("%s: status=%d message=%q, want %d %q", name, code, msg, want, wantMsg)
+		}
+	}
+
+	expect("bob's token", bobToken, http.StatusOK, "")
+
+	// While a password change is due, the token is rejected like a session.
+	if _, err := database.SetMustChangePassword(ctx, bobID, true); err != nil {
+		t.Fatal(err)
+	}
+	expect("bob's token, password change due", bobToken, http.StatusForbidden, "PASSWORD_CHANGE_REQUIRED")
+	if _, err := database.SetMustChangePassword(ctx, bobID, false); err != nil {
+		t.Fatal(err)
+	}
+	expect("bob's token, password changed", bobToken, http.StatusOK, "")
+
+	// Password expiry applies to sessions only.
+	config.Cfg.WebAdmin.MaxPasswordAgeDays = 30
+	if _, err := database.SQL.ExecContext(ctx, `UPDATE users SET password_changed_at = ? WHERE id = ?;`, time.Now().AddDate(0, 0, -31).Unix(), bobID); err != nil {
+		t.Fatal(err)
+	}
+	expect("bob's token, password expired", bobToken, http.StatusOK, "")
+	config.Cfg.WebAdmin.MaxPasswordAgeDays = 0
+
+	code, out := do(session, http.MethodPost, "/api/auth/login", "", `{"email":"admin@example.com","password":"Secret123!"}`)
+	if code != http.StatusOK {
+		t.Fatalf("login status=%d", code)
+	}
+	csrfToken, _ = out["csrf_token"].(string)
+
+	// An admin resets bob's password: all of bob's tokens are revoked, even without a forced
+	// password change.
+	body := `{"Password":"NewSecret456!","PasswordDuplicate":"NewSecret456!","MustChangePassword":false}`
+	if code, out := do(session, http.MethodPost, "/api/users/update-password/"+strconv.FormatInt(bobID, 10), "", body); code != http.StatusOK {
+		t.Fatalf("reset bob's password: status=%d body=%v", code, out)
+	}
+	expect("bob's token after reset", bobToken, http.StatusUnauthorized, "INVALID_TOKEN")
+	if tokens, err := database.ListAPITokensByUserID(ctx, bobID); err != nil || len(tokens) != 1 || tokens[0].RevokedAt == 0 {
+		t.Fatalf("bob's tokens = %+v %v", tokens, err)
+	}
+
+	// Users changing their own password keep their tokens.
+	if code, out := do(session, http.MethodPost, "/api/users/update-password/"+strconv.FormatInt(adminID, 10), "", body); code != http.StatusOK {
+		t.Fatalf("change own password: status=%d body=%v", code, out)
+	}
+	expect("admin's token after own change", adminToken, http.StatusOK, "")
+}
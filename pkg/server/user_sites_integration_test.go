@@ -0,0 +1,125 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/users"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// TestUserSiteAssignment assigns and revokes sites of another user.
+func TestUserSiteAssignment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	config.Cfg.WebAdmin.SessionName = "fyndmark_session"
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "user-sites-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	shopID, _, _ := database.GetSiteIDByKey(ctx, "shop")
+	adaID, err := users.Create(ctx, database, users.CreateParams{Email: "ada@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	bobID, err := users.Create(ctx, database, users.CreateParams{Email: "bob@example.com", Password: "Secret123!"})
+	if err != nil {
+		t.Fatalf("seed user: %v", err)
+	}
+	if _, err := database.GrantUserSite(ctx, adaID, blogID); err != nil {
+		t.Fatal(err)
+	}
+
+	sessionName := config.Cfg.WebAdmin.SessionName
+	store := sessions.NewCookieStore([]byte(strings.Repeat("k", 32)))
+	authCtl := controller.NewAuthController(database, store, sessionName)
+	usersCtl := controller.NewUsersController(database, store, sessionName)
+	requireUsers := controller.RequireAuth(database, store, sessionName, controller.ScopeUsers)
+
+	r := gin.New()
+	r.POST("/api/auth/login", authCtl.PostLogin)
+	r.GET("/api/users/:id/sites", requireUsers, usersCtl.GetSites)
+	r.POST("/api/users/:id/sites", requireUsers, usersCtl.PostSites)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	csrfToken := ""
+	do := func(method, path, body string) (int, map[string]any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(controller.CSRFHeader, csrfToken)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		var out map[string]any
+		_ = json.NewDecoder(res.Body).Decode(&out)
+		return res.StatusCode, out
+	}
+	_, out := do(http.MethodPost, "/api/auth/login", `{"email":"ada@example.com","password":"Secret123!"}`)
+	csrfToken, _ = out["csrf_token"].(string)
+
+	bobSites := "/api/users/" + strconv.FormatInt(bobID, 10) + "/sites"
+	site := func(id int64, action string) string {
+		return `{"SiteID":` + strconv.FormatInt(id, 10) + `,"Action":"` + action + `"}`
+	}
+	cases := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"assign", bobSites, site(blogID, "assign"), http.StatusOK},
+		{"site without access", bobSites, site(shopID, "assign"), http.StatusForbidden},
+		{"unknown site", bobSites, site(999, "assign"), http.StatusForbidden},
+		{"own sites", "/api/users/" + strconv.FormatInt(adaID, 10) + "/sites", site(blogID, "revoke"), http.StatusConflict},
+		{"unknown user", "/api/users/999/sites", site(blogID, "assign"), http.StatusNotFound},
+		{"invalid action", bobSites, site(blogID, "delete"), http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		if code, out := do(http.MethodPost, tc.path, tc.body); code != tc.want {
+			t.Errorf("%s: status=%d body=%v, want %d", tc.name, code, out, tc.want)
+		}
+	}
+
+	code, out := do(http.MethodGet, bobSites, "")
+	items, _ := out["items"].([]any)
+	if code != http.StatusOK || len(items) != 1 || items[0].(map[string]any)["SiteKey"] != "blog" || items[0].(map[string]any)["Manageable"] != true {
+		t.Fatalf("list: status=%d body=%v", code, out)
+	}
+
+	if code, out := do(http.MethodPost, bobSites, site(blogID, "revoke")); code != http.StatusOK || out["changed"] != true {
+		t.Fatalf("revoke: status=%d body=%v", code, out)
+	}
+	if has, _ := database.UserHasSiteAccess(ctx, bobID, blogID); has {
+		t.Fatal("site still assigned")
+	}
+}
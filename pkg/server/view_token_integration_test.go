@@ -0,0 +1,181 @@
+package server_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/controller"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/respcache"
+	"github.com/gin-gonic/gin"
+)
+
+// viewToken signs a view token like the links in the opt-in mail.
+func viewToken(siteKey, commentID, action string, exp time.Time, secret string) string {
+	payload := fmt.Sprintf("%s|%s|%s|%d", siteKey, commentID, action, exp.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TestViewTokenOwnComments lists a post with the commenter's view token and checks
+// which comments are added as own_items and that such responses are not cacheable.
+func TestViewTokenOwnComments(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	viewCfg := config.ViewTokenConfig{Enabled: true, BaseURL: "https://blog.example"}
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog":  {TokenSecret: "blog-secret", ViewToken: viewCfg},
+		"shop":  {TokenSecret: "shop-secret", ViewToken: viewCfg},
+		"plain": {TokenSecret: "plain-secret"},
+	}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "view-it.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := database.SyncSites(ctx, map[string]string{"blog": "Blog", "shop": "Shop", "plain": "Plain"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	blogID, _, _ := database.GetSiteIDByKey(ctx, "blog")
+	now := time.Now().Unix()
+	for _, c := range []db.Comment{
+		{ID: "c1", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusPending, Author: "Bob", Email: "bob@example.org", Body: "mine, pending", CreatedAt: now - 40},
+		{ID: "c2", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusApproved, Author: "Bob", Email: "bob@example.org", Body: "mine, approved", CreatedAt: now - 30},
+		{ID: "c3", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusApproved, Author: "Eve", Email: "eve@example.org", Body: "hers, approved", CreatedAt: now - 20},
+		{ID: "c4", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusPending, Author: "Eve", Email: "eve@example.org", Body: "hers, pending", CreatedAt: now - 10},
+		{ID: "c5", SiteID: blogID, PostPath: "/b/", Status: db.CommentStatusPending, Author: "Bob", Email: "bob@example.org", Body: "mine, other post", CreatedAt: now - 5},
+	} {
+		if err := database.InsertComment(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache := respcache.New(respcache.NewMemoryStore(100), time.Minute)
+	commentsCtl := controller.NewCommentsController(database, nil, nil, nil, cache)
+	r := gin.New()
+	r.GET("/api/comments/:sitekey/list", commentsCtl.GetPublicList)
+
+	type item struct {
+		ID      string `json:"id"`
+		Own     bool   `json:"own"`
+		Pending bool   `json:"pending"`
+	}
+	type listResponse struct {
+		Error    string  `json:"error"`
+		Items    []item  `json:"items"`
+		OwnItems *[]item `json:"own_items"`
+	}
+	list := func(siteKey, postPath, token string, extra ...string) (int, http.Header, listResponse) {
+		t.Helper()
+		q := url.Values{"post_path": {postPath}}
+		if token != "" {
+			q.Set("view_token", token)
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			q.Set(extra[i], extra[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/comments/"+siteKey+"/list?"+q.Encode(), nil))
+		var out listResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode list: %v: %s", err, w.Body.String())
+		}
+		return w.Code, w.Header(), out
+	}
+	ids := func(items []item) string {
+		s := ""
+		for _, it := range items {
+			s += fmt.Sprintf("%s(own=%t,pending=%t) ", it.ID, it.Own, it.Pending)
+		}
+		return s
+	}
+
+	valid := viewToken("blog", "c1", "view", time.Now().Add(time.Hour), "blog-secret")
+
+	// Without token: only approved comments, cacheable; this fills the cache.
+	code, h, out := list("blog", "/a/", "")
+	if code != http.StatusOK || out.OwnItems != nil || h.Get("Cache-Control") == "private, no-store" {
+		t.Fatalf("list without token: status=%d cache-control=%q own=%v", code, h.Get("Cache-Control"), out.OwnItems)
+	}
+	if got := ids(out.Items); got != "c2(own=false,pending=false) c3(own=false,pending=false) " {
+		t.Fatalf("public items: %s", got)
+	}
+
+	// A comment approved behind the cache's back shows which responses come from the cache.
+	if err := database.InsertComment(ctx, db.Comment{ID: "c6", SiteID: blogID, PostPath: "/a/", Status: db.CommentStatusApproved, Author: "Eve", Email: "eve@example.org", Body: "late", CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Valid token, served from the cache: the own items are merged in and the
+	// response is private.
+	code, h, out = list("blog", "/a/", valid)
+	if code != http.StatusOK || h.Get("Cache-Control") != "private, no-store" {
+		t.Fatalf("cached list with token: status=%d cache-control=%q", code, h.Get("Cache-Control"))
+	}
+	if len(out.Items) != 2 {
+		t.Fatalf("list with token was not served from the cache: %s", ids(out.Items))
+	}
+	if out.OwnItems == nil || ids(*out.OwnItems) != "c1(own=true,pending=true) c2(own=true,pending=false) " {
+		t.Fatalf("own items: %v", out.OwnItems)
+	}
+
+	// Valid token, computed response: same merge, same header.
+	code, h, out = list("blog", "/a/", valid, "limit", "50")
+	if code != http.StatusOK || h.Get("Cache-Control") != "private, no-store" || len(out.Items) != 3 {
+		t.Fatalf("uncached list with token: status=%d cache-control=%q items=%s", code, h.Get("Cache-Control"), ids(out.Items))
+	}
+	if out.OwnItems == nil || ids(*out.OwnItems) != "c1(own=true,pending=true) c2(own=true,pending=false) " {
+		t.Fatalf("own items: %v", out.OwnItems)
+	}
+
+	// The own items never end up in the cached page.
+	if _, _, out = list("blog", "/a/", "", "limit", "50"); out.OwnItems != nil {
+		t.Fatalf("own items cached: %v", *out.OwnItems)
+	}
+
+	// A token for another post returns no own items.
+	code, _, out = list("blog", "/a/", viewToken("blog", "c5", "view", time.Now().Add(time.Hour), "blog-secret"))
+	if code != http.StatusOK || out.OwnItems == nil || len(*out.OwnItems) != 0 {
+		t.Fatalf("token of another post: status=%d own=%v", code, out.OwnItems)
+	}
+
+	cases := []struct {
+		name    string
+		siteKey string
+		token   string
+		want    string
+	}{
+		{"expired", "blog", viewToken("blog", "c1", "view", time.Now().Add(-time.Minute), "blog-secret"), "view_token_expired"},
+		{"other site", "blog", viewToken("shop", "c1", "view", time.Now().Add(time.Hour), "shop-secret"), "invalid_view_token"},
+		{"other site's payload", "blog", viewToken("shop", "c1", "view", time.Now().Add(time.Hour), "blog-secret"), "invalid_view_token"},
+		{"used on other site", "shop", valid, "invalid_view_token"},
+		{"wrong action", "blog", viewToken("blog", "c1", "approve", time.Now().Add(time.Hour), "blog-secret"), "invalid_view_token"},
+		{"garbage", "blog", "not-a-token", "invalid_view_token"},
+		{"disabled", "plain", valid, "view_token_disabled"},
+	}
+	for _, tc := range cases {
+		code, _, out := list(tc.siteKey, "/a/", tc.token)
+		if code != http.StatusForbidden || out.Error != tc.want {
+			t.Errorf("%s: status=%d error=%q, want 403 %q", tc.name, code, out.Error, tc.want)
+		}
+	}
+}
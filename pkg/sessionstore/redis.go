@@ -0,0 +1,170 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/redis"
+)
+
+// RedisBackend keeps sessions in Redis, so several instances share them. Each session
+// is a key that expires with the session; a set per user lists the session IDs of the
+// user. IDs of expired sessions are removed from the set when it is listed.
+type RedisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisBackend returns a backend for the Redis server at addr (host:port).
+func NewRedisBackend(addr, password string, database int) *RedisBackend {
+	return &RedisBackend{client: redis.NewClient(addr, password, database), prefix: "fyndmark:session:"}
+}
+
+func (b *RedisBackend) sessionKey(id string) string {
+	return b.prefix + id
+}
+
+func (b *RedisBackend) userKey(userID int64) string {
+	return b.prefix + "user:" + strconv.FormatInt(userID, 10)
+}
+
+// GetSession implements Backend.
+func (b *RedisBackend) GetSession(ctx context.Context, id string) (db.Session, bool, error) {
+	v, err := b.client.Do(ctx, "GET", b.sessionKey(id))
+	if errors.Is(err, redis.ErrNil) {
+		return db.Session{}, false, nil
+	}
+	if err != nil {
+		return db.Session{}, false, err
+	}
+	raw, ok := v.([]byte)
+	if !ok {
+		return db.Session{}, false, fmt.Errorf("redis GET: unexpected reply %T", v)
+	}
+	var s db.Session
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return db.Session{}, false, fmt.Errorf("decode session: %w", err)
+	}
+	return s, true, nil
+}
+
+// PutSession implements Backend.
+func (b *RedisBackend) PutSession(ctx context.Context, s db.Session) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ms := time.Until(time.Unix(s.ExpiresAt, 0)).Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	if _, err := b.client.Do(ctx, "SET", b.sessionKey(s.ID), string(raw), "PX", strconv.FormatInt(ms, 10)); err != nil {
+		return err
+	}
+	if s.UserID > 0 {
+		if _, err := b.client.Do(ctx, "SADD", b.userKey(s.UserID), s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteSession implements Backend.
+func (b *RedisBackend) DeleteSession(ctx context.Context, id string) error {
+	s, found, err := b.GetSession(ctx, id)
+	if err != nil || !found {
+		return err
+	}
+	if _, err := b.client.Do(ctx, "DEL", b.sessionKey(id)); err != nil {
+		return err
+	}
+	if s.UserID > 0 {
+		_, err = b.client.Do(ctx, "SREM", b.userKey(s.UserID), id)
+	}
+	return err
+}
+
+// DeleteUserSessions implements Backend.
+func (b *RedisBackend) DeleteUserSessions(ctx context.Context, userID int64, keepID string) (int64, error) {
+	ids, err := b.userSessionIDs(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, id := range ids {
+		if id == keepID {
+			continue
+		}
+		v, err := b.client.Do(ctx, "DEL", b.sessionKey(id))
+		if err != nil {
+			return n, err
+		}
+		if deleted, _ := v.(int64); deleted > 0 {
+			n++
+		}
+		if _, err := b.client.Do(ctx, "SREM", b.userKey(userID), id); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ListUserSessions implements Backend. IDs of expired sessions are removed from the
+// set of the user.
+func (b *RedisBackend) ListUserSessions(ctx context.Context, userID int64) ([]db.Session, error) {
+	ids, err := b.userSessionIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := []db.Session{}
+	for _, id := range ids {
+		s, found, err := b.GetSession(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			if _, err := b.client.Do(ctx, "SREM", b.userKey(userID), id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].LastSeenAt != out[j].LastSeenAt {
+			return out[i].LastSeenAt > out[j].LastSeenAt
+		}
+		return out[i].CreatedAt > out[j].CreatedAt
+	})
+	return out, nil
+}
+
+// userSessionIDs returns the members of the session set of a user.
+func (b *RedisBackend) userSessionIDs(ctx context.Context, userID int64) ([]string, error) {
+	v, err := b.client.Do(ctx, "SMEMBERS", b.userKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("redis SMEMBERS: unexpected reply %T", v)
+	}
+	ids := make([]string, 0, len(items))
+	for _, it := range items {
+		if b, ok := it.([]byte); ok {
+			ids = append(ids, string(b))
+		}
+	}
+	return ids, nil
+}
+
+// Close closes the connection.
+func (b *RedisBackend) Close() error {
+	return b.client.Close()
+}
@@ -0,0 +1,246 @@
+// Package sessionstore keeps admin sessions on the server. The cookie only carries a
+// random session ID, so sessions can be revoked at once, e.g. after a password change.
+package sessionstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/gorilla/sessions"
+)
+
+// Session store types of web_admin.session_store.
+const (
+	TypeCookie = "cookie"
+	TypeSQLite = "sqlite"
+	TypeRedis  = "redis"
+)
+
+// backendTimeout bounds each backend call; the gorilla Store interface has no context.
+const backendTimeout = 5 * time.Second
+
+// touchInterval is how often the last use of a session is recorded.
+const touchInterval = time.Minute
+
+// Backend stores sessions.
+type Backend interface {
+	// GetSession returns the session with the given ID unless it has expired.
+	GetSession(ctx context.Context, id string) (db.Session, bool, error)
+	// PutSession creates or replaces a session.
+	PutSession(ctx context.Context, s db.Session) error
+	DeleteSession(ctx context.Context, id string) error
+	// ListUserSessions returns the active sessions of a user, most recently used first.
+	ListUserSessions(ctx context.Context, userID int64) ([]db.Session, error)
+	// DeleteUserSessions removes all sessions of a user except keepID.
+	DeleteUserSessions(ctx context.Context, userID int64, keepID string) (int64, error)
+}
+
+// Store is a gorilla sessions.Store that keeps the session values in a Backend.
+type Store struct {
+	backend Backend
+	// Options are the defaults of new sessions.
+	Options *sessions.Options
+}
+
+// NewStore returns a store keeping sessions in backend. Sessions whose MaxAge is 0
+// (browser sessions) are kept on the server for defaultMaxAge seconds.
+func NewStore(backend Backend, defaultMaxAge int) *Store {
+	return &Store{
+		backend: backend,
+		Options: &sessions.Options{Path: "/", MaxAge: defaultMaxAge, HttpOnly: true},
+	}
+}
+
+// New returns the session store configured in web_admin: a cookie store (default),
+// or a server-side store in SQLite or Redis.
+func New(wa config.WebAdminConfig, database *db.DB) (sessions.Store, error) {
+	maxAge := wa.CookieMaxAgeDays * 24 * 60 * 60
+	if maxAge <= 0 {
+		maxAge = 30 * 24 * 60 * 60
+	}
+	switch strings.ToLower(strings.TrimSpace(wa.SessionStore)) {
+	case "", TypeCookie:
+		return sessions.NewCookieStore([]byte(wa.SessionKey)), nil
+	case TypeSQLite:
+		return NewStore(database, maxAge), nil
+	case TypeRedis:
+		r := wa.SessionRedis
+		return NewStore(NewRedisBackend(strings.TrimSpace(r.Addr), r.Password, r.DB), maxAge), nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q", wa.SessionStore)
+	}
+}
+
+// Get implements sessions.Store. The session is cached for the request.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New implements sessions.Store. It loads the session of the cookie; an unknown,
+// expired or revoked session results in a new one. The last use of the session is
+// recorded at most once per touchInterval.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil || c.Value == "" {
+		return session, nil
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), backendTimeout)
+	defer cancel()
+
+	stored, found, err := s.backend.GetSession(ctx, c.Value)
+	if err != nil {
+		return session, err
+	}
+	if !found {
+		return session, nil
+	}
+	if err := gob.NewDecoder(bytes.NewReader(stored.Data)).Decode(&session.Values); err != nil {
+		return session, fmt.Errorf("decode session: %w", err)
+	}
+	session.ID = stored.ID
+	session.IsNew = false
+
+	if now := time.Now(); now.Sub(time.Unix(stored.LastSeenAt, 0)) >= touchInterval {
+		stored.LastSeenAt = now.Unix()
+		stored.IP = clientIP(r)
+		stored.UserAgent = r.UserAgent()
+		if err := s.backend.PutSession(ctx, stored); err != nil {
+			log.Printf("Touch session failed: %v", err)
+		}
+	}
+	return session, nil
+}
+
+// Save implements sessions.Store. A negative MaxAge deletes the session.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx, cancel := context.WithTimeout(r.Context(), backendTimeout)
+	defer cancel()
+
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.backend.DeleteSession(ctx, session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	now := time.Now()
+	stored := db.Session{ID: session.ID, CreatedAt: now.Unix()}
+	if session.ID == "" {
+		id, err := newSessionID()
+		if err != nil {
+			return err
+		}
+		session.ID, stored.ID = id, id
+	} else if old, found, err := s.backend.GetSession(ctx, session.ID); err == nil && found {
+		stored.CreatedAt = old.CreatedAt
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+	maxAge := session.Options.MaxAge
+	if maxAge == 0 {
+		maxAge = s.Options.MaxAge
+	}
+	stored.UserID, _ = session.Values["id"].(int64)
+	stored.Data = buf.Bytes()
+	stored.IP = clientIP(r)
+	stored.UserAgent = r.UserAgent()
+	stored.LastSeenAt = now.Unix()
+	stored.ExpiresAt = now.Add(time.Duration(maxAge) * time.Second).Unix()
+	if err := s.backend.PutSession(ctx, stored); err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
+
+// Regenerate deletes the stored session and clears its ID, so the next Save issues a
+// new ID. Called on login, so an ID known before the login never becomes authenticated.
+func (s *Store) Regenerate(r *http.Request, session *sessions.Session) error {
+	if session.ID != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), backendTimeout)
+		defer cancel()
+		if err := s.backend.DeleteSession(ctx, session.ID); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	session.IsNew = true
+	return nil
+}
+
+// ListUser returns the active sessions of a user.
+func (s *Store) ListUser(ctx context.Context, userID int64) ([]db.Session, error) {
+	return s.backend.ListUserSessions(ctx, userID)
+}
+
+// Revoke deletes the session with the given ID if it belongs to the user.
+func (s *Store) Revoke(ctx context.Context, userID int64, id string) (bool, error) {
+	stored, found, err := s.backend.GetSession(ctx, id)
+	if err != nil || !found || stored.UserID != userID {
+		return false, err
+	}
+	if err := s.backend.DeleteSession(ctx, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RevokeUser deletes all sessions of a user except keepID and returns their number.
+func (s *Store) RevokeUser(ctx context.Context, userID int64, keepID string) (int64, error) {
+	return s.backend.DeleteUserSessions(ctx, userID, keepID)
+}
+
+// newSessionID returns a random session ID.
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// clientIPKey is the request context key of the IP set by WithClientIP.
+type clientIPKey struct{}
+
+// WithClientIP returns r carrying the client IP resolved by the caller, e.g. from the
+// headers of a trusted proxy. Sessions record it instead of the connection address.
+func WithClientIP(r *http.Request, ip string) *http.Request {
+	if ip == "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip))
+}
+
+// clientIP returns the IP set by WithClientIP, or the address of the client connection.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,263 @@
+package sessionstore
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// login saves a session of userID and returns its cookie.
+func login(t *testing.T, s *Store, userID int64) *http.Cookie {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+	sess, err := s.Get(req, "fyndmark_session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sess.IsNew {
+		t.Fatal("session without cookie is not new")
+	}
+	sess.Values["id"] = userID
+	sess.Values["email"] = "ada@example.com"
+	rec := httptest.NewRecorder()
+	if err := sess.Save(req, rec); err != nil {
+		t.Fatal(err)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != sess.ID {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	return cookies[0]
+}
+
+// load returns the user of the session of cookie, 0 if it is not valid.
+func load(t *testing.T, s *Store, cookie *http.Cookie) int64 {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.AddCookie(cookie)
+	sess, err := s.New(req, "fyndmark_session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.IsNew {
+		return 0
+	}
+	id, _ := sess.Values["id"].(int64)
+	return id
+}
+
+func testStore(t *testing.T, s *Store) {
+	a1 := login(t, s, 1)
+	a2 := login(t, s, 1)
+	b := login(t, s, 2)
+	if load(t, s, a1) != 1 || load(t, s, a2) != 1 || load(t, s, b) != 2 {
+		t.Fatal("sessions not loaded")
+	}
+	if list, err := s.ListUser(context.Background(), 1); err != nil || len(list) != 2 {
+		t.Fatalf("ListUser = %d sessions, %v", len(list), err)
+	}
+	if ok, err := s.Revoke(context.Background(), 2, a1.Value); err != nil || ok {
+		t.Fatalf("Revoke of other user = %t, %v", ok, err)
+	}
+	forged := &http.Cookie{Name: "fyndmark_session", Value: "forged"}
+	if load(t, s, forged) != 0 {
+		t.Fatal("unknown session accepted")
+	}
+
+	// Revoking keeps the given session and those of other users.
+	if n, err := s.RevokeUser(context.Background(), 1, a2.Value); err != nil || n != 1 {
+		t.Fatalf("RevokeUser = %d, %v", n, err)
+	}
+	if load(t, s, a1) != 0 || load(t, s, a2) != 1 || load(t, s, b) != 2 {
+		t.Fatal("wrong sessions revoked")
+	}
+
+	// Logout deletes the session, so a copy of the cookie is no longer valid.
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	req.AddCookie(b)
+	sess, _ := s.Get(req, "fyndmark_session")
+	sess.Options.MaxAge = -1
+	if err := sess.Save(req, httptest.NewRecorder()); err != nil {
+		t.Fatal(err)
+	}
+	if load(t, s, b) != 0 {
+		t.Fatal("session valid after logout")
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		if _, err := database.CreateUser(ctx, db.User{Email: email, Password: "hash"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := NewStore(database, 3600)
+	testStore(t, s)
+
+	// Deleting a user deletes its sessions.
+	c := login(t, s, 2)
+	if _, err := database.DeleteUser(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if load(t, s, c) != 0 {
+		t.Fatal("session of deleted user still valid")
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	b := NewRedisBackend(fakeRedis(t), "", 0)
+	defer b.Close()
+	testStore(t, NewStore(b, 3600))
+}
+
+// TestRedisBackendPrunesExpired checks that IDs of sessions that expired in Redis are
+// dropped from the set of their user.
+func TestRedisBackendPrunesExpired(t *testing.T) {
+	b := NewRedisBackend(fakeRedis(t), "", 0)
+	defer b.Close()
+	ctx := context.Background()
+
+	expires := time.Now().Add(time.Hour).Unix()
+	for _, id := range []string{"s1", "s2"} {
+		if err := b.PutSession(ctx, db.Session{ID: id, UserID: 1, Data: []byte("{}"), ExpiresAt: expires}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Redis removed the key of s1 when it expired.
+	if _, err := b.client.Do(ctx, "DEL", b.sessionKey("s1")); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := b.ListUserSessions(ctx, 1)
+	if err != nil || len(list) != 1 || list[0].ID != "s2" {
+		t.Fatalf("ListUserSessions = %+v, %v", list, err)
+	}
+	if ids, err := b.userSessionIDs(ctx, 1); err != nil || len(ids) != 1 || ids[0] != "s2" {
+		t.Fatalf("session set = %v, %v", ids, err)
+	}
+	if n, err := b.DeleteUserSessions(ctx, 1, ""); err != nil || n != 1 {
+		t.Fatalf("DeleteUserSessions = %d, %v", n, err)
+	}
+	if _, found, err := b.GetSession(ctx, "s2"); err != nil || found {
+		t.Fatalf("GetSession after delete = %v, %v", found, err)
+	}
+}
+
+// fakeRedis serves the string and set commands used by RedisBackend. Expiry is ignored.
+func fakeRedis(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	strs := map[string]string{}
+	sets := map[string]map[string]bool{}
+	bulk := func(s string) string { return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n" }
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(rd)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					var reply string
+					switch strings.ToUpper(args[0]) {
+					case "GET":
+						if v, ok := strs[args[1]]; ok {
+							reply = bulk(v)
+						} else {
+							reply = "$-1\r\n"
+						}
+					case "SET":
+						strs[args[1]] = args[2]
+						reply = "+OK\r\n"
+					case "DEL":
+						n := 0
+						if _, ok := strs[args[1]]; ok {
+							delete(strs, args[1])
+							n = 1
+						}
+						reply = ":" + strconv.Itoa(n) + "\r\n"
+					case "SADD":
+						if sets[args[1]] == nil {
+							sets[args[1]] = map[string]bool{}
+						}
+						sets[args[1]][args[2]] = true
+						reply = ":1\r\n"
+					case "SREM":
+						delete(sets[args[1]], args[2])
+						reply = ":1\r\n"
+					case "SMEMBERS":
+						reply = "*" + strconv.Itoa(len(sets[args[1]])) + "\r\n"
+						for m := range sets[args[1]] {
+							reply += bulk(m)
+						}
+					default:
+						reply = "-ERR unknown command\r\n"
+					}
+					mu.Unlock()
+					if _, err := conn.Write([]byte(reply)); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		hdr, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(hdr[1:]))
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return nil, err
+		}
+		args = append(args, string(b[:size]))
+	}
+	return args, nil
+}
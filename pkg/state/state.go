@@ -0,0 +1,210 @@
+// Package state exports and imports the complete server state (sites, users,
+// site assignments, comments, the mail outbox, webhook deliveries and pipeline
+// run metadata) as a portable archive.
+//
+// The archive is a gzip-compressed tar file containing:
+//   - manifest.json: format and schema version, export time, row counts
+//   - <table>.jsonl: one JSON object per row, keyed by column name
+package state
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// FormatVersion is the version of the archive layout itself.
+const FormatVersion = 1
+
+const manifestName = "manifest.json"
+
+// Manifest describes an exported archive.
+type Manifest struct {
+	FormatVersion int              `json:"format_version"`
+	SchemaVersion int              `json:"schema_version"`
+	ExportedAt    int64            `json:"exported_at"`
+	Tables        map[string]int64 `json:"tables"`
+}
+
+// Export writes all state tables of database as an archive to w.
+func Export(ctx context.Context, database *db.DB, w io.Writer) (Manifest, error) {
+	if database == nil {
+		return Manifest{}, fmt.Errorf("db is nil")
+	}
+
+	schemaVersion, err := database.CurrentSchemaVersion(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manifest := Manifest{
+		FormatVersion: FormatVersion,
+		SchemaVersion: schemaVersion,
+		ExportedAt:    time.Now().Unix(),
+		Tables:        make(map[string]int64, len(db.StateTables)),
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	// Table files are buffered so that the manifest (written first) can carry the row counts.
+	files := make(map[string][]byte, len(db.StateTables))
+	for _, table := range db.StateTables {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		var count int64
+		err := database.DumpTable(ctx, table, func(row db.StateRow) error {
+			count++
+			return enc.Encode(row)
+		})
+		if err != nil {
+			return Manifest{}, err
+		}
+		manifest.Tables[table] = count
+		files[table] = buf.Bytes()
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("encode manifest: %w", err)
+	}
+	if err := writeTarFile(tw, manifestName, manifestJSON, manifest.ExportedAt); err != nil {
+		return Manifest{}, err
+	}
+	for _, table := range db.StateTables {
+		if err := writeTarFile(tw, table+".jsonl", files[table], manifest.ExportedAt); err != nil {
+			return Manifest{}, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return Manifest{}, fmt.Errorf("close tar: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return Manifest{}, fmt.Errorf("close gzip: %w", err)
+	}
+	return manifest, nil
+}
+
+// Import reads an archive from r and restores it into database.
+// Archives with a newer schema version than the database are rejected.
+func Import(ctx context.Context, database *db.DB, r io.Reader, replace bool) (Manifest, error) {
+	if database == nil {
+		return Manifest{}, fmt.Errorf("db is nil")
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("open gzip: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	var (
+		manifest      Manifest
+		foundManifest bool
+		tables        = make(map[string][]db.StateRow)
+	)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Manifest{}, fmt.Errorf("read tar: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if hdr.Name == manifestName {
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return Manifest{}, fmt.Errorf("decode manifest: %w", err)
+			}
+			foundManifest = true
+			continue
+		}
+
+		table, ok := strings.CutSuffix(hdr.Name, ".jsonl")
+		if !ok {
+			continue
+		}
+		rows, err := readRows(tr)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		tables[table] = rows
+	}
+
+	if !foundManifest {
+		return Manifest{}, fmt.Errorf("archive has no %s", manifestName)
+	}
+	if manifest.FormatVersion != FormatVersion {
+		return Manifest{}, fmt.Errorf("unsupported archive format version %d", manifest.FormatVersion)
+	}
+
+	schemaVersion, err := database.CurrentSchemaVersion(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if manifest.SchemaVersion > schemaVersion {
+		return Manifest{}, fmt.Errorf("archive schema version %d is newer than database schema version %d", manifest.SchemaVersion, schemaVersion)
+	}
+
+	if err := database.RestoreState(ctx, tables, replace); err != nil {
+		return Manifest{}, err
+	}
+	return manifest, nil
+}
+
+// writeTarFile performs its package-specific operation.
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime int64) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: time.Unix(modTime, 0),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("write tar header %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("write tar file %s: %w", name, err)
+	}
+	return nil
+}
+
+// readRows decodes JSON lines into rows, keeping numbers as json.Number.
+func readRows(r io.Reader) ([]db.StateRow, error) {
+	out := make([]db.StateRow, 0)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var row db.StateRow
+		if err := dec.Decode(&row); err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,167 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+// seedRows inserts one row (two for comments, a reply with its parent) into every state table.
+var seedRows = map[string][]string{
+	"sites":           {`INSERT INTO sites (id, site_key, title, status, created_at, updated_at, pipeline_paused_at) VALUES (7, 'blog', 'Blog', 'active', 10, 11, 12);`},
+	"users":           {`INSERT INTO users (id, password, firstname, lastname, email, created_at, updated_at, must_change_password) VALUES (3, 'hash', 'Ada', 'L', 'ada@example.com', 10, 11, 1);`},
+	"user_sites":      {`INSERT INTO user_sites (user_id, site_id) VALUES (3, 7);`},
+	"api_tokens":      {`INSERT INTO api_tokens (id, user_id, name, prefix, scopes, token_hash, created_at) VALUES (4, 3, 'ci', 'fm_ab', 'comments:read', 'deadbeef', 10);`},
+	"user_identities": {`INSERT INTO user_identities (id, user_id, issuer, subject, email, created_at) VALUES (5, 3, 'https://idp.example.com', 'sub-1', 'ada@example.com', 10);`},
+	"login_history":   {`INSERT INTO login_history (id, user_id, success, method, ip, created_at) VALUES (6, 3, 1, 'password', '192.0.2.1', 10);`},
+	"comments": {
+		`INSERT INTO comments (id, site_id, post_path, parent_id, status, author, email, body, created_at, updated_at) VALUES ('c1', 7, '/p/', NULL, 'approved', 'Ada', 'ada@example.com', 'Hi', 10, 11);`,
+		`INSERT INTO comments (id, site_id, post_path, parent_id, status, author, email, body, spam_score, created_at, updated_at) VALUES ('c2', 7, '/p/', 'c1', 'pending', 'Bob', 'bob@example.com', 'Re', 2, 12, 12);`,
+	},
+	"mail_outbox":        {`INSERT INTO mail_outbox (id, site_id, comment_id, kind, status, next_attempt_at, created_at, updated_at) VALUES (8, 7, 'c2', 'moderation', 'pending', 13, 12, 12);`},
+	"pipeline_runs":      {`INSERT INTO pipeline_runs (id, site_id, trigger_comment_id, state, step, created_at, finished_at) VALUES (9, 7, 'c1', 'success', 'push', 10, 20);`},
+	"pipeline_run_files": {`INSERT INTO pipeline_run_files (run_id, action, path) VALUES (9, 'created', 'content/p/comments/c1.md');`},
+	"blocklist":          {`INSERT INTO blocklist (id, site_id, kind, value, created_at) VALUES (10, 7, 'ip', '192.0.2.9', 10);`},
+	"comment_revisions":  {`INSERT INTO comment_revisions (id, site_id, comment_id, field, old_value, new_value, created_at) VALUES (11, 7, 'c1', 'body', 'Hello', 'Hi', 10);`},
+	"audit_log":          {`INSERT INTO audit_log (id, user_id, site_id, action, details, created_at) VALUES (12, 3, 7, 'comment.approve', '{}', 10);`},
+	"spam_rule_feedback": {`INSERT INTO spam_rule_feedback (site_id, rule, spam_count, ham_count, updated_at) VALUES (7, 'links', 2, 1, 10);`},
+	"webhook_deliveries": {`INSERT INTO webhook_deliveries (id, site_id, event, url, payload, status, created_at, updated_at) VALUES (13, 7, 'comment.created', 'https://hooks.example.com', '{"id":"c2"}', 'pending', 12, 12);`},
+}
+
+// openDB opens a migrated SQLite database in a temporary directory.
+func openDB(t *testing.T) *db.DB {
+	t.Helper()
+	d, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = d.Close() })
+	if err := d.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// dump returns all rows of the state tables.
+func dump(t *testing.T, d *db.DB) map[string][]db.StateRow {
+	t.Helper()
+	out := make(map[string][]db.StateRow)
+	for _, table := range db.StateTables {
+		err := d.DumpTable(context.Background(), table, func(row db.StateRow) error {
+			out[table] = append(out[table], row)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := openDB(t)
+	for _, table := range db.StateTables {
+		stmts, ok := seedRows[table]
+		if !ok {
+			t.Fatalf("no seed rows for state table %s", table)
+		}
+		for _, stmt := range stmts {
+			if _, err := src.SQL.ExecContext(ctx, stmt); err != nil {
+				t.Fatalf("seed %s: %v", table, err)
+			}
+		}
+	}
+
+	var archive bytes.Buffer
+	manifest, err := Export(ctx, src, &archive)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	for table, stmts := range seedRows {
+		if manifest.Tables[table] != int64(len(stmts)) {
+			t.Fatalf("manifest counts %d rows in %s, want %d", manifest.Tables[table], table, len(stmts))
+		}
+	}
+
+	dst := openDB(t)
+	if _, err := Import(ctx, dst, bytes.NewReader(archive.Bytes()), false); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	want, got := dump(t, src), dump(t, dst)
+	for _, table := range db.StateTables {
+		if !reflect.DeepEqual(got[table], want[table]) {
+			t.Fatalf("%s after import:\n got  %v\n want %v", table, got[table], want[table])
+		}
+	}
+
+	// A second import into the filled database needs replace and keeps all rows.
+	if _, err := Import(ctx, dst, bytes.NewReader(archive.Bytes()), false); err == nil {
+		t.Fatal("import into a filled database succeeded without replace")
+	}
+	if _, err := Import(ctx, dst, bytes.NewReader(archive.Bytes()), true); err != nil {
+		t.Fatalf("Import with replace: %v", err)
+	}
+	if got := dump(t, dst); !reflect.DeepEqual(got, want) {
+		t.Fatalf("state after import with replace:\n got  %v\n want %v", got, want)
+	}
+}
+
+// Import deletes the state tables, and with them every row that cascades from
+// them. Each such table must either be part of the state or left out on purpose.
+func TestCascadingTablesAreClassified(t *testing.T) {
+	d := openDB(t)
+	ctx := context.Background()
+
+	rows, err := d.SQL.QueryContext(ctx, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_version';`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range tables {
+		state := slices.Contains(db.StateTables, table)
+		transient := slices.Contains(db.TransientTables, table)
+		if state == transient {
+			t.Errorf("table %s must be listed in exactly one of StateTables and TransientTables", table)
+		}
+
+		parents, err := d.SQL.QueryContext(ctx, `SELECT "table" FROM pragma_foreign_key_list(?);`, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for parents.Next() {
+			var parent string
+			if err := parents.Scan(&parent); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Contains(db.StateTables, parent) {
+				continue
+			}
+			if !state && !transient {
+				t.Errorf("table %s cascades from state table %s and would be emptied by an import", table, parent)
+			}
+			if state && slices.Index(db.StateTables, parent) > slices.Index(db.StateTables, table) {
+				t.Errorf("state table %s is restored before its parent %s", table, parent)
+			}
+		}
+		if err := parents.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
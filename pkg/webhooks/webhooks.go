@@ -0,0 +1,399 @@
+// Package webhooks delivers signed JSON notifications about comment and pipeline
+// events to the webhook URLs configured per comment site.
+//
+// Each request carries the headers X-Fyndmark-Event, X-Fyndmark-Delivery and
+// X-Fyndmark-Timestamp, and X-Fyndmark-Signature = "sha256=" + hex(HMAC-SHA256(secret,
+// timestamp + "." + body)). Failed deliveries are retried with exponential backoff;
+// every delivery, its payload and its last attempt are logged in the
+// webhook_deliveries table. Deliveries still pending at shutdown are resumed on the
+// next start, so receivers may see a delivery ID twice.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+	"github.com/geschke/fyndmark/pkg/secrets"
+)
+
+const (
+	EventCommentCreated   = "comment.created"
+	EventCommentApproved  = "comment.approved"
+	EventCommentRejected  = "comment.rejected"
+	EventCommentSpam      = "comment.spam"
+	EventPipelineSuccess  = "pipeline.success"
+	EventPipelineFailed   = "pipeline.failed"
+	defaultQueueSize      = 64
+	defaultWorkers        = 2
+	maxAttempts           = 5
+	initialBackoff        = 2 * time.Second
+	requestTimeout        = 10 * time.Second
+	maxStoredErrorMessage = 500
+)
+
+// Events lists all event types that can be configured.
+var Events = []string{
+	EventCommentCreated,
+	EventCommentApproved,
+	EventCommentRejected,
+	EventCommentSpam,
+	EventPipelineSuccess,
+	EventPipelineFailed,
+}
+
+type Payload struct {
+	DeliveryID int64  `json:"delivery_id"`
+	Event      string `json:"event"`
+	SiteKey    string `json:"site_key"`
+	CreatedAt  int64  `json:"created_at"`
+	Data       any    `json:"data"`
+}
+
+type delivery struct {
+	id     int64
+	event  string
+	url    string
+	secret string
+	body   []byte
+	// attempts is the number of attempts made so far.
+	attempts int
+}
+
+type Dispatcher struct {
+	db      *db.DB
+	client  *http.Client
+	queue   chan delivery
+	stopCh  chan struct{}
+	stopped atomic.Bool
+	wg      sync.WaitGroup
+	// backoff is the delay before the first retry; shortened in tests. Retries wait
+	// on a timer, not in a worker, so a dead endpoint does not hold up other sites.
+	backoff time.Duration
+}
+
+// NewDispatcher constructs and returns a new instance.
+func NewDispatcher(database *db.DB) *Dispatcher {
+	return &Dispatcher{
+		db:      database,
+		client:  &http.Client{Timeout: requestTimeout},
+		queue:   make(chan delivery, defaultQueueSize),
+		stopCh:  make(chan struct{}),
+		backoff: initialBackoff,
+	}
+}
+
+// Start starts processing and resumes the deliveries left pending by an earlier run.
+func (d *Dispatcher) Start() {
+	if d == nil {
+		return
+	}
+	for i := 0; i < defaultWorkers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for {
+				select {
+				case <-d.stopCh:
+					return
+				case job := <-d.queue:
+					d.attempt(job)
+				}
+			}
+		}()
+	}
+
+	// Listed before Start returns, so deliveries fired afterwards are not queued twice.
+	pending := d.pendingDeliveries()
+	if len(pending) == 0 {
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for _, job := range pending {
+			select {
+			case <-d.stopCh:
+				return
+			case d.queue <- job:
+			}
+		}
+	}()
+}
+
+// Stop stops processing and releases resources.
+// Deliveries still waiting for a retry stay logged as pending and are resumed by the next Start.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	if d.stopped.CompareAndSwap(false, true) {
+		close(d.stopCh)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Fire sends an event to all webhooks of the site that subscribed to it.
+// It never blocks the caller on network I/O; failures are logged only.
+func (d *Dispatcher) Fire(ctx context.Context, siteKey string, event string, data any) {
+	if d == nil || d.db == nil || d.stopped.Load() {
+		return
+	}
+
+	siteCfg, ok := config.Cfg.CommentSites[siteKey]
+	if !ok || len(siteCfg.Webhooks) == 0 {
+		return
+	}
+
+	siteID, found, err := d.db.GetSiteIDByKey(ctx, siteKey)
+	if err != nil || !found {
+		log.Printf("webhook: resolve site failed (site=%s event=%s): %v", siteKey, event, err)
+		return
+	}
+
+	for _, hook := range siteCfg.Webhooks {
+		if !subscribed(hook, event) {
+			continue
+		}
+
+		secret, err := secrets.Decrypt(hook.Secret)
+		if err != nil {
+			log.Printf("webhook: secret not usable (site=%s event=%s): %v", siteKey, event, err)
+			continue
+		}
+
+		hookURL := strings.TrimSpace(hook.URL)
+		deliveryID, err := d.db.CreateWebhookDelivery(ctx, siteID, event, hookURL)
+		if err != nil {
+			log.Printf("webhook: log delivery failed (site=%s event=%s): %v", siteKey, event, err)
+			continue
+		}
+
+		body, err := json.Marshal(Payload{
+			DeliveryID: deliveryID,
+			Event:      event,
+			SiteKey:    siteKey,
+			CreatedAt:  time.Now().Unix(),
+			Data:       data,
+		})
+		if err != nil {
+			_ = d.db.RecordWebhookAttempt(ctx, deliveryID, db.DeliveryFailed, 0, 0, "encode payload: "+err.Error())
+			continue
+		}
+		if err := d.db.SetWebhookDeliveryPayload(ctx, deliveryID, string(body)); err != nil {
+			log.Printf("webhook: store payload failed (delivery_id=%d): %v", deliveryID, err)
+		}
+
+		d.enqueue(delivery{id: deliveryID, event: event, url: hookURL, secret: secret, body: body})
+	}
+}
+
+// enqueue hands a delivery to the workers. If the queue is full, it tries again after
+// the initial backoff; after Stop the delivery stays pending for the next Start.
+func (d *Dispatcher) enqueue(job delivery) {
+	if d.stopped.Load() {
+		return
+	}
+	select {
+	case d.queue <- job:
+	default:
+		time.AfterFunc(d.backoff, func() { d.enqueue(job) })
+	}
+}
+
+// attempt sends a delivery once and schedules a retry with exponential backoff if it
+// failed and attempts are left.
+func (d *Dispatcher) attempt(job delivery) {
+	job.attempts++
+	statusCode, err := d.send(job)
+
+	status := db.DeliveryPending
+	errMsg := ""
+	switch {
+	case err == nil:
+		status = db.DeliveryDelivered
+	case job.attempts >= maxAttempts:
+		status = db.DeliveryFailed
+	}
+	if err != nil {
+		errMsg = truncate(err.Error(), maxStoredErrorMessage)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if dbErr := d.db.RecordWebhookAttempt(ctx, job.id, status, job.attempts, statusCode, errMsg); dbErr != nil {
+		log.Printf("webhook: record attempt failed (delivery_id=%d): %v", job.id, dbErr)
+	}
+	cancel()
+
+	if err == nil {
+		return
+	}
+	log.Printf("webhook: delivery failed (delivery_id=%d event=%s attempt=%d/%d): %v", job.id, job.event, job.attempts, maxAttempts, err)
+	if status == db.DeliveryFailed {
+		return
+	}
+	time.AfterFunc(d.backoff<<(job.attempts-1), func() { d.enqueue(job) })
+}
+
+// pendingDeliveries loads the pending deliveries of the database with the secrets of
+// their webhooks. Deliveries whose webhook is no longer configured are marked failed.
+func (d *Dispatcher) pendingDeliveries() []delivery {
+	if d.db == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := d.db.ListPendingWebhookDeliveries(ctx)
+	if err != nil {
+		log.Printf("webhook: load pending deliveries failed: %v", err)
+		return nil
+	}
+
+	var out []delivery
+	for _, w := range rows {
+		secret, err := hookSecret(w)
+		if err == nil && w.Payload == "" {
+			err = errors.New("payload was not stored")
+		}
+		if err != nil {
+			if dbErr := d.db.RecordWebhookAttempt(ctx, w.ID, db.DeliveryFailed, w.Attempts, 0, truncate("resume: "+err.Error(), maxStoredErrorMessage)); dbErr != nil {
+				log.Printf("webhook: record attempt failed (delivery_id=%d): %v", w.ID, dbErr)
+			}
+			continue
+		}
+		out = append(out, delivery{id: w.ID, event: w.Event, url: w.URL, secret: secret, body: []byte(w.Payload), attempts: w.Attempts})
+	}
+	if len(out) > 0 {
+		log.Printf("webhook: resuming %d pending deliveries", len(out))
+	}
+	return out
+}
+
+// hookSecret returns the secret of the configured webhook a pending delivery was made for.
+func hookSecret(w db.WebhookDelivery) (string, error) {
+	siteCfg, ok := config.Cfg.CommentSites[w.SiteKey]
+	if !ok {
+		return "", fmt.Errorf("site %s is no longer configured", w.SiteKey)
+	}
+	for _, hook := range siteCfg.Webhooks {
+		if strings.TrimSpace(hook.URL) == w.URL && subscribed(hook, w.Event) {
+			return secrets.Decrypt(hook.Secret)
+		}
+	}
+	return "", errors.New("webhook is no longer configured")
+}
+
+// send performs a single delivery attempt and returns the HTTP status code (0 if none).
+func (d *Dispatcher) send(job delivery) (int, error) {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, job.url, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fyndmark-webhooks")
+	req.Header.Set("X-Fyndmark-Event", job.event)
+	req.Header.Set("X-Fyndmark-Delivery", strconv.FormatInt(job.id, 10))
+	req.Header.Set("X-Fyndmark-Timestamp", ts)
+	req.Header.Set("X-Fyndmark-Signature", Sign(job.secret, ts, job.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, errors.New("unexpected status " + resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value for a request body.
+// Receivers should recompute it and compare in constant time.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateConfig checks the configured event names of all webhooks.
+func ValidateConfig() error {
+	for siteKey, siteCfg := range config.Cfg.CommentSites {
+		for i, hook := range siteCfg.Webhooks {
+			for _, ev := range hook.Events {
+				if !isKnownEvent(ev) {
+					return fmt.Errorf("comment_sites.%s.webhooks[%d].events: unknown event %q (allowed: %s)", siteKey, i, ev, strings.Join(Events, ", "))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// subscribed reports whether a webhook receives the event.
+func subscribed(hook config.WebhookConfig, event string) bool {
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, ev := range hook.Events {
+		if strings.TrimSpace(ev) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownEvent performs its package-specific operation.
+func isKnownEvent(event string) bool {
+	for _, ev := range Events {
+		if strings.TrimSpace(event) == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,328 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geschke/fyndmark/config"
+	"github.com/geschke/fyndmark/pkg/db"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"comment.approved"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := Sign("s3cret", "1700000000", body); got != want {
+		t.Fatalf("Sign = %q, want %q", got, want)
+	}
+	if Sign("other", "1700000000", body) == want {
+		t.Fatal("signature does not depend on the secret")
+	}
+	if Sign("s3cret", "1700000001", body) == want {
+		t.Fatal("signature does not depend on the timestamp")
+	}
+}
+
+// receiver is a webhook endpoint that verifies the signature of every request and
+// answers with the next of its status codes (the last one repeats).
+type receiver struct {
+	t      *testing.T
+	secret string
+	codes  []int
+
+	mu       sync.Mutex
+	attempts int
+	payloads []Payload
+}
+
+func (rv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	ts := r.Header.Get("X-Fyndmark-Timestamp")
+	if got, want := r.Header.Get("X-Fyndmark-Signature"), Sign(rv.secret, ts, body); !hmac.Equal([]byte(got), []byte(want)) {
+		rv.t.Errorf("signature = %q, want %q", got, want)
+	}
+	if n, err := strconv.ParseInt(ts, 10, 64); err != nil || time.Since(time.Unix(n, 0)) > time.Minute {
+		rv.t.Errorf("timestamp = %q", ts)
+	}
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		rv.t.Errorf("decode payload: %v", err)
+	}
+	if r.Header.Get("X-Fyndmark-Event") != p.Event || r.Header.Get("X-Fyndmark-Delivery") != strconv.FormatInt(p.DeliveryID, 10) {
+		rv.t.Errorf("headers %v do not match payload %+v", r.Header, p)
+	}
+
+	rv.mu.Lock()
+	code := rv.codes[min(rv.attempts, len(rv.codes)-1)]
+	rv.attempts++
+	rv.payloads = append(rv.payloads, p)
+	rv.mu.Unlock()
+	w.WriteHeader(code)
+}
+
+// deliveryRow is the logged state of a webhook delivery.
+type deliveryRow struct {
+	status     string
+	attempts   int
+	statusCode sql.NullInt64
+	lastError  sql.NullString
+}
+
+func TestDeliver(t *testing.T) {
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+
+	database := openDB(t)
+	ctx := context.Background()
+
+	// fire sends one event to a webhook at hookURL and waits for the final result.
+	fire := func(t *testing.T, hookURL string) deliveryRow {
+		t.Helper()
+		config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+			"blog": {Webhooks: []config.WebhookConfig{
+				{URL: hookURL, Secret: "s3cret", Events: []string{EventCommentApproved}},
+				{URL: hookURL, Secret: "s3cret", Events: []string{EventPipelineFailed}},
+			}},
+		}
+		d := NewDispatcher(database)
+		d.backoff = time.Millisecond
+		d.Start()
+		defer func() { _ = d.Stop(ctx) }()
+
+		d.Fire(ctx, "blog", EventCommentApproved, map[string]string{"comment_id": "c1"})
+
+		var row deliveryRow
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			err := database.SQL.QueryRowContext(ctx, `
+SELECT status, attempts, last_status_code, last_error FROM webhook_deliveries ORDER BY id DESC LIMIT 1`).
+				Scan(&row.status, &row.attempts, &row.statusCode, &row.lastError)
+			if err != nil {
+				t.Fatalf("load delivery: %v", err)
+			}
+			if row.status != db.DeliveryPending || time.Now().After(deadline) {
+				return row
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("retried until delivered", func(t *testing.T) {
+		rv := &receiver{t: t, secret: "s3cret", codes: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent}}
+		srv := httptest.NewServer(rv)
+		defer srv.Close()
+
+		row := fire(t, srv.URL)
+		if row.status != db.DeliveryDelivered || row.attempts != 3 || row.statusCode.Int64 != http.StatusNoContent || row.lastError.Valid {
+			t.Fatalf("delivery = %+v", row)
+		}
+		rv.mu.Lock()
+		defer rv.mu.Unlock()
+		// Only the subscribed webhook receives the event; retries resend the same payload.
+		if rv.attempts != 3 {
+			t.Fatalf("receiver got %d requests, want 3", rv.attempts)
+		}
+		for _, p := range rv.payloads {
+			if p.Event != EventCommentApproved || p.SiteKey != "blog" || p.DeliveryID != rv.payloads[0].DeliveryID {
+				t.Fatalf("payload = %+v", p)
+			}
+		}
+	})
+
+	t.Run("failed after max attempts", func(t *testing.T) {
+		rv := &receiver{t: t, secret: "s3cret", codes: []int{http.StatusServiceUnavailable}}
+		srv := httptest.NewServer(rv)
+		defer srv.Close()
+
+		row := fire(t, srv.URL)
+		if row.status != db.DeliveryFailed || row.attempts != maxAttempts || row.statusCode.Int64 != http.StatusServiceUnavailable || !row.lastError.Valid {
+			t.Fatalf("delivery = %+v", row)
+		}
+		rv.mu.Lock()
+		defer rv.mu.Unlock()
+		if rv.attempts != maxAttempts {
+			t.Fatalf("receiver got %d requests, want %d", rv.attempts, maxAttempts)
+		}
+	})
+
+	t.Run("unreachable receiver", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		hookURL := srv.URL
+		srv.Close()
+
+		row := fire(t, hookURL)
+		if row.status != db.DeliveryFailed || row.attempts != maxAttempts || row.statusCode.Valid || !row.lastError.Valid {
+			t.Fatalf("delivery = %+v", row)
+		}
+	})
+}
+
+// openDB returns a migrated database with the site "blog".
+func openDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "webhooks.sqlite"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate db: %v", err)
+	}
+	if _, err := database.SyncSites(context.Background(), map[string]string{"blog": "Blog"}, db.SyncOptions{}); err != nil {
+		t.Fatalf("sync sites: %v", err)
+	}
+	return database
+}
+
+// waitForDelivery polls the delivery until it left the pending status.
+func waitForDelivery(t *testing.T, database *db.DB, id int64) deliveryRow {
+	t.Helper()
+	var row deliveryRow
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := database.SQL.QueryRow(`SELECT status, attempts, last_status_code, last_error FROM webhook_deliveries WHERE id = ?`, id).
+			Scan(&row.status, &row.attempts, &row.statusCode, &row.lastError)
+		if err != nil {
+			t.Fatalf("load delivery %d: %v", id, err)
+		}
+		if row.status != db.DeliveryPending || time.Now().After(deadline) {
+			return row
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResumePendingDeliveries(t *testing.T) {
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	database := openDB(t)
+	ctx := context.Background()
+
+	rv := &receiver{t: t, secret: "s3cret", codes: []int{http.StatusOK}}
+	srv := httptest.NewServer(rv)
+	defer srv.Close()
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog": {Webhooks: []config.WebhookConfig{{URL: srv.URL, Secret: "s3cret"}}},
+	}
+
+	siteID, _, err := database.GetSiteIDByKey(ctx, "blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pending logs a delivery left pending by an earlier process after two attempts.
+	pending := func(hookURL string) int64 {
+		id, err := database.CreateWebhookDelivery(ctx, siteID, EventCommentCreated, hookURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := json.Marshal(Payload{DeliveryID: id, Event: EventCommentCreated, SiteKey: "blog", Data: map[string]string{"comment_id": "c1"}})
+		if err := database.SetWebhookDeliveryPayload(ctx, id, string(body)); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.RecordWebhookAttempt(ctx, id, db.DeliveryPending, 2, http.StatusBadGateway, "unexpected status"); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	resumed := pending(srv.URL)
+	removed := pending("https://hooks.example.invalid/removed")
+
+	d := NewDispatcher(database)
+	d.backoff = time.Millisecond
+	d.Start()
+	defer func() { _ = d.Stop(ctx) }()
+
+	if row := waitForDelivery(t, database, resumed); row.status != db.DeliveryDelivered || row.attempts != 3 || row.lastError.Valid {
+		t.Fatalf("resumed delivery = %+v", row)
+	}
+	if row := waitForDelivery(t, database, removed); row.status != db.DeliveryFailed || row.attempts != 2 || !row.lastError.Valid {
+		t.Fatalf("delivery of a removed webhook = %+v", row)
+	}
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	if len(rv.payloads) != 1 || rv.payloads[0].DeliveryID != resumed || rv.payloads[0].Event != EventCommentCreated {
+		t.Fatalf("receiver got %+v", rv.payloads)
+	}
+}
+
+func TestRetriesDoNotBlockWorkers(t *testing.T) {
+	oldCfg := config.Cfg
+	t.Cleanup(func() { config.Cfg = oldCfg })
+	database := openDB(t)
+	ctx := context.Background()
+
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer dead.Close()
+	rv := &receiver{t: t, secret: "s3cret", codes: []int{http.StatusNoContent}}
+	live := httptest.NewServer(rv)
+	defer live.Close()
+	config.Cfg.CommentSites = map[string]config.CommentsSiteConfig{
+		"blog": {Webhooks: []config.WebhookConfig{
+			{URL: dead.URL, Secret: "s3cret", Events: []string{EventCommentApproved}},
+			{URL: live.URL, Secret: "s3cret", Events: []string{EventPipelineFailed}},
+		}},
+	}
+
+	d := NewDispatcher(database)
+	d.backoff = time.Hour
+	d.Start()
+
+	// More failing deliveries than workers, each waiting an hour for its retry.
+	for i := 0; i < defaultWorkers+1; i++ {
+		d.Fire(ctx, "blog", EventCommentApproved, nil)
+	}
+	d.Fire(ctx, "blog", EventPipelineFailed, nil)
+
+	var id int64
+	if err := database.SQL.QueryRow(`SELECT id FROM webhook_deliveries WHERE event = ?`, EventPipelineFailed).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if row := waitForDelivery(t, database, id); row.status != db.DeliveryDelivered {
+		t.Fatalf("delivery behind the failing ones = %+v", row)
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := d.Stop(stopCtx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	var pending int
+	if err := database.SQL.QueryRow(`SELECT COUNT(1) FROM webhook_deliveries WHERE status = ?`, db.DeliveryPending).Scan(&pending); err != nil || pending != defaultWorkers+1 {
+		t.Fatalf("pending deliveries after Stop: %d, %v", pending, err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"abcdef", 3, "abc"},
+		{"aäb", 2, "a"},
+		{"äöü", 4, "äö"},
+		{"äöü", 1, ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.in, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
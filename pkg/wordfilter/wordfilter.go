@@ -0,0 +1,237 @@
+// Package wordfilter checks comment bodies and author names against a per-site wordlist.
+package wordfilter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+// Actions applied to submissions containing a listed term.
+const (
+	ActionHold   = "hold"
+	ActionReject = "reject"
+	ActionMask   = "mask"
+)
+
+// Match is one occurrence of a listed term.
+type Match struct {
+	// Field is "author" or "body".
+	Field string
+	// Term is the wordlist entry that matched.
+	Term string
+}
+
+// String returns the match as "field:term", the format stored with the comment.
+func (m Match) String() string {
+	return m.Field + ":" + m.Term
+}
+
+// Filter matches text against a wordlist. Terms match case-insensitively on
+// word boundaries; a term may consist of several words.
+type Filter struct {
+	Action string
+	terms  []string
+}
+
+// Enabled reports whether a word filter is configured.
+func Enabled(cfg config.WordFilterConfig) bool {
+	return len(cfg.Words) > 0 || strings.TrimSpace(cfg.File) != ""
+}
+
+// Action returns the normalized action of the config (default hold).
+func Action(cfg config.WordFilterConfig) string {
+	switch a := strings.ToLower(strings.TrimSpace(cfg.Action)); a {
+	case ActionReject, ActionMask:
+		return a
+	default:
+		return ActionHold
+	}
+}
+
+// Load builds the filter of a site from the inline words and the wordlist file.
+// It returns nil if no filter is configured.
+func Load(cfg config.WordFilterConfig) (*Filter, error) {
+	if !Enabled(cfg) {
+		return nil, nil
+	}
+
+	terms := append([]string(nil), cfg.Words...)
+	if path := strings.TrimSpace(cfg.File); path != "" {
+		fileTerms, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, fileTerms...)
+	}
+
+	return New(Action(cfg), terms), nil
+}
+
+// New returns a filter for the given terms. Empty and duplicate terms are ignored.
+func New(action string, terms []string) *Filter {
+	f := &Filter{Action: action}
+	seen := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		t = strings.ToLower(strings.Join(strings.Fields(t), " "))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		f.terms = append(f.terms, t)
+	}
+	return f
+}
+
+// Find returns the terms occurring in text, each at most once, in wordlist order.
+func (f *Filter) Find(field, text string) []Match {
+	if f == nil {
+		return nil
+	}
+	var out []Match
+	for _, t := range f.terms {
+		if len(spans(text, t)) > 0 {
+			out = append(out, Match{Field: field, Term: t})
+		}
+	}
+	return out
+}
+
+// Mask replaces every occurrence of a listed term in text with asterisks
+// (one per character).
+func (f *Filter) Mask(text string) string {
+	if f == nil {
+		return text
+	}
+	for _, t := range f.terms {
+		found := spans(text, t)
+		if len(found) == 0 {
+			continue
+		}
+		var sb strings.Builder
+		last := 0
+		for _, s := range found {
+			sb.WriteString(text[last:s[0]])
+			sb.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[s[0]:s[1]])))
+			last = s[1]
+		}
+		sb.WriteString(text[last:])
+		text = sb.String()
+	}
+	return text
+}
+
+// spans returns the byte ranges of all occurrences of term in text.
+func spans(text, term string) [][2]int {
+	var out [][2]int
+
+	prev := rune(-1)
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if !isWordRune(prev) && isWordRune(r) {
+			if end, ok := matchAt(text, i, term); ok {
+				out = append(out, [2]int{i, end})
+				prev, _ = utf8.DecodeLastRuneInString(text[:end])
+				i = end
+				continue
+			}
+		}
+		prev = r
+		i += size
+	}
+	return out
+}
+
+// matchAt reports whether term starts at text[i:] and ends on a word boundary.
+// Whitespace in the term matches any run of whitespace in the text.
+func matchAt(text string, i int, term string) (int, bool) {
+	j := i
+	for _, tr := range term {
+		if j >= len(text) {
+			return 0, false
+		}
+		r, size := utf8.DecodeRuneInString(text[j:])
+		if tr == ' ' {
+			if !unicode.IsSpace(r) {
+				return 0, false
+			}
+			for j < len(text) {
+				r, size = utf8.DecodeRuneInString(text[j:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				j += size
+			}
+			continue
+		}
+		if unicode.ToLower(r) != tr && !strings.EqualFold(string(r), string(tr)) {
+			return 0, false
+		}
+		j += size
+	}
+	if j < len(text) {
+		if r, _ := utf8.DecodeRuneInString(text[j:]); isWordRune(r) {
+			return 0, false
+		}
+	}
+	return j, true
+}
+
+// isWordRune reports whether r is part of a word.
+func isWordRune(r rune) bool {
+	return r >= 0 && (unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r))
+}
+
+type cachedFile struct {
+	modTime time.Time
+	terms   []string
+}
+
+var (
+	fileMu    sync.Mutex
+	fileCache = map[string]cachedFile{}
+)
+
+// readFile returns the terms of a wordlist file (one term per line, "#" starts a comment).
+// The file is read again when its modification time changes.
+func readFile(path string) ([]string, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("wordlist: %w", err)
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	if c, ok := fileCache[path]; ok && c.modTime.Equal(st.ModTime()) {
+		return c.terms, nil
+	}
+
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("wordlist: %w", err)
+	}
+	defer func() { _ = fh.Close() }()
+
+	var terms []string
+	sc := bufio.NewScanner(fh)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		terms = append(terms, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("wordlist %s: %w", path, err)
+	}
+
+	fileCache[path] = cachedFile{modTime: st.ModTime(), terms: terms}
+	return terms, nil
+}
@@ -0,0 +1,55 @@
+package wordfilter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/geschke/fyndmark/config"
+)
+
+func TestFindWholeWordsCaseInsensitive(t *testing.T) {
+	f := New(ActionHold, []string{"Darn", "cheap  pills", "darn"})
+
+	got := f.Find("body", "DARN it, buy Cheap\npills now. Darned classic.")
+	if len(got) != 2 || got[0].String() != "body:darn" || got[1].String() != "body:cheap pills" {
+		t.Fatalf("unexpected matches: %v", got)
+	}
+
+	if got := f.Find("body", "darned, undarn"); len(got) != 0 {
+		t.Fatalf("expected no matches inside words, got %v", got)
+	}
+}
+
+func TestMask(t *testing.T) {
+	f := New(ActionMask, []string{"darn", "größe"})
+
+	if got := f.Mask("Darn! This darn thing, darnit."); got != "****! This **** thing, darnit." {
+		t.Fatalf("unexpected masked text: %q", got)
+	}
+	if got := f.Mask("Die GRÖSSE passt, die Größe nicht"); got != "Die GRÖSSE passt, die ***** nicht" {
+		t.Fatalf("unexpected masked text: %q", got)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# comment\n\nspam\n  eggs  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Load(config.WordFilterConfig{Action: "REJECT", Words: []string{"ham"}, File: path})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if f.Action != ActionReject {
+		t.Fatalf("expected action reject, got %q", f.Action)
+	}
+	if got := f.Find("author", "ham, spam and eggs"); len(got) != 3 {
+		t.Fatalf("expected 3 matches, got %v", got)
+	}
+
+	if f, err := Load(config.WordFilterConfig{}); f != nil || err != nil {
+		t.Fatalf("expected no filter without words, got %v, %v", f, err)
+	}
+}